@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -31,6 +32,8 @@ var (
 	tenantID    string
 	windowRange time.Duration
 	blockID     string
+	keyFile     string
+	objectsFile string
 
 	queryEndpoint string
 	traceID       string
@@ -45,6 +48,8 @@ func init() {
 	flag.StringVar(&s3Pass, "s3-pass", "", "s3 password")
 	flag.StringVar(&tenantID, "tenant-id", "", "tenant-id that contains the bucket")
 	flag.StringVar(&blockID, "block-id", "", "block-id to dump (optional)")
+	flag.StringVar(&keyFile, "key-file", "", "file holding the hex encoded key of encrypted blocks (optional)")
+	flag.StringVar(&objectsFile, "objects-file", "", "local copy of the objects of a block to print the stats footer of")
 	flag.DurationVar(&windowRange, "window-range", 4*time.Hour, "block time window range for compaction")
 
 	flag.StringVar(&queryEndpoint, "query-endpoint", "", "tempo query endpoint")
@@ -69,6 +74,14 @@ func main() {
 		return
 	}
 
+	if len(objectsFile) > 0 {
+		err := dumpStats(objectsFile)
+		if err != nil {
+			fmt.Println("error reading stats, err:", err)
+		}
+		return
+	}
+
 	if len(backend) == 0 {
 		fmt.Println("-backend is required")
 		return
@@ -84,6 +97,15 @@ func main() {
 		return
 	}
 
+	if len(keyFile) > 0 {
+		k, err := encoding.LoadEncryptionKey(keyFile)
+		if err != nil {
+			fmt.Println("error loading key, err:", err)
+			return
+		}
+		encoding.RegisterEncryptionKey(k)
+	}
+
 	r, _, c, err := getBackendUtils(backend, bucket, s3Endpoint, s3User, s3Pass)
 	if err != nil {
 		fmt.Printf("error creating backend utils, please check config")
@@ -140,7 +162,12 @@ func dumpBlock(r tempodb_backend.Reader, c tempodb_backend.Compactor, tenantID s
 
 	fmt.Println("Searching for dupes ...")
 
-	iter, err := encoding.NewBackendIterator(tenantID, id, 10*1024*1024, r)
+	format, err := meta.PageFormat()
+	if err != nil {
+		return err
+	}
+
+	iter, err := encoding.NewBackendIterator(tenantID, id, format, 10*1024*1024, r)
 	if err != nil {
 		return err
 	}
@@ -182,6 +209,8 @@ func dumpBucket(r tempodb_backend.Reader, c tempodb_backend.Compactor, tenantID
 	fmt.Println("total blocks: ", len(blockIDs))
 
 	totalObjects := 0
+	totalSpans := uint64(0)
+	totalSize := uint64(0)
 	out := make([][]string, 0)
 	for _, id := range blockIDs {
 		meta, err := r.BlockMeta(context.Background(), id, tenantID)
@@ -195,6 +224,9 @@ func dumpBucket(r tempodb_backend.Reader, c tempodb_backend.Compactor, tenantID
 		}
 
 		indexBytes, err := r.Index(context.Background(), id, tenantID)
+		if err == nil && meta != nil {
+			indexBytes, err = meta.OpenIndex(indexBytes)
+		}
 		totalIDs := -1
 		duplicateIDs := -1
 		if err == nil {
@@ -212,39 +244,78 @@ func dumpBucket(r tempodb_backend.Reader, c tempodb_backend.Compactor, tenantID
 		}
 
 		objects, lvl, window, start, end := blockStats(meta, compactedMeta, windowRange)
+		spans, size := blockSize(meta, compactedMeta)
 		out = append(out, []string{
 			id.String(),
 			strconv.Itoa(int(lvl)),
 			strconv.Itoa(totalIDs),
 			strconv.Itoa(objects),
+			strconv.FormatUint(spans, 10),
+			strconv.FormatUint(size, 10),
 			strconv.Itoa(int(window)),
 			strconv.Itoa(duplicateIDs),
 			start.Format(time.RFC3339),
 			end.Format(time.RFC3339),
 		})
 		totalObjects += objects
+		totalSpans += spans
+		totalSize += size
 	}
 
 	sort.Slice(out, func(i, j int) bool {
 		lineI := out[i]
 		lineJ := out[j]
 
-		if lineI[4] == lineJ[4] {
+		if lineI[6] == lineJ[6] {
 			return lineI[1] < lineJ[1]
 		}
 
-		return lineI[4] < lineJ[4]
+		return lineI[6] < lineJ[6]
 	})
 
 	w := tablewriter.NewWriter(os.Stdout)
-	w.SetHeader([]string{"id", "lvl", "idx", "count", "window", "dupe", "start", "end"})
-	w.SetFooter([]string{"", "", "", strconv.Itoa(totalObjects), "", "", "", ""})
+	w.SetHeader([]string{"id", "lvl", "idx", "count", "spans", "bytes", "window", "dupe", "start", "end"})
+	w.SetFooter([]string{"", "", "", strconv.Itoa(totalObjects), strconv.FormatUint(totalSpans, 10), strconv.FormatUint(totalSize, 10), "", "", "", ""})
 	w.AppendBulk(out)
 	w.Render()
 
 	return nil
 }
 
+func dumpStats(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	stats, err := encoding.ReadBlockStats(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Records       : ", stats.TotalRecords)
+	fmt.Println("Total Objects : ", stats.TotalObjects)
+	fmt.Println("Min ID        : ", hex.EncodeToString(stats.MinID))
+	fmt.Println("Max ID        : ", hex.EncodeToString(stats.MaxID))
+	fmt.Println("Size          : ", stats.Size)
+	fmt.Println("Uncompressed  : ", stats.UncompressedSize)
+	fmt.Printf("Compression   :  %.2f\n", stats.CompressionRatio())
+	fmt.Println("Pages         : ", len(stats.PageOffsets))
+	if stats.TimeGroupWindow > 0 {
+		fmt.Println("Time Groups   : ", len(stats.TimeGroups), "of", stats.TimeGroupWindow)
+		for _, g := range stats.TimeGroups {
+			fmt.Println("  ", g.Start.UTC().Format(time.RFC3339), len(g.Records), "pages")
+		}
+	}
+
+	return nil
+}
+
 func blockStats(meta *encoding.BlockMeta, compactedMeta *encoding.CompactedBlockMeta, windowRange time.Duration) (int, uint8, int64, time.Time, time.Time) {
 	if meta != nil {
 		return meta.TotalObjects, meta.CompactionLevel, meta.EndTime.Unix() / int64(windowRange/time.Second), meta.StartTime, meta.EndTime
@@ -254,3 +325,14 @@ func blockStats(meta *encoding.BlockMeta, compactedMeta *encoding.CompactedBlock
 
 	return -1, 0, -1, time.Unix(0, 0), time.Unix(0, 0)
 }
+
+// blockSize returns the span count and uncompressed size of the block.  0 for blocks written before they were recorded.
+func blockSize(meta *encoding.BlockMeta, compactedMeta *encoding.CompactedBlockMeta) (uint64, uint64) {
+	if meta != nil {
+		return meta.TotalSpans, meta.UncompressedSize
+	} else if compactedMeta != nil {
+		return compactedMeta.TotalSpans, compactedMeta.UncompressedSize
+	}
+
+	return 0, 0
+}
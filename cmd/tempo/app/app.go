@@ -229,6 +229,15 @@ func (t *App) readyHandler(sm *services.Manager) http.HandlerFunc {
 			}
 		}
 
+		// Components reading or writing blocks aren't ready until the backend can be read so bad credentials or
+		// a misconfigured bucket show up at startup rather than at the first flush.
+		if t.store != nil {
+			if err := t.store.BackendHealthy(); err != nil {
+				http.Error(w, "Backend not ready: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
 		http.Error(w, "ready", http.StatusOK)
 	}
 }
@@ -140,7 +140,7 @@ func (t *App) initQuerier() (services.Service, error) {
 }
 
 func (t *App) initCompactor() (services.Service, error) {
-	compactor, err := compactor.New(t.cfg.Compactor, t.store)
+	compactor, err := compactor.New(t.cfg.Compactor, t.store, t.overrides)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create compactor %w", err)
 	}
@@ -150,6 +150,10 @@ func (t *App) initCompactor() (services.Service, error) {
 		prometheus.MustRegister(t.compactor.Ring)
 		t.server.HTTP.Handle("/compactor/ring", t.compactor.Ring)
 	}
+	t.server.HTTP.Path("/compactor/blocks/{tenantID}/{blockID}").Methods(http.MethodDelete).Handler(http.HandlerFunc(t.compactor.DeleteBlockHandler))
+	t.server.HTTP.Path("/compactor/blocks/{tenantID}/{blockID}/repair").Methods(http.MethodPost).Handler(http.HandlerFunc(t.compactor.RepairBlockHandler))
+	t.server.HTTP.Path("/compactor/pause").Methods(http.MethodPost).Handler(http.HandlerFunc(t.compactor.PauseHandler))
+	t.server.HTTP.Path("/compactor/resume").Methods(http.MethodPost).Handler(http.HandlerFunc(t.compactor.ResumeHandler))
 
 	return t.compactor, nil
 }
@@ -210,7 +214,7 @@ func (t *App) setupModuleManager() error {
 		Distributor: {Ring, Server, Overrides},
 		Ingester:    {Store, Server, Overrides, MemberlistKV},
 		Querier:     {Store, Ring},
-		Compactor:   {Store, Server, MemberlistKV},
+		Compactor:   {Store, Server, Overrides, MemberlistKV},
 		All:         {Compactor, Querier, Ingester, Distributor},
 	}
 
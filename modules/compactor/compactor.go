@@ -10,8 +10,11 @@ import (
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/services"
 	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/tempo/modules/overrides"
 	"github.com/grafana/tempo/modules/storage"
 	tempo_util "github.com/grafana/tempo/pkg/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+	tempodb_wal "github.com/grafana/tempo/tempodb/wal"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -35,11 +38,18 @@ type Compactor struct {
 }
 
 // New makes a new Querier.
-func New(cfg Config, store storage.Store) (*Compactor, error) {
+func New(cfg Config, store storage.Store, limits *overrides.Overrides) (*Compactor, error) {
 	c := &Compactor{
 		cfg:   &cfg,
 		store: store,
 	}
+	if limits != nil {
+		store.WAL().SetOverrides(limits)
+		store.SetCompactorOverrides(limits)
+	}
+	store.WAL().SetTagExtractor(encoding.TagExtractorFunc(tempo_util.TraceTags))
+	store.WAL().SetTimeExtractor(encoding.TimeExtractorFunc(tempo_util.TraceTimeRange))
+	store.WAL().SetSpanCounter(tempodb_wal.SpanCounterFunc(tempo_util.TraceSpans))
 
 	subservices := []services.Service(nil)
 	if c.isSharded() {
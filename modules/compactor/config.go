@@ -20,15 +20,28 @@ type Config struct {
 // RegisterFlags registers the flags.
 func (cfg *Config) RegisterFlagsAndApplyDefaults(prefix string, f *flag.FlagSet) {
 	cfg.Compactor = tempodb.CompactorConfig{
-		ChunkSizeBytes:          10485760, // 10 MiB
-		CompactedBlockRetention: time.Hour,
+		ChunkSizeBytes: 10485760, // 10 MiB
 	}
 
 	flagext.DefaultValues(&cfg.ShardingRing)
 	cfg.ShardingRing.KVStore.Store = "" // by default compactor is not sharded
 
 	f.DurationVar(&cfg.Compactor.BlockRetention, util.PrefixConfig(prefix, "compaction.block-retention"), 14*24*time.Hour, "Duration to keep blocks/traces.")
+	f.DurationVar(&cfg.Compactor.CompactedBlockRetention, util.PrefixConfig(prefix, "compaction.compacted-block-retention"), time.Hour, "Duration to keep blocks that have been compacted elsewhere. Queriers that haven't polled the blocklist since they were compacted still read them.")
+	f.DurationVar(&cfg.Compactor.QuarantinedBlockRetention, util.PrefixConfig(prefix, "compaction.quarantined-block-retention"), 7*24*time.Hour, "Duration to keep blocks whose meta fails validation so they can be repaired before they are deleted. 0 keeps them.")
 	f.IntVar(&cfg.Compactor.MaxCompactionObjects, util.PrefixConfig(prefix, "compaction.max-objects-per-block"), 6000000, "Maximum number of traces in a compacted block.")
+	f.Uint64Var(&cfg.Compactor.MaxCompactionBytes, util.PrefixConfig(prefix, "compaction.max-bytes-per-block"), 0, "Maximum size in bytes of the traces in a compacted block. 0 is unlimited.")
+	f.IntVar(&cfg.Compactor.MaxCompactionLevel, util.PrefixConfig(prefix, "compaction.max-compaction-level"), 0, "Blocks compacted this many times aren't compacted again. 0 is unlimited.")
+	f.Uint64Var(&cfg.Compactor.MaxBlockBytes, util.PrefixConfig(prefix, "compaction.max-block-bytes"), 0, "Blocks holding at least this many bytes of traces aren't compacted again. 0 is unlimited.")
 	f.DurationVar(&cfg.Compactor.MaxCompactionRange, util.PrefixConfig(prefix, "compaction.compaction-window"), 4*time.Hour, "Maximum time window across which to compact blocks.")
+	f.DurationVar(&cfg.Compactor.ActiveWindow, util.PrefixConfig(prefix, "compaction.active-window"), 24*time.Hour, "How long after a compaction window ends its blocks are compacted by level.")
+	f.DurationVar(&cfg.Compactor.CompactionCycle, util.PrefixConfig(prefix, "compaction.compaction-cycle"), 30*time.Second, "How often to start a compaction pass.")
+	f.IntVar(&cfg.Compactor.CompactionConcurrency, util.PrefixConfig(prefix, "compaction.compaction-concurrency"), 1, "Number of tenants to compact at once.")
+	f.IntVar(&cfg.Compactor.TinyBlockObjects, util.PrefixConfig(prefix, "compaction.tiny-block-objects"), 0, "Level 0 blocks with at most this many traces are combined many at a time. 0 disables.")
+	f.IntVar(&cfg.Compactor.MaxTinyBlocks, util.PrefixConfig(prefix, "compaction.max-tiny-blocks"), 32, "Maximum number of tiny blocks combined at once.")
+	f.DurationVar(&cfg.Compactor.RetentionCycle, util.PrefixConfig(prefix, "compaction.retention-cycle"), 0, "How often to apply retention. Defaults to the storage maintenance cycle.")
+	f.IntVar(&cfg.Compactor.RetentionConcurrency, util.PrefixConfig(prefix, "compaction.retention-concurrency"), 10, "Number of tenants to apply retention to at once.")
+	f.BoolVar(&cfg.Compactor.DisableCompaction, util.PrefixConfig(prefix, "compaction.disable-compaction"), false, "Apply retention without compacting blocks.")
+	f.BoolVar(&cfg.Compactor.DisableRetention, util.PrefixConfig(prefix, "compaction.disable-retention"), false, "Compact blocks without applying retention.")
 	cfg.OverrideRingKey = ring.CompactorRingKey
 }
@@ -0,0 +1,97 @@
+package compactor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/grafana/tempo/tempodb/backend"
+)
+
+const (
+	TenantIDVar = "tenantID"
+	BlockIDVar  = "blockID"
+)
+
+// DeleteBlockHandler is a http.HandlerFunc that removes a block from the backend, e.g. a corrupt block that
+// fails every query that touches it
+func (c *Compactor) DeleteBlockHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars[TenantIDVar]
+	if tenantID == "" {
+		http.Error(w, "please provide a tenantID", http.StatusBadRequest)
+		return
+	}
+
+	blockID, err := uuid.Parse(vars[BlockIDVar])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid blockID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err = c.store.DeleteBlock(r.Context(), tenantID, blockID)
+	if errors.Is(err, backend.ErrMetaDoesNotExist) {
+		http.Error(w, fmt.Sprintf("block %s not found for tenant %s", blockID, tenantID), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, backend.ErrReadOnly) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RepairBlockHandler is a http.HandlerFunc that replaces a damaged block, e.g. one with a corrupt index or truncated
+// objects, with a block of the objects that can still be read from it.  It responds with what was recovered.
+func (c *Compactor) RepairBlockHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars[TenantIDVar]
+	if tenantID == "" {
+		http.Error(w, "please provide a tenantID", http.StatusBadRequest)
+		return
+	}
+
+	blockID, err := uuid.Parse(vars[BlockIDVar])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid blockID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	report, err := c.store.RepairBlock(r.Context(), tenantID, blockID)
+	if errors.Is(err, backend.ErrMetaDoesNotExist) {
+		http.Error(w, fmt.Sprintf("block %s not found for tenant %s", blockID, tenantID), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, backend.ErrReadOnly) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// PauseHandler is a http.HandlerFunc that stops this compactor from starting new compactions.  Retention
+// keeps running.  The pause does not survive a restart.
+func (c *Compactor) PauseHandler(w http.ResponseWriter, _ *http.Request) {
+	c.store.PauseCompaction()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResumeHandler is a http.HandlerFunc that undoes PauseHandler
+func (c *Compactor) ResumeHandler(w http.ResponseWriter, _ *http.Request) {
+	c.store.ResumeCompaction()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -20,7 +20,9 @@ import (
 	"github.com/grafana/tempo/modules/overrides"
 	"github.com/grafana/tempo/modules/storage"
 	"github.com/grafana/tempo/pkg/tempopb"
+	tempo_util "github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/pkg/validation"
+	"github.com/grafana/tempo/tempodb/encoding"
 	tempodb_wal "github.com/grafana/tempo/tempodb/wal"
 )
 
@@ -81,6 +83,12 @@ func New(cfg Config, store storage.Store, limits *overrides.Overrides) (*Ingeste
 	// Now that the lifecycler has been created, we can create the limiter
 	// which depends on it.
 	i.limiter = NewLimiter(limits, i.lifecycler, cfg.LifecyclerConfig.RingConfig.ReplicationFactor)
+	if limits != nil {
+		store.WAL().SetOverrides(limits)
+	}
+	store.WAL().SetTagExtractor(encoding.TagExtractorFunc(tempo_util.TraceTags))
+	store.WAL().SetTimeExtractor(encoding.TimeExtractorFunc(tempo_util.TraceTimeRange))
+	store.WAL().SetSpanCounter(tempodb_wal.SpanCounterFunc(tempo_util.TraceSpans))
 
 	i.subservicesWatcher = services.NewFailureWatcher()
 	i.subservicesWatcher.WatchService(i.lifecycler)
@@ -131,12 +139,20 @@ func (i *Ingester) stopping(_ error) error {
 	i.stopIncomingRequests()
 
 	// Lifecycler can be nil if the ingester is for a flusher.
+	var err error
 	if i.lifecycler != nil {
 		// Next initiate our graceful exit from the ring.
-		return services.StopAndAwaitTerminated(context.Background(), i.lifecycler)
+		err = services.StopAndAwaitTerminated(context.Background(), i.lifecycler)
 	}
 
-	return nil
+	// Let blocks already being flushed finish.  Anything not flushed is replayed from the wal on restart.
+	ctx, cancel := context.WithTimeout(context.Background(), i.cfg.FlushOpTimeout)
+	defer cancel()
+	if flushErr := i.store.FlushAll(ctx); flushErr != nil {
+		level.Warn(util.Logger).Log("msg", "failed to wait for block flushes on shutdown", "err", flushErr)
+	}
+
+	return err
 }
 
 // Push implements tempopb.Pusher.
@@ -33,6 +33,11 @@ var (
 		Name:      "ingester_traces_created_total",
 		Help:      "The total number of traces created per tenant.",
 	}, []string{"tenant"})
+	metricSpansTruncatedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Name:      "ingester_spans_truncated_total",
+		Help:      "The total number of spans dropped from traces over the per trace byte limit per tenant.",
+	}, []string{"tenant"})
 	metricBlocksClearedTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "tempo",
 		Name:      "ingester_blocks_cleared_total",
@@ -50,20 +55,22 @@ type instance struct {
 	completeBlocks  []*tempodb_wal.CompleteBlock
 	lastBlockCut    time.Time
 
-	instanceID         string
-	tracesCreatedTotal prometheus.Counter
-	limiter            *Limiter
-	wal                *tempodb_wal.WAL
+	instanceID          string
+	tracesCreatedTotal  prometheus.Counter
+	spansTruncatedTotal prometheus.Counter
+	limiter             *Limiter
+	wal                 *tempodb_wal.WAL
 }
 
 func newInstance(instanceID string, limiter *Limiter, wal *tempodb_wal.WAL) (*instance, error) {
 	i := &instance{
 		traces: map[uint32]*trace{},
 
-		instanceID:         instanceID,
-		tracesCreatedTotal: metricTracesCreatedTotal.WithLabelValues(instanceID),
-		limiter:            limiter,
-		wal:                wal,
+		instanceID:          instanceID,
+		tracesCreatedTotal:  metricTracesCreatedTotal.WithLabelValues(instanceID),
+		spansTruncatedTotal: metricSpansTruncatedTotal.WithLabelValues(instanceID),
+		limiter:             limiter,
+		wal:                 wal,
 	}
 	err := i.resetHeadBlock()
 	if err != nil {
@@ -81,9 +88,11 @@ func (i *instance) Push(ctx context.Context, req *tempopb.PushRequest) error {
 		return err
 	}
 
+	dropped := trace.droppedSpans
 	if err := trace.Push(ctx, req); err != nil {
 		return err
 	}
+	i.spansTruncatedTotal.Add(float64(trace.droppedSpans - dropped))
 
 	return nil
 }
@@ -107,7 +116,7 @@ func (i *instance) CutCompleteTraces(cutoff time.Duration, immediate bool) error
 	now := time.Now()
 	for key, trace := range i.traces {
 		if now.Add(cutoff).After(trace.lastAppend) || immediate {
-			out, err := proto.Marshal(trace.trace)
+			out, err := trace.Marshal()
 			if err != nil {
 				return err
 			}
@@ -179,6 +188,22 @@ func (i *instance) GetBlockToBeFlushed() *tempodb_wal.CompleteBlock {
 	return nil
 }
 
+// GetBlocksToBeFlushed returns every complete block not yet flushed.  Blocks being written in the background
+// are included until their upload finishes.
+func (i *instance) GetBlocksToBeFlushed() []*tempodb_wal.CompleteBlock {
+	i.blocksMtx.Lock()
+	defer i.blocksMtx.Unlock()
+
+	var blocks []*tempodb_wal.CompleteBlock
+	for _, c := range i.completeBlocks {
+		if c.FlushedTime().IsZero() {
+			blocks = append(blocks, c)
+		}
+	}
+
+	return blocks
+}
+
 func (i *instance) ClearFlushedBlocks(completeBlockTimeout time.Duration) error {
 	var err error
 
@@ -210,7 +235,7 @@ func (i *instance) FindTraceByID(id []byte) (*tempopb.Trace, error) {
 	// live traces
 	i.tracesMtx.Lock()
 	if liveTrace, ok := i.traces[util.TokenForTraceID(id)]; ok {
-		foundBytes, err := proto.Marshal(liveTrace.trace)
+		foundBytes, err := liveTrace.Marshal()
 		if err != nil {
 			i.tracesMtx.Unlock()
 			return nil, fmt.Errorf("unable to marshal liveTrace: %w", err)
@@ -281,7 +306,8 @@ func (i *instance) getOrCreateTrace(req *tempopb.PushRequest) (*trace, error) {
 	}
 
 	maxSpans := i.limiter.limits.MaxSpansPerTrace(i.instanceID)
-	trace = newTrace(maxSpans, fp, traceID)
+	maxBytes := i.limiter.limits.MaxBytesPerTrace(i.instanceID)
+	trace = newTrace(maxSpans, maxBytes, fp, traceID)
 	i.traces[fp] = trace
 	i.tracesCreatedTotal.Inc()
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/grafana/tempo/modules/overrides"
 	"github.com/grafana/tempo/pkg/tempopb"
+	"github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/pkg/util/test"
 
 	"github.com/stretchr/testify/assert"
@@ -252,3 +253,44 @@ func TestInstanceLimits(t *testing.T) {
 		})
 	}
 }
+
+func TestInstanceMaxBytesPerTrace(t *testing.T) {
+	first := test.MakeRequest(5, []byte{0x01})
+	second := test.MakeRequest(5, []byte{0x01})
+	third := test.MakeRequest(3, []byte{0x01})
+
+	limits, err := overrides.NewOverrides(overrides.Limits{
+		MaxBytesPerTrace: first.Batch.Size() + third.Batch.Size(),
+	})
+	assert.NoError(t, err, "unexpected error creating limits")
+	limiter := NewLimiter(limits, &ringCountMock{count: 1}, 1)
+
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	assert.NoError(t, err, "unexpected error getting temp dir")
+	defer os.RemoveAll(tempDir)
+
+	ingester, _, _ := defaultIngester(t, tempDir)
+	i, err := newInstance("fake", limiter, ingester.store.WAL())
+	assert.NoError(t, err, "unexpected error creating new instance")
+
+	// the second batch goes over the limit and is dropped but the third still fits
+	traceID := test.MustTraceID(first)
+	originalSize := int64(first.Batch.Size() + second.Batch.Size() + third.Batch.Size())
+	for _, req := range []*tempopb.PushRequest{first, second, third} {
+		assert.NoError(t, i.Push(context.Background(), req))
+	}
+
+	checkTruncated := func() {
+		trace, err := i.FindTraceByID(traceID)
+		assert.NoError(t, err)
+		assert.Len(t, trace.Batches, 3)
+		truncation, ok := util.TraceTruncation(trace)
+		assert.True(t, ok)
+		assert.Equal(t, util.Truncation{DroppedSpans: 5, OriginalSize: originalSize}, truncation)
+	}
+	checkTruncated()
+
+	// the marker is stored with the trace
+	assert.NoError(t, i.CutCompleteTraces(0, true))
+	checkTruncated()
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/status"
 	"github.com/grafana/tempo/pkg/tempopb"
+	"github.com/grafana/tempo/pkg/util"
+	v1 "github.com/open-telemetry/opentelemetry-proto/gen/go/trace/v1"
 	"google.golang.org/grpc/codes"
 )
 
@@ -16,26 +19,31 @@ type trace struct {
 	traceID      []byte
 	maxSpans     int
 	currentSpans int
+	maxBytes     int
+	currentBytes int
+	droppedSpans int // spans dropped over maxBytes
+	droppedBytes int
 }
 
-func newTrace(maxSpans int, token uint32, traceID []byte) *trace {
+func newTrace(maxSpans int, maxBytes int, token uint32, traceID []byte) *trace {
 	return &trace{
 		token:      token,
 		trace:      &tempopb.Trace{},
 		lastAppend: time.Now(),
 		traceID:    traceID,
 		maxSpans:   maxSpans,
+		maxBytes:   maxBytes,
 	}
 }
 
 func (t *trace) Push(_ context.Context, req *tempopb.PushRequest) error {
-	if t.maxSpans != 0 {
-		// count spans
-		spanCount := 0
-		for _, ils := range req.Batch.InstrumentationLibrarySpans {
-			spanCount += len(ils.Spans)
-		}
+	// count spans
+	spanCount := 0
+	for _, ils := range req.Batch.InstrumentationLibrarySpans {
+		spanCount += len(ils.Spans)
+	}
 
+	if t.maxSpans != 0 {
 		if t.currentSpans+spanCount > t.maxSpans {
 			return status.Errorf(codes.FailedPrecondition, "totalSpans (%d) exceeded while adding %d spans", t.maxSpans, spanCount)
 		}
@@ -43,8 +51,35 @@ func (t *trace) Push(_ context.Context, req *tempopb.PushRequest) error {
 		t.currentSpans += spanCount
 	}
 
+	// batches over the byte limit are dropped and recorded in the truncation marker.  the first batch is always kept
+	// so the trace has spans to find it by
+	size := req.Batch.Size()
+	if t.maxBytes != 0 && len(t.trace.Batches) > 0 && t.currentBytes+size > t.maxBytes {
+		t.droppedSpans += spanCount
+		t.droppedBytes += size
+		t.lastAppend = time.Now()
+		return nil
+	}
+	t.currentBytes += size
+
 	t.trace.Batches = append(t.trace.Batches, req.Batch)
 	t.lastAppend = time.Now()
 
 	return nil
 }
+
+// Marshal returns the trace with a truncation marker if spans were dropped
+func (t *trace) Marshal() ([]byte, error) {
+	if t.droppedSpans == 0 {
+		return proto.Marshal(t.trace)
+	}
+
+	truncated := &tempopb.Trace{
+		Batches: append([]*v1.ResourceSpans(nil), t.trace.Batches...),
+	}
+	util.AddTruncationMarker(truncated, util.Truncation{
+		DroppedSpans: int64(t.droppedSpans),
+		OriginalSize: int64(t.currentBytes + t.droppedBytes),
+	})
+	return proto.Marshal(truncated)
+}
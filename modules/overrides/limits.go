@@ -25,6 +25,13 @@ type Limits struct {
 	MaxLocalTracesPerUser  int `yaml:"max_traces_per_user"`
 	MaxGlobalTracesPerUser int `yaml:"max_global_traces_per_user"`
 	MaxSpansPerTrace       int `yaml:"max_spans_per_trace"`
+	MaxBytesPerTrace       int `yaml:"max_bytes_per_trace"`
+
+	// Storage settings of completed and compacted blocks.
+	BloomFilterFalsePositive float64 `yaml:"bloom_filter_false_positive"`
+
+	// Compactor enforced limits.
+	BlockRetention time.Duration `yaml:"block_retention"`
 
 	// Config for overrides, convenient if it goes here.
 	PerTenantOverrideConfig string        `yaml:"per_tenant_override_config"`
@@ -42,6 +49,13 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxLocalTracesPerUser, "ingester.max-traces-per-user", 10e3, "Maximum number of active traces per user, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxGlobalTracesPerUser, "ingester.max-global-traces-per-user", 0, "Maximum number of active traces per user, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxSpansPerTrace, "ingester.max-spans-per-trace", 50e3, "Maximum number of spans per trace.  0 to disable.")
+	f.IntVar(&l.MaxBytesPerTrace, "ingester.max-bytes-per-trace", 0, "Maximum size of a trace in bytes.  Spans over it are dropped and the trace is stored with a marker of what was dropped.  0 to disable.")
+
+	// Storage settings
+	f.Float64Var(&l.BloomFilterFalsePositive, "storage.bloom-filter-false-positive", 0, "Per-user bloom filter false positive rate of completed and compacted blocks. 0 to use the wal's.")
+
+	// Compactor limits
+	f.DurationVar(&l.BlockRetention, "compactor.tenant-block-retention", 0, "Per-user duration to keep blocks. 0 to use the compactor's block retention.")
 
 	f.StringVar(&l.PerTenantOverrideConfig, "limits.per-user-override-config", "", "File name of per-user overrides.")
 	f.DurationVar(&l.PerTenantOverridePeriod, "limits.per-user-override-period", 10*time.Second, "Period with this to reload the overrides.")
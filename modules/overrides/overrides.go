@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/cortexproject/cortex/pkg/util/runtimeconfig"
 	"github.com/cortexproject/cortex/pkg/util/services"
@@ -18,6 +19,14 @@ type TenantLimits func(userID string) *Limits
 // perTenantOverrides represents the overrides config file
 type perTenantOverrides struct {
 	TenantLimits map[string]*Limits `yaml:"overrides"`
+	Pool         *PoolLimits        `yaml:"pool,omitempty"`
+}
+
+// PoolLimits size the tempodb work pool.  Unlike the per tenant limits they apply to the whole process
+// and allow the pool to be grown or shrunk at runtime.
+type PoolLimits struct {
+	MaxWorkers int `yaml:"max_workers"`
+	QueueDepth int `yaml:"queue_depth"`
 }
 
 // loadPerTenantOverrides is of type runtimeconfig.Loader
@@ -40,6 +49,7 @@ type Overrides struct {
 
 	defaultLimits *Limits
 	tenantLimits  TenantLimits
+	runtimeConfig *runtimeconfig.Manager
 
 	// Manager for subservices
 	subservices        *services.Manager
@@ -52,6 +62,7 @@ type Overrides struct {
 // become the new global defaults.
 func NewOverrides(defaults Limits) (*Overrides, error) {
 	var tenantLimits TenantLimits
+	var runtimeCfgMgr *runtimeconfig.Manager
 	subservices := []services.Service(nil)
 
 	if defaults.PerTenantOverrideConfig != "" {
@@ -60,7 +71,8 @@ func NewOverrides(defaults Limits) (*Overrides, error) {
 			ReloadPeriod: defaults.PerTenantOverridePeriod,
 			Loader:       loadPerTenantOverrides,
 		}
-		runtimeCfgMgr, err := runtimeconfig.NewRuntimeConfigManager(runtimeCfg, prometheus.DefaultRegisterer)
+		var err error
+		runtimeCfgMgr, err = runtimeconfig.NewRuntimeConfigManager(runtimeCfg, prometheus.DefaultRegisterer)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create runtime config manager %w", err)
 		}
@@ -71,6 +83,7 @@ func NewOverrides(defaults Limits) (*Overrides, error) {
 	o := &Overrides{
 		tenantLimits:  tenantLimits,
 		defaultLimits: &defaults,
+		runtimeConfig: runtimeCfgMgr,
 	}
 
 	if len(subservices) > 0 {
@@ -144,6 +157,11 @@ func (o *Overrides) MaxSpansPerTrace(userID string) int {
 	return o.getOverridesForUser(userID).MaxSpansPerTrace
 }
 
+// MaxBytesPerTrace returns the maximum size in bytes of a live trace.  Spans over it are dropped.
+func (o *Overrides) MaxBytesPerTrace(userID string) int {
+	return o.getOverridesForUser(userID).MaxBytesPerTrace
+}
+
 // IngestionRateSpans is the number of spans per second allowed for this tenant
 func (o *Overrides) IngestionRateSpans(userID string) float64 {
 	return float64(o.getOverridesForUser(userID).IngestionRateSpans)
@@ -154,6 +172,41 @@ func (o *Overrides) IngestionMaxBatchSize(userID string) int {
 	return o.getOverridesForUser(userID).IngestionMaxBatchSize
 }
 
+// BloomFilterFalsePositive is the false positive rate of the bloom filters of this tenant's blocks.  0 to use
+// the storage's default
+func (o *Overrides) BloomFilterFalsePositive(userID string) float64 {
+	return o.getOverridesForUser(userID).BloomFilterFalsePositive
+}
+
+// BlockRetention is how long this tenant's blocks are kept.  0 to use the compactor's retention
+func (o *Overrides) BlockRetention(userID string) time.Duration {
+	return o.getOverridesForUser(userID).BlockRetention
+}
+
+// PoolLimits returns the work pool limits from the runtime config or nil if they are not set.
+func (o *Overrides) PoolLimits() *PoolLimits {
+	if o.runtimeConfig == nil {
+		return nil
+	}
+
+	cfg, ok := o.runtimeConfig.GetConfig().(*perTenantOverrides)
+	if !ok || cfg == nil {
+		return nil
+	}
+
+	return cfg.Pool
+}
+
+// RuntimeConfigReloads returns a channel that receives every time the runtime config is reloaded.  It is
+// nil if there is no runtime config and closed once the overrides are stopped.
+func (o *Overrides) RuntimeConfigReloads() <-chan interface{} {
+	if o.runtimeConfig == nil {
+		return nil
+	}
+
+	return o.runtimeConfig.CreateListenerChannel(1)
+}
+
 func (o *Overrides) getOverridesForUser(userID string) *Limits {
 	if o.tenantLimits != nil {
 		l := o.tenantLimits(userID)
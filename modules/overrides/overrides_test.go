@@ -25,6 +25,7 @@ func TestOverrides(t *testing.T) {
 		expectedMaxSpansPerTrace    map[string]int
 		expectedIngestionRateSpans  map[string]int
 		expectedIngestionBurstSpans map[string]int
+		expectedPoolLimits          *PoolLimits
 	}{
 		{
 			name: "limits only",
@@ -60,12 +61,17 @@ func TestOverrides(t *testing.T) {
 						IngestionRateSpans:     10,
 					},
 				},
+				Pool: &PoolLimits{
+					MaxWorkers: 100,
+					QueueDepth: 1000,
+				},
 			},
 			expectedMaxGlobalTraces:     map[string]int{"user1": 6, "user2": 1},
 			expectedMaxLocalTraces:      map[string]int{"user1": 7, "user2": 2},
 			expectedMaxSpansPerTrace:    map[string]int{"user1": 8, "user2": 3},
 			expectedIngestionBurstSpans: map[string]int{"user1": 9, "user2": 4},
 			expectedIngestionRateSpans:  map[string]int{"user1": 10, "user2": 5},
+			expectedPoolLimits:          &PoolLimits{MaxWorkers: 100, QueueDepth: 1000},
 		},
 	}
 
@@ -105,6 +111,8 @@ func TestOverrides(t *testing.T) {
 				assert.Equal(t, float64(expectedVal), overrides.IngestionRateSpans(user))
 			}
 
+			assert.Equal(t, tt.expectedPoolLimits, overrides.PoolLimits())
+
 			//if srv != nil {
 			err = services.StopAndAwaitTerminated(context.TODO(), overrides)
 			require.NoError(t, err)
@@ -9,10 +9,15 @@ import (
 type Config struct {
 	QueryTimeout    time.Duration `yaml:"query_timeout"`
 	ExtraQueryDelay time.Duration `yaml:"extra_query_delay,omitempty"`
+
+	// StoreHedgeDelay starts searching the store if the ingesters haven't returned within this long
+	// instead of waiting for them.  0 disables hedging.
+	StoreHedgeDelay time.Duration `yaml:"store_hedge_delay,omitempty"`
 }
 
 // RegisterFlagsAndApplyDefaults register flags.
 func (cfg *Config) RegisterFlagsAndApplyDefaults(prefix string, f *flag.FlagSet) {
 	cfg.QueryTimeout = 10 * time.Second
 	cfg.ExtraQueryDelay = 0
+	cfg.StoreHedgeDelay = 0
 }
@@ -4,16 +4,27 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/gorilla/mux"
 	"github.com/grafana/tempo/pkg/tempopb"
 	"github.com/grafana/tempo/pkg/util"
+	"github.com/grafana/tempo/tempodb"
 )
 
 const (
 	TraceIDVar = "traceID"
+
+	// StartParam and EndParam optionally bound when the trace was ingested, in unix epoch seconds.  Blocks
+	// written entirely outside of the range are not searched.
+	StartParam = "start"
+	EndParam   = "end"
+
+	// WarningHeader is set when a trace is returned but some blocks that could hold part of it failed to be
+	// searched, or the trace was truncated over the per trace byte limit
+	WarningHeader = "Warning"
 )
 
 // TraceByIDHandler is a http.HandlerFunc to retrieve traces
@@ -36,9 +47,20 @@ func (q *Querier) TraceByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := q.FindTraceByID(ctx, &tempopb.TraceByIDRequest{
+	start, err := parseTimeParam(r, StartParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end, err := parseTimeParam(r, EndParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, report, err := q.findTraceByID(ctx, &tempopb.TraceByIDRequest{
 		TraceID: byteID,
-	})
+	}, tempodb.WithTimeRange(start, end))
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -50,6 +72,14 @@ func (q *Querier) TraceByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if report != nil && report.Partial() {
+		// 199 is the miscellaneous warning code from RFC 7234
+		w.Header().Set(WarningHeader, fmt.Sprintf(`199 - "trace may be incomplete: %d of %d blocks could not be searched"`, len(report.FailedBlocks), report.Blocks))
+	}
+	if truncation, ok := util.TraceTruncation(resp.Trace); ok {
+		w.Header().Add(WarningHeader, fmt.Sprintf(`199 - "trace was truncated: %d spans of its %d bytes were dropped"`, truncation.DroppedSpans, truncation.OriginalSize))
+	}
+
 	marshaller := &jsonpb.Marshaler{}
 	err = marshaller.Marshal(w, resp.Trace)
 	if err != nil {
@@ -57,3 +87,19 @@ func (q *Querier) TraceByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// parseTimeParam parses an optional unix epoch seconds query parameter.  it returns the zero time if the
+// parameter is not set.
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
@@ -3,7 +3,9 @@ package querier
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/go-kit/kit/log/level"
 	"github.com/gogo/protobuf/proto"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -22,6 +24,7 @@ import (
 	"github.com/grafana/tempo/pkg/tempopb"
 	tempo_util "github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/pkg/validation"
+	"github.com/grafana/tempo/tempodb"
 )
 
 var (
@@ -42,6 +45,16 @@ var (
 		Name:      "querier_ingester_clients",
 		Help:      "The current number of ingester clients.",
 	})
+	metricHedgedStoreReads = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Name:      "querier_hedged_store_reads_total",
+		Help:      "Total number of store lookups started while still waiting on the ingesters.",
+	})
+	metricHedgedReadWinner = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Name:      "querier_hedged_read_winner_total",
+		Help:      "Total number of hedged lookups by the path that returned the trace.",
+	}, []string{"path"})
 )
 
 // Querier handlers queries.
@@ -54,6 +67,8 @@ type Querier struct {
 	store  storage.Store
 	limits *overrides.Overrides
 
+	poolLimits overrides.PoolLimits // last pool limits applied from the runtime config
+
 	subservicesWatcher *services.FailureWatcher
 }
 
@@ -94,18 +109,45 @@ func (q *Querier) starting(ctx context.Context) error {
 		return fmt.Errorf("failed to start pool %w", err)
 	}
 
+	q.applyPoolLimits()
+
 	return nil
 }
 
 func (q *Querier) running(ctx context.Context) error {
-	select {
-	case <-ctx.Done():
-		return nil
-	case err := <-q.subservicesWatcher.Chan():
-		return fmt.Errorf("querier subservices failed %w", err)
+	reloads := q.limits.RuntimeConfigReloads()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-q.subservicesWatcher.Chan():
+			return fmt.Errorf("querier subservices failed %w", err)
+		case _, ok := <-reloads:
+			if !ok {
+				reloads = nil
+				continue
+			}
+			q.applyPoolLimits()
+		}
 	}
 }
 
+// applyPoolLimits resizes the store's work pool if the runtime config has changed
+func (q *Querier) applyPoolLimits() {
+	limits := q.limits.PoolLimits()
+	if limits == nil {
+		limits = &overrides.PoolLimits{}
+	}
+
+	if *limits == q.poolLimits {
+		return
+	}
+
+	q.store.ReconfigurePool(limits.MaxWorkers, limits.QueueDepth)
+	q.poolLimits = *limits
+}
+
 // Called after distributor is asked to stop via StopAsync.
 func (q *Querier) stopping(_ error) error {
 	return services.StopAndAwaitTerminated(context.Background(), q.pool)
@@ -113,18 +155,54 @@ func (q *Querier) stopping(_ error) error {
 
 // FindTraceByID implements tempopb.Querier.
 func (q *Querier) FindTraceByID(ctx context.Context, req *tempopb.TraceByIDRequest) (*tempopb.TraceByIDResponse, error) {
+	resp, _, err := q.findTraceByID(ctx, req)
+	return resp, err
+}
+
+// findTraceByID searches the ingesters and then the store.  opts narrow the blocks searched in the store.  The
+// returned report is nil unless the store was searched.
+func (q *Querier) findTraceByID(ctx context.Context, req *tempopb.TraceByIDRequest, opts ...tempodb.FindOption) (*tempopb.TraceByIDResponse, *tempodb.FindReport, error) {
 	if !validation.ValidTraceID(req.TraceID) {
-		return nil, fmt.Errorf("invalid trace id")
+		return nil, nil, fmt.Errorf("invalid trace id")
 	}
 
 	userID, err := user.ExtractOrgID(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "error extracting org id in Querier.FindTraceByID")
+		return nil, nil, errors.Wrap(err, "error extracting org id in Querier.FindTraceByID")
 	}
 
 	span, ctx := opentracing.StartSpanFromContext(ctx, "Querier.FindTraceByID")
 	defer span.Finish()
 
+	findInIngesters := func(ctx context.Context) findResult {
+		trace, err := q.findInIngesters(ctx, userID, req)
+		return findResult{trace: trace, err: err}
+	}
+	findInStore := func(ctx context.Context) findResult {
+		return q.findInStore(ctx, userID, req, opts)
+	}
+
+	var result findResult
+	if q.cfg.StoreHedgeDelay > 0 {
+		result = findHedged(ctx, q.cfg.StoreHedgeDelay, findInIngesters, findInStore)
+	} else {
+		result = findInIngesters(ctx)
+		// if the ingester didn't have it check the store.
+		if result.err == nil && result.trace == nil {
+			result = findInStore(ctx)
+		}
+	}
+	if result.err != nil {
+		return nil, result.report, result.err
+	}
+
+	return &tempopb.TraceByIDResponse{
+		Trace: result.trace,
+	}, result.report, nil
+}
+
+// findInIngesters returns the trace combined from all ingesters that have it or nil if none do
+func (q *Querier) findInIngesters(ctx context.Context, userID string, req *tempopb.TraceByIDRequest) (*tempopb.Trace, error) {
 	key := tempo_util.TokenFor(userID, req.TraceID)
 
 	const maxExpectedReplicationSet = 3 // 3.  b/c frigg it
@@ -136,7 +214,7 @@ func (q *Querier) FindTraceByID(ctx context.Context, req *tempopb.TraceByIDReque
 
 	// get responses from all ingesters in parallel
 	responses, err := q.forGivenIngesters(ctx, replicationSet, func(client tempopb.QuerierClient) (interface{}, error) {
-		return client.FindTraceByID(opentracing.ContextWithSpan(ctx, span), req)
+		return client.FindTraceByID(ctx, req)
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error querying ingesters in Querier.FindTraceByID")
@@ -150,31 +228,118 @@ func (q *Querier) FindTraceByID(ctx context.Context, req *tempopb.TraceByIDReque
 		}
 	}
 
-	// if the ingester didn't have it check the store.
-	if completeTrace == nil {
-		foundBytes, metrics, err := q.store.Find(opentracing.ContextWithSpan(ctx, span), userID, req.TraceID)
-		if err != nil {
-			return nil, errors.Wrap(err, "error querying store in Querier.FindTraceByID")
-		}
+	return completeTrace, nil
+}
 
-		out := &tempopb.Trace{}
-		err = proto.Unmarshal(foundBytes, out)
-		if err != nil {
-			return nil, err
+// findInStore returns the trace from the backend.  the trace is empty if it wasn't found.  A trace found while
+// other blocks failed is returned with the report so the caller can flag it as possibly incomplete, but
+// not finding a trace is an error unless every block was searched.
+func (q *Querier) findInStore(ctx context.Context, userID string, req *tempopb.TraceByIDRequest, opts []tempodb.FindOption) findResult {
+	// a trace may have been cut into more than one block.  combine the parts rather than returning the first found
+	opts = append([]tempodb.FindOption{tempodb.WithCombiner(q)}, opts...)
+	foundBytes, metrics, report, err := q.store.Find(ctx, userID, req.TraceID, opts...)
+	if err != nil {
+		return findResult{report: report, err: errors.Wrap(err, "error querying store in Querier.FindTraceByID")}
+	}
+	logFailedBlocks(ctx, report)
+
+	if foundBytes == nil && report.Partial() {
+		return findResult{report: report, err: fmt.Errorf("trace not found and %d of %d blocks could not be searched", len(report.FailedBlocks), report.Blocks)}
+	}
+
+	out := &tempopb.Trace{}
+	err = proto.Unmarshal(foundBytes, out)
+	if err != nil {
+		return findResult{report: report, err: err}
+	}
+
+	metricQueryReads.WithLabelValues("bloom").Observe(float64(metrics.BloomFilterReads.Load()))
+	metricQueryBytesRead.WithLabelValues("bloom").Observe(float64(metrics.BloomFilterBytesRead.Load()))
+	metricQueryReads.WithLabelValues("index").Observe(float64(metrics.IndexReads.Load()))
+	metricQueryBytesRead.WithLabelValues("index").Observe(float64(metrics.IndexBytesRead.Load()))
+	metricQueryReads.WithLabelValues("block").Observe(float64(metrics.BlockReads.Load()))
+	metricQueryBytesRead.WithLabelValues("block").Observe(float64(metrics.BlockBytesRead.Load()))
+
+	return findResult{trace: out, report: report}
+}
+
+// Combine implements encoding.ObjectCombiner
+func (q *Querier) Combine(objA []byte, objB []byte) []byte {
+	return tempo_util.CombineTraces(objA, objB)
+}
+
+type findResult struct {
+	trace  *tempopb.Trace
+	report *tempodb.FindReport
+	err    error
+}
+
+// findHedged searches the ingesters and, if they haven't found the trace within delay, the store at the
+// same time.  The first to find the trace wins and the other lookup is abandoned.  Unlike the serial path
+// a trace found in the store first is returned without any spans the ingesters may still hold.
+func findHedged(ctx context.Context, delay time.Duration, findInIngesters, findInStore func(context.Context) findResult) findResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ingesterCh := make(chan findResult, 1)
+	go func() {
+		ingesterCh <- findInIngesters(ctx)
+	}()
+
+	storeCh := make(chan findResult, 1)
+	storeStarted := false
+	startStore := func() {
+		if storeStarted {
+			return
 		}
+		storeStarted = true
+		go func() {
+			storeCh <- findInStore(ctx)
+		}()
+	}
 
-		completeTrace = out
-		metricQueryReads.WithLabelValues("bloom").Observe(float64(metrics.BloomFilterReads.Load()))
-		metricQueryBytesRead.WithLabelValues("bloom").Observe(float64(metrics.BloomFilterBytesRead.Load()))
-		metricQueryReads.WithLabelValues("index").Observe(float64(metrics.IndexReads.Load()))
-		metricQueryBytesRead.WithLabelValues("index").Observe(float64(metrics.IndexBytesRead.Load()))
-		metricQueryReads.WithLabelValues("block").Observe(float64(metrics.BlockReads.Load()))
-		metricQueryBytesRead.WithLabelValues("block").Observe(float64(metrics.BlockBytesRead.Load()))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var storeResult *findResult
+	ingestersDone := false
+	for {
+		select {
+		case <-timer.C:
+			metricHedgedStoreReads.Inc()
+			startStore()
+
+		case r := <-ingesterCh:
+			if r.err != nil || r.trace != nil {
+				metricHedgedReadWinner.WithLabelValues("ingester").Inc()
+				return r
+			}
+			ingestersDone = true
+			if storeResult != nil {
+				return *storeResult
+			}
+			startStore()
+
+		case r := <-storeCh:
+			if r.err == nil && len(r.trace.Batches) > 0 {
+				metricHedgedReadWinner.WithLabelValues("store").Inc()
+				return r
+			}
+			// the store came up empty.  the ingesters may still have it
+			if ingestersDone {
+				return r
+			}
+			storeResult = &r
+		}
 	}
+}
 
-	return &tempopb.TraceByIDResponse{
-		Trace: completeTrace,
-	}, nil
+// logFailedBlocks logs every block that could not be read during a store lookup
+func logFailedBlocks(ctx context.Context, report *tempodb.FindReport) {
+	logger := util.WithContext(ctx, util.Logger)
+	for _, jobErr := range report.FailedBlocks {
+		level.Error(logger).Log("msg", "failed to read block", "tenant", jobErr.TenantID, "block", jobErr.Key, "err", jobErr.Err)
+	}
 }
 
 // forGivenIngesters runs f, in parallel, for given ingesters
@@ -0,0 +1,89 @@
+package querier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/tempo/pkg/tempopb"
+	v1 "github.com/open-telemetry/opentelemetry-proto/gen/go/trace/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindHedged(t *testing.T) {
+	ingesterTrace := &tempopb.Trace{Batches: make([]*v1.ResourceSpans, 1)}
+	storeTrace := &tempopb.Trace{Batches: make([]*v1.ResourceSpans, 2)}
+	notFound := &tempopb.Trace{}
+	errStore := errors.New("store failed")
+
+	find := func(after time.Duration, trace *tempopb.Trace, err error) func(context.Context) findResult {
+		return func(ctx context.Context) findResult {
+			select {
+			case <-time.After(after):
+				return findResult{trace: trace, err: err}
+			case <-ctx.Done():
+				return findResult{err: ctx.Err()}
+			}
+		}
+	}
+
+	tests := []struct {
+		name          string
+		ingesters     func(context.Context) findResult
+		store         func(context.Context) findResult
+		expected      *tempopb.Trace
+		expectedError error
+	}{
+		{
+			name:      "ingesters before delay",
+			ingesters: find(0, ingesterTrace, nil),
+			store:     find(0, storeTrace, nil),
+			expected:  ingesterTrace,
+		},
+		{
+			name:      "store wins after delay",
+			ingesters: find(time.Second, ingesterTrace, nil),
+			store:     find(0, storeTrace, nil),
+			expected:  storeTrace,
+		},
+		{
+			name:      "ingesters win after delay",
+			ingesters: find(20*time.Millisecond, ingesterTrace, nil),
+			store:     find(time.Second, storeTrace, nil),
+			expected:  ingesterTrace,
+		},
+		{
+			name:      "store empty waits on ingesters",
+			ingesters: find(50*time.Millisecond, ingesterTrace, nil),
+			store:     find(0, notFound, nil),
+			expected:  ingesterTrace,
+		},
+		{
+			name:      "ingesters empty falls back to store",
+			ingesters: find(0, nil, nil),
+			store:     find(0, storeTrace, nil),
+			expected:  storeTrace,
+		},
+		{
+			name:      "not found anywhere",
+			ingesters: find(0, nil, nil),
+			store:     find(0, notFound, nil),
+			expected:  notFound,
+		},
+		{
+			name:          "store error after ingesters empty",
+			ingesters:     find(50*time.Millisecond, nil, nil),
+			store:         find(0, nil, errStore),
+			expectedError: errStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := findHedged(context.Background(), 10*time.Millisecond, tt.ingesters, tt.store)
+			assert.Equal(t, tt.expectedError, result.err)
+			assert.Equal(t, tt.expected, result.trace)
+		})
+	}
+}
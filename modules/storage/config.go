@@ -6,9 +6,17 @@ import (
 
 	"github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/tempodb"
+	"github.com/grafana/tempo/tempodb/backend/azure"
+	"github.com/grafana/tempo/tempodb/backend/cos"
 	"github.com/grafana/tempo/tempodb/backend/gcs"
+	"github.com/grafana/tempo/tempodb/backend/hdfs"
 	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/backend/oss"
+	"github.com/grafana/tempo/tempodb/backend/ratelimit"
+	"github.com/grafana/tempo/tempodb/backend/retry"
 	"github.com/grafana/tempo/tempodb/backend/s3"
+	"github.com/grafana/tempo/tempodb/backend/swift"
+	"github.com/grafana/tempo/tempodb/encoding"
 	"github.com/grafana/tempo/tempodb/pool"
 	"github.com/grafana/tempo/tempodb/wal"
 )
@@ -22,26 +30,134 @@ var DefaultMaintenanceCycle = 5 * time.Minute
 
 // RegisterFlagsAndApplyDefaults registers the flags.
 func (cfg *Config) RegisterFlagsAndApplyDefaults(prefix string, f *flag.FlagSet) {
-	f.StringVar(&cfg.Trace.Backend, util.PrefixConfig(prefix, "trace.backend"), "", "Trace backend (s3, gcs, local)")
+	f.StringVar(&cfg.Trace.Backend, util.PrefixConfig(prefix, "trace.backend"), "", "Trace backend (s3, gcs, azure, swift, oss, cos, hdfs, local)")
 	f.DurationVar(&cfg.Trace.MaintenanceCycle, util.PrefixConfig(prefix, "trace.maintenance-cycle"), DefaultMaintenanceCycle, "Period at which to run the maintenance cycle.")
+	f.DurationVar(&cfg.Trace.HealthCheckInterval, util.PrefixConfig(prefix, "trace.health-check-interval"), 30*time.Second, "Period at which to check the backend can be read. Components are not ready until it can. 0 to disable.")
+	f.IntVar(&cfg.Trace.BlockUploadConcurrency, util.PrefixConfig(prefix, "trace.block-upload-concurrency"), 0, "Maximum number of completed blocks written to the backend at once. 0 to disable.")
+	f.IntVar(&cfg.Trace.BlockUploadBufferBytes, util.PrefixConfig(prefix, "trace.block-upload-buffer-bytes"), 0, "Maximum bloom filter and index bytes held in memory by blocks being written to the backend. 0 to disable.")
+	f.BoolVar(&cfg.Trace.AsyncBlockWrites, util.PrefixConfig(prefix, "trace.async-block-writes"), false, "Upload completed blocks in the background within the block upload limits. Blocks are marked flushed once uploaded.")
+	f.StringVar(&cfg.Trace.EncryptionKeyFile, util.PrefixConfig(prefix, "trace.encryption-key-file"), "", "File holding the hex encoded AES key to encrypt the traces and index of new blocks with. Empty to disable.")
+	f.BoolVar(&cfg.Trace.ReadOnly, util.PrefixConfig(prefix, "trace.read-only"), false, "Reject writes and deletes to the backend and disable compaction and retention. For query only clusters against a bucket owned by another install.")
+	f.IntVar(&cfg.Trace.MetaCacheMaxBytes, util.PrefixConfig(prefix, "trace.meta-cache-max-bytes"), 0, "Maximum size of the in memory cache of parsed bloom filters and block metas. 0 to disable.")
+	f.DurationVar(&cfg.Trace.PrefetchRecentBlocks, util.PrefixConfig(prefix, "trace.prefetch-recent-blocks"), 0, "Prefetch the bloom filters and indexes of blocks written within this long into the caches after each blocklist poll. 0 to disable.")
+	f.IntVar(&cfg.Trace.PrefetchPages, util.PrefixConfig(prefix, "trace.prefetch-pages"), 0, "Number of pages of traces compaction and search read ahead in the background. 0 to disable.")
+	f.IntVar(&cfg.Trace.BlocklistPollConcurrency, util.PrefixConfig(prefix, "trace.blocklist-poll-concurrency"), 1, "Number of tenants to poll for blocks at once.")
+	f.DurationVar(&cfg.Trace.BlocklistPollJitter, util.PrefixConfig(prefix, "trace.blocklist-poll-jitter"), 0, "Maximum random delay added to each blocklist poll. 0 to disable.")
+	f.IntVar(&cfg.Trace.BlocklistPollTolerateConsecutiveErrors, util.PrefixConfig(prefix, "trace.blocklist-poll-tolerate-consecutive-errors"), 1, "Number of polls in a row that may fail to list a tenant completely before the incomplete blocklist is used. Until then the previous blocklist is kept.")
+	f.DurationVar(&cfg.Trace.BlocklistPollStaleTenantIndex, util.PrefixConfig(prefix, "trace.blocklist-poll-stale-tenant-index"), 0, "Read the blocklist from the tenant index built by the compactors, falling back to listing if it is older than this. 0 to disable.")
 
 	cfg.Trace.WAL = &wal.Config{}
 	f.StringVar(&cfg.Trace.WAL.Filepath, util.PrefixConfig(prefix, "trace.wal.path"), "/var/tempo/wal", "Path at which store WAL blocks.")
 	f.Float64Var(&cfg.Trace.WAL.BloomFP, util.PrefixConfig(prefix, "trace.wal.bloom-filter-false-positive"), .05, "Bloom False Positive.")
+	f.IntVar(&cfg.Trace.WAL.BloomShards, util.PrefixConfig(prefix, "trace.wal.bloom-filter-shards"), 1, "Split block bloom filters into this many shards by trace id so queries read a single shard. 1 to disable.")
+	f.BoolVar(&cfg.Trace.WAL.TagIndex, util.PrefixConfig(prefix, "trace.wal.tag-index"), false, "Write an index of the span and resource attributes of the traces in each block after its traces.")
+	f.DurationVar(&cfg.Trace.WAL.TimeGroupWindow, util.PrefixConfig(prefix, "trace.wal.time-group-window"), 0, "Group the records of each block by the span times of their traces in windows of this duration so searches of a time range skip the records outside it. 0 to disable.")
+	f.IntVar(&cfg.Trace.WAL.AppendRecordsMaxBytes, util.PrefixConfig(prefix, "trace.wal.append-records-max-bytes"), 0, "Maximum memory the sorted records of each head block take before they are spilled to disk. 0 to disable.")
 	f.IntVar(&cfg.Trace.WAL.IndexDownsample, util.PrefixConfig(prefix, "trace.wal.index-downsample"), 100, "Number of traces per index record.")
+	f.IntVar(&cfg.Trace.WAL.IndexPageSizeBytes, util.PrefixConfig(prefix, "trace.wal.index-page-size-bytes"), 256*1024, "Split block indexes into pages of this size so queries read a single page instead of the whole index. 0 to disable.")
+	cfg.Trace.WAL.Encoding = encoding.EncNone
+	f.Var(&cfg.Trace.WAL.Encoding, util.PrefixConfig(prefix, "trace.wal.encoding"), "Compression of the pages of traces in completed and compacted blocks: none, gzip or snappy.")
 
 	cfg.Trace.S3 = &s3.Config{}
 	f.StringVar(&cfg.Trace.S3.Bucket, util.PrefixConfig(prefix, "trace.s3.bucket"), "", "s3 bucket to store blocks in.")
 	f.StringVar(&cfg.Trace.S3.Endpoint, util.PrefixConfig(prefix, "trace.s3.endpoint"), "", "s3 endpoint to push blocks to.")
+	f.Uint64Var(&cfg.Trace.S3.PartSize, util.PrefixConfig(prefix, "trace.s3.part-size"), 64*1024*1024, "Size of the parts blocks are uploaded to s3 in.")
+	f.Uint64Var(&cfg.Trace.S3.MultipartThreshold, util.PrefixConfig(prefix, "trace.s3.multipart-threshold"), 0, "Blocks this size or larger are uploaded to s3 with multipart uploads. 0 to use the part size.")
+	f.IntVar(&cfg.Trace.S3.PartConcurrency, util.PrefixConfig(prefix, "trace.s3.part-concurrency"), 4, "Number of parts of a block uploaded to s3 at once.")
+	f.StringVar(&cfg.Trace.S3.AssumeRole.RoleARN, util.PrefixConfig(prefix, "trace.s3.assume-role.role-arn"), "", "Role to assume for s3 access. Empty to use the access keys or the environment's credentials directly.")
+	f.StringVar(&cfg.Trace.S3.AssumeRole.ExternalID, util.PrefixConfig(prefix, "trace.s3.assume-role.external-id"), "", "External id to pass when assuming the role.")
+	f.StringVar(&cfg.Trace.S3.AssumeRole.WebIdentityTokenFile, util.PrefixConfig(prefix, "trace.s3.assume-role.web-identity-token-file"), "", "File holding an oidc token to assume the role with.")
+	f.Float64Var(&cfg.Trace.S3.Hedging.Percentile, util.PrefixConfig(prefix, "trace.s3.hedging.percentile"), 0, "Send a duplicate s3 read if it takes longer than this percentile of recent reads, e.g. 0.9. 0 to disable.")
+	f.StringVar(&cfg.Trace.S3.SSE.Type, util.PrefixConfig(prefix, "trace.s3.sse.type"), "", "s3 server side encryption, SSE-S3 or SSE-KMS. Empty to use the bucket's defaults.")
+	f.StringVar(&cfg.Trace.S3.SSE.KMSKeyID, util.PrefixConfig(prefix, "trace.s3.sse.kms-key-id"), "", "kms key to encrypt blocks with when using SSE-KMS.")
+	f.DurationVar(&cfg.Trace.S3.Hedging.MinDelay, util.PrefixConfig(prefix, "trace.s3.hedging.min-delay"), 10*time.Millisecond, "Minimum time to wait before sending a duplicate s3 read.")
+	f.StringVar(&cfg.Trace.S3.TLS.CAPath, util.PrefixConfig(prefix, "trace.s3.tls.ca-path"), "", "pem bundle of cas trusted in addition to the system's when connecting to s3.")
+	f.StringVar(&cfg.Trace.S3.TLS.CertPath, util.PrefixConfig(prefix, "trace.s3.tls.cert-path"), "", "Client certificate presented to s3.")
+	f.StringVar(&cfg.Trace.S3.TLS.KeyPath, util.PrefixConfig(prefix, "trace.s3.tls.key-path"), "", "Key of the client certificate presented to s3.")
+	f.BoolVar(&cfg.Trace.S3.TLS.InsecureSkipVerify, util.PrefixConfig(prefix, "trace.s3.tls.insecure-skip-verify"), false, "Skip verifying the s3 endpoint's certificate.")
+	cfg.Trace.S3.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.s3.transport."), f)
 
 	cfg.Trace.GCS = &gcs.Config{}
 	f.StringVar(&cfg.Trace.GCS.BucketName, util.PrefixConfig(prefix, "trace.gcs.bucket"), "", "gcs bucket to store traces in.")
+	f.IntVar(&cfg.Trace.GCS.ChunkBufferSize, util.PrefixConfig(prefix, "trace.gcs.chunk-buffer-size"), 16*1024*1024, "Size of the chunks blocks are uploaded to gcs in.")
+	f.IntVar(&cfg.Trace.GCS.ChunkMaxRetries, util.PrefixConfig(prefix, "trace.gcs.chunk-max-retries"), 5, "Number of times a failed chunk of a gcs upload is resent before the upload fails.")
+	f.Float64Var(&cfg.Trace.GCS.Hedging.Percentile, util.PrefixConfig(prefix, "trace.gcs.hedging.percentile"), 0, "Send a duplicate gcs read if it takes longer than this percentile of recent reads, e.g. 0.9. 0 to disable.")
+	f.DurationVar(&cfg.Trace.GCS.Hedging.MinDelay, util.PrefixConfig(prefix, "trace.gcs.hedging.min-delay"), 10*time.Millisecond, "Minimum time to wait before sending a duplicate gcs read.")
+	cfg.Trace.GCS.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.gcs.transport."), f)
 	cfg.Trace.GCS.ChunkBufferSize = 10 * 1024 * 1024
 
+	cfg.Trace.Azure = &azure.Config{}
+	f.StringVar(&cfg.Trace.Azure.StorageAccountName, util.PrefixConfig(prefix, "trace.azure.storage-account-name"), "", "Azure storage account name.")
+	f.StringVar(&cfg.Trace.Azure.ContainerName, util.PrefixConfig(prefix, "trace.azure.container-name"), "", "Azure container to store blocks in.")
+	f.StringVar(&cfg.Trace.Azure.EndpointSuffix, util.PrefixConfig(prefix, "trace.azure.endpoint-suffix"), "blob.core.windows.net", "Azure blob service domain.")
+	f.BoolVar(&cfg.Trace.Azure.UseManagedIdentity, util.PrefixConfig(prefix, "trace.azure.use-managed-identity"), false, "Authenticate with the VM's managed identity.")
+	f.IntVar(&cfg.Trace.Azure.BufferSize, util.PrefixConfig(prefix, "trace.azure.buffer-size"), 3*1024*1024, "Size of each block staged while uploading to azure.")
+	f.IntVar(&cfg.Trace.Azure.MaxBuffers, util.PrefixConfig(prefix, "trace.azure.max-buffers"), 4, "Number of blocks staged at once while uploading to azure.")
+	f.IntVar(&cfg.Trace.Azure.MaxRetries, util.PrefixConfig(prefix, "trace.azure.max-retries"), 3, "Number of times a failed azure request is retried.")
+	cfg.Trace.Azure.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.azure.transport."), f)
+
+	cfg.Trace.Swift = &swift.Config{}
+	f.StringVar(&cfg.Trace.Swift.AuthURL, util.PrefixConfig(prefix, "trace.swift.auth-url"), "", "Keystone url to authenticate with swift.")
+	f.IntVar(&cfg.Trace.Swift.AuthVersion, util.PrefixConfig(prefix, "trace.swift.auth-version"), 3, "Keystone version. 0 to detect it from the auth url.")
+	f.StringVar(&cfg.Trace.Swift.ContainerName, util.PrefixConfig(prefix, "trace.swift.container-name"), "", "Swift container to store blocks in.")
+	f.Int64Var(&cfg.Trace.Swift.ChunkSize, util.PrefixConfig(prefix, "trace.swift.chunk-size"), 100*1024*1024, "Objects larger than this are uploaded to swift as segmented large objects.")
+	f.IntVar(&cfg.Trace.Swift.MaxRetries, util.PrefixConfig(prefix, "trace.swift.max-retries"), 3, "Number of times a failed swift request is retried.")
+	f.DurationVar(&cfg.Trace.Swift.ConnectTimeout, util.PrefixConfig(prefix, "trace.swift.connect-timeout"), 10*time.Second, "Timeout for connecting to swift.")
+	f.DurationVar(&cfg.Trace.Swift.RequestTimeout, util.PrefixConfig(prefix, "trace.swift.request-timeout"), 60*time.Second, "Timeout for a single swift request.")
+	cfg.Trace.Swift.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.swift.transport."), f)
+
+	cfg.Trace.OSS = &oss.Config{}
+	f.StringVar(&cfg.Trace.OSS.Endpoint, util.PrefixConfig(prefix, "trace.oss.endpoint"), "", "oss region endpoint, e.g. oss-cn-hangzhou.aliyuncs.com.")
+	f.BoolVar(&cfg.Trace.OSS.Internal, util.PrefixConfig(prefix, "trace.oss.internal"), false, "Use the region's internal oss endpoint.")
+	f.StringVar(&cfg.Trace.OSS.Bucket, util.PrefixConfig(prefix, "trace.oss.bucket"), "", "oss bucket to store blocks in.")
+	f.Int64Var(&cfg.Trace.OSS.PartSize, util.PrefixConfig(prefix, "trace.oss.part-size"), 64*1024*1024, "Size of the parts blocks are uploaded to oss in.")
+	cfg.Trace.OSS.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.oss.transport."), f)
+
+	cfg.Trace.COS = &cos.Config{}
+	f.StringVar(&cfg.Trace.COS.Bucket, util.PrefixConfig(prefix, "trace.cos.bucket"), "", "cos bucket to store blocks in.")
+	f.StringVar(&cfg.Trace.COS.AppID, util.PrefixConfig(prefix, "trace.cos.app-id"), "", "appid of the account that owns the cos bucket.")
+	f.StringVar(&cfg.Trace.COS.Region, util.PrefixConfig(prefix, "trace.cos.region"), "", "cos region, e.g. ap-guangzhou.")
+	f.Int64Var(&cfg.Trace.COS.PartSize, util.PrefixConfig(prefix, "trace.cos.part-size"), 64*1024*1024, "Size of the parts blocks are uploaded to cos in.")
+	cfg.Trace.COS.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.cos.transport."), f)
+
+	cfg.Trace.HDFS = &hdfs.Config{}
+	f.StringVar(&cfg.Trace.HDFS.Endpoint, util.PrefixConfig(prefix, "trace.hdfs.endpoint"), "", "webhdfs or httpfs address, e.g. http://namenode:9870.")
+	f.StringVar(&cfg.Trace.HDFS.Path, util.PrefixConfig(prefix, "trace.hdfs.path"), "/tempo", "hdfs directory to store blocks in.")
+	f.StringVar(&cfg.Trace.HDFS.Username, util.PrefixConfig(prefix, "trace.hdfs.username"), "", "User to act as on clusters with simple authentication.")
+	f.StringVar(&cfg.Trace.HDFS.DelegationTokenFile, util.PrefixConfig(prefix, "trace.hdfs.delegation-token-file"), "", "File holding a delegation token for kerberos secured clusters. Reread before every request.")
+	f.StringVar(&cfg.Trace.HDFS.SpoolPath, util.PrefixConfig(prefix, "trace.hdfs.spool-path"), "", "Local directory compacted blocks are staged in before upload. Defaults to the os temp directory.")
+	cfg.Trace.HDFS.Transport.RegisterFlagsWithPrefix(util.PrefixConfig(prefix, "trace.hdfs.transport."), f)
+
 	cfg.Trace.Local = &local.Config{}
 	f.StringVar(&cfg.Trace.Local.Path, util.PrefixConfig(prefix, "trace.local.path"), "", "path to store traces at.")
+	f.BoolVar(&cfg.Trace.Local.Fsync, util.PrefixConfig(prefix, "trace.local.fsync"), false, "fsync files and folders written to the local backend so blocks survive power loss.")
+
+	cfg.Trace.Retry = &retry.Config{}
+	f.IntVar(&cfg.Trace.Retry.MaxRetries, util.PrefixConfig(prefix, "trace.retry.max-retries"), 0, "Number of times a backend operation failing with a transient error is retried. 0 to disable.")
+	f.DurationVar(&cfg.Trace.Retry.MinBackoff, util.PrefixConfig(prefix, "trace.retry.min-backoff"), 100*time.Millisecond, "Minimum delay before retrying a backend operation.")
+	f.DurationVar(&cfg.Trace.Retry.MaxBackoff, util.PrefixConfig(prefix, "trace.retry.max-backoff"), 2*time.Second, "Maximum delay before retrying a backend operation.")
+
+	cfg.Trace.RateLimit = &ratelimit.Config{}
+	f.Float64Var(&cfg.Trace.RateLimit.ReadsPerSecond, util.PrefixConfig(prefix, "trace.rate-limit.reads-per-second"), 0, "Maximum backend reads per second. 0 for no limit.")
+	f.Float64Var(&cfg.Trace.RateLimit.WritesPerSecond, util.PrefixConfig(prefix, "trace.rate-limit.writes-per-second"), 0, "Maximum backend writes per second. 0 for no limit.")
+	f.Float64Var(&cfg.Trace.RateLimit.ListsPerSecond, util.PrefixConfig(prefix, "trace.rate-limit.lists-per-second"), 0, "Maximum backend listings per second. 0 for no limit.")
+	f.IntVar(&cfg.Trace.RateLimit.Burst, util.PrefixConfig(prefix, "trace.rate-limit.burst"), 1, "Backend requests of each kind that may be made at once above the rate.")
 
 	cfg.Trace.Pool = &pool.Config{}
 	f.IntVar(&cfg.Trace.Pool.MaxWorkers, util.PrefixConfig(prefix, "trace.pool.max-workers"), 50, "Workers in the worker pool.")
 	f.IntVar(&cfg.Trace.Pool.QueueDepth, util.PrefixConfig(prefix, "trace.pool.queue-depth"), 200, "Work item queue depth.")
+	f.IntVar(&cfg.Trace.Pool.MinWorkers, util.PrefixConfig(prefix, "trace.pool.min-workers"), 0, "Workers kept when autoscaling. max-workers becomes the most the pool scales up to. 0 to disable autoscaling.")
+	f.DurationVar(&cfg.Trace.Pool.ScaleInterval, util.PrefixConfig(prefix, "trace.pool.scale-interval"), time.Second, "How often the number of workers is adjusted when autoscaling.")
+	f.DurationVar(&cfg.Trace.Pool.ScaleUpWait, util.PrefixConfig(prefix, "trace.pool.scale-up-wait"), 0, "How long queued jobs wait before workers are added when autoscaling. 0 to add workers as soon as jobs are waiting.")
+	f.DurationVar(&cfg.Trace.Pool.JobTimeout, util.PrefixConfig(prefix, "trace.pool.job-timeout"), 0, "Maximum time a single job may run before it is abandoned. 0 to disable.")
+	f.IntVar(&cfg.Trace.Pool.MaxRetries, util.PrefixConfig(prefix, "trace.pool.max-retries"), 0, "Number of times a failed job is retried. 0 to disable.")
+	f.DurationVar(&cfg.Trace.Pool.RetryMinBackoff, util.PrefixConfig(prefix, "trace.pool.retry-min-backoff"), 100*time.Millisecond, "Minimum delay before retrying a failed job.")
+	f.DurationVar(&cfg.Trace.Pool.RetryMaxBackoff, util.PrefixConfig(prefix, "trace.pool.retry-max-backoff"), 2*time.Second, "Maximum delay before retrying a failed job.")
+	f.StringVar(&cfg.Trace.Pool.OverflowPolicy, util.PrefixConfig(prefix, "trace.pool.overflow-policy"), pool.OverflowReject, "What to do when the work queue is full: reject, block or shed.")
+	f.DurationVar(&cfg.Trace.Pool.OverflowBlockTimeout, util.PrefixConfig(prefix, "trace.pool.overflow-block-timeout"), 5*time.Second, "Maximum time to wait for room in the work queue with the block overflow policy.")
+	f.Int64Var(&cfg.Trace.Pool.MaxOutstandingCost, util.PrefixConfig(prefix, "trace.pool.max-outstanding-cost"), 0, "Maximum total cost of batches in flight. Replaces the queue depth check when admitting batches. 0 to disable.")
+	f.DurationVar(&cfg.Trace.Pool.EvictExpiredJobsPeriod, util.PrefixConfig(prefix, "trace.pool.evict-expired-jobs-period"), 0, "How often to remove queued jobs whose request has already been cancelled or timed out. 0 to disable.")
+	f.IntVar(&cfg.Trace.Pool.MaxCPUWorkers, util.PrefixConfig(prefix, "trace.pool.max-cpu-workers"), 0, "Jobs that may run CPU bound work such as bloom and index parsing at once. 0 to use GOMAXPROCS.")
+	f.IntVar(&cfg.Trace.Pool.MaxWorkersPerTenant, util.PrefixConfig(prefix, "trace.pool.max-workers-per-tenant"), 0, "Maximum jobs for a single tenant that may run at once. 0 to disable.")
+	f.IntVar(&cfg.Trace.Pool.MaxResultBytes, util.PrefixConfig(prefix, "trace.pool.max-result-bytes"), 0, "Maximum size of a single job result, e.g. a trace read from a block. Larger results fail the job. 0 to disable.")
 }
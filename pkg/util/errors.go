@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"google.golang.org/grpc/codes"
@@ -50,6 +51,26 @@ func (es MultiError) Err() error {
 	return es
 }
 
+// Is reports whether any of the contained errors matches target.  See errors.Is.
+func (es MultiError) Is(target error) bool {
+	for _, err := range es {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first contained error that matches target.  See errors.As.
+func (es MultiError) As(target interface{}) bool {
+	for _, err := range es {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsConnCanceled returns true, if error is from a closed gRPC connection.
 // copied from https://github.com/etcd-io/etcd/blob/7f47de84146bdc9225d2080ec8678ca8189a2d2b/clientv3/client.go#L646
 func IsConnCanceled(err error) bool {
@@ -1,14 +1,21 @@
 package util
 
 import (
+	"fmt"
 	"hash/fnv"
+	"strconv"
+	"time"
 
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/go-kit/kit/log/level"
 	"github.com/gogo/protobuf/proto"
 	"github.com/grafana/tempo/pkg/tempopb"
+	"github.com/grafana/tempo/tempodb/encoding"
+	v1common "github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
 )
 
+// CombineTraces combines two marshalled traces into one holding the spans of both, those of objA first.  Spans in
+// both are kept once.  The querier and compactor both combine the parts of a trace with it.
 func CombineTraces(objA []byte, objB []byte) []byte {
 	// if the byte arrays are the same, we can return quickly
 	hasher := fnv.New32a()
@@ -62,7 +69,7 @@ func CombineTraces(objA []byte, objB []byte) []byte {
 }
 
 // CombineTraceProtos combines two trace protos into one.  Note that it is destructive.
-//  All spans are combined into traceA.
+//  All spans are combined into traceA.  Truncation markers are combined into one.
 func CombineTraceProtos(traceA, traceB *tempopb.Trace) *tempopb.Trace {
 	if traceA == nil {
 		return traceB
@@ -72,6 +79,11 @@ func CombineTraceProtos(traceA, traceB *tempopb.Trace) *tempopb.Trace {
 		return traceA
 	}
 
+	// markers have no spans so they'd be dropped below
+	truncationA, truncatedA := removeTruncationMarker(traceA)
+	truncationB, truncatedB := removeTruncationMarker(traceB)
+	truncationA.merge(truncationB)
+
 	spansInA := make(map[uint32]struct{})
 	for _, batchA := range traceA.Batches {
 		for _, ilsA := range batchA.InstrumentationLibrarySpans {
@@ -108,5 +120,101 @@ func CombineTraceProtos(traceA, traceB *tempopb.Trace) *tempopb.Trace {
 		}
 	}
 
+	if truncatedA || truncatedB {
+		AddTruncationMarker(traceA, truncationA)
+	}
+
 	return traceA
 }
+
+// TraceTags returns the resource and span attributes of a trace with scalar values for the block tag index
+func TraceTags(obj []byte) ([]encoding.Tag, error) {
+	trace := &tempopb.Trace{}
+	err := proto.Unmarshal(obj, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []encoding.Tag
+	add := func(attrs []*v1common.KeyValue) {
+		for _, kv := range attrs {
+			if v, ok := attributeString(kv.Value); ok {
+				tags = append(tags, encoding.Tag{Key: kv.Key, Value: v})
+			}
+		}
+	}
+	for _, b := range trace.Batches {
+		if b.Resource != nil {
+			add(b.Resource.Attributes)
+		}
+		for _, ils := range b.InstrumentationLibrarySpans {
+			for _, s := range ils.Spans {
+				add(s.Attributes)
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// TraceSpans returns the number of spans in a trace
+func TraceSpans(obj []byte) (int, error) {
+	trace := &tempopb.Trace{}
+	err := proto.Unmarshal(obj, trace)
+	if err != nil {
+		return 0, err
+	}
+
+	spans := 0
+	for _, b := range trace.Batches {
+		for _, ils := range b.InstrumentationLibrarySpans {
+			spans += len(ils.Spans)
+		}
+	}
+	return spans, nil
+}
+
+// TraceTimeRange returns the start of the first span of a trace and the end of the last for block time groups
+func TraceTimeRange(obj []byte) (time.Time, time.Time, error) {
+	trace := &tempopb.Trace{}
+	err := proto.Unmarshal(obj, trace)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	var start, end uint64
+	for _, b := range trace.Batches {
+		for _, ils := range b.InstrumentationLibrarySpans {
+			for _, s := range ils.Spans {
+				if start == 0 || s.StartTimeUnixNano < start {
+					start = s.StartTimeUnixNano
+				}
+				if s.EndTimeUnixNano > end {
+					end = s.EndTimeUnixNano
+				}
+			}
+		}
+	}
+	if start == 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("trace has no span times")
+	}
+	if end < start {
+		end = start
+	}
+
+	return time.Unix(0, int64(start)), time.Unix(0, int64(end)), nil
+}
+
+func attributeString(v *v1common.AnyValue) (string, bool) {
+	switch v := v.GetValue().(type) {
+	case *v1common.AnyValue_StringValue:
+		return v.StringValue, true
+	case *v1common.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *v1common.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *v1common.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64), true
+	}
+	return "", false
+}
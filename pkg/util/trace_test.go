@@ -5,10 +5,15 @@ import (
 	"math/rand"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/grafana/tempo/pkg/tempopb"
 	"github.com/grafana/tempo/pkg/util/test"
+	"github.com/grafana/tempo/tempodb/encoding"
+	v1common "github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
+	v1resource "github.com/open-telemetry/opentelemetry-proto/gen/go/resource/v1"
+	v1 "github.com/open-telemetry/opentelemetry-proto/gen/go/trace/v1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -89,6 +94,106 @@ func TestCombine(t *testing.T) {
 	}
 }
 
+func TestCombineDeterministic(t *testing.T) {
+	b1, err := proto.Marshal(test.MakeTrace(5, []byte{0x01}))
+	assert.NoError(t, err)
+	b2, err := proto.Marshal(test.MakeTrace(5, []byte{0x01}))
+	assert.NoError(t, err)
+
+	combined := CombineTraces(b1, b2)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, combined, CombineTraces(b1, b2))
+	}
+
+	// combining again doesn't duplicate spans
+	assert.Equal(t, combined, CombineTraces(combined, b2))
+}
+
+func TestTraceTags(t *testing.T) {
+	trace := &tempopb.Trace{
+		Batches: []*v1.ResourceSpans{
+			{
+				Resource: &v1resource.Resource{
+					Attributes: []*v1common.KeyValue{
+						{Key: "service.name", Value: &v1common.AnyValue{Value: &v1common.AnyValue_StringValue{StringValue: "svc"}}},
+					},
+				},
+				InstrumentationLibrarySpans: []*v1.InstrumentationLibrarySpans{
+					{
+						Spans: []*v1.Span{
+							{
+								Attributes: []*v1common.KeyValue{
+									{Key: "http.status_code", Value: &v1common.AnyValue{Value: &v1common.AnyValue_IntValue{IntValue: 200}}},
+									{Key: "error", Value: &v1common.AnyValue{Value: &v1common.AnyValue_BoolValue{BoolValue: true}}},
+									{Key: "ratio", Value: &v1common.AnyValue{Value: &v1common.AnyValue_DoubleValue{DoubleValue: .5}}},
+									{Key: "list", Value: &v1common.AnyValue{Value: &v1common.AnyValue_ArrayValue{}}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	b, err := proto.Marshal(trace)
+	assert.NoError(t, err)
+
+	tags, err := TraceTags(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []encoding.Tag{
+		{Key: "service.name", Value: "svc"},
+		{Key: "http.status_code", Value: "200"},
+		{Key: "error", Value: "true"},
+		{Key: "ratio", Value: "0.5"},
+	}, tags)
+
+	_, err = TraceTags([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestTraceSpans(t *testing.T) {
+	trace := test.MakeTrace(10, []byte{0x01})
+	expected := 0
+	for _, b := range trace.Batches {
+		for _, ils := range b.InstrumentationLibrarySpans {
+			expected += len(ils.Spans)
+		}
+	}
+	b, err := proto.Marshal(trace)
+	assert.NoError(t, err)
+
+	spans, err := TraceSpans(b)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, spans)
+	assert.Greater(t, spans, 0)
+}
+
+func TestTraceTimeRange(t *testing.T) {
+	trace := test.MakeTrace(10, []byte{0x01})
+	b, err := proto.Marshal(trace)
+	assert.NoError(t, err)
+	_, _, err = TraceTimeRange(b)
+	assert.Error(t, err)
+
+	n := uint64(0)
+	for _, b := range trace.Batches {
+		for _, ils := range b.InstrumentationLibrarySpans {
+			for _, s := range ils.Spans {
+				n++
+				s.StartTimeUnixNano = n * 1000
+				s.EndTimeUnixNano = n*1000 + 1500
+			}
+		}
+	}
+	b, err = proto.Marshal(trace)
+	assert.NoError(t, err)
+
+	start, end, err := TraceTimeRange(b)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(0, 1000), start)
+	assert.Equal(t, time.Unix(0, int64(n*1000+1500)), end)
+}
+
 func sortTrace(t *tempopb.Trace) {
 	sort.Slice(t.Batches, func(i, j int) bool {
 		return bytes.Compare(t.Batches[i].InstrumentationLibrarySpans[0].Spans[0].SpanId, t.Batches[j].InstrumentationLibrarySpans[0].Spans[0].SpanId) == 1
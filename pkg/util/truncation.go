@@ -0,0 +1,104 @@
+package util
+
+import (
+	"github.com/grafana/tempo/pkg/tempopb"
+	v1common "github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
+	v1resource "github.com/open-telemetry/opentelemetry-proto/gen/go/resource/v1"
+	v1 "github.com/open-telemetry/opentelemetry-proto/gen/go/trace/v1"
+)
+
+// the resource attributes of the batch marking a truncated trace
+const (
+	TruncatedDroppedSpansKey = "tempo.truncated.dropped_spans"
+	TruncatedOriginalSizeKey = "tempo.truncated.original_size_bytes"
+)
+
+// Truncation describes the spans dropped from a trace over the per trace byte limit
+type Truncation struct {
+	DroppedSpans int64
+	OriginalSize int64 // size in bytes of the trace before spans were dropped
+}
+
+// AddTruncationMarker marks the trace truncated, replacing any marker it has.  The marker is a batch without spans
+// whose resource attributes hold the truncation, so it's stored and returned by queries like the rest of the trace.
+func AddTruncationMarker(trace *tempopb.Trace, t Truncation) {
+	removeTruncationMarker(trace)
+	trace.Batches = append(trace.Batches, &v1.ResourceSpans{
+		Resource: &v1resource.Resource{
+			Attributes: []*v1common.KeyValue{
+				intAttribute(TruncatedDroppedSpansKey, t.DroppedSpans),
+				intAttribute(TruncatedOriginalSizeKey, t.OriginalSize),
+			},
+		},
+	})
+}
+
+// TraceTruncation returns the truncation the trace is marked with.  ok is false if it isn't truncated.
+func TraceTruncation(trace *tempopb.Trace) (t Truncation, ok bool) {
+	for _, b := range trace.Batches {
+		if t, ok := truncationMarker(b); ok {
+			return t, true
+		}
+	}
+	return Truncation{}, false
+}
+
+// removeTruncationMarker removes the markers of the trace and returns the truncation they describe
+func removeTruncationMarker(trace *tempopb.Trace) (t Truncation, ok bool) {
+	batches := trace.Batches[:0]
+	for _, b := range trace.Batches {
+		marker, isMarker := truncationMarker(b)
+		if !isMarker {
+			batches = append(batches, b)
+			continue
+		}
+
+		ok = true
+		t.merge(marker)
+	}
+	trace.Batches = batches
+	return t, ok
+}
+
+// merge combines the truncation of another part of the trace.  The largest counts are kept rather than their sum since
+// the parts may be replicas of each other, so a trace truncated in several parts counts at least the spans dropped.
+func (t *Truncation) merge(other Truncation) {
+	if other.DroppedSpans > t.DroppedSpans {
+		t.DroppedSpans = other.DroppedSpans
+	}
+	if other.OriginalSize > t.OriginalSize {
+		t.OriginalSize = other.OriginalSize
+	}
+}
+
+// truncationMarker returns the truncation if the batch is a marker
+func truncationMarker(b *v1.ResourceSpans) (Truncation, bool) {
+	if len(b.InstrumentationLibrarySpans) > 0 || b.Resource == nil {
+		return Truncation{}, false
+	}
+
+	t := Truncation{}
+	found := false
+	for _, kv := range b.Resource.Attributes {
+		switch kv.Key {
+		case TruncatedDroppedSpansKey:
+			t.DroppedSpans = kv.Value.GetIntValue()
+			found = true
+		case TruncatedOriginalSizeKey:
+			t.OriginalSize = kv.Value.GetIntValue()
+			found = true
+		}
+	}
+	return t, found
+}
+
+func intAttribute(key string, value int64) *v1common.KeyValue {
+	return &v1common.KeyValue{
+		Key: key,
+		Value: &v1common.AnyValue{
+			Value: &v1common.AnyValue_IntValue{
+				IntValue: value,
+			},
+		},
+	}
+}
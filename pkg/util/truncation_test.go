@@ -0,0 +1,68 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grafana/tempo/pkg/tempopb"
+	"github.com/grafana/tempo/pkg/util/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncationMarker(t *testing.T) {
+	trace := test.MakeTrace(2, []byte{0x01})
+	batches := len(trace.Batches)
+	expectedSpans, err := TraceSpans(mustMarshal(t, trace))
+	assert.NoError(t, err)
+	_, ok := TraceTruncation(trace)
+	assert.False(t, ok)
+
+	AddTruncationMarker(trace, Truncation{DroppedSpans: 3, OriginalSize: 1000})
+	AddTruncationMarker(trace, Truncation{DroppedSpans: 4, OriginalSize: 2000})
+	assert.Len(t, trace.Batches, batches+1)
+	truncation, ok := TraceTruncation(trace)
+	assert.True(t, ok)
+	assert.Equal(t, Truncation{DroppedSpans: 4, OriginalSize: 2000}, truncation)
+
+	// markers aren't spans
+	spans, err := TraceSpans(mustMarshal(t, trace))
+	assert.NoError(t, err)
+	assert.Equal(t, expectedSpans, spans)
+}
+
+func TestCombineTruncationMarkers(t *testing.T) {
+	truncated := test.MakeTrace(2, []byte{0x01})
+	AddTruncationMarker(truncated, Truncation{DroppedSpans: 3, OriginalSize: 1000})
+	other := test.MakeTrace(2, []byte{0x01})
+
+	// the marker survives combining with a part without one either way around
+	for _, combined := range [][]byte{
+		CombineTraces(mustMarshal(t, truncated), mustMarshal(t, other)),
+		CombineTraces(mustMarshal(t, other), mustMarshal(t, truncated)),
+	} {
+		trace := &tempopb.Trace{}
+		assert.NoError(t, proto.Unmarshal(combined, trace))
+		truncation, ok := TraceTruncation(trace)
+		assert.True(t, ok)
+		assert.Equal(t, Truncation{DroppedSpans: 3, OriginalSize: 1000}, truncation)
+	}
+
+	// markers of both parts are combined into one
+	AddTruncationMarker(other, Truncation{DroppedSpans: 5, OriginalSize: 500})
+	combined := CombineTraceProtos(truncated, other)
+	markers := 0
+	for _, b := range combined.Batches {
+		if _, ok := truncationMarker(b); ok {
+			markers++
+		}
+	}
+	assert.Equal(t, 1, markers)
+	truncation, _ := TraceTruncation(combined)
+	assert.Equal(t, Truncation{DroppedSpans: 5, OriginalSize: 1000}, truncation)
+}
+
+func mustMarshal(t *testing.T, trace *tempopb.Trace) []byte {
+	b, err := proto.Marshal(trace)
+	assert.NoError(t, err)
+	return b
+}
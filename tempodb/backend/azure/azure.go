@@ -0,0 +1,462 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/adal"
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/transport"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+const (
+	defaultEndpointSuffix = "blob.core.windows.net"
+	defaultBufferSize     = 3 * 1024 * 1024
+	defaultMaxBuffers     = 4
+
+	// storageResource is the resource managed identity tokens are requested for
+	storageResource = "https://storage.azure.com/"
+)
+
+// readerWriter can read/write from an azure blob storage container
+type readerWriter struct {
+	logger    log.Logger
+	cfg       *Config
+	container azblob.ContainerURL
+}
+
+func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
+	l := log_util.Logger
+
+	credential, err := newCredential(cfg, l)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	u, err := url.Parse(containerURL(cfg))
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "invalid azure container url")
+	}
+
+	rw, err := newReaderWriter(cfg, credential, *u, l)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return rw, rw, rw, nil
+}
+
+// newReaderWriter returns a readerWriter for the container at u and creates the container if needed
+func newReaderWriter(cfg *Config, credential azblob.Credential, u url.URL, l log.Logger) (*readerWriter, error) {
+	options := azblob.PipelineOptions{
+		Retry: azblob.RetryOptions{
+			MaxTries: int32(cfg.MaxRetries + 1),
+		},
+	}
+	if cfg.Transport != (transport.Config{}) {
+		var err error
+		options.HTTPSender, err = newHTTPSender(cfg.Transport)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p := azblob.NewPipeline(credential, options)
+	container := azblob.NewContainerURL(u, p)
+
+	// create the container if it doesn't exist already
+	ctx := context.Background()
+	_, err := container.Create(ctx, azblob.Metadata{}, azblob.PublicAccessNone)
+	if err != nil && !hasServiceCode(err, azblob.ServiceCodeContainerAlreadyExists) {
+		// a sas token may not be allowed to create containers.  make sure we can at least read it
+		_, errProps := container.GetProperties(ctx, azblob.LeaseAccessConditions{})
+		if errProps != nil {
+			return nil, errors.Wrapf(err, "cannot create or read azure container %s, invalid permissions", cfg.ContainerName)
+		}
+	}
+
+	return &readerWriter{
+		logger:    l,
+		cfg:       cfg,
+		container: container,
+	}, nil
+}
+
+// Write implements backend.Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	if err := util.FileExists(objectFilePath); err != nil {
+		return err
+	}
+
+	src, err := os.Open(objectFilePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	objName := util.ObjectFileName(meta.BlockID, meta.TenantID)
+	_, err = azblob.UploadStreamToBlockBlob(ctx, src, rw.container.NewBlockBlobURL(objName), azblob.UploadStreamToBlockBlobOptions{
+		BufferSize: rw.bufferSize(),
+		MaxBuffers: rw.maxBuffers(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error writing object to azure backend, object %s", objName)
+	}
+
+	level.Debug(rw.logger).Log("msg", "object uploaded to azure", "objectName", objName)
+
+	return rw.WriteBlockMeta(ctx, nil, meta, bBloom, bIndex)
+}
+
+// WriteBlockMeta implements backend.Writer
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	blockID := meta.BlockID
+	tenantID := meta.TenantID
+
+	if tracker != nil {
+		a := tracker.(AppenderTracker)
+		level.Debug(rw.logger).Log("msg", "committing compacted block", "blocks", len(a.blockIDs))
+
+		objName := util.ObjectFileName(blockID, tenantID)
+		_, err := rw.container.NewBlockBlobURL(objName).CommitBlockList(ctx, a.blockIDs, azblob.BlobHTTPHeaders{}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+		if err != nil {
+			return errors.Wrapf(err, "error committing block list, object: %s", objName)
+		}
+	}
+
+	err := rw.writeAll(ctx, util.BloomFileName(blockID, tenantID), bBloom)
+	if err != nil {
+		return err
+	}
+
+	err = rw.writeAll(ctx, util.IndexFileName(blockID, tenantID), bIndex)
+	if err != nil {
+		return err
+	}
+
+	bMeta, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// write meta last.  this will prevent blocklist from returning a partial block
+	return rw.writeAll(ctx, util.MetaFileName(blockID, tenantID), bMeta)
+}
+
+// AppenderTracker holds the ids of the blocks staged for an object.  they are committed in order by
+// WriteBlockMeta.
+type AppenderTracker struct {
+	blockIDs []string
+}
+
+// AppendObject implements backend.Writer
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	var a AppenderTracker
+	if tracker != nil {
+		a = tracker.(AppenderTracker)
+	}
+
+	objName := util.ObjectFileName(meta.BlockID, meta.TenantID)
+	level.Debug(rw.logger).Log("msg", "appending object to azure", "objectName", objName)
+
+	// block ids must all be the same length
+	blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%010d", len(a.blockIDs))))
+	_, err := rw.container.NewBlockBlobURL(objName).StageBlock(ctx, blockID, bytes.NewReader(bObject), azblob.LeaseAccessConditions{}, nil)
+	if err != nil {
+		return a, errors.Wrap(err, "error staging block in azure")
+	}
+	a.blockIDs = append(a.blockIDs, blockID)
+
+	return a, nil
+}
+
+// WriteTenantIndex implements backend.Writer
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = rw.writeAll(ctx, util.TenantIndexFileName(tenantID), bIndex)
+	if err != nil {
+		return errors.Wrapf(err, "error writing tenant index to azure backend, tenantID: %s", tenantID)
+	}
+
+	return nil
+}
+
+// Tenants implements backend.Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	prefixes, err := rw.listPrefixes(ctx, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing tenants in container %s", rw.cfg.ContainerName)
+	}
+
+	tenants := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		tenants = append(tenants, strings.TrimSuffix(p, "/"))
+	}
+	return tenants, nil
+}
+
+// Blocks implements backend.Reader
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	prefixes, err := rw.listPrefixes(ctx, tenantID+"/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing blocks in azure container, container: %s", rw.cfg.ContainerName)
+	}
+
+	blockIDs := make([]uuid.UUID, 0, len(prefixes))
+	for _, p := range prefixes {
+		blockID, err := uuid.Parse(strings.TrimSuffix(strings.TrimPrefix(p, tenantID+"/"), "/"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing uuid of obj, objectName: %s", p)
+		}
+		blockIDs = append(blockIDs, blockID)
+	}
+	return blockIDs, nil
+}
+
+// BlockMeta implements backend.Reader
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	body, err := rw.readAll(ctx, util.MetaFileName(blockID, tenantID))
+	if hasServiceCode(err, azblob.ServiceCodeBlobNotFound) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := &encoding.BlockMeta{}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Bloom implements backend.Reader
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.readAll(ctx, util.BloomFileName(blockID, tenantID))
+}
+
+// Index implements backend.Reader
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.readAll(ctx, util.IndexFileName(blockID, tenantID))
+}
+
+// Object implements backend.Reader
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.readRange(ctx, util.ObjectFileName(blockID, tenantID), int64(start), buffer)
+}
+
+// ReadRange implements backend.Reader
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.readRange(ctx, util.FileName(blockID, tenantID, name), int64(start), buffer)
+}
+
+// TenantIndex implements backend.Reader
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	body, err := rw.readAll(ctx, util.TenantIndexFileName(tenantID))
+	if hasServiceCode(err, azblob.ServiceCodeBlobNotFound) {
+		return nil, backend.ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UnmarshalTenantIndex(body)
+}
+
+// Shutdown implements backend.Reader
+func (rw *readerWriter) Shutdown() {
+}
+
+// listPrefixes returns the "directories" directly below prefix
+func (rw *readerWriter) listPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	var prefixes []string
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		res, err := rw.container.ListBlobsHierarchySegment(ctx, marker, "/", azblob.ListBlobsSegmentOptions{
+			Prefix: prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range res.Segment.BlobPrefixes {
+			prefixes = append(prefixes, p.Name)
+		}
+		marker = res.NextMarker
+	}
+
+	return prefixes, nil
+}
+
+func (rw *readerWriter) writeAll(ctx context.Context, name string, b []byte) error {
+	_, err := azblob.UploadBufferToBlockBlob(ctx, b, rw.container.NewBlockBlobURL(name), azblob.UploadToBlockBlobOptions{})
+	return err
+}
+
+func (rw *readerWriter) readAll(ctx context.Context, name string) ([]byte, error) {
+	body, _, err := rw.readAllWithModTime(ctx, name)
+	return body, err
+}
+
+func (rw *readerWriter) readAllWithModTime(ctx context.Context, name string) ([]byte, time.Time, error) {
+	res, err := rw.container.NewBlobURL(name).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		// do not wrap this error.  callers check the service code
+		return nil, time.Time{}, err
+	}
+
+	reader := res.Body(azblob.RetryReaderOptions{MaxRetryRequests: rw.cfg.MaxRetries})
+	defer reader.Close()
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return body, res.LastModified(), nil
+}
+
+func (rw *readerWriter) readRange(ctx context.Context, name string, offset int64, buffer []byte) error {
+	res, err := rw.container.NewBlobURL(name).Download(ctx, offset, int64(len(buffer)), azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return errors.Wrapf(err, "error in range read from azure backend, container: %s, objName: %s", rw.cfg.ContainerName, name)
+	}
+
+	reader := res.Body(azblob.RetryReaderOptions{MaxRetryRequests: rw.cfg.MaxRetries})
+	defer reader.Close()
+
+	_, err = io.ReadFull(reader, buffer)
+	if err == io.ErrUnexpectedEOF {
+		// the last read of a block may run past the end of the object
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error in range read from azure backend")
+	}
+	return nil
+}
+
+func (rw *readerWriter) bufferSize() int {
+	if rw.cfg.BufferSize <= 0 {
+		return defaultBufferSize
+	}
+	return rw.cfg.BufferSize
+}
+
+func (rw *readerWriter) maxBuffers() int {
+	if rw.cfg.MaxBuffers <= 0 {
+		return defaultMaxBuffers
+	}
+	return rw.cfg.MaxBuffers
+}
+
+func containerURL(cfg *Config) string {
+	suffix := cfg.EndpointSuffix
+	if suffix == "" {
+		suffix = defaultEndpointSuffix
+	}
+
+	u := fmt.Sprintf("https://%s.%s/%s", cfg.StorageAccountName, suffix, cfg.ContainerName)
+	if cfg.SASToken != "" {
+		u += "?" + strings.TrimPrefix(cfg.SASToken, "?")
+	}
+	return u
+}
+
+// newCredential returns the credential to sign requests with.  a sas token is part of the url so it
+// needs no credential.
+func newCredential(cfg *Config, logger log.Logger) (azblob.Credential, error) {
+	switch {
+	case cfg.UseManagedIdentity:
+		return newManagedIdentityCredential(cfg, logger)
+	case cfg.StorageAccountKey != "":
+		return azblob.NewSharedKeyCredential(cfg.StorageAccountName, cfg.StorageAccountKey)
+	default:
+		return azblob.NewAnonymousCredential(), nil
+	}
+}
+
+// newManagedIdentityCredential fetches a token for the VM's managed identity and refreshes it before
+// it expires
+func newManagedIdentityCredential(cfg *Config, logger log.Logger) (azblob.Credential, error) {
+	msiEndpoint, err := adal.GetMSIVMEndpoint()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting managed identity endpoint")
+	}
+
+	var spt *adal.ServicePrincipalToken
+	if cfg.UserAssignedID != "" {
+		spt, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(msiEndpoint, storageResource, cfg.UserAssignedID)
+	} else {
+		spt, err = adal.NewServicePrincipalTokenFromMSI(msiEndpoint, storageResource)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating managed identity token")
+	}
+
+	err = spt.Refresh()
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching managed identity token")
+	}
+
+	return azblob.NewTokenCredential(spt.Token().AccessToken, func(tc azblob.TokenCredential) time.Duration {
+		err := spt.Refresh()
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to refresh azure managed identity token", "err", err)
+			return time.Minute
+		}
+		tc.SetToken(spt.Token().AccessToken)
+
+		// refresh a little early so requests in flight don't use an expired token
+		return time.Until(spt.Token().Expires()) - 2*time.Minute
+	}), nil
+}
+
+func hasServiceCode(err error, code azblob.ServiceCodeType) bool {
+	var storageErr azblob.StorageError
+	if errors.As(err, &storageErr) {
+		return storageErr.ServiceCode() == code
+	}
+	return false
+}
+
+// newHTTPSender sends the pipeline's requests through a client using the configured transport.  It mirrors the
+// sdk's default sender which can't be given a transport.
+func newHTTPSender(cfg transport.Config) (pipeline.Factory, error) {
+	tr, err := transport.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: tr}
+
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			r, err := client.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+			return pipeline.NewHTTPResponse(r), err
+		}
+	}), nil
+}
@@ -0,0 +1,472 @@
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func TestContainerURL(t *testing.T) {
+	tests := []struct {
+		cfg      *Config
+		expected string
+	}{
+		{
+			cfg:      &Config{StorageAccountName: "account", ContainerName: "traces"},
+			expected: "https://account.blob.core.windows.net/traces",
+		},
+		{
+			cfg:      &Config{StorageAccountName: "account", ContainerName: "traces", EndpointSuffix: "blob.core.chinacloudapi.cn"},
+			expected: "https://account.blob.core.chinacloudapi.cn/traces",
+		},
+		{
+			cfg:      &Config{StorageAccountName: "account", ContainerName: "traces", SASToken: "?sv=2019-12-12&sig=abc"},
+			expected: "https://account.blob.core.windows.net/traces?sv=2019-12-12&sig=abc",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, containerURL(tt.cfg))
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	server := newFakeAzure(2)
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, &Config{})
+	ctx := context.Background()
+
+	blockID := uuid.New()
+	tenantID := "fake"
+	meta := &encoding.BlockMeta{
+		BlockID:  blockID,
+		TenantID: tenantID,
+	}
+
+	// appends are staged as blocks and committed in order with the meta
+	tracker, err := rw.AppendObject(ctx, nil, meta, []byte("0123456789"))
+	require.NoError(t, err)
+	tracker, err = rw.AppendObject(ctx, tracker, meta, []byte("abcdefghij"))
+	require.NoError(t, err)
+	err = rw.WriteBlockMeta(ctx, tracker, meta, []byte("bloom"), []byte("index"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.staged)
+
+	actualMeta, err := rw.BlockMeta(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, meta, actualMeta)
+
+	bloom, err := rw.Bloom(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bloom"), bloom)
+
+	index, err := rw.Index(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("index"), index)
+
+	// range reads may run past the end of the object
+	buffer := make([]byte, 6)
+	err = rw.Object(ctx, blockID, tenantID, 5, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("56789a"), buffer)
+	assert.Equal(t, "bytes=5-10", server.lastRange())
+
+	buffer = make([]byte, 10)
+	err = rw.Object(ctx, blockID, tenantID, 15, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fghij"), buffer[:5])
+
+	tenants, err := rw.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tenantID}, tenants)
+
+	blocks, err := rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{blockID}, blocks)
+
+	// compaction
+	err = rw.MarkBlockCompacted(blockID, tenantID)
+	require.NoError(t, err)
+	_, err = rw.BlockMeta(ctx, blockID, tenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	compactedMeta, err := rw.CompactedBlockMeta(blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, *meta, compactedMeta.BlockMeta)
+	assert.False(t, compactedMeta.CompactedTime.IsZero())
+
+	err = rw.ClearBlock(blockID, tenantID)
+	require.NoError(t, err)
+	blocks, err = rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 0)
+}
+
+func TestWrite(t *testing.T) {
+	server := newFakeAzure(2)
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, &Config{BufferSize: 8, MaxBuffers: 2})
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		object string
+		staged int
+	}{
+		{
+			name:   "single upload",
+			object: "0123456",
+			staged: 0,
+		},
+		{
+			name:   "staged blocks",
+			object: "0123456789abcdefghij",
+			staged: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("/tmp", "")
+			require.NoError(t, err)
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(tt.object)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			meta := &encoding.BlockMeta{
+				BlockID:  uuid.New(),
+				TenantID: "fake",
+			}
+			staged := server.staged
+			err = rw.Write(ctx, meta, []byte("bloom"), []byte("index"), f.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tt.staged, server.staged-staged)
+
+			buffer := make([]byte, len(tt.object))
+			err = rw.Object(ctx, meta.BlockID, meta.TenantID, 0, buffer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.object, string(buffer))
+
+			actualMeta, err := rw.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+			require.NoError(t, err)
+			assert.Equal(t, meta, actualMeta)
+		})
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	server := newFakeAzure(2)
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, &Config{})
+	ctx := context.Background()
+
+	var expected []string
+	for i := 0; i < 5; i++ {
+		tenantID := fmt.Sprintf("tenant-%d", i)
+		expected = append(expected, tenantID)
+		require.NoError(t, rw.WriteTenantIndex(ctx, tenantID, nil, nil))
+	}
+
+	tenants, err := rw.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, expected, tenants)
+
+	index, err := rw.TenantIndex(ctx, "tenant-0")
+	require.NoError(t, err)
+	assert.Len(t, index.Meta, 0)
+}
+
+func TestErrors(t *testing.T) {
+	server := newFakeAzure(2)
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, &Config{})
+	ctx := context.Background()
+	blockID := uuid.New()
+
+	// missing blobs map to the backend errors
+	_, err := rw.BlockMeta(ctx, blockID, "fake")
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	_, err = rw.CompactedBlockMeta(blockID, "fake")
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	_, err = rw.TenantIndex(ctx, "fake")
+	assert.Equal(t, backend.ErrIndexDoesNotExist, err)
+
+	// other failures are passed on with their service code
+	server.setError(http.StatusForbidden, azblob.ServiceCodeType("AuthorizationFailure"))
+	_, err = rw.BlockMeta(ctx, blockID, "fake")
+	assert.True(t, hasServiceCode(err, "AuthorizationFailure"))
+	_, err = rw.Bloom(ctx, blockID, "fake")
+	assert.True(t, hasServiceCode(err, "AuthorizationFailure"))
+	err = rw.Object(ctx, blockID, "fake", 0, make([]byte, 10))
+	assert.True(t, hasServiceCode(err, "AuthorizationFailure"))
+	_, err = rw.Tenants(ctx)
+	assert.Error(t, err)
+	err = rw.WriteTenantIndex(ctx, "fake", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestCreateContainer(t *testing.T) {
+	server := newFakeAzure(2)
+	defer server.Close()
+
+	// the container is created on startup and requests are signed with the account key
+	newTestReaderWriter(t, server, &Config{StorageAccountKey: base64.StdEncoding.EncodeToString([]byte("key"))})
+	server.mtx.Lock()
+	assert.True(t, server.created)
+	assert.True(t, strings.HasPrefix(server.authorization, "SharedKey account:"))
+	server.mtx.Unlock()
+
+	// a sas token that can't create the container is fine as long as it can be read
+	server.setError(http.StatusForbidden, azblob.ServiceCodeType("AuthorizationPermissionMismatch"))
+	server.mtx.Lock()
+	server.readableContainer = true
+	server.mtx.Unlock()
+	newTestReaderWriter(t, server, &Config{SASToken: "sig=abc"})
+
+	server.mtx.Lock()
+	server.readableContainer = false
+	server.mtx.Unlock()
+	u, err := url.Parse(server.URL + "/traces")
+	require.NoError(t, err)
+	_, err = newReaderWriter(&Config{ContainerName: "traces"}, azblob.NewAnonymousCredential(), *u, log.NewNopLogger())
+	assert.Error(t, err)
+}
+
+func newTestReaderWriter(t *testing.T, server *fakeAzure, cfg *Config) *readerWriter {
+	cfg.StorageAccountName = "account"
+	cfg.ContainerName = "traces"
+
+	credential, err := newCredential(cfg, log.NewNopLogger())
+	require.NoError(t, err)
+
+	u, err := url.Parse(server.URL + "/traces")
+	require.NoError(t, err)
+
+	rw, err := newReaderWriter(cfg, credential, *u, log.NewNopLogger())
+	require.NoError(t, err)
+	return rw
+}
+
+// fakeAzure is an in memory blob container that implements the calls the backend makes.  listings return
+// pageSize entries at a time.
+type fakeAzure struct {
+	*httptest.Server
+
+	pageSize int
+
+	mtx               sync.Mutex
+	status            int
+	serviceCode       azblob.ServiceCodeType
+	created           bool
+	readableContainer bool
+	authorization     string
+	staged            int
+	ranges            []string
+	blobs             map[string][]byte
+	blocks            map[string]map[string][]byte
+}
+
+func newFakeAzure(pageSize int) *fakeAzure {
+	f := &fakeAzure{
+		pageSize: pageSize,
+		blobs:    map[string][]byte{},
+		blocks:   map[string]map[string][]byte{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// setError fails every request other than reading the container's properties
+func (f *fakeAzure) setError(status int, code azblob.ServiceCodeType) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.status = status
+	f.serviceCode = code
+}
+
+func (f *fakeAzure) lastRange() string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if len(f.ranges) == 0 {
+		return ""
+	}
+	return f.ranges[len(f.ranges)-1]
+}
+
+func (f *fakeAzure) handle(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.authorization = r.Header.Get("Authorization")
+	query := r.URL.Query()
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/traces"), "/")
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if name == "" && query.Get("restype") == "container" && query.Get("comp") == "" {
+		if r.Method == http.MethodGet && f.readableContainer {
+			return
+		}
+		if f.status != 0 {
+			writeError(w, f.status, f.serviceCode)
+			return
+		}
+		if f.created {
+			writeError(w, http.StatusConflict, azblob.ServiceCodeContainerAlreadyExists)
+			return
+		}
+		f.created = true
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if f.status != 0 {
+		writeError(w, f.status, f.serviceCode)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		f.list(w, query.Get("prefix"), query.Get("delimiter"), query.Get("marker"))
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		if f.blocks[name] == nil {
+			f.blocks[name] = map[string][]byte{}
+		}
+		f.blocks[name][query.Get("blockid")] = body
+		f.staged++
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			writeError(w, http.StatusBadRequest, azblob.ServiceCodeInvalidXMLDocument)
+			return
+		}
+		var obj []byte
+		for _, id := range list.Latest {
+			b, ok := f.blocks[name][id]
+			if !ok {
+				writeError(w, http.StatusBadRequest, azblob.ServiceCodeInvalidBlockList)
+				return
+			}
+			obj = append(obj, b...)
+		}
+		f.blobs[name] = obj
+		delete(f.blocks, name)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			writeError(w, http.StatusBadRequest, azblob.ServiceCodeInvalidHeaderValue)
+			return
+		}
+		f.blobs[name] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet:
+		obj, ok := f.blobs[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, azblob.ServiceCodeBlobNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", "\"etag\"")
+		status := http.StatusOK
+		if rng := r.Header.Get("x-ms-range"); rng != "" {
+			f.ranges = append(f.ranges, rng)
+			var start, end int
+			_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if end >= len(obj) {
+				end = len(obj) - 1
+			}
+			obj = obj[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj)))
+		w.WriteHeader(status)
+		_, _ = w.Write(obj)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.blobs[name]; !ok {
+			writeError(w, http.StatusNotFound, azblob.ServiceCodeBlobNotFound)
+			return
+		}
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeAzure) list(w http.ResponseWriter, prefix string, delimiter string, marker string) {
+	// collect blobs and prefixes in order
+	entries := map[string]bool{}
+	for k := range f.blobs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, prefix)
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			entries[prefix+rest[:i+1]] = true
+		} else {
+			entries[k] = false
+		}
+	}
+	sorted := make([]string, 0, len(entries))
+	for e := range entries {
+		if e > marker {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Strings(sorted)
+
+	type blob struct {
+		Name string `xml:"Name"`
+	}
+	res := struct {
+		XMLName    xml.Name `xml:"EnumerationResults"`
+		Prefixes   []blob   `xml:"Blobs>BlobPrefix"`
+		Blobs      []blob   `xml:"Blobs>Blob"`
+		NextMarker string   `xml:"NextMarker"`
+	}{}
+	if len(sorted) > f.pageSize {
+		sorted = sorted[:f.pageSize]
+		res.NextMarker = sorted[len(sorted)-1]
+	}
+	for _, e := range sorted {
+		if entries[e] {
+			res.Prefixes = append(res.Prefixes, blob{e})
+		} else {
+			res.Blobs = append(res.Blobs, blob{e})
+		}
+	}
+
+	b, _ := xml.Marshal(res)
+	_, _ = w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, code azblob.ServiceCodeType) {
+	w.Header().Set("x-ms-error-code", string(code))
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>fake</Message></Error>", code)
+}
@@ -0,0 +1,105 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	// copy meta.json to meta.compacted.json.  server side copies are asynchronous in azure so the
+	// small meta is rewritten instead
+	ctx := context.TODO()
+	metaFileName := util.MetaFileName(blockID, tenantID)
+	bMeta, err := rw.readAll(ctx, metaFileName)
+	if err != nil {
+		return errors.Wrap(err, "error reading obj meta")
+	}
+
+	err = rw.writeAll(ctx, util.CompactedMetaFileName(blockID, tenantID), bMeta)
+	if err != nil {
+		return errors.Wrap(err, "error writing compacted obj meta")
+	}
+
+	// delete meta.json
+	_, err = rw.container.NewBlobURL(metaFileName).Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+	return err
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	prefix := util.BlockFileName(blockID, tenantID)
+	level.Debug(rw.logger).Log("msg", "deleting block", "block path", prefix)
+
+	ctx := context.TODO()
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		res, err := rw.container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+			Prefix: prefix,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error listing block in azure: %s", prefix)
+		}
+
+		for _, b := range res.Segment.BlobItems {
+			_, err = rw.container.NewBlobURL(b.Name).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+			if err != nil && !hasServiceCode(err, azblob.ServiceCodeBlobNotFound) {
+				return errors.Wrapf(err, "error deleting obj from azure: %s", b.Name)
+			}
+		}
+		marker = res.NextMarker
+	}
+
+	return nil
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return backend.ClearBlocks(rw, blockIDs, tenantID)
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	if len(tenantID) == 0 {
+		return nil, backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return nil, backend.ErrEmptyBlockID
+	}
+
+	compactedMetaFileName := util.CompactedMetaFileName(blockID, tenantID)
+	bytes, modTime, err := rw.readAllWithModTime(context.TODO(), compactedMetaFileName)
+	if hasServiceCode(err, azblob.ServiceCodeBlobNotFound) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching compacted meta file %s", compactedMetaFileName)
+	}
+
+	out := &encoding.CompactedBlockMeta{}
+	err = json.Unmarshal(bytes, out)
+	if err != nil {
+		return nil, err
+	}
+	out.CompactedTime = modTime
+
+	return out, nil
+}
@@ -0,0 +1,26 @@
+package azure
+
+import "github.com/grafana/tempo/tempodb/backend/transport"
+
+type Config struct {
+	StorageAccountName string `yaml:"storage_account_name"`
+	ContainerName      string `yaml:"container_name"`
+	// EndpointSuffix is the blob service domain.  Defaults to blob.core.windows.net.
+	EndpointSuffix string `yaml:"endpoint_suffix"`
+
+	// only one of StorageAccountKey, SASToken or UseManagedIdentity should be set
+	StorageAccountKey  string `yaml:"storage_account_key"`
+	SASToken           string `yaml:"sas_token"`
+	UseManagedIdentity bool   `yaml:"use_managed_identity"`
+	// UserAssignedID is the client id of the managed identity to use if the VM has more than one
+	UserAssignedID string `yaml:"user_assigned_id"`
+
+	// BufferSize and MaxBuffers bound the memory used to upload a block: up to MaxBuffers blocks of
+	// BufferSize bytes are staged at once
+	BufferSize int `yaml:"buffer_size"`
+	MaxBuffers int `yaml:"max_buffers"`
+	// MaxRetries is the number of times a failed request, including a broken read, is retried
+	MaxRetries int `yaml:"max_retries"`
+
+	Transport transport.Config `yaml:"transport"`
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/tempodb/encoding"
 )
 
@@ -12,6 +13,14 @@ var (
 	ErrMetaDoesNotExist = fmt.Errorf("meta does not exist")
 	ErrEmptyTenantID    = fmt.Errorf("empty tenant id")
 	ErrEmptyBlockID     = fmt.Errorf("empty block id")
+	ErrReadOnly         = fmt.Errorf("backend is read only")
+)
+
+// Names of the objects in a block that can be read with ReadRange
+const (
+	BloomName  = "bloom"
+	IndexName  = "index"
+	ObjectName = "data"
 )
 
 type AppendTracker interface{}
@@ -21,6 +30,8 @@ type Writer interface {
 
 	WriteBlockMeta(ctx context.Context, tracker AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error
 	AppendObject(ctx context.Context, tracker AppendTracker, meta *encoding.BlockMeta, bObject []byte) (AppendTracker, error)
+
+	WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error
 }
 
 type Reader interface {
@@ -30,6 +41,11 @@ type Reader interface {
 	Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error)
 	Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error)
 	Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error
+	// ReadRange fills buffer with the bytes of the named object of the block starting at offset, e.g. a
+	// page of the index.  A read running past the end of the object is not an error.
+	ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error
+	// TenantIndex returns ErrIndexDoesNotExist if the tenant has no index
+	TenantIndex(ctx context.Context, tenantID string) (*TenantIndex, error)
 
 	Shutdown()
 }
@@ -37,5 +53,17 @@ type Reader interface {
 type Compactor interface {
 	MarkBlockCompacted(blockID uuid.UUID, tenantID string) error
 	ClearBlock(blockID uuid.UUID, tenantID string) error
+	// ClearBlocks clears many blocks of a tenant with as few requests as the backend allows.  It keeps going
+	// past blocks that fail and returns their errors together.
+	ClearBlocks(blockIDs []uuid.UUID, tenantID string) error
 	CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error)
 }
+
+// ClearBlocks clears blocks one at a time for backends without a bulk delete
+func ClearBlocks(c Compactor, blockIDs []uuid.UUID, tenantID string) error {
+	errs := util.MultiError{}
+	for _, blockID := range blockIDs {
+		errs.Add(c.ClearBlock(blockID, tenantID))
+	}
+	return errs.Err()
+}
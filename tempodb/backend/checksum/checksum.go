@@ -0,0 +1,280 @@
+package checksum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	typeBloom = "bloom"
+	typeIndex = "index"
+)
+
+// ErrMismatch is returned when an object read from the backend does not match the checksum recorded when it
+// was written
+var ErrMismatch = errors.New("checksum mismatch")
+
+var (
+	metricMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "backend_checksum_mismatches_total",
+		Help:      "Total number of objects read from the backend that did not match their checksum.",
+	}, []string{"type"})
+
+	table = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type checksums struct {
+	bloom uint32
+	index uint32
+}
+
+type readerWriter struct {
+	logger log.Logger
+
+	// checksums of the blocks whose metas have been written or read.  blooms and indexes are only verified once
+	// their block's meta is known
+	mtx    sync.RWMutex
+	blocks map[uuid.UUID]checksums
+
+	nextReader    backend.Reader
+	nextWriter    backend.Writer
+	nextCompactor backend.Compactor
+}
+
+type appendTracker struct {
+	next     backend.AppendTracker
+	checksum uint32
+}
+
+// New records CRC32C checksums of the bloom, index and objects of every block written in its meta, and verifies
+// blooms and indexes read back against them.  Objects are read in ranges and can't be verified as a whole.
+func New(r backend.Reader, w backend.Writer, c backend.Compactor, logger log.Logger) (backend.Reader, backend.Writer, backend.Compactor) {
+	rw := &readerWriter{
+		logger:        logger,
+		blocks:        map[uuid.UUID]checksums{},
+		nextReader:    r,
+		nextWriter:    w,
+		nextCompactor: c,
+	}
+	return rw, rw, rw
+}
+
+// Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	return rw.nextReader.Tenants(ctx)
+}
+
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return rw.nextReader.Blocks(ctx, tenantID)
+}
+
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	meta, err := rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+	if err == nil {
+		rw.record(meta)
+	}
+	return meta, err
+}
+
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	bloom, err := rw.nextReader.Bloom(ctx, blockID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := rw.checksums(blockID)
+	if ok {
+		err = rw.verify(bloom, c.bloom, typeBloom, blockID, tenantID)
+	}
+	return bloom, err
+}
+
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	index, err := rw.nextReader.Index(ctx, blockID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := rw.checksums(blockID)
+	if ok {
+		err = rw.verify(index, c.index, typeIndex, blockID, tenantID)
+	}
+	return index, err
+}
+
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.nextReader.Object(ctx, blockID, tenantID, start, buffer)
+}
+
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	index, err := rw.nextReader.TenantIndex(ctx, tenantID)
+	if err == nil {
+		for _, meta := range index.Meta {
+			rw.record(meta)
+		}
+		for _, meta := range index.CompactedMeta {
+			rw.record(&meta.BlockMeta)
+		}
+	}
+	return index, err
+}
+
+func (rw *readerWriter) Shutdown() {
+	rw.nextReader.Shutdown()
+}
+
+// Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	objectChecksum, err := fileChecksum(objectFilePath)
+	if err != nil {
+		return err
+	}
+
+	meta.BloomChecksum = crc32.Checksum(bBloom, table)
+	meta.IndexChecksum = crc32.Checksum(bIndex, table)
+	meta.ObjectChecksum = objectChecksum
+
+	err = rw.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	if err == nil {
+		rw.record(meta)
+	}
+	return err
+}
+
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	if tracker != nil {
+		a := tracker.(*appendTracker)
+		tracker = a.next
+		meta.ObjectChecksum = a.checksum
+	}
+
+	meta.BloomChecksum = crc32.Checksum(bBloom, table)
+	meta.IndexChecksum = crc32.Checksum(bIndex, table)
+
+	err := rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	if err == nil {
+		rw.record(meta)
+	}
+	return err
+}
+
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	a, _ := tracker.(*appendTracker)
+	if a == nil {
+		a = &appendTracker{}
+	}
+
+	next, err := rw.nextWriter.AppendObject(ctx, a.next, meta, bObject)
+	if err != nil {
+		return a, err
+	}
+
+	a.next = next
+	a.checksum = crc32.Update(a.checksum, table, bObject)
+	return a, nil
+}
+
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return rw.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+}
+
+// Compactor
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return rw.nextCompactor.MarkBlockCompacted(blockID, tenantID)
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	err := rw.nextCompactor.ClearBlock(blockID, tenantID)
+
+	rw.mtx.Lock()
+	delete(rw.blocks, blockID)
+	rw.mtx.Unlock()
+
+	return err
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	err := rw.nextCompactor.ClearBlocks(blockIDs, tenantID)
+
+	rw.mtx.Lock()
+	for _, blockID := range blockIDs {
+		delete(rw.blocks, blockID)
+	}
+	rw.mtx.Unlock()
+
+	return err
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	meta, err := rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+	if err == nil {
+		rw.record(&meta.BlockMeta)
+	}
+	return meta, err
+}
+
+func (rw *readerWriter) record(meta *encoding.BlockMeta) {
+	if meta == nil || (meta.BloomChecksum == 0 && meta.IndexChecksum == 0) {
+		return
+	}
+
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+
+	rw.blocks[meta.BlockID] = checksums{
+		bloom: meta.BloomChecksum,
+		index: meta.IndexChecksum,
+	}
+}
+
+func (rw *readerWriter) checksums(blockID uuid.UUID) (checksums, bool) {
+	rw.mtx.RLock()
+	defer rw.mtx.RUnlock()
+
+	c, ok := rw.blocks[blockID]
+	return c, ok
+}
+
+func (rw *readerWriter) verify(b []byte, expected uint32, t string, blockID uuid.UUID, tenantID string) error {
+	actual := crc32.Checksum(b, table)
+	if actual == expected {
+		return nil
+	}
+
+	metricMismatches.WithLabelValues(t).Inc()
+	level.Error(rw.logger).Log("msg", "object read from backend does not match its checksum", "type", t, "blockID", blockID, "tenantID", tenantID, "expected", expected, "actual", actual)
+	return fmt.Errorf("%w: %s of block %s, tenant %s. expected %08x, got %08x", ErrMismatch, t, blockID, tenantID, expected, actual)
+}
+
+func fileChecksum(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc32.New(table)
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
@@ -0,0 +1,201 @@
+package checksum
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockBackend stores the last block written in memory
+type mockBackend struct {
+	meta    *encoding.BlockMeta
+	bloom   []byte
+	index   []byte
+	appends int
+}
+
+func (m *mockBackend) Tenants(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+func (m *mockBackend) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return nil, nil
+}
+func (m *mockBackend) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	meta := *m.meta
+	return &meta, nil
+}
+func (m *mockBackend) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return m.bloom, nil
+}
+func (m *mockBackend) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return m.index, nil
+}
+func (m *mockBackend) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return nil
+}
+func (m *mockBackend) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return nil
+}
+func (m *mockBackend) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	meta := *m.meta
+	return backend.NewTenantIndex([]*encoding.BlockMeta{&meta}, nil), nil
+}
+func (m *mockBackend) Shutdown() {}
+func (m *mockBackend) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	m.meta = meta
+	m.bloom = bBloom
+	m.index = bIndex
+	return nil
+}
+func (m *mockBackend) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	if tracker.(int) != m.appends {
+		return errors.New("unexpected tracker")
+	}
+	m.meta = meta
+	m.bloom = bBloom
+	m.index = bIndex
+	return nil
+}
+func (m *mockBackend) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	m.appends++
+	return m.appends, nil
+}
+func (m *mockBackend) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return nil
+}
+func (m *mockBackend) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return nil
+}
+func (m *mockBackend) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return nil
+}
+func (m *mockBackend) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return nil
+}
+func (m *mockBackend) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return nil, nil
+}
+
+func TestWriteRecordsChecksums(t *testing.T) {
+	f, err := ioutil.TempFile("", "object")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte("object"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	m := &mockBackend{}
+	_, w, _ := New(m, m, m, log.NewNopLogger())
+
+	meta := encoding.NewBlockMeta("tenant", uuid.New())
+	err = w.Write(context.Background(), meta, []byte("bloom"), []byte("index"), f.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, crc32.Checksum([]byte("bloom"), table), m.meta.BloomChecksum)
+	assert.Equal(t, crc32.Checksum([]byte("index"), table), m.meta.IndexChecksum)
+	assert.Equal(t, crc32.Checksum([]byte("object"), table), m.meta.ObjectChecksum)
+}
+
+func TestAppendRecordsChecksums(t *testing.T) {
+	m := &mockBackend{}
+	_, w, _ := New(m, m, m, log.NewNopLogger())
+
+	meta := encoding.NewBlockMeta("tenant", uuid.New())
+	var tracker backend.AppendTracker
+	var err error
+	for _, b := range []string{"obj", "ect"} {
+		tracker, err = w.AppendObject(context.Background(), tracker, meta, []byte(b))
+		require.NoError(t, err)
+	}
+	err = w.WriteBlockMeta(context.Background(), tracker, meta, []byte("bloom"), []byte("index"))
+	require.NoError(t, err)
+
+	assert.Equal(t, crc32.Checksum([]byte("object"), table), m.meta.ObjectChecksum)
+	assert.Equal(t, crc32.Checksum([]byte("bloom"), table), m.meta.BloomChecksum)
+}
+
+func TestVerify(t *testing.T) {
+	blockID := uuid.New()
+	checksummed := encoding.NewBlockMeta("tenant", blockID)
+	checksummed.BloomChecksum = crc32.Checksum([]byte("bloom"), table)
+	checksummed.IndexChecksum = crc32.Checksum([]byte("index"), table)
+
+	tests := []struct {
+		name      string
+		meta      *encoding.BlockMeta
+		read      func(r backend.Reader) error
+		bloom     string
+		expectErr bool
+	}{
+		{
+			name:  "matches",
+			meta:  checksummed,
+			read:  readMeta,
+			bloom: "bloom",
+		},
+		{
+			name:      "corrupt",
+			meta:      checksummed,
+			read:      readMeta,
+			bloom:     "blOom",
+			expectErr: true,
+		},
+		{
+			name:      "checksums from tenant index",
+			meta:      checksummed,
+			read:      readTenantIndex,
+			bloom:     "blOom",
+			expectErr: true,
+		},
+		{
+			name:  "unknown block",
+			meta:  checksummed,
+			read:  func(r backend.Reader) error { return nil },
+			bloom: "blOom",
+		},
+		{
+			name:  "written before checksums",
+			meta:  encoding.NewBlockMeta("tenant", blockID),
+			read:  readMeta,
+			bloom: "blOom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockBackend{meta: tt.meta, bloom: []byte(tt.bloom), index: []byte("index")}
+			r, _, _ := New(m, m, m, log.NewNopLogger())
+			require.NoError(t, tt.read(r))
+
+			_, err := r.Bloom(context.Background(), blockID, "tenant")
+			if tt.expectErr {
+				assert.True(t, errors.Is(err, ErrMismatch))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			_, err = r.Index(context.Background(), blockID, "tenant")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func readMeta(r backend.Reader) error {
+	_, err := r.BlockMeta(context.Background(), uuid.Nil, "tenant")
+	return err
+}
+
+func readTenantIndex(r backend.Reader) error {
+	_, err := r.TenantIndex(context.Background(), "tenant")
+	return err
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+// copyChunkSize is the size of the ranges objects are copied in.  it's above the s3 minimum part size so
+// every chunk but the last can be appended as a part
+const copyChunkSize = 16 * 1024 * 1024
+
+// CopyBlock copies a block from r to w.  meta is the block's meta as it should be written to w.  The meta is
+// written last so the block is never listed in w half copied.
+func CopyBlock(ctx context.Context, r Reader, w Writer, meta *encoding.BlockMeta) error {
+	if meta.Size == 0 {
+		return fmt.Errorf("block %s was written before its size was recorded and can't be copied", meta.BlockID)
+	}
+
+	bloom, err := r.Bloom(ctx, meta.BlockID, meta.TenantID)
+	if err != nil {
+		return fmt.Errorf("error reading bloom: %w", err)
+	}
+	index, err := r.Index(ctx, meta.BlockID, meta.TenantID)
+	if err != nil {
+		return fmt.Errorf("error reading index: %w", err)
+	}
+
+	var tracker AppendTracker
+	buffer := make([]byte, copyChunkSize)
+	for offset := uint64(0); offset < meta.Size; offset += uint64(len(buffer)) {
+		if remaining := meta.Size - offset; remaining < uint64(len(buffer)) {
+			buffer = buffer[:remaining]
+		}
+
+		err = r.ReadRange(ctx, ObjectName, meta.BlockID, meta.TenantID, offset, buffer)
+		if err != nil {
+			return fmt.Errorf("error reading object: %w", err)
+		}
+		tracker, err = w.AppendObject(ctx, tracker, meta, buffer)
+		if err != nil {
+			return fmt.Errorf("error copying object: %w", err)
+		}
+	}
+
+	err = w.WriteBlockMeta(ctx, tracker, meta, bloom, index)
+	if err != nil {
+		return fmt.Errorf("error writing meta: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package cos
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // cos signs requests with hmac-sha1
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/tempo/tempodb/backend/transport"
+)
+
+const (
+	errCodeNoSuchKey = "NoSuchKey"
+
+	listMaxKeys = 1000
+
+	// signatures are valid for this long after a request is signed
+	signatureExpiry = time.Hour
+)
+
+// cosError is the error document cos returns for failed requests
+type cosError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *cosError) Error() string {
+	return fmt.Sprintf("cos error %d %s: %s (request id %s)", e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+func isNoSuchKey(err error) bool {
+	cosErr, ok := err.(*cosError)
+	return ok && cosErr.Code == errCodeNoSuchKey
+}
+
+// client is a minimal client of the cos xml api.  it implements the handful of calls the backend needs.
+type client struct {
+	baseURL   *url.URL
+	host      string
+	secretID  string
+	secretKey string
+	http      *http.Client
+	now       func() time.Time
+}
+
+func newClient(cfg *Config) (*client, error) {
+	scheme := "https"
+	if cfg.Insecure {
+		scheme = "http"
+	}
+
+	tr, err := transport.New(cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	host := bucketHost(cfg)
+	u, err := url.Parse(fmt.Sprintf("%s://%s", scheme, host))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		baseURL:   u,
+		host:      host,
+		secretID:  cfg.SecretID,
+		secretKey: cfg.SecretKey,
+		http:      &http.Client{Transport: tr},
+		now:       time.Now,
+	}, nil
+}
+
+// bucketHost returns the hostname of the bucket.  the appid is appended unless the bucket name already
+// carries it.
+func bucketHost(cfg *Config) string {
+	bucket := cfg.Bucket
+	if cfg.AppID != "" && !strings.HasSuffix(bucket, "-"+cfg.AppID) {
+		bucket += "-" + cfg.AppID
+	}
+	return fmt.Sprintf("%s.cos.%s.myqcloud.com", bucket, cfg.Region)
+}
+
+// request describes a call to the api
+type request struct {
+	method string
+	object string
+	params url.Values
+	header http.Header
+	body   io.Reader
+	length int64
+}
+
+func (c *client) do(ctx context.Context, r *request) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path = "/" + r.object
+	u.RawQuery = encodeParams(r.params)
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), r.body)
+	if err != nil {
+		return nil, err
+	}
+	if r.header != nil {
+		req.Header = r.header
+	}
+	if r.body != nil {
+		req.ContentLength = r.length
+	}
+	// sign the bucket's host even when the request is sent elsewhere, e.g. to a proxy
+	req.Host = c.host
+	req.Header.Set("Authorization", c.authorization(req, r, c.now()))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		cosErr := &cosError{StatusCode: resp.StatusCode}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = xml.Unmarshal(body, cosErr)
+		return nil, cosErr
+	}
+
+	return resp, nil
+}
+
+// authorization implements cos's request signature.  every header and query parameter is signed:
+//
+//	SignKey      = hex(hmac-sha1(SecretKey, KeyTime))
+//	HttpString   = method\npath\nparams\nheaders\n
+//	StringToSign = sha1\nKeyTime\nhex(sha1(HttpString))\n
+//	Signature    = hex(hmac-sha1(SignKey, StringToSign))
+func (c *client) authorization(req *http.Request, r *request, now time.Time) string {
+	keyTime := fmt.Sprintf("%d;%d", now.Unix(), now.Add(signatureExpiry).Unix())
+
+	headers := map[string]string{
+		"host": req.Host,
+	}
+	for k := range req.Header {
+		headers[k] = req.Header.Get(k)
+	}
+	params := map[string]string{}
+	for k := range r.params {
+		params[k] = r.params.Get(k)
+	}
+
+	headerList, headerString := canonicalize(headers)
+	paramList, paramString := canonicalize(params)
+
+	httpString := strings.ToLower(req.Method) + "\n" + "/" + r.object + "\n" + paramString + "\n" + headerString + "\n"
+	httpStringSum := sha1.Sum([]byte(httpString)) //nolint:gosec
+	stringToSign := "sha1\n" + keyTime + "\n" + hex.EncodeToString(httpStringSum[:]) + "\n"
+
+	signKey := hmacSHA1Hex([]byte(c.secretKey), keyTime)
+	signature := hmacSHA1Hex([]byte(signKey), stringToSign)
+
+	return strings.Join([]string{
+		"q-sign-algorithm=sha1",
+		"q-ak=" + c.secretID,
+		"q-sign-time=" + keyTime,
+		"q-key-time=" + keyTime,
+		"q-header-list=" + headerList,
+		"q-url-param-list=" + paramList,
+		"q-signature=" + signature,
+	}, "&")
+}
+
+// canonicalize returns the sorted, ;-separated keys and the sorted key=value pairs cos signs.  keys are
+// lowercased and both keys and values are url encoded.
+func canonicalize(m map[string]string) (string, string) {
+	escaped := make(map[string]string, len(m))
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		k = url.QueryEscape(strings.ToLower(k))
+		escaped[k] = url.QueryEscape(v)
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+escaped[k])
+	}
+	return strings.Join(keys, ";"), strings.Join(pairs, "&")
+}
+
+func encodeParams(v url.Values) string {
+	// cos expects valueless subresources such as ?uploads without a trailing =
+	return strings.Replace(v.Encode(), "uploads=", "uploads", 1)
+}
+
+func hmacSHA1Hex(key []byte, s string) string {
+	h := hmac.New(sha1.New, key)
+	_, _ = h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *client) putObject(ctx context.Context, name string, body io.Reader, length int64) error {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		object: name,
+		body:   body,
+		length: length,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) putObjectBytes(ctx context.Context, name string, b []byte) error {
+	return c.putObject(ctx, name, bytes.NewReader(b), int64(len(b)))
+}
+
+// getObject returns the object and its last modified time.  length 0 reads to the end.
+func (c *client) getObject(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, time.Time, error) {
+	header := http.Header{}
+	if offset > 0 || length > 0 {
+		rng := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			rng += fmt.Sprintf("%d", offset+length-1)
+		}
+		header.Set("Range", rng)
+	}
+
+	resp, err := c.do(ctx, &request{
+		method: http.MethodGet,
+		object: name,
+		header: header,
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, modTime, nil
+}
+
+func (c *client) copyObject(ctx context.Context, src string, dst string) error {
+	header := http.Header{}
+	header.Set("x-cos-copy-source", c.host+"/"+src)
+
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		object: dst,
+		header: header,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) deleteObject(ctx context.Context, name string) error {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodDelete,
+		object: name,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type listResult struct {
+	IsTruncated bool   `xml:"IsTruncated"`
+	NextMarker  string `xml:"NextMarker"`
+	Contents    []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list returns the keys and common prefixes below prefix.  every page is read; the listing is only
+// complete once cos stops reporting it truncated.
+func (c *client) list(ctx context.Context, prefix string, delimiter string) (keys []string, prefixes []string, err error) {
+	marker := ""
+	for {
+		params := url.Values{}
+		params.Set("prefix", prefix)
+		params.Set("marker", marker)
+		params.Set("max-keys", fmt.Sprintf("%d", listMaxKeys))
+		if delimiter != "" {
+			params.Set("delimiter", delimiter)
+		}
+
+		resp, err := c.do(ctx, &request{
+			method: http.MethodGet,
+			params: params,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res := &listResult{}
+		err = decodeXML(resp, res)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		last := ""
+		for _, o := range res.Contents {
+			last = o.Key
+			// with a delimiter cos lists a "directory" placeholder object equal to the prefix itself
+			if o.Key == prefix {
+				continue
+			}
+			keys = append(keys, o.Key)
+		}
+		for _, p := range res.CommonPrefixes {
+			if p.Prefix > last {
+				last = p.Prefix
+			}
+			prefixes = append(prefixes, p.Prefix)
+		}
+
+		if !res.IsTruncated {
+			return keys, prefixes, nil
+		}
+
+		// cos omits the next marker from some truncated listings.  continue from the last entry returned
+		next := res.NextMarker
+		if next == "" {
+			next = last
+		}
+		if next == "" || next == marker {
+			return nil, nil, fmt.Errorf("cos listing of %s is truncated but cannot be continued", prefix)
+		}
+		marker = next
+	}
+}
+
+type part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *client) initiateMultipartUpload(ctx context.Context, name string) (string, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPost,
+		object: name,
+		params: url.Values{"uploads": []string{""}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res := &struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	err = decodeXML(resp, res)
+	if err != nil {
+		return "", err
+	}
+	return res.UploadID, nil
+}
+
+func (c *client) uploadPart(ctx context.Context, name string, uploadID string, partNumber int, b []byte) (part, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		object: name,
+		params: url.Values{
+			"partNumber": []string{fmt.Sprintf("%d", partNumber)},
+			"uploadId":   []string{uploadID},
+		},
+		body:   bytes.NewReader(b),
+		length: int64(len(b)),
+	})
+	if err != nil {
+		return part{}, err
+	}
+	defer resp.Body.Close()
+
+	return part{
+		PartNumber: partNumber,
+		ETag:       resp.Header.Get("ETag"),
+	}, nil
+}
+
+func (c *client) completeMultipartUpload(ctx context.Context, name string, uploadID string, parts []part) error {
+	body, err := xml.Marshal(&struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{
+		Parts: parts,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPost,
+		object: name,
+		params: url.Values{"uploadId": []string{uploadID}},
+		body:   bytes.NewReader(body),
+		length: int64(len(body)),
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func decodeXML(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
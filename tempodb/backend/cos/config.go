@@ -0,0 +1,21 @@
+package cos
+
+import "github.com/grafana/tempo/tempodb/backend/transport"
+
+type Config struct {
+	// Bucket is the bucket name without the appid suffix
+	Bucket string `yaml:"bucket"`
+	// AppID is the account's appid.  cos bucket hostnames are <bucket>-<appid>.cos.<region>.myqcloud.com
+	AppID    string `yaml:"app_id"`
+	Region   string `yaml:"region"`
+	Insecure bool   `yaml:"insecure"`
+
+	SecretID  string `yaml:"secret_id"`
+	SecretKey string `yaml:"secret_key"`
+
+	// PartSize is the size of the parts blocks are uploaded in.  Blocks smaller than this are uploaded
+	// with a single request.
+	PartSize int64 `yaml:"part_size"`
+
+	Transport transport.Config `yaml:"transport"`
+}
@@ -0,0 +1,354 @@
+package cos
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+const (
+	defaultPartSize = 64 * 1024 * 1024
+	// cos rejects parts smaller than this, except for the last one
+	minPartSize = 1024 * 1024
+)
+
+// readerWriter can read/write from a cos backend
+type readerWriter struct {
+	logger log.Logger
+	cfg    *Config
+	client *client
+}
+
+// appendTracker is the state of a multipart upload started by AppendObject
+type appendTracker struct {
+	objName  string
+	uploadID string
+	parts    []part
+	buffer   []byte
+}
+
+func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating cos client")
+	}
+
+	rw := &readerWriter{
+		logger: log_util.Logger,
+		cfg:    cfg,
+		client: c,
+	}
+
+	return rw, rw, rw, nil
+}
+
+// Write implements backend.Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	src, err := os.Open(objectFilePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	objName := util.ObjectFileName(meta.BlockID, meta.TenantID)
+	if info.Size() <= rw.partSize() {
+		err = rw.client.putObject(ctx, objName, src, info.Size())
+	} else {
+		err = rw.multipartUpload(ctx, objName, src)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error writing object to cos backend, object %s", objName)
+	}
+
+	level.Debug(rw.logger).Log("msg", "object uploaded to cos", "objectName", objName, "size", info.Size())
+
+	return rw.WriteBlockMeta(ctx, nil, meta, bBloom, bIndex)
+}
+
+// WriteBlockMeta implements backend.Writer
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	if tracker != nil {
+		a := tracker.(*appendTracker)
+		err := rw.completeAppend(ctx, a)
+		if err != nil {
+			return errors.Wrap(err, "error completing multipart upload")
+		}
+	}
+
+	blockID := meta.BlockID
+	tenantID := meta.TenantID
+
+	err := rw.client.putObjectBytes(ctx, util.BloomFileName(blockID, tenantID), bBloom)
+	if err != nil {
+		return err
+	}
+
+	err = rw.client.putObjectBytes(ctx, util.IndexFileName(blockID, tenantID), bIndex)
+	if err != nil {
+		return err
+	}
+
+	bMeta, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// write meta last.  this will prevent blocklist from returning a partial block
+	return rw.client.putObjectBytes(ctx, util.MetaFileName(blockID, tenantID), bMeta)
+}
+
+// AppendObject implements backend.Writer.  appended objects are buffered and uploaded a part at a time.
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	var a *appendTracker
+	if tracker == nil {
+		objName := util.ObjectFileName(meta.BlockID, meta.TenantID)
+		uploadID, err := rw.client.initiateMultipartUpload(ctx, objName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error initiating multipart upload, object %s", objName)
+		}
+
+		a = &appendTracker{
+			objName:  objName,
+			uploadID: uploadID,
+		}
+	} else {
+		a = tracker.(*appendTracker)
+	}
+
+	a.buffer = append(a.buffer, bObject...)
+	for int64(len(a.buffer)) >= rw.partSize() {
+		err := rw.uploadPart(ctx, a, a.buffer[:rw.partSize()])
+		if err != nil {
+			return nil, err
+		}
+		a.buffer = a.buffer[rw.partSize():]
+	}
+
+	return a, nil
+}
+
+// WriteTenantIndex implements backend.Writer
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = rw.client.putObjectBytes(ctx, util.TenantIndexFileName(tenantID), bIndex)
+	if err != nil {
+		return errors.Wrapf(err, "error writing tenant index to cos backend, tenantID: %s", tenantID)
+	}
+
+	return nil
+}
+
+// Tenants implements backend.Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	dirs, err := rw.listDirs(ctx, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing tenants in bucket %s", rw.cfg.Bucket)
+	}
+
+	return dirs, nil
+}
+
+// Blocks implements backend.Reader
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	dirs, err := rw.listDirs(ctx, tenantID+"/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing blocks in cos bucket, bucket: %s", rw.cfg.Bucket)
+	}
+
+	blockIDs := make([]uuid.UUID, 0, len(dirs))
+	for _, d := range dirs {
+		blockID, err := uuid.Parse(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing uuid of obj, objectName: %s", d)
+		}
+		blockIDs = append(blockIDs, blockID)
+	}
+	return blockIDs, nil
+}
+
+// BlockMeta implements backend.Reader
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	body, _, err := rw.readAll(ctx, util.MetaFileName(blockID, tenantID))
+	if isNoSuchKey(err) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := &encoding.BlockMeta{}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Bloom implements backend.Reader
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	body, _, err := rw.readAll(ctx, util.BloomFileName(blockID, tenantID))
+	return body, err
+}
+
+// Index implements backend.Reader
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	body, _, err := rw.readAll(ctx, util.IndexFileName(blockID, tenantID))
+	return body, err
+}
+
+// Object implements backend.Reader
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.ReadRange(ctx, backend.ObjectName, blockID, tenantID, start, buffer)
+}
+
+// ReadRange implements backend.Reader
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	objName := util.FileName(blockID, tenantID, name)
+
+	body, _, err := rw.client.getObject(ctx, objName, int64(start), int64(len(buffer)))
+	if err != nil {
+		return errors.Wrapf(err, "error in range read from cos backend, bucket: %s, objName: %s", rw.cfg.Bucket, objName)
+	}
+	defer body.Close()
+
+	_, err = io.ReadFull(body, buffer)
+	if err == io.ErrUnexpectedEOF {
+		// the last read of a block may run past the end of the object
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error in range read from cos backend")
+	}
+	return nil
+}
+
+// TenantIndex implements backend.Reader
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	body, _, err := rw.readAll(ctx, util.TenantIndexFileName(tenantID))
+	if isNoSuchKey(err) {
+		return nil, backend.ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UnmarshalTenantIndex(body)
+}
+
+// Shutdown implements backend.Reader
+func (rw *readerWriter) Shutdown() {
+}
+
+// listDirs returns the names of the pseudo directories directly below prefix
+func (rw *readerWriter) listDirs(ctx context.Context, prefix string) ([]string, error) {
+	_, prefixes, err := rw.client.list(ctx, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		dirs = append(dirs, strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"))
+	}
+	return dirs, nil
+}
+
+func (rw *readerWriter) readAll(ctx context.Context, name string) ([]byte, time.Time, error) {
+	body, modTime, err := rw.client.getObject(ctx, name, 0, 0)
+	if err != nil {
+		// do not wrap this error.  callers check it with isNoSuchKey
+		return nil, time.Time{}, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return b, modTime, nil
+}
+
+func (rw *readerWriter) multipartUpload(ctx context.Context, objName string, src io.Reader) error {
+	uploadID, err := rw.client.initiateMultipartUpload(ctx, objName)
+	if err != nil {
+		return err
+	}
+
+	a := &appendTracker{
+		objName:  objName,
+		uploadID: uploadID,
+	}
+
+	buffer := make([]byte, rw.partSize())
+	for {
+		n, err := io.ReadFull(src, buffer)
+		if n > 0 {
+			if uploadErr := rw.uploadPart(ctx, a, buffer[:n]); uploadErr != nil {
+				return uploadErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return rw.client.completeMultipartUpload(ctx, objName, uploadID, a.parts)
+}
+
+func (rw *readerWriter) uploadPart(ctx context.Context, a *appendTracker, b []byte) error {
+	p, err := rw.client.uploadPart(ctx, a.objName, a.uploadID, len(a.parts)+1, b)
+	if err != nil {
+		return errors.Wrapf(err, "error uploading part %d of %s", len(a.parts)+1, a.objName)
+	}
+	a.parts = append(a.parts, p)
+	return nil
+}
+
+// completeAppend uploads whatever is left in the buffer as the final part and completes the upload
+func (rw *readerWriter) completeAppend(ctx context.Context, a *appendTracker) error {
+	if len(a.buffer) > 0 || len(a.parts) == 0 {
+		err := rw.uploadPart(ctx, a, a.buffer)
+		if err != nil {
+			return err
+		}
+		a.buffer = nil
+	}
+
+	return rw.client.completeMultipartUpload(ctx, a.objName, a.uploadID, a.parts)
+}
+
+func (rw *readerWriter) partSize() int64 {
+	if rw.cfg.PartSize <= 0 {
+		return defaultPartSize
+	}
+	if rw.cfg.PartSize < minPartSize {
+		return minPartSize
+	}
+	return rw.cfg.PartSize
+}
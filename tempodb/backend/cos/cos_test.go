@@ -0,0 +1,325 @@
+package cos
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func TestBucketHost(t *testing.T) {
+	assert.Equal(t, "traces-1250000000.cos.ap-guangzhou.myqcloud.com", bucketHost(&Config{Bucket: "traces", AppID: "1250000000", Region: "ap-guangzhou"}))
+	assert.Equal(t, "traces-1250000000.cos.ap-guangzhou.myqcloud.com", bucketHost(&Config{Bucket: "traces-1250000000", AppID: "1250000000", Region: "ap-guangzhou"}))
+}
+
+func TestAuthorization(t *testing.T) {
+	c := &client{
+		secretID:  "id",
+		secretKey: "secret",
+	}
+
+	req, err := http.NewRequest(http.MethodPut, "http://traces-1250000000.cos.ap-guangzhou.myqcloud.com/single/Test.txt?partNumber=1&uploadId=abc", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("x-cos-meta-Author", "a b")
+
+	auth := c.authorization(req, &request{
+		object: "single/Test.txt",
+		params: url.Values{"partNumber": []string{"1"}, "uploadId": []string{"abc"}},
+	}, time.Unix(1557989753, 0))
+
+	fields := url.Values{}
+	for _, f := range strings.Split(auth, "&") {
+		kv := strings.SplitN(f, "=", 2)
+		require.Len(t, kv, 2)
+		fields.Set(kv[0], kv[1])
+	}
+	assert.Equal(t, "sha1", fields.Get("q-sign-algorithm"))
+	assert.Equal(t, "id", fields.Get("q-ak"))
+	assert.Equal(t, "1557989753;1557993353", fields.Get("q-sign-time"))
+	assert.Equal(t, "1557989753;1557993353", fields.Get("q-key-time"))
+	assert.Equal(t, "content-type;host;x-cos-meta-author", fields.Get("q-header-list"))
+	assert.Equal(t, "partnumber;uploadid", fields.Get("q-url-param-list"))
+	assert.Len(t, fields.Get("q-signature"), 40)
+
+	// the signature covers the headers
+	req.Header.Set("Content-Type", "text/html")
+	auth2 := c.authorization(req, &request{
+		object: "single/Test.txt",
+		params: url.Values{"partNumber": []string{"1"}, "uploadId": []string{"abc"}},
+	}, time.Unix(1557989753, 0))
+	assert.NotEqual(t, auth, auth2)
+}
+
+func TestReadWrite(t *testing.T) {
+	server := newFakeCOS(2, true)
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, 0)
+	ctx := context.Background()
+
+	blockID := uuid.New()
+	tenantID := "fake"
+	meta := &encoding.BlockMeta{
+		BlockID:  blockID,
+		TenantID: tenantID,
+	}
+
+	// append more than a part's worth to exercise the multipart upload
+	object := []byte(strings.Repeat("a", minPartSize+10))
+	tracker, err := rw.AppendObject(ctx, nil, meta, object[:minPartSize/2])
+	require.NoError(t, err)
+	tracker, err = rw.AppendObject(ctx, tracker, meta, object[minPartSize/2:])
+	require.NoError(t, err)
+	err = rw.WriteBlockMeta(ctx, tracker, meta, []byte("bloom"), []byte("index"))
+	require.NoError(t, err)
+
+	actualMeta, err := rw.BlockMeta(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, meta, actualMeta)
+
+	bloom, err := rw.Bloom(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bloom"), bloom)
+
+	buffer := make([]byte, 20)
+	err = rw.Object(ctx, blockID, tenantID, minPartSize-5, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, object[minPartSize-5:], buffer[:15])
+
+	// paging through the listing
+	tenants, err := rw.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tenantID}, tenants)
+
+	// a directory placeholder object is not a block
+	require.NoError(t, rw.client.putObjectBytes(ctx, tenantID+"/", nil))
+	blocks, err := rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{blockID}, blocks)
+
+	_, err = rw.BlockMeta(ctx, uuid.New(), tenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	_, err = rw.TenantIndex(ctx, tenantID)
+	assert.Equal(t, backend.ErrIndexDoesNotExist, err)
+
+	// compaction
+	err = rw.MarkBlockCompacted(blockID, tenantID)
+	require.NoError(t, err)
+	_, err = rw.BlockMeta(ctx, blockID, tenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	compactedMeta, err := rw.CompactedBlockMeta(blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, *meta, compactedMeta.BlockMeta)
+	assert.False(t, compactedMeta.CompactedTime.IsZero())
+
+	err = rw.ClearBlock(blockID, tenantID)
+	require.NoError(t, err)
+	blocks, err = rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 0)
+}
+
+func TestListPagination(t *testing.T) {
+	for _, nextMarker := range []bool{true, false} {
+		t.Run(fmt.Sprintf("nextMarker=%t", nextMarker), func(t *testing.T) {
+			testListPagination(t, nextMarker)
+		})
+	}
+}
+
+func testListPagination(t *testing.T, nextMarker bool) {
+	server := newFakeCOS(2, nextMarker)
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, 0)
+	ctx := context.Background()
+
+	var expected []string
+	for i := 0; i < 5; i++ {
+		tenantID := fmt.Sprintf("tenant-%d", i)
+		expected = append(expected, tenantID)
+		require.NoError(t, rw.client.putObjectBytes(ctx, tenantID+"/index.json.gz", []byte("x")))
+	}
+
+	tenants, err := rw.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, expected, tenants)
+}
+
+func newTestReaderWriter(t *testing.T, server *fakeCOS, partSize int64) *readerWriter {
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	cfg := &Config{
+		Bucket:    "bucket",
+		AppID:     "1250000000",
+		Region:    "ap-guangzhou",
+		SecretID:  "id",
+		SecretKey: "secret",
+		PartSize:  partSize,
+	}
+	c, err := newClient(cfg)
+	require.NoError(t, err)
+	c.baseURL = u
+
+	return &readerWriter{
+		logger: log.NewNopLogger(),
+		cfg:    cfg,
+		client: c,
+	}
+}
+
+// fakeCOS is an in memory cos that implements the calls the backend makes.  listings return pageSize
+// entries at a time.
+type fakeCOS struct {
+	*httptest.Server
+
+	pageSize int
+	// nextMarker is false to omit NextMarker from truncated listings as cos sometimes does
+	nextMarker bool
+
+	mtx     sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+}
+
+func newFakeCOS(pageSize int, nextMarker bool) *fakeCOS {
+	f := &fakeCOS{
+		pageSize:   pageSize,
+		nextMarker: nextMarker,
+		objects:    map[string][]byte{},
+		uploads:    map[string]map[int][]byte{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeCOS) handle(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "q-sign-algorithm=sha1&q-ak=id&") {
+		writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, query.Get("prefix"), query.Get("delimiter"), query.Get("marker"))
+	case r.Method == http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, errCodeNoSuchKey)
+			return
+		}
+		var start, end int
+		if n, _ := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); n == 2 {
+			if end >= len(obj) {
+				end = len(obj) - 1
+			}
+			obj = obj[start : end+1]
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write(obj)
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		var partNumber int
+		_, _ = fmt.Sscanf(query.Get("partNumber"), "%d", &partNumber)
+		f.uploads[query.Get("uploadId")][partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"%d\"", partNumber))
+	case r.Method == http.MethodPut && r.Header.Get("x-cos-copy-source") != "":
+		src := strings.SplitN(r.Header.Get("x-cos-copy-source"), "/", 2)[1]
+		f.objects[key] = f.objects[src]
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		uploadID := uuid.New().String()
+		f.uploads[uploadID] = map[int][]byte{}
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPost:
+		parts := f.uploads[query.Get("uploadId")]
+		var obj []byte
+		for i := 1; i <= len(parts); i++ {
+			obj = append(obj, parts[i]...)
+		}
+		f.objects[key] = obj
+		delete(f.uploads, query.Get("uploadId"))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeCOS) list(w http.ResponseWriter, prefix string, delimiter string, marker string) {
+	// collect keys and common prefixes in order
+	entries := map[string]bool{}
+	for k := range f.objects {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, prefix)
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			entries[prefix+rest[:i+1]] = true
+		} else {
+			entries[k] = false
+		}
+	}
+	sorted := make([]string, 0, len(entries))
+	for e := range entries {
+		if e > marker {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Strings(sorted)
+
+	res := listResult{}
+	if len(sorted) > f.pageSize {
+		sorted = sorted[:f.pageSize]
+		res.IsTruncated = true
+		if f.nextMarker {
+			res.NextMarker = sorted[len(sorted)-1]
+		}
+	}
+	for _, e := range sorted {
+		if entries[e] {
+			res.CommonPrefixes = append(res.CommonPrefixes, struct {
+				Prefix string `xml:"Prefix"`
+			}{e})
+		} else {
+			res.Contents = append(res.Contents, struct {
+				Key string `xml:"Key"`
+			}{e})
+		}
+	}
+
+	b, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listResult
+	}{listResult: res})
+	_, _ = w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>fake</Message></Error>", code)
+}
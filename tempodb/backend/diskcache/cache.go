@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -126,6 +127,43 @@ func (r *reader) Object(ctx context.Context, blockID uuid.UUID, tenantID string,
 	return r.next.Object(ctx, blockID, tenantID, start, buffer)
 }
 
+// ReadRange caches the pages of paged indexes and the shards of sharded blooms by their offset and length.
+// Ranges of the data object are read through like Object.
+func (r *reader) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	if name != backend.BloomName && name != backend.IndexName {
+		return r.next.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	}
+
+	b, skippableErr, err := r.readOrCacheToDisk(ctx, rangeKey(blockID, tenantID, name, start, len(buffer)), name, func(ctx context.Context) ([]byte, error) {
+		err := r.next.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+		if err != nil {
+			return nil, err
+		}
+		return buffer, nil
+	})
+
+	if skippableErr != nil {
+		metricDiskCache.WithLabelValues(name, "error").Inc()
+		level.Error(r.logger).Log("err", skippableErr)
+	} else {
+		metricDiskCache.WithLabelValues(name, "success").Inc()
+	}
+
+	if err != nil {
+		return err
+	}
+	if len(b) != len(buffer) {
+		return fmt.Errorf("cached range of %s is %d bytes, expected %d", name, len(b), len(buffer))
+	}
+
+	copy(buffer, b)
+	return nil
+}
+
+func (r *reader) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return r.next.TenantIndex(ctx, tenantID)
+}
+
 func (r *reader) Shutdown() {
 	r.stopCh <- struct{}{}
 	r.next.Shutdown()
@@ -134,3 +172,8 @@ func (r *reader) Shutdown() {
 func key(blockID uuid.UUID, tenantID string, t string) string {
 	return blockID.String() + ":" + tenantID + ":" + t
 }
+
+// rangeKey is the key of part of a bloom or index read with ReadRange
+func rangeKey(blockID uuid.UUID, tenantID string, name string, start uint64, length int) string {
+	return key(blockID, tenantID, name) + ":" + strconv.FormatUint(start, 10) + ":" + strconv.Itoa(length)
+}
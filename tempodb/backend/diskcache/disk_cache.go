@@ -15,9 +15,14 @@ import (
 )
 
 func (r *reader) readOrCacheKeyToDisk(ctx context.Context, blockID uuid.UUID, tenantID string, t string, miss missFunc) ([]byte, error, error) {
+	return r.readOrCacheToDisk(ctx, key(blockID, tenantID, t), t, func(ctx context.Context) ([]byte, error) {
+		return miss(ctx, blockID, tenantID)
+	})
+}
+
+func (r *reader) readOrCacheToDisk(ctx context.Context, k string, t string, miss func(ctx context.Context) ([]byte, error)) ([]byte, error, error) {
 	var skippableError error
 
-	k := key(blockID, tenantID, t)
 	filename := path.Join(r.cfg.Path, k)
 
 	bytes, err := ioutil.ReadFile(filename)
@@ -31,7 +36,7 @@ func (r *reader) readOrCacheKeyToDisk(ctx context.Context, blockID uuid.UUID, te
 	}
 
 	metricDiskCacheMiss.WithLabelValues(t).Inc()
-	bytes, err = miss(ctx, blockID, tenantID)
+	bytes, err = miss(ctx)
 	if err != nil {
 		return nil, nil, err // backend store error.  need to bubble this up
 	}
@@ -7,7 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,6 +53,54 @@ func TestReadOrCache(t *testing.T) {
 	assert.Equal(t, 1, missCalled)
 }
 
+// rangeReader serves ReadRange with the name of the object read
+type rangeReader struct {
+	backend.Reader
+	reads int
+}
+
+func (r *rangeReader) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	r.reads++
+	copy(buffer, name)
+	return nil
+}
+
+func TestReadRange(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	next := &rangeReader{}
+	cache, err := New(next, &Config{
+		Path:           tempDir,
+		MaxDiskMBs:     1024,
+		DiskPruneCount: 10,
+		DiskCleanRate:  time.Hour,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	blockID := uuid.New()
+	for i := 0; i < 2; i++ {
+		for _, name := range []string{backend.IndexName, backend.BloomName} {
+			buffer := make([]byte, 5)
+			assert.NoError(t, cache.ReadRange(ctx, name, blockID, testTenantID, 10, buffer))
+			assert.Equal(t, []byte(name), buffer)
+		}
+	}
+	assert.Equal(t, 2, next.reads)
+
+	// ranges of the data object are read through
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, cache.ReadRange(ctx, backend.ObjectName, blockID, testTenantID, 0, make([]byte, 4)))
+	}
+	assert.Equal(t, 4, next.reads)
+
+	fi, err := ioutil.ReadDir(tempDir)
+	assert.NoError(t, err)
+	assert.Len(t, fi, 2)
+}
+
 func TestJanitor(t *testing.T) {
 	tempDir, err := ioutil.TempDir("/tmp", "")
 	defer os.RemoveAll(tempDir)
@@ -5,14 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"sync"
 
 	"cloud.google.com/go/storage"
 	"github.com/google/uuid"
+	"github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/grafana/tempo/tempodb/encoding"
 	"google.golang.org/api/iterator"
 )
 
+// clearConcurrency is the number of blocks ClearBlocks clears at once
+const clearConcurrency = 16
+
 func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
 	// move meta file to a new location
 	metaFilename := rw.metaFileName(blockID, tenantID)
@@ -64,6 +69,35 @@ func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
 	return nil
 }
 
+// ClearBlocks clears blocks concurrently.  The gcs client has no batch delete so this is the closest we get to
+// one request for many blocks.
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs = util.MultiError{}
+		sem  = make(chan struct{}, clearConcurrency)
+	)
+	for _, blockID := range blockIDs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(blockID uuid.UUID) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			err := rw.ClearBlock(blockID, tenantID)
+			mtx.Lock()
+			errs.Add(err)
+			mtx.Unlock()
+		}(blockID)
+	}
+	wg.Wait()
+
+	return errs.Err()
+}
+
 func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
 	name := rw.compactedMetaFileName(blockID, tenantID)
 
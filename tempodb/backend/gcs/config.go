@@ -1,6 +1,16 @@
 package gcs
 
+import (
+	"github.com/grafana/tempo/tempodb/backend/hedge"
+	"github.com/grafana/tempo/tempodb/backend/transport"
+)
+
 type Config struct {
-	BucketName      string `yaml:"bucket_name"`
-	ChunkBufferSize int    `yaml:"chunk_buffer_size"`
+	BucketName string `yaml:"bucket_name"`
+	// ChunkBufferSize is the size of the chunks blocks are uploaded in.  Rounded up to a multiple of 256KiB.
+	ChunkBufferSize int `yaml:"chunk_buffer_size"`
+	// ChunkMaxRetries is the number of times a failed chunk is resent before the upload fails
+	ChunkMaxRetries int              `yaml:"chunk_max_retries"`
+	Hedging         hedge.Config     `yaml:"hedging"`
+	Transport       transport.Config `yaml:"transport"`
 }
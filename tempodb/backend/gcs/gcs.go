@@ -4,36 +4,52 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/hedge"
+	"github.com/grafana/tempo/tempodb/backend/transport"
 	"github.com/grafana/tempo/tempodb/encoding"
 	"github.com/opentracing/opentracing-go"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
 type readerWriter struct {
-	cfg    *Config
-	client *storage.Client
-	bucket *storage.BucketHandle
+	cfg        *Config
+	logger     log.Logger
+	client     *storage.Client
+	bucket     *storage.BucketHandle
+	hedger     *hedge.Hedger
+	httpClient *http.Client
+	uploadURL  string
 }
 
 func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
 	ctx := context.Background()
 
-	option, err := instrumentation(ctx, storage.ScopeReadWrite)
+	base, err := transport.New(cfg.Transport)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	client, err := storage.NewClient(ctx, option)
+	httpClient, err := instrumentation(ctx, storage.ScopeReadWrite, base)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -41,9 +57,13 @@ func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error)
 	bucket := client.Bucket(cfg.BucketName)
 
 	rw := &readerWriter{
-		cfg:    cfg,
-		client: client,
-		bucket: bucket,
+		cfg:        cfg,
+		logger:     log_util.Logger,
+		client:     client,
+		bucket:     bucket,
+		hedger:     hedge.New(cfg.Hedging, "gcs"),
+		httpClient: httpClient,
+		uploadURL:  uploadURL,
 	}
 
 	return rw, rw, rw, nil
@@ -64,9 +84,12 @@ func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBl
 	}
 	defer src.Close()
 
-	w := rw.writer(ctx, rw.objectFileName(blockID, tenantID))
-	defer w.Close()
-	_, err = io.Copy(w, src)
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = rw.resumableUpload(ctx, rw.objectFileName(blockID, tenantID), src, info.Size())
 	if err != nil {
 		return err
 	}
@@ -81,8 +104,12 @@ func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBl
 
 func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
 	if tracker != nil {
+		// the upload of appended chunks is only finalized on close
 		w := tracker.(*storage.Writer)
-		_ = w.Close()
+		err := w.Close()
+		if err != nil {
+			return err
+		}
 	}
 
 	blockID := meta.BlockID
@@ -118,7 +145,7 @@ func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.Append
 		blockID := meta.BlockID
 		tenantID := meta.TenantID
 
-		w = rw.writer(ctx, rw.objectFileName(blockID, tenantID))
+		w = rw.writer(ctx, rw.objectFileName(blockID, tenantID), int(rw.chunkSize()))
 	} else {
 		w = tracker.(*storage.Writer)
 	}
@@ -131,6 +158,15 @@ func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.Append
 	return w, nil
 }
 
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	return rw.writeAll(ctx, rw.tenantIndexFileName(tenantID), bIndex)
+}
+
 func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
 	var warning error
 	iter := rw.bucket.Objects(ctx, &storage.Query{
@@ -175,6 +211,11 @@ func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUI
 			continue
 		}
 
+		// objects at the root of the tenant, e.g. the tenant index, are not blocks
+		if attrs.Prefix == "" {
+			continue
+		}
+
 		idString := strings.TrimSuffix(strings.TrimPrefix(attrs.Prefix, tenantID+"/"), "/")
 		blockID, err := uuid.Parse(idString)
 		if err != nil {
@@ -232,6 +273,26 @@ func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID
 	return rw.readRange(derivedCtx, name, int64(start), buffer)
 }
 
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	span, derivedCtx := opentracing.StartSpanFromContext(ctx, "gcs.ReadRange")
+	defer span.Finish()
+	span.SetTag("name", name)
+
+	return rw.readRange(derivedCtx, path.Join(rw.rootPath(blockID, tenantID), name), int64(start), buffer)
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	bytes, err := rw.readAll(ctx, rw.tenantIndexFileName(tenantID))
+	if err == storage.ErrObjectNotExist {
+		return nil, backend.ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UnmarshalTenantIndex(bytes)
+}
+
 func (rw *readerWriter) Shutdown() {
 
 }
@@ -252,37 +313,51 @@ func (rw *readerWriter) objectFileName(blockID uuid.UUID, tenantID string) strin
 	return path.Join(rw.rootPath(blockID, tenantID), "data")
 }
 
+func (rw *readerWriter) tenantIndexFileName(tenantID string) string {
+	return path.Join(tenantID, backend.TenantIndexName)
+}
+
 func (rw *readerWriter) rootPath(blockID uuid.UUID, tenantID string) string {
 	return path.Join(tenantID, blockID.String())
 }
 
 func (rw *readerWriter) writeAll(ctx context.Context, name string, b []byte) error {
-	w := rw.writer(ctx, name)
-	defer w.Close()
+	// blooms, indexes and metas are small enough to send in a single request.  gcs rejects it if it doesn't
+	// match the crc32c
+	w := rw.writer(ctx, name, 0)
+	w.CRC32C = crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli))
+	w.SendCRC32C = true
 
 	_, err := w.Write(b)
 	if err != nil {
+		_ = w.Close()
 		return err
 	}
 
-	return nil
+	return w.Close()
 }
 
-func (rw *readerWriter) writer(ctx context.Context, name string) *storage.Writer {
+// writer returns a writer that uploads in chunks of chunkSize with the resumable upload protocol.  each chunk is
+// retried by the client library.  0 uploads in a single request
+func (rw *readerWriter) writer(ctx context.Context, name string, chunkSize int) *storage.Writer {
 	w := rw.bucket.Object(name).NewWriter(ctx)
-	w.ChunkSize = rw.cfg.ChunkBufferSize
+	w.ChunkSize = chunkSize
 
 	return w
 }
 
+// readAll reads the object in full.  slow reads are hedged separately for each kind of object, e.g. bloom
+// or index
 func (rw *readerWriter) readAll(ctx context.Context, name string) ([]byte, error) {
-	r, err := rw.bucket.Object(name).NewReader(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Close()
+	return rw.hedger.Do(ctx, path.Base(name), func(ctx context.Context) ([]byte, error) {
+		r, err := rw.bucket.Object(name).NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
 
-	return ioutil.ReadAll(r)
+		return ioutil.ReadAll(r)
+	})
 }
 
 func (rw *readerWriter) readAllWithModTime(ctx context.Context, name string) ([]byte, time.Time, error) {
@@ -301,6 +376,23 @@ func (rw *readerWriter) readAllWithModTime(ctx context.Context, name string) ([]
 }
 
 func (rw *readerWriter) readRange(ctx context.Context, name string, offset int64, buffer []byte) error {
+	if rw.hedger == nil {
+		return rw.readRangeInto(ctx, name, offset, buffer)
+	}
+
+	// hedged reads can't share the caller's buffer.  the losing read may still be writing to its buffer
+	b, err := rw.hedger.Do(ctx, path.Base(name), func(ctx context.Context) ([]byte, error) {
+		b := make([]byte, len(buffer))
+		return b, rw.readRangeInto(ctx, name, offset, b)
+	})
+	if err != nil {
+		return err
+	}
+	copy(buffer, b)
+	return nil
+}
+
+func (rw *readerWriter) readRangeInto(ctx context.Context, name string, offset int64, buffer []byte) error {
 	r, err := rw.bucket.Object(name).NewRangeReader(ctx, offset, int64(len(buffer)))
 	if err != nil {
 		return err
@@ -29,8 +29,8 @@ type instrumentedTransport struct {
 	next     http.RoundTripper
 }
 
-func instrumentation(ctx context.Context, scope string) (option.ClientOption, error) {
-	transport, err := google_http.NewTransport(ctx, http.DefaultTransport, option.WithScopes(scope))
+func instrumentation(ctx context.Context, scope string, base http.RoundTripper) (*http.Client, error) {
+	transport, err := google_http.NewTransport(ctx, base, option.WithScopes(scope))
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +40,7 @@ func instrumentation(ctx context.Context, scope string) (option.ClientOption, er
 			next:     transport,
 		},
 	}
-	return option.WithHTTPClient(client), nil
+	return client, nil
 }
 
 func (i instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
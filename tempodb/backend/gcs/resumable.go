@@ -0,0 +1,268 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cortex_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/tempo/tempodb/backend/retry"
+	"github.com/pkg/errors"
+)
+
+const (
+	uploadURL = "https://storage.googleapis.com/upload/storage/v1"
+
+	// gcs requires every chunk but the last to be a multiple of this
+	chunkAlignment         = 256 * 1024
+	defaultChunkBufferSize = 16 * 1024 * 1024
+	defaultChunkMaxRetries = 5
+	chunkRetryMinBackoff   = 100 * time.Millisecond
+	chunkRetryMaxBackoff   = 10 * time.Second
+	statusResumeIncomplete = 308
+)
+
+// statusError is an unexpected response from the upload api
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected gcs upload response %d: %s", e.code, e.body)
+}
+
+// resumableUpload writes size bytes from r to name with the resumable upload protocol.  the object is sent in
+// chunks and a chunk that fails is retried from the last byte gcs acknowledged, so a flaky connection only
+// costs the chunk in flight instead of restarting the whole block.
+// https://cloud.google.com/storage/docs/performing-resumable-uploads
+func (rw *readerWriter) resumableUpload(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	h := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	_, err := io.Copy(h, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+
+	session, err := rw.startUpload(ctx, name, size, h.Sum32())
+	if err != nil {
+		return errors.Wrapf(err, "error starting resumable upload, object: %s", name)
+	}
+
+	chunkSize := rw.chunkSize()
+	offset := int64(0)
+	for {
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		next, done, err := rw.putChunkWithRetries(ctx, session, r, offset, offset+length, size)
+		if err != nil {
+			return errors.Wrapf(err, "error uploading chunk at offset %d, object: %s", offset, name)
+		}
+		if done {
+			return nil
+		}
+		if next >= size {
+			return fmt.Errorf("resumable upload of %s not finalized after %d bytes", name, size)
+		}
+		offset = next
+	}
+}
+
+// startUpload creates an upload session and returns its uri.  gcs refuses to finalize the upload if the object it
+// received doesn't match the crc32c
+func (rw *readerWriter) startUpload(ctx context.Context, name string, size int64, crc uint32) (string, error) {
+	bCRC := make([]byte, 4)
+	binary.BigEndian.PutUint32(bCRC, crc)
+	body, err := json.Marshal(map[string]string{
+		"crc32c": base64.StdEncoding.EncodeToString(bCRC),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("%s/b/%s/o?uploadType=resumable&name=%s", rw.uploadURL, url.PathEscape(rw.cfg.BucketName), url.QueryEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+
+	resp, err := rw.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", newStatusError(resp)
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return "", errors.New("gcs did not return an upload session")
+	}
+	return session, nil
+}
+
+// putChunkWithRetries sends bytes [offset, end) of the object.  on a retryable failure it asks gcs how much it has
+// persisted and resends only the remainder.  it returns the offset of the next chunk and whether the upload is
+// complete
+func (rw *readerWriter) putChunkWithRetries(ctx context.Context, session string, r io.ReaderAt, offset int64, end int64, size int64) (int64, bool, error) {
+	next, done, err := rw.putChunk(ctx, session, r, offset, end, size)
+
+	maxRetries := rw.chunkMaxRetries()
+	backoff := cortex_util.NewBackoff(ctx, cortex_util.BackoffConfig{
+		MinBackoff: chunkRetryMinBackoff,
+		MaxBackoff: chunkRetryMaxBackoff,
+		MaxRetries: maxRetries,
+	})
+	for retries := 0; err != nil && retries < maxRetries && isRetryableUploadErr(err); retries++ {
+		level.Warn(rw.logger).Log("msg", "retrying gcs upload chunk", "offset", offset, "retries", retries, "err", err)
+
+		select {
+		case <-time.After(backoff.NextDelay()):
+		case <-ctx.Done():
+			return offset, false, ctx.Err()
+		}
+
+		// gcs may have persisted some or all of the failed chunk.  resume from what it has
+		var persisted int64
+		persisted, done, err = rw.queryUpload(ctx, session, size)
+		if err != nil {
+			continue
+		}
+		if done {
+			return size, true, nil
+		}
+		if persisted < offset {
+			return offset, false, fmt.Errorf("gcs persisted %d bytes, before the chunk at %d", persisted, offset)
+		}
+		if persisted >= end {
+			return persisted, false, nil
+		}
+		next, done, err = rw.putChunk(ctx, session, r, persisted, end, size)
+	}
+
+	return next, done, err
+}
+
+// putChunk sends bytes [offset, end) of the object.  it returns the number of bytes gcs has persisted and
+// whether the upload is complete
+func (rw *readerWriter) putChunk(ctx context.Context, session string, r io.ReaderAt, offset int64, end int64, size int64) (int64, bool, error) {
+	var contentRange string
+	if end == offset {
+		contentRange = fmt.Sprintf("bytes */%d", size)
+	} else {
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, end-1, size)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, io.NewSectionReader(r, offset, end-offset))
+	if err != nil {
+		return offset, false, err
+	}
+	req.ContentLength = end - offset
+	req.Header.Set("Content-Range", contentRange)
+
+	return rw.doUploadRequest(req, offset)
+}
+
+// queryUpload asks gcs how many bytes of the upload it has persisted
+func (rw *readerWriter) queryUpload(ctx context.Context, session string, size int64) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+
+	return rw.doUploadRequest(req, 0)
+}
+
+func (rw *readerWriter) doUploadRequest(req *http.Request, offset int64) (int64, bool, error) {
+	resp, err := rw.httpClient.Do(req)
+	if err != nil {
+		return offset, false, err
+	}
+	defer drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return offset, true, nil
+	case statusResumeIncomplete:
+		persisted, err := persistedBytes(resp.Header.Get("Range"))
+		return persisted, false, err
+	default:
+		return offset, false, newStatusError(resp)
+	}
+}
+
+// persistedBytes parses the range header of a 308 response, e.g. "bytes=0-1023".  no range header means nothing
+// has been persisted yet
+func persistedBytes(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+
+	i := strings.LastIndex(header, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("malformed range header %q", header)
+	}
+	last, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "malformed range header %q", header)
+	}
+	return last + 1, nil
+}
+
+func isRetryableUploadErr(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return retry.IsRetryableStatus(statusErr.code)
+	}
+	return retry.IsTransient(err)
+}
+
+func newStatusError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &statusError{
+		code: resp.StatusCode,
+		body: string(body),
+	}
+}
+
+func drain(resp *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// chunkSize is the configured chunk buffer size rounded up to the alignment gcs requires
+func (rw *readerWriter) chunkSize() int64 {
+	size := int64(rw.cfg.ChunkBufferSize)
+	if size <= 0 {
+		return defaultChunkBufferSize
+	}
+	if rem := size % chunkAlignment; rem != 0 {
+		size += chunkAlignment - rem
+	}
+	return size
+}
+
+func (rw *readerWriter) chunkMaxRetries() int {
+	if rw.cfg.ChunkMaxRetries <= 0 {
+		return defaultChunkMaxRetries
+	}
+	return rw.cfg.ChunkMaxRetries
+}
@@ -0,0 +1,173 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumableUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		failures   map[int64]int // chunk offset => bytes persisted before failing
+		status     int
+		ranges     []string
+		expectsErr bool
+	}{
+		{
+			name:   "empty",
+			size:   0,
+			ranges: []string{"bytes */0"},
+		},
+		{
+			name:   "single chunk",
+			size:   1000,
+			ranges: []string{"bytes 0-999/1000"},
+		},
+		{
+			name:   "chunks",
+			size:   2*chunkAlignment + 10,
+			ranges: []string{"bytes 0-262143/524298", "bytes 262144-524287/524298", "bytes 524288-524297/524298"},
+		},
+		{
+			name:     "failed chunk resumes from persisted bytes",
+			size:     2*chunkAlignment + 10,
+			failures: map[int64]int{chunkAlignment: 100},
+			status:   http.StatusServiceUnavailable,
+			ranges:   []string{"bytes 0-262143/524298", "bytes 262144-524287/524298", "bytes */524298", "bytes 262244-524287/524298", "bytes 524288-524297/524298"},
+		},
+		{
+			name:       "permanent failure",
+			size:       1000,
+			failures:   map[int64]int{0: 0},
+			status:     http.StatusForbidden,
+			ranges:     []string{"bytes 0-999/1000"},
+			expectsErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gcs := newFakeUploadServer(t, tt.failures, tt.status)
+			defer gcs.Close()
+
+			rw := &readerWriter{
+				cfg:        &Config{BucketName: "bucket", ChunkBufferSize: chunkAlignment, ChunkMaxRetries: 1},
+				logger:     log_util.Logger,
+				httpClient: gcs.Client(),
+				uploadURL:  gcs.URL,
+			}
+
+			object := make([]byte, tt.size)
+			rand.Read(object)
+
+			err := rw.resumableUpload(context.Background(), "tenant/block/data", bytes.NewReader(object), int64(tt.size))
+			if tt.expectsErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, object, gcs.object)
+
+				crc := make([]byte, 4)
+				binary.BigEndian.PutUint32(crc, crc32.Checksum(object, crc32.MakeTable(crc32.Castagnoli)))
+				assert.Equal(t, base64.StdEncoding.EncodeToString(crc), gcs.crc32c)
+			}
+			assert.Equal(t, tt.ranges, gcs.ranges)
+		})
+	}
+}
+
+func TestChunkSize(t *testing.T) {
+	rw := &readerWriter{cfg: &Config{}}
+	assert.Equal(t, int64(defaultChunkBufferSize), rw.chunkSize())
+
+	rw.cfg.ChunkBufferSize = 1
+	assert.Equal(t, int64(chunkAlignment), rw.chunkSize())
+
+	rw.cfg.ChunkBufferSize = 2 * chunkAlignment
+	assert.Equal(t, int64(2*chunkAlignment), rw.chunkSize())
+}
+
+var contentRange = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+type fakeUploadServer struct {
+	*httptest.Server
+
+	mtx    sync.Mutex
+	object []byte
+	ranges []string
+	crc32c string
+}
+
+// newFakeUploadServer implements enough of the gcs resumable upload api to upload one object.  failures maps the
+// offset of a chunk to the number of its bytes persisted before the chunk fails with status
+func newFakeUploadServer(t *testing.T, failures map[int64]int, status int) *fakeUploadServer {
+	f := &fakeUploadServer{object: []byte{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+
+		if r.Method == http.MethodPost {
+			assert.Equal(t, "/b/bucket/o", r.URL.Path)
+			assert.Equal(t, "resumable", r.URL.Query().Get("uploadType"))
+			assert.Equal(t, "tenant/block/data", r.URL.Query().Get("name"))
+
+			metadata := map[string]string{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&metadata))
+			f.crc32c = metadata["crc32c"]
+			w.Header().Set("Location", f.URL+"/session")
+			return
+		}
+
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "/session", r.URL.Path)
+		f.ranges = append(f.ranges, r.Header.Get("Content-Range"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		total := -1
+		if m := contentRange.FindStringSubmatch(r.Header.Get("Content-Range")); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			total, _ = strconv.Atoi(m[3])
+			require.Equal(t, len(f.object), start)
+
+			if persisted, ok := failures[int64(start)]; ok {
+				delete(failures, int64(start))
+				f.object = append(f.object, body[:persisted]...)
+				w.WriteHeader(status)
+				return
+			}
+			f.object = append(f.object, body...)
+		} else if r.Header.Get("Content-Range") == "bytes */0" {
+			total = 0
+		}
+
+		if len(f.object) == total {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if len(f.object) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(f.object)-1))
+		}
+		w.WriteHeader(statusResumeIncomplete)
+	}))
+	return f
+}
@@ -0,0 +1,18 @@
+package gcs
+
+import (
+	"errors"
+
+	"github.com/grafana/tempo/tempodb/backend/retry"
+	"google.golang.org/api/googleapi"
+)
+
+// IsRetryable is true for the errors gcs recommends retrying: 429s, 5xxs and transient network errors
+func IsRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return retry.IsRetryableStatus(apiErr.Code)
+	}
+
+	return retry.IsTransient(err)
+}
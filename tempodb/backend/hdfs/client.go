@@ -0,0 +1,271 @@
+package hdfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/tempo/tempodb/backend/transport"
+)
+
+const (
+	fileTypeDirectory = "DIRECTORY"
+
+	exceptionFileNotFound = "FileNotFoundException"
+)
+
+// remoteException is the error document webhdfs returns for failed requests
+type remoteException struct {
+	StatusCode int    `json:"-"`
+	Exception  string `json:"exception"`
+	ClassName  string `json:"javaClassName"`
+	Message    string `json:"message"`
+}
+
+func (e *remoteException) Error() string {
+	return fmt.Sprintf("webhdfs error %d %s: %s", e.StatusCode, e.Exception, e.Message)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*remoteException)
+	return ok && (e.Exception == exceptionFileNotFound || e.StatusCode == http.StatusNotFound)
+}
+
+type fileStatus struct {
+	PathSuffix       string `json:"pathSuffix"`
+	Type             string `json:"type"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+}
+
+func (s fileStatus) modTime() time.Time {
+	return time.Unix(0, s.ModificationTime*int64(time.Millisecond))
+}
+
+// client is a minimal webhdfs client.  it implements the handful of operations the backend needs.
+type client struct {
+	endpoint *url.URL
+	root     string
+	cfg      *Config
+	http     *http.Client
+}
+
+func newClient(cfg *Config) (*client, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := transport.New(cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		endpoint: u,
+		root:     path.Join("/", cfg.Path),
+		cfg:      cfg,
+		http: &http.Client{
+			Transport: tr,
+			// redirects to datanodes are followed by hand so the body of a create is sent to the datanode
+			// only
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// do sends an operation on name, which is relative to the root path.  a 307 redirect to a datanode is
+// followed with body.
+func (c *client) do(ctx context.Context, method string, name string, op string, params url.Values, body io.Reader, length int64) (*http.Response, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	err := c.authenticate(params)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *c.endpoint
+	u.Path = path.Join("/webhdfs/v1", c.root, name)
+	u.RawQuery = params.Encode()
+
+	// the first request of a create carries no data.  the namenode answers with the datanode to send it to
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTemporaryRedirect:
+		resp.Body.Close()
+
+		req, err = http.NewRequestWithContext(ctx, method, resp.Header.Get("Location"), body)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.ContentLength = length
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+
+		resp, err = c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+	case body != nil && resp.StatusCode/100 == 2:
+		// the data was never sent
+		resp.Body.Close()
+		return nil, fmt.Errorf("webhdfs %s of %s did not redirect to a datanode", op, name)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+
+		res := &struct {
+			RemoteException *remoteException `json:"RemoteException"`
+		}{
+			RemoteException: &remoteException{},
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		_ = json.Unmarshal(b, res)
+		res.RemoteException.StatusCode = resp.StatusCode
+		return nil, res.RemoteException
+	}
+
+	return resp, nil
+}
+
+func (c *client) authenticate(params url.Values) error {
+	token := c.cfg.DelegationToken
+	if c.cfg.DelegationTokenFile != "" {
+		b, err := ioutil.ReadFile(c.cfg.DelegationTokenFile)
+		if err != nil {
+			return fmt.Errorf("error reading delegation token: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	if token != "" {
+		params.Set("delegation", token)
+	} else if c.cfg.Username != "" {
+		params.Set("user.name", c.cfg.Username)
+	}
+	return nil
+}
+
+// create writes name in full, replacing it if it exists.  parent directories are created as needed.
+func (c *client) create(ctx context.Context, name string, body io.Reader, length int64) error {
+	resp, err := c.do(ctx, http.MethodPut, name, "CREATE", url.Values{"overwrite": []string{"true"}}, body, length)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// open reads name.  length 0 reads to the end.
+func (c *client) open(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error) {
+	params := url.Values{}
+	if offset > 0 {
+		params.Set("offset", strconv.FormatInt(offset, 10))
+	}
+	if length > 0 {
+		params.Set("length", strconv.FormatInt(length, 10))
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, name, "OPEN", params, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *client) status(ctx context.Context, name string) (fileStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, name, "GETFILESTATUS", nil, nil, 0)
+	if err != nil {
+		return fileStatus{}, err
+	}
+
+	res := &struct {
+		FileStatus fileStatus `json:"FileStatus"`
+	}{}
+	err = decodeJSON(resp, res)
+	return res.FileStatus, err
+}
+
+func (c *client) list(ctx context.Context, name string) ([]fileStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, name, "LISTSTATUS", nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &struct {
+		FileStatuses struct {
+			FileStatus []fileStatus `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}{}
+	err = decodeJSON(resp, res)
+	return res.FileStatuses.FileStatus, err
+}
+
+func (c *client) rename(ctx context.Context, src string, dst string) error {
+	resp, err := c.do(ctx, http.MethodPut, src, "RENAME", url.Values{"destination": []string{path.Join(c.root, dst)}}, nil, 0)
+	if err != nil {
+		return err
+	}
+	return checkBoolean(resp, "rename "+src)
+}
+
+// setModTime sets the modification time of name.  renames do not change it.
+func (c *client) setModTime(ctx context.Context, name string, t time.Time) error {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	resp, err := c.do(ctx, http.MethodPut, name, "SETTIMES", url.Values{"modificationtime": []string{strconv.FormatInt(ms, 10)}}, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) delete(ctx context.Context, name string, recursive bool) error {
+	resp, err := c.do(ctx, http.MethodDelete, name, "DELETE", url.Values{"recursive": []string{strconv.FormatBool(recursive)}}, nil, 0)
+	if err != nil {
+		return err
+	}
+	// deleting a path that does not exist returns false.  that's fine
+	return resp.Body.Close()
+}
+
+// checkBoolean checks the {"boolean": true} result of operations like RENAME that report failure
+// without an error status
+func checkBoolean(resp *http.Response, op string) error {
+	res := &struct {
+		Boolean bool `json:"boolean"`
+	}{}
+	err := decodeJSON(resp, res)
+	if err != nil {
+		return err
+	}
+	if !res.Boolean {
+		return fmt.Errorf("webhdfs %s failed", op)
+	}
+	return nil
+}
+
+func decodeJSON(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
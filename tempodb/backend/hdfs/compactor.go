@@ -0,0 +1,100 @@
+package hdfs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	ctx := context.TODO()
+
+	// hdfs renames are atomic.  move meta.json to meta.compacted.json
+	compactedMetaFileName := util.CompactedMetaFileName(blockID, tenantID)
+	err := rw.client.rename(ctx, util.MetaFileName(blockID, tenantID), compactedMetaFileName)
+	if err != nil {
+		return errors.Wrap(err, "error renaming meta to compacted meta")
+	}
+
+	// the compacted time is the modification time of the compacted meta.  a rename keeps the time the block
+	// was written
+	err = rw.client.setModTime(ctx, compactedMetaFileName, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "error setting compacted time")
+	}
+	return nil
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	dir := util.BlockFileName(blockID, tenantID)
+	level.Debug(rw.logger).Log("msg", "deleting block", "block path", dir)
+
+	err := rw.client.delete(context.TODO(), dir, true)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting block from hdfs: %s", dir)
+	}
+	return nil
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return backend.ClearBlocks(rw, blockIDs, tenantID)
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	if len(tenantID) == 0 {
+		return nil, backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return nil, backend.ErrEmptyBlockID
+	}
+
+	ctx := context.TODO()
+	compactedMetaFileName := util.CompactedMetaFileName(blockID, tenantID)
+
+	status, err := rw.client.status(ctx, compactedMetaFileName)
+	if isNotFound(err) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching compacted meta file status %s", compactedMetaFileName)
+	}
+
+	bytes, err := rw.readAll(ctx, compactedMetaFileName)
+	if isNotFound(err) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching compacted meta file %s", compactedMetaFileName)
+	}
+
+	out := &encoding.CompactedBlockMeta{}
+	err = json.Unmarshal(bytes, out)
+	if err != nil {
+		return nil, err
+	}
+	out.CompactedTime = status.modTime()
+
+	return out, nil
+}
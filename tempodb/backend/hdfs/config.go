@@ -0,0 +1,25 @@
+package hdfs
+
+import "github.com/grafana/tempo/tempodb/backend/transport"
+
+type Config struct {
+	// Endpoint is the webhdfs address of the namenode, e.g. http://namenode:9870, or of an httpfs gateway
+	Endpoint string `yaml:"endpoint"`
+	// Path is the directory blocks are stored under
+	Path string `yaml:"path"`
+
+	// Username is sent with every request on clusters that use simple authentication
+	Username string `yaml:"username"`
+	// DelegationToken authenticates with clusters secured with kerberos.  It is obtained out of band,
+	// e.g. with `hdfs fetchdt` after kinit.
+	DelegationToken string `yaml:"delegation_token"`
+	// DelegationTokenFile is read before every request so a sidecar can renew the token.  It takes
+	// precedence over DelegationToken.
+	DelegationTokenFile string `yaml:"delegation_token_file"`
+
+	// SpoolPath is the local directory compacted blocks are staged in before they are uploaded.  Blocks
+	// are never appended to on hdfs.  Defaults to the os temp directory.
+	SpoolPath string `yaml:"spool_path"`
+
+	Transport transport.Config `yaml:"transport"`
+}
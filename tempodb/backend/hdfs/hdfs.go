@@ -0,0 +1,285 @@
+package hdfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+// readerWriter can read/write from hdfs over webhdfs
+type readerWriter struct {
+	logger log.Logger
+	cfg    *Config
+	client *client
+}
+
+func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error creating webhdfs client")
+	}
+
+	if cfg.SpoolPath != "" {
+		err = os.MkdirAll(cfg.SpoolPath, os.ModePerm)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	rw := &readerWriter{
+		logger: log_util.Logger,
+		cfg:    cfg,
+		client: c,
+	}
+
+	return rw, rw, rw, nil
+}
+
+// Write implements backend.Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	err := rw.createFromFile(ctx, util.ObjectFileName(meta.BlockID, meta.TenantID), objectFilePath)
+	if err != nil {
+		return err
+	}
+
+	return rw.WriteBlockMeta(ctx, nil, meta, bBloom, bIndex)
+}
+
+// WriteBlockMeta implements backend.Writer
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	blockID := meta.BlockID
+	tenantID := meta.TenantID
+
+	if tracker != nil {
+		// the object was staged locally by AppendObject.  it is uploaded with a single create
+		spool := tracker.(*os.File)
+		_ = spool.Close()
+		defer os.Remove(spool.Name())
+
+		err := rw.createFromFile(ctx, util.ObjectFileName(blockID, tenantID), spool.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	err := rw.client.create(ctx, util.BloomFileName(blockID, tenantID), bytes.NewReader(bBloom), int64(len(bBloom)))
+	if err != nil {
+		return err
+	}
+
+	err = rw.client.create(ctx, util.IndexFileName(blockID, tenantID), bytes.NewReader(bIndex), int64(len(bIndex)))
+	if err != nil {
+		return err
+	}
+
+	bMeta, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// write meta last.  this will prevent blocklist from returning a partial block
+	return rw.client.create(ctx, util.MetaFileName(blockID, tenantID), bytes.NewReader(bMeta), int64(len(bMeta)))
+}
+
+// AppendObject implements backend.Writer.  many clusters disable appends so the object is staged in a local
+// spool file and uploaded in WriteBlockMeta.
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	var spool *os.File
+	if tracker == nil {
+		var err error
+		spool, err = ioutil.TempFile(rw.cfg.SpoolPath, "tempo-hdfs-"+meta.BlockID.String()+"-")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		spool = tracker.(*os.File)
+	}
+
+	_, err := spool.Write(bObject)
+	if err != nil {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+// WriteTenantIndex implements backend.Writer
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = rw.client.create(ctx, util.TenantIndexFileName(tenantID), bytes.NewReader(bIndex), int64(len(bIndex)))
+	if err != nil {
+		return errors.Wrapf(err, "error writing tenant index to hdfs, tenantID: %s", tenantID)
+	}
+
+	return nil
+}
+
+// Tenants implements backend.Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	dirs, err := rw.listDirs(ctx, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing tenants in %s", rw.cfg.Path)
+	}
+
+	return dirs, nil
+}
+
+// Blocks implements backend.Reader
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	dirs, err := rw.listDirs(ctx, tenantID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing blocks in hdfs, tenantID: %s", tenantID)
+	}
+
+	blockIDs := make([]uuid.UUID, 0, len(dirs))
+	for _, d := range dirs {
+		blockID, err := uuid.Parse(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing uuid of dir, dir: %s", d)
+		}
+		blockIDs = append(blockIDs, blockID)
+	}
+	return blockIDs, nil
+}
+
+// BlockMeta implements backend.Reader
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	body, err := rw.readAll(ctx, util.MetaFileName(blockID, tenantID))
+	if isNotFound(err) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := &encoding.BlockMeta{}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Bloom implements backend.Reader
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.readAll(ctx, util.BloomFileName(blockID, tenantID))
+}
+
+// Index implements backend.Reader
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.readAll(ctx, util.IndexFileName(blockID, tenantID))
+}
+
+// Object implements backend.Reader
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.ReadRange(ctx, backend.ObjectName, blockID, tenantID, start, buffer)
+}
+
+// ReadRange implements backend.Reader
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	name = util.FileName(blockID, tenantID, name)
+
+	body, err := rw.client.open(ctx, name, int64(start), int64(len(buffer)))
+	if err != nil {
+		return errors.Wrapf(err, "error in range read from hdfs, path: %s", name)
+	}
+	defer body.Close()
+
+	_, err = io.ReadFull(body, buffer)
+	if err == io.ErrUnexpectedEOF {
+		// the last read of a block may run past the end of the object
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error in range read from hdfs")
+	}
+	return nil
+}
+
+// TenantIndex implements backend.Reader
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	body, err := rw.readAll(ctx, util.TenantIndexFileName(tenantID))
+	if isNotFound(err) {
+		return nil, backend.ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UnmarshalTenantIndex(body)
+}
+
+// Shutdown implements backend.Reader
+func (rw *readerWriter) Shutdown() {
+}
+
+// listDirs returns the names of the directories in dir.  a directory that does not exist is empty.
+func (rw *readerWriter) listDirs(ctx context.Context, dir string) ([]string, error) {
+	statuses, err := rw.client.list(ctx, dir)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		if s.Type != fileTypeDirectory {
+			continue
+		}
+		dirs = append(dirs, s.PathSuffix)
+	}
+	return dirs, nil
+}
+
+func (rw *readerWriter) readAll(ctx context.Context, name string) ([]byte, error) {
+	body, err := rw.client.open(ctx, name, 0, 0)
+	if err != nil {
+		// do not wrap this error.  callers check it with isNotFound
+		return nil, err
+	}
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
+
+func (rw *readerWriter) createFromFile(ctx context.Context, name string, filePath string) error {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = rw.client.create(ctx, name, src, info.Size())
+	if err != nil {
+		return errors.Wrapf(err, "error writing object to hdfs, path %s", name)
+	}
+
+	level.Debug(rw.logger).Log("msg", "object uploaded to hdfs", "path", name, "size", info.Size())
+	return nil
+}
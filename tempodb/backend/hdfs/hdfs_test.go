@@ -0,0 +1,323 @@
+package hdfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func TestReadWrite(t *testing.T) {
+	server := newFakeWebHDFS()
+	defer server.Close()
+
+	spool, err := ioutil.TempDir("", "hdfs-spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(spool)
+
+	rw := newTestReaderWriter(t, server, &Config{Path: "tempo", Username: "tempo", SpoolPath: spool})
+	ctx := context.Background()
+
+	blockID := uuid.New()
+	tenantID := "fake"
+	meta := &encoding.BlockMeta{
+		BlockID:  blockID,
+		TenantID: tenantID,
+	}
+
+	tracker, err := rw.AppendObject(ctx, nil, meta, []byte("0123456789"))
+	require.NoError(t, err)
+	tracker, err = rw.AppendObject(ctx, tracker, meta, []byte("abcdefghij"))
+	require.NoError(t, err)
+	err = rw.WriteBlockMeta(ctx, tracker, meta, []byte("bloom"), []byte("index"))
+	require.NoError(t, err)
+
+	// the spool file is removed once uploaded
+	spooled, err := ioutil.ReadDir(spool)
+	require.NoError(t, err)
+	assert.Len(t, spooled, 0)
+
+	// the fake server rejects appends.  blocks are only ever created
+	assert.Equal(t, 0, server.appends)
+
+	actualMeta, err := rw.BlockMeta(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, meta, actualMeta)
+
+	index, err := rw.Index(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("index"), index)
+
+	buffer := make([]byte, 5)
+	err = rw.Object(ctx, blockID, tenantID, 8, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("89abc"), buffer)
+
+	// the tenant index is a file alongside the blocks, not a block
+	err = rw.WriteTenantIndex(ctx, tenantID, []*encoding.BlockMeta{meta}, nil)
+	require.NoError(t, err)
+
+	tenants, err := rw.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tenantID}, tenants)
+
+	blocks, err := rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{blockID}, blocks)
+
+	_, err = rw.BlockMeta(ctx, uuid.New(), tenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	blocks, err = rw.Blocks(ctx, "does-not-exist")
+	require.NoError(t, err)
+	assert.Len(t, blocks, 0)
+
+	// compaction
+	written := time.Now().Add(-time.Hour)
+	server.setModTime("/tempo/"+tenantID+"/"+blockID.String()+"/meta.json", written)
+
+	err = rw.MarkBlockCompacted(blockID, tenantID)
+	require.NoError(t, err)
+	_, err = rw.BlockMeta(ctx, blockID, tenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	compactedMeta, err := rw.CompactedBlockMeta(blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, *meta, compactedMeta.BlockMeta)
+	assert.True(t, compactedMeta.CompactedTime.After(written))
+
+	err = rw.ClearBlock(blockID, tenantID)
+	require.NoError(t, err)
+	blocks, err = rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 0)
+}
+
+func TestWrite(t *testing.T) {
+	server := newFakeWebHDFS()
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, &Config{Path: "/tempo", Username: "tempo"})
+	ctx := context.Background()
+
+	objectFile, err := ioutil.TempFile("", "hdfs-object")
+	require.NoError(t, err)
+	defer os.Remove(objectFile.Name())
+	_, err = objectFile.Write([]byte("object"))
+	require.NoError(t, err)
+	require.NoError(t, objectFile.Close())
+
+	meta := &encoding.BlockMeta{
+		BlockID:  uuid.New(),
+		TenantID: "fake",
+	}
+	err = rw.Write(ctx, meta, []byte("bloom"), []byte("index"), objectFile.Name())
+	require.NoError(t, err)
+
+	buffer := make([]byte, 10)
+	err = rw.Object(ctx, meta.BlockID, meta.TenantID, 0, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("object"), buffer[:6])
+}
+
+func TestAuthentication(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "hdfs-token")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+
+	c, err := newClient(&Config{Username: "tempo"})
+	require.NoError(t, err)
+	params := make(map[string][]string)
+	require.NoError(t, c.authenticate(params))
+	assert.Equal(t, []string{"tempo"}, params["user.name"])
+
+	// a delegation token replaces the user name
+	c, err = newClient(&Config{Username: "tempo", DelegationToken: "token"})
+	require.NoError(t, err)
+	params = make(map[string][]string)
+	require.NoError(t, c.authenticate(params))
+	assert.Equal(t, []string{"token"}, params["delegation"])
+	assert.Nil(t, params["user.name"])
+
+	// the token file is reread so renewed tokens are picked up
+	c, err = newClient(&Config{DelegationToken: "token", DelegationTokenFile: tokenFile.Name()})
+	require.NoError(t, err)
+	for _, token := range []string{"first", "second"} {
+		require.NoError(t, ioutil.WriteFile(tokenFile.Name(), []byte(token+"\n"), 0644))
+		params = make(map[string][]string)
+		require.NoError(t, c.authenticate(params))
+		assert.Equal(t, []string{token}, params["delegation"])
+	}
+}
+
+func newTestReaderWriter(t *testing.T, server *fakeWebHDFS, cfg *Config) *readerWriter {
+	cfg.Endpoint = server.URL
+	c, err := newClient(cfg)
+	require.NoError(t, err)
+
+	return &readerWriter{
+		logger: log.NewNopLogger(),
+		cfg:    cfg,
+		client: c,
+	}
+}
+
+// fakeWebHDFS is an in memory webhdfs.  creates and opens are redirected to a fake datanode the way a
+// namenode does.
+type fakeWebHDFS struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	files    map[string][]byte
+	modTimes map[string]time.Time
+	appends  int
+}
+
+func newFakeWebHDFS() *fakeWebHDFS {
+	f := &fakeWebHDFS{
+		files:    map[string][]byte{},
+		modTimes: map[string]time.Time{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeWebHDFS) setModTime(name string, t time.Time) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.modTimes[name] = t
+}
+
+func (f *fakeWebHDFS) handle(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/webhdfs/v1")
+	query := r.URL.Query()
+	if query.Get("user.name") == "" && query.Get("delegation") == "" && !strings.HasPrefix(r.URL.Path, "/datanode") {
+		writeRemoteException(w, http.StatusUnauthorized, "SecurityException")
+		return
+	}
+
+	switch query.Get("op") {
+	case "CREATE":
+		if !strings.HasPrefix(r.URL.Path, "/datanode") {
+			w.Header().Set("Location", f.URL+"/datanode"+name+"?"+r.URL.RawQuery)
+			w.WriteHeader(http.StatusTemporaryRedirect)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		name = strings.TrimPrefix(name, "/datanode")
+		f.files[name] = body
+		f.modTimes[name] = time.Now()
+		w.WriteHeader(http.StatusCreated)
+	case "APPEND":
+		f.appends++
+		writeRemoteException(w, http.StatusForbidden, "UnsupportedOperationException")
+	case "OPEN":
+		if !strings.HasPrefix(r.URL.Path, "/datanode") {
+			w.Header().Set("Location", f.URL+"/datanode"+name+"?"+r.URL.RawQuery)
+			w.WriteHeader(http.StatusTemporaryRedirect)
+			return
+		}
+		name = strings.TrimPrefix(name, "/datanode")
+		b, ok := f.files[name]
+		if !ok {
+			writeRemoteException(w, http.StatusNotFound, exceptionFileNotFound)
+			return
+		}
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		length, _ := strconv.Atoi(query.Get("length"))
+		b = b[offset:]
+		if length > 0 && length < len(b) {
+			b = b[:length]
+		}
+		_, _ = w.Write(b)
+	case "GETFILESTATUS":
+		if _, ok := f.files[name]; !ok {
+			writeRemoteException(w, http.StatusNotFound, exceptionFileNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"FileStatus": f.status(name, "FILE")})
+	case "LISTSTATUS":
+		children := map[string]string{}
+		for file := range f.files {
+			if !strings.HasPrefix(file, name+"/") {
+				continue
+			}
+			rest := strings.TrimPrefix(file, name+"/")
+			if i := strings.Index(rest, "/"); i >= 0 {
+				children[rest[:i]] = fileTypeDirectory
+			} else {
+				children[rest] = "FILE"
+			}
+		}
+		if len(children) == 0 {
+			writeRemoteException(w, http.StatusNotFound, exceptionFileNotFound)
+			return
+		}
+		statuses := []fileStatus{}
+		for child, typ := range children {
+			statuses = append(statuses, f.status(path.Join(name, child), typ))
+		}
+		writeJSON(w, map[string]interface{}{"FileStatuses": map[string]interface{}{"FileStatus": statuses}})
+	case "RENAME":
+		dst := query.Get("destination")
+		b, ok := f.files[name]
+		if !ok {
+			writeJSON(w, map[string]bool{"boolean": false})
+			return
+		}
+		f.files[dst] = b
+		f.modTimes[dst] = f.modTimes[name]
+		delete(f.files, name)
+		writeJSON(w, map[string]bool{"boolean": true})
+	case "SETTIMES":
+		ms, _ := strconv.ParseInt(query.Get("modificationtime"), 10, 64)
+		f.modTimes[name] = time.Unix(0, ms*int64(time.Millisecond))
+	case "DELETE":
+		for file := range f.files {
+			if file == name || strings.HasPrefix(file, name+"/") {
+				delete(f.files, file)
+			}
+		}
+		writeJSON(w, map[string]bool{"boolean": true})
+	default:
+		writeRemoteException(w, http.StatusBadRequest, "IllegalArgumentException")
+	}
+}
+
+func (f *fakeWebHDFS) status(name string, typ string) fileStatus {
+	return fileStatus{
+		PathSuffix:       filepath.Base(name),
+		Type:             typ,
+		Length:           int64(len(f.files[name])),
+		ModificationTime: f.modTimes[name].UnixNano() / int64(time.Millisecond),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, _ := json.Marshal(v)
+	_, _ = w.Write(b)
+}
+
+func writeRemoteException(w http.ResponseWriter, status int, exception string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `{"RemoteException":{"exception":"%s","javaClassName":"java.io.%s","message":"fake"}}`, exception, exception)
+}
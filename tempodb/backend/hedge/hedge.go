@@ -0,0 +1,195 @@
+package hedge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// latencies of this many recent requests per operation are kept to compute the hedging threshold
+	windowSize = 256
+	// no requests are hedged until this many latencies are known
+	minSamples = 32
+	// the threshold is recomputed after this many requests
+	recomputeEvery = 16
+)
+
+var (
+	metricHedgedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "backend_hedged_requests_total",
+		Help:      "Total number of duplicate requests sent because the original was slow.",
+	}, []string{"backend", "operation"})
+	metricHedgedWins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "backend_hedged_request_wins_total",
+		Help:      "Total number of duplicate requests that returned before the original.",
+	}, []string{"backend", "operation"})
+)
+
+type Config struct {
+	// Percentile of recent request latencies after which a duplicate request is sent, e.g. 0.9.  0 disables
+	// hedging.
+	Percentile float64 `yaml:"percentile"`
+	// MinDelay is the least time to wait before sending a duplicate request, however fast recent requests
+	// were.
+	MinDelay time.Duration `yaml:"min_delay"`
+}
+
+// Hedger sends a duplicate of a read that has not returned within a percentile of recent latencies of the
+// same operation and takes whichever response comes first.  A nil Hedger does not hedge.
+type Hedger struct {
+	cfg     Config
+	backend string
+
+	mtx       sync.Mutex
+	latencies map[string]*window
+}
+
+// New returns a Hedger for the named backend, or nil if hedging is disabled
+func New(cfg Config, backend string) *Hedger {
+	if cfg.Percentile <= 0 || cfg.Percentile >= 1 {
+		return nil
+	}
+
+	return &Hedger{
+		cfg:       cfg,
+		backend:   backend,
+		latencies: map[string]*window{},
+	}
+}
+
+// Do calls fn and, if it has not returned within the hedging threshold for op, calls it again.  The first
+// successful response is returned and the other call is cancelled.  If both fail the first error is
+// returned.  fn must not share state between calls.
+func (h *Hedger) Do(ctx context.Context, op string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if h == nil {
+		return fn(ctx)
+	}
+
+	w := h.window(op)
+	threshold, ok := w.threshold()
+	if !ok {
+		start := time.Now()
+		b, err := fn(ctx)
+		if err == nil {
+			w.record(time.Since(start))
+		}
+		return b, err
+	}
+	if threshold < h.cfg.MinDelay {
+		threshold = h.cfg.MinDelay
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		b      []byte
+		err    error
+		hedged bool
+	}
+	results := make(chan result, 2)
+	start := time.Now()
+	call := func(hedged bool) {
+		b, err := fn(ctx)
+		results <- result{b, err, hedged}
+	}
+
+	go call(false)
+	outstanding := 1
+
+	timer := time.NewTimer(threshold)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			metricHedgedRequests.WithLabelValues(h.backend, op).Inc()
+			go call(true)
+			outstanding++
+		case res := <-results:
+			outstanding--
+			if res.err == nil {
+				w.record(time.Since(start))
+				if res.hedged {
+					metricHedgedWins.WithLabelValues(h.backend, op).Inc()
+				}
+				return res.b, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			// the original failed before the threshold.  don't hedge a request that fails fast
+			if outstanding == 0 {
+				return nil, firstErr
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (h *Hedger) window(op string) *window {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	w, ok := h.latencies[op]
+	if !ok {
+		w = &window{percentile: h.cfg.Percentile}
+		h.latencies[op] = w
+	}
+	return w
+}
+
+// window is a ring of recent latencies
+type window struct {
+	percentile float64
+
+	mtx       sync.Mutex
+	samples   [windowSize]time.Duration
+	next      int
+	count     int
+	sinceCalc int
+	cached    time.Duration
+}
+
+func (w *window) record(d time.Duration) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % windowSize
+	if w.count < windowSize {
+		w.count++
+	}
+	w.sinceCalc++
+}
+
+// threshold returns the configured percentile of the recent latencies.  it is false until there are
+// enough samples.
+func (w *window) threshold() (time.Duration, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.count < minSamples {
+		return 0, false
+	}
+
+	if w.cached == 0 || w.sinceCalc >= recomputeEvery {
+		sorted := make([]time.Duration, w.count)
+		copy(sorted, w.samples[:w.count])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		w.cached = sorted[int(float64(len(sorted)-1)*w.percentile)]
+		w.sinceCalc = 0
+	}
+
+	return w.cached, true
+}
@@ -0,0 +1,139 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisabled(t *testing.T) {
+	assert.Nil(t, New(Config{}, "test"))
+	assert.Nil(t, New(Config{Percentile: 1}, "test"))
+
+	var h *Hedger
+	b, err := h.Do(context.Background(), "op", func(context.Context) ([]byte, error) {
+		return []byte("a"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a"), b)
+}
+
+func TestHedgesSlowRequests(t *testing.T) {
+	h := New(Config{Percentile: 0.9}, "test")
+	warmUp(t, h, "op", time.Millisecond)
+
+	// the first call hangs until cancelled.  the duplicate returns at once
+	var calls int32
+	start := time.Now()
+	b, err := h.Do(context.Background(), "op", func(ctx context.Context) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []byte("hedged"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hedged"), b)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestMinDelay(t *testing.T) {
+	h := New(Config{Percentile: 0.9, MinDelay: time.Hour}, "test")
+	warmUp(t, h, "op", 0)
+
+	// the threshold is tiny but the min delay keeps the duplicate from being sent
+	var calls int32
+	_, err := h.Do(context.Background(), "op", func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFastErrorsAreNotHedged(t *testing.T) {
+	h := New(Config{Percentile: 0.9}, "test")
+	warmUp(t, h, "op", 10*time.Millisecond)
+
+	var calls int32
+	expected := errors.New("not found")
+	_, err := h.Do(context.Background(), "op", func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, expected
+	})
+	assert.Equal(t, expected, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestBothFail(t *testing.T) {
+	h := New(Config{Percentile: 0.5}, "test")
+	warmUp(t, h, "op", 0)
+
+	var calls int32
+	first := errors.New("first")
+	_, err := h.Do(context.Background(), "op", func(ctx context.Context) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(20 * time.Millisecond)
+			return nil, first
+		}
+		time.Sleep(40 * time.Millisecond)
+		return nil, errors.New("second")
+	})
+	assert.Equal(t, first, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestOperationsAreTrackedSeparately(t *testing.T) {
+	h := New(Config{Percentile: 0.9}, "test")
+	warmUp(t, h, "fast", 0)
+
+	// not enough samples of slow to hedge it
+	var calls int32
+	_, err := h.Do(context.Background(), "slow", func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestWindowThreshold(t *testing.T) {
+	w := &window{percentile: 0.9}
+	for i := 1; i < minSamples; i++ {
+		w.record(time.Duration(i))
+	}
+	_, ok := w.threshold()
+	assert.False(t, ok)
+
+	for i := minSamples; i <= 100; i++ {
+		w.record(time.Duration(i))
+	}
+	threshold, ok := w.threshold()
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(90), threshold)
+
+	// old samples roll out of the window
+	for i := 0; i < windowSize; i++ {
+		w.record(time.Duration(1000))
+	}
+	threshold, _ = w.threshold()
+	assert.Equal(t, time.Duration(1000), threshold)
+}
+
+func warmUp(t *testing.T, h *Hedger, op string, latency time.Duration) {
+	for i := 0; i < minSamples; i++ {
+		_, err := h.Do(context.Background(), op, func(context.Context) ([]byte, error) {
+			time.Sleep(latency)
+			return nil, nil
+		})
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,226 @@
+package instrumentation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	opRead   = "read"
+	opWrite  = "write"
+	opList   = "list"
+	opDelete = "delete"
+)
+
+var (
+	metricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "backend_request_duration_seconds",
+		Help:      "Time spent in backend calls.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 4, 6),
+	}, []string{"backend", "operation", "method"})
+	metricRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "backend_request_errors_total",
+		Help:      "Total number of backend calls that failed.",
+	}, []string{"backend", "operation", "method"})
+	metricBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "backend_bytes_total",
+		Help:      "Total number of bytes read from and written to the backend.",
+	}, []string{"backend", "operation"})
+)
+
+type readerWriter struct {
+	backend string
+
+	nextReader    backend.Reader
+	nextWriter    backend.Writer
+	nextCompactor backend.Compactor
+}
+
+// New records the latency, errors and bytes transferred of every call to the backend labelled with the backend's
+// name.  Missing metas and tenant indexes and calls cancelled by the caller are not counted as errors.
+func New(r backend.Reader, w backend.Writer, c backend.Compactor, backendName string) (backend.Reader, backend.Writer, backend.Compactor) {
+	rw := &readerWriter{
+		backend:       backendName,
+		nextReader:    r,
+		nextWriter:    w,
+		nextCompactor: c,
+	}
+	return rw, rw, rw
+}
+
+// Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	tenants, err := rw.nextReader.Tenants(ctx)
+	rw.observe(opList, "Tenants", start, err)
+	return tenants, err
+}
+
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	start := time.Now()
+	blocks, err := rw.nextReader.Blocks(ctx, tenantID)
+	rw.observe(opList, "Blocks", start, err)
+	return blocks, err
+}
+
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	start := time.Now()
+	meta, err := rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+	rw.observe(opRead, "BlockMeta", start, err)
+	return meta, err
+}
+
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	start := time.Now()
+	bloom, err := rw.nextReader.Bloom(ctx, blockID, tenantID)
+	rw.observe(opRead, "Bloom", start, err)
+	rw.bytes(opRead, len(bloom))
+	return bloom, err
+}
+
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	start := time.Now()
+	index, err := rw.nextReader.Index(ctx, blockID, tenantID)
+	rw.observe(opRead, "Index", start, err)
+	rw.bytes(opRead, len(index))
+	return index, err
+}
+
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	start := time.Now()
+	err := rw.nextReader.Object(ctx, blockID, tenantID, offset, buffer)
+	rw.observe(opRead, "Object", start, err)
+	if err == nil {
+		rw.bytes(opRead, len(buffer))
+	}
+	return err
+}
+
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	start := time.Now()
+	err := rw.nextReader.ReadRange(ctx, name, blockID, tenantID, offset, buffer)
+	rw.observe(opRead, "ReadRange", start, err)
+	if err == nil {
+		rw.bytes(opRead, len(buffer))
+	}
+	return err
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	start := time.Now()
+	index, err := rw.nextReader.TenantIndex(ctx, tenantID)
+	rw.observe(opRead, "TenantIndex", start, err)
+	return index, err
+}
+
+func (rw *readerWriter) Shutdown() {
+	rw.nextReader.Shutdown()
+}
+
+// Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	var objectSize int64
+	if info, err := os.Stat(objectFilePath); err == nil {
+		objectSize = info.Size()
+	}
+
+	start := time.Now()
+	err := rw.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	rw.observe(opWrite, "Write", start, err)
+	if err == nil {
+		rw.bytes(opWrite, len(bBloom)+len(bIndex)+int(objectSize))
+	}
+	return err
+}
+
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	start := time.Now()
+	err := rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	rw.observe(opWrite, "WriteBlockMeta", start, err)
+	if err == nil {
+		rw.bytes(opWrite, len(bBloom)+len(bIndex))
+	}
+	return err
+}
+
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	start := time.Now()
+	tracker, err := rw.nextWriter.AppendObject(ctx, tracker, meta, bObject)
+	rw.observe(opWrite, "AppendObject", start, err)
+	if err == nil {
+		rw.bytes(opWrite, len(bObject))
+	}
+	return tracker, err
+}
+
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	start := time.Now()
+	err := rw.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+	rw.observe(opWrite, "WriteTenantIndex", start, err)
+	return err
+}
+
+// Compactor
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	start := time.Now()
+	err := rw.nextCompactor.MarkBlockCompacted(blockID, tenantID)
+	rw.observe(opWrite, "MarkBlockCompacted", start, err)
+	return err
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	start := time.Now()
+	err := rw.nextCompactor.ClearBlock(blockID, tenantID)
+	rw.observe(opDelete, "ClearBlock", start, err)
+	return err
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	start := time.Now()
+	err := rw.nextCompactor.ClearBlocks(blockIDs, tenantID)
+	rw.observe(opDelete, "ClearBlocks", start, err)
+	return err
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	start := time.Now()
+	meta, err := rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+	rw.observe(opRead, "CompactedBlockMeta", start, err)
+	return meta, err
+}
+
+func (rw *readerWriter) observe(op string, method string, start time.Time, err error) {
+	metricRequestDuration.WithLabelValues(rw.backend, op, method).Observe(time.Since(start).Seconds())
+	if isError(err) {
+		metricRequestErrors.WithLabelValues(rw.backend, op, method).Inc()
+	}
+}
+
+func (rw *readerWriter) bytes(op string, n int) {
+	if n > 0 {
+		metricBytes.WithLabelValues(rw.backend, op).Add(float64(n))
+	}
+}
+
+// isError is false for errors that are part of normal operation
+func isError(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, backend.ErrMetaDoesNotExist),
+		errors.Is(err, backend.ErrIndexDoesNotExist):
+		return false
+	}
+	return true
+}
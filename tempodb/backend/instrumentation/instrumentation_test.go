@@ -0,0 +1,112 @@
+package instrumentation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBackend struct {
+	err error
+}
+
+func (m *mockBackend) Tenants(ctx context.Context) ([]string, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return nil, m.err
+}
+func (m *mockBackend) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return make([]byte, 10), m.err
+}
+func (m *mockBackend) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return m.err
+}
+func (m *mockBackend) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return m.err
+}
+func (m *mockBackend) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Shutdown() {}
+func (m *mockBackend) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return m.err
+}
+func (m *mockBackend) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	return m.err
+}
+func (m *mockBackend) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return nil, m.err
+}
+func (m *mockBackend) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return m.err
+}
+func (m *mockBackend) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return m.err
+}
+func (m *mockBackend) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return m.err
+}
+func (m *mockBackend) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return m.err
+}
+func (m *mockBackend) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return nil, m.err
+}
+
+func TestInstrumentation(t *testing.T) {
+	m := &mockBackend{}
+	r, w, c := New(m, m, m, "mock")
+	ctx := context.Background()
+
+	// bytes are counted for reads and writes
+	_, err := r.Bloom(ctx, uuid.New(), "tenant")
+	require.NoError(t, err)
+	err = r.Object(ctx, uuid.New(), "tenant", 0, make([]byte, 5))
+	require.NoError(t, err)
+	_, err = w.AppendObject(ctx, nil, nil, make([]byte, 7))
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, counterValue(t, metricBytes.WithLabelValues("mock", opRead)))
+	assert.Equal(t, 7.0, counterValue(t, metricBytes.WithLabelValues("mock", opWrite)))
+	assert.Equal(t, uint64(1), histogramCount(t, metricRequestDuration.WithLabelValues("mock", opRead, "Bloom")))
+
+	// missing metas are not errors
+	m.err = backend.ErrMetaDoesNotExist
+	_, err = r.BlockMeta(ctx, uuid.New(), "tenant")
+	assert.Error(t, err)
+	assert.Equal(t, 0.0, counterValue(t, metricRequestErrors.WithLabelValues("mock", opRead, "BlockMeta")))
+
+	m.err = errors.New("failed")
+	_, err = r.Blocks(ctx, "tenant")
+	assert.Error(t, err)
+	err = c.ClearBlock(uuid.New(), "tenant")
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, counterValue(t, metricRequestErrors.WithLabelValues("mock", opList, "Blocks")))
+	assert.Equal(t, 1.0, counterValue(t, metricRequestErrors.WithLabelValues("mock", opDelete, "ClearBlock")))
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	require.NoError(t, c.Write(m))
+	return m.GetCounter().GetValue()
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	require.NoError(t, o.(prometheus.Histogram).Write(m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -2,4 +2,7 @@ package local
 
 type Config struct {
 	Path string `yaml:"path"`
+	// Fsync flushes every file written and the folder it's renamed into to disk before the write returns so
+	// blocks survive power loss.  Files are always written to a temp file and renamed into place.
+	Fsync bool `yaml:"fsync"`
 }
@@ -0,0 +1,215 @@
+package local
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+// writeFile writes data to a temp file next to name and renames it into place so a crash never leaves name
+// partially written
+func (rw *readerWriter) writeFile(name string, data []byte) error {
+	f, err := createTemp(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	return rw.commitFile(f, name)
+}
+
+// copyFile copies src to a temp file next to name and renames it into place
+func (rw *readerWriter) copyFile(src string, name string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	f, err := createTemp(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, in)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	return rw.commitFile(f, name)
+}
+
+// commitFile closes a temp file written by createTemp and renames it to name.  With fsync the file's contents
+// and then the rename are flushed to disk before returning.
+func (rw *readerWriter) commitFile(f *os.File, name string) error {
+	var err error
+	if rw.cfg.Fsync {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	err = os.Rename(f.Name(), name)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return rw.syncDir(path.Dir(name))
+}
+
+// mkdirBlock creates the block's folder.  With fsync the tenant folder is flushed so the block's folder
+// survives a crash along with the files written to it.
+func (rw *readerWriter) mkdirBlock(blockID uuid.UUID, tenantID string) error {
+	blockFolder := rw.rootPath(blockID, tenantID)
+	if fileExists(blockFolder) {
+		return nil
+	}
+
+	err := os.MkdirAll(blockFolder, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return rw.syncDir(path.Dir(blockFolder))
+}
+
+func (rw *readerWriter) syncDir(dir string) error {
+	if !rw.cfg.Fsync {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// removePartialBlocks removes blocks left behind by a crash: blocks without a meta or with a meta that can't
+// be parsed, blocks missing a file their meta promises and leftover temp files.  Without this every poll fails
+// on the broken block.  It assumes no other process is writing to the path.
+func (rw *readerWriter) removePartialBlocks() error {
+	tenants, err := ioutil.ReadDir(rw.cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, tenant := range tenants {
+		if !tenant.IsDir() {
+			continue
+		}
+		tenantID := tenant.Name()
+
+		folders, err := ioutil.ReadDir(path.Join(rw.cfg.Path, tenantID))
+		if err != nil {
+			return err
+		}
+
+		for _, f := range folders {
+			if !f.IsDir() {
+				removeTempFile(path.Join(rw.cfg.Path, tenantID), f.Name())
+				continue
+			}
+			blockID, err := uuid.Parse(f.Name())
+			if err != nil {
+				continue
+			}
+
+			if reason := rw.partial(blockID, tenantID); reason != "" {
+				level.Warn(rw.logger).Log("msg", "removing partially written block", "blockID", blockID, "tenantID", tenantID, "reason", reason)
+				err = os.RemoveAll(rw.rootPath(blockID, tenantID))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			files, err := ioutil.ReadDir(rw.rootPath(blockID, tenantID))
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				removeTempFile(rw.rootPath(blockID, tenantID), file.Name())
+			}
+		}
+	}
+
+	return nil
+}
+
+// partial returns why a block is partially written or "" if it isn't
+func (rw *readerWriter) partial(blockID uuid.UUID, tenantID string) string {
+	if fileExists(rw.compactedMetaFileName(blockID, tenantID)) {
+		return ""
+	}
+
+	bytes, err := ioutil.ReadFile(rw.metaFileName(blockID, tenantID))
+	if os.IsNotExist(err) {
+		return "no meta"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	meta := &encoding.BlockMeta{}
+	err = json.Unmarshal(bytes, meta)
+	if err != nil {
+		return "corrupt meta: " + err.Error()
+	}
+
+	for _, name := range []string{
+		rw.bloomFileName(blockID, tenantID),
+		rw.indexFileName(blockID, tenantID),
+		rw.tracesFileName(blockID, tenantID),
+	} {
+		if !fileExists(name) {
+			return "missing " + path.Base(name)
+		}
+	}
+
+	return ""
+}
+
+// createTemp creates a uniquely named temp file next to name
+func createTemp(name string) (*os.File, error) {
+	f, err := ioutil.TempFile(path.Dir(name), path.Base(name)+".*"+tempSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Chmod(0644)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func removeTempFile(dir string, name string) {
+	if strings.HasSuffix(name, tempSuffix) {
+		os.Remove(path.Join(dir, name))
+	}
+}
@@ -9,13 +9,18 @@ import (
 	"os"
 	"path"
 
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/grafana/tempo/tempodb/encoding"
 )
 
+const tempSuffix = ".tmp"
+
 type readerWriter struct {
-	cfg *Config
+	cfg    *Config
+	logger log.Logger
 }
 
 func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
@@ -25,86 +30,80 @@ func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error)
 	}
 
 	rw := &readerWriter{
-		cfg: cfg,
+		cfg:    cfg,
+		logger: log_util.Logger,
+	}
+
+	err = rw.removePartialBlocks()
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	return rw, rw, rw, nil
 }
 
 func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, tracesFilePath string) error {
-	err := rw.WriteBlockMeta(ctx, nil, meta, bBloom, bIndex)
-	if err != nil {
-		return err
-	}
-
 	blockID := meta.BlockID
 	tenantID := meta.TenantID
 	blockFolder := rw.rootPath(blockID, tenantID)
 
 	if !fileExists(tracesFilePath) {
-		os.RemoveAll(blockFolder)
 		return fmt.Errorf("traces file not found %s", tracesFilePath)
 	}
 
-	// copy traces file.
-	src, err := os.Open(tracesFilePath)
+	err := rw.mkdirBlock(blockID, tenantID)
 	if err != nil {
-		os.RemoveAll(blockFolder)
 		return err
 	}
-	defer src.Close()
 
-	tracesFileName := rw.tracesFileName(blockID, tenantID)
-	dst, err := os.Create(tracesFileName)
+	// copy traces file.
+	err = rw.copyFile(tracesFilePath, rw.tracesFileName(blockID, tenantID))
 	if err != nil {
 		os.RemoveAll(blockFolder)
 		return err
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
-	if err != nil {
-		os.RemoveAll(blockFolder)
-	}
-	return err
+	return rw.WriteBlockMeta(ctx, nil, meta, bBloom, bIndex)
 }
 
+// WriteBlockMeta writes the meta last so a block is never listed with its other files missing
 func (rw *readerWriter) WriteBlockMeta(_ context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
 	blockID := meta.BlockID
 	tenantID := meta.TenantID
-
-	if tracker != nil {
-		var dst *os.File = tracker.(*os.File)
-		_ = dst.Close()
-	}
-
 	blockFolder := rw.rootPath(blockID, tenantID)
-	err := os.MkdirAll(blockFolder, os.ModePerm)
+
+	err := rw.mkdirBlock(blockID, tenantID)
 	if err != nil {
 		return err
 	}
 
+	if tracker != nil {
+		dst := tracker.(*os.File)
+		err = rw.commitFile(dst, rw.tracesFileName(blockID, tenantID))
+		if err != nil {
+			os.RemoveAll(blockFolder)
+			return err
+		}
+	}
+
 	bMeta, err := json.Marshal(meta)
 	if err != nil {
 		return err
 	}
 
-	metaFileName := rw.metaFileName(blockID, tenantID)
-	err = ioutil.WriteFile(metaFileName, bMeta, 0644)
+	err = rw.writeFile(rw.bloomFileName(blockID, tenantID), bBloom)
 	if err != nil {
 		os.RemoveAll(blockFolder)
 		return err
 	}
 
-	bloomFileName := rw.bloomFileName(blockID, tenantID)
-	err = ioutil.WriteFile(bloomFileName, bBloom, 0644)
+	err = rw.writeFile(rw.indexFileName(blockID, tenantID), bIndex)
 	if err != nil {
 		os.RemoveAll(blockFolder)
 		return err
 	}
 
-	indexFileName := rw.indexFileName(blockID, tenantID)
-	err = ioutil.WriteFile(indexFileName, bIndex, 0644)
+	err = rw.writeFile(rw.metaFileName(blockID, tenantID), bMeta)
 	if err != nil {
 		os.RemoveAll(blockFolder)
 		return err
@@ -113,20 +112,19 @@ func (rw *readerWriter) WriteBlockMeta(_ context.Context, tracker backend.Append
 	return nil
 }
 
+// AppendObject appends to a temp file that is renamed into place by WriteBlockMeta
 func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
 	blockID := meta.BlockID
 	tenantID := meta.TenantID
 
 	var dst *os.File
 	if tracker == nil {
-		blockFolder := rw.rootPath(blockID, tenantID)
-		err := os.MkdirAll(blockFolder, os.ModePerm)
+		err := rw.mkdirBlock(blockID, tenantID)
 		if err != nil {
 			return nil, err
 		}
 
-		tracesFileName := rw.tracesFileName(blockID, tenantID)
-		dst, err = os.Create(tracesFileName)
+		dst, err = createTemp(rw.tracesFileName(blockID, tenantID))
 		if err != nil {
 			return nil, err
 		}
@@ -142,6 +140,20 @@ func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.Append
 	return dst, nil
 }
 
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path.Join(rw.cfg.Path, tenantID), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return rw.writeFile(rw.tenantIndexFileName(tenantID), bIndex)
+}
+
 func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
 	folders, err := ioutil.ReadDir(rw.cfg.Path)
 	if err != nil {
@@ -163,6 +175,10 @@ func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUI
 	var warning error
 	path := path.Join(rw.cfg.Path, tenantID)
 	folders, err := ioutil.ReadDir(path)
+	// a tenant never written to has no blocks rather than an error, as with the object stores
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -229,6 +245,39 @@ func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID
 	return nil
 }
 
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	filename := path.Join(rw.rootPath(blockID, tenantID), name)
+	if name == backend.ObjectName {
+		// objects are stored as traces by the local backend
+		filename = rw.tracesFileName(blockID, tenantID)
+	}
+
+	f, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.ReadAt(buffer, int64(start))
+	if err == io.EOF {
+		// the last read of a block may run past the end of the object
+		return nil
+	}
+	return err
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	bytes, err := ioutil.ReadFile(rw.tenantIndexFileName(tenantID))
+	if os.IsNotExist(err) {
+		return nil, backend.ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UnmarshalTenantIndex(bytes)
+}
+
 func (rw *readerWriter) Shutdown() {
 
 }
@@ -249,6 +298,10 @@ func (rw *readerWriter) tracesFileName(blockID uuid.UUID, tenantID string) strin
 	return path.Join(rw.rootPath(blockID, tenantID), "traces")
 }
 
+func (rw *readerWriter) tenantIndexFileName(tenantID string) string {
+	return path.Join(rw.cfg.Path, tenantID, backend.TenantIndexName)
+}
+
 func (rw *readerWriter) rootPath(blockID uuid.UUID, tenantID string) string {
 	return path.Join(rw.cfg.Path, tenantID, blockID.String())
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/backend"
@@ -72,6 +73,21 @@ func TestReadWrite(t *testing.T) {
 	assert.NoError(t, err, "unexpected error reading traces")
 	assert.Equal(t, fakeTraces[100:120], actualTrace)
 
+	err = r.ReadRange(ctx, backend.ObjectName, blockID, tenantIDs[0], 100, actualTrace)
+	assert.NoError(t, err, "unexpected error reading range of traces")
+	assert.Equal(t, fakeTraces[100:120], actualTrace)
+
+	actualIndexPage := make([]byte, 10)
+	err = r.ReadRange(ctx, backend.IndexName, blockID, tenantIDs[0], 5, actualIndexPage)
+	assert.NoError(t, err, "unexpected error reading range of index")
+	assert.Equal(t, fakeIndex[5:15], actualIndexPage)
+
+	// reads may run past the end of the object
+	actualIndexPage = make([]byte, 10)
+	err = r.ReadRange(ctx, backend.IndexName, blockID, tenantIDs[0], 15, actualIndexPage)
+	assert.NoError(t, err, "unexpected error reading past the end of index")
+	assert.Equal(t, fakeIndex[15:], actualIndexPage[:5])
+
 	actualBloom, err := r.Bloom(ctx, blockID, tenantIDs[0])
 	assert.NoError(t, err, "unexpected error reading bloom")
 	assert.Equal(t, fakeBloom, actualBloom)
@@ -181,3 +197,142 @@ func TestCompaction(t *testing.T) {
 		assert.Nil(t, meta)
 	}
 }
+
+func TestTenantIndex(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Path: tempDir,
+	})
+	assert.NoError(t, err, "unexpected error creating local backend")
+
+	ctx := context.Background()
+	tenantID := "fake"
+
+	_, err = r.TenantIndex(ctx, tenantID)
+	assert.Equal(t, backend.ErrIndexDoesNotExist, err)
+
+	meta := []*encoding.BlockMeta{encoding.NewBlockMeta(tenantID, uuid.New())}
+	compactedMeta := []*encoding.CompactedBlockMeta{
+		{
+			BlockMeta:     *encoding.NewBlockMeta(tenantID, uuid.New()),
+			CompactedTime: time.Unix(1000, 0).UTC(),
+		},
+	}
+
+	err = w.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+	assert.NoError(t, err)
+
+	index, err := r.TenantIndex(ctx, tenantID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), index.CreatedAt, time.Minute)
+	assert.Len(t, index.Meta, 1)
+	assert.Equal(t, meta[0].BlockID, index.Meta[0].BlockID)
+	assert.Len(t, index.CompactedMeta, 1)
+	assert.Equal(t, compactedMeta[0].BlockID, index.CompactedMeta[0].BlockID)
+	assert.True(t, compactedMeta[0].CompactedTime.Equal(index.CompactedMeta[0].CompactedTime))
+
+	// the index is not a block
+	blocks, err := r.Blocks(ctx, tenantID)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 0)
+}
+
+func TestAppendFsync(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Path:  tempDir,
+		Fsync: true,
+	})
+	assert.NoError(t, err, "unexpected error creating local backend")
+
+	ctx := context.Background()
+	meta := encoding.NewBlockMeta("fake", uuid.New())
+
+	var tracker backend.AppendTracker
+	tracker, err = w.AppendObject(ctx, tracker, meta, []byte("hello "))
+	assert.NoError(t, err)
+	tracker, err = w.AppendObject(ctx, tracker, meta, []byte("world"))
+	assert.NoError(t, err)
+
+	// not listed until the meta is written
+	_, err = r.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	_, err = os.Stat(path.Join(tempDir, meta.TenantID, meta.BlockID.String(), "traces"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = w.WriteBlockMeta(ctx, tracker, meta, []byte("bloom"), []byte("index"))
+	assert.NoError(t, err)
+
+	actualObject := make([]byte, 11)
+	err = r.Object(ctx, meta.BlockID, meta.TenantID, 0, actualObject)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello world"), actualObject)
+
+	// no temp files left behind
+	files, err := ioutil.ReadDir(path.Join(tempDir, meta.TenantID, meta.BlockID.String()))
+	assert.NoError(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.ElementsMatch(t, []string{"meta.json", "bloom", "index", "traces"}, names)
+}
+
+func TestRemovePartialBlocks(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	fakeTracesFile, err := ioutil.TempFile("/tmp", "")
+	defer os.Remove(fakeTracesFile.Name())
+	assert.NoError(t, err, "unexpected error creating temp file")
+
+	_, w, c, err := New(&Config{
+		Path: tempDir,
+	})
+	assert.NoError(t, err, "unexpected error creating local backend")
+
+	ctx := context.Background()
+	write := func() *encoding.BlockMeta {
+		meta := encoding.NewBlockMeta("fake", uuid.New())
+		err := w.Write(ctx, meta, []byte("bloom"), []byte("index"), fakeTracesFile.Name())
+		assert.NoError(t, err)
+		return meta
+	}
+	blockFile := func(meta *encoding.BlockMeta, name string) string {
+		return path.Join(tempDir, meta.TenantID, meta.BlockID.String(), name)
+	}
+
+	complete := write()
+	assert.NoError(t, ioutil.WriteFile(blockFile(complete, "index.123.tmp"), []byte("index"), 0644))
+
+	compacted := write()
+	assert.NoError(t, c.MarkBlockCompacted(compacted.BlockID, compacted.TenantID))
+
+	corruptMeta := write()
+	assert.NoError(t, ioutil.WriteFile(blockFile(corruptMeta, "meta.json"), []byte("{\"blockID"), 0644))
+
+	noMeta := write()
+	assert.NoError(t, os.Remove(blockFile(noMeta, "meta.json")))
+
+	noTraces := write()
+	assert.NoError(t, os.Remove(blockFile(noTraces, "traces")))
+
+	r, _, _, err := New(&Config{
+		Path: tempDir,
+	})
+	assert.NoError(t, err, "unexpected error creating local backend")
+
+	blocks, err := r.Blocks(ctx, "fake")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{complete.BlockID, compacted.BlockID}, blocks)
+
+	_, err = os.Stat(blockFile(complete, "index.123.tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -2,6 +2,7 @@ package memcached
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/cortexproject/cortex/pkg/chunk/cache"
@@ -9,6 +10,7 @@ import (
 	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/grafana/tempo/tempodb/encoding"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/google/uuid"
 )
@@ -16,12 +18,34 @@ import (
 const (
 	typeBloom = "bloom"
 	typeIndex = "index"
+
+	// memcached's default maximum item size
+	defaultMaxItemSize = 1024 * 1024
+)
+
+var (
+	metricCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "memcached_total",
+		Help:      "Total number of times memcached was queried.",
+	}, []string{"type", "status"})
+	metricSkippedItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "memcached_skipped_items_total",
+		Help:      "Total number of blooms and indexes not cached because they were larger than the max item size.",
+	}, []string{"type"})
 )
 
 type Config struct {
 	ClientConfig cache.MemcachedClientConfig `yaml:",inline"`
 
 	TTL time.Duration `yaml:"ttl"`
+	// MaxItemSize is the largest bloom or index cached.  Larger objects are always read from the backend.  It
+	// should not exceed memcached's own item size limit (-I).
+	MaxItemSize int `yaml:"max_item_size"`
+	// WriteThrough caches the bloom and index of every block written so the first queries of a fresh block don't
+	// all miss and go to the backend at once
+	WriteThrough bool `yaml:"write_through"`
 }
 
 type readerWriter struct {
@@ -29,6 +53,9 @@ type readerWriter struct {
 	nextWriter backend.Writer
 	client     *cache.Memcached
 	logger     log.Logger
+
+	maxItemSize  int
+	writeThrough bool
 }
 
 func New(nextReader backend.Reader, nextWriter backend.Writer, cfg *Config, logger log.Logger) (backend.Reader, backend.Writer, error) {
@@ -41,6 +68,9 @@ func New(nextReader backend.Reader, nextWriter backend.Writer, cfg *Config, logg
 	if cfg.ClientConfig.UpdateInterval == 0 {
 		cfg.ClientConfig.UpdateInterval = time.Minute
 	}
+	if cfg.MaxItemSize == 0 {
+		cfg.MaxItemSize = defaultMaxItemSize
+	}
 
 	client := cache.NewMemcachedClient(cfg.ClientConfig, "tempo", prometheus.DefaultRegisterer, logger)
 	memcachedCfg := cache.MemcachedConfig{
@@ -54,6 +84,9 @@ func New(nextReader backend.Reader, nextWriter backend.Writer, cfg *Config, logg
 		nextReader: nextReader,
 		nextWriter: nextWriter,
 		logger:     logger,
+
+		maxItemSize:  cfg.MaxItemSize,
+		writeThrough: cfg.WriteThrough,
 	}
 
 	return rw, rw, nil
@@ -74,14 +107,14 @@ func (r *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantI
 
 func (r *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
 	key := key(blockID, tenantID, typeBloom)
-	val := r.get(ctx, key)
+	val := r.get(ctx, key, typeBloom)
 	if val != nil {
 		return val, nil
 	}
 
 	val, err := r.nextReader.Bloom(ctx, blockID, tenantID)
 	if err == nil {
-		r.set(ctx, key, val)
+		r.set(ctx, key, typeBloom, val)
 	}
 
 	return val, err
@@ -89,14 +122,14 @@ func (r *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID st
 
 func (r *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
 	key := key(blockID, tenantID, typeIndex)
-	val := r.get(ctx, key)
+	val := r.get(ctx, key, typeIndex)
 	if val != nil {
 		return val, nil
 	}
 
 	val, err := r.nextReader.Index(ctx, blockID, tenantID)
 	if err == nil {
-		r.set(ctx, key, val)
+		r.set(ctx, key, typeIndex, val)
 	}
 
 	return val, err
@@ -106,6 +139,32 @@ func (r *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID s
 	return r.nextReader.Object(ctx, blockID, tenantID, start, buffer)
 }
 
+// ReadRange caches the pages of paged indexes and the shards of sharded blooms by their offset and length.
+// Ranges of the data object are read through like Object.
+func (r *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	if name != backend.BloomName && name != backend.IndexName {
+		return r.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	}
+
+	key := rangeKey(blockID, tenantID, name, start, len(buffer))
+	val := r.get(ctx, key, name)
+	if len(val) == len(buffer) {
+		copy(buffer, val)
+		return nil
+	}
+
+	err := r.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	if err == nil {
+		r.set(ctx, key, name, buffer)
+	}
+
+	return err
+}
+
+func (r *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return r.nextReader.TenantIndex(ctx, tenantID)
+}
+
 func (r *readerWriter) Shutdown() {
 	r.nextReader.Shutdown()
 	r.client.Stop()
@@ -113,35 +172,61 @@ func (r *readerWriter) Shutdown() {
 
 // Writer
 func (r *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
-	r.set(ctx, key(meta.BlockID, meta.TenantID, typeBloom), bBloom)
-	r.set(ctx, key(meta.BlockID, meta.TenantID, typeIndex), bIndex)
-
-	return r.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	err := r.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	if err == nil {
+		r.populate(ctx, meta, bBloom, bIndex)
+	}
+	return err
 }
 
 func (r *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
-	r.set(ctx, key(meta.BlockID, meta.TenantID, typeBloom), bBloom)
-	r.set(ctx, key(meta.BlockID, meta.TenantID, typeIndex), bIndex)
-
-	return r.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	err := r.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	if err == nil {
+		r.populate(ctx, meta, bBloom, bIndex)
+	}
+	return err
 }
 
 func (r *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
 	return r.nextWriter.AppendObject(ctx, tracker, meta, bObject)
 }
 
-func (r *readerWriter) get(ctx context.Context, key string) []byte {
+func (r *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return r.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+}
+
+// populate caches the bloom and index of a block that was just written
+func (r *readerWriter) populate(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) {
+	if !r.writeThrough {
+		return
+	}
+	r.set(ctx, key(meta.BlockID, meta.TenantID, typeBloom), typeBloom, bBloom)
+	r.set(ctx, key(meta.BlockID, meta.TenantID, typeIndex), typeIndex, bIndex)
+}
+
+func (r *readerWriter) get(ctx context.Context, key string, t string) []byte {
 	found, vals, _ := r.client.Fetch(ctx, []string{key})
 	if len(found) > 0 {
+		metricCache.WithLabelValues(t, "hit").Inc()
 		return vals[0]
 	}
+	metricCache.WithLabelValues(t, "miss").Inc()
 	return nil
 }
 
-func (r *readerWriter) set(ctx context.Context, key string, val []byte) {
+func (r *readerWriter) set(ctx context.Context, key string, t string, val []byte) {
+	if r.maxItemSize > 0 && len(val) > r.maxItemSize {
+		metricSkippedItems.WithLabelValues(t).Inc()
+		return
+	}
 	r.client.Store(ctx, []string{key}, [][]byte{val})
 }
 
 func key(blockID uuid.UUID, tenantID string, t string) string {
 	return blockID.String() + ":" + tenantID + ":" + t
 }
+
+// rangeKey is the key of part of a bloom or index read with ReadRange
+func rangeKey(blockID uuid.UUID, tenantID string, name string, start uint64, length int) string {
+	return key(blockID, tenantID, name) + ":" + strconv.FormatUint(start, 10) + ":" + strconv.Itoa(length)
+}
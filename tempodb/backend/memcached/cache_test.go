@@ -2,6 +2,7 @@ package memcached
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/bradfitz/gomemcache/memcache"
@@ -42,20 +43,31 @@ func (m *mockReader) Object(ctx context.Context, blockID uuid.UUID, tenantID str
 	copy(buffer, m.object)
 	return nil
 }
+func (m *mockReader) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	copy(buffer, m.object)
+	return nil
+}
+func (m *mockReader) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return nil, backend.ErrIndexDoesNotExist
+}
 func (m *mockReader) Shutdown() {}
 
 type mockWriter struct {
+	err error
 }
 
 func (m *mockWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
-	return nil
+	return m.err
 }
 func (m *mockWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
-	return nil
+	return m.err
 }
 func (m *mockWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
 	return nil, nil
 }
+func (m *mockWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return nil
+}
 
 type mockCache struct {
 	stuff map[string]*memcache.Item
@@ -186,3 +198,121 @@ func TestCache(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxItemSize(t *testing.T) {
+	blockID := uuid.New()
+	mockR := &mockReader{
+		bloom: []byte{0x01},
+		index: []byte{0x01, 0x02, 0x03},
+	}
+	mockC := &mockCache{
+		stuff: make(map[string]*memcache.Item),
+	}
+
+	logger := log.NewNopLogger()
+	rw := &readerWriter{
+		client:      cache.NewMemcached(cache.MemcachedConfig{}, mockC, "tempo", prometheus.NewRegistry(), logger),
+		nextReader:  mockR,
+		nextWriter:  &mockWriter{},
+		logger:      logger,
+		maxItemSize: 2,
+	}
+
+	ctx := context.Background()
+	_, _ = rw.Bloom(ctx, blockID, "test")
+	_, _ = rw.Index(ctx, blockID, "test")
+
+	// the index is too large to cache
+	assert.Contains(t, mockC.stuff, key(blockID, "test", typeBloom))
+	assert.NotContains(t, mockC.stuff, key(blockID, "test", typeIndex))
+}
+
+func TestReadRange(t *testing.T) {
+	blockID := uuid.New()
+	mockR := &mockReader{
+		object: []byte{0x01, 0x02},
+	}
+	mockC := &mockCache{
+		stuff: make(map[string]*memcache.Item),
+	}
+
+	logger := log.NewNopLogger()
+	rw := &readerWriter{
+		client:     cache.NewMemcached(cache.MemcachedConfig{}, mockC, "tempo", prometheus.NewRegistry(), logger),
+		nextReader: mockR,
+		nextWriter: &mockWriter{},
+		logger:     logger,
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{backend.IndexName, backend.BloomName, backend.ObjectName} {
+		buffer := make([]byte, 2)
+		assert.NoError(t, rw.ReadRange(ctx, name, blockID, "test", 10, buffer))
+		assert.Equal(t, []byte{0x01, 0x02}, buffer)
+	}
+
+	// index pages and bloom shards are cached by offset and length.  ranges of the data object aren't
+	assert.Contains(t, mockC.stuff, rangeKey(blockID, "test", backend.IndexName, 10, 2))
+	assert.Contains(t, mockC.stuff, rangeKey(blockID, "test", backend.BloomName, 10, 2))
+	assert.NotContains(t, mockC.stuff, rangeKey(blockID, "test", backend.ObjectName, 10, 2))
+
+	mockR.object = nil
+	buffer := make([]byte, 2)
+	assert.NoError(t, rw.ReadRange(ctx, backend.IndexName, blockID, "test", 10, buffer))
+	assert.Equal(t, []byte{0x01, 0x02}, buffer)
+
+	// a different range of the same index misses
+	buffer = make([]byte, 2)
+	assert.NoError(t, rw.ReadRange(ctx, backend.IndexName, blockID, "test", 12, buffer))
+	assert.Equal(t, []byte{0x00, 0x00}, buffer)
+}
+
+func TestWriteThrough(t *testing.T) {
+	tests := []struct {
+		name         string
+		writeThrough bool
+		writeErr     error
+		expectCached bool
+	}{
+		{
+			name:         "enabled",
+			writeThrough: true,
+			expectCached: true,
+		},
+		{
+			name: "disabled",
+		},
+		{
+			name:         "failed write",
+			writeThrough: true,
+			writeErr:     errors.New("failed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockC := &mockCache{
+				stuff: make(map[string]*memcache.Item),
+			}
+
+			logger := log.NewNopLogger()
+			rw := &readerWriter{
+				client:       cache.NewMemcached(cache.MemcachedConfig{}, mockC, "tempo", prometheus.NewRegistry(), logger),
+				nextReader:   &mockReader{},
+				nextWriter:   &mockWriter{err: tt.writeErr},
+				logger:       logger,
+				writeThrough: tt.writeThrough,
+			}
+
+			meta := encoding.NewBlockMeta("test", uuid.New())
+			_ = rw.WriteBlockMeta(context.Background(), nil, meta, []byte{0x01}, []byte{0x02})
+
+			if tt.expectCached {
+				assert.Contains(t, mockC.stuff, key(meta.BlockID, meta.TenantID, typeBloom))
+				assert.Contains(t, mockC.stuff, key(meta.BlockID, meta.TenantID, typeIndex))
+			} else {
+				assert.Empty(t, mockC.stuff)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package memorycache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type missFunc func(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error)
+
+const (
+	typeBloom = "bloom"
+	typeIndex = "index"
+)
+
+var (
+	metricMemoryCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "memory_cache_total",
+		Help:      "Total number of times the in memory cache was queried.",
+	}, []string{"type", "status"})
+	metricMemoryCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "memory_cache_bytes",
+		Help:      "Size of the blooms and indexes in the in memory cache.",
+	})
+)
+
+// reader is an LRU of blooms and indexes in front of the next reader, usually memcached or redis, so the
+// blocks a querier reads repeatedly don't cost even a round trip to the cache.  Only reads are cached.  What
+// a process writes is rarely what it later reads.
+type reader struct {
+	next   backend.Reader
+	logger log.Logger
+
+	mtx      sync.Mutex
+	maxBytes int
+	bytes    int
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+func New(next backend.Reader, cfg *Config, logger log.Logger) (backend.Reader, error) {
+	if cfg.MaxBytes <= 0 {
+		return nil, fmt.Errorf("must specify the maximum bytes to cache in memory")
+	}
+
+	return &reader{
+		next:     next,
+		logger:   logger,
+		maxBytes: cfg.MaxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}, nil
+}
+
+func (r *reader) Tenants(ctx context.Context) ([]string, error) {
+	return r.next.Tenants(ctx)
+}
+
+func (r *reader) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return r.next.Blocks(ctx, tenantID)
+}
+
+func (r *reader) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return r.next.BlockMeta(ctx, blockID, tenantID)
+}
+
+func (r *reader) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return r.readOrCache(ctx, blockID, tenantID, typeBloom, r.next.Bloom)
+}
+
+func (r *reader) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return r.readOrCache(ctx, blockID, tenantID, typeIndex, r.next.Index)
+}
+
+func (r *reader) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return r.next.Object(ctx, blockID, tenantID, start, buffer)
+}
+
+// ReadRange caches the pages of paged indexes and the shards of sharded blooms by their offset and length.
+// Ranges of the data object are read through like Object.
+func (r *reader) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	if name != backend.BloomName && name != backend.IndexName {
+		return r.next.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	}
+
+	b, err := r.readOrCacheKey(ctx, rangeKey(blockID, tenantID, name, start, len(buffer)), name, func(ctx context.Context) ([]byte, error) {
+		// buffer belongs to the caller so the cache keeps its own copy
+		err := r.next.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), buffer...), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	copy(buffer, b)
+	return nil
+}
+
+func (r *reader) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return r.next.TenantIndex(ctx, tenantID)
+}
+
+func (r *reader) Shutdown() {
+	r.next.Shutdown()
+}
+
+func (r *reader) readOrCache(ctx context.Context, blockID uuid.UUID, tenantID string, t string, miss missFunc) ([]byte, error) {
+	return r.readOrCacheKey(ctx, key(blockID, tenantID, t), t, func(ctx context.Context) ([]byte, error) {
+		return miss(ctx, blockID, tenantID)
+	})
+}
+
+func (r *reader) readOrCacheKey(ctx context.Context, k string, t string, miss func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if b, ok := r.get(k); ok {
+		metricMemoryCache.WithLabelValues(t, "hit").Inc()
+		return b, nil
+	}
+	metricMemoryCache.WithLabelValues(t, "miss").Inc()
+
+	b, err := miss(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.put(k, b)
+	return b, nil
+}
+
+func (r *reader) get(k string) ([]byte, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	e, ok := r.entries[k]
+	if !ok {
+		return nil, false
+	}
+
+	r.lru.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+func (r *reader) put(k string, b []byte) {
+	if len(b) > r.maxBytes {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if e, ok := r.entries[k]; ok {
+		r.remove(e)
+	}
+
+	r.entries[k] = r.lru.PushFront(&entry{
+		key:   k,
+		value: b,
+	})
+	r.bytes += len(b)
+
+	for r.bytes > r.maxBytes {
+		r.remove(r.lru.Back())
+	}
+
+	metricMemoryCacheBytes.Set(float64(r.bytes))
+}
+
+func (r *reader) remove(e *list.Element) {
+	entry := r.lru.Remove(e).(*entry)
+	delete(r.entries, entry.key)
+	r.bytes -= len(entry.value)
+}
+
+func key(blockID uuid.UUID, tenantID string, t string) string {
+	return blockID.String() + ":" + tenantID + ":" + t
+}
+
+// rangeKey is the key of part of a bloom or index read with ReadRange
+func rangeKey(blockID uuid.UUID, tenantID string, name string, start uint64, length int) string {
+	return key(blockID, tenantID, name) + ":" + strconv.FormatUint(start, 10) + ":" + strconv.Itoa(length)
+}
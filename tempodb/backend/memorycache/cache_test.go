@@ -0,0 +1,145 @@
+package memorycache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockReader struct {
+	reads int
+	err   error
+}
+
+func (m *mockReader) Tenants(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+func (m *mockReader) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return nil, nil
+}
+func (m *mockReader) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return nil, nil
+}
+func (m *mockReader) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	m.reads++
+	return []byte("bloom"), m.err
+}
+func (m *mockReader) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	m.reads++
+	return []byte("index-" + blockID.String()), m.err
+}
+func (m *mockReader) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return nil
+}
+func (m *mockReader) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	m.reads++
+	copy(buffer, name)
+	return m.err
+}
+func (m *mockReader) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return nil, backend.ErrIndexDoesNotExist
+}
+func (m *mockReader) Shutdown() {}
+
+func TestReadThrough(t *testing.T) {
+	next := &mockReader{}
+	r, err := New(next, &Config{MaxBytes: 1000}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	blockID := uuid.New()
+	for i := 0; i < 3; i++ {
+		bloom, err := r.Bloom(ctx, blockID, "test")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("bloom"), bloom)
+
+		index, err := r.Index(ctx, blockID, "test")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("index-"+blockID.String()), index)
+	}
+	assert.Equal(t, 2, next.reads)
+
+	// errors aren't cached
+	next.err = errors.New("unavailable")
+	_, err = r.Bloom(ctx, uuid.New(), "test")
+	assert.Error(t, err)
+	_, err = r.Bloom(ctx, uuid.New(), "test")
+	assert.Error(t, err)
+	assert.Equal(t, 4, next.reads)
+}
+
+func TestReadRange(t *testing.T) {
+	next := &mockReader{}
+	r, err := New(next, &Config{MaxBytes: 1000}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	blockID := uuid.New()
+	for i := 0; i < 3; i++ {
+		for _, name := range []string{backend.IndexName, backend.BloomName} {
+			buffer := make([]byte, 5)
+			require.NoError(t, r.ReadRange(ctx, name, blockID, "test", 10, buffer))
+			assert.Equal(t, []byte(name), buffer)
+		}
+	}
+	assert.Equal(t, 2, next.reads)
+
+	// the cached copy isn't the caller's buffer
+	buffer := make([]byte, 5)
+	require.NoError(t, r.ReadRange(ctx, backend.IndexName, blockID, "test", 10, buffer))
+	buffer[0] = 'x'
+	require.NoError(t, r.ReadRange(ctx, backend.IndexName, blockID, "test", 10, buffer))
+	assert.Equal(t, []byte("index"), buffer)
+
+	// another page of the index is a separate entry
+	require.NoError(t, r.ReadRange(ctx, backend.IndexName, blockID, "test", 15, buffer))
+	assert.Equal(t, 3, next.reads)
+
+	// ranges of the data object are read through
+	for i := 0; i < 2; i++ {
+		require.NoError(t, r.ReadRange(ctx, backend.ObjectName, blockID, "test", 0, make([]byte, 4)))
+	}
+	assert.Equal(t, 5, next.reads)
+}
+
+func TestEviction(t *testing.T) {
+	// room for two of the 42 byte indexes
+	next := &mockReader{}
+	r, err := New(next, &Config{MaxBytes: 100}, log.NewNopLogger())
+	require.NoError(t, err)
+	c := r.(*reader)
+
+	ctx := context.Background()
+	blocks := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for _, b := range blocks[:2] {
+		_, err = r.Index(ctx, b, "test")
+		require.NoError(t, err)
+	}
+	// touch the first so the second is least recently used
+	_, err = r.Index(ctx, blocks[0], "test")
+	require.NoError(t, err)
+	_, err = r.Index(ctx, blocks[2], "test")
+	require.NoError(t, err)
+
+	assert.Contains(t, c.entries, key(blocks[0], "test", typeIndex))
+	assert.NotContains(t, c.entries, key(blocks[1], "test", typeIndex))
+	assert.Contains(t, c.entries, key(blocks[2], "test", typeIndex))
+	assert.Equal(t, 84, c.bytes)
+
+	// too large to cache at all
+	r, err = New(next, &Config{MaxBytes: 10}, log.NewNopLogger())
+	require.NoError(t, err)
+	_, err = r.Index(ctx, blocks[0], "test")
+	require.NoError(t, err)
+	assert.Len(t, r.(*reader).entries, 0)
+
+	_, err = New(next, &Config{}, log.NewNopLogger())
+	assert.Error(t, err)
+}
@@ -0,0 +1,6 @@
+package memorycache
+
+type Config struct {
+	// MaxBytes caps the size of the cached blooms and indexes
+	MaxBytes int `yaml:"max_bytes"`
+}
@@ -0,0 +1,382 @@
+package mirror
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	opCopy    = "copy"
+	opCompact = "compact"
+	opClear   = "clear"
+
+	defaultConcurrency = 4
+	defaultQueueDepth  = 1000
+)
+
+var (
+	metricQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "mirror_queue_length",
+		Help:      "Number of writes waiting to be replicated to the mirror.",
+	})
+	metricReplicationLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "mirror_replication_lag_seconds",
+		Help:      "Time from a write to the primary backend until it was replicated to the mirror.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 4, 8),
+	})
+	metricReplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "mirror_replicated_total",
+		Help:      "Total number of writes replicated to the mirror.",
+	}, []string{"op"})
+	metricReplicationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "mirror_replication_failures_total",
+		Help:      "Total number of writes that failed to be replicated to the mirror.",
+	}, []string{"op"})
+	metricReplicationDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "mirror_replication_dropped_total",
+		Help:      "Total number of writes not replicated because the queue was full.  They are replicated by the next reconciliation.",
+	}, []string{"op"})
+	metricMissingBlocks = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "mirror_missing_blocks",
+		Help:      "Number of blocks missing from the mirror when the tenant was last reconciled.",
+	}, []string{"tenant"})
+)
+
+type Config struct {
+	// Concurrency is the number of writes replicated to the mirror at once.  Defaults to 4.
+	Concurrency int `yaml:"concurrency"`
+	// QueueDepth is the number of writes waiting to be replicated.  Writes beyond it are left to the next
+	// reconciliation.  Defaults to 1000.
+	QueueDepth int `yaml:"queue_depth"`
+}
+
+type op struct {
+	kind     string
+	blockID  uuid.UUID
+	tenantID string
+	queued   time.Time
+}
+
+// ReaderWriter writes to the primary backend and replicates every block written, compacted or cleared to the
+// mirror backend in the background.  Reads are only served by the primary backend.
+type ReaderWriter struct {
+	logger log.Logger
+
+	nextReader    backend.Reader
+	nextWriter    backend.Writer
+	nextCompactor backend.Compactor
+
+	mirrorReader    backend.Reader
+	mirrorWriter    backend.Writer
+	mirrorCompactor backend.Compactor
+
+	queue    chan op
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New starts the workers that replicate to the mirror.  They are stopped by Shutdown.
+func New(nextReader backend.Reader, nextWriter backend.Writer, nextCompactor backend.Compactor, mirrorReader backend.Reader, mirrorWriter backend.Writer, mirrorCompactor backend.Compactor, cfg *Config, logger log.Logger) *ReaderWriter {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	if cfg.QueueDepth <= 0 {
+		cfg.QueueDepth = defaultQueueDepth
+	}
+
+	rw := &ReaderWriter{
+		logger:          logger,
+		nextReader:      nextReader,
+		nextWriter:      nextWriter,
+		nextCompactor:   nextCompactor,
+		mirrorReader:    mirrorReader,
+		mirrorWriter:    mirrorWriter,
+		mirrorCompactor: mirrorCompactor,
+		queue:           make(chan op, cfg.QueueDepth),
+		stop:            make(chan struct{}),
+	}
+
+	rw.wg.Add(cfg.Concurrency)
+	for i := 0; i < cfg.Concurrency; i++ {
+		go rw.worker()
+	}
+
+	return rw
+}
+
+// Reader
+func (rw *ReaderWriter) Tenants(ctx context.Context) ([]string, error) {
+	return rw.nextReader.Tenants(ctx)
+}
+
+func (rw *ReaderWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return rw.nextReader.Blocks(ctx, tenantID)
+}
+
+func (rw *ReaderWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+}
+
+func (rw *ReaderWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.nextReader.Bloom(ctx, blockID, tenantID)
+}
+
+func (rw *ReaderWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.nextReader.Index(ctx, blockID, tenantID)
+}
+
+func (rw *ReaderWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.nextReader.Object(ctx, blockID, tenantID, start, buffer)
+}
+
+func (rw *ReaderWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+}
+
+func (rw *ReaderWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return rw.nextReader.TenantIndex(ctx, tenantID)
+}
+
+// Shutdown stops replicating.  Writes still queued are left to the next reconciliation.
+func (rw *ReaderWriter) Shutdown() {
+	rw.stopOnce.Do(func() { close(rw.stop) })
+	rw.wg.Wait()
+
+	rw.nextReader.Shutdown()
+	rw.mirrorReader.Shutdown()
+}
+
+// Writer
+func (rw *ReaderWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	err := rw.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	if err == nil {
+		rw.enqueue(opCopy, meta.BlockID, meta.TenantID)
+	}
+	return err
+}
+
+func (rw *ReaderWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	err := rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	if err == nil {
+		rw.enqueue(opCopy, meta.BlockID, meta.TenantID)
+	}
+	return err
+}
+
+func (rw *ReaderWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return rw.nextWriter.AppendObject(ctx, tracker, meta, bObject)
+}
+
+// WriteTenantIndex is not replicated.  The mirror's index is built by whichever compactors run against it.
+func (rw *ReaderWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return rw.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+}
+
+// Compactor
+func (rw *ReaderWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	err := rw.nextCompactor.MarkBlockCompacted(blockID, tenantID)
+	if err == nil {
+		rw.enqueue(opCompact, blockID, tenantID)
+	}
+	return err
+}
+
+func (rw *ReaderWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	err := rw.nextCompactor.ClearBlock(blockID, tenantID)
+	if err == nil {
+		rw.enqueue(opClear, blockID, tenantID)
+	}
+	return err
+}
+
+func (rw *ReaderWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	err := rw.nextCompactor.ClearBlocks(blockIDs, tenantID)
+	if err == nil {
+		for _, blockID := range blockIDs {
+			rw.enqueue(opClear, blockID, tenantID)
+		}
+	}
+	return err
+}
+
+func (rw *ReaderWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+}
+
+// Reconcile replicates whatever the queue missed for a tenant: blocks dropped, failed or written while the
+// process was down are copied, and blocks compacted or cleared in the primary backend are compacted or cleared
+// in the mirror.  blocklist and compactedBlocklist are the tenant's blocks in the primary backend.  Blocks only
+// in the mirror are never cleared unless they are compacted there, so an emptied primary can't empty the mirror.
+func (rw *ReaderWriter) Reconcile(ctx context.Context, tenantID string, blocklist []*encoding.BlockMeta, compactedBlocklist []*encoding.CompactedBlockMeta) error {
+	mirrored, err := rw.mirrorReader.Blocks(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[uuid.UUID]struct{}, len(blocklist)+len(compactedBlocklist))
+	missing := 0
+	for _, b := range blocklist {
+		known[b.BlockID] = struct{}{}
+
+		ok, err := rw.inMirror(ctx, b.BlockID, tenantID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+
+		missing++
+		rw.record(op{kind: opCopy, blockID: b.BlockID, tenantID: tenantID}, rw.copyBlock(ctx, b.BlockID, tenantID))
+	}
+	metricMissingBlocks.WithLabelValues(tenantID).Set(float64(missing))
+
+	for _, b := range compactedBlocklist {
+		known[b.BlockID] = struct{}{}
+		rw.record(op{kind: opCompact, blockID: b.BlockID, tenantID: tenantID}, rw.compactBlock(ctx, b.BlockID, tenantID))
+	}
+
+	for _, blockID := range mirrored {
+		if _, ok := known[blockID]; ok {
+			continue
+		}
+
+		_, err := rw.mirrorCompactor.CompactedBlockMeta(blockID, tenantID)
+		if err == backend.ErrMetaDoesNotExist {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rw.record(op{kind: opClear, blockID: blockID, tenantID: tenantID}, rw.mirrorCompactor.ClearBlock(blockID, tenantID))
+	}
+
+	return nil
+}
+
+func (rw *ReaderWriter) enqueue(kind string, blockID uuid.UUID, tenantID string) {
+	o := op{
+		kind:     kind,
+		blockID:  blockID,
+		tenantID: tenantID,
+		queued:   time.Now(),
+	}
+
+	select {
+	case rw.queue <- o:
+		metricQueueLength.Inc()
+	default:
+		level.Warn(rw.logger).Log("msg", "mirror queue full.  leaving write to reconciliation", "op", kind, "blockID", blockID, "tenantID", tenantID)
+		metricReplicationDropped.WithLabelValues(kind).Inc()
+	}
+}
+
+func (rw *ReaderWriter) worker() {
+	defer rw.wg.Done()
+
+	for {
+		select {
+		case <-rw.stop:
+			return
+		case o := <-rw.queue:
+			metricQueueLength.Dec()
+			rw.record(o, rw.replicate(context.Background(), o))
+		}
+	}
+}
+
+// replicate applies a write to the mirror.  writes to the same block may be replicated out of order, e.g. a
+// block compacted while it's being copied ends up live in the mirror.  reconciliation corrects these.
+func (rw *ReaderWriter) replicate(ctx context.Context, o op) error {
+	switch o.kind {
+	case opCopy:
+		return rw.copyBlock(ctx, o.blockID, o.tenantID)
+	case opCompact:
+		return rw.compactBlock(ctx, o.blockID, o.tenantID)
+	case opClear:
+		return rw.mirrorCompactor.ClearBlock(o.blockID, o.tenantID)
+	}
+	return nil
+}
+
+func (rw *ReaderWriter) record(o op, err error) {
+	if err != nil {
+		level.Error(rw.logger).Log("msg", "failed to replicate to mirror", "op", o.kind, "blockID", o.blockID, "tenantID", o.tenantID, "err", err)
+		metricReplicationFailures.WithLabelValues(o.kind).Inc()
+		return
+	}
+
+	metricReplicated.WithLabelValues(o.kind).Inc()
+	if !o.queued.IsZero() {
+		metricReplicationLag.Observe(time.Since(o.queued).Seconds())
+	}
+}
+
+// copyBlock copies a block from the primary backend unless it has been compacted since it was written or the
+// mirror already has it.
+func (rw *ReaderWriter) copyBlock(ctx context.Context, blockID uuid.UUID, tenantID string) error {
+	meta, err := rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+	if err == backend.ErrMetaDoesNotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := rw.inMirror(ctx, blockID, tenantID)
+	if err != nil || ok {
+		return err
+	}
+
+	// the mirror is a single backend whatever tier the block is in here
+	meta.Tier = ""
+	return backend.CopyBlock(ctx, rw.nextReader, rw.mirrorWriter, meta)
+}
+
+// compactBlock marks a block compacted in the mirror if it's live there
+func (rw *ReaderWriter) compactBlock(ctx context.Context, blockID uuid.UUID, tenantID string) error {
+	_, err := rw.mirrorReader.BlockMeta(ctx, blockID, tenantID)
+	if err == backend.ErrMetaDoesNotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return rw.mirrorCompactor.MarkBlockCompacted(blockID, tenantID)
+}
+
+// inMirror returns true if the block is live or compacted in the mirror
+func (rw *ReaderWriter) inMirror(ctx context.Context, blockID uuid.UUID, tenantID string) (bool, error) {
+	_, err := rw.mirrorReader.BlockMeta(ctx, blockID, tenantID)
+	if err == nil {
+		return true, nil
+	}
+	if err != backend.ErrMetaDoesNotExist {
+		return false, err
+	}
+
+	_, err = rw.mirrorCompactor.CompactedBlockMeta(blockID, tenantID)
+	if err == nil {
+		return true, nil
+	}
+	if err != backend.ErrMetaDoesNotExist {
+		return false, err
+	}
+	return false, nil
+}
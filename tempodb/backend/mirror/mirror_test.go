@@ -0,0 +1,132 @@
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backends struct {
+	primaryR backend.Reader
+	primaryW backend.Writer
+	primaryC backend.Compactor
+	mirrorR  backend.Reader
+	mirrorW  backend.Writer
+	mirrorC  backend.Compactor
+}
+
+func newBackends(t *testing.T, dir string) *backends {
+	bs := &backends{}
+	var err error
+	bs.primaryR, bs.primaryW, bs.primaryC, err = local.New(&local.Config{Path: path.Join(dir, "primary")})
+	require.NoError(t, err)
+	bs.mirrorR, bs.mirrorW, bs.mirrorC, err = local.New(&local.Config{Path: path.Join(dir, "mirror")})
+	require.NoError(t, err)
+	return bs
+}
+
+func (bs *backends) new() *ReaderWriter {
+	return New(bs.primaryR, bs.primaryW, bs.primaryC, bs.mirrorR, bs.mirrorW, bs.mirrorC, &Config{}, log.NewNopLogger())
+}
+
+func writeBlock(t *testing.T, dir string, w backend.Writer, object []byte) *encoding.BlockMeta {
+	objectFile := path.Join(dir, "object")
+	require.NoError(t, ioutil.WriteFile(objectFile, object, 0644))
+
+	meta := encoding.NewBlockMeta("tenant", uuid.New())
+	meta.Size = uint64(len(object))
+	require.NoError(t, w.Write(context.Background(), meta, []byte("bloom"), []byte("index"), objectFile))
+	return meta
+}
+
+func TestReplicate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	bs := newBackends(t, tempDir)
+	rw := bs.new()
+	defer rw.Shutdown()
+	ctx := context.Background()
+
+	object := []byte("object")
+	meta := writeBlock(t, tempDir, rw, object)
+
+	assert.Eventually(t, func() bool {
+		_, err := bs.mirrorR.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	actualObject := make([]byte, len(object))
+	require.NoError(t, bs.mirrorR.ReadRange(ctx, backend.ObjectName, meta.BlockID, meta.TenantID, 0, actualObject))
+	assert.Equal(t, object, actualObject)
+	actualBloom, err := bs.mirrorR.Bloom(ctx, meta.BlockID, meta.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bloom"), actualBloom)
+
+	require.NoError(t, rw.MarkBlockCompacted(meta.BlockID, meta.TenantID))
+	assert.Eventually(t, func() bool {
+		_, err := bs.mirrorC.CompactedBlockMeta(meta.BlockID, meta.TenantID)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, rw.ClearBlock(meta.BlockID, meta.TenantID))
+	assert.Eventually(t, func() bool {
+		blocks, err := bs.mirrorR.Blocks(ctx, meta.TenantID)
+		return err == nil && len(blocks) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReconcile(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	bs := newBackends(t, tempDir)
+	rw := bs.new()
+	defer rw.Shutdown()
+	ctx := context.Background()
+
+	// written while the mirror wasn't replicating
+	missing := writeBlock(t, tempDir, bs.primaryW, []byte("missing"))
+
+	// compacted in the primary only
+	compacted := writeBlock(t, tempDir, bs.primaryW, []byte("compacted"))
+	require.NoError(t, backend.CopyBlock(ctx, bs.primaryR, bs.mirrorW, compacted))
+	require.NoError(t, bs.primaryC.MarkBlockCompacted(compacted.BlockID, compacted.TenantID))
+	compactedMeta, err := bs.primaryC.CompactedBlockMeta(compacted.BlockID, compacted.TenantID)
+	require.NoError(t, err)
+
+	// cleared in the primary after it was compacted in both
+	cleared := writeBlock(t, tempDir, bs.mirrorW, []byte("cleared"))
+	require.NoError(t, bs.mirrorC.MarkBlockCompacted(cleared.BlockID, cleared.TenantID))
+
+	// only in the mirror, e.g. because the primary was lost
+	orphaned := writeBlock(t, tempDir, bs.mirrorW, []byte("orphaned"))
+
+	missingMeta, err := bs.primaryR.BlockMeta(ctx, missing.BlockID, missing.TenantID)
+	require.NoError(t, err)
+	require.NoError(t, rw.Reconcile(ctx, "tenant", []*encoding.BlockMeta{missingMeta}, []*encoding.CompactedBlockMeta{compactedMeta}))
+
+	_, err = bs.mirrorR.BlockMeta(ctx, missing.BlockID, missing.TenantID)
+	assert.NoError(t, err)
+
+	_, err = bs.mirrorC.CompactedBlockMeta(compacted.BlockID, compacted.TenantID)
+	assert.NoError(t, err)
+
+	blocks, err := bs.mirrorR.Blocks(ctx, "tenant")
+	require.NoError(t, err)
+	assert.NotContains(t, blocks, cleared.BlockID)
+	assert.Contains(t, blocks, orphaned.BlockID)
+}
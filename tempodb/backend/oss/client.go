@@ -0,0 +1,397 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // oss signs requests with hmac-sha1
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/tempo/tempodb/backend/transport"
+)
+
+const (
+	errCodeNoSuchKey = "NoSuchKey"
+
+	listMaxKeys = 1000
+)
+
+// ossError is the error document oss returns for failed requests
+type ossError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *ossError) Error() string {
+	return fmt.Sprintf("oss error %d %s: %s (request id %s)", e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+func isNoSuchKey(err error) bool {
+	ossErr, ok := err.(*ossError)
+	return ok && ossErr.Code == errCodeNoSuchKey
+}
+
+// client is a minimal client of the oss rest api.  it implements the handful of calls the backend needs.
+type client struct {
+	baseURL         *url.URL
+	bucket          string
+	accessKeyID     string
+	accessKeySecret string
+	http            *http.Client
+	now             func() time.Time
+}
+
+func newClient(cfg *Config) (*client, error) {
+	scheme := "https"
+	if cfg.Insecure {
+		scheme = "http"
+	}
+
+	endpoint := cfg.Endpoint
+	if cfg.Internal {
+		endpoint = internalEndpoint(endpoint)
+	}
+
+	// buckets are addressed virtual host style
+	tr, err := transport.New(cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(fmt.Sprintf("%s://%s.%s", scheme, cfg.Bucket, endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		baseURL:         u,
+		bucket:          cfg.Bucket,
+		accessKeyID:     cfg.AccessKeyID,
+		accessKeySecret: cfg.AccessKeySecret,
+		http:            &http.Client{Transport: tr},
+		now:             time.Now,
+	}, nil
+}
+
+// internalEndpoint turns oss-cn-hangzhou.aliyuncs.com into oss-cn-hangzhou-internal.aliyuncs.com
+func internalEndpoint(endpoint string) string {
+	parts := strings.SplitN(endpoint, ".", 2)
+	if len(parts) != 2 || strings.HasSuffix(parts[0], "-internal") {
+		return endpoint
+	}
+	return parts[0] + "-internal." + parts[1]
+}
+
+// request describes a call to the api.  subresources are signed, params are not.
+type request struct {
+	method       string
+	object       string
+	subresources url.Values
+	params       url.Values
+	header       http.Header
+	body         io.Reader
+	length       int64
+}
+
+func (c *client) do(ctx context.Context, r *request) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path = "/" + r.object
+
+	query := make([]string, 0, 2)
+	if params := r.params.Encode(); params != "" {
+		query = append(query, params)
+	}
+	if len(r.subresources) > 0 {
+		query = append(query, encodeSubresources(r.subresources, url.QueryEscape))
+	}
+	u.RawQuery = strings.Join(query, "&")
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), r.body)
+	if err != nil {
+		return nil, err
+	}
+	if r.header != nil {
+		req.Header = r.header
+	}
+	if r.body != nil {
+		req.ContentLength = r.length
+	}
+	req.Header.Set("Date", c.now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Authorization", "OSS "+c.accessKeyID+":"+c.signature(req, r))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		ossErr := &ossError{StatusCode: resp.StatusCode}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = xml.Unmarshal(body, ossErr)
+		return nil, ossErr
+	}
+
+	return resp, nil
+}
+
+// encodeSubresources writes subresources sorted by key with their values escaped by escape.  value-less
+// subresources such as uploads are written without an =, which is how oss expects them both in the
+// url and in the signed resource.
+func encodeSubresources(subresources url.Values, escape func(string) string) string {
+	keys := make([]string, 0, len(subresources))
+	for k := range subresources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sub := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if v := subresources.Get(k); v != "" {
+			sub = append(sub, escape(k)+"="+escape(v))
+		} else {
+			sub = append(sub, escape(k))
+		}
+	}
+	return strings.Join(sub, "&")
+}
+
+// signature implements oss's header signature:
+//
+//	base64(hmac-sha1(secret, VERB\nContent-MD5\nContent-Type\nDate\nCanonicalizedOSSHeaders+CanonicalizedResource))
+func (c *client) signature(req *http.Request, r *request) string {
+	var ossHeaders []string
+	for k := range req.Header {
+		lower := strings.ToLower(k)
+		if strings.HasPrefix(lower, "x-oss-") {
+			ossHeaders = append(ossHeaders, lower+":"+req.Header.Get(k)+"\n")
+		}
+	}
+	sort.Strings(ossHeaders)
+
+	resource := "/" + c.bucket + "/" + r.object
+	if len(r.subresources) > 0 {
+		resource += "?" + encodeSubresources(r.subresources, func(s string) string { return s })
+	}
+
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		req.Header.Get("Date"),
+		strings.Join(ossHeaders, "") + resource,
+	}, "\n")
+
+	h := hmac.New(sha1.New, []byte(c.accessKeySecret))
+	_, _ = h.Write([]byte(toSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (c *client) putObject(ctx context.Context, name string, body io.Reader, length int64) error {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		object: name,
+		body:   body,
+		length: length,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) putObjectBytes(ctx context.Context, name string, b []byte) error {
+	return c.putObject(ctx, name, bytes.NewReader(b), int64(len(b)))
+}
+
+// getObject returns the object and its last modified time.  length 0 reads to the end.
+func (c *client) getObject(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, time.Time, error) {
+	header := http.Header{}
+	if offset > 0 || length > 0 {
+		rng := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			rng += fmt.Sprintf("%d", offset+length-1)
+		}
+		header.Set("Range", rng)
+	}
+
+	resp, err := c.do(ctx, &request{
+		method: http.MethodGet,
+		object: name,
+		header: header,
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, modTime, nil
+}
+
+func (c *client) copyObject(ctx context.Context, src string, dst string) error {
+	header := http.Header{}
+	header.Set("x-oss-copy-source", "/"+c.bucket+"/"+src)
+
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		object: dst,
+		header: header,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) deleteObject(ctx context.Context, name string) error {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodDelete,
+		object: name,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type listResult struct {
+	IsTruncated bool   `xml:"IsTruncated"`
+	NextMarker  string `xml:"NextMarker"`
+	Contents    []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list returns the keys and common prefixes below prefix.  every page is read; the listing is only
+// complete once oss stops reporting it truncated.
+func (c *client) list(ctx context.Context, prefix string, delimiter string) (keys []string, prefixes []string, err error) {
+	marker := ""
+	for {
+		params := url.Values{}
+		params.Set("prefix", prefix)
+		params.Set("marker", marker)
+		params.Set("max-keys", fmt.Sprintf("%d", listMaxKeys))
+		if delimiter != "" {
+			params.Set("delimiter", delimiter)
+		}
+
+		resp, err := c.do(ctx, &request{
+			method: http.MethodGet,
+			params: params,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res := &listResult{}
+		err = decodeXML(resp, res)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, o := range res.Contents {
+			keys = append(keys, o.Key)
+		}
+		for _, p := range res.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+
+		if !res.IsTruncated {
+			return keys, prefixes, nil
+		}
+		if res.NextMarker == "" || res.NextMarker == marker {
+			return nil, nil, fmt.Errorf("oss listing of %s is truncated but has no next marker", prefix)
+		}
+		marker = res.NextMarker
+	}
+}
+
+type part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *client) initiateMultipartUpload(ctx context.Context, name string) (string, error) {
+	resp, err := c.do(ctx, &request{
+		method:       http.MethodPost,
+		object:       name,
+		subresources: url.Values{"uploads": []string{""}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res := &struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	err = decodeXML(resp, res)
+	if err != nil {
+		return "", err
+	}
+	return res.UploadID, nil
+}
+
+func (c *client) uploadPart(ctx context.Context, name string, uploadID string, partNumber int, b []byte) (part, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		object: name,
+		subresources: url.Values{
+			"partNumber": []string{fmt.Sprintf("%d", partNumber)},
+			"uploadId":   []string{uploadID},
+		},
+		body:   bytes.NewReader(b),
+		length: int64(len(b)),
+	})
+	if err != nil {
+		return part{}, err
+	}
+	defer resp.Body.Close()
+
+	return part{
+		PartNumber: partNumber,
+		ETag:       resp.Header.Get("ETag"),
+	}, nil
+}
+
+func (c *client) completeMultipartUpload(ctx context.Context, name string, uploadID string, parts []part) error {
+	body, err := xml.Marshal(&struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{
+		Parts: parts,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, &request{
+		method:       http.MethodPost,
+		object:       name,
+		subresources: url.Values{"uploadId": []string{uploadID}},
+		body:         bytes.NewReader(body),
+		length:       int64(len(body)),
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func decodeXML(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,94 @@
+package oss
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	ctx := context.TODO()
+
+	// copy meta.json to meta.compacted.json
+	metaFileName := util.MetaFileName(blockID, tenantID)
+	err := rw.client.copyObject(ctx, metaFileName, util.CompactedMetaFileName(blockID, tenantID))
+	if err != nil {
+		return errors.Wrap(err, "error copying obj meta to compacted obj meta")
+	}
+
+	// delete meta.json
+	return rw.client.deleteObject(ctx, metaFileName)
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	ctx := context.TODO()
+
+	prefix := util.BlockFileName(blockID, tenantID)
+	level.Debug(rw.logger).Log("msg", "deleting block", "block path", prefix)
+
+	keys, _, err := rw.client.list(ctx, prefix, "")
+	if err != nil {
+		return errors.Wrapf(err, "error listing block in oss: %s", prefix)
+	}
+
+	for _, key := range keys {
+		err = rw.client.deleteObject(ctx, key)
+		if err != nil {
+			return errors.Wrapf(err, "error deleting obj from oss: %s", key)
+		}
+	}
+
+	return nil
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return backend.ClearBlocks(rw, blockIDs, tenantID)
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	if len(tenantID) == 0 {
+		return nil, backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return nil, backend.ErrEmptyBlockID
+	}
+
+	compactedMetaFileName := util.CompactedMetaFileName(blockID, tenantID)
+	bytes, modTime, err := rw.readAll(context.TODO(), compactedMetaFileName)
+	if isNoSuchKey(err) {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching compacted meta file %s", compactedMetaFileName)
+	}
+
+	out := &encoding.CompactedBlockMeta{}
+	err = json.Unmarshal(bytes, out)
+	if err != nil {
+		return nil, err
+	}
+	out.CompactedTime = modTime
+
+	return out, nil
+}
@@ -0,0 +1,22 @@
+package oss
+
+import "github.com/grafana/tempo/tempodb/backend/transport"
+
+type Config struct {
+	// Endpoint is the region's endpoint, e.g. oss-cn-hangzhou.aliyuncs.com
+	Endpoint string `yaml:"endpoint"`
+	// Internal uses the region's internal endpoint so traffic from ECS stays on the internal network and
+	// is free, e.g. oss-cn-hangzhou-internal.aliyuncs.com
+	Internal bool   `yaml:"internal"`
+	Bucket   string `yaml:"bucket"`
+	Insecure bool   `yaml:"insecure"`
+
+	AccessKeyID     string `yaml:"access_key_id"`
+	AccessKeySecret string `yaml:"access_key_secret"`
+
+	// PartSize is the size of the parts blocks are uploaded in.  Blocks smaller than this are uploaded
+	// with a single request.
+	PartSize int64 `yaml:"part_size"`
+
+	Transport transport.Config `yaml:"transport"`
+}
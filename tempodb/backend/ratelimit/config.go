@@ -0,0 +1,12 @@
+package ratelimit
+
+type Config struct {
+	// requests per second allowed to the backend for each kind of operation.  0 is unlimited.
+	// reads are blooms, indexes, objects and metas.  writes include marking blocks compacted and clearing
+	// them.  lists are the tenant and block listings of the blocklist poll.
+	ReadsPerSecond  float64 `yaml:"reads_per_second"`
+	WritesPerSecond float64 `yaml:"writes_per_second"`
+	ListsPerSecond  float64 `yaml:"lists_per_second"`
+	// Burst is the number of requests of each kind that may be made at once above the rate.  Defaults to 1.
+	Burst int `yaml:"burst"`
+}
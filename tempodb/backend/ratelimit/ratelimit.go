@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+const (
+	kindRead  = "read"
+	kindWrite = "write"
+	kindList  = "list"
+)
+
+var metricWaitSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "tempodb",
+	Name:      "backend_rate_limit_wait_seconds_total",
+	Help:      "Total time backend operations waited for the rate limiter.",
+}, []string{"kind"})
+
+type readerWriter struct {
+	reads  *rate.Limiter
+	writes *rate.Limiter
+	lists  *rate.Limiter
+
+	nextReader    backend.Reader
+	nextWriter    backend.Writer
+	nextCompactor backend.Compactor
+}
+
+// New limits the rate of requests to the backend so compaction and polling stay within the provider's
+// request quotas.  Operations wait for their turn.  One whose context is cancelled while waiting fails with
+// the context's error.
+func New(r backend.Reader, w backend.Writer, c backend.Compactor, cfg *Config) (backend.Reader, backend.Writer, backend.Compactor) {
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	rw := &readerWriter{
+		reads:         newLimiter(cfg.ReadsPerSecond, burst),
+		writes:        newLimiter(cfg.WritesPerSecond, burst),
+		lists:         newLimiter(cfg.ListsPerSecond, burst),
+		nextReader:    r,
+		nextWriter:    w,
+		nextCompactor: c,
+	}
+	return rw, rw, rw
+}
+
+// Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	if err := rw.wait(ctx, kindList); err != nil {
+		return nil, err
+	}
+	return rw.nextReader.Tenants(ctx)
+}
+
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	if err := rw.wait(ctx, kindList); err != nil {
+		return nil, err
+	}
+	return rw.nextReader.Blocks(ctx, tenantID)
+}
+
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	if err := rw.wait(ctx, kindRead); err != nil {
+		return nil, err
+	}
+	return rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+}
+
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	if err := rw.wait(ctx, kindRead); err != nil {
+		return nil, err
+	}
+	return rw.nextReader.Bloom(ctx, blockID, tenantID)
+}
+
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	if err := rw.wait(ctx, kindRead); err != nil {
+		return nil, err
+	}
+	return rw.nextReader.Index(ctx, blockID, tenantID)
+}
+
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	if err := rw.wait(ctx, kindRead); err != nil {
+		return err
+	}
+	return rw.nextReader.Object(ctx, blockID, tenantID, start, buffer)
+}
+
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	if err := rw.wait(ctx, kindRead); err != nil {
+		return err
+	}
+	return rw.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	if err := rw.wait(ctx, kindRead); err != nil {
+		return nil, err
+	}
+	return rw.nextReader.TenantIndex(ctx, tenantID)
+}
+
+func (rw *readerWriter) Shutdown() {
+	rw.nextReader.Shutdown()
+}
+
+// Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	if err := rw.wait(ctx, kindWrite); err != nil {
+		return err
+	}
+	return rw.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+}
+
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	if err := rw.wait(ctx, kindWrite); err != nil {
+		return err
+	}
+	return rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+}
+
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	if err := rw.wait(ctx, kindWrite); err != nil {
+		return nil, err
+	}
+	return rw.nextWriter.AppendObject(ctx, tracker, meta, bObject)
+}
+
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	if err := rw.wait(ctx, kindWrite); err != nil {
+		return err
+	}
+	return rw.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+}
+
+// Compactor
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	if err := rw.wait(context.Background(), kindWrite); err != nil {
+		return err
+	}
+	return rw.nextCompactor.MarkBlockCompacted(blockID, tenantID)
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	if err := rw.wait(context.Background(), kindWrite); err != nil {
+		return err
+	}
+	return rw.nextCompactor.ClearBlock(blockID, tenantID)
+}
+
+// ClearBlocks waits for a write per block so backends that clear blocks one at a time stay within the limit
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	for range blockIDs {
+		if err := rw.wait(context.Background(), kindWrite); err != nil {
+			return err
+		}
+	}
+	return rw.nextCompactor.ClearBlocks(blockIDs, tenantID)
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	if err := rw.wait(context.Background(), kindRead); err != nil {
+		return nil, err
+	}
+	return rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+}
+
+func (rw *readerWriter) wait(ctx context.Context, kind string) error {
+	var limiter *rate.Limiter
+	switch kind {
+	case kindRead:
+		limiter = rw.reads
+	case kindWrite:
+		limiter = rw.writes
+	case kindList:
+		limiter = rw.lists
+	}
+	if limiter == nil {
+		return nil
+	}
+
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	metricWaitSeconds.WithLabelValues(kind).Add(time.Since(start).Seconds())
+	return err
+}
+
+// newLimiter returns nil if the rate is unlimited
+func newLimiter(perSecond float64, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBackend struct {
+	calls int
+}
+
+func (m *mockBackend) Tenants(ctx context.Context) ([]string, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) Shutdown() {}
+func (m *mockBackend) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	m.calls++
+	return nil, nil
+}
+func (m *mockBackend) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	m.calls++
+	return nil
+}
+func (m *mockBackend) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	m.calls++
+	return nil, nil
+}
+
+func TestLimits(t *testing.T) {
+	m := &mockBackend{}
+	// one list every 50ms.  reads are unlimited and writes effectively forbidden after the first
+	r, w, _ := New(m, m, m, &Config{ListsPerSecond: 20, WritesPerSecond: 0.001})
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := r.Tenants(ctx)
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(90*time.Millisecond))
+
+	// reads are limited separately
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		_, err := r.Bloom(ctx, uuid.New(), "test")
+		require.NoError(t, err)
+	}
+	assert.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	require.NoError(t, w.WriteTenantIndex(ctx, "test", nil, nil))
+
+	// a write waiting for its turn gives up with its context
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := w.Write(ctx, &encoding.BlockMeta{}, nil, nil, "")
+	assert.Error(t, err)
+	assert.Equal(t, 104, m.calls)
+}
@@ -0,0 +1,100 @@
+package readonly
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+type readerWriter struct {
+	nextReader    backend.Reader
+	nextCompactor backend.Compactor
+}
+
+// New rejects every write and delete with backend.ErrReadOnly so a bucket owned by another install can be
+// queried without changing it.  Reads pass through.
+func New(r backend.Reader, c backend.Compactor) (backend.Reader, backend.Writer, backend.Compactor) {
+	rw := &readerWriter{
+		nextReader:    r,
+		nextCompactor: c,
+	}
+	return rw, rw, rw
+}
+
+// Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	return rw.nextReader.Tenants(ctx)
+}
+
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return rw.nextReader.Blocks(ctx, tenantID)
+}
+
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+}
+
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.nextReader.Bloom(ctx, blockID, tenantID)
+}
+
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.nextReader.Index(ctx, blockID, tenantID)
+}
+
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.nextReader.Object(ctx, blockID, tenantID, start, buffer)
+}
+
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return rw.nextReader.TenantIndex(ctx, tenantID)
+}
+
+func (rw *readerWriter) Shutdown() {
+	rw.nextReader.Shutdown()
+}
+
+// Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return rejected("write block", meta.BlockID, meta.TenantID)
+}
+
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	return rejected("write meta of block", meta.BlockID, meta.TenantID)
+}
+
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return nil, rejected("append to block", meta.BlockID, meta.TenantID)
+}
+
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return fmt.Errorf("can't write index of tenant %s: %w", tenantID, backend.ErrReadOnly)
+}
+
+// Compactor
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return rejected("mark compacted block", blockID, tenantID)
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return rejected("clear block", blockID, tenantID)
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return fmt.Errorf("can't clear %d blocks of tenant %s: %w", len(blockIDs), tenantID, backend.ErrReadOnly)
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+}
+
+func rejected(op string, blockID uuid.UUID, tenantID string) error {
+	return fmt.Errorf("can't %s %s of tenant %s: %w", op, blockID, tenantID, backend.ErrReadOnly)
+}
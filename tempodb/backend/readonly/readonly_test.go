@@ -0,0 +1,58 @@
+package readonly
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	nextR, nextW, nextC, err := local.New(&local.Config{Path: tempDir})
+	require.NoError(t, err)
+	r, w, c := New(nextR, nextC)
+	ctx := context.Background()
+
+	objectFile := path.Join(tempDir, "object")
+	require.NoError(t, ioutil.WriteFile(objectFile, []byte("object"), 0644))
+	meta := encoding.NewBlockMeta("tenant", uuid.New())
+	require.NoError(t, nextW.Write(ctx, meta, []byte("bloom"), []byte("index"), objectFile))
+
+	// reads pass through
+	bloom, err := r.Bloom(ctx, meta.BlockID, meta.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bloom"), bloom)
+
+	// writes and deletes are rejected
+	other := encoding.NewBlockMeta("tenant", uuid.New())
+	_, appendErr := w.AppendObject(ctx, nil, other, []byte("object"))
+	for _, err := range []error{
+		w.Write(ctx, other, []byte("bloom"), []byte("index"), objectFile),
+		w.WriteBlockMeta(ctx, nil, other, []byte("bloom"), []byte("index")),
+		appendErr,
+		w.WriteTenantIndex(ctx, "tenant", nil, nil),
+		c.MarkBlockCompacted(meta.BlockID, meta.TenantID),
+		c.ClearBlock(meta.BlockID, meta.TenantID),
+	} {
+		assert.True(t, errors.Is(err, backend.ErrReadOnly), err)
+	}
+
+	blocks, err := nextR.Blocks(ctx, "tenant")
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{meta.BlockID}, blocks)
+	_, err = nextR.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	assert.NoError(t, err)
+}
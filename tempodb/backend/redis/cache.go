@@ -0,0 +1,229 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/google/uuid"
+)
+
+const (
+	typeBloom = "bloom"
+	typeIndex = "index"
+)
+
+var (
+	metricCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "redis_cache_total",
+		Help:      "Total number of times redis was queried.",
+	}, []string{"type", "status"})
+)
+
+type Config struct {
+	// Endpoint is the host:port of the redis server.  With MasterName it is a comma separated list of
+	// sentinels and with Cluster a comma separated list of cluster nodes the rest of the cluster is discovered
+	// from.
+	Endpoint string `yaml:"endpoint"`
+	// MasterName is the name of the master monitored by the sentinels at Endpoint
+	MasterName string `yaml:"master_name"`
+	// Cluster spreads keys over a redis cluster
+	Cluster bool `yaml:"cluster"`
+	// DB is selected after connecting.  Not supported by redis cluster.
+	DB int `yaml:"db"`
+
+	// Username is the acl user to authenticate as.  Empty authenticates with only the password.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// SentinelPassword authenticates with the sentinels
+	SentinelPassword string `yaml:"sentinel_password"`
+
+	TLSEnabled            bool   `yaml:"tls_enabled"`
+	TLSCAPath             string `yaml:"tls_ca_path"`
+	TLSInsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify"`
+
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxIdleConns int           `yaml:"max_idle_conns"`
+	TTL          time.Duration `yaml:"ttl"`
+
+	// WriteThrough caches the bloom and index of every block written so the first queries of a fresh block don't
+	// all miss and go to the backend at once
+	WriteThrough bool `yaml:"write_through"`
+}
+
+type readerWriter struct {
+	nextReader backend.Reader
+	nextWriter backend.Writer
+	client     cache.Cache
+	logger     log.Logger
+
+	writeThrough bool
+}
+
+func New(nextReader backend.Reader, nextWriter backend.Writer, cfg *Config, logger log.Logger) (backend.Reader, backend.Writer, error) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 100 * time.Millisecond
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = 16
+	}
+
+	client, err := newClient(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rw := &readerWriter{
+		client:     client,
+		nextReader: nextReader,
+		nextWriter: nextWriter,
+		logger:     logger,
+
+		writeThrough: cfg.WriteThrough,
+	}
+
+	return rw, rw, nil
+}
+
+// Reader
+func (r *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	return r.nextReader.Tenants(ctx)
+}
+
+func (r *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return r.nextReader.Blocks(ctx, tenantID)
+}
+
+func (r *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return r.nextReader.BlockMeta(ctx, blockID, tenantID)
+}
+
+func (r *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	key := key(blockID, tenantID, typeBloom)
+	val := r.get(ctx, key, typeBloom)
+	if val != nil {
+		return val, nil
+	}
+
+	val, err := r.nextReader.Bloom(ctx, blockID, tenantID)
+	if err == nil {
+		r.set(ctx, key, val)
+	}
+
+	return val, err
+}
+
+func (r *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	key := key(blockID, tenantID, typeIndex)
+	val := r.get(ctx, key, typeIndex)
+	if val != nil {
+		return val, nil
+	}
+
+	val, err := r.nextReader.Index(ctx, blockID, tenantID)
+	if err == nil {
+		r.set(ctx, key, val)
+	}
+
+	return val, err
+}
+
+func (r *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return r.nextReader.Object(ctx, blockID, tenantID, start, buffer)
+}
+
+// ReadRange caches the pages of paged indexes and the shards of sharded blooms by their offset and length.
+// Ranges of the data object are read through like Object.
+func (r *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	if name != backend.BloomName && name != backend.IndexName {
+		return r.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	}
+
+	key := rangeKey(blockID, tenantID, name, start, len(buffer))
+	val := r.get(ctx, key, name)
+	if len(val) == len(buffer) {
+		copy(buffer, val)
+		return nil
+	}
+
+	err := r.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	if err == nil {
+		r.set(ctx, key, buffer)
+	}
+
+	return err
+}
+
+func (r *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return r.nextReader.TenantIndex(ctx, tenantID)
+}
+
+func (r *readerWriter) Shutdown() {
+	r.nextReader.Shutdown()
+	r.client.Stop()
+}
+
+// Writer
+func (r *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	err := r.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	if err == nil {
+		r.populate(ctx, meta, bBloom, bIndex)
+	}
+	return err
+}
+
+func (r *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	err := r.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	if err == nil {
+		r.populate(ctx, meta, bBloom, bIndex)
+	}
+	return err
+}
+
+func (r *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return r.nextWriter.AppendObject(ctx, tracker, meta, bObject)
+}
+
+func (r *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return r.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+}
+
+// populate caches the bloom and index of a block that was just written
+func (r *readerWriter) populate(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) {
+	if !r.writeThrough {
+		return
+	}
+	r.set(ctx, key(meta.BlockID, meta.TenantID, typeBloom), bBloom)
+	r.set(ctx, key(meta.BlockID, meta.TenantID, typeIndex), bIndex)
+}
+
+func (r *readerWriter) get(ctx context.Context, key string, t string) []byte {
+	found, vals, _ := r.client.Fetch(ctx, []string{key})
+	if len(found) > 0 {
+		metricCache.WithLabelValues(t, "hit").Inc()
+		return vals[0]
+	}
+	metricCache.WithLabelValues(t, "miss").Inc()
+	return nil
+}
+
+func (r *readerWriter) set(ctx context.Context, key string, val []byte) {
+	r.client.Store(ctx, []string{key}, [][]byte{val})
+}
+
+func key(blockID uuid.UUID, tenantID string, t string) string {
+	return blockID.String() + ":" + tenantID + ":" + t
+}
+
+// rangeKey is the key of part of a bloom or index read with ReadRange
+func rangeKey(blockID uuid.UUID, tenantID string, name string, start uint64, length int) string {
+	return key(blockID, tenantID, name) + ":" + strconv.FormatUint(start, 10) + ":" + strconv.Itoa(length)
+}
@@ -0,0 +1,431 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+
+	cfg := &Config{
+		Endpoint: server.Addr(),
+		Username: "tempo",
+		Password: "secret",
+		DB:       2,
+		TTL:      time.Hour,
+
+		WriteThrough: true,
+	}
+	mockR := &mockReader{
+		bloom: []byte{0x01},
+		index: []byte{0x02},
+	}
+	r, w, err := New(mockR, &mockWriter{}, cfg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer r.Shutdown()
+
+	ctx := context.Background()
+	blockID := uuid.New()
+
+	bloom, err := r.Bloom(ctx, blockID, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, bloom)
+	index, err := r.Index(ctx, blockID, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, index)
+
+	// cached
+	mockR.bloom = nil
+	mockR.index = nil
+	bloom, _ = r.Bloom(ctx, blockID, "test")
+	assert.Equal(t, []byte{0x01}, bloom)
+	index, _ = r.Index(ctx, blockID, "test")
+	assert.Equal(t, []byte{0x02}, index)
+
+	// written blocks are cached
+	meta := &encoding.BlockMeta{BlockID: uuid.New(), TenantID: "test"}
+	require.NoError(t, w.WriteBlockMeta(ctx, nil, meta, []byte{0x03}, []byte{0x04}))
+	bloom, _ = r.Bloom(ctx, meta.BlockID, meta.TenantID)
+	assert.Equal(t, []byte{0x03}, bloom)
+
+	assert.Contains(t, server.commands(), "AUTH tempo secret")
+	assert.Contains(t, server.commands(), "SELECT 2")
+	assert.Contains(t, server.commands(), "SET "+key(blockID, "test", typeBloom)+" \x01 EX 3600")
+}
+
+func TestReadRange(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.Close()
+
+	mockR := &mockReader{
+		object: []byte{0x01, 0x02},
+	}
+	r, _, err := New(mockR, &mockWriter{}, &Config{Endpoint: server.Addr()}, log.NewNopLogger())
+	require.NoError(t, err)
+	defer r.Shutdown()
+
+	ctx := context.Background()
+	blockID := uuid.New()
+	for _, name := range []string{backend.IndexName, backend.ObjectName} {
+		buffer := make([]byte, 2)
+		require.NoError(t, r.ReadRange(ctx, name, blockID, "test", 10, buffer))
+		assert.Equal(t, []byte{0x01, 0x02}, buffer)
+	}
+
+	// index pages are cached by offset and length.  ranges of the data object aren't
+	assert.Contains(t, server.commands(), "SET "+rangeKey(blockID, "test", backend.IndexName, 10, 2)+" \x01\x02")
+	assert.NotContains(t, server.commands(), "GET "+rangeKey(blockID, "test", backend.ObjectName, 10, 2))
+
+	mockR.object = nil
+	buffer := make([]byte, 2)
+	require.NoError(t, r.ReadRange(ctx, backend.IndexName, blockID, "test", 10, buffer))
+	assert.Equal(t, []byte{0x01, 0x02}, buffer)
+}
+
+func TestSentinel(t *testing.T) {
+	master := newFakeRedis(t)
+	defer master.Close()
+
+	sentinel := newFakeRedis(t)
+	defer sentinel.Close()
+	host, port, _ := net.SplitHostPort(master.Addr())
+	sentinel.setHook(func(args []string) (interface{}, bool) {
+		if args[0] == "SENTINEL" && args[2] == "tempo-master" {
+			return []interface{}{[]byte(host), []byte(port)}, true
+		}
+		return nil, false
+	})
+
+	// the first sentinel is down
+	c, err := newClient(&Config{
+		Endpoint:         "127.0.0.1:1," + sentinel.Addr(),
+		MasterName:       "tempo-master",
+		SentinelPassword: "sentinel-secret",
+		Timeout:          time.Second,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+	defer c.Stop()
+
+	ctx := context.Background()
+	c.Store(ctx, []string{"key"}, [][]byte{[]byte("val")})
+	found, bufs, _ := c.Fetch(ctx, []string{"key"})
+	assert.Equal(t, []string{"key"}, found)
+	assert.Equal(t, [][]byte{[]byte("val")}, bufs)
+	assert.Contains(t, sentinel.commands(), "AUTH sentinel-secret")
+
+	// failover.  the old master is demoted and the sentinel returns the new master
+	newMaster := newFakeRedis(t)
+	defer newMaster.Close()
+	master.setHook(func(args []string) (interface{}, bool) {
+		return redigo.Error("READONLY You can't write against a read only replica."), true
+	})
+	host, port, _ = net.SplitHostPort(newMaster.Addr())
+
+	c.Store(ctx, []string{"key"}, [][]byte{[]byte("val")})
+	c.Store(ctx, []string{"key"}, [][]byte{[]byte("val")})
+	assert.Contains(t, newMaster.commands(), "SET key val")
+}
+
+func TestCluster(t *testing.T) {
+	nodes := []*fakeRedis{newFakeRedis(t), newFakeRedis(t)}
+	defer nodes[0].Close()
+	defer nodes[1].Close()
+
+	// node 0 serves the first half of the slots and node 1 the second until the boundary is moved
+	var mtx sync.Mutex
+	boundary := clusterSlots / 2
+	owner := func(s uint16) int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if int(s) < boundary {
+			return 0
+		}
+		return 1
+	}
+	for i, n := range nodes {
+		i := i
+		n.setHook(func(args []string) (interface{}, bool) {
+			switch args[0] {
+			case "CLUSTER":
+				mtx.Lock()
+				defer mtx.Unlock()
+				return []interface{}{
+					[]interface{}{int64(0), int64(boundary - 1), []interface{}{[]byte("127.0.0.1"), int64(nodes[0].port())}},
+					[]interface{}{int64(boundary), int64(clusterSlots - 1), []interface{}{[]byte(""), int64(nodes[1].port())}},
+				}, true
+			case "GET", "SET":
+				s := slot(args[1])
+				if o := owner(s); o != i {
+					return redigo.Error(fmt.Sprintf("MOVED %d %s", s, nodes[o].Addr())), true
+				}
+			}
+			return nil, false
+		})
+	}
+
+	c, err := newClient(&Config{
+		Endpoint: nodes[0].Addr(),
+		Cluster:  true,
+		Timeout:  time.Second,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+	defer c.Stop()
+
+	// foo is in slot 12182 and bar in 5061
+	ctx := context.Background()
+	c.Store(ctx, []string{"foo", "bar"}, [][]byte{[]byte("1"), []byte("2")})
+	assert.Contains(t, nodes[1].commands(), "SET foo 1")
+	assert.Contains(t, nodes[0].commands(), "SET bar 2")
+
+	// reshard.  bar moves to node 1
+	mtx.Lock()
+	boundary = 5000
+	mtx.Unlock()
+	nodes[1].set("bar", []byte("2"))
+
+	found, bufs, missed := c.Fetch(ctx, []string{"foo", "bar", "baz"})
+	assert.Equal(t, []string{"foo", "bar"}, found)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, bufs)
+	assert.Equal(t, []string{"baz"}, missed)
+}
+
+func TestSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	assert.Equal(t, uint16(12182), slot("foo"))
+	assert.Equal(t, uint16(5061), slot("bar"))
+	assert.Equal(t, slot("user1000"), slot("{user1000}.following"))
+	assert.Equal(t, slot("foo{}{bar}"), crc16("foo{}{bar}")%clusterSlots)
+}
+
+func TestConfig(t *testing.T) {
+	_, err := newClient(&Config{}, log.NewNopLogger())
+	assert.Error(t, err)
+	_, err = newClient(&Config{Endpoint: "a", Cluster: true, MasterName: "b"}, log.NewNopLogger())
+	assert.Error(t, err)
+	_, err = newClient(&Config{Endpoint: "a", Cluster: true, DB: 1, Timeout: time.Millisecond}, log.NewNopLogger())
+	assert.Error(t, err)
+}
+
+// fakeRedis speaks enough of the redis protocol to test the client
+type fakeRedis struct {
+	ln net.Listener
+
+	// hook may answer a command instead of the fake
+	hook func(args []string) (interface{}, bool)
+
+	mtx  sync.Mutex
+	data map[string][]byte
+	cmds []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeRedis{
+		ln:   ln,
+		data: map[string][]byte{},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) Addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeRedis) port() int {
+	return f.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeRedis) Close() {
+	f.ln.Close()
+}
+
+func (f *fakeRedis) commands() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]string{}, f.cmds...)
+}
+
+func (f *fakeRedis) setHook(hook func(args []string) (interface{}, bool)) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.hook = hook
+}
+
+func (f *fakeRedis) set(key string, val []byte) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.data[key] = val
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, f.reply(args))
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) reply(args []string) interface{} {
+	f.mtx.Lock()
+	f.cmds = append(f.cmds, strings.Join(args, " "))
+	hook := f.hook
+	f.mtx.Unlock()
+
+	if hook != nil {
+		if reply, ok := hook(args); ok {
+			return reply
+		}
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch args[0] {
+	case "GET":
+		if val, ok := f.data[args[1]]; ok {
+			return val
+		}
+		return nil
+	case "SET":
+		f.data[args[1]] = []byte(args[2])
+		return "OK"
+	case "AUTH", "SELECT", "ASKING", "PING":
+		return "OK"
+	}
+	return redigo.Error("ERR unknown command " + args[0])
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:l]))
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case string:
+		_, _ = fmt.Fprintf(w, "+%s\r\n", v)
+	case redigo.Error:
+		_, _ = fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		_, _ = fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		_, _ = fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
+
+type mockReader struct {
+	bloom  []byte
+	index  []byte
+	object []byte
+}
+
+func (m *mockReader) Tenants(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+func (m *mockReader) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return nil, nil
+}
+func (m *mockReader) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return nil, nil
+}
+func (m *mockReader) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return m.bloom, nil
+}
+func (m *mockReader) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return m.index, nil
+}
+func (m *mockReader) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return nil
+}
+func (m *mockReader) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	copy(buffer, m.object)
+	return nil
+}
+func (m *mockReader) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return nil, backend.ErrIndexDoesNotExist
+}
+func (m *mockReader) Shutdown() {}
+
+type mockWriter struct {
+}
+
+func (m *mockWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return nil
+}
+func (m *mockWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	return nil
+}
+func (m *mockWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return nil, nil
+}
+func (m *mockWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return nil
+}
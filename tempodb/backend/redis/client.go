@@ -0,0 +1,472 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	clusterSlots = 16384
+	// a command is redirected at most this many times before giving up
+	maxRedirects = 3
+)
+
+var metricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "tempodb",
+	Name:      "redis_request_duration_seconds",
+	Help:      "Time spent doing redis requests.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 6),
+}, []string{"operation", "status"})
+
+// client is a cache.Cache in a single redis server, a redis master found through sentinel or a redis cluster.
+// Errors are logged rather than returned.  The cache is best effort.
+type client struct {
+	cfg       *Config
+	logger    log.Logger
+	endpoints []string
+	ttl       int
+	tlsConfig *tls.Config
+
+	mtx sync.RWMutex
+	// pool is used with a single server or sentinel.  it is replaced after a failover
+	pool *redigo.Pool
+	// pools are the connections to each cluster node by address
+	pools map[string]*redigo.Pool
+	// slots is the address of the node serving each cluster slot.  nil until the cluster is discovered
+	slots      []string
+	refreshing int32
+}
+
+func newClient(cfg *Config, logger log.Logger) (*client, error) {
+	var endpoints []string
+	for _, e := range strings.Split(cfg.Endpoint, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("redis endpoint is required")
+	}
+	if cfg.Cluster && cfg.MasterName != "" {
+		return nil, errors.New("redis cluster and sentinel are mutually exclusive")
+	}
+	if cfg.Cluster && cfg.DB != 0 {
+		return nil, errors.New("redis cluster does not support selecting a db")
+	}
+
+	c := &client{
+		cfg:       cfg,
+		logger:    logger,
+		endpoints: endpoints,
+	}
+
+	if cfg.TTL > 0 {
+		c.ttl = int(cfg.TTL.Seconds())
+		if c.ttl == 0 {
+			c.ttl = 1
+		}
+	}
+
+	if cfg.TLSEnabled {
+		c.tlsConfig = &tls.Config{
+			InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		}
+		if cfg.TLSCAPath != "" {
+			ca, err := ioutil.ReadFile(cfg.TLSCAPath)
+			if err != nil {
+				return nil, errors.Wrap(err, "error reading redis ca")
+			}
+			c.tlsConfig.RootCAs = x509.NewCertPool()
+			if !c.tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in redis ca %s", cfg.TLSCAPath)
+			}
+		}
+	}
+
+	switch {
+	case cfg.Cluster:
+		c.pools = map[string]*redigo.Pool{}
+		// an unreachable cluster is retried on first use
+		if err := c.refreshSlots(); err != nil {
+			level.Warn(logger).Log("msg", "error discovering redis cluster", "err", err)
+		}
+	case cfg.MasterName != "":
+		c.pool = c.newPool(c.masterAddr)
+	default:
+		addr := endpoints[0]
+		c.pool = c.newPool(func() (string, error) { return addr, nil })
+	}
+
+	return c, nil
+}
+
+// Fetch implements cache.Cache
+func (c *client) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missed []string) {
+	for _, key := range keys {
+		start := time.Now()
+		val, err := redigo.Bytes(c.do(key, "GET", key))
+		c.observe("GET", start, err)
+
+		if err != nil {
+			if err != redigo.ErrNil {
+				level.Error(c.logger).Log("msg", "error reading from redis", "key", key, "err", err)
+			}
+			missed = append(missed, key)
+			continue
+		}
+		found = append(found, key)
+		bufs = append(bufs, val)
+	}
+	return
+}
+
+// Store implements cache.Cache
+func (c *client) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	for i, key := range keys {
+		args := []interface{}{key, bufs[i]}
+		if c.ttl > 0 {
+			args = append(args, "EX", c.ttl)
+		}
+
+		start := time.Now()
+		_, err := c.do(key, "SET", args...)
+		c.observe("SET", start, err)
+
+		if err != nil {
+			level.Error(c.logger).Log("msg", "error writing to redis", "key", key, "err", err)
+		}
+	}
+}
+
+// Stop implements cache.Cache
+func (c *client) Stop() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.pool != nil {
+		_ = c.pool.Close()
+	}
+	for _, p := range c.pools {
+		_ = p.Close()
+	}
+}
+
+func (c *client) do(key string, cmd string, args ...interface{}) (interface{}, error) {
+	if c.cfg.Cluster {
+		return c.doCluster(key, cmd, args...)
+	}
+
+	c.mtx.RLock()
+	pool := c.pool
+	c.mtx.RUnlock()
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	reply, err := redigo.DoWithTimeout(conn, c.cfg.Timeout, cmd, args...)
+	if err != nil && c.cfg.MasterName != "" && failedOver(err) {
+		c.resetPool(pool)
+	}
+	return reply, err
+}
+
+// doCluster sends the command to the node serving the key's slot and follows MOVED and ASK redirects
+func (c *client) doCluster(key string, cmd string, args ...interface{}) (interface{}, error) {
+	s := slot(key)
+	addr := c.nodeFor(s)
+	asking := false
+
+	for i := 0; ; i++ {
+		reply, err := c.doNode(addr, asking, cmd, args...)
+
+		redirect, ok := err.(redigo.Error)
+		if !ok || i == maxRedirects {
+			return reply, err
+		}
+		// MOVED <slot> <addr> or ASK <slot> <addr>
+		fields := strings.Fields(string(redirect))
+		if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+			return reply, err
+		}
+
+		addr = fields[2]
+		asking = fields[0] == "ASK"
+		if !asking {
+			c.mtx.Lock()
+			if c.slots != nil {
+				c.slots[s] = addr
+			}
+			c.mtx.Unlock()
+
+			// a moved slot usually means the cluster was resharded.  learn the rest of the changes in the background
+			if atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+				go func() {
+					defer atomic.StoreInt32(&c.refreshing, 0)
+					if err := c.refreshSlots(); err != nil {
+						level.Warn(c.logger).Log("msg", "error refreshing redis cluster slots", "err", err)
+					}
+				}()
+			}
+		}
+	}
+}
+
+func (c *client) doNode(addr string, asking bool, cmd string, args ...interface{}) (interface{}, error) {
+	conn := c.nodePool(addr).Get()
+	defer conn.Close()
+
+	if asking {
+		if _, err := redigo.DoWithTimeout(conn, c.cfg.Timeout, "ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return redigo.DoWithTimeout(conn, c.cfg.Timeout, cmd, args...)
+}
+
+func (c *client) nodeFor(s uint16) string {
+	c.mtx.RLock()
+	slots := c.slots
+	c.mtx.RUnlock()
+
+	if slots == nil {
+		if err := c.refreshSlots(); err != nil {
+			level.Warn(c.logger).Log("msg", "error discovering redis cluster", "err", err)
+			return c.endpoints[0]
+		}
+		c.mtx.RLock()
+		slots = c.slots
+		c.mtx.RUnlock()
+	}
+
+	if addr := slots[s]; addr != "" {
+		return addr
+	}
+	// a node will redirect us if the slot is served at all
+	return c.endpoints[0]
+}
+
+func (c *client) nodePool(addr string) *redigo.Pool {
+	c.mtx.RLock()
+	p, ok := c.pools[addr]
+	c.mtx.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if p, ok = c.pools[addr]; !ok {
+		p = c.newPool(func() (string, error) { return addr, nil })
+		c.pools[addr] = p
+	}
+	return p
+}
+
+// refreshSlots asks the known nodes, configured ones first, which node serves each slot
+func (c *client) refreshSlots() error {
+	addrs := append([]string{}, c.endpoints...)
+	c.mtx.RLock()
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.mtx.RUnlock()
+
+	var lastErr error
+	for _, addr := range addrs {
+		slots, err := c.clusterSlots(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c.mtx.Lock()
+		c.slots = slots
+		c.mtx.Unlock()
+		return nil
+	}
+	return lastErr
+}
+
+func (c *client) clusterSlots(addr string) ([]string, error) {
+	conn := c.nodePool(addr).Get()
+	defer conn.Close()
+
+	ranges, err := redigo.Values(redigo.DoWithTimeout(conn, c.cfg.Timeout, "CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	// each range is [start, end, [master host, master port, ...], replicas...]
+	slots := make([]string, clusterSlots)
+	for _, r := range ranges {
+		fields, err := redigo.Values(r, nil)
+		if err != nil || len(fields) < 3 {
+			continue
+		}
+		start, _ := redigo.Int(fields[0], nil)
+		end, _ := redigo.Int(fields[1], nil)
+		master, err := redigo.Values(fields[2], nil)
+		if err != nil || len(master) < 2 {
+			continue
+		}
+		host, _ := redigo.String(master[0], nil)
+		port, _ := redigo.Int(master[1], nil)
+		if host == "" {
+			// the node doesn't know its own address.  it's the one we asked
+			host, _, _ = net.SplitHostPort(addr)
+		}
+
+		nodeAddr := net.JoinHostPort(host, strconv.Itoa(port))
+		for s := start; s <= end && s < clusterSlots; s++ {
+			slots[s] = nodeAddr
+		}
+	}
+	return slots, nil
+}
+
+// masterAddr asks the sentinels for the master's address
+func (c *client) masterAddr() (string, error) {
+	var lastErr error
+	for _, sentinel := range c.endpoints {
+		conn, err := c.dial(sentinel, "", c.cfg.SentinelPassword, 0)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		reply, err := redigo.Strings(redigo.DoWithTimeout(conn, c.cfg.Timeout, "SENTINEL", "get-master-addr-by-name", c.cfg.MasterName))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply) != 2 {
+			lastErr = fmt.Errorf("unexpected sentinel reply %v", reply)
+			continue
+		}
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+
+	return "", errors.Wrapf(lastErr, "error finding redis master %s", c.cfg.MasterName)
+}
+
+// resetPool replaces the pool so new connections are made to the current master.  old is closed.
+func (c *client) resetPool(old *redigo.Pool) {
+	c.mtx.Lock()
+	if c.pool != old {
+		c.mtx.Unlock()
+		return
+	}
+	c.pool = c.newPool(c.masterAddr)
+	c.mtx.Unlock()
+
+	_ = old.Close()
+}
+
+func (c *client) newPool(addr func() (string, error)) *redigo.Pool {
+	return &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			a, err := addr()
+			if err != nil {
+				return nil, err
+			}
+			return c.dial(a, c.cfg.Username, c.cfg.Password, c.cfg.DB)
+		},
+		MaxIdle: c.cfg.MaxIdleConns,
+	}
+}
+
+// dial connects and authenticates.  redigo's own password option doesn't take an acl user.
+func (c *client) dial(addr string, username string, password string, db int) (redigo.Conn, error) {
+	options := []redigo.DialOption{
+		redigo.DialConnectTimeout(c.cfg.Timeout),
+	}
+	if c.tlsConfig != nil {
+		options = append(options, redigo.DialUseTLS(true), redigo.DialTLSConfig(c.tlsConfig))
+	}
+
+	conn, err := redigo.Dial("tcp", addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if password != "" {
+		args := []interface{}{password}
+		if username != "" {
+			args = []interface{}{username, password}
+		}
+		if _, err := redigo.DoWithTimeout(conn, c.cfg.Timeout, "AUTH", args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db != 0 {
+		if _, err := redigo.DoWithTimeout(conn, c.cfg.Timeout, "SELECT", db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *client) observe(operation string, start time.Time, err error) {
+	status := "success"
+	if err == redigo.ErrNil {
+		status = "miss"
+	} else if err != nil {
+		status = "error"
+	}
+	metricRequestDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+// failedOver is true if an error suggests the master has changed: a connection error or a write to a master
+// demoted to a replica
+func failedOver(err error) bool {
+	if redisErr, ok := err.(redigo.Error); ok {
+		return strings.HasPrefix(string(redisErr), "READONLY")
+	}
+	return true
+}
+
+// slot is the cluster slot of a key, respecting hash tags
+func slot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % clusterSlots
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum redis cluster uses
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,11 @@
+package retry
+
+import "time"
+
+type Config struct {
+	// MaxRetries is the number of times a failed backend operation is retried.  0 disables retries.
+	MaxRetries int `yaml:"max_retries"`
+	// retries back off exponentially with jitter from MinBackoff up to MaxBackoff
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
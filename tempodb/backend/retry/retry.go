@@ -0,0 +1,238 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	cortex_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var metricRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "tempodb",
+	Name:      "backend_retries_total",
+	Help:      "Total number of times a failed backend operation was retried.",
+}, []string{"operation"})
+
+// Retryable is true if an error from the backend may succeed if the operation is tried again
+type Retryable func(err error) bool
+
+type readerWriter struct {
+	cfg       *Config
+	retryable Retryable
+
+	nextReader    backend.Reader
+	nextWriter    backend.Writer
+	nextCompactor backend.Compactor
+}
+
+// New wraps the backend so that operations failing with errors the retryable func accepts are retried.  Errors
+// that can never succeed on retry, such as a missing meta or a cancelled context, are returned immediately
+// whatever retryable says.  AppendObject and WriteBlockMeta completing an append are not retried.  A failed
+// append may have left the upload in a state a retry can't recover.
+func New(r backend.Reader, w backend.Writer, c backend.Compactor, cfg *Config, retryable Retryable) (backend.Reader, backend.Writer, backend.Compactor) {
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	rw := &readerWriter{
+		cfg:           cfg,
+		retryable:     retryable,
+		nextReader:    r,
+		nextWriter:    w,
+		nextCompactor: c,
+	}
+	return rw, rw, rw
+}
+
+// Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	var tenants []string
+	err := rw.do(ctx, "Tenants", func() (err error) {
+		tenants, err = rw.nextReader.Tenants(ctx)
+		return
+	})
+	return tenants, err
+}
+
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	var blocks []uuid.UUID
+	err := rw.do(ctx, "Blocks", func() (err error) {
+		blocks, err = rw.nextReader.Blocks(ctx, tenantID)
+		return
+	})
+	return blocks, err
+}
+
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	var meta *encoding.BlockMeta
+	err := rw.do(ctx, "BlockMeta", func() (err error) {
+		meta, err = rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+		return
+	})
+	return meta, err
+}
+
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	var bloom []byte
+	err := rw.do(ctx, "Bloom", func() (err error) {
+		bloom, err = rw.nextReader.Bloom(ctx, blockID, tenantID)
+		return
+	})
+	return bloom, err
+}
+
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	var index []byte
+	err := rw.do(ctx, "Index", func() (err error) {
+		index, err = rw.nextReader.Index(ctx, blockID, tenantID)
+		return
+	})
+	return index, err
+}
+
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.do(ctx, "Object", func() error {
+		return rw.nextReader.Object(ctx, blockID, tenantID, start, buffer)
+	})
+}
+
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.do(ctx, "ReadRange", func() error {
+		return rw.nextReader.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	})
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	var index *backend.TenantIndex
+	err := rw.do(ctx, "TenantIndex", func() (err error) {
+		index, err = rw.nextReader.TenantIndex(ctx, tenantID)
+		return
+	})
+	return index, err
+}
+
+func (rw *readerWriter) Shutdown() {
+	rw.nextReader.Shutdown()
+}
+
+// Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return rw.do(ctx, "Write", func() error {
+		return rw.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	})
+}
+
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	if tracker != nil {
+		return rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	}
+
+	return rw.do(ctx, "WriteBlockMeta", func() error {
+		return rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	})
+}
+
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return rw.nextWriter.AppendObject(ctx, tracker, meta, bObject)
+}
+
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return rw.do(ctx, "WriteTenantIndex", func() error {
+		return rw.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+	})
+}
+
+// Compactor
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return rw.do(context.Background(), "MarkBlockCompacted", func() error {
+		return rw.nextCompactor.MarkBlockCompacted(blockID, tenantID)
+	})
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return rw.do(context.Background(), "ClearBlock", func() error {
+		return rw.nextCompactor.ClearBlock(blockID, tenantID)
+	})
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return rw.do(context.Background(), "ClearBlocks", func() error {
+		return rw.nextCompactor.ClearBlocks(blockIDs, tenantID)
+	})
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	var meta *encoding.CompactedBlockMeta
+	err := rw.do(context.Background(), "CompactedBlockMeta", func() (err error) {
+		meta, err = rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+		return
+	})
+	return meta, err
+}
+
+func (rw *readerWriter) do(ctx context.Context, op string, fn func() error) error {
+	err := fn()
+	if err == nil || rw.cfg.MaxRetries <= 0 {
+		return err
+	}
+
+	backoff := cortex_util.NewBackoff(ctx, cortex_util.BackoffConfig{
+		MinBackoff: rw.cfg.MinBackoff,
+		MaxBackoff: rw.cfg.MaxBackoff,
+		MaxRetries: rw.cfg.MaxRetries,
+	})
+	for retries := 0; err != nil && retries < rw.cfg.MaxRetries && rw.shouldRetry(err); retries++ {
+		select {
+		case <-time.After(backoff.NextDelay()):
+		case <-ctx.Done():
+			return err
+		}
+
+		metricRetries.WithLabelValues(op).Inc()
+		err = fn()
+	}
+
+	return err
+}
+
+func (rw *readerWriter) shouldRetry(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, backend.ErrMetaDoesNotExist),
+		errors.Is(err, backend.ErrIndexDoesNotExist),
+		errors.Is(err, backend.ErrEmptyTenantID),
+		errors.Is(err, backend.ErrEmptyBlockID):
+		return false
+	}
+
+	return rw.retryable(err)
+}
+
+// IsTransient is true for network errors that are likely to pass: timeouts, resets and truncated responses.
+// Backends without a more specific classification use it.
+func IsTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// IsRetryableStatus is true for http status codes worth retrying: throttling and server errors
+func IsRetryableStatus(code int) bool {
+	return code == 429 || code >= 500
+}
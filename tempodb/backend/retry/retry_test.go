@@ -0,0 +1,183 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = errors.New("transient")
+
+// mockBackend fails every call with errs until they run out
+type mockBackend struct {
+	errs  []error
+	calls int
+}
+
+func (m *mockBackend) next() error {
+	m.calls++
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func (m *mockBackend) Tenants(ctx context.Context) ([]string, error) {
+	return []string{"test"}, m.next()
+}
+func (m *mockBackend) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return nil, m.next()
+}
+func (m *mockBackend) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return nil, m.next()
+}
+func (m *mockBackend) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return []byte("bloom"), m.next()
+}
+func (m *mockBackend) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return nil, m.next()
+}
+func (m *mockBackend) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return m.next()
+}
+func (m *mockBackend) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return m.next()
+}
+func (m *mockBackend) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return nil, m.next()
+}
+func (m *mockBackend) Shutdown() {}
+func (m *mockBackend) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return m.next()
+}
+func (m *mockBackend) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	return m.next()
+}
+func (m *mockBackend) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return nil, m.next()
+}
+func (m *mockBackend) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return m.next()
+}
+func (m *mockBackend) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return m.next()
+}
+func (m *mockBackend) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return m.next()
+}
+func (m *mockBackend) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return m.next()
+}
+func (m *mockBackend) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return nil, m.next()
+}
+
+func newTestBackend(maxRetries int, errs ...error) (*mockBackend, backend.Reader, backend.Writer, backend.Compactor) {
+	m := &mockBackend{errs: errs}
+	r, w, c := New(m, m, m, &Config{
+		MaxRetries: maxRetries,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond,
+	}, func(err error) bool {
+		return errors.Is(err, errTransient)
+	})
+	return m, r, w, c
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	m, r, _, _ := newTestBackend(3, errTransient, fmt.Errorf("wrapped: %w", errTransient))
+	bloom, err := r.Bloom(ctx, uuid.New(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bloom"), bloom)
+	assert.Equal(t, 3, m.calls)
+
+	// gives up after max retries
+	m, r, _, _ = newTestBackend(2, errTransient, errTransient, errTransient, errTransient)
+	_, err = r.Tenants(ctx)
+	assert.Equal(t, errTransient, err)
+	assert.Equal(t, 3, m.calls)
+
+	// disabled
+	m, r, _, _ = newTestBackend(0, errTransient)
+	_, err = r.Tenants(ctx)
+	assert.Equal(t, errTransient, err)
+	assert.Equal(t, 1, m.calls)
+
+	// compactor operations are retried too
+	m, _, _, c := newTestBackend(1, errTransient)
+	require.NoError(t, c.ClearBlock(uuid.New(), "test"))
+	assert.Equal(t, 2, m.calls)
+}
+
+func TestNotRetried(t *testing.T) {
+	ctx := context.Background()
+
+	for _, err := range []error{
+		errors.New("permanent"),
+		backend.ErrMetaDoesNotExist,
+		backend.ErrIndexDoesNotExist,
+		context.Canceled,
+	} {
+		m, r, _, _ := newTestBackend(3, err)
+		_, actual := r.BlockMeta(ctx, uuid.New(), "test")
+		assert.Equal(t, err, actual)
+		assert.Equal(t, 1, m.calls)
+	}
+
+	// a failed append or the completion of one can't be safely retried
+	m, _, w, _ := newTestBackend(3, errTransient, errTransient)
+	_, err := w.AppendObject(ctx, nil, &encoding.BlockMeta{}, nil)
+	assert.Equal(t, errTransient, err)
+	err = w.WriteBlockMeta(ctx, "tracker", &encoding.BlockMeta{}, nil, nil)
+	assert.Equal(t, errTransient, err)
+	assert.Equal(t, 2, m.calls)
+
+	// writing the meta of a block written whole is
+	m, _, w, _ = newTestBackend(3, errTransient)
+	require.NoError(t, w.WriteBlockMeta(ctx, nil, &encoding.BlockMeta{}, nil, nil))
+	assert.Equal(t, 2, m.calls)
+}
+
+func TestCancelledWhileBackingOff(t *testing.T) {
+	m := &mockBackend{errs: []error{errTransient, errTransient}}
+	r, _, _ := New(m, m, m, &Config{MaxRetries: 3, MinBackoff: time.Hour, MaxBackoff: time.Hour}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// the default classification doesn't know errTransient.  use a network error
+	m.errs = []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF}
+	_, err := r.Index(ctx, uuid.New(), "test")
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 1, m.calls)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(io.ErrUnexpectedEOF))
+	assert.True(t, IsTransient(fmt.Errorf("reading: %w", io.ErrUnexpectedEOF)))
+	assert.True(t, IsTransient(timeoutError{}))
+	assert.False(t, IsTransient(errors.New("permanent")))
+
+	assert.True(t, IsRetryableStatus(429))
+	assert.True(t, IsRetryableStatus(503))
+	assert.False(t, IsRetryableStatus(404))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-kit/kit/log/level"
 	"github.com/google/uuid"
+	tempo_util "github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/grafana/tempo/tempodb/backend/util"
 	"github.com/grafana/tempo/tempodb/encoding"
@@ -28,7 +29,7 @@ func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) e
 		metaFileName,
 		rw.cfg.Bucket,
 		util.CompactedMetaFileName(blockID, tenantID),
-		nil,
+		sseHeaders(rw.sse),
 	)
 	if err != nil {
 		return errors.Wrap(err, "error copying obj meta to compacted obj meta")
@@ -48,13 +49,7 @@ func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
 
 	level.Debug(rw.logger).Log("msg", "deleting block", "block path", util.BlockFileName(blockID, tenantID))
 
-	// list of objects that need to be deleted
-	var delObjects []string
-	delObjects = append(delObjects, util.CompactedMetaFileName(blockID, tenantID))
-	delObjects = append(delObjects, util.BloomFileName(blockID, tenantID))
-	delObjects = append(delObjects, util.IndexFileName(blockID, tenantID))
-	delObjects = append(delObjects, util.ObjectFileName(blockID, tenantID))
-	for _, obj := range delObjects {
+	for _, obj := range blockObjects(blockID, tenantID) {
 		err := rw.core.RemoveObject(rw.cfg.Bucket, obj)
 		if err != nil {
 			return errors.Wrapf(err, "error deleting obj from s3: %s", obj)
@@ -64,6 +59,54 @@ func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
 	return nil
 }
 
+// ClearBlocks deletes the objects of all blocks with multi-object deletes, up to 1000 objects per request
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	for _, blockID := range blockIDs {
+		if blockID == uuid.Nil {
+			return backend.ErrEmptyBlockID
+		}
+	}
+
+	level.Debug(rw.logger).Log("msg", "deleting blocks", "tenantID", tenantID, "blocks", len(blockIDs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	objectsCh := make(chan string)
+	go func() {
+		defer close(objectsCh)
+		for _, blockID := range blockIDs {
+			for _, obj := range blockObjects(blockID, tenantID) {
+				select {
+				case objectsCh <- obj:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	errs := tempo_util.MultiError{}
+	for removeErr := range rw.core.RemoveObjectsWithContext(ctx, rw.cfg.Bucket, objectsCh) {
+		errs.Add(errors.Wrapf(removeErr.Err, "error deleting obj from s3: %s", removeErr.ObjectName))
+	}
+
+	return errs.Err()
+}
+
+// blockObjects are the objects of a compacted block
+func blockObjects(blockID uuid.UUID, tenantID string) []string {
+	return []string{
+		util.CompactedMetaFileName(blockID, tenantID),
+		util.BloomFileName(blockID, tenantID),
+		util.IndexFileName(blockID, tenantID),
+		util.ObjectFileName(blockID, tenantID),
+	}
+}
+
 func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
 	if len(tenantID) == 0 {
 		return nil, backend.ErrEmptyTenantID
@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearBlocks(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests int
+		deleted  []string
+	)
+	failKey := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if _, ok := r.URL.Query()["delete"]; r.Method != http.MethodPost || !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		requests++
+
+		del := struct {
+			Objects []struct {
+				Key string
+			} `xml:"Object"`
+		}{}
+		require.NoError(t, xml.NewDecoder(r.Body).Decode(&del))
+
+		_, _ = fmt.Fprint(w, `<DeleteResult>`)
+		for _, o := range del.Objects {
+			if o.Key == failKey {
+				_, _ = fmt.Fprintf(w, `<Error><Key>%s</Key><Code>AccessDenied</Code><Message>denied</Message></Error>`, o.Key)
+				continue
+			}
+			deleted = append(deleted, o.Key)
+			_, _ = fmt.Fprintf(w, `<Deleted><Key>%s</Key></Deleted>`, o.Key)
+		}
+		_, _ = fmt.Fprint(w, `</DeleteResult>`)
+	}))
+	defer server.Close()
+
+	rw := newFakeReaderWriter(t, server.URL, &Config{Bucket: "bucket"})
+
+	// 4 objects per block.  300 blocks take 2 requests
+	blockIDs := make([]uuid.UUID, 300)
+	for i := range blockIDs {
+		blockIDs[i] = uuid.New()
+	}
+	require.NoError(t, rw.ClearBlocks(blockIDs, "tenant"))
+	assert.Equal(t, 2, requests)
+	assert.Len(t, deleted, 4*len(blockIDs))
+	assert.Contains(t, deleted, util.ObjectFileName(blockIDs[299], "tenant"))
+
+	// a failed object doesn't stop the rest
+	mtx.Lock()
+	requests, deleted = 0, nil
+	failKey = util.BloomFileName(blockIDs[0], "tenant")
+	mtx.Unlock()
+	err := rw.ClearBlocks(blockIDs[:2], "tenant")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), failKey)
+	assert.Len(t, deleted, 7)
+}
@@ -1,5 +1,10 @@
 package s3
 
+import (
+	"github.com/grafana/tempo/tempodb/backend/hedge"
+	"github.com/grafana/tempo/tempodb/backend/transport"
+)
+
 type Config struct {
 	Bucket    string `yaml:"bucket"`
 	Endpoint  string `yaml:"endpoint"`
@@ -7,5 +12,18 @@ type Config struct {
 	AccessKey string `yaml:"access_key"`
 	SecretKey string `yaml:"secret_key"`
 	Insecure  bool   `yaml:"insecure"`
-	PartSize  uint64 `yaml:"part_size"`
+
+	// PartSize is the size of the parts blocks are uploaded in
+	PartSize uint64 `yaml:"part_size"`
+	// MultipartThreshold is the block size at which multipart uploads are used instead of a single put.
+	// 0 uses the part size.
+	MultipartThreshold uint64 `yaml:"multipart_threshold"`
+	// PartConcurrency is the number of parts of a block uploaded at once
+	PartConcurrency int `yaml:"part_concurrency"`
+
+	AssumeRole AssumeRoleConfig `yaml:"assume_role"`
+	Hedging    hedge.Config     `yaml:"hedging"`
+	SSE        SSEConfig        `yaml:"sse"`
+	TLS        TLSConfig        `yaml:"tls"`
+	Transport  transport.Config `yaml:"transport"`
 }
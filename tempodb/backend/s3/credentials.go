@@ -0,0 +1,237 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/minio/minio-go/v6/pkg/signer"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSTSEndpoint    = "https://sts.amazonaws.com"
+	defaultRoleSession    = "tempo"
+	defaultAssumeDuration = time.Hour
+)
+
+type AssumeRoleConfig struct {
+	// RoleARN is the role to assume.  Empty uses the access keys or the environment's credentials directly.
+	RoleARN string `yaml:"role_arn"`
+	// ExternalID is passed to sts when assuming a role in another account that requires one
+	ExternalID string `yaml:"external_id"`
+	// SessionName identifies the session in cloudtrail.  Defaults to tempo.
+	SessionName string `yaml:"session_name"`
+	// Duration is how long the temporary credentials are valid for.  They are refreshed before they expire.
+	Duration time.Duration `yaml:"duration"`
+	// WebIdentityTokenFile is a file holding an oidc token, such as a kubernetes projected service account
+	// token, exchanged for the role's credentials.  The file is reread on every refresh.
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"`
+	// STSEndpoint defaults to the regional sts endpoint if a region is set and the global endpoint otherwise
+	STSEndpoint string `yaml:"sts_endpoint"`
+}
+
+// newCredentials returns the credentials requests are signed with.  Static access keys are used if set,
+// otherwise the aws environment variables, shared credentials file and instance or task role are tried in
+// turn.  The IRSA environment variables set on EKS are picked up by the last of these.  If a role is
+// configured it is assumed with whichever credentials are found, or with a web identity token if one is
+// configured.
+func newCredentials(cfg *Config) (*credentials.Credentials, error) {
+	client := &http.Client{
+		Transport: http.DefaultTransport,
+		Timeout:   time.Minute,
+	}
+	roleCfg := cfg.AssumeRole
+
+	stsEndpoint := roleCfg.STSEndpoint
+	if stsEndpoint == "" {
+		stsEndpoint = defaultSTSEndpoint
+		if cfg.Region != "" {
+			stsEndpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", cfg.Region)
+		}
+	}
+
+	if roleCfg.WebIdentityTokenFile != "" {
+		if roleCfg.RoleARN == "" {
+			return nil, errors.New("a role arn is required with a web identity token file")
+		}
+		return credentials.New(&webIdentity{
+			client:   client,
+			endpoint: stsEndpoint,
+			cfg:      roleCfg,
+		}), nil
+	}
+
+	var source credentials.Provider
+	if cfg.AccessKey != "" {
+		source = &credentials.Static{
+			Value: credentials.Value{
+				AccessKeyID:     cfg.AccessKey,
+				SecretAccessKey: cfg.SecretKey,
+				SignerType:      credentials.SignatureV4,
+			},
+		}
+	} else {
+		source = &credentials.Chain{
+			Providers: []credentials.Provider{
+				&credentials.EnvAWS{},
+				&credentials.FileAWSCredentials{},
+				&credentials.IAM{Client: client},
+			},
+		}
+	}
+
+	if roleCfg.RoleARN == "" {
+		return credentials.New(source), nil
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return credentials.New(&assumeRole{
+		client:   client,
+		endpoint: stsEndpoint,
+		region:   region,
+		cfg:      roleCfg,
+		source:   credentials.New(source),
+	}), nil
+}
+
+// assumeRole exchanges source credentials for a role's temporary credentials.  minio's STSAssumeRole does not
+// take an external id or source credentials with a session token.
+type assumeRole struct {
+	credentials.Expiry
+
+	client   *http.Client
+	endpoint string
+	region   string
+	cfg      AssumeRoleConfig
+	source   *credentials.Credentials
+}
+
+func (a *assumeRole) Retrieve() (credentials.Value, error) {
+	source, err := a.source.Get()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if source.AccessKeyID == "" {
+		return credentials.Value{}, fmt.Errorf("no credentials found to assume role %s with", a.cfg.RoleARN)
+	}
+
+	v := stsParams("AssumeRole", a.cfg)
+	if a.cfg.ExternalID != "" {
+		v.Set("ExternalId", a.cfg.ExternalID)
+	}
+	body := v.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint, strings.NewReader(body))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	hash := sha256.Sum256([]byte(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	if source.SessionToken != "" {
+		// set before signing so it is a signed header
+		req.Header.Set("X-Amz-Security-Token", source.SessionToken)
+	}
+	req = signer.SignV4STS(*req, source.AccessKeyID, source.SecretAccessKey, a.region)
+
+	resp := credentials.AssumeRoleResponse{}
+	if err := doSTS(a.client, req, &resp); err != nil {
+		return credentials.Value{}, errors.Wrapf(err, "error assuming role %s", a.cfg.RoleARN)
+	}
+
+	creds := resp.Result.Credentials
+	a.SetExpiration(creds.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// webIdentity exchanges an oidc token for a role's temporary credentials.  minio's STSWebIdentity only takes
+// the role from the environment.
+type webIdentity struct {
+	credentials.Expiry
+
+	client   *http.Client
+	endpoint string
+	cfg      AssumeRoleConfig
+}
+
+func (w *webIdentity) Retrieve() (credentials.Value, error) {
+	// reread every time.  projected tokens are rotated by the kubelet
+	token, err := ioutil.ReadFile(w.cfg.WebIdentityTokenFile)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	v := stsParams("AssumeRoleWithWebIdentity", w.cfg)
+	v.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	req, err := http.NewRequest(http.MethodPost, w.endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp := credentials.AssumeRoleWithWebIdentityResponse{}
+	if err := doSTS(w.client, req, &resp); err != nil {
+		return credentials.Value{}, errors.Wrapf(err, "error assuming role %s with web identity", w.cfg.RoleARN)
+	}
+
+	creds := resp.Result.Credentials
+	w.SetExpiration(creds.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func stsParams(action string, cfg AssumeRoleConfig) url.Values {
+	sessionName := cfg.SessionName
+	if sessionName == "" {
+		sessionName = defaultRoleSession
+	}
+	duration := cfg.Duration
+	if duration == 0 {
+		duration = defaultAssumeDuration
+	}
+
+	v := url.Values{}
+	v.Set("Action", action)
+	v.Set("Version", "2011-06-15")
+	v.Set("RoleArn", cfg.RoleARN)
+	v.Set("RoleSessionName", sessionName)
+	v.Set("DurationSeconds", strconv.Itoa(int(duration.Seconds())))
+	return v
+}
+
+func doSTS(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sts returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
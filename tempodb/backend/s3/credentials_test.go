@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticCredentials(t *testing.T) {
+	creds, err := newCredentials(&Config{AccessKey: "access", SecretKey: "secret"})
+	require.NoError(t, err)
+
+	v, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "access", v.AccessKeyID)
+	assert.Equal(t, "secret", v.SecretAccessKey)
+}
+
+func TestEnvironmentCredentials(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "env-access")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	creds, err := newCredentials(&Config{})
+	require.NoError(t, err)
+
+	v, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "env-access", v.AccessKeyID)
+	assert.Equal(t, "env-secret", v.SecretAccessKey)
+}
+
+func TestAssumeRole(t *testing.T) {
+	sts := newFakeSTS(t, time.Hour)
+	defer sts.Close()
+
+	creds, err := newCredentials(&Config{
+		AccessKey: "access",
+		SecretKey: "secret",
+		AssumeRole: AssumeRoleConfig{
+			RoleARN:     "arn:aws:iam::111122223333:role/tempo",
+			ExternalID:  "external",
+			STSEndpoint: sts.URL,
+		},
+	})
+	require.NoError(t, err)
+
+	v, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "assumed-1", v.AccessKeyID)
+	assert.Equal(t, "token-1", v.SessionToken)
+
+	form := sts.requests[0]
+	assert.Equal(t, "AssumeRole", form.Get("Action"))
+	assert.Equal(t, "arn:aws:iam::111122223333:role/tempo", form.Get("RoleArn"))
+	assert.Equal(t, "external", form.Get("ExternalId"))
+	assert.Equal(t, "tempo", form.Get("RoleSessionName"))
+	assert.Equal(t, "3600", form.Get("DurationSeconds"))
+	assert.True(t, strings.HasPrefix(sts.authorization[0], "AWS4-HMAC-SHA256 Credential=access/"))
+	assert.Contains(t, sts.authorization[0], "/sts/aws4_request")
+
+	// the credentials are cached until they expire
+	_, err = creds.Get()
+	require.NoError(t, err)
+	assert.Len(t, sts.requests, 1)
+}
+
+func TestWebIdentity(t *testing.T) {
+	// credentials expire within the expiry window so every get refreshes them
+	sts := newFakeSTS(t, time.Second)
+	defer sts.Close()
+
+	tokenFile, err := ioutil.TempFile("", "web-identity-token")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+
+	_, err = newCredentials(&Config{AssumeRole: AssumeRoleConfig{WebIdentityTokenFile: tokenFile.Name()}})
+	assert.Error(t, err)
+
+	creds, err := newCredentials(&Config{
+		AssumeRole: AssumeRoleConfig{
+			RoleARN:              "arn:aws:iam::111122223333:role/tempo",
+			WebIdentityTokenFile: tokenFile.Name(),
+			STSEndpoint:          sts.URL,
+		},
+	})
+	require.NoError(t, err)
+
+	// the token is reread on every refresh so rotated tokens are used
+	for i, token := range []string{"first", "second"} {
+		require.NoError(t, ioutil.WriteFile(tokenFile.Name(), []byte(token+"\n"), 0644))
+
+		v, err := creds.Get()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("assumed-%d", i+1), v.AccessKeyID)
+
+		form := sts.requests[i]
+		assert.Equal(t, "AssumeRoleWithWebIdentity", form.Get("Action"))
+		assert.Equal(t, token, form.Get("WebIdentityToken"))
+		assert.Equal(t, "", sts.authorization[i])
+	}
+}
+
+type fakeSTS struct {
+	*httptest.Server
+
+	mtx           sync.Mutex
+	requests      []url.Values
+	authorization []string
+}
+
+func newFakeSTS(t *testing.T, expiry time.Duration) *fakeSTS {
+	f := &fakeSTS{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+
+		require.NoError(t, r.ParseForm())
+		f.requests = append(f.requests, r.PostForm)
+		f.authorization = append(f.authorization, r.Header.Get("Authorization"))
+
+		action := r.PostForm.Get("Action")
+		_, _ = fmt.Fprintf(w, `<%sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%sResult>
+    <Credentials>
+      <AccessKeyId>assumed-%d</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token-%d</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </%sResult>
+</%sResponse>`, action, action, len(f.requests), len(f.requests), time.Now().Add(expiry).UTC().Format(time.RFC3339), action, action)
+	}))
+	return f
+}
@@ -0,0 +1,204 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/minio/minio-go/v6"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPartSize        = 64 * 1024 * 1024
+	defaultPartConcurrency = 4
+
+	// s3 rejects parts other than the last smaller than this and uploads of more than maxParts parts
+	minPartSize = 5 * 1024 * 1024
+	maxParts    = 10000
+
+	abortTimeout = 30 * time.Second
+)
+
+// putFile uploads the file at path to name.  files smaller than the multipart threshold are uploaded
+// with a single put.  larger files are uploaded in parts, several at a time, and the upload is aborted
+// if any part fails so no orphaned parts are left behind in the bucket.
+func (rw *readerWriter) putFile(ctx context.Context, name string, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	if uint64(size) < rw.multipartThreshold() {
+		sum, err := readerMD5(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return 0, err
+		}
+		info, err := rw.core.PutObjectWithContext(ctx, rw.cfg.Bucket, name, io.NewSectionReader(f, 0, size), size, sum, "", rw.putOptions())
+		return info.Size, err
+	}
+
+	return size, rw.putMultipart(ctx, name, f, size)
+}
+
+func (rw *readerWriter) putMultipart(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	partSize := rw.partSize(size)
+	partCount := int((size + partSize - 1) / partSize)
+
+	uploadID, err := rw.core.NewMultipartUpload(rw.cfg.Bucket, name, rw.putOptions())
+	if err != nil {
+		return errors.Wrapf(err, "error starting multipart upload, object: %s", name)
+	}
+
+	level.Debug(rw.logger).Log("msg", "starting multipart upload", "objectName", name, "size", size, "parts", partCount, "partSize", partSize)
+
+	parts, err := rw.putParts(ctx, name, uploadID, r, size, partSize, partCount)
+	if err == nil {
+		_, err = rw.core.CompleteMultipartUploadWithContext(ctx, rw.cfg.Bucket, name, uploadID, parts)
+		err = errors.Wrapf(err, "error completing multipart upload, object: %s", name)
+	}
+	if err != nil {
+		rw.abortMultipart(name, uploadID)
+		return err
+	}
+
+	return nil
+}
+
+// putParts uploads partCount parts with at most PartConcurrency in flight.  the first failure cancels the
+// remaining parts
+func (rw *readerWriter) putParts(ctx context.Context, name string, uploadID string, r io.ReaderAt, size int64, partSize int64, partCount int) ([]minio.CompletePart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	partNums := make(chan int, partCount)
+	for i := 1; i <= partCount; i++ {
+		partNums <- i
+	}
+	close(partNums)
+
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		parts    = make([]minio.CompletePart, 0, partCount)
+		firstErr error
+	)
+
+	concurrency := rw.partConcurrency()
+	if concurrency > partCount {
+		concurrency = partCount
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for partNum := range partNums {
+				if ctx.Err() != nil {
+					return
+				}
+
+				offset := int64(partNum-1) * partSize
+				length := partSize
+				if offset+length > size {
+					length = size - offset
+				}
+
+				sum, err := readerMD5(io.NewSectionReader(r, offset, length))
+				var part minio.ObjectPart
+				if err == nil {
+					part, err = rw.core.PutObjectPartWithContext(ctx, rw.cfg.Bucket, name, uploadID, partNum, io.NewSectionReader(r, offset, length), length, sum, "", rw.sse)
+				}
+
+				mtx.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = errors.Wrapf(err, "error uploading part %d of %d, object: %s", partNum, partCount, name)
+					}
+					cancel()
+				} else {
+					parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// abortMultipart removes the parts of a failed upload.  it uses its own context because the upload's
+// context is often the reason it failed
+func (rw *readerWriter) abortMultipart(name string, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	err := rw.core.AbortMultipartUploadWithContext(ctx, rw.cfg.Bucket, name, uploadID)
+	if err != nil {
+		level.Error(rw.logger).Log("msg", "error aborting multipart upload. its parts will remain until removed by a lifecycle rule", "objectName", name, "uploadID", uploadID, "err", err)
+		return
+	}
+	level.Debug(rw.logger).Log("msg", "aborted multipart upload", "objectName", name, "uploadID", uploadID)
+}
+
+// partSize is the configured part size, raised if needed to stay within the s3 minimum part size
+// and maximum number of parts
+func (rw *readerWriter) partSize(size int64) int64 {
+	partSize := int64(rw.cfg.PartSize)
+	if partSize == 0 {
+		partSize = defaultPartSize
+	}
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if min := (size + maxParts - 1) / maxParts; partSize < min {
+		partSize = min
+	}
+	return partSize
+}
+
+func (rw *readerWriter) multipartThreshold() uint64 {
+	if rw.cfg.MultipartThreshold == 0 {
+		return uint64(rw.partSize(0))
+	}
+	return rw.cfg.MultipartThreshold
+}
+
+func (rw *readerWriter) partConcurrency() int {
+	if rw.cfg.PartConcurrency <= 0 {
+		return defaultPartConcurrency
+	}
+	return rw.cfg.PartConcurrency
+}
+
+// readerMD5 is the base64 content md5 of r.  s3 rejects puts and parts that don't match it
+func readerMD5(r io.Reader) (string, error) {
+	h := md5.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
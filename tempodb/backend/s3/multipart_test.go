@@ -0,0 +1,187 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		failPart   int
+		puts       int
+		parts      []int64
+		completed  []int
+		aborted    bool
+		expectsErr bool
+	}{
+		{
+			name: "single put below threshold",
+			size: 1024,
+			puts: 1,
+		},
+		{
+			name:      "multipart",
+			size:      12 * 1024 * 1024,
+			parts:     []int64{5 * 1024 * 1024, 5 * 1024 * 1024, 2 * 1024 * 1024},
+			completed: []int{1, 2, 3},
+		},
+		{
+			name:       "failed part aborts",
+			size:       12 * 1024 * 1024,
+			failPart:   2,
+			aborted:    true,
+			expectsErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3 := newFakeS3(t, tt.failPart)
+			defer s3.Close()
+
+			f, err := ioutil.TempFile("", "block")
+			require.NoError(t, err)
+			defer os.Remove(f.Name())
+			_, err = f.Write(make([]byte, tt.size))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			rw := newFakeReaderWriter(t, s3.URL, &Config{
+				Bucket:             "bucket",
+				PartSize:           minPartSize,
+				MultipartThreshold: 1024 * 1024,
+				PartConcurrency:    2,
+			})
+
+			size, err := rw.putFile(context.Background(), "tenant/block/data", f.Name())
+			if tt.expectsErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, int64(tt.size), size)
+			}
+
+			assert.Equal(t, tt.puts, s3.puts)
+			if tt.parts != nil {
+				assert.ElementsMatch(t, tt.parts, s3.parts)
+			}
+			assert.Equal(t, tt.completed, s3.completed)
+			assert.Equal(t, tt.aborted, s3.aborted)
+		})
+	}
+}
+
+func TestPartSize(t *testing.T) {
+	rw := &readerWriter{cfg: &Config{}}
+	assert.Equal(t, int64(defaultPartSize), rw.partSize(0))
+	assert.Equal(t, uint64(defaultPartSize), rw.multipartThreshold())
+
+	rw.cfg.PartSize = 1024
+	assert.Equal(t, int64(minPartSize), rw.partSize(0))
+
+	// parts grow so the block fits within the maximum number of parts
+	rw.cfg.PartSize = minPartSize
+	assert.Equal(t, int64(minPartSize), rw.partSize(minPartSize*maxParts))
+	assert.Equal(t, int64(minPartSize+1), rw.partSize(minPartSize*maxParts+1))
+}
+
+type fakeS3 struct {
+	*httptest.Server
+
+	mtx       sync.Mutex
+	puts      int
+	parts     []int64
+	completed []int
+	aborted   bool
+}
+
+func newFakeS3(t *testing.T, failPart int) *fakeS3 {
+	f := &fakeS3{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+
+		query := r.URL.Query()
+		_, uploads := query["uploads"]
+		switch {
+		case r.Method == http.MethodPost && uploads:
+			_, _ = fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>tenant/block/data</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && query.Get("partNumber") != "":
+			partNum, err := strconv.Atoi(query.Get("partNumber"))
+			require.NoError(t, err)
+			if partNum == failPart {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprint(w, `<Error><Code>InvalidPart</Code><Message>bad part</Message></Error>`)
+				return
+			}
+			f.parts = append(f.parts, bodySize(t, r))
+			w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNum))
+		case r.Method == http.MethodPost && query.Get("uploadId") != "":
+			complete := struct {
+				Parts []minio.CompletePart `xml:"Part"`
+			}{}
+			require.NoError(t, xml.NewDecoder(r.Body).Decode(&complete))
+			for _, p := range complete.Parts {
+				assert.Equal(t, fmt.Sprintf("etag-%d", p.PartNumber), strings.Trim(p.ETag, `"`))
+				f.completed = append(f.completed, p.PartNumber)
+			}
+			_, _ = fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>tenant/block/data</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+			f.aborted = true
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut:
+			f.puts++
+			bodySize(t, r)
+			w.Header().Set("ETag", `"etag"`)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	return f
+}
+
+// bodySize drains the request and returns the size of the object or part it carried.  uploads over plain
+// http use chunked signing so the decoded length is sent separately.  every upload carries its md5
+func bodySize(t *testing.T, r *http.Request) int64 {
+	_, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.NotEmpty(t, r.Header.Get("Content-Md5"))
+
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+		size, err := strconv.ParseInt(decoded, 10, 64)
+		require.NoError(t, err)
+		return size
+	}
+	return r.ContentLength
+}
+
+func newFakeReaderWriter(t *testing.T, url string, cfg *Config) *readerWriter {
+	client, err := minio.NewWithOptions(strings.TrimPrefix(url, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	require.NoError(t, err)
+
+	return &readerWriter{
+		logger: log_util.Logger,
+		cfg:    cfg,
+		core:   &minio.Core{Client: client},
+	}
+}
@@ -0,0 +1,22 @@
+package s3
+
+import (
+	"errors"
+
+	"github.com/grafana/tempo/tempodb/backend/retry"
+	"github.com/minio/minio-go/v6"
+)
+
+// IsRetryable is true for throttling, server errors and transient network errors
+func IsRetryable(err error) bool {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		switch resp.Code {
+		case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+			return true
+		}
+		return retry.IsRetryableStatus(resp.StatusCode)
+	}
+
+	return retry.IsTransient(err)
+}
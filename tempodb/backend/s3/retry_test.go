@@ -0,0 +1,19 @@
+package s3
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/minio/minio-go/v6"
+	pkg_errors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(minio.ErrorResponse{Code: "SlowDown", StatusCode: 503}))
+	assert.True(t, IsRetryable(minio.ErrorResponse{Code: "InternalError", StatusCode: 500}))
+	assert.True(t, IsRetryable(pkg_errors.Wrap(minio.ErrorResponse{StatusCode: 502}, "error reading object")))
+	assert.False(t, IsRetryable(minio.ErrorResponse{Code: "NoSuchKey", StatusCode: 404}))
+	assert.False(t, IsRetryable(minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}))
+	assert.False(t, IsRetryable(errors.New("unknown")))
+}
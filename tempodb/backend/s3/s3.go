@@ -3,9 +3,12 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"path"
 	"strings"
 
 	log_util "github.com/cortexproject/cortex/pkg/util"
@@ -13,9 +16,11 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/hedge"
 	"github.com/grafana/tempo/tempodb/backend/util"
 	"github.com/grafana/tempo/tempodb/encoding"
 	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
 	"github.com/pkg/errors"
 )
 
@@ -28,17 +33,36 @@ type readerWriter struct {
 	logger log.Logger
 	cfg    *Config
 	core   *minio.Core
+	hedger *hedge.Hedger
+	sse    encrypt.ServerSide
 }
 
 func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
 	l := log_util.Logger
-	core, err := minio.NewCore(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, !cfg.Insecure)
+	sse, err := newSSE(cfg.SSE)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	// TODO: add custom transport with instrumentation.
-	//client.SetCustomTransport(minio.DefaultTransport(!cfg.Insecure))
+	creds, err := newCredentials(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	client, err := minio.NewWithOptions(cfg.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	core := &minio.Core{Client: client}
+
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	client.SetCustomTransport(transport)
 
 	// make bucket name if doesn't exist already
 	err = core.MakeBucket(cfg.Bucket, cfg.Region)
@@ -59,6 +83,8 @@ func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error)
 		logger: l,
 		cfg:    cfg,
 		core:   core,
+		hedger: hedge.New(cfg.Hedging, "s3"),
+		sse:    sse,
 	}
 	return rw, rw, rw, nil
 }
@@ -70,13 +96,7 @@ func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBl
 	}
 
 	objName := util.ObjectFileName(meta.BlockID, meta.TenantID)
-	size, err := rw.core.FPutObjectWithContext(
-		ctx,
-		rw.cfg.Bucket,
-		objName,
-		objectFilePath,
-		minio.PutObjectOptions{PartSize: rw.cfg.PartSize},
-	)
+	size, err := rw.putFile(ctx, objName, objectFilePath)
 	if err != nil {
 		return errors.Wrapf(err, "error writing object to s3 backend, object %s", objName)
 	}
@@ -112,37 +132,21 @@ func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.Appe
 			completeParts,
 		)
 		if err != nil {
+			rw.abortMultipart(objName, a.uploadID)
 			return errors.Wrapf(err, "error completing multipart upload, object: %s, obj etag: %s", objName, etag)
 		}
 	}
 
 	blockID := meta.BlockID
 	tenantID := meta.TenantID
-	options := minio.PutObjectOptions{
-		PartSize: rw.cfg.PartSize,
-	}
 
-	size, err := rw.core.Client.PutObjectWithContext(
-		ctx,
-		rw.cfg.Bucket,
-		util.BloomFileName(blockID, tenantID),
-		bytes.NewReader(bBloom),
-		int64(len(bBloom)),
-		options,
-	)
+	size, err := rw.putBytes(ctx, util.BloomFileName(blockID, tenantID), bBloom)
 	if err != nil {
 		return err
 	}
 	level.Debug(rw.logger).Log("msg", "block bloom uploaded to s3", "size", size)
 
-	size, err = rw.core.Client.PutObjectWithContext(
-		ctx,
-		rw.cfg.Bucket,
-		util.IndexFileName(blockID, tenantID),
-		bytes.NewReader(bIndex),
-		int64(len(bIndex)),
-		options,
-	)
+	size, err = rw.putBytes(ctx, util.IndexFileName(blockID, tenantID), bIndex)
 	if err != nil {
 		return err
 	}
@@ -154,14 +158,7 @@ func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.Appe
 	}
 
 	// write meta last.  this will prevent blocklist from returning a partial block
-	size, err = rw.core.Client.PutObjectWithContext(
-		ctx,
-		rw.cfg.Bucket,
-		util.MetaFileName(blockID, tenantID),
-		bytes.NewReader(bMeta),
-		int64(len(bMeta)),
-		options,
-	)
+	size, err = rw.putBytes(ctx, util.MetaFileName(blockID, tenantID), bMeta)
 	if err != nil {
 		return err
 	}
@@ -179,9 +176,7 @@ type AppenderTracker struct {
 // AppendObject implements backend.Writer
 func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
 	var a AppenderTracker
-	options := minio.PutObjectOptions{
-		PartSize: rw.cfg.PartSize,
-	}
+	options := rw.putOptions()
 	if tracker != nil {
 		a = tracker.(AppenderTracker)
 	} else {
@@ -207,11 +202,13 @@ func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.Append
 		a.partNum,
 		bytes.NewReader(bObject),
 		int64(len(bObject)),
+		contentMD5(bObject),
 		"",
-		"",
-		nil,
+		rw.sse,
 	)
 	if err != nil {
+		// the compactor abandons the block when an append fails so clean up the parts already uploaded
+		rw.abortMultipart(util.ObjectFileName(meta.BlockID, meta.TenantID), a.uploadID)
 		return a, errors.Wrap(err, "error in multipart upload")
 	}
 	a.parts = append(a.parts, objPart)
@@ -219,6 +216,22 @@ func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.Append
 	return a, nil
 }
 
+// WriteTenantIndex implements backend.Writer
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	size, err := rw.putBytes(ctx, util.TenantIndexFileName(tenantID), bIndex)
+	if err != nil {
+		return errors.Wrapf(err, "error writing tenant index to s3 backend, tenantID: %s", tenantID)
+	}
+	level.Debug(rw.logger).Log("msg", "tenant index uploaded to s3", "tenantID", tenantID, "size", size)
+
+	return nil
+}
+
 // Tenants implements backend.Reader
 func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
 	// ListObjects(bucket, prefix, marker, delimiter string, maxKeys int)
@@ -289,28 +302,55 @@ func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID
 	return rw.readRange(ctx, objFileName, int64(start), buffer)
 }
 
-// Shutdown implements backend.Reader
-func (rw *readerWriter) Shutdown() {
+// ReadRange implements backend.Reader
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.readRange(ctx, util.FileName(blockID, tenantID, name), int64(start), buffer)
 }
 
-func (rw *readerWriter) readAll(ctx context.Context, name string) ([]byte, error) {
-	reader, _, _, err := rw.core.GetObjectWithContext(ctx, rw.cfg.Bucket, name, minio.GetObjectOptions{})
-	if err != nil {
-		// do not change or wrap this error
-		// we need to compare the specific err message
-		return nil, err
+// TenantIndex implements backend.Reader
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	body, err := rw.readAll(ctx, util.TenantIndexFileName(tenantID))
+	if err != nil && err.Error() == s3KeyDoesNotExist {
+		return nil, backend.ErrIndexDoesNotExist
 	}
-	defer reader.Close()
-
-	body, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return nil, err
 	}
-	return body, nil
+
+	return backend.UnmarshalTenantIndex(body)
+}
+
+// Shutdown implements backend.Reader
+func (rw *readerWriter) Shutdown() {
+}
+
+// readAll reads the object in full.  slow reads are hedged separately for each kind of object, e.g. bloom
+// or index
+func (rw *readerWriter) readAll(ctx context.Context, name string) ([]byte, error) {
+	return rw.hedger.Do(ctx, path.Base(name), func(ctx context.Context) ([]byte, error) {
+		reader, _, headers, err := rw.core.GetObjectWithContext(ctx, rw.cfg.Bucket, name, minio.GetObjectOptions{})
+		if err != nil {
+			// do not change or wrap this error
+			// we need to compare the specific err message
+			return nil, err
+		}
+		defer reader.Close()
+
+		err = verifySSE(rw.cfg.SSE, name, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		return body, nil
+	})
 }
 
 func (rw *readerWriter) readAllWithObjInfo(ctx context.Context, name string) ([]byte, minio.ObjectInfo, error) {
-	reader, info, _, err := rw.core.GetObjectWithContext(ctx, rw.cfg.Bucket, name, minio.GetObjectOptions{})
+	reader, info, headers, err := rw.core.GetObjectWithContext(ctx, rw.cfg.Bucket, name, minio.GetObjectOptions{})
 	if err != nil && err.Error() == s3KeyDoesNotExist {
 		return nil, minio.ObjectInfo{}, backend.ErrMetaDoesNotExist
 	} else if err != nil {
@@ -318,6 +358,11 @@ func (rw *readerWriter) readAllWithObjInfo(ctx context.Context, name string) ([]
 	}
 	defer reader.Close()
 
+	err = verifySSE(rw.cfg.SSE, name, headers)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
 	body, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return nil, minio.ObjectInfo{}, errors.Wrap(err, "error reading response from s3 backend")
@@ -326,17 +371,39 @@ func (rw *readerWriter) readAllWithObjInfo(ctx context.Context, name string) ([]
 }
 
 func (rw *readerWriter) readRange(ctx context.Context, objName string, offset int64, buffer []byte) error {
+	if rw.hedger == nil {
+		return rw.readRangeInto(ctx, objName, offset, buffer)
+	}
+
+	// hedged reads can't share the caller's buffer.  the losing read may still be writing to its buffer
+	b, err := rw.hedger.Do(ctx, path.Base(objName), func(ctx context.Context) ([]byte, error) {
+		b := make([]byte, len(buffer))
+		return b, rw.readRangeInto(ctx, objName, offset, b)
+	})
+	if err != nil {
+		return err
+	}
+	copy(buffer, b)
+	return nil
+}
+
+func (rw *readerWriter) readRangeInto(ctx context.Context, objName string, offset int64, buffer []byte) error {
 	options := minio.GetObjectOptions{}
 	err := options.SetRange(offset, offset+int64(len(buffer)))
 	if err != nil {
 		return errors.Wrap(err, "error setting headers for range read in s3")
 	}
-	reader, _, _, err := rw.core.GetObjectWithContext(ctx, rw.cfg.Bucket, objName, options)
+	reader, _, headers, err := rw.core.GetObjectWithContext(ctx, rw.cfg.Bucket, objName, options)
 	if err != nil {
 		return errors.Wrapf(err, "error in range read from s3 backend, bucket: %s, objName: %s", rw.cfg.Bucket, objName)
 	}
 	defer reader.Close()
 
+	err = verifySSE(rw.cfg.SSE, objName, headers)
+	if err != nil {
+		return err
+	}
+
 	totalBytes := 0
 	for {
 		byteCount, err := reader.Read(buffer[totalBytes:])
@@ -352,3 +419,21 @@ func (rw *readerWriter) readRange(ctx context.Context, objName string, offset in
 		totalBytes += byteCount
 	}
 }
+
+// putBytes uploads b to name in a single put.  s3 verifies the upload against the content md5
+func (rw *readerWriter) putBytes(ctx context.Context, name string, b []byte) (int64, error) {
+	info, err := rw.core.PutObjectWithContext(ctx, rw.cfg.Bucket, name, bytes.NewReader(b), int64(len(b)), contentMD5(b), "", rw.putOptions())
+	return info.Size, err
+}
+
+func (rw *readerWriter) putOptions() minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		PartSize:             rw.cfg.PartSize,
+		ServerSideEncryption: rw.sse,
+	}
+}
+
+func contentMD5(b []byte) string {
+	sum := md5.Sum(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
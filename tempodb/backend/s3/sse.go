@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+)
+
+const (
+	SSES3  = "SSE-S3"
+	SSEKMS = "SSE-KMS"
+
+	sseHeader           = "X-Amz-Server-Side-Encryption"
+	sseKMSKeyIDHeader   = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+	sseKMSContextHeader = "X-Amz-Server-Side-Encryption-Context"
+)
+
+type SSEConfig struct {
+	// Type is SSE-S3 or SSE-KMS.  Empty leaves encryption to the bucket's defaults.
+	Type string `yaml:"type"`
+	// KMSKeyID is the kms key used with SSE-KMS.  Empty uses the account's aws managed key.
+	KMSKeyID string `yaml:"kms_key_id"`
+	// KMSEncryptionContext is the optional encryption context used with SSE-KMS
+	KMSEncryptionContext map[string]string `yaml:"kms_encryption_context"`
+}
+
+func newSSE(cfg SSEConfig) (encrypt.ServerSide, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		sse := sseKMS{
+			keyID: cfg.KMSKeyID,
+		}
+		if len(cfg.KMSEncryptionContext) > 0 {
+			b, err := json.Marshal(cfg.KMSEncryptionContext)
+			if err != nil {
+				return nil, err
+			}
+			sse.context = base64.StdEncoding.EncodeToString(b)
+		}
+		return sse, nil
+	default:
+		return nil, fmt.Errorf("unknown s3 server side encryption type %s. expected %s or %s", cfg.Type, SSES3, SSEKMS)
+	}
+}
+
+// sseKMS requests SSE-KMS.  minio's own implementation sends the encryption context in the wrong header.
+type sseKMS struct {
+	keyID   string
+	context string
+}
+
+func (s sseKMS) Type() encrypt.Type { return encrypt.KMS }
+
+func (s sseKMS) Marshal(h http.Header) {
+	h.Set(sseHeader, "aws:kms")
+	if s.keyID != "" {
+		h.Set(sseKMSKeyIDHeader, s.keyID)
+	}
+	if s.context != "" {
+		h.Set(sseKMSContextHeader, s.context)
+	}
+}
+
+// sseHeaders returns the headers that request encryption as a map for calls such as CopyObject that take
+// metadata rather than options
+func sseHeaders(sse encrypt.ServerSide) map[string]string {
+	if sse == nil {
+		return nil
+	}
+
+	h := http.Header{}
+	sse.Marshal(h)
+
+	m := make(map[string]string, len(h))
+	for k := range h {
+		m[k] = h.Get(k)
+	}
+	return m
+}
+
+// verifySSE checks the response headers of a read show the object was encrypted as configured
+func verifySSE(cfg SSEConfig, name string, h http.Header) error {
+	var expected string
+	switch cfg.Type {
+	case SSES3:
+		expected = "AES256"
+	case SSEKMS:
+		expected = "aws:kms"
+	default:
+		return nil
+	}
+
+	if actual := h.Get(sseHeader); actual != expected {
+		return fmt.Errorf("object %s is not encrypted with %s. server side encryption is %q", name, cfg.Type, actual)
+	}
+
+	// s3 returns the key's arn.  aliases can't be checked against it
+	if cfg.Type == SSEKMS && cfg.KMSKeyID != "" && !strings.HasPrefix(cfg.KMSKeyID, "alias/") {
+		if actual := h.Get(sseKMSKeyIDHeader); actual != "" && !strings.HasSuffix(actual, cfg.KMSKeyID) {
+			return fmt.Errorf("object %s is encrypted with kms key %s, not %s", name, actual, cfg.KMSKeyID)
+		}
+	}
+
+	return nil
+}
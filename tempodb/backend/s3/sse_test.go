@@ -0,0 +1,100 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSSE(t *testing.T) {
+	sse, err := newSSE(SSEConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, sse)
+	assert.Nil(t, sseHeaders(sse))
+
+	sse, err = newSSE(SSEConfig{Type: SSES3})
+	require.NoError(t, err)
+	assert.Equal(t, encrypt.S3, sse.Type())
+	assert.Equal(t, map[string]string{sseHeader: "AES256"}, sseHeaders(sse))
+
+	sse, err = newSSE(SSEConfig{Type: SSEKMS, KMSKeyID: "key", KMSEncryptionContext: map[string]string{"app": "tempo"}})
+	require.NoError(t, err)
+	assert.Equal(t, encrypt.KMS, sse.Type())
+	headers := sseHeaders(sse)
+	assert.Equal(t, "aws:kms", headers[sseHeader])
+	assert.Equal(t, "key", headers[sseKMSKeyIDHeader])
+	assert.Equal(t, "eyJhcHAiOiJ0ZW1wbyJ9", headers[sseKMSContextHeader])
+
+	_, err = newSSE(SSEConfig{Type: "SSE-C"})
+	assert.Error(t, err)
+}
+
+func TestVerifySSE(t *testing.T) {
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		cfg     SSEConfig
+		headers http.Header
+		ok      bool
+	}{
+		{
+			name:    "disabled",
+			headers: header(),
+			ok:      true,
+		},
+		{
+			name:    "sse-s3",
+			cfg:     SSEConfig{Type: SSES3},
+			headers: header(sseHeader, "AES256"),
+			ok:      true,
+		},
+		{
+			name:    "unencrypted",
+			cfg:     SSEConfig{Type: SSES3},
+			headers: header(),
+		},
+		{
+			name:    "sse-kms when sse-s3 expected",
+			cfg:     SSEConfig{Type: SSES3},
+			headers: header(sseHeader, "aws:kms"),
+		},
+		{
+			name:    "sse-kms",
+			cfg:     SSEConfig{Type: SSEKMS, KMSKeyID: "1234abcd"},
+			headers: header(sseHeader, "aws:kms", sseKMSKeyIDHeader, "arn:aws:kms:us-east-1:111122223333:key/1234abcd"),
+			ok:      true,
+		},
+		{
+			name:    "sse-kms with another key",
+			cfg:     SSEConfig{Type: SSEKMS, KMSKeyID: "1234abcd"},
+			headers: header(sseHeader, "aws:kms", sseKMSKeyIDHeader, "arn:aws:kms:us-east-1:111122223333:key/5678efgh"),
+		},
+		{
+			name:    "sse-kms with an alias",
+			cfg:     SSEConfig{Type: SSEKMS, KMSKeyID: "alias/tempo"},
+			headers: header(sseHeader, "aws:kms", sseKMSKeyIDHeader, "arn:aws:kms:us-east-1:111122223333:key/5678efgh"),
+			ok:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySSE(tt.cfg, "obj", tt.headers)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/grafana/tempo/tempodb/backend/transport"
+	"github.com/minio/minio-go/v6"
+	"github.com/pkg/errors"
+)
+
+type TLSConfig struct {
+	// CAPath is a pem bundle of the cas trusted in addition to the system's, e.g. the private ca of an on-prem
+	// minio or ceph rgw endpoint
+	CAPath string `yaml:"ca_path"`
+	// CertPath and KeyPath are the client certificate presented to endpoints that require one
+	CertPath string `yaml:"cert_path"`
+	KeyPath  string `yaml:"key_path"`
+	// InsecureSkipVerify disables verification of the endpoint's certificate
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// newTransport is minio's default transport tuned by the transport config with the tls config applied.
+// Insecure endpoints don't use tls and ignore it.
+func newTransport(cfg *Config) (http.RoundTripper, error) {
+	rt, err := minio.DefaultTransport(!cfg.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := transport.Apply(cfg.Transport, rt.(*http.Transport))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Insecure {
+		return tr, nil
+	}
+
+	tlsConfig := tr.TLSClientConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+		tr.TLSClientConfig = tlsConfig
+	}
+	tlsConfig.InsecureSkipVerify = cfg.TLS.InsecureSkipVerify
+
+	if cfg.TLS.CAPath != "" {
+		ca, err := ioutil.ReadFile(cfg.TLS.CAPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading s3 ca")
+		}
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs, err = x509.SystemCertPool()
+			if err != nil {
+				tlsConfig.RootCAs = x509.NewCertPool()
+			}
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in s3 ca %s", cfg.TLS.CAPath)
+		}
+	}
+
+	if cfg.TLS.CertPath != "" || cfg.TLS.KeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertPath, cfg.TLS.KeyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading s3 client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tr, nil
+}
@@ -0,0 +1,85 @@
+package s3
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "s3-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caPath := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caPath, ca, 0644))
+	emptyPath := filepath.Join(dir, "empty.pem")
+	require.NoError(t, ioutil.WriteFile(emptyPath, nil, 0644))
+
+	tests := []struct {
+		name           string
+		cfg            TLSConfig
+		expectErr      bool
+		expectVerified bool
+	}{
+		{
+			name: "system cas only",
+		},
+		{
+			name:           "private ca",
+			cfg:            TLSConfig{CAPath: caPath},
+			expectVerified: true,
+		},
+		{
+			name:           "insecure skip verify",
+			cfg:            TLSConfig{InsecureSkipVerify: true},
+			expectVerified: true,
+		},
+		{
+			name:      "missing ca",
+			cfg:       TLSConfig{CAPath: filepath.Join(dir, "missing.pem")},
+			expectErr: true,
+		},
+		{
+			name:      "empty ca",
+			cfg:       TLSConfig{CAPath: emptyPath},
+			expectErr: true,
+		},
+		{
+			name:      "missing client key",
+			cfg:       TLSConfig{CertPath: caPath},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, err := newTransport(&Config{TLS: tt.cfg})
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			client := &http.Client{Transport: rt}
+			resp, err := client.Get(server.URL)
+			if tt.expectVerified {
+				require.NoError(t, err)
+				resp.Body.Close()
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
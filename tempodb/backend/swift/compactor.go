@@ -0,0 +1,93 @@
+package swift
+
+import (
+	"encoding/json"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	ncw "github.com/ncw/swift"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	// copy meta.json to meta.compacted.json
+	metaFileName := util.MetaFileName(blockID, tenantID)
+	_, err := rw.conn.ObjectCopy(rw.cfg.ContainerName, metaFileName, rw.cfg.ContainerName, util.CompactedMetaFileName(blockID, tenantID), nil)
+	if err != nil {
+		return errors.Wrap(err, "error copying obj meta to compacted obj meta")
+	}
+
+	// delete meta.json
+	return rw.conn.ObjectDelete(rw.cfg.ContainerName, metaFileName)
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	if len(tenantID) == 0 {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
+
+	prefix := util.BlockFileName(blockID, tenantID)
+	level.Debug(rw.logger).Log("msg", "deleting block", "block path", prefix)
+
+	names, err := rw.conn.ObjectNamesAll(rw.cfg.ContainerName, &ncw.ObjectsOpts{
+		Prefix: prefix,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error listing block in swift: %s", prefix)
+	}
+
+	for _, name := range names {
+		// the objects file may be a large object.  this removes its segments as well
+		err = rw.conn.LargeObjectDelete(rw.cfg.ContainerName, name)
+		if err != nil && err != ncw.ObjectNotFound {
+			return errors.Wrapf(err, "error deleting obj from swift: %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return backend.ClearBlocks(rw, blockIDs, tenantID)
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	if len(tenantID) == 0 {
+		return nil, backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return nil, backend.ErrEmptyBlockID
+	}
+
+	compactedMetaFileName := util.CompactedMetaFileName(blockID, tenantID)
+	bytes, modTime, err := rw.readAllWithModTime(compactedMetaFileName)
+	if err == ncw.ObjectNotFound {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching compacted meta file %s", compactedMetaFileName)
+	}
+
+	out := &encoding.CompactedBlockMeta{}
+	err = json.Unmarshal(bytes, out)
+	if err != nil {
+		return nil, err
+	}
+	out.CompactedTime = modTime
+
+	return out, nil
+}
@@ -0,0 +1,35 @@
+package swift
+
+import (
+	"time"
+
+	"github.com/grafana/tempo/tempodb/backend/transport"
+)
+
+type Config struct {
+	AuthURL string `yaml:"auth_url"`
+	// AuthVersion is the keystone version.  0 detects it from the auth url.
+	AuthVersion       int    `yaml:"auth_version"`
+	Username          string `yaml:"username"`
+	UserDomainName    string `yaml:"user_domain_name"`
+	Password          string `yaml:"password"`
+	ProjectName       string `yaml:"project_name"`
+	ProjectDomainName string `yaml:"project_domain_name"`
+	RegionName        string `yaml:"region_name"`
+	// Internal uses the storage endpoint on the service network
+	Internal bool `yaml:"internal"`
+
+	ContainerName string `yaml:"container_name"`
+	// SegmentContainerName holds the segments of large objects.  Defaults to the container name with a
+	// _segments suffix.
+	SegmentContainerName string `yaml:"segment_container_name"`
+	// ChunkSize is the size of the segments large objects are uploaded in.  Objects smaller than this
+	// are uploaded whole.
+	ChunkSize int64 `yaml:"chunk_size"`
+
+	MaxRetries     int           `yaml:"max_retries"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
+	Transport transport.Config `yaml:"transport"`
+}
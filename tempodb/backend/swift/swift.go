@@ -0,0 +1,349 @@
+package swift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	ncw "github.com/ncw/swift"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/transport"
+	"github.com/grafana/tempo/tempodb/backend/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+const defaultChunkSize = 100 * 1024 * 1024
+
+// readerWriter can read/write from a swift backend
+type readerWriter struct {
+	logger log.Logger
+	cfg    *Config
+	conn   *ncw.Connection
+}
+
+func New(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, error) {
+	tr, err := transport.New(cfg.Transport)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	conn := &ncw.Connection{
+		AuthUrl:        cfg.AuthURL,
+		AuthVersion:    cfg.AuthVersion,
+		UserName:       cfg.Username,
+		Domain:         cfg.UserDomainName,
+		ApiKey:         cfg.Password,
+		Tenant:         cfg.ProjectName,
+		TenantDomain:   cfg.ProjectDomainName,
+		Region:         cfg.RegionName,
+		Internal:       cfg.Internal,
+		Retries:        cfg.MaxRetries,
+		ConnectTimeout: cfg.ConnectTimeout,
+		Timeout:        cfg.RequestTimeout,
+		Transport:      tr,
+	}
+
+	err = conn.Authenticate()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot authenticate with swift")
+	}
+
+	rw := &readerWriter{
+		logger: log_util.Logger,
+		cfg:    cfg,
+		conn:   conn,
+	}
+
+	// make containers if they don't exist already.  creating an existing container is a no-op
+	for _, container := range []string{cfg.ContainerName, rw.segmentContainer()} {
+		err = conn.ContainerCreate(container, nil)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "cannot create swift container %s", container)
+		}
+	}
+
+	return rw, rw, rw, nil
+}
+
+// Write implements backend.Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	src, err := os.Open(objectFilePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	objName := util.ObjectFileName(meta.BlockID, meta.TenantID)
+	if info.Size() <= rw.chunkSize() {
+		_, err = rw.conn.ObjectPut(rw.cfg.ContainerName, objName, src, false, "", "", nil)
+	} else {
+		// big blocks exceed swift's maximum object size and are uploaded in segments
+		var w ncw.LargeObjectFile
+		w, err = rw.largeObjectWriter(objName)
+		if err == nil {
+			_, err = io.Copy(w, src)
+			if closeErr := w.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error writing object to swift backend, object %s", objName)
+	}
+
+	level.Debug(rw.logger).Log("msg", "object uploaded to swift", "objectName", objName, "size", info.Size())
+
+	return rw.WriteBlockMeta(ctx, nil, meta, bBloom, bIndex)
+}
+
+// WriteBlockMeta implements backend.Writer
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	if tracker != nil {
+		// closing writes the last segment and the manifest
+		w := tracker.(ncw.LargeObjectFile)
+		err := w.Close()
+		if err != nil {
+			return errors.Wrap(err, "error completing large object upload")
+		}
+	}
+
+	blockID := meta.BlockID
+	tenantID := meta.TenantID
+
+	err := rw.conn.ObjectPutBytes(rw.cfg.ContainerName, util.BloomFileName(blockID, tenantID), bBloom, "")
+	if err != nil {
+		return err
+	}
+
+	err = rw.conn.ObjectPutBytes(rw.cfg.ContainerName, util.IndexFileName(blockID, tenantID), bIndex, "")
+	if err != nil {
+		return err
+	}
+
+	bMeta, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// write meta last.  this will prevent blocklist from returning a partial block
+	return rw.conn.ObjectPutBytes(rw.cfg.ContainerName, util.MetaFileName(blockID, tenantID), bMeta, "")
+}
+
+// AppendObject implements backend.Writer.  compacted blocks are always written as large objects
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	var w ncw.LargeObjectFile
+	if tracker == nil {
+		var err error
+		w, err = rw.largeObjectWriter(util.ObjectFileName(meta.BlockID, meta.TenantID))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		w = tracker.(ncw.LargeObjectFile)
+	}
+
+	_, err := w.Write(bObject)
+	if err != nil {
+		return nil, errors.Wrap(err, "error appending to large object")
+	}
+
+	return w, nil
+}
+
+// WriteTenantIndex implements backend.Writer
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	bIndex, err := backend.NewTenantIndex(meta, compactedMeta).Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = rw.conn.ObjectPutBytes(rw.cfg.ContainerName, util.TenantIndexFileName(tenantID), bIndex, "")
+	if err != nil {
+		return errors.Wrapf(err, "error writing tenant index to swift backend, tenantID: %s", tenantID)
+	}
+
+	return nil
+}
+
+// Tenants implements backend.Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	dirs, err := rw.listDirs("")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing tenants in container %s", rw.cfg.ContainerName)
+	}
+
+	return dirs, nil
+}
+
+// Blocks implements backend.Reader
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	dirs, err := rw.listDirs(tenantID + "/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing blocks in swift container, container: %s", rw.cfg.ContainerName)
+	}
+
+	blockIDs := make([]uuid.UUID, 0, len(dirs))
+	for _, d := range dirs {
+		blockID, err := uuid.Parse(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing uuid of obj, objectName: %s", d)
+		}
+		blockIDs = append(blockIDs, blockID)
+	}
+	return blockIDs, nil
+}
+
+// BlockMeta implements backend.Reader
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	body, err := rw.conn.ObjectGetBytes(rw.cfg.ContainerName, util.MetaFileName(blockID, tenantID))
+	if err == ncw.ObjectNotFound {
+		return nil, backend.ErrMetaDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := &encoding.BlockMeta{}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Bloom implements backend.Reader
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.conn.ObjectGetBytes(rw.cfg.ContainerName, util.BloomFileName(blockID, tenantID))
+}
+
+// Index implements backend.Reader
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return rw.conn.ObjectGetBytes(rw.cfg.ContainerName, util.IndexFileName(blockID, tenantID))
+}
+
+// Object implements backend.Reader
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.ReadRange(ctx, backend.ObjectName, blockID, tenantID, start, buffer)
+}
+
+// ReadRange implements backend.Reader
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	objName := util.FileName(blockID, tenantID, name)
+	headers := ncw.Headers{
+		"Range": fmt.Sprintf("bytes=%d-%d", start, start+uint64(len(buffer))-1),
+	}
+
+	f, _, err := rw.conn.ObjectOpen(rw.cfg.ContainerName, objName, false, headers)
+	if err != nil {
+		return errors.Wrapf(err, "error in range read from swift backend, container: %s, objName: %s", rw.cfg.ContainerName, objName)
+	}
+	defer f.Close()
+
+	_, err = io.ReadFull(f, buffer)
+	if err == io.ErrUnexpectedEOF {
+		// the last read of a block may run past the end of the object
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error in range read from swift backend")
+	}
+	return nil
+}
+
+// TenantIndex implements backend.Reader
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	body, err := rw.conn.ObjectGetBytes(rw.cfg.ContainerName, util.TenantIndexFileName(tenantID))
+	if err == ncw.ObjectNotFound {
+		return nil, backend.ErrIndexDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UnmarshalTenantIndex(body)
+}
+
+// Shutdown implements backend.Reader
+func (rw *readerWriter) Shutdown() {
+}
+
+// listDirs returns the names of the pseudo directories directly below prefix
+func (rw *readerWriter) listDirs(prefix string) ([]string, error) {
+	names, err := rw.conn.ObjectNamesAll(rw.cfg.ContainerName, &ncw.ObjectsOpts{
+		Prefix:    prefix,
+		Delimiter: '/',
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, 0, len(names))
+	for _, n := range names {
+		// objects at this level, e.g. the tenant index, are not directories
+		if !strings.HasSuffix(n, "/") {
+			continue
+		}
+		dirs = append(dirs, strings.TrimSuffix(strings.TrimPrefix(n, prefix), "/"))
+	}
+	return dirs, nil
+}
+
+func (rw *readerWriter) largeObjectWriter(objName string) (ncw.LargeObjectFile, error) {
+	return rw.conn.StaticLargeObjectCreate(&ncw.LargeObjectOpts{
+		Container:        rw.cfg.ContainerName,
+		ObjectName:       objName,
+		ChunkSize:        rw.chunkSize(),
+		SegmentContainer: rw.segmentContainer(),
+	})
+}
+
+func (rw *readerWriter) readAllWithModTime(name string) ([]byte, time.Time, error) {
+	f, headers, err := rw.conn.ObjectOpen(rw.cfg.ContainerName, name, false, nil)
+	if err != nil {
+		// do not wrap this error.  callers compare it to ObjectNotFound
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	modTime, err := http.ParseTime(headers["Last-Modified"])
+	if err != nil {
+		return nil, time.Time{}, errors.Wrapf(err, "error parsing last modified time of %s", name)
+	}
+	return body, modTime, nil
+}
+
+func (rw *readerWriter) chunkSize() int64 {
+	if rw.cfg.ChunkSize <= 0 {
+		return defaultChunkSize
+	}
+	return rw.cfg.ChunkSize
+}
+
+func (rw *readerWriter) segmentContainer() string {
+	if rw.cfg.SegmentContainerName == "" {
+		return rw.cfg.ContainerName + "_segments"
+	}
+	return rw.cfg.SegmentContainerName
+}
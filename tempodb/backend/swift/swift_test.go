@@ -0,0 +1,492 @@
+package swift
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	ncw "github.com/ncw/swift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+func TestReadWrite(t *testing.T) {
+	server := newFakeSwift()
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, 8)
+	ctx := context.Background()
+
+	blockID := uuid.New()
+	tenantID := "fake"
+	meta := &encoding.BlockMeta{
+		BlockID:  blockID,
+		TenantID: tenantID,
+	}
+
+	// appends are uploaded as a static large object in chunk sized segments
+	tracker, err := rw.AppendObject(ctx, nil, meta, []byte("0123456789"))
+	require.NoError(t, err)
+	tracker, err = rw.AppendObject(ctx, tracker, meta, []byte("abcdefghij"))
+	require.NoError(t, err)
+	err = rw.WriteBlockMeta(ctx, tracker, meta, []byte("bloom"), []byte("index"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, server.containerObjects("container_segments"))
+
+	actualMeta, err := rw.BlockMeta(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, meta, actualMeta)
+
+	bloom, err := rw.Bloom(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bloom"), bloom)
+
+	index, err := rw.Index(ctx, blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("index"), index)
+
+	// range reads span segments and may run past the end of the object
+	buffer := make([]byte, 6)
+	err = rw.Object(ctx, blockID, tenantID, 5, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("56789a"), buffer)
+	assert.Equal(t, "bytes=5-10", server.lastRange())
+
+	buffer = make([]byte, 10)
+	err = rw.Object(ctx, blockID, tenantID, 15, buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fghij"), buffer[:5])
+
+	tenants, err := rw.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tenantID}, tenants)
+
+	blocks, err := rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{blockID}, blocks)
+
+	// compaction
+	err = rw.MarkBlockCompacted(blockID, tenantID)
+	require.NoError(t, err)
+	_, err = rw.BlockMeta(ctx, blockID, tenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	compactedMeta, err := rw.CompactedBlockMeta(blockID, tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, *meta, compactedMeta.BlockMeta)
+	assert.False(t, compactedMeta.CompactedTime.IsZero())
+
+	// clearing the block removes the segments of the large object as well
+	err = rw.ClearBlock(blockID, tenantID)
+	require.NoError(t, err)
+	blocks, err = rw.Blocks(ctx, tenantID)
+	require.NoError(t, err)
+	assert.Len(t, blocks, 0)
+	assert.Len(t, server.containerObjects("container_segments"), 0)
+}
+
+func TestWrite(t *testing.T) {
+	server := newFakeSwift()
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, 8)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		object   string
+		segments int
+	}{
+		{
+			name:     "small object",
+			object:   "01234567",
+			segments: 0,
+		},
+		{
+			name:     "large object",
+			object:   "0123456789abcdefghij",
+			segments: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("/tmp", "")
+			require.NoError(t, err)
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(tt.object)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			meta := &encoding.BlockMeta{
+				BlockID:  uuid.New(),
+				TenantID: "fake",
+			}
+			err = rw.Write(ctx, meta, []byte("bloom"), []byte("index"), f.Name())
+			require.NoError(t, err)
+
+			buffer := make([]byte, len(tt.object))
+			err = rw.Object(ctx, meta.BlockID, meta.TenantID, 0, buffer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.object, string(buffer))
+
+			actualMeta, err := rw.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+			require.NoError(t, err)
+			assert.Equal(t, meta, actualMeta)
+
+			assert.Len(t, server.containerObjects("container_segments"), tt.segments)
+			require.NoError(t, rw.ClearBlock(meta.BlockID, meta.TenantID))
+		})
+	}
+}
+
+func TestTenantIndex(t *testing.T) {
+	server := newFakeSwift()
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, 0)
+	ctx := context.Background()
+
+	_, err := rw.TenantIndex(ctx, "fake")
+	assert.Equal(t, backend.ErrIndexDoesNotExist, err)
+
+	meta := []*encoding.BlockMeta{encoding.NewBlockMeta("fake", uuid.New())}
+	err = rw.WriteTenantIndex(ctx, "fake", meta, nil)
+	require.NoError(t, err)
+
+	index, err := rw.TenantIndex(ctx, "fake")
+	require.NoError(t, err)
+	require.Len(t, index.Meta, 1)
+	assert.Equal(t, meta[0].BlockID, index.Meta[0].BlockID)
+
+	// the tenant index sits next to the blocks and is not listed as one
+	blocks, err := rw.Blocks(ctx, "fake")
+	require.NoError(t, err)
+	assert.Len(t, blocks, 0)
+}
+
+func TestErrors(t *testing.T) {
+	server := newFakeSwift()
+	defer server.Close()
+
+	rw := newTestReaderWriter(t, server, 0)
+	ctx := context.Background()
+	blockID := uuid.New()
+
+	// missing objects map to the backend errors
+	_, err := rw.BlockMeta(ctx, blockID, "fake")
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	_, err = rw.CompactedBlockMeta(blockID, "fake")
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+	_, err = rw.TenantIndex(ctx, "fake")
+	assert.Equal(t, backend.ErrIndexDoesNotExist, err)
+
+	// clearing a block that does not exist is not an error
+	assert.NoError(t, rw.ClearBlock(blockID, "fake"))
+
+	// other failures are passed on
+	server.setStatus(http.StatusForbidden)
+	_, err = rw.BlockMeta(ctx, blockID, "fake")
+	assert.Equal(t, ncw.Forbidden, err)
+
+	server.setStatus(http.StatusInternalServerError)
+	_, err = rw.Bloom(ctx, blockID, "fake")
+	assert.Error(t, err)
+	assert.NotEqual(t, backend.ErrMetaDoesNotExist, err)
+	err = rw.Object(ctx, blockID, "fake", 0, make([]byte, 10))
+	assert.Error(t, err)
+	_, err = rw.Tenants(ctx)
+	assert.Error(t, err)
+	err = rw.WriteTenantIndex(ctx, "fake", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := newFakeSwift()
+	defer server.Close()
+
+	// the containers are created on startup
+	newTestReaderWriter(t, server, 0)
+	server.mtx.Lock()
+	assert.Contains(t, server.containers, "container")
+	assert.Contains(t, server.containers, "container_segments")
+	server.mtx.Unlock()
+
+	_, _, _, err := New(&Config{
+		AuthURL:       server.URL + "/auth/v1.0",
+		AuthVersion:   1,
+		Username:      "user",
+		Password:      "wrong",
+		ContainerName: "container",
+	})
+	assert.Error(t, err)
+}
+
+func newTestReaderWriter(t *testing.T, server *fakeSwift, chunkSize int64) *readerWriter {
+	r, _, _, err := New(&Config{
+		AuthURL:       server.URL + "/auth/v1.0",
+		AuthVersion:   1,
+		Username:      "user",
+		Password:      "key",
+		ContainerName: "container",
+		ChunkSize:     chunkSize,
+	})
+	require.NoError(t, err)
+
+	return r.(*readerWriter)
+}
+
+// fakeSwift is an in memory swift that implements v1 auth and the calls the backend makes.  static large
+// objects are stored as their manifest and assembled on read.
+type fakeSwift struct {
+	*httptest.Server
+
+	mtx        sync.Mutex
+	status     int
+	ranges     []string
+	containers map[string]map[string][]byte
+	manifests  map[string][]sloSegment
+}
+
+type sloSegment struct {
+	Path string `json:"path"`
+	Etag string `json:"etag"`
+	Size int64  `json:"size_bytes"`
+}
+
+func newFakeSwift() *fakeSwift {
+	f := &fakeSwift{
+		containers: map[string]map[string][]byte{},
+		manifests:  map[string][]sloSegment{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// setStatus fails every storage request with status
+func (f *fakeSwift) setStatus(status int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.status = status
+}
+
+func (f *fakeSwift) lastRange() string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if len(f.ranges) == 0 {
+		return ""
+	}
+	return f.ranges[len(f.ranges)-1]
+}
+
+func (f *fakeSwift) containerObjects(container string) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var names []string
+	for name := range f.containers[container] {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (f *fakeSwift) handle(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	switch r.URL.Path {
+	case "/auth/v1.0":
+		if r.Header.Get("X-Auth-User") != "user" || r.Header.Get("X-Auth-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Storage-Url", f.URL+"/v1/AUTH_test")
+		w.Header().Set("X-Auth-Token", "token")
+		return
+	case "/info":
+		_, _ = w.Write([]byte(`{"slo": {"min_segment_size": 1}}`))
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/AUTH_test/"), "/", 2)
+	container := parts[0]
+	if len(parts) == 1 {
+		f.handleContainer(w, r, container)
+		return
+	}
+
+	objects, ok := f.containers[container]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := parts[1]
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch r.Method {
+	case http.MethodPut:
+		if query.Get("multipart-manifest") == "put" {
+			var segments []sloSegment
+			if err := json.Unmarshal(body, &segments); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.manifests[container+"/"+name] = segments
+			body = nil
+		}
+		objects[name] = body
+		w.Header().Set("Etag", etag(body))
+		w.WriteHeader(http.StatusCreated)
+	case "COPY":
+		obj, ok := objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		dst := strings.SplitN(r.Header.Get("Destination"), "/", 2)
+		f.containers[dst[0]][dst[1]] = obj
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(objects, name)
+		delete(f.manifests, container+"/"+name)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodHead, http.MethodGet:
+		obj, ok := objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		segments, isSLO := f.manifests[container+"/"+name]
+		if isSLO && query.Get("multipart-manifest") == "get" {
+			f.writeManifest(w, segments)
+			return
+		}
+		if isSLO {
+			w.Header().Set("X-Static-Large-Object", "True")
+			obj = nil
+			for _, s := range segments {
+				p := strings.SplitN(s.Path, "/", 2)
+				obj = append(obj, f.containers[p[0]][p[1]]...)
+			}
+		}
+
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Etag", etag(obj))
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			f.ranges = append(f.ranges, rng)
+			var start, end int
+			_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if end >= len(obj) {
+				end = len(obj) - 1
+			}
+			obj = obj[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeSwift) handleContainer(w http.ResponseWriter, r *http.Request, container string) {
+	switch r.Method {
+	case http.MethodPut:
+		if _, ok := f.containers[container]; !ok {
+			f.containers[container] = map[string][]byte{}
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		objects, ok := f.containers[container]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.list(w, objects, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"), r.URL.Query().Get("marker"))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list writes the names below prefix one per line.  with a delimiter names are rolled up into pseudo
+// directories that end in the delimiter
+func (f *fakeSwift) list(w http.ResponseWriter, objects map[string][]byte, prefix string, delimiter string, marker string) {
+	entries := map[string]struct{}{}
+	for k := range objects {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, prefix)
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			entries[prefix+rest[:i+1]] = struct{}{}
+		} else {
+			entries[k] = struct{}{}
+		}
+	}
+
+	sorted := make([]string, 0, len(entries))
+	for e := range entries {
+		if e > marker {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Strings(sorted)
+
+	for _, e := range sorted {
+		_, _ = fmt.Fprintln(w, e)
+	}
+}
+
+func (f *fakeSwift) writeManifest(w http.ResponseWriter, segments []sloSegment) {
+	type manifestEntry struct {
+		Name  string `json:"name"`
+		Hash  string `json:"hash"`
+		Bytes int64  `json:"bytes"`
+	}
+
+	entries := make([]manifestEntry, 0, len(segments))
+	for _, s := range segments {
+		entries = append(entries, manifestEntry{
+			Name:  "/" + s.Path,
+			Hash:  s.Etag,
+			Bytes: s.Size,
+		})
+	}
+	b, _ := json.Marshal(entries)
+	w.Header().Set("Etag", etag(b))
+	_, _ = w.Write(b)
+}
+
+func etag(b []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(b))
+}
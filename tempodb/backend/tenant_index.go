@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+// TenantIndexName is the name of the tenant index object stored at the root of each tenant
+const TenantIndexName = "index.json"
+
+var ErrIndexDoesNotExist = fmt.Errorf("tenant index does not exist")
+
+// TenantIndex is a snapshot of a tenant's blocklist.  It is written periodically by one poller so every
+// other component can read a single object instead of listing the tenant and reading the meta of every
+// block.
+type TenantIndex struct {
+	CreatedAt     time.Time
+	Meta          []*encoding.BlockMeta
+	CompactedMeta []*encoding.CompactedBlockMeta
+}
+
+// compactedIndexEntry preserves CompactedTime which is normally derived from the compacted meta's
+// modification time and not serialized
+type compactedIndexEntry struct {
+	encoding.BlockMeta
+	CompactedTime time.Time `json:"compactedTime"`
+}
+
+// MarshalJSON keeps CompactedTime alongside the fields of the meta.  Without it the meta's marshalling would be
+// promoted and drop it.
+func (e *compactedIndexEntry) MarshalJSON() ([]byte, error) {
+	meta, err := json.Marshal(&e.BlockMeta)
+	if err != nil {
+		return nil, err
+	}
+	compactedTime, err := json.Marshal(e.CompactedTime)
+	if err != nil {
+		return nil, err
+	}
+	return encoding.AppendJSONFields(meta, `"compactedTime":`+string(compactedTime)), nil
+}
+
+func (e *compactedIndexEntry) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, &e.BlockMeta)
+	if err != nil {
+		return err
+	}
+	compacted := struct {
+		CompactedTime time.Time `json:"compactedTime"`
+	}{}
+	err = json.Unmarshal(data, &compacted)
+	if err != nil {
+		return err
+	}
+	e.CompactedTime = compacted.CompactedTime
+	return nil
+}
+
+type tenantIndexJSON struct {
+	CreatedAt     time.Time              `json:"createdAt"`
+	Meta          []*encoding.BlockMeta  `json:"meta"`
+	CompactedMeta []*compactedIndexEntry `json:"compacted"`
+}
+
+func NewTenantIndex(meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) *TenantIndex {
+	return &TenantIndex{
+		CreatedAt:     time.Now(),
+		Meta:          meta,
+		CompactedMeta: compactedMeta,
+	}
+}
+
+func (i *TenantIndex) Marshal() ([]byte, error) {
+	out := tenantIndexJSON{
+		CreatedAt:     i.CreatedAt,
+		Meta:          i.Meta,
+		CompactedMeta: make([]*compactedIndexEntry, 0, len(i.CompactedMeta)),
+	}
+	for _, c := range i.CompactedMeta {
+		out.CompactedMeta = append(out.CompactedMeta, &compactedIndexEntry{
+			BlockMeta:     c.BlockMeta,
+			CompactedTime: c.CompactedTime,
+		})
+	}
+
+	return json.Marshal(out)
+}
+
+func UnmarshalTenantIndex(b []byte) (*TenantIndex, error) {
+	in := tenantIndexJSON{}
+	err := json.Unmarshal(b, &in)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &TenantIndex{
+		CreatedAt:     in.CreatedAt,
+		Meta:          in.Meta,
+		CompactedMeta: make([]*encoding.CompactedBlockMeta, 0, len(in.CompactedMeta)),
+	}
+	for _, c := range in.CompactedMeta {
+		i.CompactedMeta = append(i.CompactedMeta, &encoding.CompactedBlockMeta{
+			BlockMeta:     c.BlockMeta,
+			CompactedTime: c.CompactedTime,
+		})
+	}
+
+	return i, nil
+}
@@ -0,0 +1,319 @@
+package tiered
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/pkg/util"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/pkg/errors"
+)
+
+// Cold is the tier recorded in the meta of blocks moved to the cold backend
+const Cold = "cold"
+
+// ReaderWriter reads blocks from whichever of the hot and cold backends they are in.  New blocks are always
+// written to the hot backend and are later moved to the cold one with Migrate.
+type ReaderWriter struct {
+	logger log.Logger
+
+	hotReader    backend.Reader
+	hotWriter    backend.Writer
+	hotCompactor backend.Compactor
+
+	coldReader    backend.Reader
+	coldWriter    backend.Writer
+	coldCompactor backend.Compactor
+
+	// blocks whose meta was last seen in the cold tier.  blocks read before another process moved them are
+	// found in the cold tier when reading them from the hot one fails
+	mtx  sync.RWMutex
+	cold map[uuid.UUID]struct{}
+}
+
+// New lists blocks in both backends and routes reads of a block to the backend its meta was found in.
+func New(hotReader backend.Reader, hotWriter backend.Writer, hotCompactor backend.Compactor, coldReader backend.Reader, coldWriter backend.Writer, coldCompactor backend.Compactor, logger log.Logger) *ReaderWriter {
+	return &ReaderWriter{
+		logger:        logger,
+		hotReader:     hotReader,
+		hotWriter:     hotWriter,
+		hotCompactor:  hotCompactor,
+		coldReader:    coldReader,
+		coldWriter:    coldWriter,
+		coldCompactor: coldCompactor,
+		cold:          map[uuid.UUID]struct{}{},
+	}
+}
+
+// Reader
+func (rw *ReaderWriter) Tenants(ctx context.Context) ([]string, error) {
+	hot, err := rw.hotReader.Tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := rw.coldReader.Tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(hot))
+	for _, t := range hot {
+		seen[t] = struct{}{}
+	}
+	for _, t := range cold {
+		if _, ok := seen[t]; !ok {
+			hot = append(hot, t)
+		}
+	}
+	return hot, nil
+}
+
+func (rw *ReaderWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	hot, err := rw.hotReader.Blocks(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := rw.coldReader.Blocks(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a block being migrated is briefly in both
+	seen := make(map[uuid.UUID]struct{}, len(hot))
+	for _, b := range hot {
+		seen[b] = struct{}{}
+	}
+	for _, b := range cold {
+		if _, ok := seen[b]; !ok {
+			hot = append(hot, b)
+		}
+	}
+	return hot, nil
+}
+
+func (rw *ReaderWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	meta, err := rw.hotReader.BlockMeta(ctx, blockID, tenantID)
+	if err == nil {
+		rw.setCold(blockID, false)
+		return meta, nil
+	}
+	if err != backend.ErrMetaDoesNotExist {
+		return nil, err
+	}
+
+	meta, err = rw.coldReader.BlockMeta(ctx, blockID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	meta.Tier = Cold
+	rw.setCold(blockID, true)
+	return meta, nil
+}
+
+func (rw *ReaderWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	var bloom []byte
+	err := rw.read(ctx, blockID, tenantID, func(r backend.Reader) error {
+		var err error
+		bloom, err = r.Bloom(ctx, blockID, tenantID)
+		return err
+	})
+	return bloom, err
+}
+
+func (rw *ReaderWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	var index []byte
+	err := rw.read(ctx, blockID, tenantID, func(r backend.Reader) error {
+		var err error
+		index, err = r.Index(ctx, blockID, tenantID)
+		return err
+	})
+	return index, err
+}
+
+func (rw *ReaderWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.read(ctx, blockID, tenantID, func(r backend.Reader) error {
+		return r.Object(ctx, blockID, tenantID, start, buffer)
+	})
+}
+
+func (rw *ReaderWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return rw.read(ctx, blockID, tenantID, func(r backend.Reader) error {
+		return r.ReadRange(ctx, name, blockID, tenantID, start, buffer)
+	})
+}
+
+// TenantIndex is only kept in the hot backend.  The metas in it record which tier each block is in.
+func (rw *ReaderWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	index, err := rw.hotReader.TenantIndex(ctx, tenantID)
+	if err == nil {
+		for _, meta := range index.Meta {
+			rw.setCold(meta.BlockID, meta.Tier == Cold)
+		}
+		for _, meta := range index.CompactedMeta {
+			rw.setCold(meta.BlockID, meta.Tier == Cold)
+		}
+	}
+	return index, err
+}
+
+func (rw *ReaderWriter) Shutdown() {
+	rw.hotReader.Shutdown()
+	rw.coldReader.Shutdown()
+}
+
+// Writer
+func (rw *ReaderWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return rw.hotWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+}
+
+func (rw *ReaderWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	return rw.hotWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+}
+
+func (rw *ReaderWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return rw.hotWriter.AppendObject(ctx, tracker, meta, bObject)
+}
+
+func (rw *ReaderWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return rw.hotWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+}
+
+// Compactor
+func (rw *ReaderWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return rw.compactor(blockID).MarkBlockCompacted(blockID, tenantID)
+}
+
+func (rw *ReaderWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	err := rw.compactor(blockID).ClearBlock(blockID, tenantID)
+	if err == nil {
+		rw.setCold(blockID, false)
+	}
+	return err
+}
+
+// ClearBlocks splits the blocks by tier and clears each tier's blocks together
+func (rw *ReaderWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	var hot, cold []uuid.UUID
+	for _, blockID := range blockIDs {
+		if rw.isCold(blockID) {
+			cold = append(cold, blockID)
+		} else {
+			hot = append(hot, blockID)
+		}
+	}
+
+	errs := util.MultiError{}
+	errs.Add(rw.clearTier(rw.hotCompactor, hot, tenantID))
+	errs.Add(rw.clearTier(rw.coldCompactor, cold, tenantID))
+	return errs.Err()
+}
+
+func (rw *ReaderWriter) clearTier(c backend.Compactor, blockIDs []uuid.UUID, tenantID string) error {
+	if len(blockIDs) == 0 {
+		return nil
+	}
+
+	err := c.ClearBlocks(blockIDs, tenantID)
+	if err == nil {
+		for _, blockID := range blockIDs {
+			rw.setCold(blockID, false)
+		}
+	}
+	return err
+}
+
+func (rw *ReaderWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	meta, err := rw.hotCompactor.CompactedBlockMeta(blockID, tenantID)
+	if err == nil {
+		rw.setCold(blockID, false)
+		return meta, nil
+	}
+	if err != backend.ErrMetaDoesNotExist {
+		return nil, err
+	}
+
+	meta, err = rw.coldCompactor.CompactedBlockMeta(blockID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	meta.Tier = Cold
+	rw.setCold(blockID, true)
+	return meta, nil
+}
+
+// Migrate copies a block from the hot backend to the cold one and then removes it from the hot backend.  The
+// cold meta is written last so the block is never listed in the cold backend half copied.  It returns false for
+// blocks that are no longer in the hot backend because they have already been moved.
+func (rw *ReaderWriter) Migrate(ctx context.Context, meta *encoding.BlockMeta) (bool, error) {
+	hotMeta, err := rw.hotReader.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	if err == backend.ErrMetaDoesNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	hotMeta.Tier = Cold
+	err = backend.CopyBlock(ctx, rw.hotReader, rw.coldWriter, hotMeta)
+	if err != nil {
+		return false, err
+	}
+	rw.setCold(meta.BlockID, true)
+
+	err = rw.hotCompactor.ClearBlock(meta.BlockID, meta.TenantID)
+	if err != nil {
+		// the block is read from the cold tier from now on.  the hot copy is cleared on the next attempt
+		return false, errors.Wrap(err, "error clearing hot copy")
+	}
+
+	level.Info(rw.logger).Log("msg", "moved block to the cold tier", "blockID", meta.BlockID, "tenantID", meta.TenantID, "size", hotMeta.Size)
+	return true, nil
+}
+
+// read calls fn with the backend the block is believed to be in.  a block believed hot that fails to read may
+// have been moved by another process since its meta was read, in which case it's read from the cold backend.
+func (rw *ReaderWriter) read(ctx context.Context, blockID uuid.UUID, tenantID string, fn func(r backend.Reader) error) error {
+	if rw.isCold(blockID) {
+		return fn(rw.coldReader)
+	}
+
+	err := fn(rw.hotReader)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	if _, coldErr := rw.coldReader.BlockMeta(ctx, blockID, tenantID); coldErr != nil {
+		return err
+	}
+	rw.setCold(blockID, true)
+	return fn(rw.coldReader)
+}
+
+func (rw *ReaderWriter) compactor(blockID uuid.UUID) backend.Compactor {
+	if rw.isCold(blockID) {
+		return rw.coldCompactor
+	}
+	return rw.hotCompactor
+}
+
+func (rw *ReaderWriter) isCold(blockID uuid.UUID) bool {
+	rw.mtx.RLock()
+	defer rw.mtx.RUnlock()
+
+	_, ok := rw.cold[blockID]
+	return ok
+}
+
+func (rw *ReaderWriter) setCold(blockID uuid.UUID, cold bool) {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+
+	if cold {
+		rw.cold[blockID] = struct{}{}
+	} else {
+		delete(rw.cold, blockID)
+	}
+}
@@ -0,0 +1,140 @@
+package tiered
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tiers struct {
+	hotR  backend.Reader
+	hotW  backend.Writer
+	hotC  backend.Compactor
+	coldR backend.Reader
+	coldW backend.Writer
+	coldC backend.Compactor
+}
+
+func newTiers(t *testing.T, dir string) *tiers {
+	ts := &tiers{}
+	var err error
+	ts.hotR, ts.hotW, ts.hotC, err = local.New(&local.Config{Path: path.Join(dir, "hot")})
+	require.NoError(t, err)
+	ts.coldR, ts.coldW, ts.coldC, err = local.New(&local.Config{Path: path.Join(dir, "cold")})
+	require.NoError(t, err)
+	return ts
+}
+
+func (ts *tiers) new() *ReaderWriter {
+	return New(ts.hotR, ts.hotW, ts.hotC, ts.coldR, ts.coldW, ts.coldC, log.NewNopLogger())
+}
+
+func TestMigrate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	ts := newTiers(t, tempDir)
+	rw := ts.new()
+	ctx := context.Background()
+
+	bloom := []byte("bloom")
+	index := []byte("index")
+	object := make([]byte, 16*1024*1024+100) // more than one chunk
+	rand.Read(object)
+
+	objectFile := path.Join(tempDir, "object")
+	require.NoError(t, ioutil.WriteFile(objectFile, object, 0644))
+
+	meta := encoding.NewBlockMeta("tenant", uuid.New())
+	meta.Size = uint64(len(object))
+	require.NoError(t, rw.Write(ctx, meta, bloom, index, objectFile))
+
+	// a second reader that saw the block in the hot tier before it was moved
+	stale := ts.new()
+	staleMeta, err := stale.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, "", staleMeta.Tier)
+
+	moved, err := rw.Migrate(ctx, meta)
+	require.NoError(t, err)
+	assert.True(t, moved)
+
+	// gone from the hot tier
+	_, err = ts.hotR.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+
+	// moving it again is a noop
+	moved, err = rw.Migrate(ctx, meta)
+	require.NoError(t, err)
+	assert.False(t, moved)
+
+	for _, r := range []backend.Reader{rw, stale, ts.new()} {
+		actualBloom, err := r.Bloom(ctx, meta.BlockID, meta.TenantID)
+		require.NoError(t, err)
+		assert.Equal(t, bloom, actualBloom)
+
+		actualIndex, err := r.Index(ctx, meta.BlockID, meta.TenantID)
+		require.NoError(t, err)
+		assert.Equal(t, index, actualIndex)
+
+		actualObject := make([]byte, len(object))
+		require.NoError(t, r.ReadRange(ctx, backend.ObjectName, meta.BlockID, meta.TenantID, 0, actualObject))
+		assert.Equal(t, object, actualObject)
+
+		blocks, err := r.Blocks(ctx, meta.TenantID)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{meta.BlockID}, blocks)
+
+		actualMeta, err := r.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+		require.NoError(t, err)
+		assert.Equal(t, Cold, actualMeta.Tier)
+	}
+
+	// compacting and clearing the block happens in the cold tier
+	require.NoError(t, rw.MarkBlockCompacted(meta.BlockID, meta.TenantID))
+	compactedMeta, err := rw.CompactedBlockMeta(meta.BlockID, meta.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, Cold, compactedMeta.Tier)
+
+	require.NoError(t, rw.ClearBlock(meta.BlockID, meta.TenantID))
+	blocks, err := ts.coldR.Blocks(ctx, meta.TenantID)
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+}
+
+func TestMigrateUnknownSize(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	ts := newTiers(t, tempDir)
+	rw := ts.new()
+	ctx := context.Background()
+
+	objectFile := path.Join(tempDir, "object")
+	require.NoError(t, ioutil.WriteFile(objectFile, []byte("object"), 0644))
+
+	meta := encoding.NewBlockMeta("tenant", uuid.New())
+	require.NoError(t, rw.Write(ctx, meta, []byte("bloom"), []byte("index"), objectFile))
+
+	_, err = rw.Migrate(ctx, meta)
+	assert.Error(t, err)
+
+	// left where it was
+	_, err = ts.hotR.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	assert.NoError(t, err)
+	_, err = ts.coldR.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, err)
+}
@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	ot_log "github.com/opentracing/opentracing-go/log"
+)
+
+const metaName = "meta.json"
+
+type readerWriter struct {
+	backend string
+
+	nextReader    backend.Reader
+	nextWriter    backend.Writer
+	nextCompactor backend.Compactor
+}
+
+// New starts a client span for every call to the backend tagged with the tenant, block, object name and number
+// of bytes transferred.  Spans are children of the span in the call's context so a query's object store calls
+// show up in its trace.  Compactor calls carry no context and are not traced.
+func New(r backend.Reader, w backend.Writer, c backend.Compactor, backendName string) (backend.Reader, backend.Writer, backend.Compactor) {
+	rw := &readerWriter{
+		backend:       backendName,
+		nextReader:    r,
+		nextWriter:    w,
+		nextCompactor: c,
+	}
+	return rw, rw, rw
+}
+
+// Reader
+func (rw *readerWriter) Tenants(ctx context.Context) ([]string, error) {
+	span, ctx := rw.startSpan(ctx, "Tenants", "", uuid.Nil, "")
+	tenants, err := rw.nextReader.Tenants(ctx)
+	finishSpan(span, 0, err)
+	return tenants, err
+}
+
+func (rw *readerWriter) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	span, ctx := rw.startSpan(ctx, "Blocks", tenantID, uuid.Nil, "")
+	blocks, err := rw.nextReader.Blocks(ctx, tenantID)
+	finishSpan(span, 0, err)
+	return blocks, err
+}
+
+func (rw *readerWriter) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	span, ctx := rw.startSpan(ctx, "BlockMeta", tenantID, blockID, metaName)
+	meta, err := rw.nextReader.BlockMeta(ctx, blockID, tenantID)
+	finishSpan(span, 0, err)
+	return meta, err
+}
+
+func (rw *readerWriter) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	span, ctx := rw.startSpan(ctx, "Bloom", tenantID, blockID, backend.BloomName)
+	bloom, err := rw.nextReader.Bloom(ctx, blockID, tenantID)
+	finishSpan(span, len(bloom), err)
+	return bloom, err
+}
+
+func (rw *readerWriter) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	span, ctx := rw.startSpan(ctx, "Index", tenantID, blockID, backend.IndexName)
+	index, err := rw.nextReader.Index(ctx, blockID, tenantID)
+	finishSpan(span, len(index), err)
+	return index, err
+}
+
+func (rw *readerWriter) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	span, ctx := rw.startSpan(ctx, "Object", tenantID, blockID, backend.ObjectName)
+	span.SetTag("offset", offset)
+	err := rw.nextReader.Object(ctx, blockID, tenantID, offset, buffer)
+	finishSpan(span, len(buffer), err)
+	return err
+}
+
+func (rw *readerWriter) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	span, ctx := rw.startSpan(ctx, "ReadRange", tenantID, blockID, name)
+	span.SetTag("offset", offset)
+	err := rw.nextReader.ReadRange(ctx, name, blockID, tenantID, offset, buffer)
+	finishSpan(span, len(buffer), err)
+	return err
+}
+
+func (rw *readerWriter) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	span, ctx := rw.startSpan(ctx, "TenantIndex", tenantID, uuid.Nil, backend.TenantIndexName)
+	index, err := rw.nextReader.TenantIndex(ctx, tenantID)
+	finishSpan(span, 0, err)
+	return index, err
+}
+
+func (rw *readerWriter) Shutdown() {
+	rw.nextReader.Shutdown()
+}
+
+// Writer
+func (rw *readerWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	var objectSize int64
+	if info, err := os.Stat(objectFilePath); err == nil {
+		objectSize = info.Size()
+	}
+
+	span, ctx := rw.startSpan(ctx, "Write", meta.TenantID, meta.BlockID, "")
+	err := rw.nextWriter.Write(ctx, meta, bBloom, bIndex, objectFilePath)
+	finishSpan(span, len(bBloom)+len(bIndex)+int(objectSize), err)
+	return err
+}
+
+func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	span, ctx := rw.startSpan(ctx, "WriteBlockMeta", meta.TenantID, meta.BlockID, metaName)
+	err := rw.nextWriter.WriteBlockMeta(ctx, tracker, meta, bBloom, bIndex)
+	finishSpan(span, len(bBloom)+len(bIndex), err)
+	return err
+}
+
+func (rw *readerWriter) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	span, ctx := rw.startSpan(ctx, "AppendObject", meta.TenantID, meta.BlockID, backend.ObjectName)
+	tracker, err := rw.nextWriter.AppendObject(ctx, tracker, meta, bObject)
+	finishSpan(span, len(bObject), err)
+	return tracker, err
+}
+
+func (rw *readerWriter) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	span, ctx := rw.startSpan(ctx, "WriteTenantIndex", tenantID, uuid.Nil, backend.TenantIndexName)
+	span.SetTag("blocks", len(meta))
+	span.SetTag("compacted_blocks", len(compactedMeta))
+	err := rw.nextWriter.WriteTenantIndex(ctx, tenantID, meta, compactedMeta)
+	finishSpan(span, 0, err)
+	return err
+}
+
+// Compactor
+func (rw *readerWriter) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return rw.nextCompactor.MarkBlockCompacted(blockID, tenantID)
+}
+
+func (rw *readerWriter) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return rw.nextCompactor.ClearBlock(blockID, tenantID)
+}
+
+func (rw *readerWriter) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	span, _ := rw.startSpan(context.Background(), "ClearBlocks", tenantID, uuid.Nil, "")
+	span.SetTag("blocks", len(blockIDs))
+	err := rw.nextCompactor.ClearBlocks(blockIDs, tenantID)
+	finishSpan(span, 0, err)
+	return err
+}
+
+func (rw *readerWriter) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return rw.nextCompactor.CompactedBlockMeta(blockID, tenantID)
+}
+
+func (rw *readerWriter) startSpan(ctx context.Context, method string, tenantID string, blockID uuid.UUID, object string) (opentracing.Span, context.Context) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "backend."+method)
+	ext.SpanKindRPCClient.Set(span)
+	ext.PeerService.Set(span, rw.backend)
+	if tenantID != "" {
+		span.SetTag("tenant", tenantID)
+	}
+	if blockID != uuid.Nil {
+		span.SetTag("block", blockID.String())
+	}
+	if object != "" {
+		span.SetTag("object", object)
+	}
+	return span, ctx
+}
+
+func finishSpan(span opentracing.Span, size int, err error) {
+	if size > 0 {
+		span.SetTag("size", size)
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(ot_log.Error(err))
+	}
+	span.Finish()
+}
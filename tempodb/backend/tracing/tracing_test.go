@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+)
+
+type mockBackend struct {
+	err error
+}
+
+func (m *mockBackend) Tenants(ctx context.Context) ([]string, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Blocks(ctx context.Context, tenantID string) ([]uuid.UUID, error) {
+	return nil, m.err
+}
+func (m *mockBackend) BlockMeta(ctx context.Context, blockID uuid.UUID, tenantID string) (*encoding.BlockMeta, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Bloom(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return make([]byte, 10), m.err
+}
+func (m *mockBackend) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return m.err
+}
+func (m *mockBackend) ReadRange(ctx context.Context, name string, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	return m.err
+}
+func (m *mockBackend) TenantIndex(ctx context.Context, tenantID string) (*backend.TenantIndex, error) {
+	return nil, m.err
+}
+func (m *mockBackend) Shutdown() {}
+func (m *mockBackend) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	return m.err
+}
+func (m *mockBackend) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	return m.err
+}
+func (m *mockBackend) AppendObject(ctx context.Context, tracker backend.AppendTracker, meta *encoding.BlockMeta, bObject []byte) (backend.AppendTracker, error) {
+	return nil, m.err
+}
+func (m *mockBackend) WriteTenantIndex(ctx context.Context, tenantID string, meta []*encoding.BlockMeta, compactedMeta []*encoding.CompactedBlockMeta) error {
+	return m.err
+}
+func (m *mockBackend) MarkBlockCompacted(blockID uuid.UUID, tenantID string) error {
+	return m.err
+}
+func (m *mockBackend) ClearBlock(blockID uuid.UUID, tenantID string) error {
+	return m.err
+}
+func (m *mockBackend) ClearBlocks(blockIDs []uuid.UUID, tenantID string) error {
+	return m.err
+}
+func (m *mockBackend) CompactedBlockMeta(blockID uuid.UUID, tenantID string) (*encoding.CompactedBlockMeta, error) {
+	return nil, m.err
+}
+
+func TestTracing(t *testing.T) {
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
+	defer closer.Close()
+
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	m := &mockBackend{}
+	r, _, _ := New(m, m, m, "mock")
+
+	parent, ctx := opentracing.StartSpanFromContext(context.Background(), "query")
+	blockID := uuid.New()
+
+	_, err := r.Bloom(ctx, blockID, "tenant")
+	require.NoError(t, err)
+
+	m.err = errors.New("failed")
+	err = r.ReadRange(ctx, backend.IndexName, blockID, "tenant", 100, make([]byte, 5))
+	assert.Error(t, err)
+	parent.Finish()
+
+	spans := reporter.GetSpans()
+	require.Len(t, spans, 3)
+	parentID := parent.(*jaeger.Span).SpanContext().SpanID()
+
+	bloom := spans[0].(*jaeger.Span)
+	assert.Equal(t, "backend.Bloom", bloom.OperationName())
+	assert.Equal(t, parentID, bloom.SpanContext().ParentID())
+	tags := bloom.Tags()
+	assert.Equal(t, ext.SpanKindRPCClientEnum, tags["span.kind"])
+	assert.Equal(t, "mock", tags["peer.service"])
+	assert.Equal(t, "tenant", tags["tenant"])
+	assert.Equal(t, blockID.String(), tags["block"])
+	assert.Equal(t, backend.BloomName, tags["object"])
+	assert.Equal(t, 10, tags["size"])
+	assert.Nil(t, tags["error"])
+
+	readRange := spans[1].(*jaeger.Span)
+	assert.Equal(t, "backend.ReadRange", readRange.OperationName())
+	assert.Equal(t, parentID, readRange.SpanContext().ParentID())
+	tags = readRange.Tags()
+	assert.Equal(t, backend.IndexName, tags["object"])
+	assert.Equal(t, uint64(100), tags["offset"])
+	assert.Equal(t, true, tags["error"])
+}
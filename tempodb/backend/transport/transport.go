@@ -0,0 +1,80 @@
+package transport
+
+import (
+	"crypto/tls"
+	"flag"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config tunes the http transport a backend sends its requests with.  Zero values keep the backend's defaults.
+type Config struct {
+	// ProxyURL sends requests through this proxy instead of the one in the HTTP_PROXY and HTTPS_PROXY
+	// environment variables
+	ProxyURL              string        `yaml:"proxy_url"`
+	MaxIdleConns          int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	// DisableHTTP2 speaks http/1.1 only, e.g. to proxies that mishandle http/2
+	DisableHTTP2 bool `yaml:"disable_http2"`
+}
+
+// RegisterFlagsWithPrefix registers the flags under prefix, e.g. storage.trace.s3.transport.
+func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.ProxyURL, prefix+"proxy-url", "", "Proxy to send backend requests through. Empty to use the HTTP_PROXY and HTTPS_PROXY environment variables.")
+	f.IntVar(&cfg.MaxIdleConns, prefix+"max-idle-conns", 0, "Maximum idle connections to the backend. 0 to use the default.")
+	f.IntVar(&cfg.MaxIdleConnsPerHost, prefix+"max-idle-conns-per-host", 0, "Maximum idle connections to each backend host. 0 to use the default.")
+	f.DurationVar(&cfg.IdleConnTimeout, prefix+"idle-conn-timeout", 0, "Time an idle backend connection is kept open. 0 to use the default.")
+	f.DurationVar(&cfg.DialTimeout, prefix+"dial-timeout", 0, "Timeout for connecting to the backend. 0 to use the default.")
+	f.DurationVar(&cfg.ResponseHeaderTimeout, prefix+"response-header-timeout", 0, "Timeout for the backend to start responding once a request is sent. 0 for no timeout.")
+	f.BoolVar(&cfg.DisableHTTP2, prefix+"disable-http2", false, "Only use http/1.1 with the backend.")
+}
+
+// New returns a copy of http.DefaultTransport tuned by cfg
+func New(cfg Config) (*http.Transport, error) {
+	return Apply(cfg, http.DefaultTransport.(*http.Transport))
+}
+
+// Apply returns a copy of base tuned by cfg.  base is left unchanged.
+func Apply(cfg Config, base *http.Transport) (*http.Transport, error) {
+	t := base.Clone()
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid proxy url")
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.DialTimeout > 0 {
+		t.DialContext = (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if cfg.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	}
+	if cfg.DisableHTTP2 {
+		// a non nil, empty TLSNextProto stops the transport from upgrading to http/2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	base := http.DefaultTransport.(*http.Transport)
+
+	tr, err := New(Config{})
+	require.NoError(t, err)
+	assert.Equal(t, base.MaxIdleConns, tr.MaxIdleConns)
+	assert.True(t, tr.ForceAttemptHTTP2)
+
+	tr, err = New(Config{
+		ProxyURL:              "http://proxy:3128",
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   5,
+		IdleConnTimeout:       time.Minute,
+		ResponseHeaderTimeout: time.Second,
+		DialTimeout:           time.Second,
+		DisableHTTP2:          true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10, tr.MaxIdleConns)
+	assert.Equal(t, 5, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+	assert.Equal(t, time.Second, tr.ResponseHeaderTimeout)
+	assert.False(t, tr.ForceAttemptHTTP2)
+	assert.NotNil(t, tr.TLSNextProto)
+
+	req := httptest.NewRequest(http.MethodGet, "https://bucket.s3.amazonaws.com/", nil)
+	proxy, err := tr.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, &url.URL{Scheme: "http", Host: "proxy:3128"}, proxy)
+
+	// the base is untouched
+	assert.NotEqual(t, 10, base.MaxIdleConns)
+
+	_, err = New(Config{ProxyURL: "://"})
+	assert.Error(t, err)
+}
+
+func TestProxy(t *testing.T) {
+	proxied := false
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+		assert.Equal(t, "backend.invalid", r.Host)
+	}))
+	defer proxy.Close()
+
+	tr, err := New(Config{ProxyURL: proxy.URL})
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: tr}).Get("http://backend.invalid/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.True(t, proxied)
+}
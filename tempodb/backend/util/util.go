@@ -5,6 +5,7 @@ import (
 	"path"
 
 	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
 )
 
 func MetaFileName(blockID uuid.UUID, tenantID string) string {
@@ -12,15 +13,20 @@ func MetaFileName(blockID uuid.UUID, tenantID string) string {
 }
 
 func BloomFileName(blockID uuid.UUID, tenantID string) string {
-	return path.Join(rootPath(blockID, tenantID), "bloom")
+	return FileName(blockID, tenantID, backend.BloomName)
 }
 
 func IndexFileName(blockID uuid.UUID, tenantID string) string {
-	return path.Join(rootPath(blockID, tenantID), "index")
+	return FileName(blockID, tenantID, backend.IndexName)
 }
 
 func ObjectFileName(blockID uuid.UUID, tenantID string) string {
-	return path.Join(rootPath(blockID, tenantID), "data")
+	return FileName(blockID, tenantID, backend.ObjectName)
+}
+
+// FileName is the path of the named object of a block
+func FileName(blockID uuid.UUID, tenantID string, name string) string {
+	return path.Join(rootPath(blockID, tenantID), name)
 }
 
 func CompactedMetaFileName(blockID uuid.UUID, tenantID string) string {
@@ -31,6 +37,10 @@ func BlockFileName(blockID uuid.UUID, tenantID string) string {
 	return rootPath(blockID, tenantID) + "/"
 }
 
+func TenantIndexFileName(tenantID string) string {
+	return path.Join(tenantID, "index.json")
+}
+
 func rootPath(blockID uuid.UUID, tenantID string) string {
 	return path.Join(tenantID, blockID.String())
 }
@@ -0,0 +1,87 @@
+package tempodb
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/grafana/tempo/tempodb/encoding"
+)
+
+// BlocklistChange describes how a tenant's blocklist changed
+type BlocklistChange struct {
+	TenantID string
+	// Added are blocks that are new to the blocklist
+	Added []uuid.UUID
+	// Removed are blocks that are in neither the blocklist nor the compacted blocklist anymore, i.e. they
+	// have been deleted from the backend.  Compacted blocks are still readable so they aren't removed.
+	Removed []uuid.UUID
+}
+
+func (c BlocklistChange) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// SubscribeBlocklist calls fn whenever a poll or DeleteBlock changes a tenant's blocklist.  fn is called
+// synchronously by the poller and tenants are polled concurrently so it must be quick and safe for
+// concurrent use.
+func (rw *readerWriter) SubscribeBlocklist(fn func(BlocklistChange)) {
+	rw.subscribersMtx.Lock()
+	defer rw.subscribersMtx.Unlock()
+
+	rw.subscribers = append(rw.subscribers, fn)
+}
+
+func (rw *readerWriter) notifyBlocklistChange(change BlocklistChange) {
+	if change.empty() {
+		return
+	}
+
+	rw.subscribersMtx.Lock()
+	subscribers := rw.subscribers
+	rw.subscribersMtx.Unlock()
+
+	for _, fn := range subscribers {
+		fn(change)
+	}
+}
+
+// evictRemovedBlocks drops the cached bloom filters and metas of deleted blocks instead of waiting for
+// them to age out
+func (rw *readerWriter) evictRemovedBlocks(change BlocklistChange) {
+	for _, blockID := range change.Removed {
+		rw.metaCache.evictBlock(blockID, change.TenantID)
+	}
+}
+
+// diffBlocklists compares a tenant's blocklists before and after a poll
+func diffBlocklists(tenantID string, prev []*encoding.BlockMeta, prevCompacted []*encoding.CompactedBlockMeta, blocklist []*encoding.BlockMeta, compacted []*encoding.CompactedBlockMeta) BlocklistChange {
+	change := BlocklistChange{
+		TenantID: tenantID,
+	}
+
+	known := make(map[uuid.UUID]struct{}, len(prev)+len(prevCompacted))
+	for _, b := range prev {
+		known[b.BlockID] = struct{}{}
+	}
+	for _, b := range prevCompacted {
+		known[b.BlockID] = struct{}{}
+	}
+
+	current := make(map[uuid.UUID]struct{}, len(blocklist)+len(compacted))
+	for _, b := range blocklist {
+		current[b.BlockID] = struct{}{}
+		if _, ok := known[b.BlockID]; !ok {
+			change.Added = append(change.Added, b.BlockID)
+		}
+	}
+	for _, b := range compacted {
+		current[b.BlockID] = struct{}{}
+	}
+
+	for id := range known {
+		if _, ok := current[id]; !ok {
+			change.Removed = append(change.Removed, id)
+		}
+	}
+
+	return change
+}
@@ -0,0 +1,104 @@
+package tempodb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffBlocklists(t *testing.T) {
+	a, b, c, d := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	change := diffBlocklists(testTenantID,
+		[]*encoding.BlockMeta{{BlockID: a}, {BlockID: b}},
+		[]*encoding.CompactedBlockMeta{{BlockMeta: encoding.BlockMeta{BlockID: c}}},
+		[]*encoding.BlockMeta{{BlockID: d}},
+		[]*encoding.CompactedBlockMeta{{BlockMeta: encoding.BlockMeta{BlockID: a}}},
+	)
+
+	// a was compacted which isn't a removal
+	assert.Equal(t, testTenantID, change.TenantID)
+	assert.Equal(t, []uuid.UUID{d}, change.Added)
+	assert.ElementsMatch(t, []uuid.UUID{b, c}, change.Removed)
+
+	assert.True(t, diffBlocklists(testTenantID, nil, nil, nil, nil).empty())
+}
+
+func TestSubscribeBlocklist(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle:  0,
+		MetaCacheMaxBytes: 1024 * 1024,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	mtx := sync.Mutex{}
+	var changes []BlocklistChange
+	r.SubscribeBlocklist(func(change BlocklistChange) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		changes = append(changes, change)
+	})
+
+	blockIDs := make([]uuid.UUID, 0, 3)
+	for i := 0; i < 3; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		id := uuid.New()
+		err = head.Write(id[:], []byte{0x01})
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		blockIDs = append(blockIDs, complete.BlockMeta().BlockID)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, changes, 1)
+	assert.ElementsMatch(t, blockIDs, changes[0].Added)
+	assert.Len(t, changes[0].Removed, 0)
+
+	// nothing changed, nothing to report
+	rw.pollBlocklist()
+	assert.Len(t, changes, 1)
+
+	// a block deleted out from under the poller is evicted from the meta cache
+	rw.metaCache.put(metaCacheTypeBloom, blockIDs[0], testTenantID, "bloom", 1)
+	err = os.RemoveAll(path.Join(tempDir, "traces", testTenantID, blockIDs[0].String()))
+	assert.NoError(t, err)
+	rw.pollBlocklist()
+	assert.Len(t, changes, 2)
+	assert.Equal(t, []uuid.UUID{blockIDs[0]}, changes[1].Removed)
+	_, ok := rw.metaCache.get(metaCacheTypeBloom, blockIDs[0], testTenantID)
+	assert.False(t, ok)
+
+	// as is a block removed with DeleteBlock
+	err = c.DeleteBlock(context.Background(), testTenantID, blockIDs[1])
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, []uuid.UUID{blockIDs[1]}, changes[2].Removed)
+}
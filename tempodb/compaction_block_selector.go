@@ -14,9 +14,29 @@ type CompactionBlockSelector interface {
 }
 
 const (
-	activeWindowDuration = 24 * time.Hour
+	defaultActiveWindow = 24 * time.Hour
 )
 
+// compactableBlocks returns the blocks that aren't done compacting.  Blocks compacted maxLevel times or holding at least
+// maxBytes of objects would only be rewritten again with little to gain, so they're left as they are.  0 is unlimited.
+func compactableBlocks(blocklist []*encoding.BlockMeta, maxLevel int, maxBytes uint64) []*encoding.BlockMeta {
+	if maxLevel <= 0 && maxBytes == 0 {
+		return blocklist
+	}
+
+	compactable := make([]*encoding.BlockMeta, 0, len(blocklist))
+	for _, b := range blocklist {
+		if maxLevel > 0 && int(b.CompactionLevel) >= maxLevel {
+			continue
+		}
+		if maxBytes > 0 && b.Size >= maxBytes {
+			continue
+		}
+		compactable = append(compactable, b)
+	}
+	return compactable
+}
+
 /*************************** Simple Block Selector **************************/
 
 type simpleBlockSelector struct {
@@ -58,16 +78,20 @@ func (sbs *simpleBlockSelector) BlocksToCompact() ([]*encoding.BlockMeta, string
 type timeWindowBlockSelector struct {
 	blocklist            []*encoding.BlockMeta
 	MaxCompactionRange   time.Duration // Size of the time window - say 6 hours
+	ActiveWindow         time.Duration // how long windows are compacted by level after they end - say 24 hours
 	MaxCompactionObjects int           // maximum size of compacted objects
+	MaxCompactionBytes   uint64        // maximum size in bytes of compacted objects.  0 is unlimited
 }
 
 var _ (CompactionBlockSelector) = (*timeWindowBlockSelector)(nil)
 
-func newTimeWindowBlockSelector(blocklist []*encoding.BlockMeta, maxCompactionRange time.Duration, maxCompactionObjects int) CompactionBlockSelector {
+func newTimeWindowBlockSelector(blocklist []*encoding.BlockMeta, maxCompactionRange time.Duration, activeWindow time.Duration, maxCompactionObjects int, maxCompactionBytes uint64) CompactionBlockSelector {
 	twbs := &timeWindowBlockSelector{
 		blocklist:            append([]*encoding.BlockMeta(nil), blocklist...),
 		MaxCompactionRange:   maxCompactionRange,
+		ActiveWindow:         activeWindow,
 		MaxCompactionObjects: maxCompactionObjects,
+		MaxCompactionBytes:   maxCompactionBytes,
 	}
 
 	// sort by compaction window, level, and then size
@@ -78,7 +102,7 @@ func newTimeWindowBlockSelector(blocklist []*encoding.BlockMeta, maxCompactionRa
 		wi := twbs.windowForBlock(bi)
 		wj := twbs.windowForBlock(bj)
 
-		activeWindow := twbs.windowForTime(time.Now().Add(-activeWindowDuration))
+		activeWindow := twbs.activeWindow()
 		if activeWindow <= wi && activeWindow <= wj {
 			// inside active window.  sort by:  compaction lvl -> window -> size
 			//  we should always choose the smallest two blocks whos compaction lvl and windows match
@@ -131,7 +155,7 @@ func (twbs *timeWindowBlockSelector) BlocksToCompact() ([]*encoding.BlockMeta, s
 
 			// blocks in the currently active window
 			// dangerous to use time.Now()
-			activeWindow := twbs.windowForTime(time.Now().Add(-activeWindowDuration))
+			activeWindow := twbs.activeWindow()
 			blockWindow := twbs.windowForBlock(windowBlocks[0])
 
 			hashString := fmt.Sprintf("%v", windowBlocks[0].TenantID)
@@ -159,12 +183,17 @@ func (twbs *timeWindowBlockSelector) BlocksToCompact() ([]*encoding.BlockMeta, s
 
 			// are they small enough
 			totalObjects := 0
+			totalBytes := uint64(0)
 			for _, block := range compactBlocks {
 				totalObjects += block.TotalObjects
+				totalBytes += block.Size
 			}
 			if totalObjects > twbs.MaxCompactionObjects {
 				compact = false
 			}
+			if twbs.MaxCompactionBytes > 0 && totalBytes > twbs.MaxCompactionBytes {
+				compact = false
+			}
 
 			if compact {
 				// remove the blocks we are returning so we don't consider them again
@@ -191,6 +220,13 @@ func (twbs *timeWindowBlockSelector) BlocksToCompact() ([]*encoding.BlockMeta, s
 	return nil, ""
 }
 
+// activeWindow returns the oldest window still compacted by level.  Windows ending before it are compacted down to as
+// few blocks as possible, which bounds how many times their objects are rewritten and lets retention delete them in
+// whole blocks.
+func (twbs *timeWindowBlockSelector) activeWindow() int64 {
+	return twbs.windowForTime(time.Now().Add(-twbs.ActiveWindow))
+}
+
 func (twbs *timeWindowBlockSelector) windowForBlock(meta *encoding.BlockMeta) int64 {
 	return twbs.windowForTime(meta.EndTime)
 }
@@ -198,3 +234,83 @@ func (twbs *timeWindowBlockSelector) windowForBlock(meta *encoding.BlockMeta) in
 func (twbs *timeWindowBlockSelector) windowForTime(t time.Time) int64 {
 	return t.Unix() / int64(twbs.MaxCompactionRange/time.Second)
 }
+
+/*************************** Tiny Block Selector **************************/
+
+// tinyBlockSelector combines the tiny blocks frequent ingester flushes produce many at a time rather than two at a
+// time.  Level 0 blocks in the active window holding at most tinyBlockObjects objects are compacted in groups of up to
+// maxTinyBlocks.  Every other block is left to the timeWindowBlockSelector.
+type tinyBlockSelector struct {
+	groups [][]*encoding.BlockMeta
+	hashes []string
+	rest   CompactionBlockSelector
+}
+
+var _ (CompactionBlockSelector) = (*tinyBlockSelector)(nil)
+
+func newTinyBlockSelector(blocklist []*encoding.BlockMeta, maxCompactionRange time.Duration, activeWindow time.Duration, maxCompactionObjects int, maxCompactionBytes uint64, tinyBlockObjects int, maxTinyBlocks int) CompactionBlockSelector {
+	twbs := &timeWindowBlockSelector{MaxCompactionRange: maxCompactionRange, ActiveWindow: activeWindow}
+	oldestActive := twbs.activeWindow()
+
+	byWindow := map[int64][]*encoding.BlockMeta{}
+	var rest []*encoding.BlockMeta
+	for _, b := range blocklist {
+		w := twbs.windowForBlock(b)
+		if b.CompactionLevel != 0 || b.TotalObjects > tinyBlockObjects || w < oldestActive {
+			rest = append(rest, b)
+			continue
+		}
+		byWindow[w] = append(byWindow[w], b)
+	}
+
+	windows := make([]int64, 0, len(byWindow))
+	for w := range byWindow {
+		windows = append(windows, w)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] > windows[j] })
+
+	tbs := &tinyBlockSelector{}
+	for _, w := range windows {
+		blocks := byWindow[w]
+		for len(blocks) > 0 {
+			var group []*encoding.BlockMeta
+			totalObjects := 0
+			totalBytes := uint64(0)
+			for _, b := range blocks {
+				if len(group) >= maxTinyBlocks || (len(group) > 0 && totalObjects+b.TotalObjects > maxCompactionObjects) {
+					break
+				}
+				if maxCompactionBytes > 0 && len(group) > 0 && totalBytes+b.Size > maxCompactionBytes {
+					break
+				}
+				group = append(group, b)
+				totalObjects += b.TotalObjects
+				totalBytes += b.Size
+			}
+			blocks = blocks[len(group):]
+
+			// a lone tiny block is compacted with the window's other blocks
+			if len(group) < inputBlocks {
+				rest = append(rest, group...)
+				continue
+			}
+			tbs.groups = append(tbs.groups, group)
+			// the hash the timeWindowBlockSelector uses for level 0 of the window so one compactor owns its blocks
+			tbs.hashes = append(tbs.hashes, fmt.Sprintf("%v-%v-%v", group[0].TenantID, group[0].CompactionLevel, w))
+		}
+	}
+
+	tbs.rest = newTimeWindowBlockSelector(rest, maxCompactionRange, activeWindow, maxCompactionObjects, maxCompactionBytes)
+	return tbs
+}
+
+func (tbs *tinyBlockSelector) BlocksToCompact() ([]*encoding.BlockMeta, string) {
+	if len(tbs.groups) == 0 {
+		return tbs.rest.BlocksToCompact()
+	}
+
+	group, hashString := tbs.groups[0], tbs.hashes[0]
+	tbs.groups = tbs.groups[1:]
+	tbs.hashes = tbs.hashes[1:]
+	return group, hashString
+}
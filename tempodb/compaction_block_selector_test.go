@@ -1,6 +1,7 @@
 package tempodb
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -212,12 +213,12 @@ func TestTimeWindowBlockSelectorBlocksToCompact(t *testing.T) {
 				},
 				{
 					BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000003"),
-					EndTime:         now.Add(-activeWindowDuration - time.Minute),
+					EndTime:         now.Add(-defaultActiveWindow - time.Minute),
 					CompactionLevel: 1,
 				},
 				{
 					BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000001"),
-					EndTime:         now.Add(-activeWindowDuration - time.Minute),
+					EndTime:         now.Add(-defaultActiveWindow - time.Minute),
 					CompactionLevel: 0,
 				},
 			},
@@ -234,12 +235,12 @@ func TestTimeWindowBlockSelectorBlocksToCompact(t *testing.T) {
 			expectedSecond: []*encoding.BlockMeta{
 				{
 					BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000001"),
-					EndTime:         now.Add(-activeWindowDuration - time.Minute),
+					EndTime:         now.Add(-defaultActiveWindow - time.Minute),
 					CompactionLevel: 0,
 				},
 				{
 					BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000003"),
-					EndTime:         now.Add(-activeWindowDuration - time.Minute),
+					EndTime:         now.Add(-defaultActiveWindow - time.Minute),
 					CompactionLevel: 1,
 				},
 			},
@@ -299,7 +300,7 @@ func TestTimeWindowBlockSelectorBlocksToCompact(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			selector := newTimeWindowBlockSelector(tt.blocklist, time.Second, 100)
+			selector := newTimeWindowBlockSelector(tt.blocklist, time.Second, defaultActiveWindow, 100, 0)
 
 			actual, _ := selector.BlocksToCompact()
 			assert.Equal(t, tt.expected, actual)
@@ -487,9 +488,158 @@ func TestTimeWindowBlockSelectorSort(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			selector := newTimeWindowBlockSelector(tt.blocklist, timeWindow, 100)
+			selector := newTimeWindowBlockSelector(tt.blocklist, timeWindow, defaultActiveWindow, 100, 0)
 			actual := selector.(*timeWindowBlockSelector).blocklist
 			assert.Equal(t, tt.expected, actual)
 		})
 	}
 }
+
+func TestTinyBlockSelectorBlocksToCompact(t *testing.T) {
+	now := time.Now()
+	timeWindow := 12 * time.Hour
+
+	tiny := func(id string, level uint8, objects int, end time.Time) *encoding.BlockMeta {
+		return &encoding.BlockMeta{
+			BlockID:         uuid.MustParse(id),
+			TenantID:        "test",
+			CompactionLevel: level,
+			TotalObjects:    objects,
+			EndTime:         end,
+		}
+	}
+
+	blocklist := []*encoding.BlockMeta{
+		tiny("00000000-0000-0000-0000-000000000000", 0, 1, now),
+		tiny("00000000-0000-0000-0000-000000000001", 0, 2, now),
+		tiny("00000000-0000-0000-0000-000000000002", 0, 3, now),
+		tiny("00000000-0000-0000-0000-000000000003", 0, 4, now),
+		tiny("00000000-0000-0000-0000-000000000004", 0, 5, now),
+		// too big
+		tiny("00000000-0000-0000-0000-000000000005", 0, 50, now),
+		// not level 0
+		tiny("00000000-0000-0000-0000-000000000006", 1, 1, now),
+		// outside the active window
+		tiny("00000000-0000-0000-0000-000000000007", 0, 1, now.Add(-5*timeWindow)),
+		tiny("00000000-0000-0000-0000-000000000008", 0, 1, now.Add(-5*timeWindow)),
+	}
+
+	selector := newTinyBlockSelector(blocklist, timeWindow, defaultActiveWindow, 1000, 0, 10, 3)
+
+	// tiny blocks are combined up to 3 at a time
+	actual, hash := selector.BlocksToCompact()
+	assert.Equal(t, blocklist[0:3], actual)
+	assert.Equal(t, fmt.Sprintf("test-0-%v", now.Unix()/int64(timeWindow/time.Second)), hash)
+	actual, _ = selector.BlocksToCompact()
+	assert.Equal(t, blocklist[3:5], actual)
+
+	// the rest are left to the time window selector, which won't compact levels 0 and 1 of the active window together
+	actual, _ = selector.BlocksToCompact()
+	assert.Equal(t, blocklist[7:9], actual)
+	actual, _ = selector.BlocksToCompact()
+	assert.Nil(t, actual)
+
+	// a lone tiny block and the max compaction objects leave blocks to the time window selector
+	selector = newTinyBlockSelector(blocklist[2:5], timeWindow, defaultActiveWindow, 7, 0, 10, 3)
+	actual, _ = selector.BlocksToCompact()
+	assert.Equal(t, blocklist[2:4], actual)
+	actual, _ = selector.BlocksToCompact()
+	assert.Nil(t, actual)
+}
+
+func TestTimeWindowBlockSelectorActiveWindow(t *testing.T) {
+	now := time.Now()
+	timeWindow := time.Hour
+
+	// two blocks of different levels that ended a few windows ago
+	blocklist := []*encoding.BlockMeta{
+		{
+			BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000000"),
+			CompactionLevel: 0,
+			EndTime:         now.Add(-3 * timeWindow),
+		},
+		{
+			BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+			CompactionLevel: 1,
+			EndTime:         now.Add(-3 * timeWindow),
+		},
+	}
+
+	// still active, so blocks are only compacted with blocks of their level
+	selector := newTimeWindowBlockSelector(blocklist, timeWindow, defaultActiveWindow, 100, 0)
+	actual, _ := selector.BlocksToCompact()
+	assert.Nil(t, actual)
+
+	// no longer active, so the window is compacted down whatever the levels
+	selector = newTimeWindowBlockSelector(blocklist, timeWindow, timeWindow, 100, 0)
+	actual, hash := selector.BlocksToCompact()
+	assert.Equal(t, blocklist, actual)
+	assert.Equal(t, fmt.Sprintf("-%v", blocklist[0].EndTime.Unix()/int64(timeWindow/time.Second)), hash)
+}
+
+func TestCompactableBlocks(t *testing.T) {
+	blocklist := []*encoding.BlockMeta{
+		{
+			BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000000"),
+			CompactionLevel: 0,
+			Size:            10,
+		},
+		{
+			BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+			CompactionLevel: 3,
+			Size:            10,
+		},
+		{
+			BlockID:         uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+			CompactionLevel: 1,
+			Size:            1000,
+		},
+	}
+
+	assert.Equal(t, blocklist, compactableBlocks(blocklist, 0, 0))
+	assert.Equal(t, []*encoding.BlockMeta{blocklist[0], blocklist[2]}, compactableBlocks(blocklist, 3, 0))
+	assert.Equal(t, blocklist[:2], compactableBlocks(blocklist, 0, 1000))
+	assert.Equal(t, blocklist[:1], compactableBlocks(blocklist, 3, 1000))
+}
+
+func TestBlockSelectorMaxCompactionBytes(t *testing.T) {
+	now := time.Now()
+	timeWindow := 12 * time.Hour
+
+	blocklist := []*encoding.BlockMeta{
+		{
+			BlockID:      uuid.MustParse("00000000-0000-0000-0000-000000000000"),
+			TotalObjects: 1,
+			Size:         60,
+			EndTime:      now,
+		},
+		{
+			BlockID:      uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+			TotalObjects: 2,
+			Size:         60,
+			EndTime:      now,
+		},
+		{
+			BlockID:      uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+			TotalObjects: 3,
+			Size:         60,
+			EndTime:      now,
+		},
+	}
+
+	// any two blocks are too big
+	selector := newTimeWindowBlockSelector(blocklist, timeWindow, defaultActiveWindow, 100, 100)
+	actual, _ := selector.BlocksToCompact()
+	assert.Nil(t, actual)
+
+	selector = newTimeWindowBlockSelector(blocklist, timeWindow, defaultActiveWindow, 100, 120)
+	actual, _ = selector.BlocksToCompact()
+	assert.Equal(t, blocklist[:2], actual)
+
+	// tiny blocks are combined only up to the limit
+	selector = newTinyBlockSelector(blocklist, timeWindow, defaultActiveWindow, 100, 120, 10, 10)
+	actual, _ = selector.BlocksToCompact()
+	assert.Equal(t, blocklist[:2], actual)
+	actual, _ = selector.BlocksToCompact()
+	assert.Nil(t, actual)
+}
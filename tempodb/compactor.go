@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"sort"
 	"strconv"
 	"time"
 
@@ -27,45 +28,159 @@ var (
 		Help:      "Records the amount of time to compact a set of blocks.",
 		Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
 	}, []string{"level"})
+	metricCompactionTenantDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_tenant_duration_seconds",
+		Help:      "Records the amount of time to compact a set of blocks of each tenant.",
+		Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
+	}, []string{"tenant"})
 	metricCompactionErrors = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "tempodb",
 		Name:      "compaction_errors_total",
 		Help:      "Total number of errors occurring during compaction.",
 	})
+	metricCompactionTenantErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_tenant_errors_total",
+		Help:      "Total number of errors occurring during compaction of each tenant.",
+	}, []string{"tenant"})
+	metricCompactionBytesRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_bytes_read_total",
+		Help:      "Total size of the objects of the blocks compacted.  Blocks written before sizes were recorded count as 0.",
+	}, []string{"tenant"})
+	metricCompactionBytesWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_bytes_written_total",
+		Help:      "Total size of the objects of the blocks written by compaction.",
+	}, []string{"tenant"})
+	metricCompactionObjectsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_objects_written_total",
+		Help:      "Total number of objects written by compaction.",
+	}, []string{"tenant"})
+	metricCompactionObjectsCombined = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_objects_combined_total",
+		Help:      "Total number of objects combined during compaction with a different object of the same id.",
+	}, []string{"tenant"})
+	metricCompactionObjectsDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_objects_deduplicated_total",
+		Help:      "Total number of objects combined during compaction with an identical object of the same id, e.g. a replica.",
+	}, []string{"tenant"})
+	metricCompactionPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_paused",
+		Help:      "1 if compaction has been paused.",
+	})
+	metricCompactionPagesCopied = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_pages_copied_total",
+		Help:      "Total number of pages copied as they are by compactions of blocks that share no ids.",
+	})
+	metricCompactionBlocksUpgraded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "compaction_blocks_upgraded_total",
+		Help:      "Total number of blocks written in an older version of the block format compacted into the current version.",
+	}, []string{"version"})
 )
 
 const (
 	inputBlocks  = 2
 	outputBlocks = 1
 
-	recordsPerBatch = 1000
-	compactionCycle = 30 * time.Second
+	recordsPerBatch        = 1000
+	defaultCompactionCycle = 30 * time.Second
+	defaultMaxTinyBlocks   = 32
 )
 
 // todo: pass a context/chan in to cancel this cleanly
 func (rw *readerWriter) compactionLoop() {
-	ticker := time.NewTicker(compactionCycle)
+	ticker := time.NewTicker(rw.compactionCycle())
 	for range ticker.C {
 		rw.doCompaction()
 	}
 }
 
+func (rw *readerWriter) activeWindow() time.Duration {
+	if rw.compactorCfg.ActiveWindow > 0 {
+		return rw.compactorCfg.ActiveWindow
+	}
+	return defaultActiveWindow
+}
+
+func (rw *readerWriter) maxTinyBlocks() int {
+	if rw.compactorCfg.MaxTinyBlocks >= inputBlocks {
+		return rw.compactorCfg.MaxTinyBlocks
+	}
+	return defaultMaxTinyBlocks
+}
+
+func (rw *readerWriter) compactionCycle() time.Duration {
+	if rw.compactorCfg.CompactionCycle > 0 {
+		return rw.compactorCfg.CompactionCycle
+	}
+	return defaultCompactionCycle
+}
+
+// PauseCompaction stops new compactions from starting, e.g. while recovering from an incident or during
+// backend maintenance.  A compaction already in progress is allowed to finish.
+func (rw *readerWriter) PauseCompaction() {
+	if !rw.compactionPaused.Swap(true) {
+		level.Info(rw.logger).Log("msg", "compaction paused")
+	}
+	metricCompactionPaused.Set(1)
+}
+
+func (rw *readerWriter) ResumeCompaction() {
+	if rw.compactionPaused.Swap(false) {
+		level.Info(rw.logger).Log("msg", "compaction resumed")
+	}
+	metricCompactionPaused.Set(0)
+}
+
+func (rw *readerWriter) CompactionPaused() bool {
+	return rw.compactionPaused.Load()
+}
+
 func (rw *readerWriter) doCompaction() {
+	if rw.CompactionPaused() {
+		return
+	}
+
 	tenants := rw.blocklistTenants()
 	if len(tenants) == 0 {
 		return
 	}
 
-	// pick a random tenant and find some blocks to compact
+	// pick random tenants and find some blocks to compact in each
+	concurrency := rw.compactorCfg.CompactionConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(tenants) {
+		concurrency = len(tenants)
+	}
+
 	rand.Seed(time.Now().Unix())
-	tenantID := tenants[rand.Intn(len(tenants))].(string)
-	blocklist := rw.blocklist(tenantID)
-	blockSelector := newTimeWindowBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, rw.compactorCfg.MaxCompactionObjects)
+	rand.Shuffle(len(tenants), func(i, j int) { tenants[i], tenants[j] = tenants[j], tenants[i] })
+	forEachTenant(tenants[:concurrency], concurrency, rw.compactTenant)
+}
+
+func (rw *readerWriter) compactTenant(tenantID string) {
+	blocklist := compactableBlocks(rw.blocklist(tenantID), rw.compactorCfg.MaxCompactionLevel, rw.compactorCfg.MaxBlockBytes)
+	var blockSelector CompactionBlockSelector
+	if rw.compactorCfg.TinyBlockObjects > 0 {
+		blockSelector = newTinyBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, rw.activeWindow(), rw.compactorCfg.MaxCompactionObjects, rw.compactorCfg.MaxCompactionBytes, rw.compactorCfg.TinyBlockObjects, rw.maxTinyBlocks())
+	} else {
+		blockSelector = newTimeWindowBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, rw.activeWindow(), rw.compactorCfg.MaxCompactionObjects, rw.compactorCfg.MaxCompactionBytes)
+	}
 
 	start := time.Now()
 
 	level.Info(rw.logger).Log("msg", "starting compaction cycle", "tenantID", tenantID)
-	for {
+	for !rw.CompactionPaused() {
 		toBeCompacted, hashString := blockSelector.BlocksToCompact()
 		if len(toBeCompacted) == 0 {
 			level.Info(rw.logger).Log("msg", "failed to find any blocks to compact", "tenantID", tenantID)
@@ -83,6 +198,7 @@ func (rw *readerWriter) doCompaction() {
 		} else if err != nil {
 			level.Error(rw.logger).Log("msg", "error during compaction cycle", "err", err)
 			metricCompactionErrors.Inc()
+			metricCompactionTenantErrors.WithLabelValues(tenantID).Inc()
 		}
 
 		// after a maintenance cycle bail out
@@ -109,17 +225,39 @@ func (rw *readerWriter) compact(blockMetas []*encoding.BlockMeta, tenantID strin
 	defer func() {
 		level.Info(rw.logger).Log("msg", "compaction complete")
 		metricCompactionDuration.WithLabelValues(strconv.Itoa(int(compactionLevel))).Observe(time.Since(start).Seconds())
+		metricCompactionTenantDuration.WithLabelValues(tenantID).Observe(time.Since(start).Seconds())
 	}()
 
+	// blocks that share no ids don't need their objects combined.  their pages are copied as they are
+	sorted := append([]*encoding.BlockMeta(nil), blockMetas...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].MinID, sorted[j].MinID) == -1 })
+	if rw.wal.CanCopyPages(sorted) {
+		err := copyPages(rw, sorted, tenantID, nextCompactionLevel)
+		if err != nil {
+			return err
+		}
+		markCompacted(rw, blockMetas, tenantID)
+		return nil
+	}
+
 	var err error
 	bookmarks := make([]*bookmark, 0, len(blockMetas))
 
+	// stops prefetching the input blocks if compaction fails
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	var totalRecords int
 	for _, blockMeta := range blockMetas {
 		level.Info(rw.logger).Log("msg", "compacting block", "block", fmt.Sprintf("%+v", blockMeta))
 		totalRecords += blockMeta.TotalObjects
 
-		iter, err := encoding.NewBackendIterator(tenantID, blockMeta.BlockID, rw.compactorCfg.ChunkSizeBytes, rw.r)
+		format, err := blockMeta.PageFormat()
+		if err != nil {
+			return err
+		}
+
+		iter, err := encoding.NewPrefetchingBackendIterator(ctx, tenantID, blockMeta.BlockID, format, rw.compactorCfg.ChunkSizeBytes, rw.cfg.PrefetchPages, rw.r)
 		if err != nil {
 			return err
 		}
@@ -151,6 +289,11 @@ func (rw *readerWriter) compact(blockMetas []*encoding.BlockMeta, tenantID strin
 			}
 
 			if bytes.Equal(currentID, lowestID) {
+				if bytes.Equal(currentObject, lowestObject) {
+					metricCompactionObjectsDeduplicated.WithLabelValues(tenantID).Inc()
+				} else {
+					metricCompactionObjectsCombined.WithLabelValues(tenantID).Inc()
+				}
 				lowestObject = rw.compactorSharder.Combine(currentObject, lowestObject)
 				b.clear()
 			} else if len(lowestID) == 0 || bytes.Compare(currentID, lowestID) == -1 {
@@ -208,15 +351,92 @@ func (rw *readerWriter) compact(blockMetas []*encoding.BlockMeta, tenantID strin
 		}
 	}
 
-	// mark old blocks compacted so they don't show up in polling
+	markCompacted(rw, blockMetas, tenantID)
+
+	return nil
+}
+
+// copyPages compacts blocks ordered by id that share no ids by copying their pages into a new block one block after
+// the other
+func copyPages(rw *readerWriter, blockMetas []*encoding.BlockMeta, tenantID string, compactionLevel uint8) error {
+	var totalRecords int
+	for _, blockMeta := range blockMetas {
+		totalRecords += blockMeta.TotalObjects
+
+		_, err := rw.r.BlockMeta(context.TODO(), blockMeta.BlockID, tenantID)
+		if err != nil {
+			return err
+		}
+	}
+
+	currentBlock, err := rw.wal.NewCompactorBlock(uuid.New(), tenantID, blockMetas, totalRecords)
+	if err != nil {
+		return errors.Wrap(err, "error making new compacted block")
+	}
+	currentBlock.BlockMeta().CompactionLevel = compactionLevel
+
+	var tracker backend.AppendTracker
+	nextBatch := recordsPerBatch
+	for _, blockMeta := range blockMetas {
+		level.Info(rw.logger).Log("msg", "copying pages of block", "block", fmt.Sprintf("%+v", blockMeta))
+
+		format, err := blockMeta.PageFormat()
+		if err != nil {
+			return err
+		}
+		iter, err := encoding.NewBackendPageIterator(tenantID, blockMeta.BlockID, format, rw.compactorCfg.ChunkSizeBytes, rw.r)
+		if err != nil {
+			return err
+		}
+
+		for {
+			page, err := iter.NextPage()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			err = currentBlock.WritePage(page)
+			if err != nil {
+				return err
+			}
+			metricCompactionPagesCopied.Inc()
+
+			// write partial block
+			if currentBlock.Length() >= nextBatch {
+				tracker, err = appendBlock(rw, tracker, currentBlock)
+				if err != nil {
+					return errors.Wrap(err, "error writing partial block")
+				}
+				nextBatch = currentBlock.Length() + recordsPerBatch
+			}
+		}
+	}
+
+	err = finishBlock(rw, tracker, currentBlock)
+	if err != nil {
+		return errors.Wrap(err, "error shipping block to backend")
+	}
+	return nil
+}
+
+// markCompacted marks the old blocks compacted so they don't show up in polling.  Blocks in an older version of the
+// block format are counted as upgraded since they were compacted into the current one.
+func markCompacted(rw *readerWriter, blockMetas []*encoding.BlockMeta, tenantID string) {
 	for _, meta := range blockMetas {
 		if err := rw.c.MarkBlockCompacted(meta.BlockID, tenantID); err != nil {
 			level.Error(rw.logger).Log("msg", "unable to mark block compacted", "blockID", meta.BlockID, "tenantID", tenantID, "err", err)
 			metricCompactionErrors.Inc()
+			metricCompactionTenantErrors.WithLabelValues(tenantID).Inc()
+			continue
+		}
+		metricCompactionBytesRead.WithLabelValues(tenantID).Add(float64(meta.Size))
+		if meta.OldFormat() {
+			level.Info(rw.logger).Log("msg", "upgraded block format", "blockID", meta.BlockID, "tenantID", tenantID, "from", meta.Version, "to", encoding.CurrentVersion)
+			metricCompactionBlocksUpgraded.WithLabelValues(meta.Version).Inc()
 		}
 	}
-
-	return nil
 }
 
 func appendBlock(rw *readerWriter, tracker backend.AppendTracker, block *wal.CompactorBlock) (backend.AppendTracker, error) {
@@ -232,16 +452,23 @@ func appendBlock(rw *readerWriter, tracker backend.AppendTracker, block *wal.Com
 func finishBlock(rw *readerWriter, tracker backend.AppendTracker, block *wal.CompactorBlock) error {
 	level.Info(rw.logger).Log("msg", "writing compacted block", "block", fmt.Sprintf("%+v", block.BlockMeta()))
 
-	tracker, err := appendBlock(rw, tracker, block)
+	// completing the block writes its last page so it has to happen before the final append
+	err := block.Complete()
+	if err != nil {
+		return err
+	}
+	tracker, err = appendBlock(rw, tracker, block)
 	if err != nil {
 		return err
 	}
-	block.Complete()
 
 	err = rw.WriteBlockMeta(context.TODO(), tracker, block) // todo:  add timeout
 	if err != nil {
 		return err
 	}
+	meta := block.BlockMeta()
+	metricCompactionBytesWritten.WithLabelValues(meta.TenantID).Add(float64(meta.Size))
+	metricCompactionObjectsWritten.WithLabelValues(meta.TenantID).Add(float64(meta.TotalObjects))
 	err = block.Clear()
 	if err != nil {
 		level.Error(rw.logger).Log("msg", "error cleaning up currentBlock in compaction", "err", err)
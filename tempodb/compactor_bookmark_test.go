@@ -73,7 +73,9 @@ func TestCurrentClear(t *testing.T) {
 	blockID = complete.BlockMeta().BlockID
 	rw := r.(*readerWriter)
 
-	iter, err := encoding.NewBackendIterator(testTenantID, blockID, 10, rw.r)
+	format, err := complete.BlockMeta().PageFormat()
+	assert.NoError(t, err)
+	iter, err := encoding.NewBackendIterator(testTenantID, blockID, format, 10, rw.r)
 	assert.NoError(t, err)
 	bm := newBookmark(iter)
 
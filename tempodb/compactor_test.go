@@ -1,17 +1,22 @@
 package tempodb
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/grafana/tempo/pkg/tempopb"
@@ -37,7 +42,21 @@ func (m *mockSharder) Combine(objA []byte, objB []byte) []byte {
 	return objB
 }
 
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	assert.NoError(t, c.Write(m))
+	return m.GetCounter().GetValue()
+}
+
 func TestCompaction(t *testing.T) {
+	for _, enc := range encoding.SupportedEncodings {
+		t.Run(string(enc), func(t *testing.T) {
+			testCompaction(t, enc)
+		})
+	}
+}
+
+func testCompaction(t *testing.T, enc encoding.Encoding) {
 	tempDir, err := ioutil.TempDir("/tmp", "")
 	defer os.RemoveAll(tempDir)
 	assert.NoError(t, err, "unexpected error creating temp dir")
@@ -56,10 +75,14 @@ func TestCompaction(t *testing.T) {
 			ChunkBufferSize: 10 * 1024 * 1024,
 		},*/
 		WAL: &wal.Config{
-			Filepath:        path.Join(tempDir, "wal"),
-			IndexDownsample: 11,
-			BloomFP:         .01,
+			Filepath:           path.Join(tempDir, "wal"),
+			IndexDownsample:    11,
+			BloomFP:            .01,
+			BloomShards:        4,
+			Encoding:           enc,
+			IndexPageSizeBytes: 100,
 		},
+		PrefetchPages:    3,
 		MaintenanceCycle: 0,
 	}, log.NewNopLogger())
 
@@ -122,7 +145,7 @@ func TestCompaction(t *testing.T) {
 	rw.pollBlocklist()
 
 	blocklist := rw.blocklist(testTenantID)
-	blockSelector := newTimeWindowBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, 10000)
+	blockSelector := newTimeWindowBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, defaultActiveWindow, 10000, 0)
 
 	expectedCompactions := len(blocklist) / inputBlocks
 	compactions := 0
@@ -148,12 +171,16 @@ func TestCompaction(t *testing.T) {
 	var records int
 	for _, meta := range rw.blockLists[testTenantID] {
 		records += meta.TotalObjects
+		assert.Equal(t, enc, meta.Encoding)
+		assert.NotEmpty(t, meta.IndexPages)
+		assert.Len(t, meta.BloomShards, 4)
+		assert.NotZero(t, meta.BloomFalsePositive)
 	}
 	assert.Equal(t, blockCount*recordCount, records)
 
 	// now see if we can find our ids
 	for i, id := range allIds {
-		b, _, err := rw.Find(context.Background(), testTenantID, id)
+		b, _, _, err := rw.Find(context.Background(), testTenantID, id)
 		assert.NoError(t, err)
 
 		out := &tempopb.PushRequest{}
@@ -224,7 +251,7 @@ func TestSameIDCompaction(t *testing.T) {
 
 	var blocks []*encoding.BlockMeta
 	blocklist := rw.blocklist(testTenantID)
-	blockSelector := newTimeWindowBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, 10000)
+	blockSelector := newTimeWindowBlockSelector(blocklist, rw.compactorCfg.MaxCompactionRange, defaultActiveWindow, 10000, 0)
 	blocks, _ = blockSelector.BlocksToCompact()
 	assert.Len(t, blocks, inputBlocks)
 
@@ -240,3 +267,358 @@ func TestSameIDCompaction(t *testing.T) {
 	}
 	assert.Equal(t, blockCount-blocksPerCompaction, records)
 }
+
+func TestCopyPagesCompaction(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 11,
+			BloomFP:         .01,
+			Encoding:        encoding.EncGZIP,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	c.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:          10,
+		MaxCompactionRange:      24 * time.Hour,
+		BlockRetention:          0,
+		CompactedBlockRetention: 0,
+	}, &mockSharder{})
+
+	// the ids of each block start with the block's number so the blocks share no ids
+	blockCount := 2
+	recordCount := 100
+	allReqs := make([]*tempopb.PushRequest, 0, blockCount*recordCount)
+	allIds := make([][]byte, 0, blockCount*recordCount)
+	var inputObjects []byte
+	for i := 0; i < blockCount; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+
+		for j := 0; j < recordCount; j++ {
+			id := make([]byte, 16)
+			rand.Read(id)
+			id[0] = byte(i)
+
+			req := test.MakeRequest(10, id)
+			allReqs = append(allReqs, req)
+			allIds = append(allIds, id)
+
+			bReq, err := proto.Marshal(req)
+			assert.NoError(t, err)
+			err = head.Write(id, bReq)
+			assert.NoError(t, err, "unexpected error writing req")
+		}
+
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		assert.True(t, complete.BlockMeta().CopyablePages)
+
+		objects, err := ioutil.ReadFile(complete.ObjectFilePath())
+		assert.NoError(t, err)
+		inputObjects = append(inputObjects, objects[:complete.BlockMeta().Size]...)
+
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+
+	blocks := rw.blocklist(testTenantID)
+	assert.Len(t, blocks, blockCount)
+	sort.Slice(blocks, func(i, j int) bool { return bytes.Compare(blocks[i].MinID, blocks[j].MinID) == 1 })
+	assert.False(t, rw.wal.CanCopyPages(blocks))
+	sort.Slice(blocks, func(i, j int) bool { return bytes.Compare(blocks[i].MinID, blocks[j].MinID) == -1 })
+	assert.True(t, rw.wal.CanCopyPages(blocks))
+
+	err = rw.compact(blocks, testTenantID)
+	assert.NoError(t, err)
+	checkBlocklists(t, uuid.Nil, 1, blockCount, rw)
+
+	// the pages of the blocks were copied in order instead of repaged every 11 objects
+	meta := rw.blocklist(testTenantID)[0]
+	assert.Equal(t, blockCount*recordCount, meta.TotalObjects)
+	assert.Equal(t, uint8(1), meta.CompactionLevel)
+	assert.True(t, meta.CopyablePages)
+	objects, err := ioutil.ReadFile(path.Join(tempDir, "traces", testTenantID, meta.BlockID.String(), "traces"))
+	assert.NoError(t, err)
+	assert.Equal(t, inputObjects, objects[:meta.Size])
+
+	for i, id := range allIds {
+		b, _, _, err := rw.Find(context.Background(), testTenantID, id)
+		assert.NoError(t, err)
+
+		out := &tempopb.PushRequest{}
+		err = proto.Unmarshal(b, out)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(allReqs[i], out))
+	}
+}
+
+func TestCompactionUpgradesOldFormat(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 11,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	c.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:          10,
+		MaxCompactionRange:      24 * time.Hour,
+		BlockRetention:          0,
+		CompactedBlockRetention: 0,
+	}, &mockSharder{})
+
+	// blocks that share no ids, so only their format keeps their pages from being copied
+	var allIds [][]byte
+	for i := 0; i < 2; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		for j := 0; j < 20; j++ {
+			id := make([]byte, 16)
+			rand.Read(id)
+			id[0] = byte(i)
+			allIds = append(allIds, id)
+			assert.NoError(t, head.Write(id, id))
+		}
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		assert.NoError(t, w.WriteBlock(context.Background(), complete))
+
+		// v0 blocks with page checksums read like v1 blocks
+		meta := complete.BlockMeta()
+		meta.Version = encoding.VersionV0
+		b, err := json.Marshal(meta)
+		assert.NoError(t, err)
+		err = ioutil.WriteFile(path.Join(tempDir, "traces", testTenantID, meta.BlockID.String(), "meta.json"), b, 0644)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	blocks := rw.blocklist(testTenantID)
+	assert.Len(t, blocks, 2)
+	assert.Equal(t, 2.0, gaugeValue(t, metricBlocklistOldFormat.WithLabelValues(testTenantID)))
+	sort.Slice(blocks, func(i, j int) bool { return bytes.Compare(blocks[i].MinID, blocks[j].MinID) == -1 })
+	assert.False(t, rw.wal.CanCopyPages(blocks))
+
+	err = rw.compact(blocks, testTenantID)
+	assert.NoError(t, err)
+	checkBlocklists(t, uuid.Nil, 1, 2, rw)
+
+	meta := rw.blocklist(testTenantID)[0]
+	assert.Equal(t, encoding.CurrentVersion, meta.Version)
+	assert.Equal(t, []string{encoding.VersionV0}, meta.UpgradedFrom)
+	assert.Equal(t, 0.0, gaugeValue(t, metricBlocklistOldFormat.WithLabelValues(testTenantID)))
+
+	for _, id := range allIds {
+		b, _, _, err := rw.Find(context.Background(), testTenantID, id)
+		assert.NoError(t, err)
+		assert.Equal(t, id, b)
+	}
+}
+
+func TestPauseCompaction(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 11,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	c.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:          10,
+		MaxCompactionRange:      24 * time.Hour,
+		MaxCompactionObjects:    1000,
+		BlockRetention:          0,
+		CompactedBlockRetention: 0,
+	}, &mockSharder{})
+
+	for i := 0; i < 2; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		id := make([]byte, 16)
+		rand.Read(id)
+		err = head.Write(id, []byte{0x01})
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+
+	c.PauseCompaction()
+	assert.True(t, c.CompactionPaused())
+	rw.doCompaction()
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 2)
+	assert.Len(t, rw.compactedBlocklist(testTenantID), 0)
+
+	c.ResumeCompaction()
+	assert.False(t, c.CompactionPaused())
+	rw.doCompaction()
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+	assert.Len(t, rw.compactedBlocklist(testTenantID), 2)
+}
+
+func TestTinyBlockCompaction(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 11,
+			BloomFP:         .01,
+			Encoding:        encoding.EncGZIP,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	c.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:       10,
+		MaxCompactionRange:   24 * time.Hour,
+		MaxCompactionObjects: 1000,
+		TinyBlockObjects:     100,
+	}, &mockSharder{})
+
+	// every block holds a replica of the same object as well as its own
+	replicaID := make([]byte, 16)
+	rand.Read(replicaID)
+	replica, err := proto.Marshal(test.MakeRequest(10, replicaID))
+	assert.NoError(t, err)
+
+	blockCount := 5
+	recordCount := 10
+	var allIds [][]byte
+	for i := 0; i < blockCount; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+
+		err = head.Write(replicaID, replica)
+		assert.NoError(t, err)
+		for j := 0; j < recordCount; j++ {
+			id := make([]byte, 16)
+			rand.Read(id)
+			allIds = append(allIds, id)
+
+			bReq, err := proto.Marshal(test.MakeRequest(10, id))
+			assert.NoError(t, err)
+			err = head.Write(id, bReq)
+			assert.NoError(t, err)
+		}
+
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), blockCount)
+
+	deduplicated := counterValue(t, metricCompactionObjectsDeduplicated.WithLabelValues(testTenantID))
+	combined := counterValue(t, metricCompactionObjectsCombined.WithLabelValues(testTenantID))
+	written := counterValue(t, metricCompactionObjectsWritten.WithLabelValues(testTenantID))
+	bytesWritten := counterValue(t, metricCompactionBytesWritten.WithLabelValues(testTenantID))
+
+	// all the blocks are combined by a single compaction
+	rw.compactTenant(testTenantID)
+	checkBlocklists(t, uuid.Nil, 1, blockCount, rw)
+
+	meta := rw.blocklist(testTenantID)[0]
+	assert.Equal(t, blockCount*recordCount+1, meta.TotalObjects)
+	assert.Equal(t, uint8(1), meta.CompactionLevel)
+
+	// the replicas were identical so they count as deduplicated rather than combined
+	assert.Equal(t, float64(blockCount-1), counterValue(t, metricCompactionObjectsDeduplicated.WithLabelValues(testTenantID))-deduplicated)
+	assert.Equal(t, float64(0), counterValue(t, metricCompactionObjectsCombined.WithLabelValues(testTenantID))-combined)
+	assert.Equal(t, float64(meta.TotalObjects), counterValue(t, metricCompactionObjectsWritten.WithLabelValues(testTenantID))-written)
+	assert.Equal(t, float64(meta.Size), counterValue(t, metricCompactionBytesWritten.WithLabelValues(testTenantID))-bytesWritten)
+
+	for _, id := range append(allIds, replicaID) {
+		b, _, _, err := rw.Find(context.Background(), testTenantID, id)
+		assert.NoError(t, err)
+		assert.NotNil(t, b)
+	}
+	b, _, _, err := rw.Find(context.Background(), testTenantID, replicaID)
+	assert.NoError(t, err)
+	assert.Equal(t, replica, b)
+}
+
+func TestMarkCompactedMetrics(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, _, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 11,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+	rw := r.(*readerWriter)
+
+	bytesRead := counterValue(t, metricCompactionBytesRead.WithLabelValues(testTenantID))
+	tenantErrors := counterValue(t, metricCompactionTenantErrors.WithLabelValues(testTenantID))
+	errs := counterValue(t, metricCompactionErrors)
+
+	// the block doesn't exist so it can't be marked compacted and its bytes weren't compacted away
+	markCompacted(rw, []*encoding.BlockMeta{{BlockID: uuid.New(), TenantID: testTenantID, Size: 100}}, testTenantID)
+
+	assert.Equal(t, bytesRead, counterValue(t, metricCompactionBytesRead.WithLabelValues(testTenantID)))
+	assert.Equal(t, tenantErrors+1, counterValue(t, metricCompactionTenantErrors.WithLabelValues(testTenantID)))
+	assert.Equal(t, errs+1, counterValue(t, metricCompactionErrors))
+}
@@ -3,11 +3,21 @@ package tempodb
 import (
 	"time"
 
+	"github.com/grafana/tempo/tempodb/backend/azure"
+	"github.com/grafana/tempo/tempodb/backend/cos"
 	"github.com/grafana/tempo/tempodb/backend/diskcache"
 	"github.com/grafana/tempo/tempodb/backend/gcs"
+	"github.com/grafana/tempo/tempodb/backend/hdfs"
 	"github.com/grafana/tempo/tempodb/backend/local"
 	"github.com/grafana/tempo/tempodb/backend/memcached"
+	"github.com/grafana/tempo/tempodb/backend/memorycache"
+	"github.com/grafana/tempo/tempodb/backend/mirror"
+	"github.com/grafana/tempo/tempodb/backend/oss"
+	"github.com/grafana/tempo/tempodb/backend/ratelimit"
+	"github.com/grafana/tempo/tempodb/backend/redis"
+	"github.com/grafana/tempo/tempodb/backend/retry"
 	"github.com/grafana/tempo/tempodb/backend/s3"
+	"github.com/grafana/tempo/tempodb/backend/swift"
 	"github.com/grafana/tempo/tempodb/pool"
 	"github.com/grafana/tempo/tempodb/wal"
 )
@@ -17,19 +27,164 @@ type Config struct {
 	Local   *local.Config `yaml:"local"`
 	GCS     *gcs.Config   `yaml:"gcs"`
 	S3      *s3.Config    `yaml:"s3"`
+	Azure   *azure.Config `yaml:"azure"`
+	Swift   *swift.Config `yaml:"swift"`
+	OSS     *oss.Config   `yaml:"oss"`
+	COS     *cos.Config   `yaml:"cos"`
+	HDFS    *hdfs.Config  `yaml:"hdfs"`
 	Pool    *pool.Config  `yaml:"pool,omitempty"`
 	WAL     *wal.Config   `yaml:"wal"`
 
+	// ColdTier is a second backend blocks are moved to once they are old enough
+	ColdTier *ColdTierConfig `yaml:"cold_tier"`
+	// Mirror is a second backend every block is replicated to for disaster recovery
+	Mirror *MirrorConfig `yaml:"mirror"`
+
+	// EncryptionKeyFile is a file holding the hex encoded AES key the pages of traces and the index of new blocks are
+	// encrypted with using AES-GCM.  Blocks record the id of their key.  Empty writes unencrypted blocks.
+	EncryptionKeyFile string `yaml:"encryption_key_file"`
+	// DecryptionKeyFiles are files holding other keys blocks may be encrypted with, e.g. keys rotated out
+	DecryptionKeyFiles []string `yaml:"decryption_key_files"`
+
+	// ReadOnly rejects writes and deletes, e.g. to query a bucket owned by another install.  Compaction,
+	// retention and tenant index building are disabled.
+	ReadOnly bool `yaml:"read_only"`
+
+	Retry     *retry.Config     `yaml:"retry"`
+	RateLimit *ratelimit.Config `yaml:"rate_limit"`
+
 	Diskcache *diskcache.Config `yaml:"disk_cache"`
 	Memcached *memcached.Config `yaml:"memcached"`
+	Redis     *redis.Config     `yaml:"redis"`
+	// MemoryCache is an LRU of blooms and indexes in front of the other caches
+	MemoryCache *memorycache.Config `yaml:"memory_cache"`
 
 	MaintenanceCycle time.Duration `yaml:"maintenance_cycle"`
+	// HealthCheckInterval is how often every backend is probed with a read of a meta that doesn't exist.  The
+	// component isn't ready until the primary backend and cold tier pass.  0 disables.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+
+	// BlockUploadConcurrency caps the number of completed blocks written to the backend at once.  Further
+	// writes wait for an upload to finish.  0 is unlimited.
+	BlockUploadConcurrency int `yaml:"block_upload_concurrency"`
+	// BlockUploadBufferBytes caps the bloom filter and index bytes held in memory by blocks being written.
+	// A block larger than this is still written once nothing else is in flight.  0 is unlimited.
+	BlockUploadBufferBytes int `yaml:"block_upload_buffer_bytes"`
+	// AsyncBlockWrites returns from writing a completed block once it is within the limits above and uploads it
+	// in the background.  The block is only marked flushed once uploaded.  FlushAll waits for the uploads.
+	AsyncBlockWrites bool `yaml:"async_block_writes"`
+
+	// MetaCacheMaxBytes caps the in memory cache of parsed bloom filters and block metas.  0 disables.
+	MetaCacheMaxBytes int `yaml:"meta_cache_max_bytes"`
+
+	// PrefetchRecentBlocks warms the caches with the bloom filters and indexes of blocks written within this
+	// long after every blocklist poll.  Requires the meta cache, memory cache, disk cache, memcached or
+	// redis.  0 disables.
+	PrefetchRecentBlocks time.Duration `yaml:"prefetch_recent_blocks"`
+
+	// PrefetchPages is how many pages of objects compaction and search read ahead of the page being iterated, in the
+	// background, so reading the backend overlaps with decompressing and combining objects.  0 reads pages when
+	// they are needed.
+	PrefetchPages int `yaml:"prefetch_pages"`
+
+	// BlocklistPollConcurrency is the number of tenants polled at once.  Defaults to 1.
+	BlocklistPollConcurrency int `yaml:"blocklist_poll_concurrency"`
+	// BlocklistPollJitter adds up to this much random delay to each maintenance cycle's poll.
+	BlocklistPollJitter time.Duration `yaml:"blocklist_poll_jitter"`
+
+	// BlocklistPollTolerateConsecutiveErrors is the number of polls in a row that may fail to list a tenant
+	// completely before the incomplete blocklist replaces the last complete one.  Until then the previous
+	// blocklist is kept so a flaky backend doesn't make traces disappear.  0 always uses the latest poll.
+	BlocklistPollTolerateConsecutiveErrors int `yaml:"blocklist_poll_tolerate_consecutive_errors"`
+
+	// BlocklistPollStaleTenantIndex enables the tenant index.  The compactor that owns a tenant writes
+	// its blocklist to a single index object each poll and everyone else reads it instead of listing the
+	// tenant.  Readers fall back to listing if the index is missing or older than this.  0 disables.
+	BlocklistPollStaleTenantIndex time.Duration `yaml:"blocklist_poll_stale_tenant_index"`
 }
 
 type CompactorConfig struct {
 	ChunkSizeBytes          uint32        `yaml:"chunk_size_bytes"` // todo: do we need this?
 	MaxCompactionRange      time.Duration `yaml:"compaction_window"`
 	MaxCompactionObjects    int           `yaml:"max_compaction_objects"`
+	MaxCompactionBytes      uint64        `yaml:"max_compaction_bytes"` // 0 is unlimited
 	BlockRetention          time.Duration `yaml:"block_retention"`
 	CompactedBlockRetention time.Duration `yaml:"compacted_block_retention"`
+	// QuarantinedBlockRetention is how long a block whose meta fails validation is kept so it can be repaired before
+	// retention deletes it.  0 keeps them until they are deleted by hand.
+	QuarantinedBlockRetention time.Duration `yaml:"quarantined_block_retention"`
+
+	// MaxCompactionLevel and MaxBlockBytes stop compacting blocks that are big enough.  Blocks compacted
+	// MaxCompactionLevel times or holding at least MaxBlockBytes of objects aren't compacted again.  0 is unlimited.
+	MaxCompactionLevel int    `yaml:"max_compaction_level"`
+	MaxBlockBytes      uint64 `yaml:"max_block_bytes"`
+
+	// ActiveWindow is how long after a compaction window ends its blocks are still compacted level by level with the
+	// blocks of the same window.  After that the window's blocks are compacted together smallest first.  Defaults to 24h.
+	ActiveWindow time.Duration `yaml:"active_window"`
+
+	// CompactionCycle is how often a compaction pass starts.  Defaults to 30s.
+	CompactionCycle time.Duration `yaml:"compaction_cycle"`
+	// CompactionConcurrency is the number of tenants compacted at once each pass.  Defaults to 1.
+	CompactionConcurrency int `yaml:"compaction_concurrency"`
+	// RetentionCycle is how often retention runs.  Defaults to the maintenance cycle.
+	RetentionCycle time.Duration `yaml:"retention_cycle"`
+	// RetentionConcurrency is the number of tenants retention processes at once.  Defaults to 1.
+	RetentionConcurrency int `yaml:"retention_concurrency"`
+
+	// TinyBlockObjects enables combining tiny blocks.  Level 0 blocks in the active window holding at most this many
+	// objects, e.g. ones flushed by ingesters under little load, are compacted up to MaxTinyBlocks at a time rather than
+	// two at a time.  0 disables.
+	TinyBlockObjects int `yaml:"tiny_block_objects"`
+	// MaxTinyBlocks is the most tiny blocks combined at once.  Defaults to 32.
+	MaxTinyBlocks int `yaml:"max_tiny_blocks"`
+
+	// DisableCompaction and DisableRetention turn off either loop, e.g. to run a retention only instance.
+	DisableCompaction bool `yaml:"disable_compaction"`
+	DisableRetention  bool `yaml:"disable_retention"`
+}
+
+// ColdTierConfig is a second, cheaper backend, e.g. another bucket or storage class.  Blocks are read from
+// whichever backend they are in.
+type ColdTierConfig struct {
+	// MigrateAfter is how long after a block was last written to it is moved to the cold tier by the
+	// compactors' retention cycle.  0 stops migrating.  Blocks already moved are still read.
+	MigrateAfter time.Duration `yaml:"migrate_after"`
+
+	BackendConfig `yaml:",inline"`
+}
+
+// MirrorConfig is a second backend, e.g. a bucket in another region, every block written is replicated to in
+// the background.  The compactors' retention cycle reconciles the two.
+type MirrorConfig struct {
+	mirror.Config `yaml:",inline"`
+
+	BackendConfig `yaml:",inline"`
+}
+
+// BackendConfig selects one of the backends for a backend other than the primary one
+type BackendConfig struct {
+	Backend string        `yaml:"backend"`
+	Local   *local.Config `yaml:"local"`
+	GCS     *gcs.Config   `yaml:"gcs"`
+	S3      *s3.Config    `yaml:"s3"`
+	Azure   *azure.Config `yaml:"azure"`
+	Swift   *swift.Config `yaml:"swift"`
+	OSS     *oss.Config   `yaml:"oss"`
+	COS     *cos.Config   `yaml:"cos"`
+	HDFS    *hdfs.Config  `yaml:"hdfs"`
+}
+
+func (c *BackendConfig) backendConfig() *Config {
+	return &Config{
+		Backend: c.Backend,
+		Local:   c.Local,
+		GCS:     c.GCS,
+		S3:      c.S3,
+		Azure:   c.Azure,
+		Swift:   c.Swift,
+		OSS:     c.OSS,
+		COS:     c.COS,
+		HDFS:    c.HDFS,
+	}
 }
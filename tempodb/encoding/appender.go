@@ -8,7 +8,7 @@ import (
 
 type Appender interface {
 	Append(ID, []byte) error
-	Complete()
+	Complete() error
 	Records() []*Record
 	Length() int
 }
@@ -56,6 +56,6 @@ func (a *appender) Length() int {
 	return len(a.records)
 }
 
-func (a *appender) Complete() {
-
+func (a *appender) Complete() error {
+	return nil
 }
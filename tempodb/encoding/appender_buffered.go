@@ -1,22 +1,35 @@
 package encoding
 
 import (
+	"bytes"
 	"io"
 )
 
+// bufferedAppender groups objects into pages of indexDownsample objects.  Each page is encoded with the page
+// format, written to the writer and indexed by a single record.
 type bufferedAppender struct {
 	writer  io.Writer
+	format  PageFormat
 	records []*Record
 
 	totalObjects    int
 	currentOffset   uint64
 	currentRecord   *Record
+	page            bytes.Buffer
 	indexDownsample int
 }
 
-func NewBufferedAppender(writer io.Writer, indexDownsample int, totalObjectsEstimate int) Appender {
+// PageAppender is an Appender that also takes whole pages already encoded with its page format
+type PageAppender interface {
+	Appender
+	// AppendPage writes a page of objects as is and indexes it by id, the last id in the page
+	AppendPage(id ID, objects int, page []byte) error
+}
+
+func NewBufferedAppender(writer io.Writer, format PageFormat, indexDownsample int, totalObjectsEstimate int) PageAppender {
 	return &bufferedAppender{
 		writer:          writer,
+		format:          format,
 		records:         make([]*Record, 0, totalObjectsEstimate/indexDownsample+1),
 		indexDownsample: indexDownsample,
 	}
@@ -25,7 +38,7 @@ func NewBufferedAppender(writer io.Writer, indexDownsample int, totalObjectsEsti
 // Append appends the id/object to the writer.  Note that the caller is giving up ownership of the two byte arrays backing the slices.
 //   Copies should be made and passed in if this is a problem
 func (a *bufferedAppender) Append(id ID, b []byte) error {
-	length, err := marshalObjectToWriter(id, b, a.writer)
+	_, err := marshalObjectToWriter(id, b, &a.page)
 	if err != nil {
 		return err
 	}
@@ -36,19 +49,37 @@ func (a *bufferedAppender) Append(id ID, b []byte) error {
 		}
 	}
 	a.totalObjects++
-	a.currentOffset += uint64(length)
-
 	a.currentRecord.ID = id
-	a.currentRecord.Length += uint32(length)
 
 	if a.totalObjects%a.indexDownsample == 0 {
-		a.records = append(a.records, a.currentRecord)
-		a.currentRecord = nil
+		return a.flushPage()
 	}
 
 	return nil
 }
 
+// AppendPage completes the current page, if any, before writing the page so objects stay in order
+func (a *bufferedAppender) AppendPage(id ID, objects int, page []byte) error {
+	err := a.Complete()
+	if err != nil {
+		return err
+	}
+
+	_, err = a.writer.Write(page)
+	if err != nil {
+		return err
+	}
+	a.records = append(a.records, &Record{
+		ID:     id,
+		Start:  a.currentOffset,
+		Length: uint32(len(page)),
+	})
+	a.currentOffset += uint64(len(page))
+	a.totalObjects += objects
+
+	return nil
+}
+
 func (a *bufferedAppender) Records() []*Record {
 	return a.records
 }
@@ -57,10 +88,29 @@ func (a *bufferedAppender) Length() int {
 	return a.totalObjects
 }
 
-func (a *bufferedAppender) Complete() {
+func (a *bufferedAppender) Complete() error {
 	if a.currentRecord == nil {
-		return
+		return nil
+	}
+	return a.flushPage()
+}
+
+// flushPage writes the current page and closes its record
+func (a *bufferedAppender) flushPage() error {
+	b, err := a.format.encode(a.page.Bytes())
+	if err != nil {
+		return err
 	}
+	_, err = a.writer.Write(b)
+	if err != nil {
+		return err
+	}
+	a.page.Reset()
+
+	a.currentOffset += uint64(len(b))
+	a.currentRecord.Length = uint32(len(b))
 	a.records = append(a.records, a.currentRecord)
 	a.currentRecord = nil
+
+	return nil
 }
@@ -0,0 +1,285 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+)
+
+// SpillingAppender is an Appender that keeps at most maxRecordBytes of sorted records in memory.  Once over, the
+// records are written to a temporary file in dir as a sorted run and memory starts over, so the records of a large
+// block don't have to fit in memory.  Iterator and FindRecords read the runs back as needed.
+type SpillingAppender struct {
+	appender
+
+	dir            string
+	maxRecordBytes int
+	runs           []*os.File
+	spilled        int
+}
+
+// NewSpillingAppender returns an appender that spills its records to dir once they take more than maxRecordBytes.
+// 0 keeps every record in memory like NewAppender.
+func NewSpillingAppender(writer io.Writer, dir string, maxRecordBytes int) *SpillingAppender {
+	return &SpillingAppender{
+		appender: appender{
+			writer: writer,
+		},
+		dir:            dir,
+		maxRecordBytes: maxRecordBytes,
+	}
+}
+
+func (a *SpillingAppender) Append(id ID, b []byte) error {
+	err := a.appender.Append(id, b)
+	if err != nil {
+		return err
+	}
+
+	if a.maxRecordBytes > 0 && len(a.records)*recordLength >= a.maxRecordBytes {
+		return a.spill()
+	}
+	return nil
+}
+
+// Records returns every record in order.  Spilled records are read back into memory, so prefer Iterator or
+// FindRecords.
+func (a *SpillingAppender) Records() []*Record {
+	if len(a.runs) == 0 {
+		return a.records
+	}
+
+	records := make([]*Record, 0, a.Length())
+	iter := a.recordIterator()
+	for {
+		r, err := iter.next()
+		if err != nil || r == nil {
+			break
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func (a *SpillingAppender) Length() int {
+	return a.spilled + len(a.records)
+}
+
+// Spilled returns the number of records written to disk
+func (a *SpillingAppender) Spilled() int {
+	return a.spilled
+}
+
+// Iterator iterates the objects the records point to in order like NewRecordIterator.  Records are read from disk
+// as they are needed.
+func (a *SpillingAppender) Iterator(ra io.ReaderAt, format PageFormat) Iterator {
+	return &spilledRecordIterator{
+		records: a.recordIterator(),
+		ra:      ra,
+		format:  format,
+	}
+}
+
+// FindRecords returns the records of the id in order
+func (a *SpillingAppender) FindRecords(id ID) ([]*Record, error) {
+	var found []*Record
+	buff := make([]byte, recordLength)
+	for _, run := range a.runs {
+		info, err := run.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		count := int(info.Size() / recordLength)
+		var readErr error
+		i := sort.Search(count, func(i int) bool {
+			if _, err := run.ReadAt(buff, int64(i*recordLength)); err != nil {
+				readErr = err
+				return true
+			}
+			return bytes.Compare(buff[:16], id) >= 0
+		})
+		for ; i < count && readErr == nil; i++ {
+			if _, readErr = run.ReadAt(buff, int64(i*recordLength)); readErr != nil {
+				break
+			}
+			r := unmarshalRecord(buff)
+			if !bytes.Equal(r.ID, id) {
+				break
+			}
+			found = append(found, r)
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	i := sort.Search(len(a.records), func(i int) bool {
+		return bytes.Compare(a.records[i].ID, id) >= 0
+	})
+	for ; i < len(a.records) && bytes.Equal(a.records[i].ID, id); i++ {
+		found = append(found, a.records[i])
+	}
+
+	return found, nil
+}
+
+// Clear removes the spilled records
+func (a *SpillingAppender) Clear() error {
+	var lastErr error
+	for _, run := range a.runs {
+		_ = run.Close()
+		if err := os.Remove(run.Name()); err != nil {
+			lastErr = err
+		}
+	}
+	a.runs = nil
+	return lastErr
+}
+
+// spill writes the records in memory to a new run
+func (a *SpillingAppender) spill() error {
+	run, err := ioutil.TempFile(a.dir, "records-")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(run)
+	buff := make([]byte, recordLength)
+	for _, r := range a.records {
+		marshalRecord(r, buff)
+		if _, err = w.Write(buff); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		_ = run.Close()
+		_ = os.Remove(run.Name())
+		return err
+	}
+
+	a.runs = append(a.runs, run)
+	a.spilled += len(a.records)
+	a.records = nil
+	return nil
+}
+
+// recordIterator merges the runs and the records in memory.  Records of the same id come in the order they were
+// appended.
+func (a *SpillingAppender) recordIterator() *mergedRecordIterator {
+	sources := make([]*recordSource, 0, len(a.runs)+1)
+	for _, run := range a.runs {
+		sources = append(sources, &recordSource{
+			// a section reader so concurrent iterators and FindRecords don't share the file's offset.  runs are read
+			// to EOF
+			reader: bufio.NewReader(io.NewSectionReader(run, 0, math.MaxInt64)),
+		})
+	}
+	sources = append(sources, &recordSource{
+		records: a.records,
+	})
+	return &mergedRecordIterator{
+		sources: sources,
+	}
+}
+
+// recordSource is a run on disk or the records in memory
+type recordSource struct {
+	reader  *bufio.Reader
+	records []*Record
+
+	current *Record
+	done    bool
+}
+
+func (s *recordSource) peek() (*Record, error) {
+	if s.current != nil || s.done {
+		return s.current, nil
+	}
+
+	if s.reader == nil {
+		if len(s.records) == 0 {
+			s.done = true
+			return nil, nil
+		}
+		s.current = s.records[0]
+		s.records = s.records[1:]
+		return s.current, nil
+	}
+
+	buff := make([]byte, recordLength)
+	_, err := io.ReadFull(s.reader, buff)
+	if err == io.EOF {
+		s.done = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.current = unmarshalRecord(buff)
+	return s.current, nil
+}
+
+type mergedRecordIterator struct {
+	sources []*recordSource
+}
+
+// next returns the lowest record of all sources or nil once they are exhausted
+func (m *mergedRecordIterator) next() (*Record, error) {
+	var lowest *recordSource
+	for _, s := range m.sources {
+		r, err := s.peek()
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			continue
+		}
+		// earlier sources win ties so records of an id stay in append order
+		if lowest == nil || bytes.Compare(r.ID, lowest.current.ID) == -1 {
+			lowest = s
+		}
+	}
+
+	if lowest == nil {
+		return nil, nil
+	}
+	r := lowest.current
+	lowest.current = nil
+	return r, nil
+}
+
+type spilledRecordIterator struct {
+	records *mergedRecordIterator
+	ra      io.ReaderAt
+	format  PageFormat
+
+	currentIterator Iterator
+}
+
+func (i *spilledRecordIterator) Next() (ID, []byte, error) {
+	for {
+		if i.currentIterator != nil {
+			id, object, err := i.currentIterator.Next()
+			if err != nil || id != nil {
+				return id, object, err
+			}
+		}
+
+		r, err := i.records.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if r == nil {
+			return nil, nil, nil
+		}
+		i.currentIterator = NewRecordIterator([]*Record{r}, i.ra, i.format)
+	}
+}
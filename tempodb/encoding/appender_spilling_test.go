@@ -0,0 +1,84 @@
+package encoding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpillingAppender(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	require.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+	appender := NewSpillingAppender(buffer, tempDir, 7*recordLength)
+
+	// every id is appended twice to check the order of records of the same id
+	ids := make([]ID, 50)
+	objects := map[string][][]byte{}
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+	for round := 0; round < 2; round++ {
+		for i, id := range ids {
+			object := []byte{byte(round), byte(i)}
+			require.NoError(t, appender.Append(id, object))
+			objects[string(id)] = append(objects[string(id)], object)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) == -1 })
+
+	assert.Equal(t, 100, appender.Length())
+	assert.Equal(t, 98, appender.Spilled())
+	runs, err := ioutil.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, runs, 14)
+
+	records := appender.Records()
+	require.Len(t, records, 100)
+	for i := 1; i < len(records); i++ {
+		assert.True(t, bytes.Compare(records[i-1].ID, records[i].ID) <= 0)
+	}
+
+	iter := appender.Iterator(bytes.NewReader(buffer.Bytes()), PageFormat{})
+	for _, id := range ids {
+		for _, expected := range objects[string(id)] {
+			actualID, actualObject, err := iter.Next()
+			require.NoError(t, err)
+			assert.Equal(t, id, actualID)
+			assert.Equal(t, expected, actualObject)
+		}
+	}
+	actualID, _, err := iter.Next()
+	assert.NoError(t, err)
+	assert.Nil(t, actualID)
+
+	for _, id := range ids {
+		found, err := appender.FindRecords(id)
+		require.NoError(t, err)
+		require.Len(t, found, 2)
+		for i, r := range found {
+			assert.Equal(t, id, r.ID)
+			iter := NewRecordIterator([]*Record{r}, bytes.NewReader(buffer.Bytes()), PageFormat{})
+			_, object, err := iter.Next()
+			require.NoError(t, err)
+			assert.Equal(t, objects[string(id)][i], object)
+		}
+	}
+	found, err := appender.FindRecords(make([]byte, 16))
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	assert.NoError(t, appender.Clear())
+	runs, err = ioutil.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
@@ -2,11 +2,22 @@ package encoding
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// metaVersion is the version of the envelope metas are written in.  Readers verify metas of versions they know and
+// trust newer ones.
+const metaVersion = 2
+
+// ErrInvalidMeta is returned for metas that fail validation, e.g. because they were altered or truncated
+var ErrInvalidMeta = errors.New("invalid block meta")
+
 type CompactedBlockMeta struct {
 	BlockMeta
 
@@ -14,7 +25,7 @@ type CompactedBlockMeta struct {
 }
 
 type BlockMeta struct {
-	Version         string    `json:"format"`
+	Version         string    `json:"format"` // version of the block format.  see VersionedEncoding
 	BlockID         uuid.UUID `json:"blockID"`
 	MinID           ID        `json:"minID"`
 	MaxID           ID        `json:"maxID"`
@@ -23,12 +34,77 @@ type BlockMeta struct {
 	EndTime         time.Time `json:"endTime"`
 	TotalObjects    int       `json:"totalObjects"`
 	CompactionLevel uint8     `json:"compactionLevel"`
+	Size            uint64    `json:"size"` // size of the objects in bytes.  0 for blocks written before it was recorded
+
+	// TotalSpans is the number of spans in the objects and UncompressedSize the size in bytes of the objects before
+	// their pages are compressed.  0 for blocks written before they were recorded.  TotalSpans is also 0 if the
+	// writer couldn't count spans.
+	TotalSpans       uint64 `json:"totalSpans,omitempty"`
+	UncompressedSize uint64 `json:"uncompressedSize,omitempty"`
+
+	// CRC32C (Castagnoli) checksums of the bloom, index and objects as written to the backend.  0 for blocks written
+	// before they were recorded
+	BloomChecksum  uint32 `json:"bloomChecksum,omitempty"`
+	IndexChecksum  uint32 `json:"indexChecksum,omitempty"`
+	ObjectChecksum uint32 `json:"objectChecksum,omitempty"`
+
+	// TotalRecords is the number of records in the index.  IndexPageSize is the size in bytes of the pages the
+	// index is split into and IndexPages the id of the last record of each page, so a record can be found by reading
+	// a single page.  0 and empty for blocks without a paged index, whose index is read whole.
+	TotalRecords  uint32 `json:"totalRecords,omitempty"`
+	IndexPageSize uint32 `json:"indexPageSize,omitempty"`
+	IndexPages    []ID   `json:"indexPages,omitempty"`
+	// IndexPageChecksums are the CRC32C checksums of the index pages.  Empty for blocks written before they were
+	// recorded.
+	IndexPageChecksums []uint32 `json:"indexPageChecksums,omitempty"`
+
+	// BloomShards is the size in bytes of each shard of the bloom filter, which are written back to back in the bloom
+	// object.  Empty for blocks with a single bloom filter.
+	BloomShards []uint32 `json:"bloomShards,omitempty"`
+	// BloomFalsePositive is the estimated false positive rate of the bloom filter given the ids in the block.  0 for
+	// blocks written before it was recorded.
+	BloomFalsePositive float64 `json:"bloomFalsePositive,omitempty"`
+
+	// Encoding is how the block's pages of objects are compressed.  Empty for blocks written before it was recorded,
+	// which are uncompressed.
+	Encoding Encoding `json:"encoding,omitempty"`
+	// PageChecksums is true if each page of objects is followed by its CRC32C.  False for blocks written before
+	// they were.
+	PageChecksums bool `json:"pageChecksums,omitempty"`
+
+	// CopyablePages is true if every id is in a single object, so compacting the block with blocks it shares no ids
+	// with can copy its pages as they are instead of combining objects.  False for blocks written before it was
+	// recorded.
+	CopyablePages bool `json:"copyablePages,omitempty"`
+
+	// EncryptionKeyID is the id of the key the pages of objects and the index are encrypted with.  Empty for
+	// unencrypted blocks.
+	EncryptionKeyID string `json:"encryptionKeyID,omitempty"`
+
+	// TagIndexOffset and TagIndexLength locate the block's tag index, which follows the last page in the objects.
+	// 0 for blocks without one.
+	TagIndexOffset uint64 `json:"tagIndexOffset,omitempty"`
+	TagIndexLength uint32 `json:"tagIndexLength,omitempty"`
+
+	// StatsFooterLength is the length of the stats footer that ends the objects.  0 for blocks written before it was
+	// recorded.
+	StatsFooterLength uint32 `json:"statsFooterLength,omitempty"`
+	// TimeGroupWindow is the duration of the time windows the stats footer groups the records by.  0 if they aren't
+	// grouped.
+	TimeGroupWindow time.Duration `json:"timeGroupWindow,omitempty"`
+
+	// UpgradedFrom are the older versions of the block format of the blocks this block was compacted from.  Empty if
+	// they were all written in its version.
+	UpgradedFrom []string `json:"upgradedFrom,omitempty"`
+
+	// Tier is the storage tier the block is in.  Empty for the primary backend.
+	Tier string `json:"tier,omitempty"`
 }
 
 func NewBlockMeta(tenantID string, blockID uuid.UUID) *BlockMeta {
 	now := time.Now()
 	b := &BlockMeta{
-		Version:   "v0",
+		Version:   CurrentVersion,
 		BlockID:   blockID,
 		MinID:     []byte{},
 		MaxID:     []byte{},
@@ -53,3 +129,71 @@ func (b *BlockMeta) ObjectAdded(id ID) {
 
 	b.TotalObjects++
 }
+
+// blockMetaJSON is BlockMeta without its custom marshalling
+type blockMetaJSON BlockMeta
+
+// metaEnvelope wraps the marshalled meta with the CRC32C of its bytes as written, so the checksum holds no matter
+// which fields the reader knows.
+type metaEnvelope struct {
+	Meta         json.RawMessage `json:"meta"`
+	MetaVersion  int             `json:"metaVersion"`
+	MetaChecksum uint32          `json:"metaChecksum"`
+}
+
+// MarshalJSON writes the meta in an envelope with its version and checksum
+func (b *BlockMeta) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*blockMetaJSON)(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&metaEnvelope{
+		Meta:         data,
+		MetaVersion:  metaVersion,
+		MetaChecksum: crc32.Checksum(data, checksumTable),
+	})
+}
+
+// UnmarshalJSON reads and validates a meta.  Metas written before the envelope are read as they are and trusted.
+// That includes those of version 1, whose checksum was over the meta as the writer marshalled it and couldn't be
+// verified by a reader that didn't know every field.
+func (b *BlockMeta) UnmarshalJSON(data []byte) error {
+	envelope := metaEnvelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+
+	payload := data
+	if envelope.Meta != nil {
+		payload = envelope.Meta
+		if envelope.MetaVersion <= metaVersion && crc32.Checksum(payload, checksumTable) != envelope.MetaChecksum {
+			return fmt.Errorf("%w: checksum mismatch", ErrInvalidMeta)
+		}
+	}
+
+	meta := blockMetaJSON{}
+	if err := json.Unmarshal(payload, &meta); err != nil {
+		return err
+	}
+	if meta.BlockID == uuid.Nil {
+		return fmt.Errorf("%w: no block id", ErrInvalidMeta)
+	}
+	if meta.TenantID == "" {
+		return fmt.Errorf("%w: block %s has no tenant id", ErrInvalidMeta, meta.BlockID)
+	}
+
+	*b = BlockMeta(meta)
+	return nil
+}
+
+// AppendJSONFields adds the marshalled fields to the end of a JSON object
+func AppendJSONFields(object []byte, fields string) []byte {
+	out := make([]byte, 0, len(object)+len(fields)+1)
+	out = append(out, object[:len(object)-1]...)
+	if len(object) > 2 {
+		out = append(out, ',')
+	}
+	out = append(out, fields...)
+	return append(out, '}')
+}
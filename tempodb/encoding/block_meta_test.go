@@ -2,11 +2,15 @@ package encoding
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
 	"math/rand"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -35,3 +39,59 @@ func TestBlockMeta(t *testing.T) {
 
 	assert.Equal(t, 2, b.TotalObjects)
 }
+
+func TestBlockMetaJSON(t *testing.T) {
+	b := NewBlockMeta(testTenantID, uuid.New())
+	b.ObjectAdded([]byte{0x01})
+	b.Size = 100
+
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"metaVersion":2`)
+
+	actual := &BlockMeta{}
+	require.NoError(t, json.Unmarshal(data, actual))
+	assert.True(t, b.StartTime.Equal(actual.StartTime))
+	actual.StartTime, actual.EndTime = b.StartTime, b.EndTime
+	assert.Equal(t, b, actual)
+
+	// compacted metas are checked the same way
+	compacted := &CompactedBlockMeta{}
+	require.NoError(t, json.Unmarshal(data, compacted))
+	assert.Equal(t, b.BlockID, compacted.BlockID)
+
+	// altered
+	altered := bytes.Replace(data, []byte(`"size":100`), []byte(`"size":101`), 1)
+	err = json.Unmarshal(altered, &BlockMeta{})
+	assert.True(t, errors.Is(err, ErrInvalidMeta))
+
+	// metas written before they had a checksum are trusted
+	legacy, err := json.Marshal((*blockMetaJSON)(b))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(legacy, &BlockMeta{}))
+
+	// as are metas of newer versions
+	newer := bytes.Replace(altered, []byte(`"metaVersion":2`), []byte(`"metaVersion":3`), 1)
+	require.NoError(t, json.Unmarshal(newer, &BlockMeta{}))
+
+	// fields added by a newer writer don't break the checksum
+	payload, err := json.Marshal((*blockMetaJSON)(b))
+	require.NoError(t, err)
+	payload = AppendJSONFields(payload, `"addedLater":true`)
+	extra, err := json.Marshal(&metaEnvelope{
+		Meta:         payload,
+		MetaVersion:  metaVersion,
+		MetaChecksum: crc32.Checksum(payload, checksumTable),
+	})
+	require.NoError(t, err)
+	actual = &BlockMeta{}
+	require.NoError(t, json.Unmarshal(extra, actual))
+	assert.Equal(t, b.BlockID, actual.BlockID)
+	assert.Equal(t, b.Size, actual.Size)
+
+	// metas must identify their block
+	err = json.Unmarshal([]byte(`{"tenantID":"fake"}`), &BlockMeta{})
+	assert.True(t, errors.Is(err, ErrInvalidMeta))
+	err = json.Unmarshal([]byte(`{"blockID":"`+b.BlockID.String()+`"}`), &BlockMeta{})
+	assert.True(t, errors.Is(err, ErrInvalidMeta))
+}
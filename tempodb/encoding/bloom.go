@@ -0,0 +1,117 @@
+package encoding
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/willf/bloom"
+)
+
+// MaxBloomShards is the most shards a block's bloom filter can be split into.  Shards are keyed by a single byte
+// of the id.
+const MaxBloomShards = 256
+
+// ShardedBloomFilter is a block's bloom filter split into shards by id prefix so a query for an id only needs the
+// shard the id falls in.  With one shard it's a plain bloom filter and is written exactly as one.
+type ShardedBloomFilter struct {
+	shards []*bloom.BloomFilter
+	added  []uint
+}
+
+// NewShardedBloomFilter creates a filter of shardCount shards sized for estimatedObjects ids in total.  shardCount is
+// clamped to [1, MaxBloomShards].
+func NewShardedBloomFilter(fp float64, shardCount int, estimatedObjects int) *ShardedBloomFilter {
+	if shardCount < 1 {
+		shardCount = 1
+	}
+	if shardCount > MaxBloomShards {
+		shardCount = MaxBloomShards
+	}
+
+	perShard := estimatedObjects / shardCount
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	b := &ShardedBloomFilter{
+		shards: make([]*bloom.BloomFilter, shardCount),
+		added:  make([]uint, shardCount),
+	}
+	for i := range b.shards {
+		b.shards[i] = bloom.NewWithEstimates(uint(perShard), fp)
+	}
+	return b
+}
+
+func (b *ShardedBloomFilter) Add(id ID) {
+	shard := BloomShard(id, len(b.shards))
+	b.shards[shard].Add(id)
+	b.added[shard]++
+}
+
+func (b *ShardedBloomFilter) Test(id ID) bool {
+	return b.shards[BloomShard(id, len(b.shards))].Test(id)
+}
+
+// FalsePositiveRate estimates the rate at which the filter claims to hold an id it doesn't from the ids added to
+// it, i.e. the rate it achieves rather than the one it was sized for.  Ids are assumed to fall in every shard
+// equally often.
+func (b *ShardedBloomFilter) FalsePositiveRate() float64 {
+	var sum float64
+	for i, shard := range b.shards {
+		k := float64(shard.K())
+		m := float64(shard.Cap())
+		sum += math.Pow(1-math.Exp(-k*float64(b.added[i])/m), k)
+	}
+	return sum / float64(len(b.shards))
+}
+
+// Marshal returns the shards written back to back, as stored in the block's bloom object, and the size of each
+func (b *ShardedBloomFilter) Marshal() ([]byte, []uint32, error) {
+	buffer := &bytes.Buffer{}
+	sizes := make([]uint32, 0, len(b.shards))
+	for _, shard := range b.shards {
+		n, err := shard.WriteTo(buffer)
+		if err != nil {
+			return nil, nil, err
+		}
+		sizes = append(sizes, uint32(n))
+	}
+	return buffer.Bytes(), sizes, nil
+}
+
+// BloomShard returns the shard of shardCount id falls in.  Shards split the range of the first non-zero byte of the
+// id evenly.  Leading zeros are skipped so 64 bit trace ids, which are padded with them, spread across the shards too.
+func BloomShard(id ID, shardCount int) int {
+	if shardCount <= 1 {
+		return 0
+	}
+	for _, b := range id {
+		if b != 0 {
+			return int(b) * shardCount / MaxBloomShards
+		}
+	}
+	return 0
+}
+
+// BloomShardCount is the number of shards the block's bloom filter is split into
+func (b *BlockMeta) BloomShardCount() int {
+	if len(b.BloomShards) == 0 {
+		return 1
+	}
+	return len(b.BloomShards)
+}
+
+// BloomShard returns the shard of the block's bloom filter id falls in
+func (b *BlockMeta) BloomShard(id ID) int {
+	return BloomShard(id, b.BloomShardCount())
+}
+
+// BloomShardRange returns the offset and length in the bloom object of the shard.  Only valid for blocks with a
+// sharded bloom filter.
+func (b *BlockMeta) BloomShardRange(shard int) (offset uint64, length uint32) {
+	for _, size := range b.BloomShards[:shard] {
+		offset += uint64(size)
+	}
+	return offset, b.BloomShards[shard]
+}
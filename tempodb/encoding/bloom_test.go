@@ -0,0 +1,75 @@
+package encoding
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/willf/bloom"
+)
+
+func TestBloomShard(t *testing.T) {
+	assert.Equal(t, 0, BloomShard(ID{0xff}, 1))
+	assert.Equal(t, 0, BloomShard(ID{0x00, 0x00}, 4))
+	assert.Equal(t, 0, BloomShard(ID{0x3f}, 4))
+	assert.Equal(t, 1, BloomShard(ID{0x40}, 4))
+	assert.Equal(t, 3, BloomShard(ID{0xff}, 4))
+	assert.Equal(t, 255, BloomShard(ID{0xff}, MaxBloomShards))
+
+	// leading zeros of padded 64 bit ids are skipped
+	assert.Equal(t, 3, BloomShard(ID{0x00, 0x00, 0xff, 0x00}, 4))
+}
+
+func TestShardedBloomFilter(t *testing.T) {
+	ids := make([]ID, 100)
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+
+	for _, shardCount := range []int{0, 1, 4, 1000} {
+		filter := NewShardedBloomFilter(.01, shardCount, len(ids))
+		for _, id := range ids {
+			filter.Add(id)
+		}
+		for _, id := range ids {
+			assert.True(t, filter.Test(id))
+		}
+
+		bloomBytes, shards, err := filter.Marshal()
+		require.NoError(t, err)
+
+		meta := NewBlockMeta(testTenantID, uuid.New())
+		if len(shards) > 1 {
+			meta.BloomShards = shards
+		}
+		switch shardCount {
+		case 0, 1:
+			// a single filter is written as a plain bloom filter
+			assert.Equal(t, 1, meta.BloomShardCount())
+			assert.InDelta(t, .01, filter.FalsePositiveRate(), .005)
+			single := &bloom.BloomFilter{}
+			_, err = single.ReadFrom(bytes.NewReader(bloomBytes))
+			require.NoError(t, err)
+			for _, id := range ids {
+				assert.True(t, single.Test(id))
+			}
+			continue
+		case 1000:
+			assert.Equal(t, MaxBloomShards, meta.BloomShardCount())
+		default:
+			assert.Equal(t, shardCount, meta.BloomShardCount())
+		}
+
+		for _, id := range ids {
+			offset, length := meta.BloomShardRange(meta.BloomShard(id))
+			shard := &bloom.BloomFilter{}
+			_, err = shard.ReadFrom(bytes.NewReader(bloomBytes[offset : offset+uint64(length)]))
+			require.NoError(t, err)
+			assert.True(t, shard.Test(id))
+		}
+	}
+}
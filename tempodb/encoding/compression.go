@@ -0,0 +1,112 @@
+package encoding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// Encoding is how the pages of objects a block's records point to are compressed.  It's chosen when the block is
+// written and recorded in its meta so readers pick the right codec for each block.
+type Encoding string
+
+const (
+	EncNone   Encoding = "none"
+	EncGZIP   Encoding = "gzip"
+	EncSnappy Encoding = "snappy"
+	EncLZ4    Encoding = "lz4"
+	EncZstd   Encoding = "zstd"
+)
+
+// SupportedEncodings are the encodings blocks can be written and read with
+var SupportedEncodings = []Encoding{EncNone, EncGZIP, EncSnappy}
+
+// ParseEncoding returns the encoding named s.  lz4 and zstd are known but their codecs aren't part of this build.
+func ParseEncoding(s string) (Encoding, error) {
+	e := Encoding(s)
+	for _, supported := range SupportedEncodings {
+		if e == supported {
+			return e, nil
+		}
+	}
+	if e == EncLZ4 || e == EncZstd {
+		return "", fmt.Errorf("encoding %s is not supported by this build. supported encodings are %s", s, supportedEncodings())
+	}
+	return "", fmt.Errorf("unknown encoding %s. supported encodings are %s", s, supportedEncodings())
+}
+
+// String implements flag.Value
+func (e Encoding) String() string {
+	return string(e)
+}
+
+// Set implements flag.Value
+func (e *Encoding) Set(s string) error {
+	parsed, err := ParseEncoding(s)
+	if err != nil {
+		return err
+	}
+	*e = parsed
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (e *Encoding) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return e.Set(s)
+}
+
+// compress returns the page as written to the block.  For EncNone it's the page itself.
+func (e Encoding) compress(page []byte) ([]byte, error) {
+	switch e {
+	case "", EncNone:
+		return page, nil
+	case EncGZIP:
+		buf := bytes.NewBuffer(make([]byte, 0, len(page)/2))
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(page); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case EncSnappy:
+		return snappy.Encode(nil, page), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %s", e)
+}
+
+// decompress reverses compress.  Blocks written before encodings were recorded have an empty encoding and are
+// uncompressed.
+func (e Encoding) decompress(page []byte) ([]byte, error) {
+	switch e {
+	case "", EncNone:
+		return page, nil
+	case EncGZIP:
+		r, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case EncSnappy:
+		return snappy.Decode(nil, page)
+	}
+	return nil, fmt.Errorf("unsupported encoding %s", e)
+}
+
+func supportedEncodings() string {
+	names := make([]string, 0, len(SupportedEncodings))
+	for _, e := range SupportedEncodings {
+		names = append(names, string(e))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,113 @@
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEncoding(t *testing.T) {
+	for _, e := range SupportedEncodings {
+		parsed, err := ParseEncoding(string(e))
+		assert.NoError(t, err)
+		assert.Equal(t, e, parsed)
+	}
+
+	_, err := ParseEncoding("zstd")
+	assert.EqualError(t, err, "encoding zstd is not supported by this build. supported encodings are none, gzip, snappy")
+
+	_, err = ParseEncoding("lz4")
+	assert.EqualError(t, err, "encoding lz4 is not supported by this build. supported encodings are none, gzip, snappy")
+
+	_, err = ParseEncoding("brotli")
+	assert.Error(t, err)
+}
+
+func TestEncodings(t *testing.T) {
+	ids := make([]ID, 20)
+	objects := make(map[string][]byte, len(ids))
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+		// compressible objects
+		objects[string(ids[i])] = bytes.Repeat([]byte{byte(i)}, 1000)
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) == -1 })
+
+	for _, enc := range SupportedEncodings {
+		t.Run(string(enc), func(t *testing.T) {
+			format := PageFormat{Encoding: enc, Checksum: true}
+			buffer := &bytes.Buffer{}
+			appender := NewBufferedAppender(buffer, format, 3, len(ids))
+			for _, id := range ids {
+				require.NoError(t, appender.Append(id, objects[string(id)]))
+			}
+			require.NoError(t, appender.Complete())
+
+			records := appender.Records()
+			assert.Len(t, records, 7)
+			assert.Equal(t, uint64(buffer.Len()), RecordsSize(records))
+			if enc != EncNone {
+				assert.Less(t, buffer.Len(), len(ids)*1000)
+			}
+
+			data := buffer.Bytes()
+			assertIterates := func(iter Iterator) {
+				for _, id := range ids {
+					actualID, actualObject, err := iter.Next()
+					require.NoError(t, err)
+					assert.Equal(t, id, actualID)
+					assert.Equal(t, objects[string(id)], actualObject)
+				}
+				actualID, _, err := iter.Next()
+				assert.Nil(t, actualID)
+				assert.True(t, err == nil || err == io.EOF)
+			}
+
+			assertIterates(NewRecordIterator(records, bytes.NewReader(data), format))
+
+			index, err := MarshalRecords(records)
+			require.NoError(t, err)
+			iter, err := NewBackendIterator("tenant", uuid.New(), format, 2000, &mockReader{index: index, objects: data})
+			require.NoError(t, err)
+			assertIterates(iter)
+
+			finder := NewDedupingFinder(records, bytes.NewReader(data), format, &mockCombiner{})
+			for _, id := range ids {
+				actualObject, err := finder.Find(id)
+				require.NoError(t, err)
+				assert.Equal(t, objects[string(id)], actualObject)
+			}
+		})
+	}
+}
+
+type mockReader struct {
+	index   []byte
+	objects []byte
+}
+
+func (m *mockReader) Index(ctx context.Context, blockID uuid.UUID, tenantID string) ([]byte, error) {
+	return m.index, nil
+}
+
+func (m *mockReader) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	copy(buffer, m.objects[start:])
+	return nil
+}
+
+type mockCombiner struct{}
+
+func (m *mockCombiner) Combine(objA []byte, objB []byte) []byte {
+	if len(objA) > len(objB) {
+		return objA
+	}
+	return objB
+}
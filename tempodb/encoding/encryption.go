@@ -0,0 +1,187 @@
+package encoding
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// sealed data is the length of the rest, the nonce and the ciphertext followed by the GCM tag
+const (
+	sealLengthSize = 4
+	sealNonceSize  = 12
+	sealOverhead   = sealLengthSize + sealNonceSize + 16
+)
+
+// ErrDecrypt is returned for encrypted data that can't be decrypted with its key, i.e. it's corrupt or was altered
+var ErrDecrypt = errors.New("unable to decrypt")
+
+var (
+	encryptionKeysMtx sync.RWMutex
+	encryptionKeys    = map[string]*EncryptionKey{}
+)
+
+// EncryptionKey encrypts the pages of objects and the index of blocks with AES-GCM
+type EncryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewEncryptionKey returns a 16, 24 or 32 byte key for AES-128, AES-192 or AES-256
+func NewEncryptionKey(key []byte) (*EncryptionKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// blocks record the id of their key.  it identifies the key without revealing it
+	sum := sha256.Sum256(key)
+	return &EncryptionKey{
+		id:   hex.EncodeToString(sum[:8]),
+		aead: aead,
+	}, nil
+}
+
+// LoadEncryptionKey reads a hex encoded key from a file, e.g. one written by a secret manager
+func LoadEncryptionKey(filename string) (*EncryptionKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key %s isn't hex encoded: %w", filename, err)
+	}
+	return NewEncryptionKey(key)
+}
+
+// ID identifies the key in the metas of blocks encrypted with it
+func (k *EncryptionKey) ID() string {
+	return k.id
+}
+
+// RegisterEncryptionKey makes the key available to read blocks encrypted with it.  Keys are process wide like the
+// versioned encodings.  Register every key blocks may be encrypted with, e.g. keys rotated out, before reading them.
+func RegisterEncryptionKey(k *EncryptionKey) {
+	encryptionKeysMtx.Lock()
+	defer encryptionKeysMtx.Unlock()
+	encryptionKeys[k.id] = k
+}
+
+// encryptionKey returns the key of an encrypted block
+func (b *BlockMeta) encryptionKey() (*EncryptionKey, error) {
+	encryptionKeysMtx.RLock()
+	defer encryptionKeysMtx.RUnlock()
+
+	k, ok := encryptionKeys[b.EncryptionKeyID]
+	if !ok {
+		return nil, fmt.Errorf("block %s is encrypted with key %s which isn't loaded", b.BlockID, b.EncryptionKeyID)
+	}
+	return k, nil
+}
+
+// seal encrypts b
+func (k *EncryptionKey) seal(b []byte) ([]byte, error) {
+	out := make([]byte, sealLengthSize+sealNonceSize, sealOverhead+len(b))
+	binary.BigEndian.PutUint32(out, uint32(sealNonceSize+len(b)+k.aead.Overhead()))
+	nonce := out[sealLengthSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(out, nonce, b, nil), nil
+}
+
+// open decrypts the data sealed at the start of b and returns it and the rest of b
+func (k *EncryptionKey) open(b []byte) ([]byte, []byte, error) {
+	if len(b) < sealLengthSize {
+		return nil, nil, ErrDecrypt
+	}
+	length := binary.BigEndian.Uint32(b)
+	b = b[sealLengthSize:]
+	if length < sealNonceSize || uint64(length) > uint64(len(b)) {
+		return nil, nil, ErrDecrypt
+	}
+
+	plain, err := k.aead.Open(nil, b[:sealNonceSize], b[sealNonceSize:length], nil)
+	if err != nil {
+		return nil, nil, ErrDecrypt
+	}
+	return plain, b[length:], nil
+}
+
+// MarshalIndex returns the index of the records as written to the backend.  The index of an encrypted block is
+// sealed a page at a time so a page can be read and decrypted alone.
+func (b *BlockMeta) MarshalIndex(records []*Record) ([]byte, error) {
+	index, err := MarshalRecords(records)
+	if err != nil || b.EncryptionKeyID == "" {
+		return index, err
+	}
+
+	k, err := b.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := len(index)
+	if b.IndexPageSize > 0 {
+		pageSize = int(b.IndexPageSize)
+	}
+	var sealed []byte
+	for len(index) > 0 || len(sealed) == 0 {
+		n := pageSize
+		if n > len(index) {
+			n = len(index)
+		}
+		page, err := k.seal(index[:n])
+		if err != nil {
+			return nil, err
+		}
+		sealed = append(sealed, page...)
+		index = index[n:]
+	}
+	return sealed, nil
+}
+
+// OpenIndex returns the records of an index, or one page of it, read from the backend
+func (b *BlockMeta) OpenIndex(index []byte) ([]byte, error) {
+	if b.EncryptionKeyID == "" {
+		return index, nil
+	}
+
+	k, err := b.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	records, err := k.openIndex(index)
+	if err != nil {
+		return nil, fmt.Errorf("block %s index: %w", b.BlockID, err)
+	}
+	return records, nil
+}
+
+// openIndex decrypts the pages of an index
+func (k *EncryptionKey) openIndex(index []byte) ([]byte, error) {
+	var records []byte
+	for len(index) > 0 {
+		var page []byte
+		var err error
+		page, index, err = k.open(index)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, page...)
+	}
+	return records, nil
+}
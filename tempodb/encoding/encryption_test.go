@@ -0,0 +1,171 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEncryptionKey(t *testing.T) *EncryptionKey {
+	key := make([]byte, 32)
+	rand.Read(key)
+	k, err := NewEncryptionKey(key)
+	require.NoError(t, err)
+	RegisterEncryptionKey(k)
+	return k
+}
+
+func TestLoadEncryptionKey(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	require.NoError(t, err)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	filename := path.Join(tempDir, "key")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(hex.EncodeToString(key)+"\n"), 0600))
+
+	k, err := LoadEncryptionKey(filename)
+	require.NoError(t, err)
+	expected, err := NewEncryptionKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, expected.ID(), k.ID())
+
+	require.NoError(t, ioutil.WriteFile(filename, key, 0600))
+	_, err = LoadEncryptionKey(filename)
+	assert.Error(t, err)
+
+	_, err = NewEncryptionKey([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testEncryptionKey(t)
+
+	sealed, err := k.seal([]byte("plaintext"))
+	require.NoError(t, err)
+	assert.Len(t, sealed, len("plaintext")+sealOverhead)
+	assert.False(t, bytes.Contains(sealed, []byte("plaintext")))
+
+	plain, rest, err := k.open(append(sealed, 0x01))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plaintext"), plain)
+	assert.Equal(t, []byte{0x01}, rest)
+
+	sealed[len(sealed)-1] ^= 0xff
+	_, _, err = k.open(sealed)
+	assert.Equal(t, ErrDecrypt, err)
+	_, _, err = k.open(sealed[:10])
+	assert.Equal(t, ErrDecrypt, err)
+
+	other := testEncryptionKey(t)
+	sealed, err = k.seal([]byte("plaintext"))
+	require.NoError(t, err)
+	_, _, err = other.open(sealed)
+	assert.Equal(t, ErrDecrypt, err)
+}
+
+func TestEncryptedIndex(t *testing.T) {
+	k := testEncryptionKey(t)
+
+	records := make([]*Record, 10)
+	for i := range records {
+		records[i] = &Record{ID: make([]byte, 16), Start: uint64(i), Length: 1}
+		rand.Read(records[i].ID)
+	}
+	sort.Slice(records, func(i, j int) bool { return bytes.Compare(records[i].ID, records[j].ID) == -1 })
+	plain, err := MarshalRecords(records)
+	require.NoError(t, err)
+
+	for _, pageSize := range []int{0, 3 * recordLength} {
+		meta := NewBlockMeta("tenant", uuid.New())
+		meta.EncryptionKeyID = k.ID()
+		meta.SetIndexPages(records, pageSize)
+
+		index, err := meta.MarshalIndex(records)
+		require.NoError(t, err)
+		assert.NotEqual(t, plain, index)
+
+		opened, err := meta.OpenIndex(index)
+		require.NoError(t, err)
+		assert.Equal(t, plain, opened)
+
+		if pageSize == 0 {
+			continue
+		}
+
+		// every page can be read and decrypted alone
+		for _, r := range records {
+			offset, length, ok := meta.IndexPage(r.ID)
+			require.True(t, ok)
+			page, err := meta.OpenIndex(index[offset : offset+uint64(length)])
+			require.NoError(t, err)
+			require.NoError(t, meta.VerifyIndexPage(offset, page))
+
+			found, err := FindRecord(r.ID, page)
+			require.NoError(t, err)
+			assert.Equal(t, r, found)
+		}
+	}
+
+	meta := NewBlockMeta("tenant", uuid.New())
+	meta.EncryptionKeyID = "missing"
+	_, err = meta.MarshalIndex(records)
+	assert.Error(t, err)
+	_, err = meta.PageFormat()
+	assert.Error(t, err)
+}
+
+func TestEncryptedPages(t *testing.T) {
+	k := testEncryptionKey(t)
+
+	meta := NewBlockMeta("tenant", uuid.New())
+	meta.Encoding = EncSnappy
+	meta.EncryptionKeyID = k.ID()
+	format, err := meta.PageFormat()
+	require.NoError(t, err)
+	assert.Equal(t, k, format.Encryption)
+
+	ids := make([]ID, 20)
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) == -1 })
+
+	buffer := &bytes.Buffer{}
+	appender := NewBufferedAppender(buffer, format, 3, len(ids))
+	for _, id := range ids {
+		require.NoError(t, appender.Append(id, []byte("secret span")))
+	}
+	require.NoError(t, appender.Complete())
+	assert.False(t, bytes.Contains(buffer.Bytes(), []byte("secret")))
+
+	index, err := meta.MarshalIndex(appender.Records())
+	require.NoError(t, err)
+	iter, err := NewBackendIterator("tenant", meta.BlockID, format, 2000, &mockReader{index: index, objects: buffer.Bytes()})
+	require.NoError(t, err)
+	for _, id := range ids {
+		actualID, actualObject, err := iter.Next()
+		require.NoError(t, err)
+		assert.Equal(t, id, actualID)
+		assert.Equal(t, []byte("secret span"), actualObject)
+	}
+
+	// encryption authenticates the page even without a checksum
+	format.Checksum = false
+	records := appender.Records()
+	data := buffer.Bytes()
+	data[records[0].Start+sealLengthSize+sealNonceSize] ^= 0xff
+	_, err = NewPageIterator(format, data[records[0].Start:records[0].Start+uint64(records[0].Length)])
+	assert.Equal(t, ErrDecrypt, err)
+}
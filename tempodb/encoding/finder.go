@@ -2,6 +2,7 @@ package encoding
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"sort"
 )
@@ -12,12 +13,14 @@ type Finder interface {
 
 type finder struct {
 	ra            io.ReaderAt
+	format        PageFormat
 	sortedRecords []*Record
 }
 
-func NewFinder(sortedRecords []*Record, ra io.ReaderAt) Finder {
+func NewFinder(sortedRecords []*Record, ra io.ReaderAt, format PageFormat) Finder {
 	return &finder{
 		ra:            ra,
+		format:        format,
 		sortedRecords: sortedRecords,
 	}
 }
@@ -39,7 +42,10 @@ func (f *finder) Find(id ID) ([]byte, error) {
 		return nil, err
 	}
 
-	iter := NewIterator(bytes.NewReader(buff))
+	iter, err := NewPageIterator(f.format, buff)
+	if err != nil {
+		return nil, fmt.Errorf("page at offset %d: %w", record.Start, err)
+	}
 
 	for {
 		foundID, b, err := iter.Next()
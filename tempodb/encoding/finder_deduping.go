@@ -2,19 +2,22 @@ package encoding
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"sort"
 )
 
 type dedupingFinder struct {
 	ra            io.ReaderAt
+	format        PageFormat
 	sortedRecords []*Record
 	combiner      ObjectCombiner
 }
 
-func NewDedupingFinder(sortedRecords []*Record, ra io.ReaderAt, combiner ObjectCombiner) Finder {
+func NewDedupingFinder(sortedRecords []*Record, ra io.ReaderAt, format PageFormat, combiner ObjectCombiner) Finder {
 	return &dedupingFinder{
 		ra:            ra,
+		format:        format,
 		sortedRecords: sortedRecords,
 		combiner:      combiner,
 	}
@@ -62,7 +65,10 @@ func (f *dedupingFinder) findOne(id ID, record *Record) ([]byte, error) {
 		return nil, err
 	}
 
-	iter := NewIterator(bytes.NewReader(buff))
+	iter, err := NewPageIterator(f.format, buff)
+	if err != nil {
+		return nil, fmt.Errorf("page at offset %d: %w", record.Start, err)
+	}
 	iter, err = NewDedupingIterator(iter, f.combiner)
 	if err != nil {
 		return nil, err
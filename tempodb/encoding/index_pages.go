@@ -0,0 +1,92 @@
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// IndexPageRecords is the number of records in each index page of pageSize bytes.  At least one.
+func IndexPageRecords(pageSize uint32) int {
+	n := int(pageSize) / recordLength
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// SetIndexPages pages the index of the block's records into pages of pageSize bytes, rounded down to whole
+// records, and records the coarse index of the pages and their checksums in the meta.  A pageSize of 0 leaves the
+// index unpaged.
+func (b *BlockMeta) SetIndexPages(records []*Record, pageSize int) {
+	b.IndexPageSize = 0
+	b.IndexPages = nil
+	b.IndexPageChecksums = nil
+	b.TotalRecords = uint32(len(records))
+	if pageSize <= 0 {
+		return
+	}
+
+	perPage := IndexPageRecords(uint32(pageSize))
+	b.IndexPageSize = uint32(perPage * recordLength)
+	for start := 0; start < len(records); start += perPage {
+		end := start + perPage
+		if end > len(records) {
+			end = len(records)
+		}
+		b.IndexPages = append(b.IndexPages, records[end-1].ID)
+
+		page := make([]byte, (end-start)*recordLength)
+		for i, r := range records[start:end] {
+			marshalRecord(r, page[i*recordLength:])
+		}
+		b.IndexPageChecksums = append(b.IndexPageChecksums, crc32.Checksum(page, checksumTable))
+	}
+}
+
+// IndexPage returns the offset and length in the index object of the page holding the record for id.  ok is false
+// if id is past the last record.  Only valid for blocks with a paged index.
+func (b *BlockMeta) IndexPage(id ID) (offset uint64, length uint32, ok bool) {
+	// the first page whose last record is at or past id
+	i := sort.Search(len(b.IndexPages), func(i int) bool {
+		return bytes.Compare(b.IndexPages[i], id) >= 0
+	})
+	if i >= len(b.IndexPages) {
+		return 0, 0, false
+	}
+
+	plainOffset := uint64(i) * uint64(b.IndexPageSize)
+	length = b.IndexPageSize
+	if total := uint64(b.TotalRecords) * recordLength; plainOffset+uint64(length) > total {
+		length = uint32(total - plainOffset)
+	}
+	if b.EncryptionKeyID != "" {
+		// every page is sealed separately
+		length += sealOverhead
+	}
+	return uint64(i) * b.indexPageStride(), length, true
+}
+
+// indexPageStride is the distance between the starts of index pages in the index object
+func (b *BlockMeta) indexPageStride() uint64 {
+	if b.EncryptionKeyID != "" {
+		return uint64(b.IndexPageSize) + sealOverhead
+	}
+	return uint64(b.IndexPageSize)
+}
+
+// VerifyIndexPage checks a page read from offset in the index object against its checksum.  Pages of encrypted blocks
+// are checked once decrypted.  Blocks written before index pages were checksummed aren't verified.
+func (b *BlockMeta) VerifyIndexPage(offset uint64, page []byte) error {
+	i := int(offset / b.indexPageStride())
+	if i >= len(b.IndexPageChecksums) {
+		return nil
+	}
+
+	if crc32.Checksum(page, checksumTable) != b.IndexPageChecksums[i] {
+		metricPageChecksumMismatches.WithLabelValues(checksumTypeIndex).Inc()
+		return fmt.Errorf("block %s index page at offset %d: %w", b.BlockID, offset, ErrPageChecksum)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package encoding
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexPages(t *testing.T) {
+	records := make([]*Record, 10)
+	for i := range records {
+		records[i] = newRecord()
+		rand.Read(records[i].ID)
+	}
+	sortRecords(records)
+	index, err := MarshalRecords(records)
+	require.NoError(t, err)
+
+	meta := NewBlockMeta(testTenantID, uuid.New())
+	meta.SetIndexPages(records, 3*recordLength+10) // rounded down to 3 records
+	assert.Equal(t, uint32(3*recordLength), meta.IndexPageSize)
+	assert.Equal(t, uint32(len(records)), meta.TotalRecords)
+	assert.Equal(t, []ID{records[2].ID, records[5].ID, records[8].ID, records[9].ID}, meta.IndexPages)
+
+	for _, r := range records {
+		offset, length, ok := meta.IndexPage(r.ID)
+		require.True(t, ok)
+		assert.LessOrEqual(t, length, meta.IndexPageSize)
+
+		page := index[offset : offset+uint64(length)]
+		assert.NoError(t, meta.VerifyIndexPage(offset, page))
+
+		found, err := FindRecord(r.ID, page)
+		require.NoError(t, err)
+		assert.Equal(t, r, found)
+	}
+
+	// a corrupt page is caught
+	corrupt := append([]byte(nil), index[:3*recordLength]...)
+	corrupt[0] ^= 0xff
+	err = meta.VerifyIndexPage(0, corrupt)
+	assert.True(t, errors.Is(err, ErrPageChecksum))
+	assert.Contains(t, err.Error(), meta.BlockID.String())
+
+	// past the last record
+	_, _, ok := meta.IndexPage(ID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.False(t, ok)
+
+	meta.SetIndexPages(records, 0)
+	assert.Equal(t, uint32(0), meta.IndexPageSize)
+	assert.Empty(t, meta.IndexPages)
+	assert.Empty(t, meta.IndexPageChecksums)
+}
@@ -2,6 +2,7 @@ package encoding
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"math"
 
@@ -14,86 +15,285 @@ type Reader interface {
 	Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error
 }
 
+type backendReaderAt struct {
+	ctx      context.Context
+	tenantID string
+	blockID  uuid.UUID
+	r        Reader
+}
+
+// NewBackendReaderAt reads the objects of a block through the reader
+func NewBackendReaderAt(ctx context.Context, tenantID string, blockID uuid.UUID, reader Reader) io.ReaderAt {
+	return &backendReaderAt{
+		ctx:      ctx,
+		tenantID: tenantID,
+		blockID:  blockID,
+		r:        reader,
+	}
+}
+
+func (b *backendReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	err := b.r.Object(b.ctx, b.blockID, b.tenantID, uint64(off), p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// PageIterator iterates the pages of a block as they are written, e.g. to copy them to another block without decoding
+// them.  Pages are owned by the iterator and only valid until the next call.  io.EOF after the last page.
+type PageIterator interface {
+	NextPage() ([]byte, error)
+}
+
 type backendIterator struct {
 	tenantID string
 	blockID  uuid.UUID
+	format   PageFormat
 	r        Reader
 
-	indexBuffer         []byte
-	objectsBuffer       []byte
-	activeObjectsBuffer []byte
+	indexBuffer   []byte
+	objectsBuffer []byte
+	// pages read into objectsBuffer that haven't been iterated yet and their offsets in the block
+	pages       [][]byte
+	pageOffsets []uint64
+	activePage  []byte
+
+	// prefetched pages read in the background.  nil if pages are read when needed
+	prefetched  <-chan prefetchedPage
+	prefetchCtx context.Context
 }
 
-func NewBackendIterator(tenantID string, blockID uuid.UUID, chunkSizeBytes uint32, reader Reader) (Iterator, error) {
+type prefetchedPage struct {
+	page   []byte
+	offset uint64
+	err    error
+}
+
+func NewBackendIterator(tenantID string, blockID uuid.UUID, format PageFormat, chunkSizeBytes uint32, reader Reader) (Iterator, error) {
 	index, err := reader.Index(context.TODO(), blockID, tenantID)
 	if err != nil {
 		return nil, err
 	}
+	if format.Encryption != nil {
+		index, err = format.Encryption.openIndex(index)
+		if err != nil {
+			return nil, fmt.Errorf("block %s index: %w", blockID, err)
+		}
+	}
 
 	return &backendIterator{
 		tenantID:      tenantID,
 		blockID:       blockID,
+		format:        format,
 		r:             reader,
 		indexBuffer:   index,
 		objectsBuffer: make([]byte, chunkSizeBytes),
 	}, err
 }
 
+// NewPrefetchingBackendIterator iterates a block like NewBackendIterator but reads up to prefetchPages pages ahead of
+// the page being iterated on a background goroutine, overlapping reading the backend with decompressing and using the
+// objects.  The goroutine stops at the end of the block, on an error or when ctx is cancelled, so cancel ctx if the
+// iterator isn't iterated to the end.  A prefetchPages of 0 or less reads pages when they are needed.
+func NewPrefetchingBackendIterator(ctx context.Context, tenantID string, blockID uuid.UUID, format PageFormat, chunkSizeBytes uint32, prefetchPages int, reader Reader) (Iterator, error) {
+	iter, err := NewBackendIterator(tenantID, blockID, format, chunkSizeBytes, reader)
+	if err != nil || prefetchPages <= 0 {
+		return iter, err
+	}
+
+	i := iter.(*backendIterator)
+	prefetched := make(chan prefetchedPage, prefetchPages)
+	i.prefetched = prefetched
+	i.prefetchCtx = ctx
+	go i.prefetch(ctx, i.indexBuffer, chunkSizeBytes, prefetched)
+	i.indexBuffer = nil
+	i.objectsBuffer = nil
+
+	return i, nil
+}
+
+// NewBackendPageIterator iterates the pages of a block reading as many as fit in chunkSizeBytes at a time
+func NewBackendPageIterator(tenantID string, blockID uuid.UUID, format PageFormat, chunkSizeBytes uint32, reader Reader) (PageIterator, error) {
+	iter, err := NewBackendIterator(tenantID, blockID, format, chunkSizeBytes, reader)
+	if err != nil {
+		return nil, err
+	}
+	return iter.(*backendIterator), nil
+}
+
+func (i *backendIterator) NextPage() ([]byte, error) {
+	for len(i.pages) == 0 {
+		if len(i.indexBuffer) == 0 {
+			return nil, io.EOF
+		}
+		err := i.readPages()
+		if err != nil {
+			return nil, errors.Wrap(err, "error iterating through pages in backend")
+		}
+	}
+
+	page := i.pages[0]
+	i.pages = i.pages[1:]
+	i.pageOffsets = i.pageOffsets[1:]
+	return page, nil
+}
+
 // For performance reasons the ID and object slices returned from this method are owned by
 // the iterator.  If you have need to keep these values for longer than a single iteration
 // you need to make a copy of them.
 func (i *backendIterator) Next() (ID, []byte, error) {
-	var err error
-	var id ID
-	var object []byte
+	for {
+		var err error
+		var id ID
+		var object []byte
+
+		i.activePage, id, object, err = unmarshalAndAdvanceBuffer(i.activePage)
+		if err != nil && err != io.EOF {
+			return nil, nil, errors.Wrap(err, "error iterating through object in backend")
+		} else if err != io.EOF {
+			return id, object, nil
+		}
+
+		// active page is empty, move to the next page
+		if len(i.pages) > 0 {
+			i.activePage, err = i.format.decode(i.pages[0])
+			if err == ErrPageChecksum || err == ErrDecrypt {
+				return nil, nil, fmt.Errorf("block %s page at offset %d: %w", i.blockID, i.pageOffsets[0], err)
+			}
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "error decompressing %s page in backend", i.format.Encoding)
+			}
+			i.pages = i.pages[1:]
+			i.pageOffsets = i.pageOffsets[1:]
+			continue
+		}
 
-	i.activeObjectsBuffer, id, object, err = unmarshalAndAdvanceBuffer(i.activeObjectsBuffer)
-	if err != nil && err != io.EOF {
-		return nil, nil, errors.Wrap(err, "error iterating through object in backend")
-	} else if err != io.EOF {
-		return id, object, nil
+		if i.prefetched != nil {
+			p, ok := <-i.prefetched
+			if !ok {
+				// the prefetching stopped early if cancelled
+				if err := i.prefetchCtx.Err(); err != nil {
+					return nil, nil, err
+				}
+				return nil, nil, io.EOF
+			}
+			if p.err != nil {
+				return nil, nil, errors.Wrap(p.err, "error iterating through object in backend")
+			}
+			i.pages = append(i.pages, p.page)
+			i.pageOffsets = append(i.pageOffsets, p.offset)
+			continue
+		}
+
+		// no pages left, check the index
+		// if no index left, EOF
+		if len(i.indexBuffer) == 0 {
+			return nil, nil, io.EOF
+		}
+
+		err = i.readPages()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error iterating through object in backend")
+		}
 	}
+}
 
-	// objects reader was empty, check the index
-	// if no index left, EOF
-	if len(i.indexBuffer) == 0 {
-		return nil, nil, io.EOF
+// prefetch reads the pages of index in chunks and sends them one at a time.  It owns index, so the iterator must not
+// read the index itself.  Each chunk gets its own buffer as the pages of earlier chunks may not have been iterated
+// yet.
+func (i *backendIterator) prefetch(ctx context.Context, index []byte, chunkSizeBytes uint32, prefetched chan<- prefetchedPage) {
+	defer close(prefetched)
+
+	send := func(p prefetchedPage) bool {
+		select {
+		case prefetched <- p:
+			return true
+		case <-ctx.Done():
+			return false
+		}
 	}
 
-	// pull next n bytes into objects
+	for len(index) > 0 {
+		var c *pageChunk
+		var err error
+		c, index, err = i.readChunk(ctx, index, make([]byte, chunkSizeBytes))
+		if err != nil {
+			send(prefetchedPage{err: err})
+			return
+		}
+
+		for j, page := range c.pages {
+			if !send(prefetchedPage{page: page, offset: c.offsets[j]}) {
+				return
+			}
+		}
+	}
+}
+
+// readPages pulls as many of the next pages as fit in the objects buffer, at least one
+func (i *backendIterator) readPages() error {
+	c, index, err := i.readChunk(context.TODO(), i.indexBuffer, i.objectsBuffer)
+	if err != nil {
+		return err
+	}
+
+	i.indexBuffer = index
+	i.objectsBuffer = c.buffer
+	i.pages = append(i.pages, c.pages...)
+	i.pageOffsets = append(i.pageOffsets, c.offsets...)
+	return nil
+}
+
+// pageChunk is pages read from the backend at once into buffer
+type pageChunk struct {
+	buffer  []byte
+	pages   [][]byte
+	offsets []uint64
+}
+
+// readChunk reads as many of the pages the records in index point to as fit in buffer, at least one, and returns
+// them and the rest of the index.  buffer is replaced by a larger one if the first page doesn't fit.
+func (i *backendIterator) readChunk(ctx context.Context, index []byte, buffer []byte) (*pageChunk, []byte, error) {
 	var start uint64
 	var length uint32
+	var lengths []uint32
 
 	start = math.MaxUint64
-	for len(i.indexBuffer) > 0 {
-		record := unmarshalRecord(i.indexBuffer[:recordLength])
+	for len(index) > 0 {
+		record := unmarshalRecord(index[:recordLength])
 
 		// see if we can fit this record in.  we have to get at least one record in
-		if length+record.Length > uint32(len(i.objectsBuffer)) && start != math.MaxUint64 {
+		if length+record.Length > uint32(len(buffer)) && start != math.MaxUint64 {
 			break
 		}
 		// advance index buffer
-		i.indexBuffer = i.indexBuffer[recordLength:]
+		index = index[recordLength:]
 
 		if start == math.MaxUint64 {
 			start = record.Start
 		}
 		length += record.Length
+		lengths = append(lengths, record.Length)
+	}
+	if length > uint32(len(buffer)) {
+		buffer = make([]byte, length)
 	}
-	if length > uint32(len(i.objectsBuffer)) {
-		i.objectsBuffer = make([]byte, length)
+	c := &pageChunk{
+		buffer: buffer,
 	}
-	i.activeObjectsBuffer = i.objectsBuffer[:length]
-	err = i.r.Object(context.TODO(), i.blockID, i.tenantID, start, i.activeObjectsBuffer)
+	buffer = buffer[:length]
+	err := i.r.Object(ctx, i.blockID, i.tenantID, start, buffer)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "error iterating through object in backend")
+		return nil, nil, err
 	}
 
-	// attempt to get next object from objects
-	i.activeObjectsBuffer, id, object, err = unmarshalAndAdvanceBuffer(i.activeObjectsBuffer)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "error iterating through object in backend")
+	for _, l := range lengths {
+		c.pages = append(c.pages, buffer[:l])
+		c.offsets = append(c.offsets, start)
+		buffer = buffer[l:]
+		start += uint64(l)
 	}
 
-	return id, object, nil
+	return c, index, nil
 }
@@ -0,0 +1,77 @@
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchingBackendIterator(t *testing.T) {
+	ids := make([]ID, 100)
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) == -1 })
+
+	format := PageFormat{Encoding: EncGZIP, Checksum: true}
+	buffer := &bytes.Buffer{}
+	appender := NewBufferedAppender(buffer, format, 3, len(ids))
+	for i, id := range ids {
+		require.NoError(t, appender.Append(id, bytes.Repeat([]byte{byte(i)}, 100)))
+	}
+	require.NoError(t, appender.Complete())
+	index, err := MarshalRecords(appender.Records())
+	require.NoError(t, err)
+	reader := &mockReader{index: index, objects: buffer.Bytes()}
+
+	for _, prefetchPages := range []int{0, 1, 5, 100} {
+		iter, err := NewPrefetchingBackendIterator(context.Background(), "tenant", uuid.New(), format, 500, prefetchPages, reader)
+		require.NoError(t, err)
+
+		for i, id := range ids {
+			actualID, actualObject, err := iter.Next()
+			require.NoError(t, err)
+			assert.Equal(t, id, actualID)
+			assert.Equal(t, bytes.Repeat([]byte{byte(i)}, 100), actualObject)
+		}
+		_, _, err = iter.Next()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	// cancelling stops the prefetching without ending the iteration cleanly
+	ctx, cancel := context.WithCancel(context.Background())
+	iter, err := NewPrefetchingBackendIterator(ctx, "tenant", uuid.New(), format, 500, 1, reader)
+	require.NoError(t, err)
+	_, _, err = iter.Next()
+	require.NoError(t, err)
+	cancel()
+	for err == nil {
+		_, _, err = iter.Next()
+	}
+	assert.Equal(t, context.Canceled, err)
+
+	// backend errors are returned in order
+	iter, err = NewPrefetchingBackendIterator(context.Background(), "tenant", uuid.New(), format, 500, 2, &failingReader{mockReader: reader})
+	require.NoError(t, err)
+	_, _, err = iter.Next()
+	assert.True(t, errors.Is(err, errObjectRead))
+}
+
+var errObjectRead = errors.New("object read failed")
+
+type failingReader struct {
+	*mockReader
+}
+
+func (f *failingReader) Object(ctx context.Context, blockID uuid.UUID, tenantID string, start uint64, buffer []byte) error {
+	return errObjectRead
+}
@@ -1,21 +1,23 @@
 package encoding
 
 import (
-	"bytes"
+	"fmt"
 	"io"
 )
 
 type recordIterator struct {
 	records []*Record
 	ra      io.ReaderAt
+	format  PageFormat
 
 	currentIterator Iterator
 }
 
-func NewRecordIterator(r []*Record, ra io.ReaderAt) Iterator {
+func NewRecordIterator(r []*Record, ra io.ReaderAt, format PageFormat) Iterator {
 	return &recordIterator{
 		records: r,
 		ra:      ra,
+		format:  format,
 	}
 }
 
@@ -40,7 +42,10 @@ func (i *recordIterator) Next() (ID, []byte, error) {
 			return nil, nil, err
 		}
 
-		i.currentIterator = NewIterator(bytes.NewReader(buff))
+		i.currentIterator, err = NewPageIterator(i.format, buff)
+		if err != nil {
+			return nil, nil, fmt.Errorf("page at offset %d: %w", record.Start, err)
+		}
 		i.records = i.records[1:]
 
 		return i.currentIterator.Next()
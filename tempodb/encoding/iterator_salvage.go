@@ -0,0 +1,117 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+)
+
+// SalvageIterator iterates what can be recovered of a damaged block, e.g. one with a corrupt index or truncated
+// objects.  Pages are found from the longest consistent run of records at the start of the index, or from the
+// offsets in the stats footer if it finds more.  Pages that can't be read or decoded are skipped rather than failing
+// the iteration, so Next only returns nil at the end.
+type SalvageIterator struct {
+	format PageFormat
+	ra     io.ReaderAt
+	pages  []*Record
+
+	current []byte
+	damaged int
+}
+
+// NewSalvageIterator salvages the objects ra reads.  index is the index as read from the block, nil if it's lost, and
+// stats the stats footer, nil if the block has none.
+func NewSalvageIterator(format PageFormat, index []byte, stats *BlockStats, ra io.ReaderAt) *SalvageIterator {
+	pages := salvageRecords(index)
+	if stats != nil && len(stats.PageOffsets) > len(pages) {
+		pages = statsPages(stats)
+	}
+
+	return &SalvageIterator{
+		format: format,
+		ra:     ra,
+		pages:  pages,
+	}
+}
+
+// Next returns the next object recovered
+func (i *SalvageIterator) Next() (ID, []byte, error) {
+	for {
+		if len(i.current) > 0 {
+			var id ID
+			var object []byte
+			var err error
+			i.current, id, object, err = unmarshalAndAdvanceBuffer(i.current)
+			if err == nil {
+				return id, object, nil
+			}
+			if err != io.EOF {
+				// the rest of the page can't be trusted
+				i.damaged++
+			}
+			i.current = nil
+		}
+
+		if len(i.pages) == 0 {
+			return nil, nil, nil
+		}
+		page := i.pages[0]
+		i.pages = i.pages[1:]
+
+		buff := make([]byte, page.Length)
+		_, err := i.ra.ReadAt(buff, int64(page.Start))
+		if err == nil {
+			i.current, err = i.format.decode(buff)
+		}
+		if err != nil {
+			i.damaged++
+		}
+	}
+}
+
+// Damaged returns the number of pages iterated so far that were lost in whole or in part
+func (i *SalvageIterator) Damaged() int {
+	return i.damaged
+}
+
+// salvageRecords returns the records at the start of the index up to the first one that's inconsistent with those
+// before it
+func salvageRecords(index []byte) []*Record {
+	var records []*Record
+	for len(index) >= recordLength {
+		r := unmarshalRecord(index[:recordLength])
+		index = index[recordLength:]
+
+		if r.Length == 0 {
+			break
+		}
+		if n := len(records); n > 0 {
+			prev := records[n-1]
+			if r.Start != prev.Start+uint64(prev.Length) || bytes.Compare(r.ID, prev.ID) != 1 {
+				break
+			}
+		} else if r.Start != 0 {
+			break
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// statsPages returns the pages the stats footer locates
+func statsPages(stats *BlockStats) []*Record {
+	pages := make([]*Record, 0, len(stats.PageOffsets))
+	for j, start := range stats.PageOffsets {
+		end := stats.Size
+		if j+1 < len(stats.PageOffsets) {
+			end = stats.PageOffsets[j+1]
+		}
+		if end <= start {
+			break
+		}
+		pages = append(pages, &Record{
+			Start:  start,
+			Length: uint32(end - start),
+		})
+	}
+	return pages
+}
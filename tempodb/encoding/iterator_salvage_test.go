@@ -0,0 +1,85 @@
+package encoding
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSalvageIterator(t *testing.T) {
+	ids := make([]ID, 30)
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) == -1 })
+
+	format := PageFormat{Encoding: EncSnappy, Checksum: true}
+	buffer := &bytes.Buffer{}
+	appender := NewBufferedAppender(buffer, format, 3, len(ids))
+	for _, id := range ids {
+		require.NoError(t, appender.Append(id, []byte("object")))
+	}
+	require.NoError(t, appender.Complete())
+	records := appender.Records()
+	index, err := MarshalRecords(records)
+	require.NoError(t, err)
+
+	meta := NewBlockMeta("tenant", uuid.New())
+	for _, id := range ids {
+		meta.ObjectAdded(id)
+	}
+	stats := NewBlockStats(meta, records)
+	objects := buffer.Bytes()
+
+	salvage := func(index []byte, stats *BlockStats, objects []byte) ([]ID, int) {
+		iter := NewSalvageIterator(format, index, stats, bytes.NewReader(objects))
+		var found []ID
+		for {
+			id, object, err := iter.Next()
+			require.NoError(t, err)
+			if id == nil {
+				break
+			}
+			assert.Equal(t, []byte("object"), object)
+			found = append(found, id)
+		}
+		return found, iter.Damaged()
+	}
+
+	// intact
+	found, damaged := salvage(index, nil, objects)
+	assert.Equal(t, ids, found)
+	assert.Equal(t, 0, damaged)
+
+	// a corrupt index is cut at the first bad record
+	corruptIndex := append([]byte(nil), index...)
+	corruptIndex[4*recordLength+16] ^= 0xff
+	found, damaged = salvage(corruptIndex, nil, objects)
+	assert.Equal(t, ids[:12], found)
+	assert.Equal(t, 0, damaged)
+
+	// the stats footer finds every page
+	found, damaged = salvage(corruptIndex, stats, objects)
+	assert.Equal(t, ids, found)
+	assert.Equal(t, 0, damaged)
+	found, _ = salvage(nil, stats, objects)
+	assert.Equal(t, ids, found)
+
+	// truncated objects lose the pages past the end
+	found, damaged = salvage(index, nil, objects[:records[5].Start+10])
+	assert.Equal(t, ids[:15], found)
+	assert.Equal(t, 5, damaged)
+
+	// a corrupt page is skipped
+	corruptObjects := append([]byte(nil), objects...)
+	corruptObjects[records[2].Start] ^= 0xff
+	found, damaged = salvage(index, nil, corruptObjects)
+	assert.Equal(t, append(append([]ID(nil), ids[:6]...), ids[9:]...), found)
+	assert.Equal(t, 1, damaged)
+}
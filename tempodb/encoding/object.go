@@ -92,7 +92,7 @@ func unmarshalAndAdvanceBuffer(buffer []byte) ([]byte, ID, []byte, error) {
 	buffer = buffer[uint32Size:]
 
 	restLength := totalLength - uint32Size*2
-	if uint32(len(buffer)) < restLength {
+	if uint32(len(buffer)) < restLength || idLength > restLength {
 		return nil, nil, nil, fmt.Errorf("unable to read id/object from buffer")
 	}
 
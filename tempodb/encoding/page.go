@@ -0,0 +1,108 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	pageChecksumLength = 4
+
+	checksumTypeIndex  = "index"
+	checksumTypeObject = "object"
+	checksumTypeStats  = "stats"
+)
+
+// ErrPageChecksum is returned for a page of a block whose contents don't match the checksum written with it.  It's
+// wrapped with the offset of the page and, where known, the block.
+var ErrPageChecksum = errors.New("page checksum mismatch")
+
+var (
+	metricPageChecksumMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "page_checksum_mismatches_total",
+		Help:      "Total number of index and object pages read that did not match their checksum.",
+	}, []string{"type"})
+
+	checksumTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// PageFormat is how the pages of objects a block's records point to are written
+type PageFormat struct {
+	Encoding Encoding
+	// Checksum follows each compressed page with its CRC32C
+	Checksum bool
+	// Encryption encrypts each compressed page.  nil for unencrypted blocks.
+	Encryption *EncryptionKey
+}
+
+// encode returns the page as written to the block
+func (f PageFormat) encode(page []byte) ([]byte, error) {
+	b, err := f.Encoding.compress(page)
+	if err != nil {
+		return nil, err
+	}
+	if f.Encryption != nil {
+		b, err = f.Encryption.seal(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !f.Checksum {
+		return b, nil
+	}
+
+	// compress may return the page itself.  don't append to the caller's buffer
+	out := make([]byte, len(b)+pageChecksumLength)
+	copy(out, b)
+	binary.BigEndian.PutUint32(out[len(b):], crc32.Checksum(b, checksumTable))
+	return out, nil
+}
+
+// decode verifies a page read from the block and returns its objects
+func (f PageFormat) decode(page []byte) ([]byte, error) {
+	if f.Checksum {
+		if len(page) < pageChecksumLength {
+			metricPageChecksumMismatches.WithLabelValues(checksumTypeObject).Inc()
+			return nil, ErrPageChecksum
+		}
+		split := len(page) - pageChecksumLength
+		if crc32.Checksum(page[:split], checksumTable) != binary.BigEndian.Uint32(page[split:]) {
+			metricPageChecksumMismatches.WithLabelValues(checksumTypeObject).Inc()
+			return nil, ErrPageChecksum
+		}
+		page = page[:split]
+	}
+	if f.Encryption != nil {
+		var err error
+		var rest []byte
+		page, rest, err = f.Encryption.open(page)
+		if err == nil && len(rest) > 0 {
+			err = ErrDecrypt
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f.Encoding.decompress(page)
+}
+
+// NewPageIterator iterates the objects of a page read from a block with format f, e.g. the bytes a record points to.
+// Returns ErrPageChecksum if the page is corrupt or ErrDecrypt if it can't be decrypted.
+func NewPageIterator(f PageFormat, page []byte) (Iterator, error) {
+	b, err := f.decode(page)
+	if err == ErrPageChecksum || err == ErrDecrypt {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing %s page: %w", f.Encoding, err)
+	}
+	return NewIterator(bytes.NewReader(b)), nil
+}
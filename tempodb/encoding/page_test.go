@@ -0,0 +1,62 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageChecksums(t *testing.T) {
+	ids := make([]ID, 10)
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) == -1 })
+
+	for _, enc := range SupportedEncodings {
+		t.Run(string(enc), func(t *testing.T) {
+			format := PageFormat{Encoding: enc, Checksum: true}
+			buffer := &bytes.Buffer{}
+			appender := NewBufferedAppender(buffer, format, 5, len(ids))
+			for _, id := range ids {
+				require.NoError(t, appender.Append(id, []byte{0x01, 0x02}))
+			}
+			require.NoError(t, appender.Complete())
+			records := appender.Records()
+			require.Len(t, records, 2)
+
+			// corrupt the second page
+			data := buffer.Bytes()
+			data[records[1].Start] ^= 0xff
+
+			finder := NewFinder(records, bytes.NewReader(data), format)
+			_, err := finder.Find(ids[0])
+			assert.NoError(t, err)
+			_, err = finder.Find(ids[9])
+			assert.True(t, errors.Is(err, ErrPageChecksum))
+			assert.Contains(t, err.Error(), "offset")
+
+			index, err := MarshalRecords(records)
+			require.NoError(t, err)
+			blockID := uuid.New()
+			iter, err := NewBackendIterator("tenant", blockID, format, 2000, &mockReader{index: index, objects: data})
+			require.NoError(t, err)
+			for {
+				var id ID
+				id, _, err = iter.Next()
+				if id == nil || err != nil {
+					break
+				}
+			}
+			assert.True(t, errors.Is(err, ErrPageChecksum))
+			assert.Contains(t, err.Error(), blockID.String())
+		})
+	}
+}
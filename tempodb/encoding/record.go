@@ -44,6 +44,15 @@ func (t *recordSorter) Swap(i, j int) {
 	t.records[i], t.records[j] = t.records[j], t.records[i]
 }
 
+// RecordsSize returns the number of bytes of objects the records point to
+func RecordsSize(records []*Record) uint64 {
+	size := uint64(0)
+	for _, r := range records {
+		size += uint64(r.Length)
+	}
+	return size
+}
+
 // todo: move encoding/decoding to a separate util area?  is the index too large?  need an io.Reader?
 func MarshalRecords(records []*Record) ([]byte, error) {
 	recordBytes := make([]byte, len(records)*recordLength)
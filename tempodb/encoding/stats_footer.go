@@ -0,0 +1,247 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// the footer ends the objects with the length and CRC32C of the stats followed by the magic number.  The magic
+// number of footers written before time groups differs.
+const (
+	statsFooterMagic   uint32 = 0x54535447 // "TSTG"
+	statsFooterMagicV1 uint32 = 0x54535446 // "TSTF"
+	statsFooterTrailer        = 12
+)
+
+// ErrNoStatsFooter is returned for objects written before blocks had a stats footer
+var ErrNoStatsFooter = errors.New("objects have no stats footer")
+
+// BlockStats summarize the objects of a block.  They're written in a footer at the end of the objects so the objects
+// describe themselves to tools holding only them.
+type BlockStats struct {
+	TotalRecords     uint32
+	TotalObjects     uint32
+	MinID            ID
+	MaxID            ID
+	Size             uint64 // size of the pages of objects in bytes
+	UncompressedSize uint64 // size of the objects before their pages are compressed.  0 if unknown
+	// PageOffsets are the offsets of the pages of objects.  A page ends where the next starts or at Size.
+	PageOffsets []uint64
+	// TimeGroupWindow is the duration of the windows the records are grouped by and TimeGroups the groups in order of
+	// time.  0 and empty if the records aren't grouped.
+	TimeGroupWindow time.Duration
+	TimeGroups      []TimeGroup
+}
+
+// NewBlockStats returns the stats of the block the records index
+func NewBlockStats(meta *BlockMeta, records []*Record) *BlockStats {
+	s := &BlockStats{
+		TotalRecords:     uint32(len(records)),
+		TotalObjects:     uint32(meta.TotalObjects),
+		MinID:            meta.MinID,
+		MaxID:            meta.MaxID,
+		Size:             RecordsSize(records),
+		UncompressedSize: meta.UncompressedSize,
+		PageOffsets:      make([]uint64, 0, len(records)),
+	}
+	for _, r := range records {
+		s.PageOffsets = append(s.PageOffsets, r.Start)
+	}
+	return s
+}
+
+// CompressionRatio returns how many times smaller the pages are than the objects they hold.  0 if unknown.
+func (s *BlockStats) CompressionRatio() float64 {
+	if s.Size == 0 || s.UncompressedSize == 0 {
+		return 0
+	}
+	return float64(s.UncompressedSize) / float64(s.Size)
+}
+
+// MarshalFooter returns the footer to write after the last byte of the objects.  Numbers are uvarints.  Page
+// offsets, the windows of time groups and their records are delta encoded.
+func (s *BlockStats) MarshalFooter() []byte {
+	var buf []byte
+	buf = appendUvarint(buf, uint64(s.TotalRecords))
+	buf = appendUvarint(buf, uint64(s.TotalObjects))
+	buf = appendUvarint(buf, uint64(len(s.MinID)))
+	buf = append(buf, s.MinID...)
+	buf = appendUvarint(buf, uint64(len(s.MaxID)))
+	buf = append(buf, s.MaxID...)
+	buf = appendUvarint(buf, s.Size)
+	buf = appendUvarint(buf, s.UncompressedSize)
+	buf = appendUvarint(buf, uint64(len(s.PageOffsets)))
+	prev := uint64(0)
+	for _, o := range s.PageOffsets {
+		buf = appendUvarint(buf, o-prev)
+		prev = o
+	}
+	buf = appendUvarint(buf, uint64(s.TimeGroupWindow))
+	buf = appendUvarint(buf, uint64(len(s.TimeGroups)))
+	prevWindow := int64(0)
+	for _, g := range s.TimeGroups {
+		window := g.Start.UnixNano() / int64(s.TimeGroupWindow)
+		buf = appendUvarint(buf, uint64(window-prevWindow))
+		prevWindow = window
+		buf = appendUvarint(buf, uint64(len(g.Records)))
+		prevRecord := uint32(0)
+		for _, r := range g.Records {
+			buf = appendUvarint(buf, uint64(r-prevRecord))
+			prevRecord = r
+		}
+	}
+
+	trailer := make([]byte, statsFooterTrailer)
+	binary.BigEndian.PutUint32(trailer, uint32(len(buf)))
+	binary.BigEndian.PutUint32(trailer[4:], crc32.Checksum(buf, checksumTable))
+	binary.BigEndian.PutUint32(trailer[8:], statsFooterMagic)
+	return append(buf, trailer...)
+}
+
+// ReadBlockStats reads the stats footer at the end of objects of size bytes
+func ReadBlockStats(ra io.ReaderAt, size int64) (*BlockStats, error) {
+	if size < statsFooterTrailer {
+		return nil, ErrNoStatsFooter
+	}
+	trailer := make([]byte, statsFooterTrailer)
+	if _, err := ra.ReadAt(trailer, size-statsFooterTrailer); err != nil {
+		return nil, err
+	}
+	magic := binary.BigEndian.Uint32(trailer[8:])
+	if magic != statsFooterMagic && magic != statsFooterMagicV1 {
+		return nil, ErrNoStatsFooter
+	}
+
+	length := int64(binary.BigEndian.Uint32(trailer))
+	if length > size-statsFooterTrailer {
+		return nil, fmt.Errorf("corrupt stats footer. %d bytes in %d byte objects", length, size)
+	}
+	footer := make([]byte, length)
+	if _, err := ra.ReadAt(footer, size-statsFooterTrailer-length); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(footer, checksumTable) != binary.BigEndian.Uint32(trailer[4:]) {
+		metricPageChecksumMismatches.WithLabelValues(checksumTypeStats).Inc()
+		return nil, fmt.Errorf("stats footer: %w", ErrPageChecksum)
+	}
+
+	s, _, err := unmarshalBlockStats(footer, magic == statsFooterMagic)
+	return s, err
+}
+
+// StatsFooterMaxSize is the most bytes the stats footer of a block with the meta takes, or its size if the meta records
+// it.  Readers that can't tell where the objects end, like backends, read this many bytes from where the footer starts
+// for UnmarshalBlockStats.
+func StatsFooterMaxSize(meta *BlockMeta) int {
+	if meta.StatsFooterLength > 0 {
+		return int(meta.StatsFooterLength)
+	}
+	return 8*binary.MaxVarintLen64 + len(meta.MinID) + len(meta.MaxID) + int(meta.TotalRecords)*binary.MaxVarintLen64 + statsFooterTrailer
+}
+
+// UnmarshalBlockStats reads the stats footer at the start of b, which may run past the end of the objects
+func UnmarshalBlockStats(b []byte) (*BlockStats, error) {
+	// the trailer says which version the footer is, so try both
+	s, err := unmarshalBlockStatsVersion(b, statsFooterMagicV1)
+	if err == ErrNoStatsFooter {
+		s, err = unmarshalBlockStatsVersion(b, statsFooterMagic)
+	}
+	return s, err
+}
+
+// unmarshalBlockStatsVersion reads the stats footer at the start of b if it's the version of the magic number
+func unmarshalBlockStatsVersion(b []byte, magic uint32) (*BlockStats, error) {
+	s, rest, err := unmarshalBlockStats(b, magic == statsFooterMagic)
+	if err != nil {
+		return nil, ErrNoStatsFooter
+	}
+	length := len(b) - len(rest)
+	if len(rest) < statsFooterTrailer || binary.BigEndian.Uint32(rest[8:]) != magic || binary.BigEndian.Uint32(rest) != uint32(length) {
+		return nil, ErrNoStatsFooter
+	}
+	if crc32.Checksum(b[:length], checksumTable) != binary.BigEndian.Uint32(rest[4:]) {
+		metricPageChecksumMismatches.WithLabelValues(checksumTypeStats).Inc()
+		return nil, fmt.Errorf("stats footer: %w", ErrPageChecksum)
+	}
+	return s, nil
+}
+
+// unmarshalBlockStats returns the stats at the start of b and the rest of b.  timeGroups is false for footers written
+// before time groups.
+func unmarshalBlockStats(b []byte, timeGroups bool) (*BlockStats, []byte, error) {
+	var err error
+	next := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			err = fmt.Errorf("corrupt stats footer")
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+	id := func() ID {
+		l := next()
+		if err == nil && l > uint64(len(b)) {
+			err = fmt.Errorf("corrupt stats footer. id of %d bytes", l)
+		}
+		if err != nil {
+			return nil
+		}
+		id := append(ID(nil), b[:l]...)
+		b = b[l:]
+		return id
+	}
+
+	s := &BlockStats{}
+	s.TotalRecords = uint32(next())
+	s.TotalObjects = uint32(next())
+	s.MinID = id()
+	s.MaxID = id()
+	s.Size = next()
+	s.UncompressedSize = next()
+	pages := next()
+	if err == nil && pages > uint64(len(b)) {
+		err = fmt.Errorf("corrupt stats footer. %d pages", pages)
+	}
+	prev := uint64(0)
+	for i := uint64(0); i < pages && err == nil; i++ {
+		prev += next()
+		s.PageOffsets = append(s.PageOffsets, prev)
+	}
+	if timeGroups {
+		s.TimeGroupWindow = time.Duration(next())
+		groups := next()
+		if err == nil && (groups > uint64(len(b)) || (groups > 0 && s.TimeGroupWindow <= 0)) {
+			err = fmt.Errorf("corrupt stats footer. %d time groups", groups)
+		}
+		window := int64(0)
+		for i := uint64(0); i < groups && err == nil; i++ {
+			window += int64(next())
+			g := TimeGroup{
+				Start: time.Unix(0, window*int64(s.TimeGroupWindow)),
+			}
+			records := next()
+			if err == nil && records > uint64(len(b)) {
+				err = fmt.Errorf("corrupt stats footer. %d records in time group", records)
+			}
+			record := uint32(0)
+			for j := uint64(0); j < records && err == nil; j++ {
+				record += uint32(next())
+				g.Records = append(g.Records, record)
+			}
+			s.TimeGroups = append(s.TimeGroups, g)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, b, nil
+}
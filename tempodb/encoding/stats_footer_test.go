@@ -0,0 +1,82 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsFooter(t *testing.T) {
+	stats := &BlockStats{
+		TotalRecords:     3,
+		TotalObjects:     10,
+		MinID:            []byte{0x01},
+		MaxID:            []byte{0x02, 0x03},
+		Size:             300,
+		UncompressedSize: 900,
+		PageOffsets:      []uint64{0, 100, 250},
+	}
+
+	objects := append(bytes.Repeat([]byte{0xff}, 300), stats.MarshalFooter()...)
+	actual, err := ReadBlockStats(bytes.NewReader(objects), int64(len(objects)))
+	require.NoError(t, err)
+	assert.Equal(t, stats, actual)
+	assert.Equal(t, 3.0, actual.CompressionRatio())
+
+	// objects written before the footer
+	_, err = ReadBlockStats(bytes.NewReader(objects[:300]), 300)
+	assert.Equal(t, ErrNoStatsFooter, err)
+	_, err = ReadBlockStats(bytes.NewReader(nil), 0)
+	assert.Equal(t, ErrNoStatsFooter, err)
+
+	objects[len(objects)-statsFooterTrailer-1] ^= 0xff
+	_, err = ReadBlockStats(bytes.NewReader(objects), int64(len(objects)))
+	assert.True(t, errors.Is(err, ErrPageChecksum))
+}
+
+func TestStatsFooterCorrupt(t *testing.T) {
+	stats := &BlockStats{
+		MinID:       []byte{0x01},
+		MaxID:       []byte{0x02},
+		PageOffsets: []uint64{0, 100},
+	}
+	b := stats.MarshalFooter()
+	b = b[:len(b)-statsFooterTrailer]
+
+	for i := 0; i < len(b); i++ {
+		_, _, err := unmarshalBlockStats(b[:i], true)
+		assert.Error(t, err)
+	}
+}
+
+func TestStatsFooterV1(t *testing.T) {
+	stats := &BlockStats{
+		TotalRecords: 2,
+		MinID:        []byte{0x01},
+		MaxID:        []byte{0x02},
+		Size:         200,
+		PageOffsets:  []uint64{0, 100},
+	}
+
+	// footers written before time groups don't end the stats with the (empty) groups and have their own magic number
+	footer := stats.MarshalFooter()
+	footer = footer[:len(footer)-statsFooterTrailer-2]
+	trailer := make([]byte, statsFooterTrailer)
+	binary.BigEndian.PutUint32(trailer, uint32(len(footer)))
+	binary.BigEndian.PutUint32(trailer[4:], crc32.Checksum(footer, checksumTable))
+	binary.BigEndian.PutUint32(trailer[8:], statsFooterMagicV1)
+	footer = append(footer, trailer...)
+
+	objects := append(bytes.Repeat([]byte{0xff}, 200), footer...)
+	actual, err := ReadBlockStats(bytes.NewReader(objects), int64(len(objects)))
+	require.NoError(t, err)
+	assert.Equal(t, stats, actual)
+	actual, err = UnmarshalBlockStats(append(footer, 0x00, 0x00))
+	require.NoError(t, err)
+	assert.Equal(t, stats, actual)
+}
@@ -0,0 +1,281 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// TagIndexMaxValuesPerKey is the most values of a key a tag index holds.  Keys with more, e.g. ids, aren't worth
+// indexing and are only recorded as dropped.
+const TagIndexMaxValuesPerKey = 1000
+
+// Tag is a key and value objects are indexed by, e.g. an attribute of a span
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// TagExtractor returns the tags of an object.  tempodb doesn't know the format of the objects it stores so the
+// caller supplies it.
+type TagExtractor interface {
+	Tags(object []byte) ([]Tag, error)
+}
+
+// TagExtractorFunc adapts a function to a TagExtractor
+type TagExtractorFunc func(object []byte) ([]Tag, error)
+
+func (f TagExtractorFunc) Tags(object []byte) ([]Tag, error) {
+	return f(object)
+}
+
+// TagIndexBuilder builds the tag index of a block: the records holding objects with each tag.  If the tags of any
+// object can't be extracted the index would be missing records, so none is built.  A nil *TagIndexBuilder is valid
+// and builds nothing.
+type TagIndexBuilder struct {
+	extractor TagExtractor
+	postings  map[string]map[string][]uint32
+	dropped   map[string]struct{}
+	failed    bool
+}
+
+func NewTagIndexBuilder(extractor TagExtractor) *TagIndexBuilder {
+	return &TagIndexBuilder{
+		extractor: extractor,
+		postings:  map[string]map[string][]uint32{},
+		dropped:   map[string]struct{}{},
+	}
+}
+
+// Add indexes the tags of an object written to the record'th record of the block.  Records must be added in order.
+func (b *TagIndexBuilder) Add(record uint32, object []byte) {
+	if b == nil || b.failed {
+		return
+	}
+
+	tags, err := b.extractor.Tags(object)
+	if err != nil {
+		b.failed = true
+		b.postings = nil
+		return
+	}
+
+	for _, t := range tags {
+		if _, ok := b.dropped[t.Key]; ok {
+			continue
+		}
+		values, ok := b.postings[t.Key]
+		if !ok {
+			values = map[string][]uint32{}
+			b.postings[t.Key] = values
+		}
+		records := values[t.Value]
+		if len(records) > 0 && records[len(records)-1] == record {
+			continue
+		}
+		values[t.Value] = append(records, record)
+
+		if len(values) > TagIndexMaxValuesPerKey {
+			delete(b.postings, t.Key)
+			b.dropped[t.Key] = struct{}{}
+		}
+	}
+}
+
+// Marshal returns the tag index or nil if there is none
+func (b *TagIndexBuilder) Marshal() []byte {
+	if b == nil || b.failed || len(b.postings)+len(b.dropped) == 0 {
+		return nil
+	}
+	return marshalTagIndex(b.postings, b.dropped)
+}
+
+// TagIndex maps the tags of the objects of a block to the records holding them so a search can skip records
+// without reading them
+type TagIndex struct {
+	postings map[string]map[string][]uint32
+	dropped  map[string]struct{}
+}
+
+// Records returns the ascending indexes of the records holding objects with the tag.  indexed is false if the key
+// had too many values to be indexed, in which case any record may hold the tag.
+func (t *TagIndex) Records(key string, value string) (records []uint32, indexed bool) {
+	if _, ok := t.dropped[key]; ok {
+		return nil, false
+	}
+	return t.postings[key][value], true
+}
+
+// Keys returns the indexed keys in order
+func (t *TagIndex) Keys() []string {
+	keys := make([]string, 0, len(t.postings))
+	for k := range t.postings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DroppedKeys returns the keys with too many values to index in order
+func (t *TagIndex) DroppedKeys() []string {
+	keys := make([]string, 0, len(t.dropped))
+	for k := range t.dropped {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Values returns the values of the key in order
+func (t *TagIndex) Values(key string) []string {
+	values := make([]string, 0, len(t.postings[key]))
+	for v := range t.postings[key] {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// marshalTagIndex writes the postings dictionary encoded: the sorted strings used as keys and values, then the
+// dropped keys, then the indexed keys, each with its values and their delta encoded records.  Every number is a
+// uvarint.
+func marshalTagIndex(postings map[string]map[string][]uint32, dropped map[string]struct{}) []byte {
+	t := &TagIndex{
+		postings: postings,
+		dropped:  dropped,
+	}
+
+	dictionary := map[string]uint64{}
+	for k, values := range postings {
+		dictionary[k] = 0
+		for v := range values {
+			dictionary[v] = 0
+		}
+	}
+	for k := range dropped {
+		dictionary[k] = 0
+	}
+	strs := make([]string, 0, len(dictionary))
+	for s := range dictionary {
+		strs = append(strs, s)
+	}
+	sort.Strings(strs)
+	for i, s := range strs {
+		dictionary[s] = uint64(i)
+	}
+
+	var buf []byte
+	put := func(v uint64) {
+		buf = appendUvarint(buf, v)
+	}
+
+	put(uint64(len(strs)))
+	for _, s := range strs {
+		put(uint64(len(s)))
+		buf = append(buf, s...)
+	}
+
+	put(uint64(len(dropped)))
+	for _, k := range t.DroppedKeys() {
+		put(dictionary[k])
+	}
+
+	put(uint64(len(postings)))
+	for _, k := range t.Keys() {
+		put(dictionary[k])
+		put(uint64(len(postings[k])))
+		for _, v := range t.Values(k) {
+			records := postings[k][v]
+			put(dictionary[v])
+			put(uint64(len(records)))
+			prev := uint32(0)
+			for _, r := range records {
+				put(uint64(r - prev))
+				prev = r
+			}
+		}
+	}
+
+	return buf
+}
+
+// UnmarshalTagIndex reads a tag index written by a TagIndexBuilder
+func UnmarshalTagIndex(b []byte) (*TagIndex, error) {
+	var err error
+	next := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			err = fmt.Errorf("corrupt tag index")
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+	str := func(strs []string) string {
+		i := next()
+		if err != nil {
+			return ""
+		}
+		if i >= uint64(len(strs)) {
+			err = fmt.Errorf("corrupt tag index. string %d of %d", i, len(strs))
+			return ""
+		}
+		return strs[i]
+	}
+
+	count := next()
+	var strs []string
+	for i := uint64(0); i < count && err == nil; i++ {
+		l := next()
+		if err == nil && l > uint64(len(b)) {
+			err = fmt.Errorf("corrupt tag index. string of %d bytes", l)
+		}
+		if err != nil {
+			break
+		}
+		strs = append(strs, string(b[:l]))
+		b = b[l:]
+	}
+
+	t := &TagIndex{
+		postings: map[string]map[string][]uint32{},
+		dropped:  map[string]struct{}{},
+	}
+	dropped := next()
+	for i := uint64(0); i < dropped && err == nil; i++ {
+		t.dropped[str(strs)] = struct{}{}
+	}
+
+	keys := next()
+	for i := uint64(0); i < keys && err == nil; i++ {
+		k := str(strs)
+		valueCount := next()
+		values := map[string][]uint32{}
+		for j := uint64(0); j < valueCount && err == nil; j++ {
+			v := str(strs)
+			recordCount := next()
+			var records []uint32
+			prev := uint32(0)
+			for r := uint64(0); r < recordCount && err == nil; r++ {
+				prev += uint32(next())
+				records = append(records, prev)
+			}
+			values[v] = records
+		}
+		t.postings[k] = values
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
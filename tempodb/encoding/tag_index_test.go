@@ -0,0 +1,84 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objects are "key=value,key=value"
+var testTagExtractor = TagExtractorFunc(func(object []byte) ([]Tag, error) {
+	if string(object) == "bad" {
+		return nil, errors.New("bad object")
+	}
+
+	var tags []Tag
+	for _, kv := range strings.Split(string(object), ",") {
+		split := strings.SplitN(kv, "=", 2)
+		tags = append(tags, Tag{Key: split[0], Value: split[1]})
+	}
+	return tags, nil
+})
+
+func TestTagIndex(t *testing.T) {
+	builder := NewTagIndexBuilder(testTagExtractor)
+	builder.Add(0, []byte("service=a,http.status=200"))
+	builder.Add(0, []byte("service=b,http.status=200"))
+	builder.Add(1, []byte("service=a,http.status=500"))
+	builder.Add(3, []byte("service=a"))
+	for i := 0; i <= TagIndexMaxValuesPerKey; i++ {
+		builder.Add(4, []byte(fmt.Sprintf("id=%d", i)))
+	}
+
+	index, err := UnmarshalTagIndex(builder.Marshal())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"http.status", "service"}, index.Keys())
+	assert.Equal(t, []string{"id"}, index.DroppedKeys())
+	assert.Equal(t, []string{"a", "b"}, index.Values("service"))
+
+	records, indexed := index.Records("service", "a")
+	assert.True(t, indexed)
+	assert.Equal(t, []uint32{0, 1, 3}, records)
+
+	records, indexed = index.Records("http.status", "200")
+	assert.True(t, indexed)
+	assert.Equal(t, []uint32{0}, records)
+
+	records, indexed = index.Records("service", "c")
+	assert.True(t, indexed)
+	assert.Empty(t, records)
+
+	_, indexed = index.Records("id", "1")
+	assert.False(t, indexed)
+}
+
+func TestTagIndexNotBuilt(t *testing.T) {
+	var builder *TagIndexBuilder
+	builder.Add(0, []byte("service=a"))
+	assert.Nil(t, builder.Marshal())
+
+	builder = NewTagIndexBuilder(testTagExtractor)
+	assert.Nil(t, builder.Marshal())
+
+	// an index missing the tags of an object would skip records holding them
+	builder.Add(0, []byte("service=a"))
+	builder.Add(1, []byte("bad"))
+	builder.Add(2, []byte("service=b"))
+	assert.Nil(t, builder.Marshal())
+}
+
+func TestTagIndexCorrupt(t *testing.T) {
+	builder := NewTagIndexBuilder(testTagExtractor)
+	builder.Add(0, []byte("service=a"))
+	b := builder.Marshal()
+
+	for i := 0; i < len(b); i++ {
+		_, err := UnmarshalTagIndex(b[:i])
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,146 @@
+package encoding
+
+import (
+	"sort"
+	"time"
+)
+
+// TimeGroupsMaxWindows is the most windows an object may span.  An object spanning more, e.g. one with a bogus
+// timestamp, would put its record in nearly every group, so no groups are built.
+const TimeGroupsMaxWindows = 1000
+
+// TimeExtractor returns the time range of an object, e.g. the start of its first span and the end of its last.
+// tempodb doesn't know the format of the objects it stores so the caller supplies it.
+type TimeExtractor interface {
+	TimeRange(object []byte) (start time.Time, end time.Time, err error)
+}
+
+// TimeExtractorFunc adapts a function to a TimeExtractor
+type TimeExtractorFunc func(object []byte) (time.Time, time.Time, error)
+
+func (f TimeExtractorFunc) TimeRange(object []byte) (time.Time, time.Time, error) {
+	return f(object)
+}
+
+// TimeGroup is a row group of a block: the records holding objects with times in the window starting at Start
+type TimeGroup struct {
+	Start   time.Time
+	Records []uint32
+}
+
+// TimeGroupBuilder groups the records of a block by the time windows of their objects.  Records hold objects sorted by
+// id, not time, so a record is in the group of every window one of its objects overlaps.  If the times of any object
+// can't be extracted the groups would be missing records, so none are built.  A nil *TimeGroupBuilder is valid and
+// builds nothing.
+type TimeGroupBuilder struct {
+	extractor TimeExtractor
+	window    time.Duration
+	groups    map[int64][]uint32 // by window number since the epoch
+	failed    bool
+}
+
+func NewTimeGroupBuilder(extractor TimeExtractor, window time.Duration) *TimeGroupBuilder {
+	return &TimeGroupBuilder{
+		extractor: extractor,
+		window:    window,
+		groups:    map[int64][]uint32{},
+	}
+}
+
+// Add groups an object written to the record'th record of the block.  Records must be added in order.
+func (b *TimeGroupBuilder) Add(record uint32, object []byte) {
+	if b == nil || b.failed {
+		return
+	}
+
+	start, end, err := b.extractor.TimeRange(object)
+	if err != nil || start.Unix() < 0 || end.Before(start) {
+		b.fail()
+		return
+	}
+	first := start.UnixNano() / int64(b.window)
+	last := end.UnixNano() / int64(b.window)
+	if last-first >= TimeGroupsMaxWindows {
+		b.fail()
+		return
+	}
+
+	for w := first; w <= last; w++ {
+		records := b.groups[w]
+		if len(records) > 0 && records[len(records)-1] == record {
+			continue
+		}
+		b.groups[w] = append(records, record)
+	}
+}
+
+func (b *TimeGroupBuilder) fail() {
+	b.failed = true
+	b.groups = nil
+}
+
+// Window returns the duration of the windows or 0 if no groups were built
+func (b *TimeGroupBuilder) Window() time.Duration {
+	if b == nil || b.failed || len(b.groups) == 0 {
+		return 0
+	}
+	return b.window
+}
+
+// Groups returns the groups in order of time or nil if none were built
+func (b *TimeGroupBuilder) Groups() []TimeGroup {
+	if b.Window() == 0 {
+		return nil
+	}
+
+	windows := make([]int64, 0, len(b.groups))
+	for w := range b.groups {
+		windows = append(windows, w)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+
+	groups := make([]TimeGroup, 0, len(windows))
+	for _, w := range windows {
+		groups = append(groups, TimeGroup{
+			Start:   time.Unix(0, w*int64(b.window)),
+			Records: b.groups[w],
+		})
+	}
+	return groups
+}
+
+// WithTimeGroups adds the groups the builder built to the stats
+func (s *BlockStats) WithTimeGroups(b *TimeGroupBuilder) *BlockStats {
+	s.TimeGroupWindow = b.Window()
+	s.TimeGroups = b.Groups()
+	return s
+}
+
+// PagesInRange returns the pages of objects holding objects with times between start and end in order.  Either may
+// be zero to leave that side of the range open.  grouped is false if the block's records aren't grouped by time, in
+// which case any page may hold them.
+func (s *BlockStats) PagesInRange(start, end time.Time) (pages []*Record, grouped bool) {
+	if s.TimeGroupWindow == 0 {
+		return nil, false
+	}
+
+	included := map[uint32]struct{}{}
+	for _, g := range s.TimeGroups {
+		if !start.IsZero() && !g.Start.Add(s.TimeGroupWindow).After(start) {
+			continue
+		}
+		if !end.IsZero() && g.Start.After(end) {
+			continue
+		}
+		for _, r := range g.Records {
+			included[r] = struct{}{}
+		}
+	}
+
+	for i, p := range statsPages(s) {
+		if _, ok := included[uint32(i)]; ok {
+			pages = append(pages, p)
+		}
+	}
+	return pages, true
+}
@@ -0,0 +1,88 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeExtractor reads objects as the hour they start in and the number of hours they last
+var testTimeExtractor = TimeExtractorFunc(func(object []byte) (time.Time, time.Time, error) {
+	if len(object) != 2 {
+		return time.Time{}, time.Time{}, errors.New("bad object")
+	}
+	start := time.Unix(int64(object[0])*3600, 0)
+	return start, start.Add(time.Duration(object[1]) * time.Hour), nil
+})
+
+func TestTimeGroupBuilder(t *testing.T) {
+	builder := NewTimeGroupBuilder(testTimeExtractor, time.Hour)
+	builder.Add(0, []byte{1, 0})
+	builder.Add(0, []byte{2, 0})
+	builder.Add(1, []byte{1, 2})
+	builder.Add(2, []byte{5, 0})
+
+	assert.Equal(t, time.Hour, builder.Window())
+	assert.Equal(t, []TimeGroup{
+		{Start: time.Unix(3600, 0), Records: []uint32{0, 1}},
+		{Start: time.Unix(2*3600, 0), Records: []uint32{0, 1}},
+		{Start: time.Unix(3*3600, 0), Records: []uint32{1}},
+		{Start: time.Unix(5*3600, 0), Records: []uint32{2}},
+	}, builder.Groups())
+
+	// an object whose times can't be extracted leaves no groups
+	builder.Add(3, []byte{})
+	assert.Equal(t, time.Duration(0), builder.Window())
+	assert.Nil(t, builder.Groups())
+
+	// as does one spanning too many windows
+	builder = NewTimeGroupBuilder(testTimeExtractor, time.Minute)
+	builder.Add(0, []byte{1, 255})
+	assert.Nil(t, builder.Groups())
+
+	var nilBuilder *TimeGroupBuilder
+	nilBuilder.Add(0, []byte{1, 0})
+	assert.Nil(t, nilBuilder.Groups())
+}
+
+func TestTimeGroupsFooter(t *testing.T) {
+	builder := NewTimeGroupBuilder(testTimeExtractor, time.Hour)
+	builder.Add(0, []byte{1, 0})
+	builder.Add(1, []byte{3, 1})
+	builder.Add(2, []byte{10, 0})
+
+	stats := (&BlockStats{
+		TotalRecords: 3,
+		MinID:        []byte{0x01},
+		MaxID:        []byte{0x02},
+		Size:         300,
+		PageOffsets:  []uint64{0, 100, 250},
+	}).WithTimeGroups(builder)
+
+	footer := stats.MarshalFooter()
+	objects := append(bytes.Repeat([]byte{0xff}, 300), footer...)
+	actual, err := ReadBlockStats(bytes.NewReader(objects), int64(len(objects)))
+	require.NoError(t, err)
+	assert.Equal(t, stats, actual)
+	actual, err = UnmarshalBlockStats(append(footer, 0x00, 0x00))
+	require.NoError(t, err)
+	assert.Equal(t, stats, actual)
+
+	pages, grouped := actual.PagesInRange(time.Unix(2*3600, 0), time.Unix(5*3600, 0))
+	assert.True(t, grouped)
+	assert.Equal(t, []*Record{{Start: 100, Length: 150}}, pages)
+	pages, _ = actual.PagesInRange(time.Time{}, time.Unix(3600, 0))
+	assert.Equal(t, []*Record{{Start: 0, Length: 100}}, pages)
+	pages, _ = actual.PagesInRange(time.Unix(4*3600, 0), time.Time{})
+	assert.Equal(t, []*Record{{Start: 100, Length: 150}, {Start: 250, Length: 50}}, pages)
+	pages, _ = actual.PagesInRange(time.Unix(20*3600, 0), time.Time{})
+	assert.Empty(t, pages)
+
+	// blocks that aren't grouped read every page
+	_, grouped = (&BlockStats{}).PagesInRange(time.Unix(3600, 0), time.Time{})
+	assert.False(t, grouped)
+}
@@ -0,0 +1,115 @@
+package encoding
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// VersionV0 blocks have uncompressed pages without checksums unless their meta records an encoding and page
+	// checksums, which blocks written before versions were introduced may
+	VersionV0 = "v0"
+	// VersionV1 blocks have pages encoded with the meta's encoding, each followed by its checksum
+	VersionV1 = "v1"
+
+	// CurrentVersion is the version new blocks are written in
+	CurrentVersion = VersionV1
+)
+
+// VersionedEncoding decodes blocks written in one version of the block format.  A new format registers one so
+// blocks of every version stay readable.
+type VersionedEncoding interface {
+	Version() string
+	// PageFormat returns how the block's pages of objects are written
+	PageFormat(meta *BlockMeta) (PageFormat, error)
+}
+
+var versions = map[string]VersionedEncoding{}
+
+func init() {
+	Register(v0Encoding{})
+	Register(v1Encoding{})
+}
+
+// Register makes a version of the block format readable.  It panics if the version is already registered.
+func Register(e VersionedEncoding) {
+	if _, ok := versions[e.Version()]; ok {
+		panic("block format " + e.Version() + " registered twice")
+	}
+	versions[e.Version()] = e
+}
+
+// FromVersion returns the encoding of a version of the block format
+func FromVersion(v string) (VersionedEncoding, error) {
+	e, ok := versions[v]
+	if !ok {
+		return nil, fmt.Errorf("unsupported block format %s. supported formats are %s", v, supportedVersions())
+	}
+	return e, nil
+}
+
+// OldFormat returns true if the block was written in an older version of the block format.  Compacting it writes its
+// objects in the current version.
+func (b *BlockMeta) OldFormat() bool {
+	return b.Version != CurrentVersion
+}
+
+// PageFormat returns the format of the block's pages of objects according to its version
+func (b *BlockMeta) PageFormat() (PageFormat, error) {
+	e, err := FromVersion(b.Version)
+	if err != nil {
+		return PageFormat{}, fmt.Errorf("block %s: %w", b.BlockID, err)
+	}
+	return e.PageFormat(b)
+}
+
+type v0Encoding struct{}
+
+func (v0Encoding) Version() string {
+	return VersionV0
+}
+
+func (v0Encoding) PageFormat(meta *BlockMeta) (PageFormat, error) {
+	return pageFormat(meta, meta.PageChecksums)
+}
+
+type v1Encoding struct{}
+
+func (v1Encoding) Version() string {
+	return VersionV1
+}
+
+func (v1Encoding) PageFormat(meta *BlockMeta) (PageFormat, error) {
+	return pageFormat(meta, true)
+}
+
+// pageFormat returns the format of the pages of a block with the meta's encoding and encryption.  An empty encoding
+// is none.
+func pageFormat(meta *BlockMeta, checksum bool) (PageFormat, error) {
+	f := PageFormat{Encoding: EncNone, Checksum: checksum}
+	if meta.Encoding != "" {
+		enc, err := ParseEncoding(string(meta.Encoding))
+		if err != nil {
+			return PageFormat{}, fmt.Errorf("block %s: %w", meta.BlockID, err)
+		}
+		f.Encoding = enc
+	}
+	if meta.EncryptionKeyID != "" {
+		k, err := meta.encryptionKey()
+		if err != nil {
+			return PageFormat{}, err
+		}
+		f.Encryption = k
+	}
+	return f, nil
+}
+
+func supportedVersions() string {
+	names := make([]string, 0, len(versions))
+	for v := range versions {
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
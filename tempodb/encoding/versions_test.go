@@ -0,0 +1,64 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionedEncodings(t *testing.T) {
+	meta := NewBlockMeta(testTenantID, uuid.New())
+	assert.Equal(t, CurrentVersion, meta.Version)
+
+	tests := []struct {
+		name     string
+		version  string
+		encoding Encoding
+		checksum bool
+		expected PageFormat
+	}{
+		{
+			name:     "v0 before encodings",
+			version:  VersionV0,
+			expected: PageFormat{Encoding: EncNone},
+		},
+		{
+			name:     "v0 with page checksums",
+			version:  VersionV0,
+			encoding: EncSnappy,
+			checksum: true,
+			expected: PageFormat{Encoding: EncSnappy, Checksum: true},
+		},
+		{
+			name:     "v1",
+			version:  VersionV1,
+			encoding: EncGZIP,
+			expected: PageFormat{Encoding: EncGZIP, Checksum: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta.Version = tt.version
+			meta.Encoding = tt.encoding
+			meta.PageChecksums = tt.checksum
+
+			format, err := meta.PageFormat()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+
+	meta.Version = "v9"
+	_, err := meta.PageFormat()
+	assert.EqualError(t, err, "block "+meta.BlockID.String()+": unsupported block format v9. supported formats are v0, v1")
+
+	meta.Version = VersionV1
+	meta.Encoding = EncZstd
+	_, err = meta.PageFormat()
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { Register(v1Encoding{}) })
+}
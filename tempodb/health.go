@@ -0,0 +1,97 @@
+package tempodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/tempo/tempodb/backend"
+)
+
+const (
+	healthCheckTimeout = 10 * time.Second
+	// the health check reads the meta of a block that never exists in a tenant that never exists.  any
+	// answer but "does not exist" means the backend can't be read
+	healthCheckTenantID = "tempo-health-check"
+)
+
+var (
+	metricBackendHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "backend_healthy",
+		Help:      "1 if the last health check of the backend succeeded, 0 if it failed.",
+	}, []string{"backend"})
+
+	errBackendNotChecked = errors.New("backend not checked yet")
+)
+
+type healthCheck struct {
+	name string
+	r    backend.Reader
+	// ready is true for backends queries depend on.  the mirror is checked but doesn't affect readiness.
+	ready bool
+}
+
+// BackendHealthy returns the error of the last failed health check of a backend queries depend on, or nil if
+// they all passed.  Always nil if health checks are disabled.
+func (rw *readerWriter) BackendHealthy() error {
+	if rw.cfg.HealthCheckInterval <= 0 {
+		return nil
+	}
+
+	rw.healthMtx.Lock()
+	defer rw.healthMtx.Unlock()
+
+	return rw.healthErr
+}
+
+func (rw *readerWriter) healthLoop() {
+	if rw.cfg.HealthCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(rw.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	rw.checkBackends()
+	for range ticker.C {
+		rw.checkBackends()
+	}
+}
+
+func (rw *readerWriter) checkBackends() {
+	var readyErr error
+	for _, hc := range rw.healthChecks {
+		err := hc.check()
+		if err != nil {
+			level.Error(rw.logger).Log("msg", "backend health check failed", "backend", hc.name, "err", err)
+			metricBackendHealthy.WithLabelValues(hc.name).Set(0)
+			if hc.ready && readyErr == nil {
+				readyErr = fmt.Errorf("backend %s: %w", hc.name, err)
+			}
+			continue
+		}
+		metricBackendHealthy.WithLabelValues(hc.name).Set(1)
+	}
+
+	rw.healthMtx.Lock()
+	rw.healthErr = readyErr
+	rw.healthMtx.Unlock()
+}
+
+func (hc healthCheck) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	_, err := hc.r.BlockMeta(ctx, uuid.Nil, healthCheckTenantID)
+	if err == nil || err == backend.ErrMetaDoesNotExist {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package tempodb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendHealthy(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	require.NoError(t, err)
+
+	backendPath := path.Join(tempDir, "traces")
+	primary, _, _, err := local.New(&local.Config{Path: backendPath})
+	require.NoError(t, err)
+	mirror, _, _, err := local.New(&local.Config{Path: path.Join(tempDir, "mirror")})
+	require.NoError(t, err)
+
+	rw := &readerWriter{
+		cfg:    &Config{HealthCheckInterval: time.Hour},
+		logger: log.NewNopLogger(),
+		healthChecks: []healthCheck{
+			{name: "local", r: primary, ready: true},
+			{name: "local-mirror", r: mirror},
+		},
+		healthErr: errBackendNotChecked,
+	}
+	assert.Equal(t, errBackendNotChecked, rw.BackendHealthy())
+
+	rw.checkBackends()
+	assert.NoError(t, rw.BackendHealthy())
+
+	// a file where the bucket should be fails every read
+	require.NoError(t, os.RemoveAll(backendPath))
+	require.NoError(t, ioutil.WriteFile(backendPath, []byte{}, 0644))
+	rw.checkBackends()
+	assert.Error(t, rw.BackendHealthy())
+
+	// the mirror doesn't affect readiness
+	require.NoError(t, os.RemoveAll(backendPath))
+	require.NoError(t, os.RemoveAll(path.Join(tempDir, "mirror")))
+	require.NoError(t, ioutil.WriteFile(path.Join(tempDir, "mirror"), []byte{}, 0644))
+	rw.checkBackends()
+	assert.NoError(t, rw.BackendHealthy())
+
+	// disabled
+	rw.cfg.HealthCheckInterval = 0
+	assert.NoError(t, rw.BackendHealthy())
+}
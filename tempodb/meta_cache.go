@@ -0,0 +1,142 @@
+package tempodb
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/willf/bloom"
+)
+
+const (
+	metaCacheTypeMeta  = "meta"
+	metaCacheTypeBloom = "bloom"
+
+	// rough size of a parsed meta.json.  blooms are sized by their serialized length
+	metaCacheMetaSize = 512
+)
+
+var (
+	metricMetaCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "meta_cache_total",
+		Help:      "Total number of times the block meta cache was queried.",
+	}, []string{"type", "status"})
+	metricMetaCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "meta_cache_bytes",
+		Help:      "Approximate size of the entries in the block meta cache.",
+	})
+)
+
+// metaCache is an LRU of parsed block metadata, i.e. *encoding.BlockMeta and *cachedBloom, keyed by
+// block.  Entries are never invalidated.  Blooms can't change once written but a meta is replaced when
+// its block is compacted so callers must only cache metas where a stale one is harmless.  A nil
+// *metaCache is valid and caches nothing.
+type metaCache struct {
+	mtx      sync.Mutex
+	maxBytes int
+	bytes    int
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+// cachedBloom holds the shards of a block's bloom filter read so far.  nil for those that haven't been.
+type cachedBloom struct {
+	shards []*bloom.BloomFilter
+	size   int
+}
+
+type metaCacheEntry struct {
+	key   string
+	value interface{}
+	size  int
+}
+
+func newMetaCache(maxBytes int) *metaCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+
+	return &metaCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *metaCache) get(t string, blockID uuid.UUID, tenantID string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[metaCacheKey(t, blockID, tenantID)]
+	if !ok {
+		metricMetaCache.WithLabelValues(t, "miss").Inc()
+		return nil, false
+	}
+
+	metricMetaCache.WithLabelValues(t, "hit").Inc()
+	c.lru.MoveToFront(e)
+	return e.Value.(*metaCacheEntry).value, true
+}
+
+func (c *metaCache) put(t string, blockID uuid.UUID, tenantID string, value interface{}, size int) {
+	if c == nil || size > c.maxBytes {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := metaCacheKey(t, blockID, tenantID)
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	c.entries[key] = c.lru.PushFront(&metaCacheEntry{
+		key:   key,
+		value: value,
+		size:  size,
+	})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+
+	metricMetaCacheBytes.Set(float64(c.bytes))
+}
+
+// evictBlock drops every entry for the block
+func (c *metaCache) evictBlock(blockID uuid.UUID, tenantID string) {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, t := range []string{metaCacheTypeMeta, metaCacheTypeBloom} {
+		if e, ok := c.entries[metaCacheKey(t, blockID, tenantID)]; ok {
+			c.remove(e)
+		}
+	}
+
+	metricMetaCacheBytes.Set(float64(c.bytes))
+}
+
+func (c *metaCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*metaCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func metaCacheKey(t string, blockID uuid.UUID, tenantID string) string {
+	return blockID.String() + ":" + tenantID + ":" + t
+}
@@ -0,0 +1,108 @@
+package tempodb
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaCache(t *testing.T) {
+	c := newMetaCache(10)
+
+	a, b, d := uuid.New(), uuid.New(), uuid.New()
+	c.put(metaCacheTypeBloom, a, testTenantID, "a", 4)
+	c.put(metaCacheTypeBloom, b, testTenantID, "b", 4)
+
+	v, ok := c.get(metaCacheTypeBloom, a, testTenantID)
+	assert.True(t, ok)
+	assert.Equal(t, "a", v)
+
+	// types and tenants are cached separately
+	_, ok = c.get(metaCacheTypeMeta, a, testTenantID)
+	assert.False(t, ok)
+	_, ok = c.get(metaCacheTypeBloom, a, "other")
+	assert.False(t, ok)
+
+	// b is least recently used and evicted to make room
+	c.put(metaCacheTypeBloom, d, testTenantID, "d", 4)
+	_, ok = c.get(metaCacheTypeBloom, b, testTenantID)
+	assert.False(t, ok)
+	_, ok = c.get(metaCacheTypeBloom, a, testTenantID)
+	assert.True(t, ok)
+	assert.Equal(t, 8, c.bytes)
+
+	// entries larger than the cache are not stored
+	c.put(metaCacheTypeBloom, b, testTenantID, "b", 11)
+	_, ok = c.get(metaCacheTypeBloom, b, testTenantID)
+	assert.False(t, ok)
+
+	// evicting a block drops all of its entries
+	c.put(metaCacheTypeMeta, a, testTenantID, "meta", 1)
+	c.evictBlock(a, testTenantID)
+	_, ok = c.get(metaCacheTypeBloom, a, testTenantID)
+	assert.False(t, ok)
+	_, ok = c.get(metaCacheTypeMeta, a, testTenantID)
+	assert.False(t, ok)
+	assert.Equal(t, 4, c.bytes)
+
+	// a nil cache caches nothing
+	var nilCache *metaCache
+	nilCache.put(metaCacheTypeBloom, a, testTenantID, "a", 1)
+	_, ok = nilCache.get(metaCacheTypeBloom, a, testTenantID)
+	assert.False(t, ok)
+	nilCache.evictBlock(a, testTenantID)
+	assert.Nil(t, newMetaCache(0))
+}
+
+func TestFindUsesMetaCache(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle:  0,
+		MetaCacheMaxBytes: 1024 * 1024,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+
+	r.(*readerWriter).pollBlocklist()
+
+	_, metrics, _, err := r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), metrics.BloomFilterReads.Load())
+
+	// the second lookup uses the cached bloom
+	_, metrics, _, err = r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), metrics.BloomFilterReads.Load())
+	assert.Equal(t, int32(1), metrics.IndexReads.Load())
+}
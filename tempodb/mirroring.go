@@ -0,0 +1,27 @@
+package tempodb
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// reconcileMirror replicates to the mirror whatever the background replication missed for a tenant.  Tenants
+// are split between the compactors so each is only reconciled once per cycle.
+func (rw *readerWriter) reconcileMirror(tenantID string) {
+	rw.compactorMtx.Lock()
+	owns := rw.compactorSharder.Owns(mirrorHash(tenantID))
+	rw.compactorMtx.Unlock()
+	if !owns {
+		return
+	}
+
+	err := rw.mirror.Reconcile(context.Background(), tenantID, rw.blocklist(tenantID), rw.compactedBlocklist(tenantID))
+	if err != nil {
+		level.Error(rw.logger).Log("msg", "failed to reconcile mirror", "tenantID", tenantID, "err", err)
+	}
+}
+
+func mirrorHash(tenantID string) string {
+	return "mirror-" + tenantID
+}
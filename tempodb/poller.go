@@ -0,0 +1,453 @@
+package tempodb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/pool"
+)
+
+var (
+	metricBlocklistErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_poll_errors_total",
+		Help:      "Total number of times an error occurred while polling the blocklist.",
+	}, []string{"tenant"})
+	metricBlocklistPollDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_poll_duration_seconds",
+		Help:      "Records the amount of time to poll and update the blocklist.",
+		Buckets:   prometheus.ExponentialBuckets(.25, 2, 6),
+	})
+	metricBlocklistLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_length",
+		Help:      "Total number of blocks per tenant.",
+	}, []string{"tenant"})
+	metricBlocklistBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_bytes",
+		Help:      "Total size of the objects in each tenant's blocks.  Blocks written before sizes were recorded count as 0.",
+	}, []string{"tenant"})
+	metricBlocklistLengthByLevel = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_length_by_compaction_level",
+		Help:      "Number of blocks per tenant at each compaction level.",
+	}, []string{"tenant", "level"})
+	metricCompactedBlocklistLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_compacted_length",
+		Help:      "Total number of compacted blocks per tenant.",
+	}, []string{"tenant"})
+	metricBlocklistTenantPollDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_tenant_poll_duration_seconds",
+		Help:      "Time taken by the last poll of each tenant's blocklist.",
+	}, []string{"tenant"})
+	metricTenantIndexErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_tenant_index_errors_total",
+		Help:      "Total number of times the tenant index could not be read or written.",
+	}, []string{"tenant"})
+	metricTenantIndexAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_tenant_index_age_seconds",
+		Help:      "Age of the last tenant index read or written.",
+	}, []string{"tenant"})
+	metricBlocklistConsecutiveFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_poll_consecutive_failures",
+		Help:      "Number of polls in a row that failed to retrieve the tenant's complete blocklist.",
+	}, []string{"tenant"})
+	metricBlocklistLastSuccessfulPoll = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_last_successful_poll_timestamp_seconds",
+		Help:      "Unix timestamp of the last poll that retrieved the tenant's complete blocklist.",
+	}, []string{"tenant"})
+	metricBlocklistOldFormat = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_old_format_blocks",
+		Help:      "Number of blocks per tenant written in an older version of the block format.  Compaction upgrades them.",
+	}, []string{"tenant"})
+	metricBlocklistQuarantined = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "blocklist_quarantined_blocks",
+		Help:      "Number of blocks left out of the tenant's blocklist by the last listing because their meta is invalid.",
+	}, []string{"tenant"})
+)
+
+func (rw *readerWriter) maintenanceLoop() {
+	if rw.cfg.MaintenanceCycle == 0 {
+		level.Info(rw.logger).Log("msg", "maintenance cycle unset.  blocklist polling disabled.")
+		return
+	}
+
+	rw.pollBlocklist()
+	go rw.prefetchRecentBlocks()
+
+	for {
+		time.Sleep(rw.nextPoll())
+		rw.pollBlocklist()
+		go rw.prefetchRecentBlocks()
+	}
+}
+
+// nextPoll returns how long to wait before the next poll.  jitter keeps every querier and compactor
+// that started at the same time, e.g. after a rollout, from hitting the backend at once.
+func (rw *readerWriter) nextPoll() time.Duration {
+	if rw.cfg.BlocklistPollJitter <= 0 {
+		return rw.cfg.MaintenanceCycle
+	}
+
+	return rw.cfg.MaintenanceCycle + time.Duration(rand.Int63n(int64(rw.cfg.BlocklistPollJitter)))
+}
+
+func (rw *readerWriter) pollBlocklist() {
+	start := time.Now()
+	defer func() { metricBlocklistPollDuration.Observe(time.Since(start).Seconds()) }()
+
+	ctx := context.Background()
+	tenants, err := rw.r.Tenants(ctx)
+	if err != nil {
+		metricBlocklistErrors.WithLabelValues("").Inc()
+		level.Error(rw.logger).Log("msg", "error retrieving tenants while polling blocklist", "err", err)
+
+		// every tenant we know about is now stale
+		for _, tenantID := range rw.blocklistTenants() {
+			rw.pollFailed(tenantID)
+		}
+		return
+	}
+
+	// tenants are polled independently so a handful of shards keeps one huge tenant from holding up the rest
+	forEachTenant(tenants, rw.cfg.BlocklistPollConcurrency, func(tenantID string) {
+		rw.pollTenantAndUpdate(ctx, tenantID)
+	})
+}
+
+func (rw *readerWriter) pollTenantAndUpdate(ctx context.Context, tenantID string) {
+	start := time.Now()
+	defer func() { metricBlocklistTenantPollDuration.WithLabelValues(tenantID).Set(time.Since(start).Seconds()) }()
+
+	blocklist, compactedBlocklist, complete, err := rw.pollTenant(ctx, tenantID)
+	if err != nil {
+		metricBlocklistErrors.WithLabelValues(tenantID).Inc()
+		level.Error(rw.logger).Log("msg", "run blocklist jobs", "tenantID", tenantID, "err", err)
+		rw.pollFailed(tenantID)
+		return
+	}
+
+	if !complete {
+		// a truncated blocklist makes traces in the missing blocks disappear.  keep serving the previous
+		// blocklist for a while and hope the backend recovers
+		failures := rw.pollFailed(tenantID)
+		if failures <= rw.cfg.BlocklistPollTolerateConsecutiveErrors && rw.hasBlocklist(tenantID) {
+			level.Warn(rw.logger).Log("msg", "blocklist poll incomplete. keeping previous blocklist", "tenantID", tenantID, "consecutiveFailures", failures)
+			return
+		}
+		level.Warn(rw.logger).Log("msg", "blocklist poll incomplete. using partial blocklist", "tenantID", tenantID, "consecutiveFailures", failures)
+	} else {
+		rw.pollSucceeded(tenantID)
+	}
+
+	sort.Slice(blocklist, func(i, j int) bool {
+		return blocklist[i].StartTime.Before(blocklist[j].StartTime)
+	})
+	sort.Slice(compactedBlocklist, func(i, j int) bool {
+		return compactedBlocklist[i].StartTime.Before(compactedBlocklist[j].StartTime)
+	})
+
+	rw.blockListsMtx.Lock()
+	prev := rw.blockLists[tenantID]
+	change := diffBlocklists(tenantID, prev, rw.compactedBlockLists[tenantID], blocklist, compactedBlocklist)
+	rw.blockLists[tenantID] = blocklist
+	rw.compactedBlockLists[tenantID] = compactedBlocklist
+	rw.blockListsMtx.Unlock()
+
+	updateBlocklistMetrics(tenantID, prev, blocklist, compactedBlocklist)
+	rw.notifyBlocklistChange(change)
+}
+
+// updateBlocklistMetrics sets the tenant's blocklist gauges.  a growing number of blocks at the lower
+// compaction levels means compaction is falling behind.
+func updateBlocklistMetrics(tenantID string, prev []*encoding.BlockMeta, blocklist []*encoding.BlockMeta, compactedBlocklist []*encoding.CompactedBlockMeta) {
+	metricBlocklistLength.WithLabelValues(tenantID).Set(float64(len(blocklist)))
+	metricCompactedBlocklistLength.WithLabelValues(tenantID).Set(float64(len(compactedBlocklist)))
+
+	bytes := uint64(0)
+	oldFormat := 0
+	levels := map[uint8]int{}
+	for _, b := range blocklist {
+		bytes += b.Size
+		levels[b.CompactionLevel]++
+		if b.OldFormat() {
+			oldFormat++
+		}
+	}
+	// zero the levels that have emptied out since the last poll
+	for _, b := range prev {
+		if _, ok := levels[b.CompactionLevel]; !ok {
+			levels[b.CompactionLevel] = 0
+		}
+	}
+
+	metricBlocklistBytes.WithLabelValues(tenantID).Set(float64(bytes))
+	metricBlocklistOldFormat.WithLabelValues(tenantID).Set(float64(oldFormat))
+	for level, count := range levels {
+		metricBlocklistLengthByLevel.WithLabelValues(tenantID, strconv.Itoa(int(level))).Set(float64(count))
+	}
+}
+
+// pollFailed records a failed or incomplete poll of the tenant and returns the number of failures in a row
+func (rw *readerWriter) pollFailed(tenantID string) int {
+	rw.blockListsMtx.Lock()
+	defer rw.blockListsMtx.Unlock()
+
+	rw.pollFailures[tenantID]++
+	failures := rw.pollFailures[tenantID]
+	metricBlocklistConsecutiveFailures.WithLabelValues(tenantID).Set(float64(failures))
+
+	return failures
+}
+
+func (rw *readerWriter) pollSucceeded(tenantID string) {
+	rw.blockListsMtx.Lock()
+	defer rw.blockListsMtx.Unlock()
+
+	delete(rw.pollFailures, tenantID)
+	metricBlocklistConsecutiveFailures.WithLabelValues(tenantID).Set(0)
+	metricBlocklistLastSuccessfulPoll.WithLabelValues(tenantID).SetToCurrentTime()
+}
+
+func (rw *readerWriter) hasBlocklist(tenantID string) bool {
+	rw.blockListsMtx.Lock()
+	defer rw.blockListsMtx.Unlock()
+
+	_, ok := rw.blockLists[tenantID]
+	return ok
+}
+
+// pollTenant returns the tenant's blocklist.  if tenant indexes are enabled it is read from the index
+// unless this instance is responsible for building the index or the index is missing or stale, in which
+// case the tenant is listed.  complete is false if some blocks could not be listed.
+func (rw *readerWriter) pollTenant(ctx context.Context, tenantID string) (blocklist []*encoding.BlockMeta, compactedBlocklist []*encoding.CompactedBlockMeta, complete bool, err error) {
+	if rw.cfg.BlocklistPollStaleTenantIndex == 0 {
+		return rw.listTenant(ctx, tenantID)
+	}
+
+	builder := rw.buildsTenantIndex(tenantID)
+	// blocks with invalid metas aren't in the index.  the compactor that clears them has to list the tenant to find
+	// them
+	if !builder && !rw.clearsQuarantined(tenantID) {
+		index, err := rw.r.TenantIndex(ctx, tenantID)
+		if err == nil {
+			age := time.Since(index.CreatedAt)
+			metricTenantIndexAge.WithLabelValues(tenantID).Set(age.Seconds())
+			if age < rw.cfg.BlocklistPollStaleTenantIndex {
+				return index.Meta, index.CompactedMeta, true, nil
+			}
+			err = fmt.Errorf("tenant index is stale. created %v ago", age)
+		}
+
+		metricTenantIndexErrors.WithLabelValues(tenantID).Inc()
+		level.Warn(rw.logger).Log("msg", "failed to read tenant index. falling back to listing blocks", "tenantID", tenantID, "err", err)
+	}
+
+	blocklist, compactedBlocklist, complete, err = rw.listTenant(ctx, tenantID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// don't replace a good index with one missing blocks due to a listing error
+	if builder && complete {
+		err = rw.w.WriteTenantIndex(ctx, tenantID, blocklist, compactedBlocklist)
+		if err != nil {
+			metricTenantIndexErrors.WithLabelValues(tenantID).Inc()
+			level.Error(rw.logger).Log("msg", "failed to write tenant index", "tenantID", tenantID, "err", err)
+		} else {
+			metricTenantIndexAge.WithLabelValues(tenantID).Set(0)
+		}
+	}
+
+	return blocklist, compactedBlocklist, complete, nil
+}
+
+// buildsTenantIndex returns true if this instance should write the tenant's index.  the index is built
+// by whichever compactor owns the tenant so it is only listed once per poll across the cluster.
+func (rw *readerWriter) buildsTenantIndex(tenantID string) bool {
+	rw.compactorMtx.Lock()
+	sharder := rw.compactorSharder
+	rw.compactorMtx.Unlock()
+
+	return sharder != nil && sharder.Owns(tenantIndexHash(tenantID))
+}
+
+// clearsQuarantined returns true if this instance's retention deletes the tenant's quarantined blocks
+func (rw *readerWriter) clearsQuarantined(tenantID string) bool {
+	rw.compactorMtx.Lock()
+	defer rw.compactorMtx.Unlock()
+
+	cfg := rw.compactorCfg
+	if rw.compactorSharder == nil || cfg == nil || cfg.DisableRetention || cfg.QuarantinedBlockRetention <= 0 {
+		return false
+	}
+	return rw.compactorSharder.Owns(retentionHash(tenantID))
+}
+
+// setQuarantined records the blocks that were quarantined when the tenant was last listed.  blocks keep the time
+// they were first quarantined until they are repaired or deleted.
+func (rw *readerWriter) setQuarantined(tenantID string, blockIDs []uuid.UUID) {
+	rw.blockListsMtx.Lock()
+	defer rw.blockListsMtx.Unlock()
+
+	prev := rw.quarantined[tenantID]
+	quarantined := make(map[uuid.UUID]time.Time, len(blockIDs))
+	for _, blockID := range blockIDs {
+		since, ok := prev[blockID]
+		if !ok {
+			since = time.Now()
+		}
+		quarantined[blockID] = since
+	}
+	rw.quarantined[tenantID] = quarantined
+}
+
+// expiredQuarantined returns the tenant's blocks that have been quarantined since before cutoff
+func (rw *readerWriter) expiredQuarantined(tenantID string, cutoff time.Time) []uuid.UUID {
+	rw.blockListsMtx.Lock()
+	defer rw.blockListsMtx.Unlock()
+
+	var expired []uuid.UUID
+	for blockID, since := range rw.quarantined[tenantID] {
+		if since.Before(cutoff) {
+			expired = append(expired, blockID)
+		}
+	}
+	return expired
+}
+
+func (rw *readerWriter) compacts() bool {
+	rw.compactorMtx.Lock()
+	defer rw.compactorMtx.Unlock()
+
+	return rw.compactorSharder != nil
+}
+
+// blockMeta returns the block's meta from the meta cache if allowed or the backend
+func (rw *readerWriter) blockMeta(ctx context.Context, blockID uuid.UUID, tenantID string, useCache bool) (*encoding.BlockMeta, error) {
+	if !useCache {
+		return rw.r.BlockMeta(ctx, blockID, tenantID)
+	}
+
+	if cached, ok := rw.metaCache.get(metaCacheTypeMeta, blockID, tenantID); ok {
+		return cached.(*encoding.BlockMeta), nil
+	}
+
+	meta, err := rw.r.BlockMeta(ctx, blockID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	rw.metaCache.put(metaCacheTypeMeta, blockID, tenantID, meta, metaCacheMetaSize)
+	return meta, nil
+}
+
+func tenantIndexHash(tenantID string) string {
+	return "tenant-index-" + tenantID
+}
+
+// listTenant lists every block of the tenant and reads its meta.  complete is false if listing failed
+// part way and the blocklist may be missing blocks.
+func (rw *readerWriter) listTenant(ctx context.Context, tenantID string) (blocklist []*encoding.BlockMeta, compactedBlocklist []*encoding.CompactedBlockMeta, complete bool, err error) {
+	blockIDs, err := rw.r.Blocks(ctx, tenantID)
+	complete = err == nil
+	if err != nil {
+		metricBlocklistErrors.WithLabelValues(tenantID).Inc()
+		level.Error(rw.logger).Log("msg", "error polling blocklist", "tenantID", tenantID, "err", err)
+	}
+
+	interfaceSlice := make([]interface{}, 0, len(blockIDs))
+	for _, id := range blockIDs {
+		interfaceSlice = append(interfaceSlice, id)
+	}
+
+	// a compactor must see a block is compacted on the next poll or it will compact it again.  everyone
+	// else can cache metas.  they'll keep searching a compacted block until it is cleared which is harmless.
+	cacheMeta := !rw.compacts()
+
+	listMutex := sync.Mutex{}
+	var quarantined []uuid.UUID
+	blocklist = make([]*encoding.BlockMeta, 0, len(blockIDs))
+	compactedBlocklist = make([]*encoding.CompactedBlockMeta, 0, len(blockIDs))
+	_, err = rw.pool.RunJobs(ctx, interfaceSlice, func(ctx context.Context, payload interface{}) ([]byte, error) {
+		blockID := payload.(uuid.UUID)
+
+		var compactedBlockMeta *encoding.CompactedBlockMeta
+		blockMeta, err := rw.blockMeta(ctx, blockID, tenantID, cacheMeta)
+		// if the normal meta doesn't exist maybe it's compacted.
+		if err == backend.ErrMetaDoesNotExist {
+			blockMeta = nil
+			compactedBlockMeta, err = rw.c.CompactedBlockMeta(blockID, tenantID)
+		}
+
+		// a block with an invalid meta won't become valid by polling again.  quarantine it so it doesn't fail every
+		// listing, it's excluded until its meta is repaired or retention deletes it
+		if invalidMeta(err) {
+			level.Warn(rw.logger).Log("msg", "quarantining block with invalid meta", "tenantID", tenantID, "blockID", blockID, "err", err)
+			listMutex.Lock()
+			quarantined = append(quarantined, blockID)
+			listMutex.Unlock()
+			return nil, nil
+		}
+
+		if err != nil {
+			metricBlocklistErrors.WithLabelValues(tenantID).Inc()
+			level.Error(rw.logger).Log("msg", "failed to retrieve block meta", "tenantID", tenantID, "blockID", blockID, "err", err)
+			listMutex.Lock()
+			complete = false
+			listMutex.Unlock()
+			return nil, nil
+		}
+
+		// todo:  make this not terrible. this mutex is dumb we should be returning results with a channel. shoehorning this into the worker pool is silly.
+		//        make the worker pool more generic? and reusable in this case
+		listMutex.Lock()
+		if blockMeta != nil {
+			blocklist = append(blocklist, blockMeta)
+
+		} else if compactedBlockMeta != nil {
+			compactedBlocklist = append(compactedBlocklist, compactedBlockMeta)
+		}
+		listMutex.Unlock()
+
+		return nil, nil
+	}, pool.WithPriority(pool.PriorityLow), pool.WithTenant(tenantID), pool.WithJobType("poll_blocklist"))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	metricBlocklistQuarantined.WithLabelValues(tenantID).Set(float64(len(quarantined)))
+	rw.setQuarantined(tenantID, quarantined)
+
+	return blocklist, compactedBlocklist, complete, nil
+}
+
+// invalidMeta returns true if err is from a meta that was read but is invalid
+func invalidMeta(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.Is(err, encoding.ErrInvalidMeta) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
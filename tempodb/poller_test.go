@@ -0,0 +1,290 @@
+package tempodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/wal"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollConcurrency(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle:         0,
+		BlocklistPollConcurrency: 3,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	tenants := 10
+	for i := 0; i < tenants; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), fmt.Sprintf("tenant-%d", i))
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+
+	assert.Len(t, rw.blockLists, tenants)
+	for i := 0; i < tenants; i++ {
+		assert.Len(t, rw.blocklist(fmt.Sprintf("tenant-%d", i)), 1)
+	}
+}
+
+func TestNextPoll(t *testing.T) {
+	rw := &readerWriter{
+		cfg: &Config{
+			MaintenanceCycle: time.Minute,
+		},
+	}
+	assert.Equal(t, time.Minute, rw.nextPoll())
+
+	rw.cfg.BlocklistPollJitter = 10 * time.Second
+	for i := 0; i < 100; i++ {
+		next := rw.nextPoll()
+		assert.True(t, next >= time.Minute && next < time.Minute+10*time.Second)
+	}
+}
+
+func TestPollTolerateConsecutiveErrors(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle:                       0,
+		BlocklistPollTolerateConsecutiveErrors: 1,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	var blockID uuid.UUID
+	for i := 0; i < 2; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		blockID = complete.BlockMeta().BlockID
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 2)
+
+	// a meta that can't be read leaves the listing incomplete
+	metaPath := path.Join(tempDir, "traces", testTenantID, blockID.String(), "meta.json")
+	meta, err := ioutil.ReadFile(metaPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(metaPath))
+	assert.NoError(t, os.Mkdir(metaPath, 0755))
+
+	// the previous blocklist is kept as long as the failures are tolerated
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 2)
+	assert.Equal(t, 1, rw.pollFailures[testTenantID])
+
+	// then the partial blocklist is used
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+	assert.Equal(t, 2, rw.pollFailures[testTenantID])
+
+	assert.NoError(t, os.Remove(metaPath))
+	err = ioutil.WriteFile(metaPath, meta, 0644)
+	assert.NoError(t, err)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 2)
+	assert.Equal(t, 0, rw.pollFailures[testTenantID])
+}
+
+func TestPollQuarantinesInvalidMeta(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	var blockIDs []uuid.UUID
+	for i := 0; i < 3; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		blockIDs = append(blockIDs, complete.BlockMeta().BlockID)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 3)
+	assert.Equal(t, 0.0, gaugeValue(t, metricBlocklistQuarantined.WithLabelValues(testTenantID)))
+
+	// one meta is truncated and another altered
+	metaPath := func(blockID uuid.UUID) string {
+		return path.Join(tempDir, "traces", testTenantID, blockID.String(), "meta.json")
+	}
+	meta, err := ioutil.ReadFile(metaPath(blockIDs[0]))
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(metaPath(blockIDs[0]), meta[:len(meta)/2], 0644))
+	meta, err = ioutil.ReadFile(metaPath(blockIDs[1]))
+	assert.NoError(t, err)
+	altered := bytes.Replace(meta, []byte(`"compactionLevel":0`), []byte(`"compactionLevel":1`), 1)
+	assert.NotEqual(t, meta, altered)
+	assert.NoError(t, ioutil.WriteFile(metaPath(blockIDs[1]), altered, 0644))
+
+	// the blocks are left out but the listing is complete
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+	assert.Equal(t, blockIDs[2], rw.blocklist(testTenantID)[0].BlockID)
+	assert.Equal(t, 0, rw.pollFailures[testTenantID])
+	assert.Equal(t, 2.0, gaugeValue(t, metricBlocklistQuarantined.WithLabelValues(testTenantID)))
+}
+
+func TestUpdateBlocklistMetrics(t *testing.T) {
+	tenantID := "metrics-tenant"
+	blocklist := []*encoding.BlockMeta{
+		{CompactionLevel: 0, Size: 10},
+		{CompactionLevel: 0, Size: 20},
+		{CompactionLevel: 1, Size: 30},
+	}
+	updateBlocklistMetrics(tenantID, nil, blocklist, nil)
+
+	assert.Equal(t, 3.0, gaugeValue(t, metricBlocklistLength.WithLabelValues(tenantID)))
+	assert.Equal(t, 60.0, gaugeValue(t, metricBlocklistBytes.WithLabelValues(tenantID)))
+	assert.Equal(t, 2.0, gaugeValue(t, metricBlocklistLengthByLevel.WithLabelValues(tenantID, "0")))
+	assert.Equal(t, 1.0, gaugeValue(t, metricBlocklistLengthByLevel.WithLabelValues(tenantID, "1")))
+
+	// level 0 is compacted away
+	updateBlocklistMetrics(tenantID, blocklist, []*encoding.BlockMeta{{CompactionLevel: 1, Size: 60}}, nil)
+	assert.Equal(t, 1.0, gaugeValue(t, metricBlocklistLength.WithLabelValues(tenantID)))
+	assert.Equal(t, 60.0, gaugeValue(t, metricBlocklistBytes.WithLabelValues(tenantID)))
+	assert.Equal(t, 0.0, gaugeValue(t, metricBlocklistLengthByLevel.WithLabelValues(tenantID, "0")))
+	assert.Equal(t, 1.0, gaugeValue(t, metricBlocklistLengthByLevel.WithLabelValues(tenantID, "1")))
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	assert.NoError(t, g.Write(m))
+	return m.GetGauge().GetValue()
+}
+
+func TestRetentionClearsQuarantined(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		BlocklistPollStaleTenantIndex: time.Hour,
+		MaintenanceCycle:              0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	// retention is owned but not the tenant index
+	sharder := &ownsSharder{owned: map[string]bool{retentionHash(testTenantID): true}}
+	c.EnableCompaction(&CompactorConfig{
+		BlockRetention:            time.Hour,
+		CompactedBlockRetention:   time.Hour,
+		QuarantinedBlockRetention: time.Hour,
+	}, sharder)
+
+	var blockIDs []uuid.UUID
+	for i := 0; i < 2; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		blockIDs = append(blockIDs, complete.BlockMeta().BlockID)
+	}
+
+	// an up to date index doesn't show the quarantined block, so the tenant is listed anyway
+	rw := r.(*readerWriter)
+	err = rw.w.WriteTenantIndex(context.Background(), testTenantID, nil, nil)
+	assert.NoError(t, err)
+
+	blockPath := path.Join(tempDir, "traces", testTenantID, blockIDs[0].String())
+	assert.NoError(t, ioutil.WriteFile(path.Join(blockPath, "meta.json"), []byte("{"), 0644))
+
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+	assert.Contains(t, rw.quarantined[testTenantID], blockIDs[0])
+
+	// the block is kept through the grace period
+	rw.doRetention()
+	_, err = os.Stat(blockPath)
+	assert.NoError(t, err)
+
+	// polling again doesn't restart it
+	since := rw.quarantined[testTenantID][blockIDs[0]]
+	rw.pollBlocklist()
+	assert.Equal(t, since, rw.quarantined[testTenantID][blockIDs[0]])
+
+	rw.quarantined[testTenantID][blockIDs[0]] = time.Now().Add(-2 * time.Hour)
+	rw.doRetention()
+	_, err = os.Stat(blockPath)
+	assert.True(t, os.IsNotExist(err))
+
+	rw.pollBlocklist()
+	assert.Empty(t, rw.quarantined[testTenantID])
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+}
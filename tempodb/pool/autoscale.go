@@ -0,0 +1,79 @@
+package pool
+
+import (
+	"time"
+)
+
+const defaultScaleInterval = time.Second
+
+// autoscaling is true if MaxWorkers is a ceiling and the number of workers follows the load
+func (p *Pool) autoscaling() bool {
+	return p.cfg.MinWorkers > 0
+}
+
+func (p *Pool) autoscale() {
+	interval := p.cfg.ScaleInterval
+	if interval <= 0 {
+		interval = defaultScaleInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.scale()
+			case <-p.shutdownCh:
+				return
+			}
+		}
+	}()
+}
+
+// scale adds enough workers to pick up every queued job once the queue has backed up behind busy
+// workers, and removes half of the idle workers once it is empty.  shrinking gradually keeps a
+// pool that sees regular bursts from repeatedly tearing down and starting workers.
+func (p *Pool) scale() {
+	p.scaleMtx.Lock()
+	defer p.scaleMtx.Unlock()
+
+	workers := p.workQueue.numWorkers()
+	queued := p.workQueue.length()
+	busy := int(p.busy.Load()) // borrowed workers run on the shared budget and aren't counted
+
+	target := workers
+	switch {
+	case queued > 0 && busy >= workers:
+		// jobs queued while workers are idle are held back by their tenant's cap.  more workers wouldn't
+		// run them so only a queue backed up behind busy workers counts
+		if oldest := p.workQueue.oldest(); !oldest.IsZero() && time.Since(oldest) < p.cfg.ScaleUpWait {
+			return
+		}
+		target = workers + queued
+	case queued == 0 && busy < workers:
+		target = workers - (workers-busy+1)/2
+	}
+
+	target = p.clampWorkers(target)
+	if target != workers {
+		p.resize(target, p.workQueue.capacity())
+	}
+}
+
+// clampWorkers keeps an autoscaled worker count between MinWorkers and the current ceiling
+func (p *Pool) clampWorkers(workers int) int {
+	max := int(p.maxWorkers.Load())
+	min := p.cfg.MinWorkers
+	if min > max {
+		min = max
+	}
+
+	if workers < min {
+		return min
+	}
+	if workers > max {
+		return max
+	}
+	return workers
+}
@@ -0,0 +1,71 @@
+package pool
+
+import (
+	"sync"
+)
+
+// Budget caps the number of jobs executing at once across every pool that shares it.  A pool's own
+// workers always take precedence.  When they are idle their share of the budget can be borrowed by
+// other pools with a backlog, up to each pool's MaxBorrowedWorkers.  Borrowed workers give the budget
+// back as soon as an owning worker needs it.
+type Budget struct {
+	mtx  sync.Mutex
+	cond *sync.Cond
+
+	limit   int
+	used    int
+	waiting int // owning workers blocked in acquire
+}
+
+// NewBudget creates a budget allowing at most limit jobs to execute at once
+func NewBudget(limit int) *Budget {
+	b := &Budget{
+		limit: limit,
+	}
+	b.cond = sync.NewCond(&b.mtx)
+
+	return b
+}
+
+// acquire blocks until the budget has room.  it is used by a pool's own workers.
+func (b *Budget) acquire() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.waiting++
+	for b.used >= b.limit {
+		b.cond.Wait()
+	}
+	b.waiting--
+	b.used++
+}
+
+// tryBorrow takes room in the budget for a borrowed worker.  it fails if the budget is full or any
+// owning worker is waiting.
+func (b *Budget) tryBorrow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.used >= b.limit || b.waiting > 0 {
+		return false
+	}
+
+	b.used++
+	return true
+}
+
+// contended returns true if an owning worker is waiting on the budget
+func (b *Budget) contended() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.waiting > 0
+}
+
+func (b *Budget) release() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.used--
+	b.cond.Signal()
+}
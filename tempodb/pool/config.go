@@ -1,6 +1,66 @@
 package pool
 
+import "time"
+
 type Config struct {
-	MaxWorkers int `yaml:"max_workers"`
-	QueueDepth int `yaml:"queue_depth"`
+	MaxWorkers int           `yaml:"max_workers"`
+	QueueDepth int           `yaml:"queue_depth"`
+	JobTimeout time.Duration `yaml:"job_timeout"`
+
+	// MinWorkers enables autoscaling.  The pool starts with MinWorkers and MaxWorkers becomes a ceiling:
+	// workers are added while jobs wait on busy workers and removed again once they sit idle.  0 disables
+	// and the pool always runs MaxWorkers.
+	MinWorkers int `yaml:"min_workers"`
+	// ScaleInterval is how often the autoscaler adjusts the number of workers.  Defaults to 1s.
+	ScaleInterval time.Duration `yaml:"scale_interval"`
+	// ScaleUpWait holds off adding workers until the oldest queued job has waited this long so short
+	// bursts are absorbed by the queue.  0 adds workers as soon as jobs are waiting.
+	ScaleUpWait time.Duration `yaml:"scale_up_wait"`
+
+	// failed jobs are retried with jittered exponential backoff up to MaxRetries times.  0 disables retries.
+	MaxRetries      int           `yaml:"max_retries"`
+	RetryMinBackoff time.Duration `yaml:"retry_min_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff"`
+
+	// OverflowPolicy determines what happens when a job is submitted to a full queue.  One of
+	// OverflowReject, OverflowBlock or OverflowShed.  Defaults to OverflowReject.
+	OverflowPolicy       string        `yaml:"overflow_policy"`
+	OverflowBlockTimeout time.Duration `yaml:"overflow_block_timeout"`
+
+	// MaxBorrowedWorkers is the number of extra workers the pool may run when its workers are busy and
+	// the shared Budget has room.  Only used by pools created from a Registry with a budget.
+	MaxBorrowedWorkers int `yaml:"max_borrowed_workers"`
+
+	// MaxOutstandingCost caps the total cost of all batches in flight.  Each payload costs 1 unless the
+	// batch sets WithCost.  When set it replaces the job count check against QueueDepth when admitting a
+	// batch.  0 disables.
+	MaxOutstandingCost int64 `yaml:"max_outstanding_cost"`
+
+	// EvictExpiredJobsPeriod is how often queued jobs whose caller has already gone away, e.g. the
+	// request deadline passed, are removed from the queue.  0 disables.  Such jobs are always skipped
+	// when they reach a worker but until then they take up room in the queue.
+	EvictExpiredJobsPeriod time.Duration `yaml:"evict_expired_jobs_period"`
+
+	// MaxCPUWorkers is the number of jobs that may be inside Pool.CPUBound at once.  MaxWorkers should be
+	// sized for IO latency and this for the cores available.  0 uses GOMAXPROCS.
+	MaxCPUWorkers int `yaml:"max_cpu_workers"`
+
+	// MaxWorkersPerTenant caps the jobs of a single tenant, as set by WithTenant, that may run at once so
+	// one tenant's block heavy query can't take every worker.  Jobs over the cap wait in the queue while
+	// other tenants' jobs run.  0 disables.
+	MaxWorkersPerTenant int `yaml:"max_workers_per_tenant"`
+
+	// MaxResultBytes fails any job that returns a []byte larger than this with ErrResultTooLarge.
+	// 0 disables.
+	MaxResultBytes int `yaml:"max_result_bytes"`
 }
+
+const (
+	// OverflowReject fails the batch immediately
+	OverflowReject = "reject"
+	// OverflowBlock waits up to OverflowBlockTimeout for room in the queue
+	OverflowBlock = "block"
+	// OverflowShed evicts the oldest queued low priority job to make room.  The evicted job fails with
+	// ErrJobShed.  If there are no low priority jobs to evict the batch fails as with OverflowReject.
+	OverflowShed = "shed"
+)
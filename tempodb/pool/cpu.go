@@ -0,0 +1,42 @@
+package pool
+
+import (
+	"context"
+	"runtime"
+)
+
+// cpuClass limits how many jobs may run CPU bound work at once.  Workers are sized for object store
+// latency so most of them are expected to be waiting on IO.  Without a separate limit the handful of
+// jobs parsing blooms or indexes at any moment could still be dozens, far more than there are cores.
+type cpuClass struct {
+	slots chan struct{}
+}
+
+func newCPUClass(maxWorkers int) *cpuClass {
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	return &cpuClass{
+		slots: make(chan struct{}, maxWorkers),
+	}
+}
+
+// CPUBound runs fn once one of the pool's MaxCPUWorkers slots is free.  Jobs should wrap CPU heavy
+// sections, e.g. decoding a bloom filter or searching an index, and leave backend reads outside so
+// they don't hold a slot while waiting on IO.  It returns ctx.Err() if ctx is done before a slot frees up.
+func (p *Pool) CPUBound(ctx context.Context, fn func() error) error {
+	select {
+	case p.cpu.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.metrics.cpuWorkersBusy.Inc()
+	defer func() {
+		p.metrics.cpuWorkersBusy.Dec()
+		<-p.cpu.slots
+	}()
+
+	return fn()
+}
@@ -0,0 +1,74 @@
+package pool
+
+import "fmt"
+
+// dedupEntry tracks the jobs waiting on an in flight job with the same dedup key
+type dedupEntry struct {
+	followers []*job
+}
+
+// follow attaches j to an in flight job with the same dedup key.  it returns false if there is none in
+// which case j becomes the leader and must be queued.
+func (p *Pool) follow(j *job) bool {
+	if j.dedupKey == "" {
+		return false
+	}
+
+	p.dedupMtx.Lock()
+	defer p.dedupMtx.Unlock()
+
+	if e, ok := p.dedup[j.dedupKey]; ok {
+		e.followers = append(e.followers, j)
+		p.metrics.jobsDeduplicated.Inc()
+		return true
+	}
+
+	p.dedup[j.dedupKey] = &dedupEntry{}
+	j.leader = true
+	return false
+}
+
+// resolveFollowers fans the leader's result out to every job waiting on it.  ran is the leader's payload if it
+// was run, nil otherwise.
+func (p *Pool) resolveFollowers(leader *job, ran interface{}, msg []byte, err error) {
+	if !leader.leader {
+		return
+	}
+
+	p.dedupMtx.Lock()
+	e := p.dedup[leader.dedupKey]
+	delete(p.dedup, leader.dedupKey)
+	p.dedupMtx.Unlock()
+
+	for _, f := range e.followers {
+		record(f, ran, msg, err)
+		f.batch.wg.Done()
+	}
+}
+
+// promoteFollower is called when a leader is skipped without running or its caller went away mid run.  its
+// followers still need the result so the first of them is queued in its place.
+func (p *Pool) promoteFollower(leader *job) {
+	if !leader.leader {
+		return
+	}
+
+	p.dedupMtx.Lock()
+	e := p.dedup[leader.dedupKey]
+	if len(e.followers) == 0 {
+		delete(p.dedup, leader.dedupKey)
+		p.dedupMtx.Unlock()
+		return
+	}
+	next := e.followers[0]
+	e.followers = e.followers[1:]
+	next.leader = true
+	p.dedupMtx.Unlock()
+
+	// queued like any other job so the overflow policy applies
+	p.size.Inc()
+	p.prioritySizes[next.priority].Inc()
+	if !p.enqueue(next.ctx, next) {
+		p.dropJob(next, fmt.Errorf("failed to add a job to work queue"))
+	}
+}
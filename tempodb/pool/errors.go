@@ -0,0 +1,49 @@
+package pool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// JobError is the failure of a single job in a batch.  Batches return every JobError they encounter in a
+// util.MultiError so callers can see exactly which payloads failed.
+type JobError struct {
+	TenantID string
+	Key      string // identifies the payload, e.g. a block id.  see WithPayloadKey
+	Err      error
+}
+
+func (e *JobError) Error() string {
+	var fields []string
+	if e.TenantID != "" {
+		fields = append(fields, "tenant="+e.TenantID)
+	}
+	if e.Key != "" {
+		fields = append(fields, "key="+e.Key)
+	}
+
+	if len(fields) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", strings.Join(fields, " "), e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+func newJobError(j *job, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	e := &JobError{
+		TenantID: j.tenantID,
+		Err:      err,
+	}
+	if j.keyFn != nil {
+		e.Key = j.keyFn(j.payload)
+	}
+
+	return e
+}
@@ -0,0 +1,165 @@
+package pool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricQueryQueueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_length",
+		Help:      "Current length of the work queue.",
+	}, []string{"pool"})
+
+	metricQueryQueuePriorityLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_priority_length",
+		Help:      "Current length of the work queue by priority.",
+	}, []string{"pool", "priority"})
+
+	metricQueryQueueMax = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_max",
+		Help:      "Maximum number of items in the work queue.",
+	}, []string{"pool"})
+
+	metricWorkers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_workers",
+		Help:      "Current number of workers pulling from the work queue.",
+	}, []string{"pool"})
+
+	metricJobTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_job_timeouts_total",
+		Help:      "Total number of jobs that exceeded the configured job timeout.",
+	}, []string{"pool"})
+
+	metricJobRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_job_retries_total",
+		Help:      "Total number of times a failed job was retried.",
+	}, []string{"pool"})
+
+	metricJobFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_job_failures_total",
+		Help:      "Total number of jobs that failed after exhausting all retries.",
+	}, []string{"pool"})
+
+	metricWorkerPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_worker_panics_total",
+		Help:      "Total number of panics recovered in pool workers.",
+	}, []string{"pool"})
+
+	metricJobWaitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_wait_duration_seconds",
+		Help:      "Time jobs spent in the work queue before being picked up by a worker.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 4, 6),
+	}, []string{"pool", "job_type"})
+
+	metricJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_job_duration_seconds",
+		Help:      "Time spent executing jobs including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 4, 6),
+	}, []string{"pool", "job_type"})
+
+	metricJobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_jobs_total",
+		Help:      "Total number of jobs processed by outcome.",
+	}, []string{"pool", "job_type", "outcome"})
+
+	metricJobsShed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_jobs_shed_total",
+		Help:      "Total number of queued jobs evicted from a full work queue.",
+	}, []string{"pool"})
+
+	metricJobsDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_jobs_deduplicated_total",
+		Help:      "Total number of jobs that shared the result of an identical in flight job.",
+	}, []string{"pool"})
+
+	metricQueueOldestAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_oldest_job_age_seconds",
+		Help:      "Age of the oldest job in the work queue.",
+	}, []string{"pool"})
+
+	metricJobsEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_jobs_evicted_total",
+		Help:      "Total number of queued jobs evicted because their caller had gone away.",
+	}, []string{"pool"})
+
+	metricCPUWorkersBusy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_cpu_workers_busy",
+		Help:      "Current number of jobs running CPU bound work.",
+	}, []string{"pool"})
+
+	metricResultsTooLarge = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_results_too_large_total",
+		Help:      "Total number of job results dropped for exceeding the max result size.",
+	}, []string{"pool"})
+
+	metricOutstandingCost = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "work_queue_outstanding_cost",
+		Help:      "Total cost of the batches currently admitted to the pool.",
+	}, []string{"pool"})
+)
+
+// poolMetrics are the package metrics curried with the name of a single pool
+type poolMetrics struct {
+	queueLength         prometheus.Gauge
+	queuePriorityLength *prometheus.GaugeVec
+	queueMax            prometheus.Gauge
+	workers             prometheus.Gauge
+	jobTimeouts         prometheus.Counter
+	jobRetries          prometheus.Counter
+	jobFailures         prometheus.Counter
+	workerPanics        prometheus.Counter
+	jobWaitDuration     prometheus.ObserverVec
+	jobDuration         prometheus.ObserverVec
+	jobsTotal           *prometheus.CounterVec
+	jobsShed            prometheus.Counter
+	jobsDeduplicated    prometheus.Counter
+	outstandingCost     prometheus.Gauge
+	queueOldestAge      prometheus.Gauge
+	jobsEvicted         prometheus.Counter
+	cpuWorkersBusy      prometheus.Gauge
+	resultsTooLarge     prometheus.Counter
+}
+
+func newPoolMetrics(name string) *poolMetrics {
+	labels := prometheus.Labels{"pool": name}
+
+	return &poolMetrics{
+		queueLength:         metricQueryQueueLength.With(labels),
+		queuePriorityLength: metricQueryQueuePriorityLength.MustCurryWith(labels),
+		queueMax:            metricQueryQueueMax.With(labels),
+		workers:             metricWorkers.With(labels),
+		jobTimeouts:         metricJobTimeouts.With(labels),
+		jobRetries:          metricJobRetries.With(labels),
+		jobFailures:         metricJobFailures.With(labels),
+		workerPanics:        metricWorkerPanics.With(labels),
+		jobWaitDuration:     metricJobWaitDuration.MustCurryWith(labels),
+		jobDuration:         metricJobDuration.MustCurryWith(labels),
+		jobsTotal:           metricJobsTotal.MustCurryWith(labels),
+		jobsShed:            metricJobsShed.With(labels),
+		jobsDeduplicated:    metricJobsDeduplicated.With(labels),
+		outstandingCost:     metricOutstandingCost.With(labels),
+		queueOldestAge:      metricQueueOldestAge.With(labels),
+		jobsEvicted:         metricJobsEvicted.With(labels),
+		cpuWorkersBusy:      metricCPUWorkersBusy.With(labels),
+		resultsTooLarge:     metricResultsTooLarge.With(labels),
+	}
+}
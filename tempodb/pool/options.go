@@ -0,0 +1,153 @@
+package pool
+
+// Priority determines which jobs a worker will pick up first.  Workers always drain higher priority
+// jobs before looking at lower priority ones.
+type Priority int
+
+const (
+	// PriorityHigh is for user facing work such as trace by id lookups
+	PriorityHigh Priority = iota
+	// PriorityLow is for background work such as blocklist polling and retention
+	PriorityLow
+
+	numPriorities = 2
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	}
+	return "unknown"
+}
+
+// Option configures a single call to RunJobs
+type Option func(*runOptions)
+
+type runOptions struct {
+	priority Priority
+	tenantID string
+	jobType  string
+	keyFn    func(payload interface{}) string
+
+	dedupKeyFn func(payload interface{}) string
+
+	stopOnFirstResult *bool // nil uses the default of the method running the batch
+
+	costFn func(payload interface{}) int64
+
+	doneFn func(payload, ran interface{}, err error)
+}
+
+// DefaultJobType is used to label metrics for batches that don't set WithJobType
+const DefaultJobType = "other"
+
+// WithPriority sets the priority of all jobs in the batch.  Defaults to PriorityHigh.
+func WithPriority(p Priority) Option {
+	return func(o *runOptions) {
+		o.priority = p
+	}
+}
+
+// WithTenant identifies the tenant the batch is being run on behalf of.  Jobs of the same priority are
+// scheduled round robin across tenants so one tenant can't monopolize the pool.
+func WithTenant(tenantID string) Option {
+	return func(o *runOptions) {
+		o.tenantID = tenantID
+	}
+}
+
+// WithJobType labels the batch's latency and outcome metrics, e.g. "trace_by_id" or "poll_blocklist".
+// Keep the set of job types small as each one is a metric label value.
+func WithJobType(jobType string) Option {
+	return func(o *runOptions) {
+		o.jobType = jobType
+	}
+}
+
+// WithPayloadKey sets a function that identifies a payload, e.g. by block id.  The key is included in the
+// JobError of any job that fails.
+func WithPayloadKey(keyFn func(payload interface{}) string) Option {
+	return func(o *runOptions) {
+		o.keyFn = keyFn
+	}
+}
+
+// WithDedupKey sets a function that returns a key identifying the work a payload represents.  If a job
+// with the same key is already queued or running, in this batch or any other, the payload is not queued
+// again and instead receives the result of the in flight job.  Jobs with the same key must be
+// interchangeable.  An empty key disables deduplication for that payload.
+func WithDedupKey(keyFn func(payload interface{}) string) Option {
+	return func(o *runOptions) {
+		o.dedupKeyFn = keyFn
+	}
+}
+
+// WithStopOnFirstResult controls whether jobs that haven't started are skipped once any job returns a
+// result.  RunJobs defaults to true which suits lookups like trace by id.  RunAllJobs and RunJobsStream
+// default to false which suits aggregations like search that need every result.
+func WithStopOnFirstResult(stop bool) Option {
+	return func(o *runOptions) {
+		o.stopOnFirstResult = &stop
+	}
+}
+
+// WithCost sets a function that estimates the cost of a payload, e.g. the bytes it will scan.  Batches are
+// admitted based on the total cost of their payloads when MaxOutstandingCost is configured.
+func WithCost(costFn func(payload interface{}) int64) Option {
+	return func(o *runOptions) {
+		o.costFn = costFn
+	}
+}
+
+// WithJobDone sets a function that is called once for every payload whose job completes, successfully or
+// not.  ran is the payload fn was called with: the payload itself, the payload of the in flight job it was
+// deduplicated onto or nil if fn never ran, e.g. the job was shed.  Payloads skipped after the batch stopped
+// are not reported.  It lets the caller account for work done on its behalf by another batch's job.  Calls
+// are serialized but made from the pool's workers, so fn must not block.
+func WithJobDone(doneFn func(payload, ran interface{}, err error)) Option {
+	return func(o *runOptions) {
+		o.doneFn = doneFn
+	}
+}
+
+func (o *runOptions) cost(payloads []interface{}) int64 {
+	var total int64
+	for _, payload := range payloads {
+		total += o.payloadCost(payload)
+	}
+	return total
+}
+
+func (o *runOptions) payloadCost(payload interface{}) int64 {
+	if o.costFn == nil {
+		return 1
+	}
+	return o.costFn(payload)
+}
+
+func (o *runOptions) stopOnFirst(def bool) bool {
+	if o.stopOnFirstResult == nil {
+		return def
+	}
+	return *o.stopOnFirstResult
+}
+
+func newRunOptions(opts []Option) *runOptions {
+	o := &runOptions{
+		priority: PriorityHigh,
+		jobType:  DefaultJobType,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.priority < 0 || o.priority >= numPriorities {
+		o.priority = PriorityLow
+	}
+
+	return o
+}
@@ -3,30 +3,47 @@ package pool
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	cortex_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	ot_log "github.com/opentracing/opentracing-go/log"
 	"github.com/uber-go/atomic"
+
+	"github.com/grafana/tempo/pkg/util"
 )
 
 const (
 	queueLengthReportDuration = 15 * time.Second
+
+	// DefaultName is the name used to label the metrics of pools created with NewPool
+	DefaultName = "default"
 )
 
-var (
-	metricQueryQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
-		Namespace: "tempodb",
-		Name:      "work_queue_length",
-		Help:      "Current length of the work queue.",
-	})
+const (
+	outcomeSuccess   = "success"
+	outcomeFailure   = "failure"
+	outcomeCancelled = "cancelled"
+)
 
-	metricQueryQueueMax = promauto.NewGauge(prometheus.GaugeOpts{
-		Namespace: "tempodb",
-		Name:      "work_queue_max",
-		Help:      "Maximum number of items in the work queue.",
-	})
+var (
+	// ErrJobTimeout is returned for any job that runs longer than the configured job timeout
+	ErrJobTimeout = fmt.Errorf("job exceeded timeout")
+	// ErrPoolShutdown is returned for any batch submitted after the pool started draining or shutting down
+	// and for any queued job that was dropped during shutdown
+	ErrPoolShutdown = fmt.Errorf("pool is shut down")
+	// ErrJobPanic is returned for any job that panicked
+	ErrJobPanic = fmt.Errorf("job panicked")
+	// ErrJobShed is returned for any queued job that was evicted to make room for newer work
+	ErrJobShed = fmt.Errorf("job shed from full work queue")
+	// ErrCostLimit is returned for any batch whose cost doesn't fit in the outstanding cost budget
+	ErrCostLimit = fmt.Errorf("batch exceeds outstanding cost limit")
+	// ErrResultTooLarge is returned for any job whose result exceeds MaxResultBytes
+	ErrResultTooLarge = fmt.Errorf("job result exceeds max result size")
 )
 
 type JobFunc func(ctx context.Context, payload interface{}) ([]byte, error)
@@ -35,123 +52,593 @@ type job struct {
 	ctx     context.Context
 	cancel  context.CancelFunc
 	payload interface{}
+	index   int
 	fn      JobFunc
 
-	wg        *sync.WaitGroup
-	resultsCh chan []byte
-	stop      *atomic.Bool
-	err       *atomic.Error
+	priority Priority
+	tenantID string
+	jobType  string
+	keyFn    func(payload interface{}) string
+	enqueued time.Time
+
+	dedupKey string // optional. jobs with the same key share a single execution
+	leader   bool   // this job executes on behalf of all others with its dedup key
+
+	batch *batch
 }
 
-type Pool struct {
-	cfg  *Config
-	size *atomic.Int32
+// batch is shared by all jobs submitted in a single call to RunJobs or RunAllJobs
+type batch struct {
+	stopOnFirstResult bool
+	onResult          func([]byte) // optional. called with every non-nil result as soon as it's available
+
+	// optional. called as each payload completes, see WithJobDone
+	onDone func(payload, ran interface{}, err error)
+
+	partial    bool          // admit what fits instead of failing the batch when the queue is full
+	unadmitted []interface{} // payloads that were not queued in a partial batch
 
-	workQueue  chan *job
-	shutdownCh chan struct{}
+	wg   sync.WaitGroup // way to wait for all jobs to complete
+	stop *atomic.Bool   // way to signal to the jobs to quit
+
+	mtx     sync.Mutex
+	first   []byte          // first non-nil result returned
+	results [][]byte        // results by payload index
+	errs    util.MultiError // a *JobError for every failed job
+}
+
+type Pool struct {
+	name          string
+	cfg           *Config
+	metrics       *poolMetrics
+	size          *atomic.Int32
+	prioritySizes [numPriorities]*atomic.Int32
+
+	workQueue    *jobQueue
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+
+	// scaleMtx serializes changes to the number of workers between Reconfigure and the autoscaler
+	scaleMtx   sync.Mutex
+	maxWorkers *atomic.Int32 // the worker count, or with autoscaling the ceiling, last set by Reconfigure
+
+	budget   *Budget       // optional. shared with other pools
+	cpu      *cpuClass     // limits concurrent CPU bound work. see CPUBound
+	busy     *atomic.Int32 // the pool's own workers currently running a job
+	borrowed *atomic.Int32 // borrowed workers currently running
+
+	dedupMtx sync.Mutex
+	dedup    map[string]*dedupEntry // in flight jobs by dedup key
+
+	costMtx         sync.Mutex
+	outstandingCost int64
+
+	// batchMtx guards closed so no batch can be added to the inflight WaitGroup once Drain is waiting on it
+	batchMtx sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
 }
 
+// NewPool creates a pool named DefaultName
 func NewPool(cfg *Config) *Pool {
+	return NewNamedPool(DefaultName, cfg)
+}
+
+// NewNamedPool creates a pool whose metrics are labelled with name.  Pools that are used for different
+// purposes, e.g. queries and compaction, should be given different names.  See Registry.
+func NewNamedPool(name string, cfg *Config) *Pool {
+	return newPool(name, cfg, nil)
+}
+
+func newPool(name string, cfg *Config, budget *Budget) *Pool {
 	if cfg == nil {
 		cfg = defaultConfig()
 	}
 
-	q := make(chan *job, cfg.QueueDepth)
 	p := &Pool{
+		name:       name,
 		cfg:        cfg,
-		workQueue:  q,
+		metrics:    newPoolMetrics(name),
+		budget:     budget,
+		cpu:        newCPUClass(cfg.MaxCPUWorkers),
+		busy:       atomic.NewInt32(0),
+		borrowed:   atomic.NewInt32(0),
+		dedup:      make(map[string]*dedupEntry),
 		size:       atomic.NewInt32(0),
+		maxWorkers: atomic.NewInt32(0),
+		workQueue:  newJobQueue(cfg.QueueDepth, cfg.MaxWorkersPerTenant),
 		shutdownCh: make(chan struct{}),
 	}
 
-	for i := 0; i < cfg.MaxWorkers; i++ {
-		go p.worker(q)
+	for i := range p.prioritySizes {
+		p.prioritySizes[i] = atomic.NewInt32(0)
 	}
 
+	p.Reconfigure(cfg.MaxWorkers, cfg.QueueDepth)
 	p.reportQueueLength()
-
-	metricQueryQueueMax.Set(float64(cfg.QueueDepth))
+	if cfg.EvictExpiredJobsPeriod > 0 {
+		p.evictExpiredJobs()
+	}
+	if p.autoscaling() {
+		p.autoscale()
+	}
 
 	return p
 }
 
-func (p *Pool) RunJobs(ctx context.Context, payloads []interface{}, fn JobFunc) ([]byte, error) {
+// Reconfigure changes the number of workers and the depth of the queue.  Queued and in flight jobs are
+// not affected.  Excess workers exit once they finish their current job and a queue shrunk below its
+// current length only rejects new jobs.  Values <= 0 restore the value the pool was created with.  With
+// autoscaling maxWorkers is the new ceiling and the current workers are only trimmed to fit under it.
+func (p *Pool) Reconfigure(maxWorkers, queueDepth int) {
+	if maxWorkers <= 0 {
+		maxWorkers = p.cfg.MaxWorkers
+	}
+	if queueDepth <= 0 {
+		queueDepth = p.cfg.QueueDepth
+	}
+
+	p.scaleMtx.Lock()
+	defer p.scaleMtx.Unlock()
+
+	p.maxWorkers.Store(int32(maxWorkers))
+	workers := maxWorkers
+	if p.autoscaling() {
+		workers = p.clampWorkers(p.workQueue.numWorkers())
+	}
+	p.resize(workers, queueDepth)
+
+	p.metrics.queueMax.Set(float64(queueDepth))
+}
+
+// resize sets the number of workers and the depth of the queue.  scaleMtx must be held.
+func (p *Pool) resize(workers, queueDepth int) {
+	for i := p.workQueue.resize(workers, queueDepth); i > 0; i-- {
+		go p.worker()
+	}
+
+	p.metrics.workers.Set(float64(workers))
+}
+
+// Name returns the name the pool's metrics are labelled with
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// RunJobs runs fn once for every payload, scheduled according to opts, and returns the first non-nil
+// result.  Once a result is found any jobs that have not started are skipped unless
+// WithStopOnFirstResult(false) is passed.  If no result is found every job failure is returned as a
+// *JobError in a util.MultiError.
+func (p *Pool) RunJobs(ctx context.Context, payloads []interface{}, fn JobFunc, opts ...Option) ([]byte, error) {
+	o := newRunOptions(opts)
+	b := newBatch(len(payloads), o.stopOnFirst(true))
+	err := p.run(ctx, b, payloads, fn, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// ignore err if msg != nil.  otherwise errors like "context cancelled"
+	//  will take precedence over the err
+	if b.first != nil {
+		return b.first, nil
+	}
+
+	if len(b.errs) > 0 {
+		return nil, b.errs
+	}
+
+	// if the caller's context was cancelled then jobs were likely skipped.  report that instead of "not found"
+	return nil, ctx.Err()
+}
+
+// RunAllJobs runs fn once for every payload and returns every non-nil result in payload order along with
+// all errors encountered.  Unlike RunJobs it does not stop on the first result.
+func (p *Pool) RunAllJobs(ctx context.Context, payloads []interface{}, fn JobFunc, opts ...Option) ([][]byte, error) {
+	o := newRunOptions(opts)
+	b := newBatch(len(payloads), o.stopOnFirst(false))
+	err := p.run(ctx, b, payloads, fn, o)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]byte, 0, len(b.results))
+	for _, r := range b.results {
+		if r != nil {
+			results = append(results, r)
+		}
+	}
+
+	// jobs are skipped once the caller's context is cancelled so the results are incomplete
+	b.errs.Add(ctx.Err())
+
+	return results, b.errs.Err()
+}
+
+// RunJobsStream runs fn once for every payload like RunAllJobs but sends every non-nil result on the
+// returned channel as soon as it is available so callers can start merging before all jobs complete.  Both
+// channels are closed once all jobs are done.  At most one error is sent and it contains every error
+// encountered.  Results are buffered so the caller is not required to drain the results channel.
+func (p *Pool) RunJobsStream(ctx context.Context, payloads []interface{}, fn JobFunc, opts ...Option) (<-chan []byte, <-chan error) {
+	resultsCh := make(chan []byte, len(payloads))
+	errCh := make(chan error, 1)
+
+	o := newRunOptions(opts)
+	b := newBatch(len(payloads), o.stopOnFirst(false))
+	b.onResult = func(msg []byte) {
+		resultsCh <- msg
+	}
+
+	go func() {
+		defer close(resultsCh)
+		defer close(errCh)
+
+		err := p.run(ctx, b, payloads, fn, o)
+		if err == nil {
+			b.errs.Add(ctx.Err())
+			err = b.errs.Err()
+		}
+		if err != nil {
+			errCh <- err
+		}
+	}()
+
+	return resultsCh, errCh
+}
+
+// RunJobsPartial runs fn for as many payloads as fit in the work queue and returns the results like
+// RunAllJobs.  Instead of failing the whole batch when the queue fills up the payloads that could not be
+// queued are returned, in order, so the caller can run them some other way, e.g. sequentially.  The
+// unadmitted payloads are not reflected in the returned error.
+func (p *Pool) RunJobsPartial(ctx context.Context, payloads []interface{}, fn JobFunc, opts ...Option) ([][]byte, []interface{}, error) {
+	o := newRunOptions(opts)
+	b := newBatch(len(payloads), o.stopOnFirst(false))
+	b.partial = true
+	err := p.run(ctx, b, payloads, fn, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := make([][]byte, 0, len(b.results))
+	for _, r := range b.results {
+		if r != nil {
+			results = append(results, r)
+		}
+	}
+
+	b.errs.Add(ctx.Err())
+
+	return results, b.unadmitted, b.errs.Err()
+}
+
+func newBatch(totalJobs int, stopOnFirstResult bool) *batch {
+	return &batch{
+		stopOnFirstResult: stopOnFirstResult,
+		stop:              atomic.NewBool(false),
+		results:           make([][]byte, totalJobs),
+	}
+}
+
+// run queues a job for every payload in the batch and waits for them all to complete
+func (p *Pool) run(ctx context.Context, b *batch, payloads []interface{}, fn JobFunc, o *runOptions) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	totalJobs := len(payloads)
+	b.onDone = o.doneFn
 
-	// sanity check before we even attempt to start adding jobs
-	if int(p.size.Load())+totalJobs > p.cfg.QueueDepth {
-		return nil, fmt.Errorf("queue doesn't have room for %d jobs", len(payloads))
+	// no sense queueing work for a caller that has already gone away
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	resultsCh := make(chan []byte, 1) // way for jobs to send back results
-	err := atomic.NewError(nil)       // way for jobs to send back an error
-	stop := atomic.NewBool(false)     // way to signal to the jobs to quit
-	wg := &sync.WaitGroup{}           // way to wait for all jobs to complete
+	if !p.startBatch() {
+		return ErrPoolShutdown
+	}
+	defer p.inflight.Done()
+
+	admit := payloads
+	if p.cfg.MaxOutstandingCost > 0 && b.partial {
+		var cost int64
+		admit, cost = p.admitCostPrefix(payloads, o)
+		defer p.releaseCost(cost)
+	} else if p.cfg.MaxOutstandingCost > 0 {
+		cost := o.cost(payloads)
+		if !p.admitCost(cost) {
+			return fmt.Errorf("%w: cost %d, outstanding %d, limit %d", ErrCostLimit, cost, p.currentCost(), p.cfg.MaxOutstandingCost)
+		}
+		defer p.releaseCost(cost)
+	} else if !b.partial && p.overflowPolicy() == OverflowReject && int(p.size.Load())+len(payloads) > p.workQueue.capacity() {
+		// sanity check before we even attempt to start adding jobs.  only the reject policy fails fast
+		return fmt.Errorf("queue doesn't have room for %d jobs", len(payloads))
+	}
 
 	// add each job one at a time.  even though we checked length above these might still fail
-	for _, payload := range payloads {
-		wg.Add(1)
+	for i, payload := range admit {
+		b.wg.Add(1)
 		j := &job{
-			ctx:       ctx,
-			cancel:    cancel,
-			fn:        fn,
-			payload:   payload,
-			wg:        wg,
-			resultsCh: resultsCh,
-			stop:      stop,
-			err:       err,
+			ctx:      ctx,
+			cancel:   cancel,
+			fn:       fn,
+			payload:  payload,
+			index:    i,
+			batch:    b,
+			priority: o.priority,
+			tenantID: o.tenantID,
+			jobType:  o.jobType,
+			keyFn:    o.keyFn,
+			enqueued: time.Now(),
+		}
+		if o.dedupKeyFn != nil {
+			j.dedupKey = o.dedupKeyFn(payload)
 		}
 
-		select {
-		case p.workQueue <- j:
-			p.size.Inc()
-		default:
-			wg.Done()
-			stop.Store(true)
-			return nil, fmt.Errorf("failed to add a job to work queue")
+		// an identical job is already in flight.  share its result
+		if p.follow(j) {
+			continue
+		}
+
+		// increment first so the counts can't go negative if a worker picks up the job immediately
+		p.size.Inc()
+		p.prioritySizes[o.priority].Inc()
+		if !p.enqueue(ctx, j) {
+			p.size.Dec()
+			p.prioritySizes[o.priority].Dec()
+			p.resolveFollowers(j, nil, nil, fmt.Errorf("failed to add a job to work queue"))
+			b.wg.Done()
+			if b.partial {
+				admit = admit[:i]
+				break
+			}
+			b.stop.Store(true)
+			// jobs already queued will be skipped.  wait on them so none touch the batch after we return
+			b.wg.Wait()
+			return fmt.Errorf("failed to add a job to work queue")
 		}
 	}
 
+	if len(admit) < len(payloads) {
+		b.unadmitted = payloads[len(admit):]
+	}
+
 	// wait for all jobs to finish
-	wg.Wait()
+	b.wg.Wait()
 
-	// see if anything ended up in the results channel
-	var msg []byte
-	select {
-	case msg = <-resultsCh:
-	default:
+	return nil
+}
+
+// admitCost reserves cost in the outstanding cost budget.  a batch is always admitted if nothing else is
+// outstanding so a single expensive query can still run on an idle pool.
+func (p *Pool) admitCost(cost int64) bool {
+	p.costMtx.Lock()
+	defer p.costMtx.Unlock()
+
+	if p.outstandingCost > 0 && p.outstandingCost+cost > p.cfg.MaxOutstandingCost {
+		return false
 	}
 
-	// ignore err if msg != nil.  otherwise errors like "context cancelled"
-	//  will take precedence over the err
-	if msg != nil {
-		return msg, nil
+	p.outstandingCost += cost
+	p.metrics.outstandingCost.Set(float64(p.outstandingCost))
+	return true
+}
+
+// admitCostPrefix reserves cost for the longest prefix of payloads that fits in the outstanding cost
+// budget.  it returns the prefix and the cost reserved.
+func (p *Pool) admitCostPrefix(payloads []interface{}, o *runOptions) ([]interface{}, int64) {
+	p.costMtx.Lock()
+	defer p.costMtx.Unlock()
+
+	var total int64
+	n := 0
+	for _, payload := range payloads {
+		cost := o.payloadCost(payload)
+		if p.outstandingCost+total > 0 && p.outstandingCost+total+cost > p.cfg.MaxOutstandingCost {
+			break
+		}
+		total += cost
+		n++
+	}
+
+	p.outstandingCost += total
+	p.metrics.outstandingCost.Set(float64(p.outstandingCost))
+	return payloads[:n], total
+}
+
+func (p *Pool) releaseCost(cost int64) {
+	p.costMtx.Lock()
+	defer p.costMtx.Unlock()
+
+	p.outstandingCost -= cost
+	p.metrics.outstandingCost.Set(float64(p.outstandingCost))
+}
+
+func (p *Pool) currentCost() int64 {
+	p.costMtx.Lock()
+	defer p.costMtx.Unlock()
+
+	return p.outstandingCost
+}
+
+// enqueue adds the job to the work queue according to the configured overflow policy
+func (p *Pool) enqueue(ctx context.Context, j *job) bool {
+	if !p.push(ctx, j) {
+		return false
+	}
+
+	p.maybeBorrow()
+	return true
+}
+
+func (p *Pool) push(ctx context.Context, j *job) bool {
+	switch p.overflowPolicy() {
+	case OverflowBlock:
+		return p.workQueue.pushWait(ctx, j, p.cfg.OverflowBlockTimeout)
+	case OverflowShed:
+		evicted, ok := p.workQueue.pushShed(j)
+		if evicted != nil {
+			p.metrics.jobsShed.Inc()
+			p.dropJob(evicted, ErrJobShed)
+		}
+		return ok
+	}
+
+	return p.workQueue.push(j)
+}
+
+// maybeBorrow starts a borrowed worker if all of the pool's workers are busy and the shared budget has room
+func (p *Pool) maybeBorrow() {
+	if p.budget == nil || int(p.borrowed.Load()) >= p.cfg.MaxBorrowedWorkers {
+		return
+	}
+
+	if int(p.busy.Load()) < p.workQueue.numWorkers() || p.workQueue.length() == 0 {
+		return
+	}
+
+	if !p.budget.tryBorrow() {
+		return
 	}
 
-	return nil, err.Load()
+	p.borrowed.Inc()
+	go p.borrowedWorker()
 }
 
+// borrowedWorker runs jobs until the queue is empty or an owning worker somewhere needs the budget back
+func (p *Pool) borrowedWorker() {
+	defer func() {
+		p.borrowed.Dec()
+		p.budget.release()
+	}()
+
+	for !p.budget.contended() {
+		j, ok := p.workQueue.tryPop()
+		if !ok {
+			return
+		}
+		p.runJob(j)
+	}
+}
+
+func (p *Pool) overflowPolicy() string {
+	switch p.cfg.OverflowPolicy {
+	case OverflowBlock, OverflowShed:
+		return p.cfg.OverflowPolicy
+	}
+	return OverflowReject
+}
+
+// Drain stops accepting new batches and waits for all in flight batches to complete before shutting
+// down the workers.  If ctx expires first the pool is shut down anyway, any jobs still queued fail with
+// ErrPoolShutdown, and ctx.Err() is returned.
+func (p *Pool) Drain(ctx context.Context) error {
+	p.stopBatches()
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	p.Shutdown()
+	return err
+}
+
+// Shutdown stops the workers immediately.  Queued jobs are dropped and fail with ErrPoolShutdown.  Use
+// Drain to wait for in flight work.
 func (p *Pool) Shutdown() {
-	close(p.workQueue)
-	close(p.shutdownCh)
+	p.shutdownOnce.Do(func() {
+		p.stopBatches()
+
+		for _, j := range p.workQueue.close() {
+			p.dropJob(j, ErrPoolShutdown)
+		}
+		close(p.shutdownCh)
+	})
+}
+
+// startBatch registers an in flight batch.  it returns false if the pool is no longer accepting work.
+func (p *Pool) startBatch() bool {
+	p.batchMtx.RLock()
+	defer p.batchMtx.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	p.inflight.Add(1)
+	return true
+}
+
+func (p *Pool) stopBatches() {
+	p.batchMtx.Lock()
+	defer p.batchMtx.Unlock()
+
+	p.closed = true
+}
+
+// dropJob completes a job that will never be run so its caller isn't left waiting.  jobs sharing its
+// dedup key fail with it.
+func (p *Pool) dropJob(j *job, err error) {
+	p.completeDropped(j, err)
+	p.resolveFollowers(j, nil, nil, err)
 }
 
-func (p *Pool) worker(j <-chan *job) {
+func (p *Pool) completeDropped(j *job, err error) {
+	record(j, nil, nil, err)
+
+	j.batch.wg.Done()
+	p.size.Dec()
+	p.prioritySizes[j.priority].Dec()
+	p.metrics.jobsTotal.WithLabelValues(j.jobType, outcomeCancelled).Inc()
+}
+
+func (p *Pool) worker() {
+	// jobs are recovered individually.  this protects the pool itself from shrinking due to a bug outside the job
+	defer func() {
+		if r := recover(); r != nil {
+			p.metrics.workerPanics.Inc()
+			level.Error(cortex_util.Logger).Log("msg", "pool worker panicked. restarting", "panic", r, "stack", string(debug.Stack()))
+			go p.worker()
+		}
+	}()
+
 	for {
-		select {
-		case <-p.shutdownCh:
+		j, ok := p.workQueue.pop()
+		if !ok {
 			return
-		case j, ok := <-j:
-			if !ok {
-				return
-			}
-			runJob(j)
-			p.size.Dec()
 		}
+		p.runOwnedJob(j)
+	}
+}
+
+// runOwnedJob runs a job on one of the pool's own workers.  these take precedence over borrowed workers
+// for room in the shared budget.
+func (p *Pool) runOwnedJob(j *job) {
+	if p.budget != nil {
+		p.budget.acquire()
+		defer p.budget.release()
 	}
+
+	p.busy.Inc()
+	defer p.busy.Dec()
+
+	p.runJob(j)
+}
+
+func (p *Pool) runJob(j *job) {
+	p.maybeBorrow()
+	defer func() {
+		p.workQueue.done(j)
+		p.size.Dec()
+		p.prioritySizes[j.priority].Dec()
+	}()
+
+	p.execute(j)
 }
 
 func (p *Pool) reportQueueLength() {
@@ -161,7 +648,31 @@ func (p *Pool) reportQueueLength() {
 		for {
 			select {
 			case <-ticker.C:
-				metricQueryQueueLength.Set(float64(p.size.Load()))
+				p.metrics.queueLength.Set(float64(p.size.Load()))
+				for i, size := range p.prioritySizes {
+					p.metrics.queuePriorityLength.WithLabelValues(Priority(i).String()).Set(float64(size.Load()))
+				}
+
+				age := time.Duration(0)
+				if oldest := p.workQueue.oldest(); !oldest.IsZero() {
+					age = time.Since(oldest)
+				}
+				p.metrics.queueOldestAge.Set(age.Seconds())
+			case <-p.shutdownCh:
+				return
+			}
+		}
+	}()
+}
+
+func (p *Pool) evictExpiredJobs() {
+	ticker := time.NewTicker(p.cfg.EvictExpiredJobsPeriod)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.evictExpired()
 			case <-p.shutdownCh:
 				return
 			}
@@ -169,29 +680,209 @@ func (p *Pool) reportQueueLength() {
 	}()
 }
 
-func runJob(job *job) {
-	defer job.wg.Done()
+// evictExpired removes queued jobs whose caller has gone away
+func (p *Pool) evictExpired() {
+	expired := p.workQueue.removeIf(func(j *job) bool {
+		return j.ctx.Err() != nil
+	})
+
+	for _, j := range expired {
+		p.metrics.jobsEvicted.Inc()
+		// the caller is gone so this error is likely never seen, but report why the job didn't run
+		p.completeDropped(j, j.ctx.Err())
+		// other callers may still be waiting on the job through its dedup key
+		p.promoteFollower(j)
+	}
+}
+
+func (p *Pool) execute(job *job) {
+	b := job.batch
+	defer b.wg.Done()
+
+	p.metrics.jobWaitDuration.WithLabelValues(job.jobType).Observe(time.Since(job.enqueued).Seconds())
 
-	if job.stop.Load() {
+	// the job is no longer needed or the caller has gone away (client disconnect, deadline exceeded).
+	// skip the job instead of burning a worker on it
+	if b.stop.Load() || job.ctx.Err() != nil {
+		p.metrics.jobsTotal.WithLabelValues(job.jobType, outcomeCancelled).Inc()
+		p.promoteFollower(job)
 		return
 	}
 
-	msg, err := job.fn(job.ctx, job.payload)
-	if msg != nil {
-		job.stop.Store(true) // one job was successful.  stop all others
+	// the job runs on another goroutine.  continue the caller's trace so work done by the job shows up
+	// as children of the original request
+	span, ctx := opentracing.StartSpanFromContext(job.ctx, "pool.Job")
+	span.SetTag("pool", p.name)
+	span.SetTag("job_type", job.jobType)
+	span.SetTag("tenant", job.tenantID)
+	span.LogFields(ot_log.String("queue_wait", time.Since(job.enqueued).String()))
+	if job.keyFn != nil {
+		span.SetTag("key", job.keyFn(job.payload))
+	}
+	job.ctx = ctx
+
+	start := time.Now()
+	msg, err := p.callJob(job)
+	if err == nil {
+		msg, err = p.checkResultSize(msg)
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(ot_log.Error(err))
+	}
+	span.Finish()
+	p.metrics.jobDuration.WithLabelValues(job.jobType).Observe(time.Since(start).Seconds())
+	p.metrics.jobsTotal.WithLabelValues(job.jobType, jobOutcome(job, err)).Inc()
+
+	record(job, job.payload, msg, err)
+
+	// the leader's caller went away mid run so its result is likely just the cancellation.  followers from
+	// other batches are still waiting on it so one of them runs the job in its place
+	if job.ctx.Err() != nil {
+		p.promoteFollower(job)
+		return
+	}
+	p.resolveFollowers(job, job.payload, msg, err)
+}
+
+// checkResultSize drops results larger than MaxResultBytes.  a corrupt block can claim an object of
+// several GB and we'd rather fail the job than hold that in memory until the batch completes.
+func (p *Pool) checkResultSize(msg []byte) ([]byte, error) {
+	if p.cfg.MaxResultBytes <= 0 {
+		return msg, nil
+	}
+
+	if len(msg) > p.cfg.MaxResultBytes {
+		p.metrics.resultsTooLarge.Inc()
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrResultTooLarge, len(msg), p.cfg.MaxResultBytes)
+	}
+
+	return msg, nil
+}
+
+// record stores the result of a job in its batch.  ran is the payload fn was called with to produce the
+// result, nil if it never ran.
+func record(job *job, ran interface{}, msg []byte, err error) {
+	b := job.batch
+
+	if msg != nil && b.stopOnFirstResult {
+		b.stop.Store(true) // one job was successful.  stop all others
 		// Commenting out job cancellations for now because of a resource leak suspected in the GCS golang client.
 		// Issue logged here: https://github.com/googleapis/google-cloud-go/issues/3018
 		// job.cancel()
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if msg != nil {
+		b.results[job.index] = msg
+		if b.first == nil {
+			b.first = msg
+		}
+		if b.onResult != nil {
+			b.onResult(msg)
+		}
+	}
+	if b.onDone != nil {
+		b.onDone(job.payload, ran, err)
+	}
+	b.errs.Add(newJobError(job, err))
+}
+
+func jobOutcome(job *job, err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case job.ctx.Err() != nil:
+		return outcomeCancelled
+	}
+	return outcomeFailure
+}
+
+// callJob executes the job retrying with backoff on failure if configured.  the worker is held while
+// backing off.
+func (p *Pool) callJob(j *job) ([]byte, error) {
+	msg, err := p.callJobWithTimeout(j, p.cfg.JobTimeout)
+	if err == nil || p.cfg.MaxRetries <= 0 {
+		return msg, err
+	}
+
+	backoff := cortex_util.NewBackoff(j.ctx, cortex_util.BackoffConfig{
+		MinBackoff: p.cfg.RetryMinBackoff,
+		MaxBackoff: p.cfg.RetryMaxBackoff,
+		MaxRetries: p.cfg.MaxRetries,
+	})
+	for retries := 0; err != nil && retries < p.cfg.MaxRetries; retries++ {
 		select {
-		case job.resultsCh <- msg:
-		default: // if we hit default it means that something else already returned a good result.  /shrug
+		case <-time.After(backoff.NextDelay()):
+		case <-j.ctx.Done():
+			return msg, err
 		}
+
+		// another job already found the result
+		if j.batch.stop.Load() {
+			break
+		}
+
+		p.metrics.jobRetries.Inc()
+		msg, err = p.callJobWithTimeout(j, p.cfg.JobTimeout)
 	}
-	if err != nil {
-		job.err.Store(err)
+
+	if err != nil && j.ctx.Err() == nil {
+		p.metrics.jobFailures.Inc()
+	}
+
+	return msg, err
+}
+
+// callJobWithTimeout executes the job.  if a timeout is set the worker is released once it expires even if the
+// job doesn't respect context cancellation.
+func (p *Pool) callJobWithTimeout(job *job, timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		return p.safeCall(job.ctx, job)
+	}
+
+	ctx, cancel := context.WithTimeout(job.ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		msg []byte
+		err error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		msg, err := p.safeCall(ctx, job)
+		resultCh <- result{msg, err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		return r.msg, r.err
+	case <-ctx.Done():
+		// only count it as a timeout if the caller didn't cancel first
+		if job.ctx.Err() != nil {
+			return nil, job.ctx.Err()
+		}
+		p.metrics.jobTimeouts.Inc()
+		return nil, fmt.Errorf("%w after %v", ErrJobTimeout, timeout)
 	}
 }
 
+// safeCall executes the job converting a panic into an error so a bad job can't take down the process
+func (p *Pool) safeCall(ctx context.Context, job *job) (msg []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.metrics.workerPanics.Inc()
+			level.Error(cortex_util.Logger).Log("msg", "pool job panicked", "tenant", job.tenantID, "panic", r, "stack", string(debug.Stack()))
+			msg = nil
+			err = fmt.Errorf("%w: %v", ErrJobPanic, r)
+		}
+	}()
+
+	return job.fn(ctx, job.payload)
+}
+
 // default is concurrency disabled
 func defaultConfig() *Config {
 	return &Config{
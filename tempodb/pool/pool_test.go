@@ -2,14 +2,21 @@ package pool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/atomic"
 	"go.uber.org/goleak"
+
+	"github.com/grafana/tempo/pkg/util"
 )
 
 func TestResults(t *testing.T) {
@@ -108,9 +115,16 @@ func TestError(t *testing.T) {
 	}
 	payloads := []interface{}{1, 2, 3, 4, 5}
 
-	msg, err := p.RunJobs(context.Background(), payloads, fn)
+	msg, err := p.RunJobs(context.Background(), payloads, fn, WithTenant("test"), WithPayloadKey(func(payload interface{}) string {
+		return fmt.Sprintf("block-%d", payload.(int))
+	}))
 	assert.Nil(t, msg)
-	assert.Equal(t, ret, err)
+	assert.True(t, errors.Is(err, ret))
+	assert.EqualError(t, err, "tenant=test key=block-3: blerg")
+
+	var jobErr *JobError
+	assert.True(t, errors.As(err, &jobErr))
+	assert.Equal(t, &JobError{TenantID: "test", Key: "block-3", Err: ret}, jobErr)
 	goleak.VerifyNone(t, opts)
 
 	p.Shutdown()
@@ -134,7 +148,8 @@ func TestMultipleErrors(t *testing.T) {
 
 	msg, err := p.RunJobs(context.Background(), payloads, fn)
 	assert.Nil(t, msg)
-	assert.Equal(t, ret, err)
+	assert.True(t, errors.Is(err, ret))
+	assert.Len(t, err.(util.MultiError), 5)
 	goleak.VerifyNone(t, opts)
 
 	p.Shutdown()
@@ -292,3 +307,1628 @@ func TestShutdown(t *testing.T) {
 	assert.Error(t, err)
 	goleak.VerifyNone(t, opts)
 }
+
+func TestCancellation(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	calls := atomic.NewInt32(0)
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if calls.Inc() == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+		return nil, nil
+	}
+	payloads := []interface{}{1, 2, 3, 4, 5}
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	msg, err := p.RunJobs(ctx, payloads, fn)
+	assert.Nil(t, msg)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, int32(1), calls.Load())
+	goleak.VerifyNone(t, opts)
+
+	// a cancelled context should not queue anything
+	msg, err = p.RunJobs(ctx, payloads, fn)
+	assert.Nil(t, msg)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, int32(1), calls.Load())
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestPriority(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	// occupy the only worker so everything else queues up behind it
+	blocking := make(chan struct{})
+	started := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = p.RunJobs(context.Background(), []interface{}{0}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+			close(started)
+			<-blocking
+			return nil, nil
+		}, WithPriority(PriorityLow))
+	}()
+	<-started
+
+	mtx := sync.Mutex{}
+	order := []Priority{}
+	run := func(priority Priority) {
+		defer wg.Done()
+		_, _ = p.RunJobs(context.Background(), []interface{}{1, 2}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+			mtx.Lock()
+			order = append(order, priority)
+			mtx.Unlock()
+			return nil, nil
+		}, WithPriority(priority))
+	}
+
+	// the blocking job counts against the low priority queue until it completes
+	wg.Add(1)
+	go run(PriorityLow)
+	assert.Eventually(t, func() bool { return p.prioritySizes[PriorityLow].Load() == 3 }, time.Second, 10*time.Millisecond)
+	wg.Add(1)
+	go run(PriorityHigh)
+	assert.Eventually(t, func() bool { return p.prioritySizes[PriorityHigh].Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	close(blocking)
+	wg.Wait()
+
+	assert.Equal(t, []Priority{PriorityHigh, PriorityHigh, PriorityLow, PriorityLow}, order)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestTenantFairness(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	// occupy the only worker so everything else queues up behind it
+	blocking := make(chan struct{})
+	started := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = p.RunJobs(context.Background(), []interface{}{0}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+			close(started)
+			<-blocking
+			return nil, nil
+		})
+	}()
+	<-started
+
+	mtx := sync.Mutex{}
+	order := []string{}
+	run := func(tenantID string, payloads []interface{}) {
+		defer wg.Done()
+		_, _ = p.RunJobs(context.Background(), payloads, func(ctx context.Context, payload interface{}) ([]byte, error) {
+			mtx.Lock()
+			order = append(order, tenantID)
+			mtx.Unlock()
+			return nil, nil
+		}, WithTenant(tenantID))
+	}
+
+	wg.Add(1)
+	go run("a", []interface{}{1, 2, 3, 4})
+	assert.Eventually(t, func() bool { return p.size.Load() == 5 }, time.Second, 10*time.Millisecond)
+	wg.Add(1)
+	go run("b", []interface{}{1, 2})
+	assert.Eventually(t, func() bool { return p.size.Load() == 7 }, time.Second, 10*time.Millisecond)
+
+	close(blocking)
+	wg.Wait()
+
+	assert.Equal(t, []string{"a", "b", "a", "b", "a", "a"}, order)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestMaxWorkersPerTenant(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:          3,
+		QueueDepth:          10,
+		MaxWorkersPerTenant: 1,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	running := atomic.NewInt32(0)
+	maxRunning := atomic.NewInt32(0)
+	blocking := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	// tenant a has more jobs than workers but may only run one at a time
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{1, 2, 3, 4}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+			n := running.Inc()
+			defer running.Dec()
+			if n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			<-blocking
+			return nil, nil
+		}, WithTenant("a"))
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// tenant b still gets a worker while a's jobs are stuck
+	_, err := p.RunAllJobs(context.Background(), []interface{}{1, 2}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+		return nil, nil
+	}, WithTenant("b"))
+	assert.NoError(t, err)
+
+	// jobs without a tenant are not limited
+	_, err = p.RunAllJobs(context.Background(), []interface{}{1, 2}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	close(blocking)
+	wg.Wait()
+	assert.Equal(t, int32(1), maxRunning.Load())
+	assert.Eventually(t, func() bool {
+		p.workQueue.mtx.Lock()
+		defer p.workQueue.mtx.Unlock()
+		return len(p.workQueue.running) == 0
+	}, time.Second, 10*time.Millisecond)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestRunAllJobs(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 3,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	ret := fmt.Errorf("blerg")
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		i := payload.(int)
+
+		switch i {
+		case 2, 4:
+			return []byte{byte(i)}, nil
+		case 3, 5:
+			return nil, ret
+		}
+		return nil, nil
+	}
+	payloads := []interface{}{1, 2, 3, 4, 5}
+
+	results, err := p.RunAllJobs(context.Background(), payloads, fn)
+	assert.Equal(t, [][]byte{{0x02}, {0x04}}, results)
+	assert.Error(t, err)
+	assert.Len(t, err.(util.MultiError), 2)
+
+	results, err = p.RunAllJobs(context.Background(), payloads[:2], fn)
+	assert.Equal(t, [][]byte{{0x02}}, results)
+	assert.NoError(t, err)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestJobTimeout(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+		JobTimeout: 50 * time.Millisecond,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		i := payload.(int)
+
+		if i == 1 {
+			<-ctx.Done()
+			return nil, nil
+		}
+		return []byte{0x01}, nil
+	}
+
+	msg, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+	assert.Nil(t, msg)
+	assert.True(t, errors.Is(err, ErrJobTimeout))
+
+	// the hung job should not hold on to the only worker
+	msg, err = p.RunJobs(context.Background(), []interface{}{1, 2}, fn)
+	assert.Equal(t, []byte{0x01}, msg)
+	assert.NoError(t, err)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestDrain(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release
+		return []byte{0x01}, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		msg, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		assert.Equal(t, []byte{0x01}, msg)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	drainErr := make(chan error)
+	go func() {
+		drainErr <- p.Drain(context.Background())
+	}()
+
+	// new batches are rejected while draining
+	assert.Eventually(t, func() bool {
+		_, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		return errors.Is(err, ErrPoolShutdown)
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	assert.NoError(t, <-drainErr)
+	wg.Wait()
+
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// the second job is still queued when the drain times out and is dropped
+		msg, err := p.RunJobs(context.Background(), []interface{}{1, 2}, fn)
+		assert.Nil(t, msg)
+		assert.True(t, errors.Is(err, ErrPoolShutdown))
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Drain(ctx))
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(0), p.size.Load())
+
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestRetries(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:      1,
+		QueueDepth:      10,
+		MaxRetries:      2,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: 5 * time.Millisecond,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	// fails twice before succeeding
+	attempts := atomic.NewInt32(0)
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if attempts.Inc() <= 2 {
+			return nil, fmt.Errorf("transient")
+		}
+		return []byte{0x01}, nil
+	}
+
+	msg, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, msg)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	// permanently failing job gives up after MaxRetries
+	attempts.Store(0)
+	fn = func(ctx context.Context, payload interface{}) ([]byte, error) {
+		attempts.Inc()
+		return nil, fmt.Errorf("permanent")
+	}
+
+	msg, err = p.RunJobs(context.Background(), []interface{}{1}, fn)
+	assert.EqualError(t, err, "permanent")
+	assert.Nil(t, msg)
+	assert.Equal(t, int32(3), attempts.Load())
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestRunJobsStream(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	release := make(chan struct{})
+	ret := fmt.Errorf("blerg")
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		i := payload.(int)
+
+		switch i {
+		case 1:
+			return []byte{0x01}, nil
+		case 2:
+			<-release
+			return []byte{0x02}, nil
+		}
+		return nil, ret
+	}
+
+	resultsCh, errCh := p.RunJobsStream(context.Background(), []interface{}{1, 2, 3}, fn)
+
+	// the first result is available while the second job is still running
+	assert.Equal(t, []byte{0x01}, <-resultsCh)
+	close(release)
+	assert.Equal(t, []byte{0x02}, <-resultsCh)
+
+	_, ok := <-resultsCh
+	assert.False(t, ok)
+	assert.EqualError(t, <-errCh, "blerg")
+	_, ok = <-errCh
+	assert.False(t, ok)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	for _, timeout := range []time.Duration{0, time.Second} {
+		p := NewPool(&Config{
+			MaxWorkers: 1,
+			QueueDepth: 10,
+			JobTimeout: timeout,
+		})
+
+		fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+			if payload.(int) == 1 {
+				panic("oops")
+			}
+			return []byte{0x01}, nil
+		}
+
+		msg, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		assert.Nil(t, msg)
+		assert.True(t, errors.Is(err, ErrJobPanic))
+
+		// the only worker survived
+		msg, err = p.RunJobs(context.Background(), []interface{}{2}, fn)
+		assert.Equal(t, []byte{0x01}, msg)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), p.size.Load())
+
+		p.Shutdown()
+	}
+
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestJobTypeMetrics(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		switch payload.(int) {
+		case 1:
+			return []byte{0x01}, nil
+		case 2:
+			return nil, fmt.Errorf("blerg")
+		}
+		return nil, nil
+	}
+
+	success := p.metrics.jobsTotal.WithLabelValues("test", outcomeSuccess)
+	failure := p.metrics.jobsTotal.WithLabelValues("test", outcomeFailure)
+	cancelled := p.metrics.jobsTotal.WithLabelValues("test", outcomeCancelled)
+	startSuccess, startFailure, startCancelled := counterValue(t, success), counterValue(t, failure), counterValue(t, cancelled)
+
+	_, _ = p.RunAllJobs(context.Background(), []interface{}{1, 2, 3}, fn, WithJobType("test"))
+	assert.Equal(t, 2.0, counterValue(t, success)-startSuccess)
+	assert.Equal(t, 1.0, counterValue(t, failure)-startFailure)
+
+	// once the first result is found the rest are skipped
+	_, _ = p.RunJobs(context.Background(), []interface{}{1, 3, 3}, fn, WithJobType("test"))
+	assert.Equal(t, 3.0, counterValue(t, success)-startSuccess)
+	assert.Equal(t, 2.0, counterValue(t, cancelled)-startCancelled)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	assert.NoError(t, c.Write(m))
+	return m.GetCounter().GetValue()
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	assert.NoError(t, g.Write(m))
+	return m.GetGauge().GetValue()
+}
+
+func TestOverflowBlock(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:           1,
+		QueueDepth:           1,
+		OverflowPolicy:       OverflowBlock,
+		OverflowBlockTimeout: time.Second,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if payload.(int) == 1 {
+			<-release
+		}
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// the second job waits for room in the queue instead of failing
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	_, err := p.RunJobs(context.Background(), []interface{}{2, 3}, fn)
+	assert.NoError(t, err)
+	wg.Wait()
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestOverflowBlockTimeout(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:           1,
+		QueueDepth:           1,
+		OverflowPolicy:       OverflowBlock,
+		OverflowBlockTimeout: 50 * time.Millisecond,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{2, 3}, fn)
+		assert.EqualError(t, err, "failed to add a job to work queue")
+	}()
+
+	// let the second batch time out before freeing the worker
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestOverflowShed(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:     1,
+		QueueDepth:     1,
+		OverflowPolicy: OverflowShed,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if payload.(int) == 1 {
+			<-release
+		}
+		return []byte{0x01}, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{2}, fn, WithPriority(PriorityLow))
+		assert.True(t, errors.Is(err, ErrJobShed))
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	// the queued low priority job is evicted to make room
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	msg, err := p.RunJobs(context.Background(), []interface{}{3}, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, msg)
+
+	// nothing left to shed
+	_, err = p.RunJobs(context.Background(), []interface{}{1, 3}, fn)
+	assert.Error(t, err)
+
+	wg.Wait()
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestRegistry(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	r := NewRegistry()
+	query := r.Pool("query", &Config{MaxWorkers: 1, QueueDepth: 10})
+	compaction := r.Pool("compaction", &Config{MaxWorkers: 1, QueueDepth: 10})
+
+	assert.NotSame(t, query, compaction)
+	assert.Same(t, query, r.Pool("query", nil))
+	assert.Same(t, compaction, r.Get("compaction"))
+	assert.Nil(t, r.Get("search"))
+	assert.Equal(t, "query", query.Name())
+
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		return []byte{0x01}, nil
+	}
+
+	// each pool reports its own metrics
+	queryJobs := query.metrics.jobsTotal.WithLabelValues(DefaultJobType, outcomeSuccess)
+	compactionJobs := compaction.metrics.jobsTotal.WithLabelValues(DefaultJobType, outcomeSuccess)
+	startQuery, startCompaction := counterValue(t, queryJobs), counterValue(t, compactionJobs)
+
+	_, err := query.RunJobs(context.Background(), []interface{}{1}, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, counterValue(t, queryJobs)-startQuery)
+	assert.Equal(t, 0.0, counterValue(t, compactionJobs)-startCompaction)
+
+	assert.NoError(t, r.Drain(context.Background()))
+	_, err = compaction.RunJobs(context.Background(), []interface{}{1}, fn)
+	assert.Equal(t, ErrPoolShutdown, err)
+
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestReconfigure(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 1,
+	})
+
+	running := atomic.NewInt32(0)
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		running.Inc()
+		defer running.Dec()
+		<-release
+		return nil, nil
+	}
+
+	// too many jobs for the current queue
+	_, err := p.RunJobs(context.Background(), []interface{}{1, 2, 3}, fn)
+	assert.Error(t, err)
+
+	// grow and all jobs run concurrently
+	p.Reconfigure(3, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{1, 2, 3}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return running.Load() == 3 }, time.Second, 10*time.Millisecond)
+
+	// shrink.  in flight jobs finish and then only one worker remains
+	p.Reconfigure(1, 10)
+	close(release)
+	wg.Wait()
+
+	release = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{1, 2, 3}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), running.Load())
+	assert.Equal(t, int32(3), p.size.Load())
+
+	close(release)
+	wg.Wait()
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestAutoscale(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	// the interval is long enough that the test drives the autoscaler itself
+	p := NewPool(&Config{
+		MaxWorkers:    4,
+		MinWorkers:    1,
+		QueueDepth:    10,
+		ScaleInterval: time.Hour,
+	})
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+	assert.Equal(t, 1.0, gaugeValue(t, p.metrics.workers))
+
+	running := atomic.NewInt32(0)
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		running.Inc()
+		defer running.Dec()
+		<-release
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{1, 2, 3, 4, 5}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return running.Load() == 1 && p.workQueue.length() == 4 }, time.Second, 10*time.Millisecond)
+
+	// jobs are backed up behind the only worker.  grow up to the ceiling
+	p.scale()
+	assert.Equal(t, 4, p.workQueue.numWorkers())
+	assert.Equal(t, 4.0, gaugeValue(t, p.metrics.workers))
+	assert.Eventually(t, func() bool { return running.Load() == 4 }, time.Second, 10*time.Millisecond)
+
+	// a lower ceiling trims the workers.  in flight jobs finish first
+	p.Reconfigure(2, 10)
+	assert.Equal(t, 2, p.workQueue.numWorkers())
+	close(release)
+	wg.Wait()
+
+	// idle workers are removed gradually down to the minimum
+	assert.Eventually(t, func() bool { return p.busy.Load() == 0 }, time.Second, 10*time.Millisecond)
+	p.scale()
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+	p.scale()
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+	assert.Equal(t, 1.0, gaugeValue(t, p.metrics.workers))
+
+	// restoring the configured ceiling doesn't start workers until they are needed
+	p.Reconfigure(0, 0)
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestAutoscaleWait(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:    4,
+		MinWorkers:    1,
+		QueueDepth:    10,
+		ScaleInterval: time.Hour,
+		ScaleUpWait:   100 * time.Millisecond,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{1, 2, 3}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.busy.Load() == 1 && p.workQueue.length() == 2 }, time.Second, 10*time.Millisecond)
+
+	// the queued jobs haven't waited long enough yet
+	p.scale()
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+
+	time.Sleep(100 * time.Millisecond)
+	p.scale()
+	assert.Equal(t, 3, p.workQueue.numWorkers())
+
+	close(release)
+	wg.Wait()
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestAutoscaleBorrowed(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	r := NewRegistryWithBudget(NewBudget(4))
+	p := r.Pool("query", &Config{
+		MaxWorkers:         2,
+		MinWorkers:         1,
+		QueueDepth:         10,
+		ScaleInterval:      time.Hour,
+		MaxBorrowedWorkers: 2,
+	})
+
+	release := map[int]chan struct{}{}
+	for i := 1; i <= 4; i++ {
+		release[i] = make(chan struct{})
+	}
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release[payload.(int)]
+		return nil, nil
+	}
+
+	// the only worker and two borrowed workers are running a job each
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{1, 2, 3}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.busy.Load() == 1 && p.borrowed.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	// borrowed workers don't count as the pool's own, so nothing changes while the queue is empty
+	p.scale()
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+
+	// a job queued behind them adds a worker of the pool's own
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{4}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.workQueue.length() == 1 }, time.Second, 10*time.Millisecond)
+	p.scale()
+	assert.Equal(t, 2, p.workQueue.numWorkers())
+	assert.Eventually(t, func() bool { return p.busy.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	// once it finishes the pool's idle worker is removed even though the borrowed workers are still busy
+	close(release[4])
+	assert.Eventually(t, func() bool { return p.busy.Load() == 1 }, time.Second, 10*time.Millisecond)
+	p.scale()
+	assert.Equal(t, 1, p.workQueue.numWorkers())
+
+	for i := 1; i <= 3; i++ {
+		close(release[i])
+	}
+	wg.Wait()
+
+	r.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestStaticWorkers(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	// without MinWorkers the pool always runs MaxWorkers
+	p := NewPool(&Config{
+		MaxWorkers: 3,
+		QueueDepth: 10,
+	})
+	assert.Equal(t, 3, p.workQueue.numWorkers())
+	assert.Equal(t, 3.0, gaugeValue(t, p.metrics.workers))
+
+	p.Reconfigure(5, 0)
+	assert.Equal(t, 5, p.workQueue.numWorkers())
+	assert.Equal(t, 5.0, gaugeValue(t, p.metrics.workers))
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestBudget(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	r := NewRegistryWithBudget(NewBudget(4))
+	query := r.Pool("query", &Config{MaxWorkers: 2, QueueDepth: 10, MaxBorrowedWorkers: 2})
+	compaction := r.Pool("compaction", &Config{MaxWorkers: 2, QueueDepth: 10})
+
+	running := atomic.NewInt32(0)
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		running.Inc()
+		defer running.Dec()
+		<-release
+		return nil, nil
+	}
+
+	// compaction is idle so query borrows its share of the budget
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := query.RunJobs(context.Background(), []interface{}{1, 2, 3, 4, 5}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return running.Load() == 4 }, time.Second, 10*time.Millisecond)
+
+	// the hard cap holds
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(4), running.Load())
+	assert.Equal(t, int32(2), query.borrowed.Load())
+
+	// compaction work takes precedence once the borrowed workers finish their current job
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := compaction.RunJobs(context.Background(), []interface{}{1}, func(ctx context.Context, payload interface{}) ([]byte, error) {
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	}()
+
+	close(release)
+	wg.Wait()
+	assert.Eventually(t, func() bool { return query.borrowed.Load() == 0 }, time.Second, 10*time.Millisecond)
+
+	r.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestDedup(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 2,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	calls := atomic.NewInt32(0)
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		calls.Inc()
+		<-release
+		return []byte(payload.(string)), nil
+	}
+	dedup := WithDedupKey(func(payload interface{}) string {
+		return payload.(string)
+	})
+
+	// two batches fetching the same blocks share a single execution per block
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := p.RunAllJobs(context.Background(), []interface{}{"a", "b"}, fn, dedup)
+			assert.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, results)
+		}()
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), calls.Load())
+
+	// the dedup key is released once the job completes
+	results, err := p.RunAllJobs(context.Background(), []interface{}{"a"}, fn, dedup)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a")}, results)
+	assert.Equal(t, int32(3), calls.Load())
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestJobDone(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 2,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	type payload struct{ key string }
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+	dedup := WithDedupKey(func(p interface{}) string {
+		return p.(*payload).key
+	})
+
+	// each batch hears about its own payload.  the follower's ran with the leader's
+	leader, follower := &payload{key: "a"}, &payload{key: "a"}
+	var leaderRan, followerRan interface{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{leader}, fn, dedup, WithJobDone(func(payload, ran interface{}, err error) {
+			assert.Same(t, leader, payload)
+			leaderRan = ran
+		}))
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunAllJobs(context.Background(), []interface{}{follower}, fn, dedup, WithJobDone(func(payload, ran interface{}, err error) {
+			assert.Same(t, follower, payload)
+			followerRan = ran
+		}))
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	assert.Same(t, leader, leaderRan)
+	assert.Same(t, leader, followerRan)
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestDedupSkippedLeader(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if payload.(string) == "block" {
+			<-release
+		}
+		return []byte(payload.(string)), nil
+	}
+	dedup := WithDedupKey(func(payload interface{}) string {
+		return payload.(string)
+	})
+
+	// occupy the only worker
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{"block"}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// the leader's caller goes away while it is queued
+	ctx, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(ctx, []interface{}{"a"}, fn, dedup)
+		assert.Equal(t, context.Canceled, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	// the follower still gets a result
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		msg, err := p.RunJobs(context.Background(), []interface{}{"a"}, fn, dedup)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("a"), msg)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	close(release)
+	wg.Wait()
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestTracePropagation(t *testing.T) {
+	tracer := &recordingTracer{}
+	prevTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prevTracer)
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	defer p.Shutdown()
+
+	parent, ctx := opentracing.StartSpanFromContext(context.Background(), "parent")
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		// work done by the job is a child of the job span
+		span, _ := opentracing.StartSpanFromContext(ctx, "backend.read")
+		span.Finish()
+		return nil, nil
+	}
+
+	_, err := p.RunJobs(ctx, []interface{}{1}, fn, WithJobType("test"))
+	assert.NoError(t, err)
+	parent.Finish()
+
+	spans := tracer.byName()
+	assert.Len(t, spans, 3)
+	assert.Same(t, spans["parent"], spans["pool.Job"].parent)
+	assert.Same(t, spans["pool.Job"], spans["backend.read"].parent)
+	assert.Equal(t, "test", spans["pool.Job"].tags["job_type"])
+}
+
+// recordingTracer records the parent of every span started
+type recordingTracer struct {
+	opentracing.NoopTracer
+
+	mtx   sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	opentracing.Span
+
+	tracer *recordingTracer
+	name   string
+	parent *recordingSpan
+	tags   map[string]interface{}
+}
+
+func (t *recordingTracer) StartSpan(name string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	sso := opentracing.StartSpanOptions{}
+	for _, o := range opts {
+		o.Apply(&sso)
+	}
+
+	span := &recordingSpan{
+		Span:   opentracing.NoopTracer{}.StartSpan(name),
+		tracer: t,
+		name:   name,
+		tags:   map[string]interface{}{},
+	}
+	for _, ref := range sso.References {
+		if parent, ok := ref.ReferencedContext.(*recordingSpan); ok {
+			span.parent = parent
+		}
+	}
+
+	t.mtx.Lock()
+	t.spans = append(t.spans, span)
+	t.mtx.Unlock()
+
+	return span
+}
+
+func (t *recordingTracer) byName() map[string]*recordingSpan {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	spans := map[string]*recordingSpan{}
+	for _, s := range t.spans {
+		spans[s.name] = s
+	}
+	return spans
+}
+
+func (s *recordingSpan) Context() opentracing.SpanContext          { return s }
+func (s *recordingSpan) Tracer() opentracing.Tracer                { return s.tracer }
+func (s *recordingSpan) ForeachBaggageItem(func(k, v string) bool) {}
+
+func (s *recordingSpan) SetTag(key string, value interface{}) opentracing.Span {
+	s.tracer.mtx.Lock()
+	defer s.tracer.mtx.Unlock()
+
+	s.tags[key] = value
+	return s
+}
+
+func TestStopOnFirstResult(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	calls := atomic.NewInt32(0)
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		calls.Inc()
+		return []byte{byte(payload.(int))}, nil
+	}
+	payloads := []interface{}{1, 2, 3}
+
+	// default for RunJobs is to skip the rest
+	msg, err := p.RunJobs(context.Background(), payloads, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, msg)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	msg, err = p.RunJobs(context.Background(), payloads, fn, WithStopOnFirstResult(false))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, msg)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// and RunAllJobs can opt in
+	calls.Store(0)
+	results, err := p.RunAllJobs(context.Background(), payloads, fn, WithStopOnFirstResult(true))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{{0x01}}, results)
+	assert.Equal(t, int32(1), calls.Load())
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestCostAdmission(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:         1,
+		QueueDepth:         20,
+		MaxOutstandingCost: 100,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if payload.(int) == 90 {
+			<-release
+		}
+		return nil, nil
+	}
+	cost := WithCost(func(payload interface{}) int64 {
+		return int64(payload.(int))
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// a single batch over the limit is admitted on an idle pool
+		_, err := p.RunJobs(context.Background(), []interface{}{90, 20}, fn, cost)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.currentCost() == 110 }, time.Second, 10*time.Millisecond)
+
+	// 3 huge blocks are rejected
+	_, err := p.RunJobs(context.Background(), []interface{}{50, 50, 50}, fn, cost)
+	assert.True(t, errors.Is(err, ErrCostLimit))
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(0), p.currentCost())
+
+	// while 10 tiny blocks are admitted even though they are more jobs
+	_, err = p.RunJobs(context.Background(), []interface{}{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, fn, cost)
+	assert.NoError(t, err)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestEvictExpiredJobs(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:             1,
+		QueueDepth:             10,
+		EvictExpiredJobsPeriod: 10 * time.Millisecond,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{1}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 1 }, time.Second, 10*time.Millisecond)
+	assert.True(t, p.workQueue.oldest().IsZero())
+
+	// the queued jobs are evicted once the deadline passes without waiting for the worker
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		assert.False(t, p.workQueue.oldest().IsZero())
+	}()
+	_, err := p.RunJobs(ctx, []interface{}{1, 2, 3}, fn)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, int32(1), p.size.Load())
+	assert.True(t, p.workQueue.oldest().IsZero())
+
+	close(release)
+	wg.Wait()
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestRunJobsPartial(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 1,
+		QueueDepth: 3,
+	})
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		if payload.(int) == -1 {
+			<-release
+			return nil, nil
+		}
+		return []byte{byte(payload.(int))}, nil
+	}
+
+	// occupy the only worker
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{-1}, fn)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.busy.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// only 3 of the 5 jobs fit in the queue
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results, unadmitted, err := p.RunJobsPartial(context.Background(), []interface{}{0, 1, 2, 3, 4}, fn)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{{0}, {1}, {2}}, results)
+		assert.Equal(t, []interface{}{3, 4}, unadmitted)
+	}()
+	assert.Eventually(t, func() bool { return p.workQueue.length() == 3 }, time.Second, 10*time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	// everything is admitted once there is room
+	results, unadmitted, err := p.RunJobsPartial(context.Background(), []interface{}{0, 1}, fn)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Empty(t, unadmitted)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestCPUBound(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:    10,
+		QueueDepth:    10,
+		MaxCPUWorkers: 2,
+	})
+
+	running := atomic.NewInt32(0)
+	maxRunning := atomic.NewInt32(0)
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		// io bound work is not limited
+		time.Sleep(10 * time.Millisecond)
+
+		err := p.CPUBound(ctx, func() error {
+			n := running.Inc()
+			defer running.Dec()
+			for {
+				max := maxRunning.Load()
+				if n <= max || maxRunning.CAS(max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		return nil, err
+	}
+
+	payloads := make([]interface{}, 10)
+	_, err := p.RunAllJobs(context.Background(), payloads, fn)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), maxRunning.Load())
+
+	// waiting for a slot gives up with the caller
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			_ = p.CPUBound(context.Background(), func() error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	assert.Eventually(t, func() bool { return len(p.cpu.slots) == 2 }, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = p.CPUBound(ctx, func() error { return nil })
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Eventually(t, func() bool { return len(p.cpu.slots) == 0 }, time.Second, 10*time.Millisecond)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestMaxResultBytes(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:     1,
+		QueueDepth:     10,
+		MaxResultBytes: 4,
+	})
+
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		return make([]byte, payload.(int)), nil
+	}
+
+	results, err := p.RunAllJobs(context.Background(), []interface{}{4, 5}, fn)
+	assert.Equal(t, [][]byte{make([]byte, 4)}, results)
+	assert.True(t, errors.Is(err, ErrResultTooLarge))
+	assert.EqualError(t, err, "job result exceeds max result size: 5 bytes, limit 4")
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestDedupCancelledLeader(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers: 2,
+		QueueDepth: 10,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	calls := atomic.NewInt32(0)
+	started := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		// the first execution runs until its caller goes away
+		if calls.Inc() == 1 {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []byte(payload.(string)), nil
+	}
+	dedup := WithDedupKey(func(payload interface{}) string {
+		return payload.(string)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(ctx, []interface{}{"a"}, fn, dedup)
+		assert.Error(t, err)
+	}()
+	<-started
+
+	// a second batch follows the running leader
+	go func() {
+		defer wg.Done()
+		msg, err := p.RunJobs(context.Background(), []interface{}{"a"}, fn, dedup)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("a"), msg)
+	}()
+	assert.Eventually(t, func() bool {
+		p.dedupMtx.Lock()
+		defer p.dedupMtx.Unlock()
+		return len(p.dedup["a"].followers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the leader's batch is cancelled mid run.  the follower runs the job instead of failing with it
+	cancel()
+	wg.Wait()
+	assert.Equal(t, int32(2), calls.Load())
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
+
+func TestDedupPromotedFollowerOverflowBlock(t *testing.T) {
+	prePoolOpts := goleak.IgnoreCurrent()
+
+	p := NewPool(&Config{
+		MaxWorkers:           2,
+		QueueDepth:           1,
+		OverflowPolicy:       OverflowBlock,
+		OverflowBlockTimeout: time.Second,
+	})
+	opts := goleak.IgnoreCurrent()
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	fn := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		switch payload.(string) {
+		case "leader":
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case "busy":
+			started <- struct{}{}
+			<-release
+		}
+		return []byte(payload.(string)), nil
+	}
+	dedup := WithDedupKey(func(payload interface{}) string {
+		if payload.(string) == "leader" || payload.(string) == "follower" {
+			return "same"
+		}
+		return payload.(string)
+	})
+
+	// one worker runs the leader, the other a slow job
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(ctx, []interface{}{"leader"}, fn, dedup)
+		assert.Error(t, err)
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{"busy"}, fn, dedup)
+		assert.NoError(t, err)
+	}()
+	<-started
+	<-started
+
+	// the queue is full when the follower is promoted
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.RunJobs(context.Background(), []interface{}{"queued"}, fn, dedup)
+		assert.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.size.Load() == 3 }, time.Second, 10*time.Millisecond)
+	go func() {
+		defer wg.Done()
+		msg, err := p.RunJobs(context.Background(), []interface{}{"follower"}, fn, dedup)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("follower"), msg)
+	}()
+	assert.Eventually(t, func() bool {
+		p.dedupMtx.Lock()
+		defer p.dedupMtx.Unlock()
+		return len(p.dedup["same"].followers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the promoted follower waits for room instead of failing
+	cancel()
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	wg.Wait()
+	goleak.VerifyNone(t, opts)
+
+	p.Shutdown()
+	goleak.VerifyNone(t, prePoolOpts)
+}
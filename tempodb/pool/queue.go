@@ -0,0 +1,425 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// jobQueue is a bounded queue that hands out jobs by priority.  Within a priority level jobs are handed
+// out round robin by tenant so one tenant submitting thousands of block jobs can't monopolize the workers.
+type jobQueue struct {
+	mtx     sync.Mutex
+	cond    *sync.Cond // signalled when a job is pushed
+	notFull *sync.Cond // signalled when a job is popped
+
+	depth    int
+	size     int
+	closed   bool
+	levels   [numPriorities]*fairQueue
+	workers  int // number of workers that should be pulling from the queue
+	retiring int // number of workers that should exit the next time they call pop
+
+	// maxTenantRunning caps the jobs handed out for a single tenant that have not yet finished.  jobs
+	// for a tenant at the cap stay queued and other tenants' jobs are handed out instead.  0 disables.
+	maxTenantRunning int
+	running          map[string]int
+}
+
+type fairQueue struct {
+	tenants []string // tenants with queued jobs in the order they will be serviced
+	jobs    map[string][]*job
+}
+
+func newJobQueue(depth int, maxTenantRunning int) *jobQueue {
+	q := &jobQueue{
+		depth:            depth,
+		maxTenantRunning: maxTenantRunning,
+		running:          make(map[string]int),
+	}
+	q.cond = sync.NewCond(&q.mtx)
+	q.notFull = sync.NewCond(&q.mtx)
+
+	for i := range q.levels {
+		q.levels[i] = &fairQueue{
+			jobs: make(map[string][]*job),
+		}
+	}
+
+	return q
+}
+
+// push adds a job to the queue.  it returns false if the queue is full or closed.
+func (q *jobQueue) push(j *job) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed || q.size >= q.depth {
+		return false
+	}
+
+	q.pushLocked(j)
+	return true
+}
+
+// pushWait adds a job to the queue waiting up to timeout for room.  it returns false if the queue
+// is closed, ctx is cancelled or the timeout expires first.
+func (q *jobQueue) pushWait(ctx context.Context, j *job, timeout time.Duration) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if !q.closed && q.size < q.depth {
+		q.pushLocked(j)
+		return true
+	}
+
+	// wake ourselves up if we are still waiting when the timeout expires or the caller goes away
+	expired := false
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-stop:
+			return
+		}
+
+		q.mtx.Lock()
+		expired = true
+		q.notFull.Broadcast()
+		q.mtx.Unlock()
+	}()
+
+	for !q.closed && !expired && q.size >= q.depth {
+		q.notFull.Wait()
+	}
+
+	if q.closed || q.size >= q.depth {
+		return false
+	}
+
+	q.pushLocked(j)
+	return true
+}
+
+// pushShed adds a job to the queue.  if the queue is full the oldest queued low priority job is evicted
+// to make room and returned so the caller can fail it.  it returns false if the queue is closed or there
+// is nothing to evict.
+func (q *jobQueue) pushShed(j *job) (*job, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return nil, false
+	}
+
+	var evicted *job
+	if q.size >= q.depth {
+		evicted = q.levels[PriorityLow].popOldest()
+		if evicted == nil {
+			return nil, false
+		}
+		q.size--
+	}
+
+	q.pushLocked(j)
+	return evicted, true
+}
+
+func (q *jobQueue) pushLocked(j *job) {
+	q.levels[j.priority].push(j)
+	q.size++
+	q.cond.Signal()
+}
+
+// pop blocks until a job is available.  it returns false once the queue is closed or if the calling
+// worker should exit because the pool was shrunk.
+func (q *jobQueue) pop() (*job, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for {
+		if q.closed {
+			return nil, false
+		}
+
+		if q.retiring > 0 {
+			q.retiring--
+			return nil, false
+		}
+
+		// the queue may hold jobs that can't be handed out yet because their tenant is at its cap
+		if j := q.popLocked(); j != nil {
+			return j, true
+		}
+		q.cond.Wait()
+	}
+}
+
+// tryPop returns a job if one is immediately available
+func (q *jobQueue) tryPop() (*job, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed || q.size == 0 {
+		return nil, false
+	}
+
+	j := q.popLocked()
+	return j, j != nil
+}
+
+func (q *jobQueue) popLocked() *job {
+	for _, l := range q.levels {
+		if j := l.popEligible(q.throttled); j != nil {
+			q.size--
+			q.notFull.Signal()
+			if q.maxTenantRunning > 0 && j.tenantID != "" {
+				q.running[j.tenantID]++
+			}
+			return j
+		}
+	}
+
+	return nil
+}
+
+// throttled is true if the tenant already has as many jobs running as it is allowed.  jobs without a
+// tenant are never throttled.
+func (q *jobQueue) throttled(tenantID string) bool {
+	return q.maxTenantRunning > 0 && tenantID != "" && q.running[tenantID] >= q.maxTenantRunning
+}
+
+// done must be called once a job handed out by pop or tryPop has finished
+func (q *jobQueue) done(j *job) {
+	if q.maxTenantRunning <= 0 || j.tenantID == "" {
+		return
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.running[j.tenantID]--
+	if q.running[j.tenantID] <= 0 {
+		delete(q.running, j.tenantID)
+	}
+	// workers may be waiting on jobs for this tenant
+	q.cond.Broadcast()
+}
+
+// oldest returns the enqueue time of the job that has been queued the longest.  it is zero if the
+// queue is empty.
+func (q *jobQueue) oldest() time.Time {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	var oldest time.Time
+	for _, l := range q.levels {
+		for _, jobs := range l.jobs {
+			for _, j := range jobs {
+				if oldest.IsZero() || j.enqueued.Before(oldest) {
+					oldest = j.enqueued
+				}
+			}
+		}
+	}
+
+	return oldest
+}
+
+// removeIf removes and returns every queued job matching fn
+func (q *jobQueue) removeIf(fn func(*job) bool) []*job {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	var removed []*job
+	for _, l := range q.levels {
+		removed = append(removed, l.removeIf(fn)...)
+	}
+
+	q.size -= len(removed)
+	if len(removed) > 0 {
+		q.notFull.Broadcast()
+	}
+
+	return removed
+}
+
+// length returns the number of queued jobs
+func (q *jobQueue) length() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.size
+}
+
+// numWorkers returns the number of workers that should be pulling from the queue
+func (q *jobQueue) numWorkers() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.workers
+}
+
+// resize changes the depth of the queue and the number of workers that should be pulling from it.  it
+// returns the number of new workers the caller must start.  excess workers exit on their next call to pop.
+func (q *jobQueue) resize(workers, depth int) int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.depth = depth
+	q.notFull.Broadcast()
+
+	start := 0
+	if workers > q.workers {
+		// prefer keeping workers that haven't exited yet over starting new ones
+		start = workers - q.workers
+		keep := start
+		if keep > q.retiring {
+			keep = q.retiring
+		}
+		q.retiring -= keep
+		start -= keep
+	} else if workers < q.workers {
+		q.retiring += q.workers - workers
+		q.cond.Broadcast()
+	}
+	q.workers = workers
+
+	return start
+}
+
+func (q *jobQueue) capacity() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.depth
+}
+
+// close wakes all waiting workers and returns any jobs that were still queued
+func (q *jobQueue) close() []*job {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	var remaining []*job
+	for _, l := range q.levels {
+		for j := l.pop(); j != nil; j = l.pop() {
+			remaining = append(remaining, j)
+		}
+	}
+
+	q.size = 0
+	q.closed = true
+	q.cond.Broadcast()
+	q.notFull.Broadcast()
+
+	return remaining
+}
+
+func (f *fairQueue) push(j *job) {
+	jobs, ok := f.jobs[j.tenantID]
+	if !ok {
+		f.tenants = append(f.tenants, j.tenantID)
+	}
+	f.jobs[j.tenantID] = append(jobs, j)
+}
+
+func (f *fairQueue) pop() *job {
+	return f.popEligible(func(string) bool { return false })
+}
+
+// popEligible removes the next job from the first tenant in line that isn't throttled.  throttled tenants
+// keep their place in line.
+func (f *fairQueue) popEligible(throttled func(tenantID string) bool) *job {
+	for i, tenantID := range f.tenants {
+		if throttled(tenantID) {
+			continue
+		}
+
+		f.tenants = append(f.tenants[:i], f.tenants[i+1:]...)
+		j := f.popTenant(tenantID)
+
+		// send the tenant to the back of the line if it has more work
+		if _, ok := f.jobs[tenantID]; ok {
+			f.tenants = append(f.tenants, tenantID)
+		}
+
+		return j
+	}
+
+	return nil
+}
+
+// popOldest removes the job that has been queued the longest regardless of tenant.  the tenant keeps
+// its place in line.
+func (f *fairQueue) popOldest() *job {
+	oldest := -1
+	for i, tenantID := range f.tenants {
+		if oldest == -1 || f.jobs[tenantID][0].enqueued.Before(f.jobs[f.tenants[oldest]][0].enqueued) {
+			oldest = i
+		}
+	}
+
+	if oldest == -1 {
+		return nil
+	}
+
+	tenantID := f.tenants[oldest]
+	j := f.popTenant(tenantID)
+	if _, ok := f.jobs[tenantID]; !ok {
+		f.tenants = append(f.tenants[:oldest], f.tenants[oldest+1:]...)
+	}
+
+	return j
+}
+
+func (f *fairQueue) removeIf(fn func(*job) bool) []*job {
+	var removed []*job
+
+	tenants := f.tenants[:0]
+	for _, tenantID := range f.tenants {
+		jobs := f.jobs[tenantID]
+		kept := jobs[:0]
+		for _, j := range jobs {
+			if fn(j) {
+				removed = append(removed, j)
+			} else {
+				kept = append(kept, j)
+			}
+		}
+		for i := len(kept); i < len(jobs); i++ {
+			jobs[i] = nil
+		}
+
+		if len(kept) == 0 {
+			delete(f.jobs, tenantID)
+			continue
+		}
+		f.jobs[tenantID] = kept
+		tenants = append(tenants, tenantID)
+	}
+	f.tenants = tenants
+
+	return removed
+}
+
+// popTenant removes the next job for the tenant.  the tenant is removed from the map once it has no
+// more jobs but the caller is responsible for maintaining the tenants slice.
+func (f *fairQueue) popTenant(tenantID string) *job {
+	jobs := f.jobs[tenantID]
+	j := jobs[0]
+	jobs[0] = nil
+	jobs = jobs[1:]
+
+	if len(jobs) > 0 {
+		f.jobs[tenantID] = jobs
+	} else {
+		delete(f.jobs, tenantID)
+	}
+
+	return j
+}
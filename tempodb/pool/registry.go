@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/tempo/pkg/util"
+)
+
+// Registry creates and tracks named pools so independent workloads, e.g. "query" and "compaction",
+// get their own workers and queue while sharing metrics distinguished by the pool label.
+type Registry struct {
+	mtx    sync.Mutex
+	pools  map[string]*Pool
+	budget *Budget
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		pools: make(map[string]*Pool),
+	}
+}
+
+// NewRegistryWithBudget creates a registry whose pools share budget.  Pools can borrow idle capacity from
+// each other but never run more than the budget's limit of jobs at once in total.
+func NewRegistryWithBudget(budget *Budget) *Registry {
+	r := NewRegistry()
+	r.budget = budget
+	return r
+}
+
+// Pool returns the pool registered under name creating it with cfg if it doesn't exist yet.  cfg is
+// ignored if the pool already exists.
+func (r *Registry) Pool(name string, cfg *Config) *Pool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if p, ok := r.pools[name]; ok {
+		return p
+	}
+
+	p := newPool(name, cfg, r.budget)
+	r.pools[name] = p
+	return p
+}
+
+// Get returns the pool registered under name or nil
+func (r *Registry) Get(name string) *Pool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.pools[name]
+}
+
+// Drain drains all registered pools concurrently.  See Pool.Drain.
+func (r *Registry) Drain(ctx context.Context) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs util.MultiError
+	)
+	for _, p := range r.pools {
+		wg.Add(1)
+		go func(p *Pool) {
+			defer wg.Done()
+
+			err := p.Drain(ctx)
+
+			mtx.Lock()
+			errs.Add(err)
+			mtx.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	return errs.Err()
+}
+
+// Shutdown shuts down all registered pools
+func (r *Registry) Shutdown() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, p := range r.pools {
+		p.Shutdown()
+	}
+}
@@ -0,0 +1,120 @@
+package tempodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	tempo_util "github.com/grafana/tempo/pkg/util"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/pool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricPrefetchBlocks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "prefetch_blocks_total",
+		Help:      "Total number of recent blocks whose bloom filters and indexes were prefetched.",
+	}, []string{"status"})
+	metricPrefetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "tempodb",
+		Name:      "prefetch_duration_seconds",
+		Help:      "Time spent prefetching recent blocks after a blocklist poll.",
+		Buckets:   prometheus.ExponentialBuckets(.25, 2, 10),
+	})
+)
+
+// hasCache is true if anything would hold on to what a prefetch reads
+func (rw *readerWriter) hasCache() bool {
+	return rw.metaCache != nil || rw.cfg.MemoryCache != nil || rw.cfg.Diskcache != nil || rw.cfg.Memcached != nil || rw.cfg.Redis != nil
+}
+
+// prefetchRecentBlocks reads the bloom filters and indexes of blocks younger than PrefetchRecentBlocks so
+// they are cached before the first query asks for them.  most queries are for recent traces.  blocks are
+// only fetched the first time they're seen and the jobs run at low priority so queries always go first.
+// blooms and indexes are read the way Find reads them, shard by shard and page by page, so the caches hold
+// what queries will ask for.
+func (rw *readerWriter) prefetchRecentBlocks() {
+	if rw.cfg.PrefetchRecentBlocks <= 0 || !rw.hasCache() {
+		return
+	}
+
+	// a slow prefetch shouldn't stack up behind the next poll
+	if !rw.prefetching.CAS(false, true) {
+		return
+	}
+	defer rw.prefetching.Store(false)
+
+	start := time.Now()
+	defer func() { metricPrefetchDuration.Observe(time.Since(start).Seconds()) }()
+
+	cutoff := time.Now().Add(-rw.cfg.PrefetchRecentBlocks)
+	recent := make(map[uuid.UUID]struct{})
+	payloads := make([]interface{}, 0)
+	for _, tenantID := range rw.blocklistTenants() {
+		for _, b := range rw.blocklist(tenantID) {
+			if b.EndTime.Before(cutoff) {
+				continue
+			}
+
+			recent[b.BlockID] = struct{}{}
+			if _, ok := rw.prefetched[b.BlockID]; !ok {
+				payloads = append(payloads, b)
+			}
+		}
+	}
+	// forget blocks that have aged out or been compacted away
+	rw.prefetched = recent
+
+	if len(payloads) == 0 {
+		return
+	}
+
+	_, err := rw.pool.RunAllJobs(context.Background(), payloads, func(ctx context.Context, payload interface{}) ([]byte, error) {
+		meta := payload.(*encoding.BlockMeta)
+
+		var err error
+		for shard := 0; shard < meta.BloomShardCount() && err == nil; shard++ {
+			_, err = rw.bloomFilter(ctx, meta, shard, newFindMetrics())
+		}
+		if err == nil && meta.IndexPageSize == 0 {
+			_, err = rw.r.Index(ctx, meta.BlockID, meta.TenantID)
+		}
+		// the last id of each page finds that page
+		for i := 0; i < len(meta.IndexPages) && err == nil; i++ {
+			_, err = rw.readIndex(ctx, meta, meta.IndexPages[i])
+		}
+		if err != nil {
+			metricPrefetchBlocks.WithLabelValues("failure").Inc()
+			return nil, err
+		}
+
+		metricPrefetchBlocks.WithLabelValues("success").Inc()
+		return nil, nil
+	}, pool.WithPriority(pool.PriorityLow), pool.WithJobType("prefetch"), pool.WithPayloadKey(blockIDKey))
+	if err == nil {
+		return
+	}
+
+	level.Warn(rw.logger).Log("msg", "failed to prefetch recent blocks", "err", err)
+
+	// try the failed blocks again next poll
+	errs, ok := err.(tempo_util.MultiError)
+	if !ok {
+		errs = tempo_util.MultiError{err}
+	}
+	for _, err := range errs {
+		jobErr, ok := err.(*pool.JobError)
+		if !ok {
+			// the whole batch failed, e.g. the queue was full
+			rw.prefetched = make(map[uuid.UUID]struct{})
+			return
+		}
+		if blockID, parseErr := uuid.Parse(jobErr.Key); parseErr == nil {
+			delete(rw.prefetched, blockID)
+		}
+	}
+}
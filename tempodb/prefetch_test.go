@@ -0,0 +1,151 @@
+package tempodb
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/backend/memorycache"
+	"github.com/grafana/tempo/tempodb/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchRecentBlocks(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle:     0,
+		MetaCacheMaxBytes:    1024 * 1024,
+		PrefetchRecentBlocks: time.Hour,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	blockIDs := make([]uuid.UUID, 0, 2)
+	for i := 0; i < 2; i++ {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		id := make([]byte, 16)
+		rand.Read(id)
+		err = head.Write(id, []byte{0x01})
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		blockIDs = append(blockIDs, complete.BlockMeta().BlockID)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+
+	// age one of the blocks past the prefetch window
+	for _, b := range rw.blockLists[testTenantID] {
+		if b.BlockID == blockIDs[1] {
+			b.EndTime = time.Now().Add(-2 * time.Hour)
+		}
+	}
+
+	rw.prefetchRecentBlocks()
+
+	_, ok := rw.metaCache.get(metaCacheTypeBloom, blockIDs[0], testTenantID)
+	assert.True(t, ok)
+	_, ok = rw.metaCache.get(metaCacheTypeBloom, blockIDs[1], testTenantID)
+	assert.False(t, ok)
+	assert.Len(t, rw.prefetched, 1)
+
+	// blocks that were already prefetched are skipped
+	rw.metaCache.evictBlock(blockIDs[0], testTenantID)
+	rw.prefetchRecentBlocks()
+	_, ok = rw.metaCache.get(metaCacheTypeBloom, blockIDs[0], testTenantID)
+	assert.False(t, ok)
+
+	// without a cache there's nothing to prefetch into
+	r, _, _, err = New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		PrefetchRecentBlocks: time.Hour,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+	rw = r.(*readerWriter)
+	rw.pollBlocklist()
+	rw.prefetchRecentBlocks()
+	assert.Len(t, rw.prefetched, 0)
+}
+
+func TestPrefetchIndexPages(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:           path.Join(tempDir, "wal"),
+			IndexDownsample:    2,
+			IndexPageSizeBytes: 100,
+			BloomFP:            .01,
+		},
+		MaintenanceCycle:     0,
+		MetaCacheMaxBytes:    1024 * 1024,
+		MemoryCache:          &memorycache.Config{MaxBytes: 1024 * 1024},
+		PrefetchRecentBlocks: time.Hour,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	require.NoError(t, err)
+	ids := make([][]byte, 0, 20)
+	for i := 0; i < 20; i++ {
+		id := make([]byte, 16)
+		rand.Read(id)
+		ids = append(ids, id)
+		require.NoError(t, head.Write(id, []byte{0x01}))
+	}
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	require.NoError(t, err)
+	meta := complete.BlockMeta()
+	require.Greater(t, len(meta.IndexPages), 1)
+	require.NoError(t, w.WriteBlock(context.Background(), complete))
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	rw.prefetchRecentBlocks()
+
+	// every page Find reads was cached so the index itself is no longer needed
+	err = os.Remove(path.Join(tempDir, "traces", testTenantID, meta.BlockID.String(), "index"))
+	require.NoError(t, err)
+	for _, id := range ids {
+		found, _, _, err := r.Find(context.Background(), testTenantID, id)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x01}, found)
+	}
+}
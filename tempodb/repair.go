@@ -0,0 +1,141 @@
+package tempodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/pkg/errors"
+)
+
+// RepairReport describes what RepairBlock recovered of a damaged block
+type RepairReport struct {
+	// BlockID is the block written with the recovered objects
+	BlockID uuid.UUID `json:"blockID"`
+	// Objects is the number of objects recovered
+	Objects int `json:"objects"`
+	// DamagedPages is the number of pages of objects lost in whole or in part
+	DamagedPages int `json:"damagedPages"`
+	// DroppedObjects is the number of objects recovered out of id order, e.g. from a page the index pointed to
+	// wrongly, which a block can't hold
+	DroppedObjects int `json:"droppedObjects"`
+}
+
+// RepairBlock rewrites a damaged block, e.g. one with a corrupt index or truncated objects, with every object that can
+// still be read.  The damaged block is marked compacted once the new block is written.
+func (rw *readerWriter) RepairBlock(ctx context.Context, tenantID string, blockID uuid.UUID) (*RepairReport, error) {
+	if tenantID == "" {
+		return nil, backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return nil, backend.ErrEmptyBlockID
+	}
+	if rw.cfg.ReadOnly {
+		return nil, backend.ErrReadOnly
+	}
+
+	meta, err := rw.r.BlockMeta(ctx, blockID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	format, err := meta.PageFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := rw.r.Index(ctx, blockID, tenantID)
+	if err == nil {
+		index, err = meta.OpenIndex(index)
+	}
+	if err != nil {
+		level.Warn(rw.logger).Log("msg", "unable to read index of block being repaired", "blockID", blockID, "tenantID", tenantID, "err", err)
+		index = nil
+	}
+	iter := encoding.NewSalvageIterator(format, index, rw.readStats(ctx, meta), encoding.NewBackendReaderAt(ctx, tenantID, blockID, rw.r))
+
+	estimatedObjects := meta.TotalObjects
+	if estimatedObjects <= 0 {
+		estimatedObjects = 1
+	}
+	currentBlock, err := rw.wal.NewCompactorBlock(uuid.New(), tenantID, []*encoding.BlockMeta{meta}, estimatedObjects)
+	if err != nil {
+		return nil, errors.Wrap(err, "error making new repaired block")
+	}
+	currentBlock.BlockMeta().CompactionLevel = meta.CompactionLevel
+
+	report := &RepairReport{}
+	var tracker backend.AppendTracker
+	var lastID encoding.ID
+	for {
+		id, object, err := iter.Next()
+		if err != nil {
+			_ = currentBlock.Clear()
+			return nil, err
+		}
+		if id == nil {
+			break
+		}
+		if lastID != nil && bytes.Compare(id, lastID) != 1 {
+			report.DroppedObjects++
+			continue
+		}
+
+		lastID = append([]byte(nil), id...)
+		err = currentBlock.Write(lastID, object)
+		if err != nil {
+			_ = currentBlock.Clear()
+			return nil, err
+		}
+		report.Objects++
+
+		// write partial block
+		if currentBlock.Length()%recordsPerBatch == 0 {
+			tracker, err = appendBlock(rw, tracker, currentBlock)
+			if err != nil {
+				_ = currentBlock.Clear()
+				return nil, errors.Wrap(err, "error writing partial block")
+			}
+		}
+	}
+	report.DamagedPages = iter.Damaged()
+
+	if report.Objects == 0 {
+		_ = currentBlock.Clear()
+		return nil, fmt.Errorf("no objects of block %s could be recovered", blockID)
+	}
+
+	err = finishBlock(rw, tracker, currentBlock)
+	if err != nil {
+		return nil, errors.Wrap(err, "error shipping block to backend")
+	}
+	markCompacted(rw, []*encoding.BlockMeta{meta}, tenantID)
+
+	report.BlockID = currentBlock.BlockMeta().BlockID
+	level.Info(rw.logger).Log("msg", "repaired block", "blockID", blockID, "tenantID", tenantID, "repairedBlockID", report.BlockID,
+		"objects", report.Objects, "damagedPages", report.DamagedPages, "droppedObjects", report.DroppedObjects)
+	return report, nil
+}
+
+// readStats returns the stats footer of the block or nil if it can't be read.  The footer follows the objects and the
+// tag index.
+func (rw *readerWriter) readStats(ctx context.Context, meta *encoding.BlockMeta) *encoding.BlockStats {
+	// blocks written before the footer don't record their records either
+	if meta.TotalRecords == 0 {
+		return nil
+	}
+
+	b := make([]byte, encoding.StatsFooterMaxSize(meta))
+	err := rw.r.ReadRange(ctx, backend.ObjectName, meta.BlockID, meta.TenantID, meta.Size+uint64(meta.TagIndexLength), b)
+	if err != nil {
+		return nil
+	}
+	stats, err := encoding.UnmarshalBlockStats(b)
+	if err != nil {
+		return nil
+	}
+	return stats
+}
@@ -0,0 +1,109 @@
+package tempodb
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/wal"
+)
+
+func TestRepairBlock(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	require.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 5,
+			BloomFP:         .01,
+			Encoding:        encoding.EncGZIP,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+	c.EnableCompaction(&CompactorConfig{}, &mockSharder{})
+	rw := r.(*readerWriter)
+
+	writeBlock := func() (*encoding.BlockMeta, [][]byte) {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		require.NoError(t, err)
+		ids := make([][]byte, 0, 50)
+		for i := 0; i < 50; i++ {
+			id := make([]byte, 16)
+			rand.Read(id)
+			ids = append(ids, id)
+			require.NoError(t, head.Write(id, id))
+		}
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		require.NoError(t, err)
+		require.NoError(t, w.WriteBlock(context.Background(), complete))
+		return complete.BlockMeta(), ids
+	}
+	blockDir := func(meta *encoding.BlockMeta) string {
+		return path.Join(tempDir, "traces", testTenantID, meta.BlockID.String())
+	}
+	repair := func(meta *encoding.BlockMeta) *RepairReport {
+		report, err := c.RepairBlock(context.Background(), testTenantID, meta.BlockID)
+		require.NoError(t, err)
+		assert.NotEqual(t, meta.BlockID, report.BlockID)
+
+		rw.pollBlocklist()
+		assert.Len(t, rw.blocklist(testTenantID), 1)
+		repaired := rw.blocklist(testTenantID)[0]
+		assert.Equal(t, report.BlockID, repaired.BlockID)
+		assert.Equal(t, report.Objects, repaired.TotalObjects)
+
+		err = c.DeleteBlock(context.Background(), testTenantID, repaired.BlockID)
+		require.NoError(t, err)
+		return report
+	}
+
+	// a corrupt index is replaced with the stats footer
+	meta, ids := writeBlock()
+	err = ioutil.WriteFile(path.Join(blockDir(meta), "index"), []byte("garbage"), 0644)
+	require.NoError(t, err)
+	report := repair(meta)
+	assert.Equal(t, 50, report.Objects)
+	assert.Equal(t, 0, report.DamagedPages)
+
+	// truncated objects lose the pages past the end
+	meta, ids = writeBlock()
+	err = os.Truncate(path.Join(blockDir(meta), "traces"), int64(meta.Size/2))
+	require.NoError(t, err)
+	report, err = c.RepairBlock(context.Background(), testTenantID, meta.BlockID)
+	require.NoError(t, err)
+	assert.Less(t, report.Objects, 50)
+	assert.NotZero(t, report.Objects)
+	assert.NotZero(t, report.DamagedPages)
+
+	rw.pollBlocklist()
+	found := 0
+	for _, id := range ids {
+		b, _, _, err := rw.Find(context.Background(), testTenantID, id)
+		assert.NoError(t, err)
+		if b != nil {
+			assert.Equal(t, id, b)
+			found++
+		}
+	}
+	assert.Equal(t, report.Objects, found)
+
+	_, err = c.RepairBlock(context.Background(), testTenantID, uuid.New())
+	assert.Error(t, err)
+}
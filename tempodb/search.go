@@ -0,0 +1,224 @@
+package tempodb
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/pool"
+)
+
+// searchChunkSizeBytes is how much of a block is read from the backend at a time while searching it
+const searchChunkSizeBytes = 1024 * 1024
+
+var (
+	metricSearchObjectsInspected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "search_objects_inspected_total",
+		Help:      "Total number of objects read and passed to a search matcher.",
+	})
+	metricSearchPagesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "search_pages_skipped_total",
+		Help:      "Total number of pages of objects a search skipped because their time groups are outside of its range.",
+	})
+)
+
+// ObjectMatcher decides which objects a search returns.  tempodb doesn't know the format of the objects
+// it stores so the caller supplies the matching, e.g. unmarshalling a trace and comparing its tags.
+type ObjectMatcher interface {
+	// Match returns a summary of the object if it matches or nil if it doesn't
+	Match(id encoding.ID, object []byte) (*TraceSummary, error)
+}
+
+// SearchRequest describes the traces to search for
+type SearchRequest struct {
+	// Start and End skip blocks written entirely outside of the range like WithTimeRange.  In blocks
+	// grouped by time they also skip the records whose objects' own times are outside of it.  Either may
+	// be zero.
+	Start time.Time
+	End   time.Time
+	// Limit stops the search once this many traces have matched.  0 searches every block.
+	Limit int
+
+	Matcher ObjectMatcher
+}
+
+// TraceSummary describes a trace matched by a search
+type TraceSummary struct {
+	TraceID         encoding.ID
+	RootServiceName string
+	RootSpanName    string
+	StartTime       time.Time
+	Duration        time.Duration
+}
+
+// merge combines summaries of the same trace found in different blocks.  a trace is split across blocks
+// until they are compacted together.
+func (s *TraceSummary) merge(other *TraceSummary) {
+	end := s.StartTime.Add(s.Duration)
+	if otherEnd := other.StartTime.Add(other.Duration); otherEnd.After(end) {
+		end = otherEnd
+	}
+	if other.StartTime.Before(s.StartTime) {
+		s.StartTime = other.StartTime
+	}
+	s.Duration = end.Sub(s.StartTime)
+
+	if s.RootServiceName == "" {
+		s.RootServiceName = other.RootServiceName
+		s.RootSpanName = other.RootSpanName
+	}
+}
+
+// Search reads every block of the tenant in the request's time range and returns the summaries of the
+// traces the matcher accepts, most recent first.  Like Find, blocks that fail are listed in the report
+// and only an error that prevents the search as a whole is returned.
+func (rw *readerWriter) Search(ctx context.Context, tenantID string, req *SearchRequest) ([]*TraceSummary, *FindReport, error) {
+	if req.Matcher == nil {
+		return nil, nil, fmt.Errorf("search requires a matcher")
+	}
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "store.Search")
+	defer span.Finish()
+
+	o := &findOptions{}
+	WithTimeRange(req.Start, req.End)(o)
+
+	report := &FindReport{}
+	rw.blockListsMtx.Lock()
+	blocklist, found := rw.blockLists[tenantID]
+	copiedBlocklist := make([]interface{}, 0, len(blocklist))
+	for _, b := range blocklist {
+		report.Blocks++
+		if !o.includes(b) {
+			report.PrunedBlocks++
+			continue
+		}
+		copiedBlocklist = append(copiedBlocklist, b)
+	}
+	rw.blockListsMtx.Unlock()
+	span.SetTag("blocks", len(copiedBlocklist))
+
+	if !found {
+		return nil, report, fmt.Errorf("tenantID %s not found", tenantID)
+	}
+
+	mtx := sync.Mutex{}
+	summaries := map[string]*TraceSummary{}
+	searched := atomic.NewInt32(0)
+	matched := atomic.NewInt32(0)
+	limitReached := func() bool {
+		return req.Limit > 0 && int(matched.Load()) >= req.Limit
+	}
+
+	_, err := rw.pool.RunAllJobs(ctx, copiedBlocklist, func(ctx context.Context, payload interface{}) ([]byte, error) {
+		meta := payload.(*encoding.BlockMeta)
+		if limitReached() {
+			return nil, nil
+		}
+
+		format, err := meta.PageFormat()
+		if err != nil {
+			return nil, err
+		}
+
+		// stops prefetching if the search ends before the block does
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var iter encoding.Iterator
+		if pages, ok := rw.pagesInRange(ctx, meta, req); ok {
+			iter = encoding.NewRecordIterator(pages, encoding.NewBackendReaderAt(ctx, tenantID, meta.BlockID, rw.r), format)
+		} else {
+			iter, err = encoding.NewPrefetchingBackendIterator(ctx, tenantID, meta.BlockID, format, searchChunkSizeBytes, rw.cfg.PrefetchPages, rw.r)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for !limitReached() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			id, object, err := iter.Next()
+			if err == io.EOF || (err == nil && id == nil) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			metricSearchObjectsInspected.Inc()
+
+			summary, err := req.Matcher.Match(id, object)
+			if err != nil {
+				return nil, err
+			}
+			if summary == nil {
+				continue
+			}
+
+			// the iterator owns id
+			key := hex.EncodeToString(id)
+			mtx.Lock()
+			if existing, ok := summaries[key]; ok {
+				existing.merge(summary)
+			} else {
+				summary.TraceID = append(encoding.ID(nil), id...)
+				summaries[key] = summary
+				matched.Inc()
+			}
+			mtx.Unlock()
+		}
+
+		searched.Inc()
+		return nil, nil
+	}, pool.WithTenant(tenantID), pool.WithJobType("search"), pool.WithPayloadKey(blockIDKey))
+
+	report.SearchedBlocks = int(searched.Load())
+	if err := report.addErr(err); err != nil {
+		return nil, report, err
+	}
+
+	results := make([]*TraceSummary, 0, len(summaries))
+	for _, s := range summaries {
+		results = append(results, s)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].StartTime.After(results[j].StartTime)
+	})
+	if req.Limit > 0 && len(results) > req.Limit {
+		results = results[:req.Limit]
+	}
+	span.SetTag("traces", len(results))
+
+	return results, report, nil
+}
+
+// pagesInRange returns the pages of the block holding objects in the time range of the request.  ok is false if the
+// whole block must be read: the request has no range or the block isn't grouped by time.
+func (rw *readerWriter) pagesInRange(ctx context.Context, meta *encoding.BlockMeta, req *SearchRequest) (pages []*encoding.Record, ok bool) {
+	if meta.TimeGroupWindow == 0 || (req.Start.IsZero() && req.End.IsZero()) {
+		return nil, false
+	}
+
+	stats := rw.readStats(ctx, meta)
+	if stats == nil {
+		return nil, false
+	}
+	pages, ok = stats.PagesInRange(req.Start, req.End)
+	if ok {
+		metricSearchPagesSkipped.Add(float64(len(stats.PageOffsets) - len(pages)))
+	}
+	return pages, ok
+}
@@ -0,0 +1,185 @@
+package tempodb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend/local"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMatcher matches objects whose first byte is 1.  the second byte is the trace start in seconds and
+// the third its duration
+type testMatcher struct{}
+
+func (testMatcher) Match(id encoding.ID, object []byte) (*TraceSummary, error) {
+	if object[0] != 1 {
+		return nil, nil
+	}
+
+	return &TraceSummary{
+		StartTime: time.Unix(int64(object[1]), 0),
+		Duration:  time.Duration(object[2]) * time.Second,
+	}, nil
+}
+
+func TestSearch(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	split := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+	other := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}
+	nomatch := []byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03}
+
+	writeBlock := func(objects map[string][]byte) uuid.UUID {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		for _, id := range [][]byte{split, other, nomatch} {
+			if object, ok := objects[string(id)]; ok {
+				err = head.Write(id, object)
+				assert.NoError(t, err)
+			}
+		}
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		return complete.BlockMeta().BlockID
+	}
+
+	// split is in both blocks and should be merged into a single summary spanning both parts
+	writeBlock(map[string][]byte{
+		string(split):   {0x01, 10, 5},
+		string(nomatch): {0x00, 0, 0},
+	})
+	secondBlock := writeBlock(map[string][]byte{
+		string(split): {0x01, 12, 8},
+		string(other): {0x01, 30, 1},
+	})
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+
+	results, report, err := r.Search(context.Background(), testTenantID, &SearchRequest{Matcher: testMatcher{}})
+	assert.NoError(t, err)
+	assert.False(t, report.Partial())
+	assert.Equal(t, 2, report.SearchedBlocks)
+	assert.Equal(t, []*TraceSummary{
+		{TraceID: other, StartTime: time.Unix(30, 0), Duration: time.Second},
+		{TraceID: split, StartTime: time.Unix(10, 0), Duration: 10 * time.Second},
+	}, results)
+
+	// limit
+	results, _, err = r.Search(context.Background(), testTenantID, &SearchRequest{Matcher: testMatcher{}, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// blocks outside of the range are not searched
+	results, report, err = r.Search(context.Background(), testTenantID, &SearchRequest{Matcher: testMatcher{}, Start: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Len(t, results, 0)
+	assert.Equal(t, 2, report.PrunedBlocks)
+
+	// a failed block is reported and the rest are still searched
+	err = os.Remove(path.Join(tempDir, "traces", testTenantID, secondBlock.String(), "index"))
+	assert.NoError(t, err)
+	results, report, err = r.Search(context.Background(), testTenantID, &SearchRequest{Matcher: testMatcher{}})
+	assert.NoError(t, err)
+	assert.True(t, report.Partial())
+	assert.Len(t, report.FailedBlocks, 1)
+	assert.Equal(t, []*TraceSummary{
+		{TraceID: split, StartTime: time.Unix(10, 0), Duration: 5 * time.Second},
+	}, results)
+
+	_, _, err = r.Search(context.Background(), "unknown", &SearchRequest{Matcher: testMatcher{}})
+	assert.Error(t, err)
+	_, _, err = r.Search(context.Background(), testTenantID, &SearchRequest{})
+	assert.Error(t, err)
+}
+
+func TestSearchTimeGroups(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 1,
+			BloomFP:         .01,
+			TimeGroupWindow: time.Hour,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	// the second byte of objects is the hour they start in relative to the current one and the third how many hours
+	// they last.  searches must include now not to skip the block
+	hour := time.Now().Truncate(time.Hour)
+	w.WAL().SetTimeExtractor(encoding.TimeExtractorFunc(func(object []byte) (time.Time, time.Time, error) {
+		start := hour.Add(time.Duration(int8(object[1])) * time.Hour)
+		return start, start.Add(time.Duration(object[2]) * time.Hour), nil
+	}))
+
+	early := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+	long := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}
+	late := []byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03}
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	minus := func(hours int8) byte { return byte(-hours) }
+	assert.NoError(t, head.Write(early, []byte{0x01, minus(10), 0}))
+	assert.NoError(t, head.Write(long, []byte{0x01, minus(15), 20}))
+	assert.NoError(t, head.Write(late, []byte{0x01, 10, 0}))
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, complete.BlockMeta().TimeGroupWindow)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+
+	search := func(start, end time.Time) []encoding.ID {
+		results, report, err := r.Search(context.Background(), testTenantID, &SearchRequest{Matcher: testMatcher{}, Start: start, End: end})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, report.SearchedBlocks)
+		var ids []encoding.ID
+		for _, s := range results {
+			ids = append(ids, s.TraceID)
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []encoding.ID{early, long, late}, search(time.Time{}, time.Time{}))
+	assert.ElementsMatch(t, []encoding.ID{long, late}, search(hour, time.Time{}))
+	assert.ElementsMatch(t, []encoding.ID{early, long}, search(time.Time{}, hour.Add(time.Hour)))
+	assert.ElementsMatch(t, []encoding.ID{long}, search(hour, hour.Add(2*time.Hour)))
+}
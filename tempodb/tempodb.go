@@ -21,34 +21,37 @@ import (
 	"github.com/opentracing/opentracing-go"
 	ot_log "github.com/opentracing/opentracing-go/log"
 
+	tempo_util "github.com/grafana/tempo/pkg/util"
 	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/backend/azure"
+	"github.com/grafana/tempo/tempodb/backend/checksum"
+	"github.com/grafana/tempo/tempodb/backend/cos"
 	"github.com/grafana/tempo/tempodb/backend/diskcache"
 	"github.com/grafana/tempo/tempodb/backend/gcs"
+	"github.com/grafana/tempo/tempodb/backend/hdfs"
+	"github.com/grafana/tempo/tempodb/backend/instrumentation"
 	"github.com/grafana/tempo/tempodb/backend/local"
 	"github.com/grafana/tempo/tempodb/backend/memcached"
+	"github.com/grafana/tempo/tempodb/backend/memorycache"
+	"github.com/grafana/tempo/tempodb/backend/mirror"
+	"github.com/grafana/tempo/tempodb/backend/oss"
+	"github.com/grafana/tempo/tempodb/backend/ratelimit"
+	"github.com/grafana/tempo/tempodb/backend/readonly"
+	"github.com/grafana/tempo/tempodb/backend/redis"
+	"github.com/grafana/tempo/tempodb/backend/retry"
 	"github.com/grafana/tempo/tempodb/backend/s3"
+	"github.com/grafana/tempo/tempodb/backend/swift"
+	"github.com/grafana/tempo/tempodb/backend/tiered"
+	"github.com/grafana/tempo/tempodb/backend/tracing"
 	"github.com/grafana/tempo/tempodb/encoding"
 	"github.com/grafana/tempo/tempodb/pool"
 	"github.com/grafana/tempo/tempodb/wal"
 )
 
+// retentionClearBatchSize is the most expired blocks retention clears with one call to the backend
+const retentionClearBatchSize = 1000
+
 var (
-	metricBlocklistErrors = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: "tempodb",
-		Name:      "blocklist_poll_errors_total",
-		Help:      "Total number of times an error occurred while polling the blocklist.",
-	}, []string{"tenant"})
-	metricBlocklistPollDuration = promauto.NewHistogram(prometheus.HistogramOpts{
-		Namespace: "tempodb",
-		Name:      "blocklist_poll_duration_seconds",
-		Help:      "Records the amount of time to poll and update the blocklist.",
-		Buckets:   prometheus.ExponentialBuckets(.25, 2, 6),
-	})
-	metricBlocklistLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "tempodb",
-		Name:      "blocklist_length",
-		Help:      "Total number of blocks per tenant.",
-	}, []string{"tenant"})
 	metricRetentionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "tempodb",
 		Name:      "retention_duration_seconds",
@@ -70,20 +73,49 @@ var (
 		Name:      "retention_deleted_total",
 		Help:      "Total number of blocks deleted.",
 	})
+	metricFindBlocksGone = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "find_blocks_gone_total",
+		Help:      "Total number of blocks that were compacted away after the blocklist was polled and skipped by finds.",
+	})
 )
 
 type Writer interface {
+	// WriteBlock uploads a completed block and marks it flushed.  With AsyncBlockWrites it returns once the
+	// upload has started and the block is marked flushed when it finishes.
 	WriteBlock(ctx context.Context, block wal.WriteableBlock) error
+	// FlushAll waits for every block upload in flight to finish.  Called on shutdown so blocks being
+	// written aren't left half uploaded.
+	FlushAll(ctx context.Context) error
 	WAL() *wal.WAL
 }
 
 type Reader interface {
-	Find(ctx context.Context, tenantID string, id encoding.ID) ([]byte, FindMetrics, error)
+	Find(ctx context.Context, tenantID string, id encoding.ID, opts ...FindOption) ([]byte, FindMetrics, *FindReport, error)
+	Search(ctx context.Context, tenantID string, req *SearchRequest) ([]*TraceSummary, *FindReport, error)
+	ReconfigurePool(maxWorkers int, queueDepth int)
+	// SubscribeBlocklist registers fn to be called when a tenant's blocklist changes
+	SubscribeBlocklist(fn func(BlocklistChange))
+	// BackendHealthy returns an error until the backends queries depend on pass a health check and again
+	// whenever one fails
+	BackendHealthy() error
 	Shutdown()
 }
 
 type Compactor interface {
 	EnableCompaction(cfg *CompactorConfig, sharder CompactorSharder)
+	// SetCompactorOverrides sets the per tenant settings of retention.  Call it before EnableCompaction.
+	SetCompactorOverrides(o CompactorOverrides)
+	// DeleteBlock removes a block, compacted or not, from the backend and the blocklist
+	DeleteBlock(ctx context.Context, tenantID string, blockID uuid.UUID) error
+	// RepairBlock replaces a damaged block with a block of the objects that can still be read from it
+	RepairBlock(ctx context.Context, tenantID string, blockID uuid.UUID) (*RepairReport, error)
+
+	// PauseCompaction stops new compactions from starting until ResumeCompaction is called.  Retention
+	// keeps running.
+	PauseCompaction()
+	ResumeCompaction()
+	CompactionPaused() bool
 }
 
 type CompactorSharder interface {
@@ -91,6 +123,12 @@ type CompactorSharder interface {
 	Owns(hash string) bool
 }
 
+// CompactorOverrides are per tenant settings of retention
+type CompactorOverrides interface {
+	// BlockRetention is how long the tenant's blocks are kept.  0 to use the CompactorConfig's.
+	BlockRetention(tenantID string) time.Duration
+}
+
 type FindMetrics struct {
 	BloomFilterReads     *atomic.Int32
 	BloomFilterBytesRead *atomic.Int32
@@ -100,43 +138,205 @@ type FindMetrics struct {
 	BlockBytesRead       *atomic.Int32
 }
 
+func newFindMetrics() FindMetrics {
+	return FindMetrics{
+		BloomFilterReads:     atomic.NewInt32(0),
+		BloomFilterBytesRead: atomic.NewInt32(0),
+		IndexReads:           atomic.NewInt32(0),
+		IndexBytesRead:       atomic.NewInt32(0),
+		BlockReads:           atomic.NewInt32(0),
+		BlockBytesRead:       atomic.NewInt32(0),
+	}
+}
+
+func (m FindMetrics) add(other FindMetrics) {
+	m.BloomFilterReads.Add(other.BloomFilterReads.Load())
+	m.BloomFilterBytesRead.Add(other.BloomFilterBytesRead.Load())
+	m.IndexReads.Add(other.IndexReads.Load())
+	m.IndexBytesRead.Add(other.IndexBytesRead.Load())
+	m.BlockReads.Add(other.BlockReads.Load())
+	m.BlockBytesRead.Add(other.BlockBytesRead.Load())
+}
+
+// FindReport describes which blocks a Find was able to search.  A trace returned alongside a report with
+// failed blocks may be incomplete.
+type FindReport struct {
+	// Blocks is the number of blocks whose id range could hold the trace
+	Blocks int
+	// PrunedBlocks were in the id range but excluded by WithTimeRange
+	PrunedBlocks int
+	// SearchedBlocks were read without error
+	SearchedBlocks int
+	// FailedBlocks were attempted and returned an error
+	FailedBlocks []*pool.JobError
+}
+
+// SkippedBlocks is the number of blocks never searched, either because the trace was already found or the
+// search was cancelled
+func (r *FindReport) SkippedBlocks() int {
+	return r.Blocks - r.PrunedBlocks - r.SearchedBlocks - len(r.FailedBlocks)
+}
+
+// Partial is true if any block that could hold the trace failed to be searched
+func (r *FindReport) Partial() bool {
+	return len(r.FailedBlocks) > 0
+}
+
+// addErr records the blocks in err as failed.  any error that can not be tied to a block is returned.
+func (r *FindReport) addErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(tempo_util.MultiError)
+	if !ok {
+		errs = tempo_util.MultiError{err}
+	}
+
+	other := tempo_util.MultiError{}
+	for _, err := range errs {
+		if jobErr, ok := err.(*pool.JobError); ok {
+			r.FailedBlocks = append(r.FailedBlocks, jobErr)
+			continue
+		}
+		other.Add(err)
+	}
+	return other.Err()
+}
+
+// FindOption narrows the blocks searched by Find
+type FindOption func(*findOptions)
+
+type findOptions struct {
+	start    time.Time
+	end      time.Time
+	combiner encoding.ObjectCombiner
+}
+
+// WithTimeRange only searches blocks that were being written to at some point between start and end.
+// Either may be zero to leave that side of the range open.  Block times are when the block was
+// written, not span timestamps, so callers should pad the range to allow for ingestion delay.
+func WithTimeRange(start, end time.Time) FindOption {
+	return func(o *findOptions) {
+		o.start = start
+		o.end = end
+	}
+}
+
+// WithCombiner searches every block the id may be in and combines the objects found in each rather than returning
+// the first found.  An object split across blocks, e.g. a trace that was still receiving spans when its block was cut,
+// is returned whole.  Objects are combined in a fixed order so the result doesn't depend on which block is read first.
+func WithCombiner(c encoding.ObjectCombiner) FindOption {
+	return func(o *findOptions) {
+		o.combiner = c
+	}
+}
+
+// includes returns true if the block may contain data written within the time range
+func (o *findOptions) includes(b *encoding.BlockMeta) bool {
+	if !o.start.IsZero() && b.EndTime.Before(o.start) {
+		return false
+	}
+	if !o.end.IsZero() && b.StartTime.After(o.end) {
+		return false
+	}
+	return true
+}
+
 type readerWriter struct {
 	r backend.Reader
 	w backend.Writer
 	c backend.Compactor
 
-	wal  *wal.WAL
-	pool *pool.Pool
+	wal       *wal.WAL
+	pool      *pool.Pool
+	metaCache *metaCache
+	uploads   *uploadLimiter
+	coldTier  *tiered.ReaderWriter // nil without a cold tier
+	mirror    *mirror.ReaderWriter // nil without a mirror
 
 	logger        log.Logger
 	cfg           *Config
 	blockLists    map[string][]*encoding.BlockMeta
 	blockListsMtx sync.Mutex
+	pollFailures  map[string]int // consecutive failed polls by tenant.  guarded by blockListsMtx
+	quarantined   map[string]map[uuid.UUID]time.Time // when blocks with invalid metas were first listed, by tenant.  guarded by blockListsMtx
 
 	compactorCfg        *CompactorConfig
 	compactedBlockLists map[string][]*encoding.CompactedBlockMeta
 	compactorSharder    CompactorSharder
+	compactorMtx        sync.Mutex // guards compactorSharder which is read by the blocklist poller
+	compactorOverrides  CompactorOverrides
+	compactionPaused    *atomic.Bool
+
+	prefetching *atomic.Bool
+	prefetched  map[uuid.UUID]struct{} // blocks warmed by the previous prefetch.  only touched by the prefetcher
+
+	subscribers    []func(BlocklistChange)
+	subscribersMtx sync.Mutex
+
+	healthChecks []healthCheck
+	healthErr    error // from the last health check.  guarded by healthMtx
+	healthMtx    sync.Mutex
 }
 
 func New(cfg *Config, logger log.Logger) (Reader, Writer, Compactor, error) {
-	var err error
-	var r backend.Reader
-	var w backend.Writer
-	var c backend.Compactor
+	r, w, c, retryable, err := newBackend(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	switch cfg.Backend {
-	case "local":
-		r, w, c, err = local.New(cfg.Local)
-	case "gcs":
-		r, w, c, err = gcs.New(cfg.GCS)
-	case "s3":
-		r, w, c, err = s3.New(cfg.S3)
-	default:
-		err = fmt.Errorf("unknown backend %s", cfg.Backend)
+	r, w, c = tracing.New(r, w, c, cfg.Backend)
+	r, w, c = instrumentation.New(r, w, c, cfg.Backend)
+	healthChecks := []healthCheck{{name: cfg.Backend, r: r, ready: true}}
+
+	var coldTier *tiered.ReaderWriter
+	if cfg.ColdTier != nil {
+		coldR, coldW, coldC, coldRetryable, err := newBackend(cfg.ColdTier.backendConfig())
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error creating cold tier backend: %w", err)
+		}
+
+		coldName := cfg.ColdTier.Backend + "-cold"
+		coldR, coldW, coldC = tracing.New(coldR, coldW, coldC, coldName)
+		coldR, coldW, coldC = instrumentation.New(coldR, coldW, coldC, coldName)
+		healthChecks = append(healthChecks, healthCheck{name: coldName, r: coldR, ready: true})
+
+		coldTier = tiered.New(r, w, c, coldR, coldW, coldC, logger)
+		r, w, c = coldTier, coldTier, coldTier
+
+		hotRetryable := retryable
+		retryable = func(err error) bool {
+			return hotRetryable(err) || coldRetryable(err)
+		}
 	}
 
-	if err != nil {
-		return nil, nil, nil, err
+	var mirrorRW *mirror.ReaderWriter
+	if cfg.Mirror != nil {
+		mirrorR, mirrorW, mirrorC, _, err := newBackend(cfg.Mirror.backendConfig())
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error creating mirror backend: %w", err)
+		}
+
+		mirrorName := cfg.Mirror.Backend + "-mirror"
+		mirrorR, mirrorW, mirrorC = tracing.New(mirrorR, mirrorW, mirrorC, mirrorName)
+		mirrorR, mirrorW, mirrorC = instrumentation.New(mirrorR, mirrorW, mirrorC, mirrorName)
+		healthChecks = append(healthChecks, healthCheck{name: mirrorName, r: mirrorR})
+
+		// replicated in the background so mirror errors are never retried in the write path
+		mirrorRW = mirror.New(r, w, c, mirrorR, mirrorW, mirrorC, &cfg.Mirror.Config, logger)
+		r, w, c = mirrorRW, mirrorRW, mirrorRW
+	}
+
+	r, w, c = checksum.New(r, w, c, logger)
+
+	// limited before retrying so retries count against the limits
+	if cfg.RateLimit != nil {
+		r, w, c = ratelimit.New(r, w, c, cfg.RateLimit)
+	}
+
+	if cfg.Retry != nil && cfg.Retry.MaxRetries > 0 {
+		r, w, c = retry.New(r, w, c, cfg.Retry, retryable)
 	}
 
 	if cfg.Diskcache != nil {
@@ -155,6 +355,26 @@ func New(cfg *Config, logger log.Logger) (Reader, Writer, Compactor, error) {
 		}
 	}
 
+	if cfg.Redis != nil {
+		r, w, err = redis.New(r, w, cfg.Redis, logger)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if cfg.MemoryCache != nil {
+		r, err = memorycache.New(r, cfg.MemoryCache, logger)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if cfg.ReadOnly {
+		r, w, c = readonly.New(r, c)
+	}
+
 	rw := &readerWriter{
 		c:                   c,
 		compactedBlockLists: make(map[string][]*encoding.CompactedBlockMeta),
@@ -163,7 +383,24 @@ func New(cfg *Config, logger log.Logger) (Reader, Writer, Compactor, error) {
 		cfg:                 cfg,
 		logger:              logger,
 		pool:                pool.NewPool(cfg.Pool),
+		metaCache:           newMetaCache(cfg.MetaCacheMaxBytes),
+		uploads:             newUploadLimiter(cfg.BlockUploadConcurrency, cfg.BlockUploadBufferBytes),
+		coldTier:            coldTier,
+		mirror:              mirrorRW,
+		healthChecks:        healthChecks,
+		healthErr:           errBackendNotChecked,
 		blockLists:          make(map[string][]*encoding.BlockMeta),
+		pollFailures:        make(map[string]int),
+		quarantined:         make(map[string]map[uuid.UUID]time.Time),
+		compactionPaused:    atomic.NewBool(false),
+		prefetching:         atomic.NewBool(false),
+		prefetched:          make(map[uuid.UUID]struct{}),
+	}
+
+	rw.SubscribeBlocklist(rw.evictRemovedBlocks)
+
+	if cfg.PrefetchRecentBlocks > 0 && !rw.hasCache() {
+		level.Warn(logger).Log("msg", "prefetch_recent_blocks is set but no cache is configured.  prefetch disabled.")
 	}
 
 	rw.wal, err = wal.New(rw.cfg.WAL)
@@ -171,53 +408,146 @@ func New(cfg *Config, logger log.Logger) (Reader, Writer, Compactor, error) {
 		return nil, nil, nil, err
 	}
 
+	err = loadEncryptionKeys(cfg, rw.wal)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	go rw.maintenanceLoop()
+	go rw.healthLoop()
 
 	return rw, rw, rw, nil
 }
 
+// loadEncryptionKeys registers the keys blocks may be encrypted with and has the WAL encrypt new blocks with the
+// encryption key
+func loadEncryptionKeys(cfg *Config, w *wal.WAL) error {
+	for _, filename := range cfg.DecryptionKeyFiles {
+		k, err := encoding.LoadEncryptionKey(filename)
+		if err != nil {
+			return fmt.Errorf("error loading decryption key: %w", err)
+		}
+		encoding.RegisterEncryptionKey(k)
+	}
+
+	if cfg.EncryptionKeyFile == "" {
+		return nil
+	}
+	k, err := encoding.LoadEncryptionKey(cfg.EncryptionKeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading encryption key: %w", err)
+	}
+	encoding.RegisterEncryptionKey(k)
+	w.SetEncryptionKey(k)
+	return nil
+}
+
+// newBackend creates the backend named in cfg and returns how to tell its transient errors apart
+func newBackend(cfg *Config) (backend.Reader, backend.Writer, backend.Compactor, retry.Retryable, error) {
+	var err error
+	var r backend.Reader
+	var w backend.Writer
+	var c backend.Compactor
+
+	retryable := retry.IsTransient
+	switch cfg.Backend {
+	case "local":
+		r, w, c, err = local.New(cfg.Local)
+	case "gcs":
+		r, w, c, err = gcs.New(cfg.GCS)
+		retryable = gcs.IsRetryable
+	case "s3":
+		r, w, c, err = s3.New(cfg.S3)
+		retryable = s3.IsRetryable
+	case "azure":
+		r, w, c, err = azure.New(cfg.Azure)
+	case "swift":
+		r, w, c, err = swift.New(cfg.Swift)
+	case "oss":
+		r, w, c, err = oss.New(cfg.OSS)
+	case "cos":
+		r, w, c, err = cos.New(cfg.COS)
+	case "hdfs":
+		r, w, c, err = hdfs.New(cfg.HDFS)
+	default:
+		err = fmt.Errorf("unknown backend %s", cfg.Backend)
+	}
+
+	return r, w, c, retryable, err
+}
+
 func (rw *readerWriter) WriteBlock(ctx context.Context, c wal.WriteableBlock) error {
+	meta := c.BlockMeta()
+	if rw.cfg.ReadOnly {
+		// rejected here rather than by the backend so async writes fail too
+		return backend.ErrReadOnly
+	}
+	if rw.cfg.AsyncBlockWrites && !rw.uploads.queue(meta.BlockID) {
+		return nil // already being uploaded
+	}
+
 	records := c.Records()
-	indexBytes, err := encoding.MarshalRecords(records)
+	indexBytes, err := meta.MarshalIndex(records)
 	if err != nil {
+		rw.uploads.dequeue(meta.BlockID)
 		return err
 	}
 
-	bloomBuffer := &bytes.Buffer{}
-	_, err = c.BloomFilter().WriteTo(bloomBuffer)
+	bloomBytes, err := marshalBloom(c, meta)
 	if err != nil {
+		rw.uploads.dequeue(meta.BlockID)
 		return err
 	}
 
-	meta := c.BlockMeta()
-	err = rw.w.Write(ctx, meta, bloomBuffer.Bytes(), indexBytes, c.ObjectFilePath())
+	size := len(bloomBytes) + len(indexBytes)
+	err = rw.uploads.acquire(ctx, size)
 	if err != nil {
+		rw.uploads.dequeue(meta.BlockID)
 		return err
 	}
 
-	err = c.Flushed()
+	if rw.cfg.AsyncBlockWrites {
+		// the upload outlives the caller's context.  FlushAll waits for it on shutdown
+		go func() {
+			defer rw.uploads.dequeue(meta.BlockID)
+			defer rw.uploads.release(size)
+
+			err := rw.writeBlock(context.Background(), c, meta, bloomBytes, indexBytes)
+			if err != nil {
+				metricAsyncBlockWriteFailures.Inc()
+				level.Error(rw.logger).Log("msg", "failed to write block in the background. it will be written again on the next flush", "blockID", meta.BlockID, "tenantID", meta.TenantID, "err", err)
+			}
+		}()
+		return nil
+	}
+
+	defer rw.uploads.release(size)
+	return rw.writeBlock(ctx, c, meta, bloomBytes, indexBytes)
+}
+
+func (rw *readerWriter) writeBlock(ctx context.Context, c wal.WriteableBlock, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte) error {
+	err := rw.w.Write(ctx, meta, bBloom, bIndex, c.ObjectFilePath())
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return c.Flushed()
 }
 
 func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.AppendTracker, c wal.WriteableBlock) error {
+	meta := c.BlockMeta()
 	records := c.Records()
-	indexBytes, err := encoding.MarshalRecords(records)
+	indexBytes, err := meta.MarshalIndex(records)
 	if err != nil {
 		return err
 	}
 
-	bloomBuffer := &bytes.Buffer{}
-	_, err = c.BloomFilter().WriteTo(bloomBuffer)
+	bloomBytes, err := marshalBloom(c, meta)
 	if err != nil {
 		return err
 	}
 
-	meta := c.BlockMeta()
-	err = rw.w.WriteBlockMeta(ctx, tracker, meta, bloomBuffer.Bytes(), indexBytes)
+	err = rw.w.WriteBlockMeta(ctx, tracker, meta, bloomBytes, indexBytes)
 	if err != nil {
 		return err
 	}
@@ -225,68 +555,131 @@ func (rw *readerWriter) WriteBlockMeta(ctx context.Context, tracker backend.Appe
 	return nil
 }
 
+// marshalBloom returns the block's bloom object and records the sizes of its shards and its false positive rate
+// in the meta
+func marshalBloom(c wal.WriteableBlock, meta *encoding.BlockMeta) ([]byte, error) {
+	filter := c.BloomFilter()
+	bloomBytes, shards, err := filter.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	meta.BloomFalsePositive = filter.FalsePositiveRate()
+	meta.BloomShards = nil
+	if len(shards) > 1 {
+		meta.BloomShards = shards
+	}
+	return bloomBytes, nil
+}
+
+func (rw *readerWriter) FlushAll(ctx context.Context) error {
+	return rw.uploads.wait(ctx)
+}
+
 func (rw *readerWriter) WAL() *wal.WAL {
 	return rw.wal
 }
 
-func (rw *readerWriter) Find(ctx context.Context, tenantID string, id encoding.ID) ([]byte, FindMetrics, error) {
-	metrics := FindMetrics{
-		BloomFilterReads:     atomic.NewInt32(0),
-		BloomFilterBytesRead: atomic.NewInt32(0),
-		IndexReads:           atomic.NewInt32(0),
-		IndexBytesRead:       atomic.NewInt32(0),
-		BlockReads:           atomic.NewInt32(0),
-		BlockBytesRead:       atomic.NewInt32(0),
+// readIndex returns the page of the block's index holding the record for id, or the whole index if it isn't
+// paged.  nil if the paged index shows id is past the block's last record.
+func (rw *readerWriter) readIndex(ctx context.Context, meta *encoding.BlockMeta, id encoding.ID) ([]byte, error) {
+	if meta.IndexPageSize == 0 {
+		index, err := rw.r.Index(ctx, meta.BlockID, meta.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		return meta.OpenIndex(index)
 	}
 
+	offset, length, ok := meta.IndexPage(id)
+	if !ok {
+		return nil, nil
+	}
+	page := make([]byte, length)
+	err := rw.r.ReadRange(ctx, backend.IndexName, meta.BlockID, meta.TenantID, offset, page)
+	if err != nil {
+		return nil, err
+	}
+	page, err = meta.OpenIndex(page)
+	if err != nil {
+		return nil, err
+	}
+	err = meta.VerifyIndexPage(offset, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (rw *readerWriter) Find(ctx context.Context, tenantID string, id encoding.ID, opts ...FindOption) ([]byte, FindMetrics, *FindReport, error) {
+	o := &findOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	metrics := newFindMetrics()
+
 	// tracing instrumentation
 	logger := util.WithContext(ctx, util.Logger)
 	span, derivedCtx := opentracing.StartSpanFromContext(ctx, "store.Find")
 	defer span.Finish()
 
+	report := &FindReport{}
+
 	rw.blockListsMtx.Lock()
 	blocklist, found := rw.blockLists[tenantID]
 	copiedBlocklist := make([]interface{}, 0, len(blocklist))
 	for _, b := range blocklist {
 		// if in range copy
 		if bytes.Compare(id, b.MinID) != -1 && bytes.Compare(id, b.MaxID) != 1 {
-			copiedBlocklist = append(copiedBlocklist, b)
+			report.Blocks++
+			if !o.includes(b) {
+				report.PrunedBlocks++
+				continue
+			}
+			copiedBlocklist = append(copiedBlocklist, &findJob{meta: b, metrics: newFindMetrics()})
 		}
 	}
 	rw.blockListsMtx.Unlock()
+	span.SetTag("blocks", len(copiedBlocklist))
 
 	if !found {
-		return nil, metrics, fmt.Errorf("tenantID %s not found", tenantID)
+		return nil, metrics, report, fmt.Errorf("tenantID %s not found", tenantID)
 	}
 
-	foundBytes, err := rw.pool.RunJobs(derivedCtx, copiedBlocklist, func(ctx context.Context, payload interface{}) ([]byte, error) {
-		meta := payload.(*encoding.BlockMeta)
+	searchBlock := func(ctx context.Context, job *findJob) ([]byte, error) {
+		meta, metrics := job.meta, job.metrics
 
-		bloomBytes, err := rw.r.Bloom(ctx, meta.BlockID, tenantID)
+		// fail blocks of unknown formats before reading anything
+		format, err := meta.PageFormat()
 		if err != nil {
-			return nil, fmt.Errorf("error retrieving bloom %v", err)
+			return nil, err
 		}
 
-		filter := &bloom.BloomFilter{}
-		_, err = filter.ReadFrom(bytes.NewReader(bloomBytes))
+		filter, err := rw.bloomFilter(ctx, meta, meta.BloomShard(id), metrics)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing bloom %v", err)
+			return nil, err
 		}
-
-		metrics.BloomFilterReads.Inc()
-		metrics.BloomFilterBytesRead.Add(int32(len(bloomBytes)))
 		if !filter.Test(id) {
 			return nil, nil
 		}
 
-		indexBytes, err := rw.r.Index(ctx, meta.BlockID, tenantID)
+		indexBytes, err := rw.readIndex(ctx, meta, id)
 		metrics.IndexReads.Inc()
 		metrics.IndexBytesRead.Add(int32(len(indexBytes)))
 		if err != nil {
 			return nil, fmt.Errorf("error reading index %v", err)
 		}
+		if indexBytes == nil {
+			return nil, nil
+		}
 
-		record, err := encoding.FindRecord(id, indexBytes) // todo: replace with backend.Finder
+		var record *encoding.Record
+		err = rw.pool.CPUBound(ctx, func() error {
+			var err error
+			record, err = encoding.FindRecord(id, indexBytes) // todo: replace with backend.Finder
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("error finding record %v", err)
 		}
@@ -303,20 +696,28 @@ func (rw *readerWriter) Find(ctx context.Context, tenantID string, id encoding.I
 			return nil, fmt.Errorf("error reading object %v", err)
 		}
 
-		iter := encoding.NewIterator(bytes.NewReader(objectBytes))
 		var foundObject []byte
-		for {
-			iterID, iterObject, err := iter.Next()
-			if iterID == nil {
-				break
-			}
+		err = rw.pool.CPUBound(ctx, func() error {
+			iter, err := encoding.NewPageIterator(format, objectBytes)
 			if err != nil {
-				return nil, err
+				return fmt.Errorf("block %s page at offset %d: %w", meta.BlockID, record.Start, err)
 			}
-			if bytes.Equal(iterID, id) {
-				foundObject = iterObject
-				break
+			for {
+				iterID, iterObject, err := iter.Next()
+				if iterID == nil {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if bytes.Equal(iterID, id) {
+					foundObject = iterObject
+					return nil
+				}
 			}
+		})
+		if err != nil {
+			return nil, err
 		}
 		level.Info(logger).Log("msg", "searching for trace in block", "traceID", hex.EncodeToString(id), "block", meta.BlockID, "found", foundObject != nil)
 		span.LogFields(ot_log.String("msg", "searching for trace in block"), ot_log.String("traceID", hex.EncodeToString(id)), ot_log.String("block", meta.BlockID.String()), ot_log.Bool("found", foundObject != nil))
@@ -324,9 +725,188 @@ func (rw *readerWriter) Find(ctx context.Context, tenantID string, id encoding.I
 			span.SetTag("object bytes", len(foundObject))
 		}
 		return foundObject, nil
+	}
+	findInBlock := func(ctx context.Context, payload interface{}) ([]byte, error) {
+		job := payload.(*findJob)
+		foundBytes, err := searchBlock(ctx, job)
+		if err != nil && rw.blockGone(ctx, job.meta) {
+			// the blocklist is stale.  the block's objects are in the blocks compacted from it
+			level.Warn(logger).Log("msg", "skipping block deleted since the blocklist was polled", "block", job.meta.BlockID, "err", err)
+			metricFindBlocksGone.Inc()
+			job.gone = true
+			return nil, nil
+		}
+		return foundBytes, err
+	}
+	// a block deduplicated onto another query's search completes with that query's job.  note which job so
+	// its reads and outcome are counted for this query too
+	jobDone := func(payload, ran interface{}, err error) {
+		job := payload.(*findJob)
+		job.err = err
+		if ran != nil {
+			job.ran = ran.(*findJob)
+		}
+	}
+
+	results, unadmitted, err := rw.pool.RunJobsPartial(derivedCtx, copiedBlocklist, findInBlock, pool.WithTenant(tenantID), pool.WithJobType("trace_by_id"), pool.WithStopOnFirstResult(o.combiner == nil), pool.WithPayloadKey(blockIDKey), pool.WithJobDone(jobDone), pool.WithDedupKey(func(payload interface{}) string {
+		// a retried query for the same trace can share the in flight block reads
+		return tenantID + "/" + hex.EncodeToString(id) + "/" + blockIDKey(payload)
+	}))
+	errs := tempo_util.MultiError{}
+	errs.Add(err)
+	defer func() {
+		for _, payload := range copiedBlocklist {
+			job := payload.(*findJob)
+			if job.ran == nil {
+				continue
+			}
+			metrics.add(job.ran.metrics)
+			if job.err == nil && !job.ran.gone {
+				report.SearchedBlocks++
+			}
+		}
+		span.SetTag("failed_blocks", len(report.FailedBlocks))
+	}()
+
+	if len(results) > 0 && o.combiner == nil {
+		// other blocks failing doesn't fail the query, but the caller may want to know the trace could be incomplete
+		_ = report.addErr(errs.Err())
+		return results[0], metrics, report, nil
+	}
+
+	// the pool is too busy to take every block.  search the rest ourselves rather than failing the query
+	if len(unadmitted) > 0 {
+		level.Warn(logger).Log("msg", "work queue full, searching remaining blocks sequentially", "blocks", len(unadmitted))
+	}
+
+	for _, payload := range unadmitted {
+		if derivedCtx.Err() != nil {
+			errs.Add(derivedCtx.Err())
+			break
+		}
+
+		foundBytes, err := findInBlock(derivedCtx, payload)
+		jobDone(payload, payload, err)
+		if err != nil {
+			errs.Add(&pool.JobError{TenantID: tenantID, Key: blockIDKey(payload), Err: err})
+			continue
+		}
+		if foundBytes != nil && o.combiner != nil {
+			results = append(results, foundBytes)
+			continue
+		}
+		if foundBytes != nil {
+			_ = report.addErr(errs.Err())
+			return foundBytes, metrics, report, nil
+		}
+	}
+
+	if len(results) > 0 {
+		_ = report.addErr(errs.Err())
+		return combineObjects(o.combiner, results), metrics, report, nil
+	}
+
+	// block failures are in the report.  only an error that prevented the search itself fails Find
+	return nil, metrics, report, report.addErr(errs.Err())
+}
+
+// blockGone returns true if the block's meta is gone, i.e. the block was compacted or deleted since it was polled.
+// Queries read the meta only after failing to read the block, so a block cleared mid-query isn't an error.
+func (rw *readerWriter) blockGone(ctx context.Context, meta *encoding.BlockMeta) bool {
+	_, err := rw.r.BlockMeta(ctx, meta.BlockID, meta.TenantID)
+	return err == backend.ErrMetaDoesNotExist
+}
+
+// combineObjects combines the objects in byte order so the result is the same however they were found
+func combineObjects(combiner encoding.ObjectCombiner, objects [][]byte) []byte {
+	sort.Slice(objects, func(i, j int) bool {
+		return bytes.Compare(objects[i], objects[j]) == -1
 	})
 
-	return foundBytes, metrics, err
+	combined := objects[0]
+	for _, obj := range objects[1:] {
+		combined = combiner.Combine(combined, obj)
+	}
+	return combined
+}
+
+// bloomFilter returns the parsed shard of the block's bloom filter from the meta cache or the backend.  Blocks with a
+// single bloom filter have one shard.
+func (rw *readerWriter) bloomFilter(ctx context.Context, meta *encoding.BlockMeta, shard int, metrics FindMetrics) (*bloom.BloomFilter, error) {
+	// the cached shards are never modified.  a shard read later is added to a copy
+	var shards []*bloom.BloomFilter
+	if cached, ok := rw.metaCache.get(metaCacheTypeBloom, meta.BlockID, meta.TenantID); ok {
+		shards = cached.(*cachedBloom).shards
+		if shards[shard] != nil {
+			return shards[shard], nil
+		}
+	}
+
+	var bloomBytes []byte
+	var err error
+	if len(meta.BloomShards) == 0 {
+		bloomBytes, err = rw.r.Bloom(ctx, meta.BlockID, meta.TenantID)
+	} else {
+		offset, length := meta.BloomShardRange(shard)
+		bloomBytes = make([]byte, length)
+		err = rw.r.ReadRange(ctx, backend.BloomName, meta.BlockID, meta.TenantID, offset, bloomBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving bloom %v", err)
+	}
+	metrics.BloomFilterReads.Inc()
+	metrics.BloomFilterBytesRead.Add(int32(len(bloomBytes)))
+
+	// backend reads are IO bound and run on the pool's workers.  parsing and searching what was read
+	// is CPU bound and limited separately so a pool sized for backend latency doesn't swamp the cores
+	filter := &bloom.BloomFilter{}
+	err = rw.pool.CPUBound(ctx, func() error {
+		_, err := filter.ReadFrom(bytes.NewReader(bloomBytes))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing bloom %v", err)
+	}
+
+	entry := &cachedBloom{
+		shards: make([]*bloom.BloomFilter, meta.BloomShardCount()),
+		size:   len(bloomBytes),
+	}
+	for i, s := range shards {
+		if s != nil {
+			entry.shards[i] = s
+			entry.size += int(meta.BloomShards[i])
+		}
+	}
+	entry.shards[shard] = filter
+	rw.metaCache.put(metaCacheTypeBloom, meta.BlockID, meta.TenantID, entry, entry.size)
+	return filter, nil
+}
+
+// findJob is a block searched by Find
+type findJob struct {
+	meta    *encoding.BlockMeta
+	metrics FindMetrics // reads made searching the block
+	gone    bool        // the block was deleted since the blocklist was polled
+
+	// set when the search completes.  ran is the job that searched the block, another query's if the search
+	// was deduplicated
+	ran *findJob
+	err error
+}
+
+// blockIDKey identifies *encoding.BlockMeta and *findJob payloads in pool errors
+func blockIDKey(payload interface{}) string {
+	if job, ok := payload.(*findJob); ok {
+		return job.meta.BlockID.String()
+	}
+	return payload.(*encoding.BlockMeta).BlockID.String()
+}
+
+// ReconfigurePool resizes the work pool.  Values <= 0 restore the statically configured value.
+func (rw *readerWriter) ReconfigurePool(maxWorkers int, queueDepth int) {
+	level.Info(rw.logger).Log("msg", "reconfiguring work pool", "maxWorkers", maxWorkers, "queueDepth", queueDepth)
+	rw.pool.Reconfigure(maxWorkers, queueDepth)
 }
 
 func (rw *readerWriter) Shutdown() {
@@ -336,179 +916,228 @@ func (rw *readerWriter) Shutdown() {
 }
 
 func (rw *readerWriter) EnableCompaction(cfg *CompactorConfig, c CompactorSharder) {
+	if rw.cfg.ReadOnly {
+		level.Info(rw.logger).Log("msg", "backend is read only.  compaction, retention and tenant index building disabled.")
+		return
+	}
+
+	rw.compactorMtx.Lock()
 	rw.compactorCfg = cfg
 	rw.compactorSharder = c
+	rw.compactorMtx.Unlock()
 
 	if rw.cfg.MaintenanceCycle == 0 {
 		level.Info(rw.logger).Log("msg", "maintenance cycle unset.  compaction and retention disabled.")
 		return
 	}
 
-	if cfg != nil {
-		level.Info(rw.logger).Log("msg", "compaction and retention enabled.")
+	if cfg == nil {
+		return
+	}
+
+	// compacted blocks are still read by queriers that haven't polled since they were compacted
+	if stale := rw.cfg.MaintenanceCycle + rw.cfg.BlocklistPollJitter; !cfg.DisableRetention && cfg.CompactedBlockRetention < stale {
+		level.Warn(rw.logger).Log("msg", "compacted block retention is shorter than the blocklist poll.  queriers may read blocks after they're deleted", "compactedBlockRetention", cfg.CompactedBlockRetention, "poll", stale)
+	}
+
+	if cfg.DisableCompaction {
+		level.Info(rw.logger).Log("msg", "compaction disabled.")
+	} else {
+		level.Info(rw.logger).Log("msg", "compaction enabled.", "cycle", rw.compactionCycle(), "concurrency", cfg.CompactionConcurrency)
 		go rw.compactionLoop()
+	}
+
+	if cfg.DisableRetention {
+		level.Info(rw.logger).Log("msg", "retention disabled.")
+	} else {
+		level.Info(rw.logger).Log("msg", "retention enabled.", "cycle", rw.retentionCycle(), "concurrency", cfg.RetentionConcurrency)
 		go rw.retentionLoop()
 	}
 }
 
-func (rw *readerWriter) maintenanceLoop() {
-	if rw.cfg.MaintenanceCycle == 0 {
-		level.Info(rw.logger).Log("msg", "maintenance cycle unset.  blocklist polling disabled.")
-		return
+// todo: pass a context/chan in to cancel this cleanly
+//  once a retention cycle cleanup any blocks
+func (rw *readerWriter) retentionLoop() {
+	ticker := time.NewTicker(rw.retentionCycle())
+	for range ticker.C {
+		rw.doRetention()
 	}
+}
 
-	rw.pollBlocklist()
+func (rw *readerWriter) SetCompactorOverrides(o CompactorOverrides) {
+	rw.compactorOverrides = o
+}
 
-	ticker := time.NewTicker(rw.cfg.MaintenanceCycle)
-	for range ticker.C {
-		rw.pollBlocklist()
+// blockRetention is the tenant's override or the configured retention
+func (rw *readerWriter) blockRetention(tenantID string) time.Duration {
+	if rw.compactorOverrides != nil {
+		if retention := rw.compactorOverrides.BlockRetention(tenantID); retention > 0 {
+			return retention
+		}
 	}
+	return rw.compactorCfg.BlockRetention
 }
 
-func (rw *readerWriter) pollBlocklist() {
-	start := time.Now()
-	defer func() { metricBlocklistPollDuration.Observe(time.Since(start).Seconds()) }()
+func retentionHash(tenantID string) string {
+	return "retention-" + tenantID
+}
 
-	ctx := context.Background()
-	tenants, err := rw.r.Tenants(ctx)
-	if err != nil {
-		metricBlocklistErrors.WithLabelValues("").Inc()
-		level.Error(rw.logger).Log("msg", "error retrieving tenants while polling blocklist", "err", err)
+// retentionCycle defaults to the maintenance cycle
+func (rw *readerWriter) retentionCycle() time.Duration {
+	if rw.compactorCfg.RetentionCycle > 0 {
+		return rw.compactorCfg.RetentionCycle
 	}
+	return rw.cfg.MaintenanceCycle
+}
 
-	for _, tenantID := range tenants {
-		blockIDs, err := rw.r.Blocks(ctx, tenantID)
-		if err != nil {
-			metricBlocklistErrors.WithLabelValues(tenantID).Inc()
-			level.Error(rw.logger).Log("msg", "error polling blocklist", "tenantID", tenantID, "err", err)
-		}
+func (rw *readerWriter) doRetention() {
+	// retention runs on its own workers rather than the work pool so deletes keep up however busy the
+	// pool is with queries or compaction
+	forEachTenant(rw.blocklistTenants(), rw.compactorCfg.RetentionConcurrency, rw.retainTenant)
 
-		interfaceSlice := make([]interface{}, 0, len(blockIDs))
-		for _, id := range blockIDs {
-			interfaceSlice = append(interfaceSlice, id)
-		}
+	if rw.migratesToColdTier() {
+		forEachTenant(rw.blocklistTenants(), rw.compactorCfg.RetentionConcurrency, rw.migrateTenant)
+	}
+
+	if rw.mirror != nil {
+		forEachTenant(rw.blocklistTenants(), rw.compactorCfg.RetentionConcurrency, rw.reconcileMirror)
+	}
+}
 
-		listMutex := sync.Mutex{}
-		blocklist := make([]*encoding.BlockMeta, 0, len(blockIDs))
-		compactedBlocklist := make([]*encoding.CompactedBlockMeta, 0, len(blockIDs))
-		_, err = rw.pool.RunJobs(ctx, interfaceSlice, func(ctx context.Context, payload interface{}) ([]byte, error) {
-			blockID := payload.(uuid.UUID)
+// retainTenant applies retention to a tenant.  Tenants are split between the compactors so blocks are only marked and
+// cleared once per cycle rather than by every compactor at once.
+func (rw *readerWriter) retainTenant(tenantID string) {
+	rw.compactorMtx.Lock()
+	owns := rw.compactorSharder.Owns(retentionHash(tenantID))
+	rw.compactorMtx.Unlock()
+	if !owns {
+		return
+	}
 
-			var compactedBlockMeta *encoding.CompactedBlockMeta
-			blockMeta, err := rw.r.BlockMeta(ctx, blockID, tenantID)
-			// if the normal meta doesn't exist maybe it's compacted.
-			if err == backend.ErrMetaDoesNotExist {
-				blockMeta = nil
-				compactedBlockMeta, err = rw.c.CompactedBlockMeta(blockID, tenantID)
-			}
+	start := time.Now()
+	defer func() { metricRetentionDuration.Observe(time.Since(start).Seconds()) }()
 
+	// iterate through block list.  make compacted anything that is past retention.
+	cutoff := time.Now().Add(-rw.blockRetention(tenantID))
+	blocklist := rw.blocklist(tenantID)
+	for _, b := range blocklist {
+		if b.EndTime.Before(cutoff) {
+			level.Info(rw.logger).Log("msg", "marking block for deletion", "blockID", b.BlockID, "tenantID", tenantID)
+			err := rw.c.MarkBlockCompacted(b.BlockID, tenantID)
 			if err != nil {
-				metricBlocklistErrors.WithLabelValues(tenantID).Inc()
-				level.Error(rw.logger).Log("msg", "failed to retrieve block meta", "tenantID", tenantID, "blockID", blockID, "err", err)
-				return nil, nil
+				level.Error(rw.logger).Log("msg", "failed to mark block compacted during retention", "blockID", b.BlockID, "tenantID", tenantID, "err", err)
+				metricRetentionErrors.Inc()
+			} else {
+				metricMarkedForDeletion.Inc()
 			}
+		}
+	}
 
-			// todo:  make this not terrible. this mutex is dumb we should be returning results with a channel. shoehorning this into the worker pool is silly.
-			//        make the worker pool more generic? and reusable in this case
-			listMutex.Lock()
-			if blockMeta != nil {
-				blocklist = append(blocklist, blockMeta)
+	// iterate through compacted list looking for blocks ready to be cleared
+	cutoff = time.Now().Add(-rw.compactorCfg.CompactedBlockRetention)
+	compactedBlocklist := rw.compactedBlocklist(tenantID)
+	var expired []uuid.UUID
+	for _, b := range compactedBlocklist {
+		if b.CompactedTime.Before(cutoff) {
+			level.Info(rw.logger).Log("msg", "deleting block", "blockID", b.BlockID, "tenantID", tenantID)
+			expired = append(expired, b.BlockID)
+		}
+	}
 
-			} else if compactedBlockMeta != nil {
-				compactedBlocklist = append(compactedBlocklist, compactedBlockMeta)
-			}
-			listMutex.Unlock()
+	// blocks with invalid metas aren't in either list.  they are cleared once they've been quarantined long enough
+	// for someone to repair them
+	if rw.compactorCfg.QuarantinedBlockRetention > 0 {
+		cutoff = time.Now().Add(-rw.compactorCfg.QuarantinedBlockRetention)
+		for _, blockID := range rw.expiredQuarantined(tenantID, cutoff) {
+			level.Info(rw.logger).Log("msg", "deleting quarantined block", "blockID", blockID, "tenantID", tenantID)
+			expired = append(expired, blockID)
+		}
+	}
 
-			return nil, nil
-		})
+	// clear in batches so tenants with many expired blocks use the backend's bulk deletes
+	for len(expired) > 0 {
+		batch := expired
+		if len(batch) > retentionClearBatchSize {
+			batch = batch[:retentionClearBatchSize]
+		}
+		expired = expired[len(batch):]
 
+		err := rw.c.ClearBlocks(batch, tenantID)
 		if err != nil {
-			metricBlocklistErrors.WithLabelValues(tenantID).Inc()
-			level.Error(rw.logger).Log("msg", "run blocklist jobs", "tenantID", tenantID, "err", err)
-			continue
+			level.Error(rw.logger).Log("msg", "failed to clear compacted blocks during retention", "blocks", len(batch), "tenantID", tenantID, "err", err)
+			metricRetentionErrors.Inc()
+		} else {
+			metricDeleted.Add(float64(len(batch)))
 		}
+	}
+}
 
-		metricBlocklistLength.WithLabelValues(tenantID).Set(float64(len(blocklist)))
+// DeleteBlock clears a block from the backend immediately instead of waiting on retention, e.g. to remove
+// a corrupt block.  The block is dropped from this instance's blocklist right away.  Everyone else drops
+// it on their next poll.
+func (rw *readerWriter) DeleteBlock(ctx context.Context, tenantID string, blockID uuid.UUID) error {
+	if tenantID == "" {
+		return backend.ErrEmptyTenantID
+	}
+	if blockID == uuid.Nil {
+		return backend.ErrEmptyBlockID
+	}
 
-		sort.Slice(blocklist, func(i, j int) bool {
-			return blocklist[i].StartTime.Before(blocklist[j].StartTime)
-		})
-		sort.Slice(compactedBlocklist, func(i, j int) bool {
-			return compactedBlocklist[i].StartTime.Before(compactedBlocklist[j].StartTime)
-		})
+	// make sure the block exists so a typo isn't reported as a successful delete
+	_, err := rw.r.BlockMeta(ctx, blockID, tenantID)
+	if err == backend.ErrMetaDoesNotExist {
+		_, err = rw.c.CompactedBlockMeta(blockID, tenantID)
+	}
+	if err != nil {
+		return err
+	}
 
-		rw.blockListsMtx.Lock()
-		rw.blockLists[tenantID] = blocklist
-		rw.compactedBlockLists[tenantID] = compactedBlocklist
-		rw.blockListsMtx.Unlock()
+	level.Info(rw.logger).Log("msg", "deleting block", "blockID", blockID, "tenantID", tenantID)
+	err = rw.c.ClearBlock(blockID, tenantID)
+	if err != nil {
+		return err
 	}
+	metricDeleted.Inc()
+
+	rw.removeFromBlocklist(tenantID, blockID)
+	rw.notifyBlocklistChange(BlocklistChange{
+		TenantID: tenantID,
+		Removed:  []uuid.UUID{blockID},
+	})
+
+	return nil
 }
 
-// todo: pass a context/chan in to cancel this cleanly
-//  once a maintenance cycle cleanup any blocks
-func (rw *readerWriter) retentionLoop() {
-	ticker := time.NewTicker(rw.cfg.MaintenanceCycle)
-	for range ticker.C {
-		rw.doRetention()
+func (rw *readerWriter) removeFromBlocklist(tenantID string, blockID uuid.UUID) {
+	rw.blockListsMtx.Lock()
+	defer rw.blockListsMtx.Unlock()
+
+	if _, ok := rw.blockLists[tenantID]; !ok {
+		return
 	}
-}
 
-func (rw *readerWriter) doRetention() {
-	tenants := rw.blocklistTenants()
-
-	// todo: continued abuse of runJobs.  need a runAllJobs() method or something
-	_, err := rw.pool.RunJobs(context.TODO(), tenants, func(_ context.Context, payload interface{}) ([]byte, error) {
-		start := time.Now()
-		defer func() { metricRetentionDuration.Observe(time.Since(start).Seconds()) }()
-
-		tenantID := payload.(string)
-
-		// iterate through block list.  make compacted anything that is past retention.
-		cutoff := time.Now().Add(-rw.compactorCfg.BlockRetention)
-		blocklist := rw.blocklist(tenantID)
-		for _, b := range blocklist {
-			if b.EndTime.Before(cutoff) {
-				level.Info(rw.logger).Log("msg", "marking block for deletion", "blockID", b.BlockID, "tenantID", tenantID)
-				err := rw.c.MarkBlockCompacted(b.BlockID, tenantID)
-				if err != nil {
-					level.Error(rw.logger).Log("msg", "failed to mark block compacted during retention", "blockID", b.BlockID, "tenantID", tenantID, "err", err)
-					metricRetentionErrors.Inc()
-				} else {
-					metricMarkedForDeletion.Inc()
-				}
-			}
+	blocklist := make([]*encoding.BlockMeta, 0, len(rw.blockLists[tenantID]))
+	for _, b := range rw.blockLists[tenantID] {
+		if b.BlockID != blockID {
+			blocklist = append(blocklist, b)
 		}
+	}
+	rw.blockLists[tenantID] = blocklist
 
-		// iterate through compacted list looking for blocks ready to be cleared
-		cutoff = time.Now().Add(-rw.compactorCfg.CompactedBlockRetention)
-		compactedBlocklist := rw.compactedBlocklist(tenantID)
-		for _, b := range compactedBlocklist {
-			if b.CompactedTime.Before(cutoff) {
-				level.Info(rw.logger).Log("msg", "deleting block", "blockID", b.BlockID, "tenantID", tenantID)
-				err := rw.c.ClearBlock(b.BlockID, tenantID)
-				if err != nil {
-					level.Error(rw.logger).Log("msg", "failed to clear compacted block during retention", "blockID", b.BlockID, "tenantID", tenantID, "err", err)
-					metricRetentionErrors.Inc()
-				} else {
-					metricDeleted.Inc()
-				}
-			}
+	compactedBlocklist := make([]*encoding.CompactedBlockMeta, 0, len(rw.compactedBlockLists[tenantID]))
+	for _, b := range rw.compactedBlockLists[tenantID] {
+		if b.BlockID != blockID {
+			compactedBlocklist = append(compactedBlocklist, b)
 		}
-
-		return nil, nil
-	})
-
-	if err != nil {
-		level.Error(rw.logger).Log("msg", "failure to start retention.  retention disabled until the next maintenance cycle", "err", err)
-		metricRetentionErrors.Inc()
 	}
+	rw.compactedBlockLists[tenantID] = compactedBlocklist
 }
 
-func (rw *readerWriter) blocklistTenants() []interface{} {
+func (rw *readerWriter) blocklistTenants() []string {
 	rw.blockListsMtx.Lock()
 	defer rw.blockListsMtx.Unlock()
 
-	tenants := make([]interface{}, 0, len(rw.blockLists))
+	tenants := make([]string, 0, len(rw.blockLists))
 	for tenant := range rw.blockLists {
 		tenants = append(tenants, tenant)
 	}
@@ -516,6 +1145,32 @@ func (rw *readerWriter) blocklistTenants() []interface{} {
 	return tenants
 }
 
+// forEachTenant calls fn for every tenant on concurrency goroutines and waits for them to finish.  tenants
+// are handed out one at a time so a single large tenant doesn't hold up the others.
+func forEachTenant(tenants []string, concurrency int, fn func(tenantID string)) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	tenantCh := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tenantID := range tenantCh {
+				fn(tenantID)
+			}
+		}()
+	}
+
+	for _, tenantID := range tenants {
+		tenantCh <- tenantID
+	}
+	close(tenantCh)
+	wg.Wait()
+}
+
 func (rw *readerWriter) blocklist(tenantID string) []*encoding.BlockMeta {
 	rw.blockListsMtx.Lock()
 	defer rw.blockListsMtx.Unlock()
@@ -2,10 +2,14 @@ package tempodb
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,9 +19,11 @@ import (
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/pkg/tempopb"
 	"github.com/grafana/tempo/pkg/util/test"
+	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/grafana/tempo/tempodb/backend/local"
 	"github.com/grafana/tempo/tempodb/wal"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
 )
 
 const (
@@ -86,7 +92,7 @@ func TestDB(t *testing.T) {
 
 	// read
 	for i, id := range ids {
-		bFound, _, err := r.Find(context.Background(), testTenantID, id)
+		bFound, _, _, err := r.Find(context.Background(), testTenantID, id)
 		assert.NoError(t, err)
 
 		out := &tempopb.PushRequest{}
@@ -151,6 +157,126 @@ func TestRetention(t *testing.T) {
 	checkBlocklists(t, blockID, 0, 0, rw)
 }
 
+// ownsSharder owns only the hashes it's given
+type ownsSharder struct {
+	mockSharder
+	owned map[string]bool
+}
+
+func (s *ownsSharder) Owns(hash string) bool {
+	return s.owned[hash]
+}
+
+func TestRetentionSharded(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	// this compactor only applies retention to the test tenant
+	c.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:          10,
+		MaxCompactionRange:      time.Hour,
+		BlockRetention:          0,
+		CompactedBlockRetention: time.Hour,
+	}, &ownsSharder{owned: map[string]bool{retentionHash(testTenantID): true}})
+
+	for _, tenantID := range []string{testTenantID, "other"} {
+		head, err := w.WAL().NewBlock(uuid.New(), tenantID)
+		assert.NoError(t, err)
+		err = head.Write(make([]byte, 16), []byte{0x01})
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	rw.doRetention()
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 0)
+	assert.Len(t, rw.compactedBlocklist(testTenantID), 1)
+	assert.Len(t, rw.blocklist("other"), 1)
+	assert.Len(t, rw.compactedBlocklist("other"), 0)
+}
+
+type retentionOverrides map[string]time.Duration
+
+func (o retentionOverrides) BlockRetention(tenantID string) time.Duration {
+	return o[tenantID]
+}
+
+func TestTenantRetention(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	// the tenant keeps its blocks for an hour while other tenants' expire right away
+	overrides := retentionOverrides{testTenantID: time.Hour}
+	c.SetCompactorOverrides(overrides)
+	c.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:          10,
+		MaxCompactionRange:      time.Hour,
+		BlockRetention:          0,
+		CompactedBlockRetention: time.Hour,
+	}, &mockSharder{})
+
+	for _, tenantID := range []string{testTenantID, "other"} {
+		head, err := w.WAL().NewBlock(uuid.New(), tenantID)
+		assert.NoError(t, err)
+		err = head.Write(make([]byte, 16), []byte{0x01})
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	rw.doRetention()
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+	assert.Len(t, rw.blocklist("other"), 0)
+	assert.Len(t, rw.compactedBlocklist("other"), 1)
+
+	// without an override the tenant uses the configured retention
+	delete(overrides, testTenantID)
+	rw.doRetention()
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 0)
+	assert.Len(t, rw.compactedBlocklist(testTenantID), 1)
+}
+
 func checkBlocklists(t *testing.T, expectedID uuid.UUID, expectedB int, expectedCB int, rw *readerWriter) {
 	rw.pollBlocklist()
 
@@ -179,3 +305,637 @@ func checkBlocklists(t *testing.T, expectedID uuid.UUID, expectedB int, expected
 		lastTime = b.StartTime
 	}
 }
+
+func TestTenantIndex(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	newRW := func(walDir string) *readerWriter {
+		r, _, _, err := New(&Config{
+			Backend: "local",
+			Local: &local.Config{
+				Path: path.Join(tempDir, "traces"),
+			},
+			WAL: &wal.Config{
+				Filepath:        path.Join(tempDir, walDir),
+				IndexDownsample: 17,
+				BloomFP:         .01,
+			},
+			MaintenanceCycle:              0,
+			BlocklistPollStaleTenantIndex: time.Hour,
+		}, log.NewNopLogger())
+		assert.NoError(t, err)
+		return r.(*readerWriter)
+	}
+
+	// the builder owns the tenant.  the reader doesn't compact
+	builder := newRW("wal-builder")
+	builder.EnableCompaction(&CompactorConfig{
+		ChunkSizeBytes:     10,
+		MaxCompactionRange: time.Hour,
+	}, &mockSharder{})
+	reader := newRW("wal-reader")
+
+	writeBlock := func() uuid.UUID {
+		head, err := builder.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		complete, err := head.Complete(builder.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = builder.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+		return complete.BlockMeta().BlockID
+	}
+
+	blockID := writeBlock()
+
+	// without an index the reader lists the tenant
+	checkBlocklists(t, blockID, 1, 0, reader)
+
+	// the builder lists the tenant and writes the index
+	checkBlocklists(t, blockID, 1, 0, builder)
+	index, err := builder.r.TenantIndex(context.Background(), testTenantID)
+	assert.NoError(t, err)
+	assert.Len(t, index.Meta, 1)
+
+	// the reader now uses the index and won't see a new block until the index is rebuilt
+	writeBlock()
+	checkBlocklists(t, blockID, 1, 0, reader)
+	checkBlocklists(t, uuid.Nil, 2, 0, builder)
+	checkBlocklists(t, uuid.Nil, 2, 0, reader)
+
+	// a stale index is ignored
+	writeBlock()
+	reader.cfg.BlocklistPollStaleTenantIndex = time.Nanosecond
+	checkBlocklists(t, uuid.Nil, 3, 0, reader)
+}
+
+func TestFindTimeRange(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+
+	r.(*readerWriter).pollBlocklist()
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		start    time.Time
+		end      time.Time
+		expected []byte
+	}{
+		{name: "no range", expected: []byte{0x01}},
+		{name: "includes block", start: now.Add(-time.Hour), end: now.Add(time.Hour), expected: []byte{0x01}},
+		{name: "open start", end: now.Add(time.Hour), expected: []byte{0x01}},
+		{name: "before block", start: now.Add(-2 * time.Hour), end: now.Add(-time.Hour)},
+		{name: "after block", start: now.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, metrics, _, err := r.Find(context.Background(), testTenantID, id, WithTimeRange(tt.start, tt.end))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, found)
+			if tt.expected == nil {
+				assert.Equal(t, int32(0), metrics.BloomFilterReads.Load())
+			}
+		})
+	}
+}
+
+func TestFindCombines(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	// the object is split across three blocks
+	id := make([]byte, 16)
+	rand.Read(id)
+	for _, obj := range [][]byte{{0x02}, {0x01}, {0x03}} {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		err = head.Write(id, obj)
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	r.(*readerWriter).pollBlocklist()
+
+	found, _, report, err := r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	for i := 0; i < 5; i++ {
+		found, _, report, err = r.Find(context.Background(), testTenantID, id, WithCombiner(&concatCombiner{}))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x01, 0x02, 0x03}, found)
+		assert.Equal(t, 3, report.SearchedBlocks)
+	}
+}
+
+type concatCombiner struct{}
+
+func (c *concatCombiner) Combine(objA []byte, objB []byte) []byte {
+	return append(append([]byte{}, objA...), objB...)
+}
+
+func TestFindReport(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+	blockID := complete.BlockMeta().BlockID
+
+	r.(*readerWriter).pollBlocklist()
+
+	found, _, report, err := r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, found)
+	assert.False(t, report.Partial())
+	assert.Equal(t, 1, report.Blocks)
+	assert.Equal(t, 1, report.SearchedBlocks)
+	assert.Equal(t, 0, report.SkippedBlocks())
+
+	_, _, report, err = r.Find(context.Background(), testTenantID, id, WithTimeRange(time.Now().Add(time.Hour), time.Time{}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.PrunedBlocks)
+	assert.Equal(t, 0, report.SkippedBlocks())
+
+	// a block that can't be read is reported instead of failing the find
+	err = os.Remove(path.Join(tempDir, "traces", testTenantID, blockID.String(), "index"))
+	assert.NoError(t, err)
+
+	found, _, report, err = r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	assert.True(t, report.Partial())
+	assert.Len(t, report.FailedBlocks, 1)
+	assert.Equal(t, blockID.String(), report.FailedBlocks[0].Key)
+	assert.Equal(t, testTenantID, report.FailedBlocks[0].TenantID)
+	assert.Equal(t, 0, report.SearchedBlocks)
+}
+
+// blockingReader holds every Object read until unblock is closed
+type blockingReader struct {
+	backend.Reader
+
+	reads   *atomic.Int32
+	unblock chan struct{}
+}
+
+func (r *blockingReader) Object(ctx context.Context, blockID uuid.UUID, tenantID string, offset uint64, buffer []byte) error {
+	r.reads.Inc()
+	<-r.unblock
+	return r.Reader.Object(ctx, blockID, tenantID, offset, buffer)
+}
+
+func TestFindReportDeduplicated(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	for _, obj := range [][]byte{{0x01}, {0x02}} {
+		head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+		assert.NoError(t, err)
+		err = head.Write(id, obj)
+		assert.NoError(t, err)
+		complete, err := head.Complete(w.WAL(), &mockSharder{})
+		assert.NoError(t, err)
+		err = w.WriteBlock(context.Background(), complete)
+		assert.NoError(t, err)
+	}
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	reader := &blockingReader{
+		Reader:  rw.r,
+		reads:   atomic.NewInt32(0),
+		unblock: make(chan struct{}),
+	}
+	rw.r = reader
+
+	type findResult struct {
+		found   []byte
+		metrics FindMetrics
+		report  *FindReport
+		err     error
+	}
+	results := make(chan findResult, 2)
+	find := func() {
+		found, metrics, report, err := r.Find(context.Background(), testTenantID, id, WithCombiner(&concatCombiner{}))
+		results <- findResult{found, metrics, report, err}
+	}
+
+	// the second find's block searches are deduplicated onto the first's while its object reads are held
+	go find()
+	assert.Eventually(t, func() bool { return reader.reads.Load() == 2 }, time.Second, time.Millisecond)
+	go find()
+	time.Sleep(100 * time.Millisecond)
+	close(reader.unblock)
+
+	for i := 0; i < 2; i++ {
+		res := <-results
+		assert.NoError(t, res.err)
+		assert.Equal(t, []byte{0x01, 0x02}, res.found)
+		assert.Equal(t, 2, res.report.SearchedBlocks)
+		assert.Equal(t, 0, res.report.SkippedBlocks())
+		assert.Equal(t, int32(2), res.metrics.BlockReads.Load())
+	}
+	assert.Equal(t, int32(2), reader.reads.Load())
+}
+
+func TestForEachTenant(t *testing.T) {
+	tenants := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		tenants = append(tenants, fmt.Sprintf("tenant-%d", i))
+	}
+
+	for _, concurrency := range []int{0, 1, 3} {
+		mtx := sync.Mutex{}
+		seen := map[string]bool{}
+		running := atomic.NewInt32(0)
+		maxRunning := atomic.NewInt32(0)
+
+		forEachTenant(tenants, concurrency, func(tenantID string) {
+			n := running.Inc()
+			defer running.Dec()
+			for {
+				max := maxRunning.Load()
+				if n <= max || maxRunning.CAS(max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			mtx.Lock()
+			seen[tenantID] = true
+			mtx.Unlock()
+		})
+
+		assert.Len(t, seen, len(tenants))
+		expectedMax := int32(concurrency)
+		if concurrency == 0 {
+			expectedMax = 1
+		}
+		assert.LessOrEqual(t, maxRunning.Load(), expectedMax)
+	}
+}
+
+func TestDeleteBlock(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+	blockID := complete.BlockMeta().BlockID
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+
+	assert.Equal(t, backend.ErrEmptyTenantID, c.DeleteBlock(context.Background(), "", blockID))
+	assert.Equal(t, backend.ErrEmptyBlockID, c.DeleteBlock(context.Background(), testTenantID, uuid.Nil))
+	assert.Equal(t, backend.ErrMetaDoesNotExist, c.DeleteBlock(context.Background(), testTenantID, uuid.New()))
+
+	err = c.DeleteBlock(context.Background(), testTenantID, blockID)
+	assert.NoError(t, err)
+	assert.Len(t, rw.blocklist(testTenantID), 0)
+
+	found, _, _, err := r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	// gone from the backend as well
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 0)
+	assert.Equal(t, backend.ErrMetaDoesNotExist, c.DeleteBlock(context.Background(), testTenantID, blockID))
+}
+
+func TestFindStaleBlocklist(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+	c.EnableCompaction(&CompactorConfig{
+		BlockRetention:          time.Hour,
+		CompactedBlockRetention: 0,
+	}, &mockSharder{})
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+	blockID := complete.BlockMeta().BlockID
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+
+	// the block is compacted and cleared without the blocklist being polled again
+	err = rw.c.MarkBlockCompacted(blockID, testTenantID)
+	assert.NoError(t, err)
+	err = rw.c.ClearBlock(blockID, testTenantID)
+	assert.NoError(t, err)
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+
+	found, _, report, err := r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	assert.Empty(t, report.FailedBlocks)
+}
+
+func TestColdTier(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		ColdTier: &ColdTierConfig{
+			MigrateAfter: time.Nanosecond,
+			BackendConfig: BackendConfig{
+				Backend: "local",
+				Local: &local.Config{
+					Path: path.Join(tempDir, "cold"),
+				},
+			},
+		},
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	c.EnableCompaction(&CompactorConfig{
+		BlockRetention: time.Hour,
+	}, &mockSharder{})
+
+	blockID := uuid.New()
+	head, err := w.WAL().NewBlock(blockID, testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	rw.migrateTenant(testTenantID)
+
+	// moved out of the primary backend
+	_, err = os.Stat(path.Join(tempDir, "traces", testTenantID, blockID.String()))
+	assert.True(t, os.IsNotExist(err))
+
+	rw.pollBlocklist()
+	blocklist := rw.blocklist(testTenantID)
+	assert.Len(t, blocklist, 1)
+	assert.Equal(t, "cold", blocklist[0].Tier)
+
+	found, _, _, err := r.Find(context.Background(), testTenantID, id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, found)
+}
+
+func TestReadOnly(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	r, w, c, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		ReadOnly: true,
+		WAL: &wal.Config{
+			Filepath:        path.Join(tempDir, "wal"),
+			IndexDownsample: 17,
+			BloomFP:         .01,
+		},
+		MaintenanceCycle: 0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+	c.EnableCompaction(&CompactorConfig{}, &mockSharder{})
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	err = head.Write(id, []byte{0x01})
+	assert.NoError(t, err)
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+
+	err = w.WriteBlock(context.Background(), complete)
+	assert.True(t, errors.Is(err, backend.ErrReadOnly))
+
+	// a block written by another install is read but can't be deleted
+	_, otherW, _, err := local.New(&local.Config{Path: path.Join(tempDir, "traces")})
+	assert.NoError(t, err)
+	meta := complete.BlockMeta()
+	err = otherW.Write(context.Background(), meta, []byte{}, []byte{}, complete.ObjectFilePath())
+	assert.NoError(t, err)
+
+	rw := r.(*readerWriter)
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+
+	err = c.DeleteBlock(context.Background(), testTenantID, meta.BlockID)
+	assert.True(t, errors.Is(err, backend.ErrReadOnly))
+
+	rw.pollBlocklist()
+	assert.Len(t, rw.blocklist(testTenantID), 1)
+}
+
+func TestEncryption(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyFile := path.Join(tempDir, "key")
+	err = ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(key)), 0600)
+	assert.NoError(t, err)
+
+	r, w, _, err := New(&Config{
+		Backend: "local",
+		Local: &local.Config{
+			Path: path.Join(tempDir, "traces"),
+		},
+		WAL: &wal.Config{
+			Filepath:           path.Join(tempDir, "wal"),
+			IndexDownsample:    2,
+			IndexPageSizeBytes: 100,
+			BloomFP:            .01,
+		},
+		EncryptionKeyFile: keyFile,
+		MaintenanceCycle:  0,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	head, err := w.WAL().NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err)
+
+	ids := make([][]byte, 0, 20)
+	for i := 0; i < 20; i++ {
+		id := make([]byte, 16)
+		rand.Read(id)
+		ids = append(ids, id)
+		err = head.Write(id, []byte("secret"))
+		assert.NoError(t, err)
+	}
+
+	complete, err := head.Complete(w.WAL(), &mockSharder{})
+	assert.NoError(t, err)
+	meta := complete.BlockMeta()
+	assert.NotEmpty(t, meta.EncryptionKeyID)
+
+	err = w.WriteBlock(context.Background(), complete)
+	assert.NoError(t, err)
+
+	objects, err := ioutil.ReadFile(path.Join(tempDir, "traces", testTenantID, meta.BlockID.String(), "traces"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(objects), "secret")
+
+	r.(*readerWriter).pollBlocklist()
+	for _, id := range ids {
+		bFound, _, _, err := r.Find(context.Background(), testTenantID, id)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("secret"), bFound)
+	}
+}
@@ -0,0 +1,60 @@
+package tempodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/tempo/tempodb/backend/tiered"
+)
+
+var (
+	metricBlocksMigrated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "cold_tier_blocks_migrated_total",
+		Help:      "Total number of blocks moved to the cold tier.",
+	})
+	metricMigrationErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "cold_tier_migration_errors_total",
+		Help:      "Total number of blocks that failed to be moved to the cold tier.",
+	})
+)
+
+func (rw *readerWriter) migratesToColdTier() bool {
+	return rw.coldTier != nil && rw.cfg.ColdTier.MigrateAfter > 0
+}
+
+// migrateTenant moves the tenant's blocks that are older than MigrateAfter to the cold tier.  Blocks are split
+// between the compactors like compaction jobs so each is only copied once.  Blocks past retention are left
+// to be deleted.
+func (rw *readerWriter) migrateTenant(tenantID string) {
+	migrateCutoff := time.Now().Add(-rw.cfg.ColdTier.MigrateAfter)
+	retentionCutoff := time.Now().Add(-rw.blockRetention(tenantID))
+
+	for _, b := range rw.blocklist(tenantID) {
+		if b.Tier == tiered.Cold || !b.EndTime.Before(migrateCutoff) || b.EndTime.Before(retentionCutoff) {
+			continue
+		}
+
+		rw.compactorMtx.Lock()
+		owns := rw.compactorSharder.Owns(b.BlockID.String())
+		rw.compactorMtx.Unlock()
+		if !owns {
+			continue
+		}
+
+		moved, err := rw.coldTier.Migrate(context.Background(), b)
+		if err != nil {
+			level.Error(rw.logger).Log("msg", "failed to move block to the cold tier", "blockID", b.BlockID, "tenantID", tenantID, "err", err)
+			metricMigrationErrors.Inc()
+			continue
+		}
+		if moved {
+			metricBlocksMigrated.Inc()
+		}
+	}
+}
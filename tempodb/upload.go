@@ -0,0 +1,134 @@
+package tempodb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricBlockUploadsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "block_uploads_in_flight",
+		Help:      "Number of completed blocks being written to the backend.",
+	})
+	metricBlockUploadBufferBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tempodb",
+		Name:      "block_upload_buffer_bytes",
+		Help:      "Bloom filter and index bytes held in memory by blocks being written to the backend.",
+	})
+	metricAsyncBlockWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tempodb",
+		Name:      "async_block_write_failures_total",
+		Help:      "Total number of blocks that failed to be written to the backend in the background.",
+	})
+)
+
+// uploadLimiter bounds the number of blocks WriteBlock uploads at once and the bytes they hold in memory
+type uploadLimiter struct {
+	maxUploads int
+	maxBytes   int
+
+	mtx      sync.Mutex
+	uploads  int
+	bytes    int
+	released chan struct{}          // closed and replaced each time an upload finishes
+	queued   map[uuid.UUID]struct{} // blocks being written in the background
+}
+
+func newUploadLimiter(maxUploads int, maxBytes int) *uploadLimiter {
+	return &uploadLimiter{
+		maxUploads: maxUploads,
+		maxBytes:   maxBytes,
+		released:   make(chan struct{}),
+		queued:     make(map[uuid.UUID]struct{}),
+	}
+}
+
+// queue records that a block is being written in the background.  it returns false if it already is so the
+// ingester asking again before the upload finishes doesn't start a second one.
+func (l *uploadLimiter) queue(blockID uuid.UUID) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if _, ok := l.queued[blockID]; ok {
+		return false
+	}
+	l.queued[blockID] = struct{}{}
+	return true
+}
+
+func (l *uploadLimiter) dequeue(blockID uuid.UUID) {
+	l.mtx.Lock()
+	delete(l.queued, blockID)
+	l.mtx.Unlock()
+}
+
+// acquire waits until an upload of size bytes fits within the limits.  a single upload larger than
+// maxBytes is allowed once nothing else is in flight so it can't wait forever.
+func (l *uploadLimiter) acquire(ctx context.Context, size int) error {
+	for {
+		l.mtx.Lock()
+		if l.fits(size) {
+			l.uploads++
+			l.bytes += size
+			l.mtx.Unlock()
+
+			metricBlockUploadsInFlight.Inc()
+			metricBlockUploadBufferBytes.Add(float64(size))
+			return nil
+		}
+		released := l.released
+		l.mtx.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *uploadLimiter) fits(size int) bool {
+	if l.maxUploads > 0 && l.uploads >= l.maxUploads {
+		return false
+	}
+	if l.maxBytes > 0 && l.uploads > 0 && l.bytes+size > l.maxBytes {
+		return false
+	}
+	return true
+}
+
+func (l *uploadLimiter) release(size int) {
+	l.mtx.Lock()
+	l.uploads--
+	l.bytes -= size
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mtx.Unlock()
+
+	metricBlockUploadsInFlight.Dec()
+	metricBlockUploadBufferBytes.Sub(float64(size))
+}
+
+// wait blocks until no uploads are in flight
+func (l *uploadLimiter) wait(ctx context.Context) error {
+	for {
+		l.mtx.Lock()
+		if l.uploads == 0 {
+			l.mtx.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mtx.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package tempodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestUploadLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newUploadLimiter(2, 10)
+
+	// concurrency
+	assert.NoError(t, l.acquire(ctx, 1))
+	assert.NoError(t, l.acquire(ctx, 1))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(timeoutCtx, 1))
+	cancel()
+	l.release(1)
+	l.release(1)
+
+	// bytes
+	assert.NoError(t, l.acquire(ctx, 8))
+	timeoutCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(timeoutCtx, 3))
+	cancel()
+
+	// a waiting upload proceeds once room is released
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(ctx, 3)
+	}()
+	l.release(8)
+	assert.NoError(t, <-acquired)
+
+	// an oversized upload only goes on its own
+	go func() {
+		acquired <- l.acquire(ctx, 20)
+	}()
+	select {
+	case <-acquired:
+		assert.Fail(t, "oversized upload acquired while another was in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// wait returns once everything is released
+	timeoutCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, l.wait(timeoutCtx))
+	cancel()
+
+	l.release(3)
+	assert.NoError(t, <-acquired)
+	l.release(20)
+	assert.NoError(t, l.wait(ctx))
+}
+
+type mockBlock struct {
+	meta    *encoding.BlockMeta
+	flushed *atomic.Int32
+}
+
+func (b *mockBlock) BlockMeta() *encoding.BlockMeta { return b.meta }
+func (b *mockBlock) BloomFilter() *encoding.ShardedBloomFilter {
+	return encoding.NewShardedBloomFilter(.01, 1, 10)
+}
+func (b *mockBlock) Records() []*encoding.Record { return nil }
+func (b *mockBlock) ObjectFilePath() string      { return "" }
+func (b *mockBlock) Flushed() error              { b.flushed.Inc(); return nil }
+
+// blockingWriter holds every Write until unblock is closed
+type blockingWriter struct {
+	backend.Writer
+
+	writes  *atomic.Int32
+	unblock chan struct{}
+	err     error
+}
+
+func (w *blockingWriter) Write(ctx context.Context, meta *encoding.BlockMeta, bBloom []byte, bIndex []byte, objectFilePath string) error {
+	w.writes.Inc()
+	<-w.unblock
+	return w.err
+}
+
+func TestAsyncBlockWrites(t *testing.T) {
+	ctx := context.Background()
+	w := &blockingWriter{
+		writes:  atomic.NewInt32(0),
+		unblock: make(chan struct{}),
+	}
+	rw := &readerWriter{
+		w:       w,
+		cfg:     &Config{AsyncBlockWrites: true},
+		uploads: newUploadLimiter(0, 0),
+		logger:  log.NewNopLogger(),
+	}
+	block := &mockBlock{
+		meta:    encoding.NewBlockMeta(testTenantID, uuid.New()),
+		flushed: atomic.NewInt32(0),
+	}
+
+	// returns while the upload is still in flight
+	require.NoError(t, rw.WriteBlock(ctx, block))
+	assert.Equal(t, int32(0), block.flushed.Load())
+
+	// writing the block again before its upload finishes doesn't upload it twice
+	require.NoError(t, rw.WriteBlock(ctx, block))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, rw.FlushAll(timeoutCtx))
+	cancel()
+
+	// flushed once uploaded
+	close(w.unblock)
+	require.NoError(t, rw.FlushAll(ctx))
+	assert.Equal(t, int32(1), w.writes.Load())
+	assert.Equal(t, int32(1), block.flushed.Load())
+
+	// a failed upload leaves the block unflushed to be written again
+	w.err = errors.New("failed")
+	block.flushed.Store(0)
+	require.NoError(t, rw.WriteBlock(ctx, block))
+	require.NoError(t, rw.FlushAll(ctx))
+	assert.Equal(t, int32(0), block.flushed.Load())
+
+	require.NoError(t, rw.WriteBlock(ctx, block))
+	require.NoError(t, rw.FlushAll(ctx))
+	assert.Equal(t, int32(3), w.writes.Load())
+}
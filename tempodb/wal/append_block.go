@@ -5,19 +5,18 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/encoding"
-	"github.com/willf/bloom"
 )
 
 // AppendBlock is a block that is actively used to append new objects to.  It stores all data in the appendFile
-// in the order it was received and an in memory sorted index.
+// in the order it was received and a sorted index, in memory up to a limit and spilled to disk past it.
 type AppendBlock struct {
 	block
 
 	appendFile *os.File
-	appender   encoding.Appender
+	appender   *encoding.SpillingAppender
 }
 
-func newAppendBlock(id uuid.UUID, tenantID string, filepath string) (*AppendBlock, error) {
+func newAppendBlock(id uuid.UUID, tenantID string, filepath string, spillFilepath string, maxRecordBytes int) (*AppendBlock, error) {
 	h := &AppendBlock{
 		block: block{
 			meta:     encoding.NewBlockMeta(tenantID, id),
@@ -36,7 +35,7 @@ func newAppendBlock(id uuid.UUID, tenantID string, filepath string) (*AppendBloc
 		return nil, err
 	}
 	h.appendFile = f
-	h.appender = encoding.NewAppender(f)
+	h.appender = encoding.NewSpillingAppender(f, spillFilepath, maxRecordBytes)
 
 	return h, nil
 }
@@ -72,19 +71,24 @@ func (h *AppendBlock) Complete(w *WAL, combiner encoding.ObjectCombiner) (*Compl
 	// 2) append all objects from this block in order
 	// 3) move from completeddir -> realdir
 	// 4) remove old
-	records := h.appender.Records()
+	estimatedObjects := h.appender.Length()
 	orderedBlock := &CompleteBlock{
 		block: block{
 			meta:     encoding.NewBlockMeta(h.meta.TenantID, uuid.New()),
 			filepath: walConfig.CompletedFilepath,
 		},
-		bloom: bloom.NewWithEstimates(uint(len(records)), walConfig.BloomFP),
+		bloom: encoding.NewShardedBloomFilter(w.bloomFP(h.meta.TenantID), walConfig.BloomShards, estimatedObjects),
 	}
 	orderedBlock.meta.StartTime = h.meta.StartTime
 	orderedBlock.meta.EndTime = h.meta.EndTime
 	orderedBlock.meta.MinID = h.meta.MinID
 	orderedBlock.meta.MaxID = h.meta.MaxID
 	orderedBlock.meta.TotalObjects = h.meta.TotalObjects
+	orderedBlock.meta.Encoding = walConfig.Encoding
+	orderedBlock.meta.EncryptionKeyID = w.encryptionKeyID()
+	orderedBlock.meta.PageChecksums = true
+	// the objects of an id are combined below
+	orderedBlock.meta.CopyablePages = true
 
 	_, err := os.Create(orderedBlock.fullFilename())
 	if err != nil {
@@ -103,14 +107,22 @@ func (h *AppendBlock) Complete(w *WAL, combiner encoding.ObjectCombiner) (*Compl
 		return nil, err
 	}
 
-	iterator := encoding.NewRecordIterator(records, readFile)
+	iterator := h.appender.Iterator(readFile, encoding.PageFormat{})
 	iterator, err = encoding.NewDedupingIterator(iterator, combiner)
 	if err != nil {
 		_ = appendFile.Close()
 		_ = os.Remove(orderedBlock.fullFilename())
 		return nil, err
 	}
-	appender := encoding.NewBufferedAppender(appendFile, walConfig.IndexDownsample, len(records))
+	format, err := orderedBlock.meta.PageFormat()
+	if err != nil {
+		_ = appendFile.Close()
+		_ = os.Remove(orderedBlock.fullFilename())
+		return nil, err
+	}
+	appender := encoding.NewBufferedAppender(appendFile, format, walConfig.IndexDownsample, estimatedObjects)
+	tags := w.newTagIndexBuilder()
+	timeGroups := w.newTimeGroupBuilder()
 	for {
 		bytesID, bytesObject, err := iterator.Next()
 		if bytesID == nil {
@@ -123,6 +135,9 @@ func (h *AppendBlock) Complete(w *WAL, combiner encoding.ObjectCombiner) (*Compl
 		}
 
 		orderedBlock.bloom.Add(bytesID)
+		objectWritten(orderedBlock.meta, w.spanCounter, bytesObject)
+		tags.Add(uint32(len(appender.Records())), bytesObject)
+		timeGroups.Add(uint32(len(appender.Records())), bytesObject)
 		// obj gets written to disk immediately but the id escapes the iterator and needs to be copied
 		writeID := append([]byte(nil), bytesID...)
 		err = appender.Append(writeID, bytesObject)
@@ -132,22 +147,44 @@ func (h *AppendBlock) Complete(w *WAL, combiner encoding.ObjectCombiner) (*Compl
 			return nil, err
 		}
 	}
-	appender.Complete()
+	err = appender.Complete()
+	if b := tags.Marshal(); err == nil && len(b) > 0 {
+		// the tag index follows the last page
+		orderedBlock.meta.TagIndexOffset = encoding.RecordsSize(appender.Records())
+		orderedBlock.meta.TagIndexLength = uint32(len(b))
+		_, err = appendFile.Write(b)
+	}
+	if err == nil {
+		footer := encoding.NewBlockStats(orderedBlock.meta, appender.Records()).WithTimeGroups(timeGroups).MarshalFooter()
+		orderedBlock.meta.StatsFooterLength = uint32(len(footer))
+		orderedBlock.meta.TimeGroupWindow = timeGroups.Window()
+		_, err = appendFile.Write(footer)
+	}
 	appendFile.Close()
+	if err != nil {
+		_ = os.Remove(orderedBlock.fullFilename())
+		return nil, err
+	}
 	orderedBlock.records = appender.Records()
+	orderedBlock.meta.Size = encoding.RecordsSize(orderedBlock.records)
+	orderedBlock.meta.SetIndexPages(orderedBlock.records, walConfig.IndexPageSizeBytes)
 	orderedBlock.walFilename = h.fullFilename() // pass the filename to the complete block for cleanup when it's flusehd
+	orderedBlock.walRecords = h.appender
 
 	return orderedBlock, nil
 }
 
 func (h *AppendBlock) Find(id encoding.ID, combiner encoding.ObjectCombiner) ([]byte, error) {
-	records := h.appender.Records()
+	records, err := h.appender.FindRecords(id)
+	if err != nil {
+		return nil, err
+	}
 	file, err := h.file()
 	if err != nil {
 		return nil, err
 	}
 
-	finder := encoding.NewDedupingFinder(records, file, combiner)
+	finder := encoding.NewDedupingFinder(records, file, encoding.PageFormat{}, combiner)
 
 	return finder.Find(id)
 }
@@ -160,6 +197,7 @@ func (h *AppendBlock) Clear() error {
 	if h.appendFile != nil {
 		_ = h.appendFile.Close()
 	}
+	_ = h.appender.Clear()
 
 	name := h.fullFilename()
 	return os.Remove(name)
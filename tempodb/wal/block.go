@@ -6,12 +6,11 @@ import (
 	"sync"
 
 	"github.com/grafana/tempo/tempodb/encoding"
-	"github.com/willf/bloom"
 )
 
 type WriteableBlock interface {
 	BlockMeta() *encoding.BlockMeta
-	BloomFilter() *bloom.BloomFilter
+	BloomFilter() *encoding.ShardedBloomFilter
 	Records() []*encoding.Record
 	ObjectFilePath() string
 
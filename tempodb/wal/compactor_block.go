@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/encoding"
-	"github.com/willf/bloom"
 )
 
 type CompactorBlock struct {
@@ -15,13 +15,18 @@ type CompactorBlock struct {
 
 	metas []*encoding.BlockMeta
 
-	bloom *bloom.BloomFilter
+	bloom         *encoding.ShardedBloomFilter
+	indexPageSize int
+	tags          *encoding.TagIndexBuilder
+	timeGroups    *encoding.TimeGroupBuilder
+	spanCounter   SpanCounter
 
 	appendBuffer *bytes.Buffer
-	appender     encoding.Appender
+	appender     encoding.PageAppender
+	format       encoding.PageFormat
 }
 
-func newCompactorBlock(id uuid.UUID, tenantID string, bloomFP float64, indexDownsample int, metas []*encoding.BlockMeta, filepath string, estimatedObjects int) (*CompactorBlock, error) {
+func newCompactorBlock(id uuid.UUID, tenantID string, bloomFP float64, bloomShards int, indexDownsample int, indexPageSize int, enc encoding.Encoding, encryptionKeyID string, metas []*encoding.BlockMeta, filepath string, estimatedObjects int) (*CompactorBlock, error) {
 	if len(metas) == 0 {
 		return nil, fmt.Errorf("empty block meta list")
 	}
@@ -35,32 +40,96 @@ func newCompactorBlock(id uuid.UUID, tenantID string, bloomFP float64, indexDown
 			meta:     encoding.NewBlockMeta(tenantID, id),
 			filepath: filepath,
 		},
-		bloom: bloom.NewWithEstimates(uint(estimatedObjects), bloomFP),
-		metas: metas,
+		bloom:         encoding.NewShardedBloomFilter(bloomFP, bloomShards, estimatedObjects),
+		indexPageSize: indexPageSize,
+		metas:         metas,
+	}
+	c.meta.Encoding = enc
+	for _, m := range metas {
+		if m.OldFormat() && !contains(c.meta.UpgradedFrom, m.Version) {
+			c.meta.UpgradedFrom = append(c.meta.UpgradedFrom, m.Version)
+		}
+	}
+	sort.Strings(c.meta.UpgradedFrom)
+	c.meta.EncryptionKeyID = encryptionKeyID
+	c.meta.PageChecksums = true
+	c.meta.CopyablePages = true
+
+	format, err := c.meta.PageFormat()
+	if err != nil {
+		return nil, err
 	}
 
 	name := c.fullFilename()
-	_, err := os.Create(name)
+	_, err = os.Create(name)
 	if err != nil {
 		return nil, err
 	}
 
 	c.appendBuffer = &bytes.Buffer{}
-	c.appender = encoding.NewBufferedAppender(c.appendBuffer, indexDownsample, estimatedObjects)
+	c.appender = encoding.NewBufferedAppender(c.appendBuffer, format, indexDownsample, estimatedObjects)
+	c.format = format
 
 	return c, nil
 }
 
 func (c *CompactorBlock) Write(id encoding.ID, object []byte) error {
+	// the object goes in the page after the completed ones
+	record := uint32(len(c.appender.Records()))
+	c.tags.Add(record, object)
+	c.timeGroups.Add(record, object)
 	err := c.appender.Append(id, object)
 	if err != nil {
 		return err
 	}
 	c.meta.ObjectAdded(id)
+	objectWritten(c.meta, c.spanCounter, object)
 	c.bloom.Add(id)
 	return nil
 }
 
+// WritePage copies a page read from a block written with the same page format without re-encoding it.  Its objects
+// are decoded only to add them to the bloom filter and meta, so the page must not hold ids already written.
+func (c *CompactorBlock) WritePage(page []byte) error {
+	iter, err := encoding.NewPageIterator(c.format, page)
+	if err != nil {
+		return err
+	}
+
+	var ids []encoding.ID
+	var objects [][]byte
+	for {
+		id, object, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			break
+		}
+		ids = append(ids, id)
+		objects = append(objects, object)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("empty page")
+	}
+
+	err = c.appender.AppendPage(ids[len(ids)-1], len(ids), page)
+	if err != nil {
+		return err
+	}
+
+	// the page is the last record
+	record := uint32(len(c.appender.Records()) - 1)
+	for i, id := range ids {
+		c.tags.Add(record, objects[i])
+		c.timeGroups.Add(record, objects[i])
+		c.meta.ObjectAdded(id)
+		objectWritten(c.meta, c.spanCounter, objects[i])
+		c.bloom.Add(id)
+	}
+	return nil
+}
+
 func (c *CompactorBlock) CurrentBuffer() []byte {
 	return c.appendBuffer.Bytes()
 }
@@ -73,8 +142,25 @@ func (c *CompactorBlock) Length() int {
 	return c.appender.Length()
 }
 
-func (c *CompactorBlock) Complete() {
-	c.appender.Complete()
+// Complete writes the last page, the tag index and the stats footer with the time groups to the buffer.  Ship the buffer after calling it.
+func (c *CompactorBlock) Complete() error {
+	err := c.appender.Complete()
+	if err != nil {
+		return err
+	}
+	c.meta.Size = encoding.RecordsSize(c.appender.Records())
+	c.meta.SetIndexPages(c.appender.Records(), c.indexPageSize)
+
+	if tags := c.tags.Marshal(); len(tags) > 0 {
+		c.appendBuffer.Write(tags)
+		c.meta.TagIndexOffset = c.meta.Size
+		c.meta.TagIndexLength = uint32(len(tags))
+	}
+	footer := encoding.NewBlockStats(c.meta, c.appender.Records()).WithTimeGroups(c.timeGroups).MarshalFooter()
+	c.appendBuffer.Write(footer)
+	c.meta.StatsFooterLength = uint32(len(footer))
+	c.meta.TimeGroupWindow = c.timeGroups.Window()
+	return nil
 }
 
 func (c *CompactorBlock) Clear() error {
@@ -102,7 +188,7 @@ func (c *CompactorBlock) BlockMeta() *encoding.BlockMeta {
 }
 
 // implements WriteableBlock
-func (c *CompactorBlock) BloomFilter() *bloom.BloomFilter {
+func (c *CompactorBlock) BloomFilter() *encoding.ShardedBloomFilter {
 	return c.bloom
 }
 
@@ -121,3 +207,12 @@ func (c *CompactorBlock) Records() []*encoding.Record {
 func (c *CompactorBlock) ObjectFilePath() string {
 	return ""
 }
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -16,7 +16,7 @@ import (
 )
 
 func TestCompactorBlockError(t *testing.T) {
-	_, err := newCompactorBlock(uuid.New(), "", 0, 0, nil, "", 0)
+	_, err := newCompactorBlock(uuid.New(), "", 0, 1, 0, 0, encoding.EncNone, "", nil, "", 0)
 	assert.Error(t, err)
 }
 
@@ -32,6 +32,10 @@ func TestCompactorBlockWrite(t *testing.T) {
 	}
 	wal, err := New(walCfg)
 	assert.NoError(t, err)
+	// one span per byte
+	wal.SetSpanCounter(SpanCounterFunc(func(object []byte) (int, error) {
+		return len(object), nil
+	}))
 
 	metas := []*encoding.BlockMeta{
 		{
@@ -50,6 +54,7 @@ func TestCompactorBlockWrite(t *testing.T) {
 
 	var minID encoding.ID
 	var maxID encoding.ID
+	var size uint64
 
 	ids := make([][]byte, 0)
 	for i := 0; i < numObjects; i++ {
@@ -62,6 +67,7 @@ func TestCompactorBlockWrite(t *testing.T) {
 		assert.NoError(t, err)
 
 		ids = append(ids, id)
+		size += uint64(len(object))
 
 		err = cb.Write(id, object)
 		assert.NoError(t, err)
@@ -73,7 +79,7 @@ func TestCompactorBlockWrite(t *testing.T) {
 			maxID = id
 		}
 	}
-	cb.Complete()
+	assert.NoError(t, cb.Complete())
 
 	assert.Equal(t, numObjects, cb.Length())
 
@@ -86,6 +92,13 @@ func TestCompactorBlockWrite(t *testing.T) {
 	assert.Equal(t, maxID, meta.MaxID)
 	assert.Equal(t, testTenantID, meta.TenantID)
 	assert.Equal(t, numObjects, meta.TotalObjects)
+	// the pages are followed by the stats footer
+	stats, err := encoding.ReadBlockStats(bytes.NewReader(cb.CurrentBuffer()), int64(len(cb.CurrentBuffer())))
+	assert.NoError(t, err)
+	assert.Equal(t, stats.Size, meta.Size)
+	assert.Greater(t, uint64(len(cb.CurrentBuffer())), meta.Size)
+	assert.Equal(t, size, meta.UncompressedSize)
+	assert.Equal(t, size, meta.TotalSpans)
 
 	// bloom
 	bloom := cb.BloomFilter()
@@ -1,11 +1,11 @@
 package wal
 
 import (
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/grafana/tempo/tempodb/encoding"
-	"github.com/willf/bloom"
 	"go.uber.org/atomic"
 )
 
@@ -15,11 +15,12 @@ import (
 type CompleteBlock struct {
 	block
 
-	bloom   *bloom.BloomFilter
+	bloom   *encoding.ShardedBloomFilter
 	records []*encoding.Record
 
 	flushedTime atomic.Int64 // protecting flushedTime b/c it's accessed from the store on flush and from the ingester instance checking flush time
 	walFilename string
+	walRecords  *encoding.SpillingAppender // records of the wal file spilled to disk, removed with it
 }
 
 func (c *CompleteBlock) Records() []*encoding.Record {
@@ -36,19 +37,32 @@ func (c *CompleteBlock) Find(id encoding.ID, combiner encoding.ObjectCombiner) (
 		return nil, err
 	}
 
-	finder := encoding.NewDedupingFinder(c.records, file, combiner)
+	format, err := c.meta.PageFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	finder := encoding.NewDedupingFinder(c.records, file, format, combiner)
 
-	return finder.Find(id)
+	obj, err := finder.Find(id)
+	if err != nil {
+		return nil, fmt.Errorf("block %s %w", c.meta.BlockID, err)
+	}
+	return obj, nil
 }
 
 func (c *CompleteBlock) Iterator() (encoding.Iterator, error) {
-	name := c.fullFilename()
-	f, err := os.OpenFile(name, os.O_RDONLY, 0644)
+	file, err := c.file()
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := c.meta.PageFormat()
 	if err != nil {
 		return nil, err
 	}
 
-	return encoding.NewIterator(f), nil
+	return encoding.NewRecordIterator(c.records, file, format), nil
 }
 
 func (c *CompleteBlock) Clear() error {
@@ -70,6 +84,9 @@ func (c *CompleteBlock) FlushedTime() time.Time {
 
 func (c *CompleteBlock) Flushed() error {
 	c.flushedTime.Store(time.Now().Unix())
+	if c.walRecords != nil {
+		_ = c.walRecords.Clear()
+	}
 	return os.Remove(c.walFilename) // now that we are flushed, remove our wal file
 }
 
@@ -77,6 +94,6 @@ func (c *CompleteBlock) BlockMeta() *encoding.BlockMeta {
 	return c.meta
 }
 
-func (c *CompleteBlock) BloomFilter() *bloom.BloomFilter {
+func (c *CompleteBlock) BloomFilter() *encoding.ShardedBloomFilter {
 	return c.bloom
 }
@@ -1,11 +1,13 @@
 package wal
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/grafana/tempo/tempodb/encoding"
@@ -13,10 +15,36 @@ import (
 
 const (
 	completedDir = "completed"
+	spillDir     = "spill"
 )
 
 type WAL struct {
 	c *Config
+
+	overrides     Overrides
+	tagExtractor  encoding.TagExtractor
+	timeExtractor encoding.TimeExtractor
+	spanCounter   SpanCounter
+	encryption    *encoding.EncryptionKey
+}
+
+// Overrides are per tenant settings of the blocks the WAL completes and compacts
+type Overrides interface {
+	// BloomFilterFalsePositive is the tenant's bloom filter false positive rate.  0 to use the WAL's.
+	BloomFilterFalsePositive(tenantID string) float64
+}
+
+// SpanCounter returns the number of spans in an object.  tempodb doesn't know the format of the objects it stores so
+// the caller supplies it.
+type SpanCounter interface {
+	Spans(object []byte) (int, error)
+}
+
+// SpanCounterFunc adapts a function to a SpanCounter
+type SpanCounterFunc func(object []byte) (int, error)
+
+func (f SpanCounterFunc) Spans(object []byte) (int, error) {
+	return f(object)
 }
 
 type Config struct {
@@ -24,6 +52,23 @@ type Config struct {
 	CompletedFilepath string
 	IndexDownsample   int     `yaml:"index_downsample"`
 	BloomFP           float64 `yaml:"bloom_filter_false_positive"`
+	// BloomShards splits the bloom filter of completed and compacted blocks into this many shards by trace id so
+	// queries read a single shard instead of the whole filter.  1 writes a single filter.
+	BloomShards int `yaml:"bloom_filter_shards"`
+	// IndexPageSizeBytes splits the index of completed and compacted blocks into pages of this size so queries read
+	// a single page instead of the whole index.  0 disables.
+	IndexPageSizeBytes int `yaml:"index_page_size_bytes"`
+	// Encoding compresses the pages of objects of completed blocks.  Compacted blocks use it too.
+	Encoding encoding.Encoding `yaml:"encoding"`
+	// TagIndex writes an index of the tags of the objects of completed and compacted blocks after their objects
+	TagIndex bool `yaml:"tag_index"`
+	// TimeGroupWindow groups the records of completed and compacted blocks by the times of their objects in windows of
+	// this duration so searches of a time range skip the records outside it.  0 disables.
+	TimeGroupWindow time.Duration `yaml:"time_group_window"`
+	// AppendRecordsMaxBytes caps the memory the sorted records of each block being appended to take.  Records over it
+	// are spilled to sorted files in the WAL's spill folder and merged when the block is completed.  0 keeps every
+	// record in memory.
+	AppendRecordsMaxBytes int `yaml:"append_records_max_bytes"`
 }
 
 func New(c *Config) (*WAL, error) {
@@ -39,6 +84,20 @@ func New(c *Config) (*WAL, error) {
 		return nil, fmt.Errorf("invalid bloom filter fp rate %v", c.BloomFP)
 	}
 
+	if c.BloomShards == 0 {
+		c.BloomShards = 1
+	}
+	if c.BloomShards < 0 || c.BloomShards > encoding.MaxBloomShards {
+		return nil, fmt.Errorf("invalid bloom filter shards %d. must be between 1 and %d", c.BloomShards, encoding.MaxBloomShards)
+	}
+
+	if c.Encoding == "" {
+		c.Encoding = encoding.EncNone
+	}
+	if _, err := encoding.ParseEncoding(string(c.Encoding)); err != nil {
+		return nil, err
+	}
+
 	// make folder
 	err := os.MkdirAll(c.Filepath, os.ModePerm)
 	if err != nil {
@@ -59,6 +118,17 @@ func New(c *Config) (*WAL, error) {
 		c.CompletedFilepath = completedFilepath
 	}
 
+	// records spilled by blocks appended to before a restart are rebuilt on replay
+	spillFilepath := path.Join(c.Filepath, spillDir)
+	err = os.RemoveAll(spillFilepath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(spillFilepath, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
 	return &WAL{
 		c: c,
 	}, nil
@@ -94,11 +164,105 @@ func (w *WAL) AllBlocks() ([]*ReplayBlock, error) {
 }
 
 func (w *WAL) NewBlock(id uuid.UUID, tenantID string) (*AppendBlock, error) {
-	return newAppendBlock(id, tenantID, w.c.Filepath)
+	return newAppendBlock(id, tenantID, w.c.Filepath, path.Join(w.c.Filepath, spillDir), w.c.AppendRecordsMaxBytes)
 }
 
 func (w *WAL) NewCompactorBlock(id uuid.UUID, tenantID string, metas []*encoding.BlockMeta, estimatedObjects int) (*CompactorBlock, error) {
-	return newCompactorBlock(id, tenantID, w.c.BloomFP, w.c.IndexDownsample, metas, w.c.CompletedFilepath, estimatedObjects)
+	c, err := newCompactorBlock(id, tenantID, w.bloomFP(tenantID), w.c.BloomShards, w.c.IndexDownsample, w.c.IndexPageSizeBytes, w.c.Encoding, w.encryptionKeyID(), metas, w.c.CompletedFilepath, estimatedObjects)
+	if err != nil {
+		return nil, err
+	}
+	c.tags = w.newTagIndexBuilder()
+	c.timeGroups = w.newTimeGroupBuilder()
+	c.spanCounter = w.spanCounter
+	return c, nil
+}
+
+// CanCopyPages returns true if compacting the blocks can copy their pages into a compacted block with WritePage: they
+// are written in the current version and page format of compacted blocks and no two hold the same id.  The blocks must
+// be ordered by id.
+func (w *WAL) CanCopyPages(metas []*encoding.BlockMeta) bool {
+	for i, m := range metas {
+		if m.OldFormat() || !m.CopyablePages || !m.PageChecksums || m.Encoding != w.c.Encoding || m.EncryptionKeyID != w.encryptionKeyID() {
+			return false
+		}
+		if i > 0 && bytes.Compare(metas[i-1].MaxID, m.MinID) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetOverrides sets the per tenant settings of blocks.  Call it before the WAL is used.
+func (w *WAL) SetOverrides(o Overrides) {
+	w.overrides = o
+}
+
+// SetTagExtractor sets how the tags of objects are found for tag indexes.  Call it before the WAL is used.
+func (w *WAL) SetTagExtractor(e encoding.TagExtractor) {
+	w.tagExtractor = e
+}
+
+// SetTimeExtractor sets how the times of objects are found for time groups.  Call it before the WAL is used.
+func (w *WAL) SetTimeExtractor(e encoding.TimeExtractor) {
+	w.timeExtractor = e
+}
+
+// SetEncryptionKey sets the key completed and compacted blocks are encrypted with.  Call it before the WAL is used.
+func (w *WAL) SetEncryptionKey(k *encoding.EncryptionKey) {
+	w.encryption = k
+}
+
+// encryptionKeyID returns the id of the key blocks are encrypted with or empty if they aren't
+func (w *WAL) encryptionKeyID() string {
+	if w.encryption == nil {
+		return ""
+	}
+	return w.encryption.ID()
+}
+
+// SetSpanCounter sets how the spans of objects are counted for the TotalSpans of block metas.  Call it before the WAL
+// is used.
+func (w *WAL) SetSpanCounter(c SpanCounter) {
+	w.spanCounter = c
+}
+
+// newTagIndexBuilder returns nil if blocks aren't tag indexed
+func (w *WAL) newTagIndexBuilder() *encoding.TagIndexBuilder {
+	if !w.c.TagIndex || w.tagExtractor == nil {
+		return nil
+	}
+	return encoding.NewTagIndexBuilder(w.tagExtractor)
+}
+
+// newTimeGroupBuilder returns nil if blocks aren't grouped by time
+func (w *WAL) newTimeGroupBuilder() *encoding.TimeGroupBuilder {
+	if w.c.TimeGroupWindow <= 0 || w.timeExtractor == nil {
+		return nil
+	}
+	return encoding.NewTimeGroupBuilder(w.timeExtractor, w.c.TimeGroupWindow)
+}
+
+// bloomFP returns the tenant's bloom filter false positive rate
+func (w *WAL) bloomFP(tenantID string) float64 {
+	if w.overrides != nil {
+		if fp := w.overrides.BloomFilterFalsePositive(tenantID); fp > 0 && fp < 1 {
+			return fp
+		}
+	}
+	return w.c.BloomFP
+}
+
+// objectWritten adds the object to the span count and uncompressed size of the meta.  Objects whose spans can't be
+// counted don't add to TotalSpans.
+func objectWritten(meta *encoding.BlockMeta, counter SpanCounter, object []byte) {
+	meta.UncompressedSize += uint64(len(object))
+	if counter == nil {
+		return
+	}
+	if spans, err := counter.Spans(object); err == nil {
+		meta.TotalSpans += uint64(spans)
+	}
 }
 
 func (w *WAL) config() *Config {
@@ -56,6 +56,23 @@ func TestCreateBlock(t *testing.T) {
 	assert.Equal(t, block.fullFilename(), blocks[0].fullFilename())
 }
 
+func TestEncodingValidation(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	// known encodings without a codec in this build are rejected up front instead of failing the first block
+	for _, enc := range []encoding.Encoding{encoding.EncLZ4, encoding.EncZstd, "brotli"} {
+		_, err = New(&Config{
+			Filepath:        tempDir,
+			IndexDownsample: 2,
+			BloomFP:         0.1,
+			Encoding:        enc,
+		})
+		assert.Error(t, err, "encoding %s", enc)
+	}
+}
+
 func TestReadWrite(t *testing.T) {
 	tempDir, err := ioutil.TempDir("/tmp", "")
 	defer os.RemoveAll(tempDir)
@@ -119,7 +136,7 @@ func TestAppend(t *testing.T) {
 	records := block.appender.Records()
 	file, err := block.file()
 	assert.NoError(t, err)
-	iterator := encoding.NewRecordIterator(records, file)
+	iterator := encoding.NewRecordIterator(records, file, encoding.PageFormat{})
 	i := 0
 
 	for {
@@ -194,15 +211,25 @@ func TestIterator(t *testing.T) {
 }
 
 func TestCompleteBlock(t *testing.T) {
+	t.Run("in memory", func(t *testing.T) {
+		testCompleteBlock(t, 0)
+	})
+	t.Run("spilled", func(t *testing.T) {
+		testCompleteBlock(t, 10*28)
+	})
+}
+
+func testCompleteBlock(t *testing.T, appendRecordsMaxBytes int) {
 	tempDir, err := ioutil.TempDir("/tmp", "")
 	defer os.RemoveAll(tempDir)
 	assert.NoError(t, err, "unexpected error creating temp dir")
 
 	indexDownsample := 13
 	wal, err := New(&Config{
-		Filepath:        tempDir,
-		IndexDownsample: indexDownsample,
-		BloomFP:         .01,
+		Filepath:              tempDir,
+		IndexDownsample:       indexDownsample,
+		BloomFP:               .01,
+		AppendRecordsMaxBytes: appendRecordsMaxBytes,
 	})
 	assert.NoError(t, err, "unexpected error creating temp wal")
 
@@ -226,6 +253,20 @@ func TestCompleteBlock(t *testing.T) {
 		assert.NoError(t, err, "unexpected error writing req")
 	}
 
+	if appendRecordsMaxBytes > 0 {
+		assert.Equal(t, numMsgs/10*10, block.appender.Spilled())
+	}
+
+	// the head block is queried until it's completed
+	for i, id := range ids {
+		foundBytes, err := block.Find(id, &mockCombiner{})
+		assert.NoError(t, err)
+		out := &tempopb.PushRequest{}
+		err = proto.Unmarshal(foundBytes, out)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(out, reqs[i]))
+	}
+
 	complete, err := block.Complete(wal, &mockCombiner{})
 	assert.NoError(t, err, "unexpected error completing block")
 	// test downsample config
@@ -234,6 +275,11 @@ func TestCompleteBlock(t *testing.T) {
 	assert.True(t, bytes.Equal(complete.meta.MinID, block.meta.MinID))
 	assert.True(t, bytes.Equal(complete.meta.MaxID, block.meta.MaxID))
 
+	// the pages are followed by the stats footer
+	info, err := os.Stat(complete.ObjectFilePath())
+	assert.NoError(t, err)
+	assert.Greater(t, uint64(info.Size()), complete.meta.Size)
+
 	for i, id := range ids {
 		out := &tempopb.PushRequest{}
 		foundBytes, err := complete.Find(id, &mockCombiner{})
@@ -255,6 +301,134 @@ func TestCompleteBlock(t *testing.T) {
 
 		prev = r
 	}
+
+	// spilled records are removed with the wal file
+	assert.NoError(t, complete.Flushed())
+	spilled, err := ioutil.ReadDir(path.Join(tempDir, spillDir))
+	assert.NoError(t, err)
+	assert.Empty(t, spilled)
+}
+
+func TestBloomFPOverrides(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	wal, err := New(&Config{
+		Filepath:        tempDir,
+		IndexDownsample: 13,
+		BloomFP:         .1,
+	})
+	assert.NoError(t, err, "unexpected error creating temp wal")
+	wal.SetOverrides(mockOverrides{"lowfp": .001})
+
+	completeBlock := func(tenantID string) *CompleteBlock {
+		block, err := wal.NewBlock(uuid.New(), tenantID)
+		assert.NoError(t, err, "unexpected error creating block")
+		for i := 0; i < 100; i++ {
+			id := make([]byte, 16)
+			rand.Read(id)
+			err = block.Write(id, []byte{0x01})
+			assert.NoError(t, err, "unexpected error writing req")
+		}
+		complete, err := block.Complete(wal, &mockCombiner{})
+		assert.NoError(t, err, "unexpected error completing block")
+		return complete
+	}
+
+	assert.InDelta(t, .1, completeBlock(testTenantID).BloomFilter().FalsePositiveRate(), .05)
+	assert.InDelta(t, .001, completeBlock("lowfp").BloomFilter().FalsePositiveRate(), .0005)
+}
+
+func TestTagIndex(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	wal, err := New(&Config{
+		Filepath:        tempDir,
+		IndexDownsample: 2,
+		BloomFP:         .01,
+		TagIndex:        true,
+	})
+	assert.NoError(t, err, "unexpected error creating temp wal")
+	wal.SetTagExtractor(encoding.TagExtractorFunc(func(object []byte) ([]encoding.Tag, error) {
+		return []encoding.Tag{{Key: "first", Value: string(object[:1])}}, nil
+	}))
+
+	block, err := wal.NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err, "unexpected error creating block")
+	for _, obj := range []string{"a1", "b1", "a2", "b2"} {
+		id := make([]byte, 16)
+		rand.Read(id)
+		// ids are sorted on complete
+		id[0] = obj[1]
+		err = block.Write(id, []byte(obj))
+		assert.NoError(t, err, "unexpected error writing req")
+	}
+
+	complete, err := block.Complete(wal, &mockCombiner{})
+	assert.NoError(t, err, "unexpected error completing block")
+	assert.Equal(t, complete.meta.Size, complete.meta.TagIndexOffset)
+
+	objects, err := ioutil.ReadFile(complete.ObjectFilePath())
+	assert.NoError(t, err)
+	index, err := encoding.UnmarshalTagIndex(objects[complete.meta.TagIndexOffset : complete.meta.TagIndexOffset+uint64(complete.meta.TagIndexLength)])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, index.Values("first"))
+	// records of two objects: a1 b1, a2 b2
+	records, indexed := index.Records("first", "a")
+	assert.True(t, indexed)
+	assert.Equal(t, []uint32{0, 1}, records)
+}
+
+func TestStatsFooter(t *testing.T) {
+	tempDir, err := ioutil.TempDir("/tmp", "")
+	defer os.RemoveAll(tempDir)
+	assert.NoError(t, err, "unexpected error creating temp dir")
+
+	wal, err := New(&Config{
+		Filepath:        tempDir,
+		IndexDownsample: 2,
+		BloomFP:         .01,
+		Encoding:        encoding.EncGZIP,
+	})
+	assert.NoError(t, err, "unexpected error creating temp wal")
+
+	block, err := wal.NewBlock(uuid.New(), testTenantID)
+	assert.NoError(t, err, "unexpected error creating block")
+	for i := 0; i < 10; i++ {
+		id := make([]byte, 16)
+		rand.Read(id)
+		err = block.Write(id, bytes.Repeat([]byte{0x01}, 100))
+		assert.NoError(t, err, "unexpected error writing req")
+	}
+
+	complete, err := block.Complete(wal, &mockCombiner{})
+	assert.NoError(t, err, "unexpected error completing block")
+
+	objects, err := ioutil.ReadFile(complete.ObjectFilePath())
+	assert.NoError(t, err)
+	stats, err := encoding.ReadBlockStats(bytes.NewReader(objects), int64(len(objects)))
+	assert.NoError(t, err)
+
+	meta := complete.BlockMeta()
+	assert.Equal(t, uint32(len(complete.records)), stats.TotalRecords)
+	assert.Equal(t, uint32(10), stats.TotalObjects)
+	assert.Equal(t, meta.MinID, stats.MinID)
+	assert.Equal(t, meta.MaxID, stats.MaxID)
+	assert.Equal(t, meta.Size, stats.Size)
+	assert.Equal(t, uint64(1000), stats.UncompressedSize)
+	assert.Greater(t, stats.CompressionRatio(), 1.0)
+	for i, r := range complete.records {
+		assert.Equal(t, r.Start, stats.PageOffsets[i])
+	}
+}
+
+type mockOverrides map[string]float64
+
+func (m mockOverrides) BloomFilterFalsePositive(tenantID string) float64 {
+	return m[tenantID]
 }
 
 func TestWorkDir(t *testing.T) {